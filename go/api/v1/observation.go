@@ -0,0 +1,461 @@
+package v1
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Observation is a message of a sandbox or space stream, in the schema of API version 2: the
+// fields all observations have, and those of its type in Data. DecodeObservation reads
+// messages of either API version into it.
+type Observation struct {
+	Seq       uint64          `json:"seq,omitempty"`
+	Type      string          `json:"type"`
+	ActionID  string          `json:"action_id,omitempty"`
+	Timestamp string          `json:"timestamp,omitempty"` // RFC 3339
+	Metadata  json.RawMessage `json:"metadata,omitempty"`  // Client metadata of the action
+	Data      ObservationData `json:"data"`
+}
+
+// Time returns the parsed Timestamp, or the zero time if it has none.
+func (o Observation) Time() time.Time {
+	t, _ := time.Parse(time.RFC3339Nano, o.Timestamp)
+	return t
+}
+
+// ObservationData is the data of an observation: one of the types below, DisplayData for
+// "display_data" and "execute_result" observations, Progress for "progress" observations,
+// or UnknownObservation.
+type ObservationData interface {
+	isObservationData()
+}
+
+// UnknownObservation is the data of observations of a type DecodeObservation does not know.
+type UnknownObservation struct {
+	Fields json.RawMessage // The fields of the type, as a JSON object
+}
+
+func (o UnknownObservation) MarshalJSON() ([]byte, error) {
+	if len(o.Fields) == 0 {
+		return []byte("{}"), nil
+	}
+	return o.Fields, nil
+}
+
+// StartObservation is the data of "start" observations, sent when an action starts.
+type StartObservation struct{}
+
+// StreamObservation is the data of "stream" observations: a line of an action's output.
+// Binary payloads are base64-encoded; large ones are split into frames sharing a ChunkID,
+// with increasing ChunkIndex and Final set on the last frame.
+type StreamObservation struct {
+	Stream     string `json:"stream"` // "stdout" or "stderr"
+	Line       string `json:"line"`
+	Encoding   string `json:"encoding,omitempty"` // "utf-8" (the default) or "base64"
+	MimeType   string `json:"mime_type,omitempty"`
+	ChunkID    string `json:"chunk_id,omitempty"`
+	ChunkIndex int    `json:"chunk_index,omitempty"`
+	Final      bool   `json:"final,omitempty"`
+	StreamSeq  uint64 `json:"stream_seq,omitempty"`
+	Truncated  bool   `json:"truncated,omitempty"` // Line was cut at the output limit
+	Coalesced  int    `json:"coalesced,omitempty"` // Number of lines batched into Line
+}
+
+// Bytes returns the content of Line, decoding it if it is base64-encoded.
+func (o StreamObservation) Bytes() ([]byte, error) {
+	if o.Encoding == "base64" {
+		return base64.StdEncoding.DecodeString(o.Line)
+	}
+	return []byte(o.Line), nil
+}
+
+// ResourceUsage is what an action used, measured by the agent.
+type ResourceUsage struct {
+	DurationMS  int64 `json:"duration_ms"`
+	UserCPUMS   int64 `json:"user_cpu_ms"`
+	SystemCPUMS int64 `json:"system_cpu_ms"`
+	MaxRSSBytes int64 `json:"max_rss_bytes,omitempty"`
+}
+
+// ResultObservation is the data of "result" observations, sent by the agent when an action
+// finishes; the runtime follows it with an "end" observation. Failed ipython actions carry
+// the exception in ErrorName, ErrorValue and Traceback.
+type ResultObservation struct {
+	ExitCode   *int           `json:"exit_code,omitempty"`
+	Status     string         `json:"status,omitempty"` // "ok" or "error", for ipython actions
+	Error      string         `json:"error,omitempty"`
+	ErrorName  string         `json:"error_name,omitempty"`
+	ErrorValue string         `json:"error_value,omitempty"`
+	Traceback  []string       `json:"traceback,omitempty"`
+	Signal     string         `json:"signal,omitempty"`
+	OOMKilled  bool           `json:"oom_killed,omitempty"`
+	Usage      *ResourceUsage `json:"usage,omitempty"`
+}
+
+// EndObservation is the data of "end" observations, the last observation of an action.
+type EndObservation struct {
+	ExitCode        int            `json:"exit_code"`
+	Error           string         `json:"error,omitempty"`
+	Output          *string        `json:"output,omitempty"` // Aggregated output, for actions asking for it
+	Stdout          *string        `json:"stdout,omitempty"`
+	Stderr          *string        `json:"stderr,omitempty"`
+	OutputTruncated bool           `json:"output_truncated,omitempty"`
+	Signal          string         `json:"signal,omitempty"`
+	OOMKilled       bool           `json:"oom_killed,omitempty"`
+	Usage           *ResourceUsage `json:"usage,omitempty"`
+	CacheHit        bool           `json:"cache_hit,omitempty"`
+}
+
+// ErrorObservation is the data of "error" observations.
+type ErrorObservation struct {
+	Error string `json:"error"`
+}
+
+// TruncatedObservation is the data of "truncated" observations, sent when an action's output
+// reaches its limit.
+type TruncatedObservation struct {
+	Reason     string `json:"reason"`
+	LimitBytes int64  `json:"limit_bytes"`
+}
+
+// OutputSavedObservation is the data of "output_saved" observations: the artifact holding
+// the full output of a truncated action.
+type OutputSavedObservation struct {
+	ArtifactID string `json:"artifact_id"`
+	Name       string `json:"name"`
+	Size       int64  `json:"size"`
+	URL        string `json:"url,omitempty"`
+}
+
+// QueuedObservation is the data of "queued" observations, sent when an action waits in its
+// sandbox's queue.
+type QueuedObservation struct {
+	Position int `json:"position"`
+	Priority int `json:"priority,omitempty"`
+}
+
+// ThrottledObservation is the data of "throttled" observations.
+type ThrottledObservation struct {
+	Reason string `json:"reason"`
+}
+
+// ReplayStepObservation is the data of "replay_step" observations.
+type ReplayStepObservation struct {
+	SourceSandboxID string `json:"source_sandbox_id"`
+	Step            int    `json:"step"`
+	SourceActionID  string `json:"source_action_id"`
+	Match           bool   `json:"match"`
+	Error           string `json:"error,omitempty"`
+}
+
+// ReplayEndObservation is the data of "replay_end" observations.
+type ReplayEndObservation struct {
+	SourceSandboxID string `json:"source_sandbox_id"`
+	Status          string `json:"status"`
+	DivergedAt      *int   `json:"diverged_at,omitempty"`
+}
+
+// ScheduleTriggeredObservation is the data of "schedule_triggered" observations.
+type ScheduleTriggeredObservation struct {
+	ScheduleID string `json:"schedule_id"`
+}
+
+// WorkflowStepObservation is the data of "workflow_step" observations.
+type WorkflowStepObservation struct {
+	WorkflowID string `json:"workflow_id"`
+	Step       int    `json:"step"`
+	Name       string `json:"name,omitempty"`
+	Status     string `json:"status"`
+	ExitCode   *int   `json:"exit_code,omitempty"`
+	Error      string `json:"error,omitempty"`
+}
+
+// WorkflowEndObservation is the data of "workflow_end" observations.
+type WorkflowEndObservation struct {
+	WorkflowID string `json:"workflow_id"`
+	Status     string `json:"status"`
+}
+
+// SandboxKilledObservation is the data of "sandbox_killed" observations.
+type SandboxKilledObservation struct {
+	Reason         string `json:"reason"`
+	DiskUsageBytes int64  `json:"disk_usage_bytes,omitempty"`
+	LimitBytes     int64  `json:"limit_bytes,omitempty"`
+}
+
+// SandboxHealthObservation is the data of "sandbox_health" observations.
+type SandboxHealthObservation struct {
+	Health              string `json:"health"`
+	ConsecutiveFailures int    `json:"consecutive_failures,omitempty"`
+	RestartCount        int    `json:"restart_count,omitempty"`
+	Error               string `json:"error,omitempty"`
+}
+
+// SandboxTerminatedObservation is the data of "sandbox_terminated" observations.
+type SandboxTerminatedObservation struct {
+	Reason   string `json:"reason"`
+	ExitCode int    `json:"exit_code"`
+	Error    string `json:"error,omitempty"`
+}
+
+// SandboxStateObservation is the data of "sandbox_state" observations and space events: a
+// sandbox's phase change. SandboxID is set on space streams.
+type SandboxStateObservation struct {
+	SandboxID string `json:"sandbox_id,omitempty"`
+	State     string `json:"state"`
+	Previous  string `json:"previous,omitempty"`
+	Reason    string `json:"reason,omitempty"`
+}
+
+// StatusObservation is the data of "status" observations, a sandbox's periodic status.
+type StatusObservation struct {
+	State            string  `json:"state"`
+	Running          bool    `json:"running"`
+	Health           string  `json:"health,omitempty"`
+	ActiveActions    int     `json:"active_actions"`
+	QueuedActions    int     `json:"queued_actions,omitempty"`
+	CPUPercent       float64 `json:"cpu_percent,omitempty"`
+	MemoryBytes      uint64  `json:"memory_bytes,omitempty"`
+	MemoryLimitBytes uint64  `json:"memory_limit_bytes,omitempty"`
+}
+
+// CreationProgressObservation is the data of "creation_progress" observations.
+type CreationProgressObservation struct {
+	SandboxID string `json:"sandbox_id"`
+	SpaceID   string `json:"space_id"`
+	Step      string `json:"step"`
+	Image     string `json:"image,omitempty"`
+	Percent   *int   `json:"percent,omitempty"`
+	Error     string `json:"error,omitempty"`
+}
+
+// FsEventObservation is the data of "fs_event" observations: a change under a watched path.
+type FsEventObservation struct {
+	WatchID string `json:"watch_id"`
+	Path    string `json:"path"`
+	Event   string `json:"event"`
+	IsDir   bool   `json:"is_dir,omitempty"`
+}
+
+// SandboxEvent is the data of "sandbox_created" and "sandbox_deleted" space events.
+type SandboxEvent struct {
+	SandboxID string            `json:"sandbox_id"`
+	Image     string            `json:"image,omitempty"`
+	Hostname  string            `json:"hostname,omitempty"`
+	Labels    map[string]string `json:"labels,omitempty"`
+}
+
+// QuotaWarningEvent is the data of "quota_warning" space events.
+type QuotaWarningEvent struct {
+	SandboxID string `json:"sandbox_id"`
+	Quota     string `json:"quota"` // "concurrent_actions" or "disk"
+	Used      int64  `json:"used"`
+	Limit     int64  `json:"limit"`
+}
+
+// ActionCompletedEvent is the data of "action_completed" space events.
+type ActionCompletedEvent struct {
+	SandboxID string `json:"sandbox_id"`
+	ActionID  string `json:"action_id"`
+	ExitCode  int    `json:"exit_code"`
+	Error     string `json:"error,omitempty"`
+	Signal    string `json:"signal,omitempty"`
+	OOMKilled bool   `json:"oom_killed,omitempty"`
+	CacheHit  bool   `json:"cache_hit,omitempty"`
+}
+
+// Budget caps the usage of the sandboxes of a space or tenant.
+type Budget struct {
+	MaxRuntimeHours float64   `json:"max_runtime_hours,omitempty"`
+	MaxCostUnits    float64   `json:"max_cost_units,omitempty"`
+	WarnAt          []float64 `json:"warn_at,omitempty"`
+}
+
+// BudgetEvent is the data of "budget_warning" and "budget_exceeded" space events. Tenant is
+// set for the budgets of tenants, SpaceID for those of spaces.
+type BudgetEvent struct {
+	Tenant       string  `json:"tenant,omitempty"`
+	SpaceID      string  `json:"space_id,omitempty"`
+	Budget       Budget  `json:"budget"`
+	RuntimeHours float64 `json:"runtime_hours"`
+	CostUnits    float64 `json:"cost_units"`
+	Share        float64 `json:"share"`
+	Exceeded     bool    `json:"exceeded"`
+}
+
+func (UnknownObservation) isObservationData()           {}
+func (StartObservation) isObservationData()             {}
+func (StreamObservation) isObservationData()            {}
+func (ResultObservation) isObservationData()            {}
+func (EndObservation) isObservationData()               {}
+func (ErrorObservation) isObservationData()             {}
+func (TruncatedObservation) isObservationData()         {}
+func (OutputSavedObservation) isObservationData()       {}
+func (QueuedObservation) isObservationData()            {}
+func (ThrottledObservation) isObservationData()         {}
+func (ReplayStepObservation) isObservationData()        {}
+func (ReplayEndObservation) isObservationData()         {}
+func (ScheduleTriggeredObservation) isObservationData() {}
+func (WorkflowStepObservation) isObservationData()      {}
+func (WorkflowEndObservation) isObservationData()       {}
+func (SandboxKilledObservation) isObservationData()     {}
+func (SandboxHealthObservation) isObservationData()     {}
+func (SandboxTerminatedObservation) isObservationData() {}
+func (SandboxStateObservation) isObservationData()      {}
+func (StatusObservation) isObservationData()            {}
+func (CreationProgressObservation) isObservationData()  {}
+func (FsEventObservation) isObservationData()           {}
+func (DisplayData) isObservationData()                  {}
+func (Progress) isObservationData()                     {}
+func (SandboxEvent) isObservationData()                 {}
+func (QuotaWarningEvent) isObservationData()            {}
+func (ActionCompletedEvent) isObservationData()         {}
+func (BudgetEvent) isObservationData()                  {}
+
+// observationTypes decode the data of each observation type.
+var observationTypes = map[string]func([]byte) (ObservationData, error){
+	"start":              decodeAs[StartObservation],
+	"stream":             decodeAs[StreamObservation],
+	"result":             decodeAs[ResultObservation],
+	"end":                decodeAs[EndObservation],
+	"error":              decodeAs[ErrorObservation],
+	"truncated":          decodeAs[TruncatedObservation],
+	"output_saved":       decodeAs[OutputSavedObservation],
+	"queued":             decodeAs[QueuedObservation],
+	"throttled":          decodeAs[ThrottledObservation],
+	"replay_step":        decodeAs[ReplayStepObservation],
+	"replay_end":         decodeAs[ReplayEndObservation],
+	"schedule_triggered": decodeAs[ScheduleTriggeredObservation],
+	"workflow_step":      decodeAs[WorkflowStepObservation],
+	"workflow_end":       decodeAs[WorkflowEndObservation],
+	"sandbox_killed":     decodeAs[SandboxKilledObservation],
+	"sandbox_health":     decodeAs[SandboxHealthObservation],
+	"sandbox_terminated": decodeAs[SandboxTerminatedObservation],
+	"sandbox_state":      decodeAs[SandboxStateObservation],
+	"status":             decodeAs[StatusObservation],
+	"creation_progress":  decodeAs[CreationProgressObservation],
+	"fs_event":           decodeAs[FsEventObservation],
+	"display_data":       decodeAs[DisplayData],
+	"execute_result":     decodeAs[DisplayData],
+	"progress":           decodeAs[Progress],
+	"sandbox_created":    decodeAs[SandboxEvent],
+	"sandbox_deleted":    decodeAs[SandboxEvent],
+	"quota_warning":      decodeAs[QuotaWarningEvent],
+	"action_completed":   decodeAs[ActionCompletedEvent],
+	"budget_warning":     decodeAs[BudgetEvent],
+	"budget_exceeded":    decodeAs[BudgetEvent],
+}
+
+func decodeAs[T ObservationData](fields []byte) (ObservationData, error) {
+	var data T
+	err := json.Unmarshal(fields, &data)
+	return data, err
+}
+
+// envelopeFields are the top-level fields of observations that are not data of their type.
+var envelopeFields = []string{"seq", "observation_type", "type", "action_id", "timestamp", "metadata", "data"}
+
+// DecodeObservation decodes an observation message of a sandbox or space stream, in the
+// schema of either API version. Version 1 observations carry the fields of some types, such
+// as the lines of "stream" observations, at the top level rather than under "data". Data is
+// an UnknownObservation for types it does not know.
+func DecodeObservation(message []byte) (Observation, error) {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(message, &fields); err != nil {
+		return Observation{}, err
+	}
+	var obs Observation
+	v1 := fields["observation_type"] != nil
+	typeField := "type"
+	if v1 {
+		typeField = "observation_type"
+	}
+	if err := json.Unmarshal(fields[typeField], &obs.Type); err != nil || obs.Type == "" {
+		return Observation{}, errors.New("observation has no type")
+	}
+	if raw, ok := fields["seq"]; ok {
+		json.Unmarshal(raw, &obs.Seq)
+	}
+	if raw, ok := fields["action_id"]; ok {
+		json.Unmarshal(raw, &obs.ActionID)
+	}
+	if raw, ok := fields["timestamp"]; ok {
+		json.Unmarshal(raw, &obs.Timestamp)
+	}
+	obs.Metadata = fields["metadata"]
+
+	var data []byte
+	var err error
+	switch {
+	case obs.Type == "display_data" || obs.Type == "execute_result":
+		if !v1 {
+			obs.Data, err = decodeTypedDisplay(fields["data"], obs.Metadata)
+			if err != nil {
+				return Observation{}, fmt.Errorf("observation %s: %w", obs.Type, err)
+			}
+			return obs, nil
+		}
+		// The MIME bundle is "data" and its Jupyter metadata "metadata", as DisplayData has them
+		data = message
+	default:
+		data, err = typeFields(fields)
+		if err != nil {
+			return Observation{}, err
+		}
+	}
+	decode, ok := observationTypes[obs.Type]
+	if !ok {
+		obs.Data = UnknownObservation{Fields: data}
+		return obs, nil
+	}
+	if obs.Data, err = decode(data); err != nil {
+		return Observation{}, fmt.Errorf("observation %s: %w", obs.Type, err)
+	}
+	return obs, nil
+}
+
+// typeFields returns the fields of an observation's type as one JSON object: those under
+// "data", and those at the top level that are not envelope fields. Data that is not an
+// object is kept whole under "data".
+func typeFields(fields map[string]json.RawMessage) ([]byte, error) {
+	data := map[string]json.RawMessage{}
+	if raw, ok := fields["data"]; ok && string(raw) != "null" && json.Unmarshal(raw, &data) != nil {
+		data = map[string]json.RawMessage{"data": raw}
+	}
+	for name, raw := range fields {
+		if !isEnvelopeField(name) {
+			data[name] = raw
+		}
+	}
+	return json.Marshal(data)
+}
+
+// decodeTypedDisplay decodes the data of a version 2 display observation, whose MIME bundle
+// is its data alongside execution_count and whose Jupyter metadata is the observation's.
+func decodeTypedDisplay(raw, metadata json.RawMessage) (DisplayData, error) {
+	var display DisplayData
+	if err := json.Unmarshal(raw, &display.Data); err != nil {
+		return DisplayData{}, err
+	}
+	if count, ok := display.Data["execution_count"].(float64); ok {
+		n := int(count)
+		display.ExecutionCount = &n
+		delete(display.Data, "execution_count")
+	}
+	if len(metadata) > 0 {
+		json.Unmarshal(metadata, &display.Metadata)
+	}
+	return display, nil
+}
+
+func isEnvelopeField(name string) bool {
+	for _, field := range envelopeFields {
+		if name == field {
+			return true
+		}
+	}
+	return false
+}
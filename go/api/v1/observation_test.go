@@ -0,0 +1,84 @@
+package v1
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestDecodeObservation_version1(t *testing.T) {
+	obs, err := DecodeObservation([]byte(`{"seq":4,"observation_type":"stream","action_id":"a1","timestamp":"2026-10-17T10:00:00.5Z","metadata":{"step":1},"stream":"stdout","line":"hi\n","stream_seq":2}`))
+	require.NoError(t, err)
+	require.Equal(t, uint64(4), obs.Seq)
+	require.Equal(t, "stream", obs.Type)
+	require.Equal(t, "a1", obs.ActionID)
+	require.Equal(t, time.Date(2026, time.October, 17, 10, 0, 0, 5e8, time.UTC), obs.Time())
+	require.JSONEq(t, `{"step":1}`, string(obs.Metadata))
+	require.Equal(t, StreamObservation{Stream: "stdout", Line: "hi\n", StreamSeq: 2}, obs.Data)
+
+	obs, err = DecodeObservation([]byte(`{"observation_type":"end","action_id":"a1","data":{"exit_code":3,"signal":"SIGKILL"}}`))
+	require.NoError(t, err)
+	require.Equal(t, EndObservation{ExitCode: 3, Signal: "SIGKILL"}, obs.Data)
+
+	obs, err = DecodeObservation([]byte(`{"observation_type":"fs_event","action_id":"","watch_id":"w1","data":{"watch_id":"w1","path":"/a","event":"create"}}`))
+	require.NoError(t, err)
+	require.Equal(t, FsEventObservation{WatchID: "w1", Path: "/a", Event: "create"}, obs.Data)
+
+	obs, err = DecodeObservation([]byte(`{"observation_type":"progress","action_id":"a1","percent":40,"message":"numpy","eta_seconds":1.5}`))
+	require.NoError(t, err)
+	percent, eta := 40.0, 1.5
+	require.Equal(t, Progress{Percent: &percent, Message: "numpy", EtaSeconds: &eta}, obs.Data)
+}
+
+func TestDecodeObservation_version2(t *testing.T) {
+	obs, err := DecodeObservation([]byte(`{"seq":1,"type":"sandbox_state","data":{"sandbox_id":"s1","state":"running","previous":"creating"}}`))
+	require.NoError(t, err)
+	require.Equal(t, "sandbox_state", obs.Type)
+	require.Equal(t, SandboxStateObservation{SandboxID: "s1", State: "running", Previous: "creating"}, obs.Data)
+
+	// Decoding what an Observation marshals to gives it back
+	message, err := json.Marshal(obs)
+	require.NoError(t, err)
+	again, err := DecodeObservation(message)
+	require.NoError(t, err)
+	require.Equal(t, obs, again)
+}
+
+func TestDecodeObservation_display(t *testing.T) {
+	count := 2
+	want := DisplayData{Data: map[string]interface{}{"text/plain": "4"}, Metadata: map[string]interface{}{"isolated": true}, ExecutionCount: &count}
+
+	obs, err := DecodeObservation([]byte(`{"observation_type":"execute_result","action_id":"a1","data":{"text/plain":"4"},"metadata":{"isolated":true},"execution_count":2}`))
+	require.NoError(t, err)
+	require.Equal(t, want, obs.Data)
+
+	obs, err = DecodeObservation([]byte(`{"type":"execute_result","action_id":"a1","metadata":{"isolated":true},"data":{"text/plain":"4","execution_count":2}}`))
+	require.NoError(t, err)
+	require.Equal(t, want, obs.Data)
+}
+
+func TestDecodeObservation_unknownAndInvalid(t *testing.T) {
+	obs, err := DecodeObservation([]byte(`{"observation_type":"shutdown","action_id":null,"terminated_commands":0}`))
+	require.NoError(t, err)
+	unknown, ok := obs.Data.(UnknownObservation)
+	require.True(t, ok)
+	require.JSONEq(t, `{"terminated_commands":0}`, string(unknown.Fields))
+
+	_, err = DecodeObservation([]byte(`{"action_id":"a1"}`))
+	require.Error(t, err)
+	_, err = DecodeObservation([]byte(`{"observation_type":"end","data":{"exit_code":"zero"}}`))
+	require.ErrorContains(t, err, "observation end")
+	_, err = DecodeObservation([]byte(`[]`))
+	require.Error(t, err)
+}
+
+func TestStreamObservation_Bytes(t *testing.T) {
+	data, err := StreamObservation{Line: "aGk=", Encoding: "base64"}.Bytes()
+	require.NoError(t, err)
+	require.Equal(t, []byte("hi"), data)
+	data, err = StreamObservation{Line: "aGk="}.Bytes()
+	require.NoError(t, err)
+	require.Equal(t, []byte("aGk="), data)
+}
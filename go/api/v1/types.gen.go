@@ -12,12 +12,48 @@ type CreateSandboxRequest struct {
 	Spec SandboxSpec `json:"spec"`
 }
 
+// DisplayData A Jupyter MIME bundle, sent by ipython actions as display_data (display() calls) and execute_result (the value of the cell's last expression) observations.
+type DisplayData struct {
+	// Data Representations of the output keyed by MIME type (e.g. text/plain, text/html, image/png, application/json). Binary representations are base64-encoded.
+	Data map[string]interface{} `json:"data"`
+
+	// ExecutionCount Execution count of the cell, for execute_result observations.
+	ExecutionCount *int `json:"execution_count,omitempty"`
+
+	// Metadata Jupyter metadata for the representations, such as image sizes.
+	Metadata map[string]interface{} `json:"metadata,omitempty"`
+}
+
 // Error defines model for Error.
 type Error struct {
 	// Message The error message.
 	Message string `json:"message"`
 }
 
+// IPythonError Error details carried by the result observation of a failed ipython action.
+type IPythonError struct {
+	// ErrorName Name of the exception class.
+	ErrorName string `json:"error_name,omitempty"`
+
+	// ErrorValue String value of the exception.
+	ErrorValue string `json:"error_value,omitempty"`
+
+	// Traceback Formatted traceback lines.
+	Traceback []string `json:"traceback,omitempty"`
+}
+
+// Progress Progress of a long action, sent by the agent as progress observations. The runtime drops invalid ones and forwards at most a few per second.
+type Progress struct {
+	// EtaSeconds Estimated seconds until the action completes, set by the runtime from the rate of progress so far.
+	EtaSeconds *float64 `json:"eta_seconds,omitempty"`
+
+	// Message What the action is doing, such as the package being installed.
+	Message string `json:"message,omitempty"`
+
+	// Percent Completion of the action in percent. Unset if the agent cannot tell how far along the action is.
+	Percent *float64 `json:"percent,omitempty"`
+}
+
 // RunIPythonCellRequest The cell to run.
 type RunIPythonCellRequest struct {
 	// Code The code to run in the IPython kernel.
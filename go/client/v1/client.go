@@ -135,11 +135,33 @@ func (c *Client) GetSandbox(ctx context.Context, space, name string) (*v1.Sandbo
 	return &response, nil
 }
 
+// DeleteOption configures DeleteSandbox.
+type DeleteOption func(*deleteOptions)
+
+type deleteOptions struct {
+	ignoreNotFound bool
+}
+
+// IgnoreNotFound makes DeleteSandbox succeed if the sandbox does not exist, so retried
+// deletes are safe.
+func IgnoreNotFound() DeleteOption {
+	return func(o *deleteOptions) {
+		o.ignoreNotFound = true
+	}
+}
+
 // DeleteSandbox deletes a specific sandbox.
-func (c *Client) DeleteSandbox(ctx context.Context, space, name string) error {
+func (c *Client) DeleteSandbox(ctx context.Context, space, name string, opts ...DeleteOption) error {
+	var options deleteOptions
+	for _, opt := range opts {
+		opt(&options)
+	}
 	// --- CORRECTED URL ---
 	url := fmt.Sprintf("%s/v1/spaces/%s/sandboxes/%s", c.BaseURL, space, name) // Added /v1
 	// --- END CORRECTION ---
+	if options.ignoreNotFound {
+		url += "?ignore_not_found=true"
+	}
 	req, err := http.NewRequestWithContext(ctx, http.MethodDelete, url, nil)
 	if err != nil {
 		return err
@@ -154,6 +176,9 @@ func (c *Client) DeleteSandbox(ctx context.Context, space, name string) error {
 	if err := validateResponse(resp, http.StatusNoContent); err != nil {
 		// Check if it was a 404 (already deleted or never existed)
 		if resp.StatusCode == http.StatusNotFound {
+			if options.ignoreNotFound {
+				return nil // Servers without ignore_not_found, or a deleted space
+			}
 			return ErrSandboxNotFound // Return specific error for 404
 		}
 		return err // Return generic validation error for other statuses
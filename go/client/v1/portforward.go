@@ -0,0 +1,153 @@
+package v1
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+
+	"github.com/gorilla/websocket"
+)
+
+// PortForwarder listens on a local address and tunnels each connection it accepts to a TCP
+// port of a sandbox, through a WebSocket to the runtime.
+type PortForwarder struct {
+	listener net.Listener
+	endpoint string
+	dialer   websocket.Dialer
+
+	mu     sync.Mutex
+	conns  map[net.Conn]struct{}
+	closed bool
+}
+
+// PortForward forwards remotePort of a sandbox to a local port on the loopback interface,
+// until ctx is done or Close is called. Open Addr in a browser to reach a server running in
+// the sandbox.
+func (c *Client) PortForward(ctx context.Context, space, sandbox string, remotePort int) (*PortForwarder, error) {
+	if remotePort < 1 || remotePort > 65535 {
+		return nil, fmt.Errorf("invalid port %d", remotePort)
+	}
+	if _, err := c.GetSandbox(ctx, space, sandbox); err != nil {
+		return nil, err
+	}
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, err
+	}
+	f := &PortForwarder{
+		listener: listener,
+		endpoint: fmt.Sprintf("ws%s/v1/spaces/%s/sandboxes/%s/ports/%d/forward", strings.TrimPrefix(c.BaseURL, "http"), url.PathEscape(space), url.PathEscape(sandbox), remotePort),
+		dialer: websocket.Dialer{
+			Proxy:            http.ProxyFromEnvironment,
+			HandshakeTimeout: websocket.DefaultDialer.HandshakeTimeout,
+		},
+		conns: make(map[net.Conn]struct{}),
+	}
+	go func() {
+		<-ctx.Done()
+		f.Close()
+	}()
+	go f.serve()
+	return f, nil
+}
+
+// Addr returns the local address connections are accepted on.
+func (f *PortForwarder) Addr() net.Addr {
+	return f.listener.Addr()
+}
+
+// Close stops accepting connections and closes those being forwarded.
+func (f *PortForwarder) Close() error {
+	f.mu.Lock()
+	if f.closed {
+		f.mu.Unlock()
+		return nil
+	}
+	f.closed = true
+	conns := f.conns
+	f.conns = nil
+	f.mu.Unlock()
+
+	err := f.listener.Close()
+	for conn := range conns {
+		conn.Close()
+	}
+	return err
+}
+
+func (f *PortForwarder) serve() {
+	for {
+		conn, err := f.listener.Accept()
+		if err != nil {
+			return
+		}
+		go f.forward(conn)
+	}
+}
+
+// track records a connection so Close closes it, or reports false if f is closed.
+func (f *PortForwarder) track(conn net.Conn) bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.closed {
+		return false
+	}
+	f.conns[conn] = struct{}{}
+	return true
+}
+
+func (f *PortForwarder) untrack(conn net.Conn) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	delete(f.conns, conn)
+}
+
+// forward tunnels a local connection until either side closes it.
+func (f *PortForwarder) forward(local net.Conn) {
+	defer local.Close()
+	if !f.track(local) {
+		return
+	}
+	defer f.untrack(local)
+	remote, _, err := f.dialer.Dial(f.endpoint, nil)
+	if err != nil {
+		return
+	}
+	defer remote.Close()
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		defer local.Close()
+		for {
+			kind, data, err := remote.ReadMessage()
+			if err != nil {
+				return
+			}
+			if kind != websocket.BinaryMessage {
+				continue
+			}
+			if _, err := local.Write(data); err != nil {
+				return
+			}
+		}
+	}()
+	buf := make([]byte, 32*1024)
+	for {
+		n, err := local.Read(buf)
+		if n > 0 {
+			if werr := remote.WriteMessage(websocket.BinaryMessage, buf[:n]); werr != nil {
+				break
+			}
+		}
+		if err != nil {
+			break
+		}
+	}
+	remote.Close()
+	<-done
+}
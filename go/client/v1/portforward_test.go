@@ -0,0 +1,42 @@
+package v1_test
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	client "github.com/foreveryh/sandboxai/go/client/v1"
+	"github.com/foreveryh/sandboxai/go/mentisruntime/fake"
+	"github.com/foreveryh/sandboxai/go/mentisruntime/handler"
+	"github.com/foreveryh/sandboxai/go/mentisruntime/testharness"
+)
+
+func TestPortForward(t *testing.T) {
+	h := testharness.New(t)
+	spaceID := h.CreateSpace("forward")
+	sandboxID := h.CreateSandbox(spaceID, handler.CreateSandboxRequest{})
+
+	// The service port is published, so the fake agent serving it is reachable through the tunnel
+	c := client.NewClient(h.URL)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	forwarder, err := c.PortForward(ctx, spaceID, sandboxID, fake.ServicePort)
+	require.NoError(t, err)
+	for i := 0; i < 2; i++ {
+		resp, err := http.Get("http://" + forwarder.Addr().String() + "/health")
+		require.NoError(t, err)
+		resp.Body.Close()
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+	}
+	require.NoError(t, forwarder.Close())
+	_, err = http.Get("http://" + forwarder.Addr().String() + "/health")
+	require.Error(t, err)
+
+	_, err = c.PortForward(ctx, spaceID, "missing", fake.ServicePort)
+	require.ErrorIs(t, err, client.ErrSandboxNotFound)
+	require.Equal(t, http.StatusBadRequest, h.Do("GET", "/v1/spaces/"+spaceID+"/sandboxes/"+sandboxID+"/ports/0/forward", nil, nil))
+	// The agent is only called by the runtime
+	require.Equal(t, http.StatusBadRequest, h.Do("GET", "/v1/spaces/"+spaceID+"/sandboxes/"+sandboxID+"/ports/8000/forward", nil, nil))
+}
@@ -0,0 +1,242 @@
+package v1
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"path"
+	"sync"
+	"time"
+
+	v1 "github.com/foreveryh/sandboxai/go/api/v1"
+)
+
+// ErrSandboxClosed is returned by the methods of a Sandbox after Close.
+var ErrSandboxClosed = fmt.Errorf("sandbox closed")
+
+// autoCleanupTimeout bounds the deletion of a sandbox once the context of WithAutoCleanup is done.
+const autoCleanupTimeout = 30 * time.Second
+
+// Sandbox is a handle on one sandbox of a space, which it creates on first use and threads
+// through every call. Close deletes it.
+type Sandbox struct {
+	client *Client
+	space  string
+	spec   v1.SandboxSpec
+
+	mu          sync.Mutex
+	id          string
+	closed      bool
+	stopCleanup func() bool
+}
+
+// SandboxOption configures a Sandbox.
+type SandboxOption func(*Sandbox)
+
+// WithAutoCleanup deletes the sandbox once ctx is done, as if Close was called.
+func WithAutoCleanup(ctx context.Context) SandboxOption {
+	return func(s *Sandbox) {
+		s.stopCleanup = context.AfterFunc(ctx, func() {
+			ctx, cancel := context.WithTimeout(context.Background(), autoCleanupTimeout)
+			defer cancel()
+			s.Close(ctx)
+		})
+	}
+}
+
+// NewSandbox returns a handle on a sandbox of a space running spec's image and environment.
+// Nothing is created until EnsureCreated or the first call that needs the sandbox.
+func (c *Client) NewSandbox(space string, spec v1.SandboxSpec, opts ...SandboxOption) *Sandbox {
+	s := &Sandbox{client: c, space: space, spec: spec}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
+}
+
+// RunResult is the output of a command or cell run in a Sandbox.
+type RunResult struct {
+	ActionID string
+	Stdout   string
+	Stderr   string
+	ExitCode int
+}
+
+// Space returns the space of the sandbox.
+func (s *Sandbox) Space() string { return s.space }
+
+// ID returns the ID of the sandbox, or "" until it is created.
+func (s *Sandbox) ID() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.id
+}
+
+// EnsureCreated creates the sandbox unless it already was, and returns its ID.
+func (s *Sandbox) EnsureCreated(ctx context.Context) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return "", ErrSandboxClosed
+	}
+	if s.id != "" {
+		return s.id, nil
+	}
+	id, err := s.client.createSandbox(ctx, s.space, s.spec)
+	if err != nil {
+		return "", err
+	}
+	s.id = id
+	return id, nil
+}
+
+// Run runs a shell command in the sandbox and waits for it to end. A command that fails
+// is reported through RunResult.ExitCode, not an error.
+func (s *Sandbox) Run(ctx context.Context, command string) (*RunResult, error) {
+	return s.run(ctx, "run_shell_command", v1.RunShellCommandRequest{Command: command})
+}
+
+// RunPython runs code in the sandbox's IPython kernel and waits for it to end. Only the
+// cell's stdout and stderr are collected, not its display data.
+func (s *Sandbox) RunPython(ctx context.Context, code string) (*RunResult, error) {
+	return s.run(ctx, "run_ipython_cell", v1.RunIPythonCellRequest{Code: code})
+}
+
+// UploadFile copies a local file to an absolute path of the sandbox, creating its missing
+// parent directories.
+func (s *Sandbox) UploadFile(ctx context.Context, localPath, remotePath string) error {
+	id, err := s.EnsureCreated(ctx)
+	if err != nil {
+		return err
+	}
+	if !path.IsAbs(remotePath) {
+		return fmt.Errorf("sandbox path %q is not absolute", remotePath)
+	}
+	_, err = s.client.uploadFile(ctx, s.space, id, localPath, path.Dir(remotePath), path.Base(remotePath))
+	return err
+}
+
+// Close deletes the sandbox, if it was created. It is safe to call more than once.
+func (s *Sandbox) Close(ctx context.Context) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return nil
+	}
+	if s.stopCleanup != nil {
+		s.stopCleanup()
+	}
+	if s.id != "" {
+		if err := s.client.DeleteSandbox(ctx, s.space, s.id, IgnoreNotFound()); err != nil {
+			return err
+		}
+	}
+	s.closed = true
+	return nil
+}
+
+func (s *Sandbox) run(ctx context.Context, tool string, request interface{}) (*RunResult, error) {
+	id, err := s.EnsureCreated(ctx)
+	if err != nil {
+		return nil, err
+	}
+	actionID, err := s.client.startAction(ctx, s.space, id, tool, request)
+	if err != nil {
+		return nil, err
+	}
+	stream, err := s.client.StreamAction(ctx, id, actionID)
+	if err != nil {
+		return nil, err
+	}
+	defer stream.Close()
+
+	var stdout, stderr bytes.Buffer
+	stdoutCh, stderrCh := stream.Stdout(), stream.Stderr()
+	for stdoutCh != nil || stderrCh != nil {
+		select {
+		case out, ok := <-stdoutCh:
+			if !ok {
+				stdoutCh = nil
+			}
+			stdout.Write(out)
+		case out, ok := <-stderrCh:
+			if !ok {
+				stderrCh = nil
+			}
+			stderr.Write(out)
+		}
+	}
+	result := <-stream.Done()
+	if result.Err != nil {
+		return nil, fmt.Errorf("action %s: %w", actionID, result.Err)
+	}
+	return &RunResult{ActionID: actionID, Stdout: stdout.String(), Stderr: stderr.String(), ExitCode: result.ExitCode}, nil
+}
+
+// createSandbox creates a sandbox running spec and returns its ID.
+func (c *Client) createSandbox(ctx context.Context, space string, spec v1.SandboxSpec) (string, error) {
+	body, err := json.Marshal(spec)
+	if err != nil {
+		return "", err
+	}
+	endpoint := fmt.Sprintf("%s/v1/spaces/%s/sandboxes", c.BaseURL, url.PathEscape(space))
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(body))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := c.httpc.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if err := validateResponse(resp, http.StatusCreated); err != nil {
+		return "", err
+	}
+	var response struct {
+		SandboxID string `json:"sandbox_id"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
+		return "", err
+	}
+	if response.SandboxID == "" {
+		return "", fmt.Errorf("create sandbox: no sandbox_id in response")
+	}
+	return response.SandboxID, nil
+}
+
+// startAction starts an action of a tool ("run_shell_command" or "run_ipython_cell") and
+// returns its ID.
+func (c *Client) startAction(ctx context.Context, space, name, tool string, request interface{}) (string, error) {
+	body, err := json.Marshal(request)
+	if err != nil {
+		return "", err
+	}
+	endpoint := fmt.Sprintf("%s/v1/spaces/%s/sandboxes/%s/tools:%s", c.BaseURL, url.PathEscape(space), url.PathEscape(name), tool)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(body))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := c.httpc.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return "", ErrSandboxNotFound
+	}
+	if err := validateResponse(resp, http.StatusAccepted); err != nil {
+		return "", err
+	}
+	var response struct {
+		ActionID string `json:"action_id"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
+		return "", err
+	}
+	return response.ActionID, nil
+}
@@ -0,0 +1,84 @@
+package v1_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	v1 "github.com/foreveryh/sandboxai/go/api/v1"
+	client "github.com/foreveryh/sandboxai/go/client/v1"
+	"github.com/foreveryh/sandboxai/go/mentisruntime/fake"
+	"github.com/foreveryh/sandboxai/go/mentisruntime/testharness"
+)
+
+func TestSandboxHandle(t *testing.T) {
+	h := testharness.New(t, testharness.WithShell(func(command string) fake.Result {
+		if command == "print(1 / 0)" {
+			return fake.Result{Stderr: "ZeroDivisionError\n", ExitCode: 1}
+		}
+		return fake.Echo(command)
+	}))
+	spaceID := h.CreateSpace("handle")
+	c := client.NewClient(h.URL)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	sb := c.NewSandbox(spaceID, v1.SandboxSpec{})
+	require.Empty(t, sb.ID())
+	// Run creates the sandbox on first use
+	result, err := sb.Run(ctx, "echo hi")
+	require.NoError(t, err)
+	require.Equal(t, "hi", result.Stdout)
+	require.Equal(t, 0, result.ExitCode)
+	id := sb.ID()
+	require.NotEmpty(t, id)
+	again, err := sb.EnsureCreated(ctx)
+	require.NoError(t, err)
+	require.Equal(t, id, again)
+
+	result, err = sb.RunPython(ctx, "print(1 / 0)")
+	require.NoError(t, err)
+	require.Equal(t, 1, result.ExitCode)
+	require.Equal(t, "ZeroDivisionError\n", result.Stderr)
+
+	local := filepath.Join(t.TempDir(), "data.csv")
+	require.NoError(t, os.WriteFile(local, []byte("a,b\n"), 0o644))
+	require.NoError(t, sb.UploadFile(ctx, local, "/work/in/data.csv"))
+	state, err := h.Manager.GetSandbox(ctx, id)
+	require.NoError(t, err)
+	data, ok := h.Docker.ReadFile(state.ContainerID, "/work/in/data.csv")
+	require.True(t, ok)
+	require.Equal(t, "a,b\n", string(data))
+
+	require.NoError(t, sb.Close(ctx))
+	require.NoError(t, sb.Close(ctx))
+	_, err = c.GetSandbox(ctx, spaceID, id)
+	require.ErrorIs(t, err, client.ErrSandboxNotFound)
+	require.ErrorIs(t, c.DeleteSandbox(ctx, spaceID, id), client.ErrSandboxNotFound)
+	require.NoError(t, c.DeleteSandbox(ctx, spaceID, id, client.IgnoreNotFound()))
+	_, err = sb.Run(ctx, "echo hi")
+	require.ErrorIs(t, err, client.ErrSandboxClosed)
+}
+
+func TestSandboxAutoCleanup(t *testing.T) {
+	h := testharness.New(t)
+	spaceID := h.CreateSpace("cleanup")
+	c := client.NewClient(h.URL)
+
+	scope, cancel := context.WithCancel(context.Background())
+	sb := c.NewSandbox(spaceID, v1.SandboxSpec{}, client.WithAutoCleanup(scope))
+	id, err := sb.EnsureCreated(context.Background())
+	require.NoError(t, err)
+
+	cancel()
+	require.Eventually(t, func() bool {
+		_, err := c.GetSandbox(context.Background(), spaceID, id)
+		return err == client.ErrSandboxNotFound
+	}, 5*time.Second, 10*time.Millisecond)
+	_, err = sb.EnsureCreated(context.Background())
+	require.ErrorIs(t, err, client.ErrSandboxClosed)
+}
@@ -0,0 +1,172 @@
+package v1
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/gorilla/websocket"
+
+	v1 "github.com/foreveryh/sandboxai/go/api/v1"
+)
+
+// actionStreamBuffer is the number of outputs an ActionStream holds for a receiver that has
+// not read them yet.
+const actionStreamBuffer = 64
+
+// ActionResult is how an action ended, sent on ActionStream.Done.
+type ActionResult struct {
+	ExitCode int                // -1 if the stream ended before the action did
+	End      *v1.EndObservation // The action's "end" observation, if it was received
+	Err      error              // Why the stream ended before the action did
+}
+
+// ActionStream is the output of one action, read from the observation stream of its
+// sandbox. Like the pipes of an exec.Cmd, Stdout and Stderr must both be read until they
+// are closed, or the stream stops reading; Done then receives the result.
+type ActionStream struct {
+	ActionID string
+
+	conn   *websocket.Conn
+	stdout chan []byte
+	stderr chan []byte
+	done   chan ActionResult
+}
+
+// StreamAction subscribes to the observations of an action. The sandbox's stream is read
+// from its first recorded observation, so the action may have been started before the call.
+// The stream ends when the action does, ctx is done, or Close is called.
+func (c *Client) StreamAction(ctx context.Context, sandboxID, actionID string) (*ActionStream, error) {
+	endpoint := "ws" + strings.TrimPrefix(c.BaseURL, "http") + "/v2/sandboxes/" + url.PathEscape(sandboxID) + "/stream?cursor=0"
+	dialer := websocket.Dialer{
+		Proxy:            http.ProxyFromEnvironment,
+		HandshakeTimeout: websocket.DefaultDialer.HandshakeTimeout,
+		Subprotocols:     []string{"observations.v2.json"},
+	}
+	conn, resp, err := dialer.DialContext(ctx, endpoint, nil)
+	if err != nil {
+		if resp != nil && resp.StatusCode == http.StatusNotFound {
+			return nil, ErrSandboxNotFound
+		}
+		return nil, fmt.Errorf("subscribe to sandbox %s: %w", sandboxID, err)
+	}
+
+	s := &ActionStream{
+		ActionID: actionID,
+		conn:     conn,
+		stdout:   make(chan []byte, actionStreamBuffer),
+		stderr:   make(chan []byte, actionStreamBuffer),
+		done:     make(chan ActionResult, 1),
+	}
+	stop := make(chan struct{})
+	go func() {
+		select {
+		case <-ctx.Done():
+			conn.Close() // Ends the read below
+		case <-stop:
+		}
+	}()
+	go func() {
+		defer close(stop)
+		s.read(ctx)
+	}()
+	return s, nil
+}
+
+// Stdout returns the action's standard output, one message per stream observation or raw
+// output frame. It is closed when the stream ends.
+func (s *ActionStream) Stdout() <-chan []byte { return s.stdout }
+
+// Stderr returns the action's standard error, like Stdout.
+func (s *ActionStream) Stderr() <-chan []byte { return s.stderr }
+
+// Done receives the result once the stream has ended, after Stdout and Stderr are closed.
+func (s *ActionStream) Done() <-chan ActionResult { return s.done }
+
+// Close ends the stream without waiting for the action.
+func (s *ActionStream) Close() error {
+	return s.conn.Close()
+}
+
+func (s *ActionStream) read(ctx context.Context) {
+	result := ActionResult{ExitCode: -1}
+	defer func() {
+		s.conn.Close()
+		close(s.stdout)
+		close(s.stderr)
+		s.done <- result
+		close(s.done)
+	}()
+	for {
+		kind, message, err := s.conn.ReadMessage()
+		if err != nil {
+			if ctx.Err() != nil {
+				err = ctx.Err()
+			}
+			result.Err = err
+			return
+		}
+
+		var stream string
+		var output []byte
+		if kind == websocket.BinaryMessage {
+			actionID, code, out, ok := parseOutputFrame(message)
+			if !ok || actionID != s.ActionID {
+				continue
+			}
+			stream, output = "stdout", out
+			if code == streamStderr {
+				stream = "stderr"
+			}
+		} else {
+			obs, err := v1.DecodeObservation(message)
+			if err != nil || obs.ActionID != s.ActionID {
+				continue
+			}
+			switch data := obs.Data.(type) {
+			case v1.StreamObservation:
+				if output, err = data.Bytes(); err != nil {
+					continue
+				}
+				stream = data.Stream
+			case v1.EndObservation:
+				result = ActionResult{ExitCode: data.ExitCode, End: &data}
+				return
+			default:
+				continue
+			}
+		}
+
+		out := s.stdout
+		if stream == "stderr" {
+			out = s.stderr
+		}
+		select {
+		case out <- output:
+		case <-ctx.Done():
+			result.Err = ctx.Err()
+			return
+		}
+	}
+}
+
+// Binary frames of observation streams carry raw action output: byte 0 is frameOutput,
+// byte 1 the stream, byte 2 the length n of the action ID, followed by the action ID and
+// the output.
+const (
+	frameOutput  byte = 1
+	streamStderr byte = 2
+)
+
+func parseOutputFrame(frame []byte) (actionID string, stream byte, output []byte, ok bool) {
+	if len(frame) < 3 || frame[0] != frameOutput {
+		return "", 0, nil, false
+	}
+	end := 3 + int(frame[2])
+	if len(frame) < end {
+		return "", 0, nil, false
+	}
+	return string(frame[3:end]), frame[1], frame[end:], true
+}
@@ -0,0 +1,57 @@
+package v1_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	client "github.com/foreveryh/sandboxai/go/client/v1"
+	"github.com/foreveryh/sandboxai/go/mentisruntime/fake"
+	"github.com/foreveryh/sandboxai/go/mentisruntime/handler"
+	"github.com/foreveryh/sandboxai/go/mentisruntime/testharness"
+)
+
+func TestStreamAction(t *testing.T) {
+	h := testharness.New(t, testharness.WithShell(func(command string) fake.Result {
+		return fake.Result{Stdout: "out\n", Stderr: "err\n", ExitCode: 3}
+	}))
+	spaceID := h.CreateSpace("client")
+	sandboxID := h.CreateSandbox(spaceID, handler.CreateSandboxRequest{})
+	h.RunShell(spaceID, sandboxID, "first")
+	actionID := h.RunShell(spaceID, sandboxID, "second")
+	h.Observe(sandboxID).Action(actionID)
+
+	c := client.NewClient(h.URL)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	stream, err := c.StreamAction(ctx, sandboxID, actionID)
+	require.NoError(t, err)
+
+	var stdout, stderr string
+	stdoutCh, stderrCh := stream.Stdout(), stream.Stderr()
+	for stdoutCh != nil || stderrCh != nil {
+		select {
+		case out, ok := <-stdoutCh:
+			if !ok {
+				stdoutCh = nil
+			}
+			stdout += string(out)
+		case out, ok := <-stderrCh:
+			if !ok {
+				stderrCh = nil
+			}
+			stderr += string(out)
+		}
+	}
+	result := <-stream.Done()
+	require.NoError(t, result.Err)
+	require.Equal(t, 3, result.ExitCode)
+	require.NotNil(t, result.End)
+	require.Equal(t, "out", stdout)
+	require.Equal(t, "err", stderr)
+
+	_, err = c.StreamAction(ctx, "missing", actionID)
+	require.ErrorIs(t, err, client.ErrSandboxNotFound)
+}
@@ -0,0 +1,364 @@
+package v1
+
+import (
+	"archive/tar"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// ErrPathNotFound is returned when a path does not exist in a sandbox.
+var ErrPathNotFound = fmt.Errorf("path not found")
+
+// DefaultSyncConcurrency is the number of files UploadDir and DownloadDir copy at once when
+// SyncOptions.Concurrency is not set.
+const DefaultSyncConcurrency = 4
+
+// SyncOptions selects the files UploadDir and DownloadDir copy. Patterns use path.Match
+// syntax and are matched against the path of a file relative to the synced directory, with
+// "/" separators, and against each of its parent directories; patterns without a "/" are
+// also matched against the base names, so "*.pyc" and "node_modules" apply at any depth.
+type SyncOptions struct {
+	Include     []string // Files to copy; all if empty. Directories are always walked
+	Exclude     []string // Files and directories not to copy, even if included
+	Concurrency int      // Files copied at once; DefaultSyncConcurrency if zero
+}
+
+// SyncResult reports what UploadDir or DownloadDir did, by relative path.
+type SyncResult struct {
+	Copied  []string // Files that were missing or differed
+	Skipped []string // Files whose checksum already matched
+	Bytes   int64    // Of the copied files
+}
+
+// FileChecksum is the checksum of a regular file below a path of a sandbox.
+type FileChecksum struct {
+	Path   string `json:"path"` // Relative to the path, with "/" separators; empty for the path itself
+	Size   int64  `json:"size"`
+	Mode   int64  `json:"mode"`
+	SHA256 string `json:"sha256"`
+}
+
+// FileChecksums returns the checksums of the regular files at or below an absolute path of a
+// sandbox, or ErrPathNotFound.
+func (c *Client) FileChecksums(ctx context.Context, space, name, remotePath string) ([]FileChecksum, error) {
+	resp, err := c.filesRequest(ctx, http.MethodGet, space, name, "files:checksums", remotePath, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if err := validateResponse(resp, http.StatusOK); err != nil {
+		return nil, err
+	}
+	var response struct {
+		Files []FileChecksum `json:"files"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
+		return nil, err
+	}
+	return response.Files, nil
+}
+
+// UploadDir copies the files of a local directory into a directory of a sandbox, creating
+// it if needed. Files whose checksum matches the sandbox's copy are skipped; files only in
+// the sandbox are left alone.
+func (c *Client) UploadDir(ctx context.Context, space, name, localDir, remoteDir string, opts SyncOptions) (*SyncResult, error) {
+	remote, err := c.FileChecksums(ctx, space, name, remoteDir)
+	if err != nil && !errors.Is(err, ErrPathNotFound) {
+		return nil, err
+	}
+	existing := make(map[string]string, len(remote))
+	for _, file := range remote {
+		existing[file.Path] = file.SHA256
+	}
+
+	var files []string
+	err = filepath.WalkDir(localDir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(localDir, p)
+		if err != nil || rel == "." {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		if opts.excluded(rel) {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if d.Type().IsRegular() && opts.included(rel) {
+			files = append(files, rel)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	result := &SyncResult{}
+	var changed []string
+	for _, rel := range files {
+		sum, err := fileChecksum(filepath.Join(localDir, filepath.FromSlash(rel)))
+		if err != nil {
+			return nil, err
+		}
+		if existing[rel] == sum {
+			result.Skipped = append(result.Skipped, rel)
+		} else {
+			changed = append(changed, rel)
+		}
+	}
+	err = result.copyAll(ctx, opts.Concurrency, changed, func(ctx context.Context, rel string) (int64, error) {
+		return c.uploadFile(ctx, space, name, filepath.Join(localDir, filepath.FromSlash(rel)), remoteDir, rel)
+	})
+	return result, err
+}
+
+// DownloadDir copies the files of a directory of a sandbox into a local directory, creating
+// it if needed. Files whose checksum matches the local copy are skipped; local files not in
+// the sandbox are left alone.
+func (c *Client) DownloadDir(ctx context.Context, space, name, remoteDir, localDir string, opts SyncOptions) (*SyncResult, error) {
+	remote, err := c.FileChecksums(ctx, space, name, remoteDir)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &SyncResult{}
+	var changed []string
+	for _, file := range remote {
+		if file.Path == "" || opts.excluded(file.Path) || !opts.included(file.Path) {
+			continue
+		}
+		local := filepath.Join(localDir, filepath.FromSlash(file.Path))
+		if !strings.HasPrefix(local, filepath.Clean(localDir)+string(filepath.Separator)) {
+			return nil, fmt.Errorf("sandbox file %q is outside %s", file.Path, localDir)
+		}
+		if sum, err := fileChecksum(local); err == nil && sum == file.SHA256 {
+			result.Skipped = append(result.Skipped, file.Path)
+			continue
+		}
+		changed = append(changed, file.Path)
+	}
+	err = result.copyAll(ctx, opts.Concurrency, changed, func(ctx context.Context, rel string) (int64, error) {
+		return c.downloadFile(ctx, space, name, path.Join(remoteDir, rel), filepath.Join(localDir, filepath.FromSlash(rel)))
+	})
+	return result, err
+}
+
+// copyAll runs copy for each file with up to concurrency at once, recording the copied files
+// in r. It stops at the first error.
+func (r *SyncResult) copyAll(ctx context.Context, concurrency int, files []string, copy func(context.Context, string) (int64, error)) error {
+	if concurrency <= 0 {
+		concurrency = DefaultSyncConcurrency
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var mu sync.Mutex
+	var firstErr error
+	work := make(chan string)
+	var wg sync.WaitGroup
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for rel := range work {
+				n, err := copy(ctx, rel)
+				mu.Lock()
+				if err != nil && firstErr == nil {
+					firstErr = fmt.Errorf("copy %s: %w", rel, err)
+					cancel()
+				}
+				if err == nil {
+					r.Copied = append(r.Copied, rel)
+					r.Bytes += n
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+feed:
+	for _, rel := range files {
+		select {
+		case work <- rel:
+		case <-ctx.Done():
+			break feed
+		}
+	}
+	close(work)
+	wg.Wait()
+	sort.Strings(r.Copied)
+	if firstErr == nil {
+		firstErr = ctx.Err()
+	}
+	return firstErr
+}
+
+// uploadFile sends a local file to dir/rel in a sandbox.
+func (c *Client) uploadFile(ctx context.Context, space, name, local, dir, rel string) (int64, error) {
+	f, err := os.Open(local)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return 0, err
+	}
+
+	pr, pw := io.Pipe()
+	go func() {
+		tw := tar.NewWriter(pw)
+		err := tw.WriteHeader(&tar.Header{Typeflag: tar.TypeReg, Name: rel, Size: info.Size(), Mode: int64(info.Mode().Perm()), ModTime: info.ModTime()})
+		if err == nil {
+			_, err = io.Copy(tw, io.LimitReader(f, info.Size()))
+		}
+		if err == nil {
+			err = tw.Close()
+		}
+		pw.CloseWithError(err)
+	}()
+	resp, err := c.filesRequest(ctx, http.MethodPut, space, name, "files", dir, pr)
+	pr.Close()
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	if err := validateResponse(resp, http.StatusNoContent); err != nil {
+		return 0, err
+	}
+	return info.Size(), nil
+}
+
+// downloadFile writes a file of a sandbox to a local path, replacing it once complete.
+func (c *Client) downloadFile(ctx context.Context, space, name, remote, local string) (int64, error) {
+	resp, err := c.filesRequest(ctx, http.MethodGet, space, name, "files", remote, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	if err := validateResponse(resp, http.StatusOK); err != nil {
+		return 0, err
+	}
+	tr := tar.NewReader(resp.Body)
+	hdr, err := tr.Next()
+	if err != nil {
+		return 0, fmt.Errorf("read archive: %w", err)
+	}
+	if hdr.Typeflag != tar.TypeReg {
+		return 0, fmt.Errorf("%s is not a regular file", remote)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(local), 0o755); err != nil {
+		return 0, err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(local), "."+filepath.Base(local)+".*")
+	if err != nil {
+		return 0, err
+	}
+	defer os.Remove(tmp.Name()) // Fails harmlessly once renamed
+	n, err := io.Copy(tmp, tr)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return 0, err
+	}
+	if err := os.Chmod(tmp.Name(), fs.FileMode(hdr.Mode).Perm()); err != nil {
+		return 0, err
+	}
+	return n, os.Rename(tmp.Name(), local)
+}
+
+// filesRequest sends a request to a file route of a sandbox, for an absolute path, and maps
+// a 404 for the path to ErrPathNotFound.
+func (c *Client) filesRequest(ctx context.Context, method, space, name, route, remotePath string, body io.Reader) (*http.Response, error) {
+	if !path.IsAbs(remotePath) {
+		return nil, fmt.Errorf("sandbox path %q is not absolute", remotePath)
+	}
+	endpoint := fmt.Sprintf("%s/v1/spaces/%s/sandboxes/%s/%s?path=%s", c.BaseURL, url.PathEscape(space), url.PathEscape(name), route, url.QueryEscape(remotePath))
+	req, err := http.NewRequestWithContext(ctx, method, endpoint, body)
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/x-tar")
+	}
+	resp, err := c.httpc.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode == http.StatusNotFound {
+		var apiErr struct {
+			Code string `json:"code"`
+		}
+		json.NewDecoder(resp.Body).Decode(&apiErr)
+		resp.Body.Close()
+		switch apiErr.Code {
+		case "path_not_found":
+			return nil, ErrPathNotFound
+		default:
+			return nil, ErrSandboxNotFound
+		}
+	}
+	return resp, nil
+}
+
+// fileChecksum returns the SHA-256 checksum of a local file.
+func fileChecksum(name string) (string, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// included reports whether a file is selected by the Include patterns.
+func (o SyncOptions) included(rel string) bool {
+	return len(o.Include) == 0 || matchAny(o.Include, rel)
+}
+
+// excluded reports whether a file or directory, or one of its parents, is matched by the
+// Exclude patterns.
+func (o SyncOptions) excluded(rel string) bool {
+	for p := rel; p != "."; p = path.Dir(p) {
+		if matchAny(o.Exclude, p) {
+			return true
+		}
+	}
+	return false
+}
+
+func matchAny(patterns []string, rel string) bool {
+	for _, pattern := range patterns {
+		if ok, _ := path.Match(pattern, rel); ok {
+			return true
+		}
+		if !strings.Contains(pattern, "/") {
+			if ok, _ := path.Match(pattern, path.Base(rel)); ok {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,72 @@
+package v1_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	client "github.com/foreveryh/sandboxai/go/client/v1"
+	"github.com/foreveryh/sandboxai/go/mentisruntime/handler"
+	"github.com/foreveryh/sandboxai/go/mentisruntime/testharness"
+)
+
+func TestUploadAndDownloadDir(t *testing.T) {
+	h := testharness.New(t)
+	spaceID := h.CreateSpace("sync")
+	sandboxID := h.CreateSandbox(spaceID, handler.CreateSandboxRequest{})
+	c := client.NewClient(h.URL)
+	ctx := context.Background()
+
+	local := t.TempDir()
+	write := func(dir, name, content string) {
+		name = filepath.Join(dir, filepath.FromSlash(name))
+		require.NoError(t, os.MkdirAll(filepath.Dir(name), 0o755))
+		require.NoError(t, os.WriteFile(name, []byte(content), 0o644))
+	}
+	write(local, "main.py", "print(1)\n")
+	write(local, "pkg/util.py", "x = 1\n")
+	write(local, "pkg/util.pyc", "compiled")
+	write(local, "node_modules/dep/index.js", "dep")
+
+	opts := client.SyncOptions{Exclude: []string{"*.pyc", "node_modules"}, Concurrency: 2}
+	result, err := c.UploadDir(ctx, spaceID, sandboxID, local, "/work/project", opts)
+	require.NoError(t, err)
+	require.Equal(t, []string{"main.py", "pkg/util.py"}, result.Copied)
+	require.Equal(t, int64(15), result.Bytes)
+	state, err := h.Manager.GetSandbox(ctx, sandboxID)
+	require.NoError(t, err)
+	container := state.ContainerID
+	data, ok := h.Docker.ReadFile(container, "/work/project/pkg/util.py")
+	require.True(t, ok)
+	require.Equal(t, "x = 1\n", string(data))
+	_, ok = h.Docker.ReadFile(container, "/work/project/pkg/util.pyc")
+	require.False(t, ok)
+
+	// Unchanged files are skipped
+	write(local, "main.py", "print(2)\n")
+	result, err = c.UploadDir(ctx, spaceID, sandboxID, local, "/work/project", opts)
+	require.NoError(t, err)
+	require.Equal(t, []string{"main.py"}, result.Copied)
+	require.Equal(t, []string{"pkg/util.py"}, result.Skipped)
+
+	// Downloading into a copy with one stale file fetches only that one
+	require.NoError(t, h.Docker.WriteFile(container, "/work/project/out/result.txt", []byte("42")))
+	copyDir := t.TempDir()
+	write(copyDir, "main.py", "print(2)\n")
+	write(copyDir, "pkg/util.py", "stale")
+	result, err = c.DownloadDir(ctx, spaceID, sandboxID, "/work/project", copyDir, client.SyncOptions{Include: []string{"*.py", "out/*"}})
+	require.NoError(t, err)
+	require.Equal(t, []string{"out/result.txt", "pkg/util.py"}, result.Copied)
+	require.Equal(t, []string{"main.py"}, result.Skipped)
+	data, err = os.ReadFile(filepath.Join(copyDir, "pkg", "util.py"))
+	require.NoError(t, err)
+	require.Equal(t, "x = 1\n", string(data))
+
+	_, err = c.DownloadDir(ctx, spaceID, sandboxID, "/missing", copyDir, client.SyncOptions{})
+	require.ErrorIs(t, err, client.ErrPathNotFound)
+	_, err = c.UploadDir(ctx, spaceID, sandboxID, local, "relative", client.SyncOptions{})
+	require.Error(t, err)
+}
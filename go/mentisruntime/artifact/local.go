@@ -0,0 +1,124 @@
+package artifact
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// LocalStore keeps artifacts on the local filesystem. Signed URLs point back at the
+// runtime itself and are verified with an HMAC before the file is served (see ServeHTTP).
+type LocalStore struct {
+	dir     string
+	baseURL string // e.g. "http://127.0.0.1:5266/v1/artifacts/download"
+	key     []byte
+}
+
+// NewLocalStore creates a store rooted at dir. baseURL is the externally reachable URL of the
+// download route and signingKey the secret used to sign download URLs.
+func NewLocalStore(dir, baseURL string, signingKey []byte) (*LocalStore, error) {
+	if len(signingKey) == 0 {
+		return nil, errors.New("local artifact store requires a signing key")
+	}
+	if err := os.MkdirAll(dir, 0o750); err != nil {
+		return nil, fmt.Errorf("create artifact dir %s: %w", dir, err)
+	}
+	return &LocalStore{dir: dir, baseURL: strings.TrimRight(baseURL, "/"), key: signingKey}, nil
+}
+
+func (s *LocalStore) path(key string) (string, error) {
+	clean := filepath.Clean("/" + key)
+	if clean == "/" {
+		return "", fmt.Errorf("invalid artifact key %q", key)
+	}
+	return filepath.Join(s.dir, filepath.FromSlash(clean)), nil
+}
+
+// Put implements Store.
+func (s *LocalStore) Put(ctx context.Context, key string, r io.Reader, size int64, contentType string) error {
+	p, err := s.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(p), 0o750); err != nil {
+		return fmt.Errorf("create artifact dir: %w", err)
+	}
+	f, err := os.CreateTemp(filepath.Dir(p), ".upload-*")
+	if err != nil {
+		return fmt.Errorf("create artifact file: %w", err)
+	}
+	defer os.Remove(f.Name())
+	if _, err := io.Copy(f, r); err != nil {
+		f.Close()
+		return fmt.Errorf("write artifact: %w", err)
+	}
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("close artifact: %w", err)
+	}
+	return os.Rename(f.Name(), p)
+}
+
+// SignedURL implements Store.
+func (s *LocalStore) SignedURL(ctx context.Context, key string, ttl time.Duration) (string, error) {
+	expires := strconv.FormatInt(time.Now().Add(ttl).Unix(), 10)
+	q := url.Values{}
+	q.Set("key", key)
+	q.Set("expires", expires)
+	q.Set("sig", s.sign(key, expires))
+	return s.baseURL + "?" + q.Encode(), nil
+}
+
+// Delete implements Store.
+func (s *LocalStore) Delete(ctx context.Context, key string) error {
+	p, err := s.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(p); err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return ErrObjectNotFound
+		}
+		return err
+	}
+	return nil
+}
+
+func (s *LocalStore) sign(key, expires string) string {
+	mac := hmac.New(sha256.New, s.key)
+	mac.Write([]byte(key + "\n" + expires))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// ServeHTTP serves downloads for URLs produced by SignedURL.
+func (s *LocalStore) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	key, expires, sig := q.Get("key"), q.Get("expires"), q.Get("sig")
+
+	exp, err := strconv.ParseInt(expires, 10, 64)
+	if err != nil || time.Now().Unix() > exp {
+		http.Error(w, "download link expired or invalid", http.StatusForbidden)
+		return
+	}
+	if !hmac.Equal([]byte(sig), []byte(s.sign(key, expires))) {
+		http.Error(w, "invalid signature", http.StatusForbidden)
+		return
+	}
+	p, err := s.path(key)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filepath.Base(p)))
+	http.ServeFile(w, r, p)
+}
@@ -0,0 +1,259 @@
+package artifact
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// S3Config configures an S3-compatible store. Google Cloud Storage is supported through its
+// XML API interoperability mode (Endpoint "https://storage.googleapis.com", Region "auto", HMAC keys).
+type S3Config struct {
+	Endpoint  string // e.g. "https://s3.amazonaws.com" or "http://minio:9000"
+	Region    string
+	Bucket    string
+	AccessKey string
+	SecretKey string
+	// PathStyle addresses objects as {endpoint}/{bucket}/{key} instead of {bucket}.{endpoint host}/{key}.
+	PathStyle bool
+}
+
+// S3Store talks to S3-compatible object storage using AWS Signature Version 4.
+type S3Store struct {
+	cfg   S3Config
+	httpc *http.Client
+	now   func() time.Time
+}
+
+const (
+	sigV4Algorithm  = "AWS4-HMAC-SHA256"
+	unsignedPayload = "UNSIGNED-PAYLOAD"
+)
+
+// NewS3Store creates an S3-compatible store.
+func NewS3Store(cfg S3Config, httpc *http.Client) (*S3Store, error) {
+	if cfg.Bucket == "" || cfg.AccessKey == "" || cfg.SecretKey == "" {
+		return nil, errors.New("s3 artifact store requires bucket, access key and secret key")
+	}
+	if cfg.Endpoint == "" {
+		cfg.Endpoint = "https://s3.amazonaws.com"
+	}
+	if cfg.Region == "" {
+		cfg.Region = "us-east-1"
+	}
+	cfg.Endpoint = strings.TrimRight(cfg.Endpoint, "/")
+	if httpc == nil {
+		httpc = http.DefaultClient
+	}
+	return &S3Store{cfg: cfg, httpc: httpc, now: time.Now}, nil
+}
+
+func (s *S3Store) objectURL(key string) (*url.URL, error) {
+	u, err := url.Parse(s.cfg.Endpoint)
+	if err != nil {
+		return nil, fmt.Errorf("parse endpoint: %w", err)
+	}
+	if s.cfg.PathStyle {
+		u.Path = "/" + s.cfg.Bucket + "/" + key
+	} else {
+		u.Host = s.cfg.Bucket + "." + u.Host
+		u.Path = "/" + key
+	}
+	return u, nil
+}
+
+// Put implements Store.
+func (s *S3Store) Put(ctx context.Context, key string, r io.Reader, size int64, contentType string) error {
+	u, err := s.objectURL(key)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, u.String(), r)
+	if err != nil {
+		return err
+	}
+	req.ContentLength = size
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	s.signRequest(req, s.now().UTC())
+
+	resp, err := s.httpc.Do(req)
+	if err != nil {
+		return fmt.Errorf("put object: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		body, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("put object %s: status %d: %s", key, resp.StatusCode, string(body))
+	}
+	return nil
+}
+
+// Delete implements Store.
+func (s *S3Store) Delete(ctx context.Context, key string) error {
+	u, err := s.objectURL(key)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodDelete, u.String(), nil)
+	if err != nil {
+		return err
+	}
+	s.signRequest(req, s.now().UTC())
+
+	resp, err := s.httpc.Do(req)
+	if err != nil {
+		return fmt.Errorf("delete object: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return ErrObjectNotFound
+	}
+	if resp.StatusCode/100 != 2 {
+		body, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("delete object %s: status %d: %s", key, resp.StatusCode, string(body))
+	}
+	return nil
+}
+
+// SignedURL implements Store by returning a presigned GET URL.
+func (s *S3Store) SignedURL(ctx context.Context, key string, ttl time.Duration) (string, error) {
+	u, err := s.objectURL(key)
+	if err != nil {
+		return "", err
+	}
+	return s.presign(u, s.now().UTC(), ttl), nil
+}
+
+func (s *S3Store) presign(u *url.URL, t time.Time, ttl time.Duration) string {
+	amzDate := t.Format("20060102T150405Z")
+	scope := s.scope(t)
+
+	q := url.Values{}
+	q.Set("X-Amz-Algorithm", sigV4Algorithm)
+	q.Set("X-Amz-Credential", s.cfg.AccessKey+"/"+scope)
+	q.Set("X-Amz-Date", amzDate)
+	q.Set("X-Amz-Expires", strconv.Itoa(int(ttl.Seconds())))
+	q.Set("X-Amz-SignedHeaders", "host")
+
+	canonicalQuery := canonicalQueryString(q)
+	canonicalRequest := strings.Join([]string{
+		http.MethodGet,
+		uriEncode(u.Path, false),
+		canonicalQuery,
+		"host:" + u.Host + "\n",
+		"host",
+		unsignedPayload,
+	}, "\n")
+
+	signature := s.signature(t, amzDate, scope, canonicalRequest)
+	return u.Scheme + "://" + u.Host + uriEncode(u.Path, false) + "?" + canonicalQuery + "&X-Amz-Signature=" + signature
+}
+
+func (s *S3Store) signRequest(req *http.Request, t time.Time) {
+	amzDate := t.Format("20060102T150405Z")
+	scope := s.scope(t)
+
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", unsignedPayload)
+
+	headers := map[string]string{
+		"host":                 req.URL.Host,
+		"x-amz-content-sha256": unsignedPayload,
+		"x-amz-date":           amzDate,
+	}
+	if ct := req.Header.Get("Content-Type"); ct != "" {
+		headers["content-type"] = ct
+	}
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + strings.TrimSpace(headers[name]) + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		uriEncode(req.URL.Path, false),
+		canonicalQueryString(req.URL.Query()),
+		canonicalHeaders.String(),
+		signedHeaders,
+		unsignedPayload,
+	}, "\n")
+
+	signature := s.signature(t, amzDate, scope, canonicalRequest)
+	req.Header.Set("Authorization", fmt.Sprintf("%s Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		sigV4Algorithm, s.cfg.AccessKey, scope, signedHeaders, signature))
+}
+
+func (s *S3Store) scope(t time.Time) string {
+	return t.Format("20060102") + "/" + s.cfg.Region + "/s3/aws4_request"
+}
+
+func (s *S3Store) signature(t time.Time, amzDate, scope, canonicalRequest string) string {
+	hash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := strings.Join([]string{sigV4Algorithm, amzDate, scope, hex.EncodeToString(hash[:])}, "\n")
+
+	key := hmacSHA256([]byte("AWS4"+s.cfg.SecretKey), t.Format("20060102"))
+	key = hmacSHA256(key, s.cfg.Region)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+	return hex.EncodeToString(hmacSHA256(key, stringToSign))
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+func canonicalQueryString(q url.Values) string {
+	keys := make([]string, 0, len(q))
+	for k := range q {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var parts []string
+	for _, k := range keys {
+		vals := append([]string(nil), q[k]...)
+		sort.Strings(vals)
+		for _, v := range vals {
+			parts = append(parts, uriEncode(k, true)+"="+uriEncode(v, true))
+		}
+	}
+	return strings.Join(parts, "&")
+}
+
+// uriEncode implements the SigV4 URI encoding: every byte except the RFC 3986 unreserved
+// characters is percent-encoded, and '/' is kept as-is unless encodeSlash is set.
+func uriEncode(s string, encodeSlash bool) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case 'A' <= c && c <= 'Z', 'a' <= c && c <= 'z', '0' <= c && c <= '9', c == '-', c == '_', c == '.', c == '~':
+			b.WriteByte(c)
+		case c == '/' && !encodeSlash:
+			b.WriteByte(c)
+		default:
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
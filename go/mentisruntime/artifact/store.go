@@ -0,0 +1,22 @@
+// Package artifact persists files captured from sandboxes into object storage
+// so that results outlive the containers that produced them.
+package artifact
+
+import (
+	"context"
+	"errors"
+	"io"
+	"time"
+)
+
+var ErrObjectNotFound = errors.New("artifact object not found")
+
+// Store is an object storage backend for artifacts.
+type Store interface {
+	// Put uploads size bytes read from r under key.
+	Put(ctx context.Context, key string, r io.Reader, size int64, contentType string) error
+	// SignedURL returns a time-limited URL that allows downloading the object without further credentials.
+	SignedURL(ctx context.Context, key string, ttl time.Duration) (string, error)
+	// Delete removes the object stored under key.
+	Delete(ctx context.Context, key string) error
+}
@@ -0,0 +1,433 @@
+// Package compose translates Docker Compose files into sandbox specs.
+//
+// One service becomes the sandbox container and the others become its sidecars. Named
+// volumes and networks become volumes and private networks owned by the sandbox, so every
+// resource lives under one sandbox ID and is removed with it. Only the parts of the format
+// that fit this model are supported: host bind mounts, builds, privileged mode, host
+// namespaces and similar settings are rejected, and published ports are ignored since
+// services reach each other on the private networks.
+package compose
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/foreveryh/sandboxai/go/mentisruntime/manager"
+)
+
+// DefaultService is the service that becomes the sandbox when the caller names none and the
+// file has more than one service.
+const DefaultService = "sandbox"
+
+// File is a parsed compose file.
+type File struct {
+	Services map[string]*Service  `yaml:"services"`
+	Volumes  map[string]*Resource `yaml:"volumes"`
+	Networks map[string]*Resource `yaml:"networks"`
+}
+
+// Resource is a top-level volume or network. Driver settings are ignored.
+type Resource struct {
+	External bool `yaml:"external"`
+}
+
+// Service is a compose service. Unknown keys are ignored.
+type Service struct {
+	Image       string        `yaml:"image"`
+	Command     command       `yaml:"command"`
+	Entrypoint  command       `yaml:"entrypoint"`
+	Environment environment   `yaml:"environment"`
+	WorkingDir  string        `yaml:"working_dir"`
+	User        string        `yaml:"user"`
+	DNS         stringList    `yaml:"dns"`
+	DNSSearch   stringList    `yaml:"dns_search"`
+	ExtraHosts  extraHosts    `yaml:"extra_hosts"`
+	Volumes     []volumeMount `yaml:"volumes"`
+	Networks    keyList       `yaml:"networks"`
+	DependsOn   keyList       `yaml:"depends_on"`
+
+	// Rejected settings.
+	Build       yaml.Node `yaml:"build"`
+	Privileged  bool      `yaml:"privileged"`
+	NetworkMode string    `yaml:"network_mode"`
+	Pid         string    `yaml:"pid"`
+	Ipc         string    `yaml:"ipc"`
+	CapAdd      []string  `yaml:"cap_add"`
+	Devices     yaml.Node `yaml:"devices"`
+	VolumesFrom []string  `yaml:"volumes_from"`
+}
+
+// Parse parses and checks a compose file.
+func Parse(data []byte) (*File, error) {
+	var f File
+	if err := yaml.Unmarshal(data, &f); err != nil {
+		return nil, fmt.Errorf("invalid compose file: %w", err)
+	}
+	if len(f.Services) == 0 {
+		return nil, fmt.Errorf("compose file has no services")
+	}
+	for name, r := range f.Volumes {
+		if r != nil && r.External {
+			return nil, fmt.Errorf("volume %q: external volumes are not supported", name)
+		}
+	}
+	for name, r := range f.Networks {
+		if r != nil && r.External {
+			return nil, fmt.Errorf("network %q: external networks are not supported, use the network field instead", name)
+		}
+	}
+	for _, name := range f.serviceNames() {
+		if err := f.checkService(f.Services[name]); err != nil {
+			return nil, fmt.Errorf("service %q: %w", name, err)
+		}
+	}
+	return &f, nil
+}
+
+func (f *File) checkService(s *Service) error {
+	if s == nil {
+		return fmt.Errorf("empty service")
+	}
+	switch {
+	case !s.Build.IsZero():
+		return fmt.Errorf("build is not supported, use a prebuilt image")
+	case s.Privileged:
+		return fmt.Errorf("privileged is not supported")
+	case s.NetworkMode != "":
+		return fmt.Errorf("network_mode is not supported")
+	case s.Pid != "" || s.Ipc != "":
+		return fmt.Errorf("pid and ipc namespaces are not supported")
+	case len(s.CapAdd) > 0:
+		return fmt.Errorf("cap_add is not supported")
+	case !s.Devices.IsZero():
+		return fmt.Errorf("devices are not supported")
+	case len(s.VolumesFrom) > 0:
+		return fmt.Errorf("volumes_from is not supported")
+	}
+	for _, v := range s.Volumes {
+		if _, declared := f.Volumes[v.Volume]; !declared {
+			return fmt.Errorf("volume %q is not declared in the top-level volumes", v.Volume)
+		}
+	}
+	for _, n := range s.Networks {
+		if _, declared := f.Networks[n]; !declared && n != manager.DefaultPrivateNetwork {
+			return fmt.Errorf("network %q is not declared in the top-level networks", n)
+		}
+	}
+	for _, dep := range s.DependsOn {
+		if _, exists := f.Services[dep]; !exists {
+			return fmt.Errorf("depends on unknown service %q", dep)
+		}
+	}
+	return nil
+}
+
+// SandboxSpec translates the file into a sandbox spec, with service main as the sandbox.
+// If main is empty, the only service is used, or else DefaultService. Sidecars are ordered
+// so that each comes after the services it depends on.
+func (f *File) SandboxSpec(main string) (manager.SandboxSpec, error) {
+	if main == "" {
+		main = DefaultService
+		if len(f.Services) == 1 {
+			main = f.serviceNames()[0]
+		}
+	}
+	box, exists := f.Services[main]
+	if !exists {
+		return manager.SandboxSpec{}, fmt.Errorf("compose file has no service %q to run as the sandbox", main)
+	}
+	order, err := f.startOrder()
+	if err != nil {
+		return manager.SandboxSpec{}, err
+	}
+
+	spec := manager.SandboxSpec{
+		Image:           box.Image,
+		Command:         box.Command,
+		Entrypoint:      box.Entrypoint,
+		Env:             box.Environment,
+		Workdir:         box.WorkingDir,
+		User:            box.User,
+		DNS:             box.DNS,
+		DNSSearch:       box.DNSSearch,
+		ExtraHosts:      box.ExtraHosts,
+		Volumes:         volumeMounts(box.Volumes),
+		PrivateNetworks: box.Networks,
+	}
+	for _, name := range order {
+		if name == main {
+			continue
+		}
+		s := f.Services[name]
+		if s.Image == "" {
+			return manager.SandboxSpec{}, fmt.Errorf("service %q: image is required", name)
+		}
+		if len(s.DNS) > 0 || len(s.DNSSearch) > 0 || len(s.ExtraHosts) > 0 {
+			return manager.SandboxSpec{}, fmt.Errorf("service %q: dns and extra_hosts are only supported on the sandbox service", name)
+		}
+		spec.Sidecars = append(spec.Sidecars, manager.SidecarSpec{
+			Name:       name,
+			Image:      s.Image,
+			Env:        s.Environment,
+			Command:    s.Command,
+			Entrypoint: s.Entrypoint,
+			Workdir:    s.WorkingDir,
+			User:       s.User,
+			Volumes:    volumeMounts(s.Volumes),
+			Networks:   s.Networks,
+		})
+	}
+	return spec, nil
+}
+
+// startOrder sorts the services topologically by depends_on, breaking ties by name.
+func (f *File) startOrder() ([]string, error) {
+	const (
+		visiting = 1
+		done     = 2
+	)
+	marks := make(map[string]int, len(f.Services))
+	var order []string
+	var visit func(name string) error
+	visit = func(name string) error {
+		switch marks[name] {
+		case visiting:
+			return fmt.Errorf("service %q: circular depends_on", name)
+		case done:
+			return nil
+		}
+		marks[name] = visiting
+		deps := append([]string(nil), f.Services[name].DependsOn...)
+		sort.Strings(deps)
+		for _, dep := range deps {
+			if err := visit(dep); err != nil {
+				return err
+			}
+		}
+		marks[name] = done
+		order = append(order, name)
+		return nil
+	}
+	for _, name := range f.serviceNames() {
+		if err := visit(name); err != nil {
+			return nil, err
+		}
+	}
+	return order, nil
+}
+
+func (f *File) serviceNames() []string {
+	names := make([]string, 0, len(f.Services))
+	for name := range f.Services {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func volumeMounts(mounts []volumeMount) []manager.VolumeMount {
+	if len(mounts) == 0 {
+		return nil
+	}
+	result := make([]manager.VolumeMount, len(mounts))
+	for i, m := range mounts {
+		result[i] = manager.VolumeMount(m)
+	}
+	return result
+}
+
+// command accepts the string and list forms of command and entrypoint. Strings are split
+// into words like a shell would, without expanding anything.
+type command []string
+
+func (c *command) UnmarshalYAML(node *yaml.Node) error {
+	if node.Kind == yaml.ScalarNode {
+		words, err := splitWords(node.Value)
+		if err != nil {
+			return err
+		}
+		*c = words
+		return nil
+	}
+	var list []string
+	if err := node.Decode(&list); err != nil {
+		return err
+	}
+	*c = list
+	return nil
+}
+
+// stringList accepts a single string or a list of strings.
+type stringList []string
+
+func (l *stringList) UnmarshalYAML(node *yaml.Node) error {
+	if node.Kind == yaml.ScalarNode {
+		*l = []string{node.Value}
+		return nil
+	}
+	var list []string
+	if err := node.Decode(&list); err != nil {
+		return err
+	}
+	*l = list
+	return nil
+}
+
+// keyList accepts a list of names or a mapping keyed by name, as used by networks and
+// depends_on. Per-entry settings are ignored.
+type keyList []string
+
+func (l *keyList) UnmarshalYAML(node *yaml.Node) error {
+	if node.Kind == yaml.MappingNode {
+		for i := 0; i < len(node.Content); i += 2 {
+			*l = append(*l, node.Content[i].Value)
+		}
+		return nil
+	}
+	var list []string
+	if err := node.Decode(&list); err != nil {
+		return err
+	}
+	*l = list
+	return nil
+}
+
+// environment accepts a mapping or a list of NAME=value entries. Entries without a value,
+// which compose would take from the host environment, are skipped.
+type environment map[string]string
+
+func (e *environment) UnmarshalYAML(node *yaml.Node) error {
+	env := environment{}
+	switch node.Kind {
+	case yaml.MappingNode:
+		for i := 0; i < len(node.Content); i += 2 {
+			env[node.Content[i].Value] = node.Content[i+1].Value // Null values become ""
+		}
+	case yaml.SequenceNode:
+		var list []string
+		if err := node.Decode(&list); err != nil {
+			return err
+		}
+		for _, entry := range list {
+			if name, value, ok := strings.Cut(entry, "="); ok {
+				env[name] = value
+			}
+		}
+	default:
+		return fmt.Errorf("line %d: environment must be a mapping or a list", node.Line)
+	}
+	*e = env
+	return nil
+}
+
+// extraHosts accepts a list of "host:ip" or "host=ip" entries, or a mapping of host to IP,
+// and normalizes them to "host:ip".
+type extraHosts []string
+
+func (h *extraHosts) UnmarshalYAML(node *yaml.Node) error {
+	if node.Kind == yaml.MappingNode {
+		for i := 0; i < len(node.Content); i += 2 {
+			*h = append(*h, node.Content[i].Value+":"+node.Content[i+1].Value)
+		}
+		return nil
+	}
+	var list []string
+	if err := node.Decode(&list); err != nil {
+		return err
+	}
+	for _, entry := range list {
+		if host, ip, ok := strings.Cut(entry, "="); ok {
+			entry = host + ":" + ip
+		}
+		*h = append(*h, entry)
+	}
+	return nil
+}
+
+// volumeMount accepts the short ("name:/path[:ro]") and long syntax of a named volume mount.
+type volumeMount struct {
+	Volume   string
+	Path     string
+	ReadOnly bool
+}
+
+func (v *volumeMount) UnmarshalYAML(node *yaml.Node) error {
+	if node.Kind == yaml.ScalarNode {
+		parts := strings.Split(node.Value, ":")
+		if len(parts) < 2 || len(parts) > 3 {
+			return fmt.Errorf("line %d: volume %q must have the form name:/path[:ro]; anonymous volumes are not supported", node.Line, node.Value)
+		}
+		v.Volume, v.Path = parts[0], parts[1]
+		if len(parts) == 3 {
+			for _, opt := range strings.Split(parts[2], ",") {
+				v.ReadOnly = v.ReadOnly || opt == "ro"
+			}
+		}
+	} else {
+		var long struct {
+			Type     string `yaml:"type"`
+			Source   string `yaml:"source"`
+			Target   string `yaml:"target"`
+			ReadOnly bool   `yaml:"read_only"`
+		}
+		if err := node.Decode(&long); err != nil {
+			return err
+		}
+		if long.Type != "" && long.Type != "volume" {
+			return fmt.Errorf("line %d: %s mounts are not supported, only named volumes", node.Line, long.Type)
+		}
+		v.Volume, v.Path, v.ReadOnly = long.Source, long.Target, long.ReadOnly
+	}
+	if v.Volume == "" || strings.ContainsAny(v.Volume[:1], "/.~$") {
+		return fmt.Errorf("line %d: host bind mounts are not supported, only named volumes", node.Line)
+	}
+	return nil
+}
+
+// splitWords splits s into words like a POSIX shell, honouring single and double quotes and
+// backslash escapes.
+func splitWords(s string) ([]string, error) {
+	var words []string
+	var word strings.Builder
+	inWord := false
+	var quote rune
+	escaped := false
+	for _, r := range s {
+		switch {
+		case escaped:
+			word.WriteRune(r)
+			escaped = false
+		case r == '\\' && quote != '\'':
+			escaped = true
+			inWord = true
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			} else {
+				word.WriteRune(r)
+			}
+		case r == '\'' || r == '"':
+			quote = r
+			inWord = true
+		case r == ' ' || r == '\t' || r == '\n':
+			if inWord {
+				words = append(words, word.String())
+				word.Reset()
+				inWord = false
+			}
+		default:
+			word.WriteRune(r)
+			inWord = true
+		}
+	}
+	if quote != 0 || escaped {
+		return nil, fmt.Errorf("unterminated quote or escape in %q", s)
+	}
+	if inWord {
+		words = append(words, word.String())
+	}
+	return words, nil
+}
@@ -0,0 +1,96 @@
+package compose
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/foreveryh/sandboxai/go/mentisruntime/manager"
+)
+
+func TestSandboxSpec(t *testing.T) {
+	f, err := Parse([]byte(`
+services:
+  sandbox:
+    image: python:3.12-slim
+    command: python -m http.server "8000"
+    environment:
+      DATABASE_URL: postgres://app@db/app
+      DEBUG:
+    working_dir: /work
+    extra_hosts:
+      - api.internal=10.0.0.10
+    volumes:
+      - data:/data:ro
+    networks: [default, backend]
+    depends_on: [app]
+  app:
+    image: example/app:1
+    environment: [MODE=test, FROM_HOST]
+    networks: {backend: {}}
+    depends_on:
+      db: {condition: service_healthy}
+  db:
+    image: postgres:16
+    ports: ["5432:5432"]
+    volumes:
+      - type: volume
+        source: data
+        target: /var/lib/postgresql/data
+volumes:
+  data: {}
+networks:
+  backend:
+`))
+	require.NoError(t, err)
+
+	spec, err := f.SandboxSpec("")
+	require.NoError(t, err)
+	require.Equal(t, "python:3.12-slim", spec.Image)
+	require.Equal(t, []string{"python", "-m", "http.server", "8000"}, spec.Command)
+	require.Equal(t, map[string]string{"DATABASE_URL": "postgres://app@db/app", "DEBUG": ""}, spec.Env)
+	require.Equal(t, []string{"api.internal:10.0.0.10"}, spec.ExtraHosts)
+	require.Equal(t, []manager.VolumeMount{{Volume: "data", Path: "/data", ReadOnly: true}}, spec.Volumes)
+	require.Equal(t, []string{"default", "backend"}, spec.PrivateNetworks)
+
+	require.Len(t, spec.Sidecars, 2)
+	require.Equal(t, "db", spec.Sidecars[0].Name)
+	require.Equal(t, []manager.VolumeMount{{Volume: "data", Path: "/var/lib/postgresql/data"}}, spec.Sidecars[0].Volumes)
+	require.Equal(t, "app", spec.Sidecars[1].Name)
+	require.Equal(t, map[string]string{"MODE": "test"}, spec.Sidecars[1].Env)
+	require.Equal(t, []string{"backend"}, spec.Sidecars[1].Networks)
+}
+
+func TestParse_rejectsUnsupported(t *testing.T) {
+	for name, doc := range map[string]string{
+		"bind mount":       "services: {sandbox: {image: x, volumes: ['./src:/src']}}",
+		"anonymous volume": "services: {sandbox: {image: x, volumes: ['/cache']}}",
+		"undeclared":       "services: {sandbox: {image: x, volumes: ['data:/data']}}",
+		"build":            "services: {sandbox: {build: .}}",
+		"privileged":       "services: {sandbox: {image: x, privileged: true}}",
+		"network_mode":     "services: {sandbox: {image: x, network_mode: host}}",
+		"external network": "services: {sandbox: {image: x}}\nnetworks: {shared: {external: true}}",
+		"unknown service":  "services: {sandbox: {image: x, depends_on: [db]}}",
+		"no services":      "volumes: {data: {}}",
+	} {
+		_, err := Parse([]byte(doc))
+		require.Error(t, err, name)
+	}
+}
+
+func TestSandboxSpec_errors(t *testing.T) {
+	f, err := Parse([]byte("services: {a: {image: x, depends_on: [b]}, b: {image: y, depends_on: [a]}}"))
+	require.NoError(t, err)
+	_, err = f.SandboxSpec("a")
+	require.ErrorContains(t, err, "circular")
+	_, err = f.SandboxSpec("")
+	require.ErrorContains(t, err, `no service "sandbox"`)
+}
+
+func TestSplitWords(t *testing.T) {
+	words, err := splitWords(`sh -c 'echo "hi there"' a\ b`)
+	require.NoError(t, err)
+	require.Equal(t, []string{"sh", "-c", `echo "hi there"`, "a b"}, words)
+	_, err = splitWords(`echo "open`)
+	require.Error(t, err)
+}
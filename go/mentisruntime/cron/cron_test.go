@@ -0,0 +1,41 @@
+package cron
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSchedule_Next(t *testing.T) {
+	from := time.Date(2024, 1, 31, 10, 7, 30, 0, time.UTC) // A Wednesday
+	cases := []struct {
+		expr string
+		want time.Time
+	}{
+		{"* * * * *", time.Date(2024, 1, 31, 10, 8, 0, 0, time.UTC)},
+		{"*/15 * * * *", time.Date(2024, 1, 31, 10, 15, 0, 0, time.UTC)},
+		{"0 9-17/4 * * mon-fri", time.Date(2024, 1, 31, 13, 0, 0, 0, time.UTC)},
+		{"30 2 * feb *", time.Date(2024, 2, 1, 2, 30, 0, 0, time.UTC)},
+		{"0 0 29 2 *", time.Date(2024, 2, 29, 0, 0, 0, 0, time.UTC)},
+		{"0 0 1 * 7", time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC)}, // Day of month OR Sunday
+		{"@hourly", time.Date(2024, 1, 31, 11, 0, 0, 0, time.UTC)},
+		{"@every 90s", time.Date(2024, 1, 31, 10, 9, 0, 0, time.UTC)},
+	}
+	for _, tc := range cases {
+		s, err := Parse(tc.expr)
+		require.NoError(t, err, tc.expr)
+		require.Equal(t, tc.want, s.Next(from), tc.expr)
+	}
+
+	never, err := Parse("0 0 30 2 *")
+	require.NoError(t, err)
+	require.True(t, never.Next(from).IsZero())
+}
+
+func TestParse_invalid(t *testing.T) {
+	for _, expr := range []string{"", "* * * *", "60 * * * *", "* * 0 * *", "5-1 * * * *", "*/0 * * * *", "* * * foo *", "@every 10ms"} {
+		_, err := Parse(expr)
+		require.Error(t, err, expr)
+	}
+}
@@ -0,0 +1,202 @@
+// Package dockerenv finds the local container runtime serving the Docker API — Docker
+// Desktop, Colima, Rancher Desktop, OrbStack or a native Docker Engine — and the presets
+// sandboxes need on it: where its socket is, and the host name containers reach the
+// runtime's callbacks at.
+//
+// Without DOCKER_HOST, the sockets of the runtimes are tried in turn; the daemon that answers
+// is then identified from its info, which also names the runtime behind a DOCKER_HOST.
+package dockerenv
+
+import (
+	"fmt"
+	"net"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/docker/docker/api/types/system"
+)
+
+// Runtimes serving the Docker API.
+const (
+	DockerDesktop  = "docker-desktop"
+	Colima         = "colima"
+	RancherDesktop = "rancher-desktop"
+	OrbStack       = "orbstack"
+	Engine         = "engine" // Native Docker Engine on Linux
+)
+
+// Preset is how sandboxes work on a runtime.
+type Preset struct {
+	Runtime string
+	// Sockets are where the runtime serves the Docker API, "~" standing for the home directory.
+	Sockets []string
+	// CallbackHost is the name containers reach the host, and so the runtime, at.
+	CallbackHost string
+	// HostGateway maps CallbackHost to the host gateway in containers' /etc/hosts, for runtimes
+	// that do not resolve it themselves.
+	HostGateway bool
+	// LoopbackReachable is set for runtimes that forward CallbackHost to the host's loopback
+	// interface, so a runtime listening on 127.0.0.1 is reachable from containers.
+	LoopbackReachable bool
+	// StartHint tells how to start the runtime, for errors about it being unreachable.
+	StartHint string
+}
+
+// Presets are the supported runtimes. Their sockets are tried in the order of Order.
+var Presets = map[string]Preset{
+	OrbStack: {
+		Runtime:           OrbStack,
+		Sockets:           []string{"~/.orbstack/run/docker.sock"},
+		CallbackHost:      "host.docker.internal",
+		LoopbackReachable: true,
+		StartHint:         "start OrbStack (orb start)",
+	},
+	Colima: {
+		Runtime:           Colima,
+		Sockets:           []string{"~/.colima/default/docker.sock", "~/.colima/docker.sock"},
+		CallbackHost:      "host.lima.internal",
+		LoopbackReachable: true,
+		StartHint:         "start Colima (colima start)",
+	},
+	RancherDesktop: {
+		Runtime:           RancherDesktop,
+		Sockets:           []string{"~/.rd/docker.sock"},
+		CallbackHost:      "host.docker.internal",
+		LoopbackReachable: true,
+		StartHint:         "start Rancher Desktop with the dockerd (moby) container engine",
+	},
+	DockerDesktop: {
+		Runtime:           DockerDesktop,
+		Sockets:           []string{"~/.docker/run/docker.sock", "~/.docker/desktop/docker.sock"},
+		CallbackHost:      "host.docker.internal",
+		LoopbackReachable: true,
+		StartHint:         "start Docker Desktop",
+	},
+	Engine: {
+		Runtime:      Engine,
+		Sockets:      []string{"/var/run/docker.sock"},
+		CallbackHost: "host.docker.internal",
+		HostGateway:  true,
+		StartHint:    "start the Docker daemon (sudo systemctl start docker) and check your user may use its socket",
+	},
+}
+
+// Order is the order in which the sockets of the runtimes are tried: the engine's socket
+// last, as the desktop runtimes may link it to their own.
+var Order = []string{OrbStack, Colima, RancherDesktop, DockerDesktop, Engine}
+
+// Candidate is a Docker endpoint to try, with the runtime expected behind it.
+type Candidate struct {
+	Preset
+	DockerHost string // "unix://..." endpoint; empty keeps DOCKER_HOST
+	Known      bool   // The runtime is known from configuration or the socket path; else identify it once connected
+}
+
+// Candidates returns the endpoints to try, in order. runtime is a preset name from
+// configuration, or "" to detect it. dockerHost is DOCKER_HOST, which is used as is when
+// set. exists reports whether a socket path exists.
+func Candidates(runtime, dockerHost, home string, exists func(path string) bool) ([]Candidate, error) {
+	if runtime != "" {
+		if _, ok := Presets[runtime]; !ok {
+			return nil, fmt.Errorf("unknown Docker runtime %q: use one of %s", runtime, strings.Join(Names(), ", "))
+		}
+	}
+	if dockerHost != "" {
+		c := Candidate{Preset: Presets[Engine]}
+		switch {
+		case runtime != "":
+			c.Preset, c.Known = Presets[runtime], true
+		default:
+			if name := runtimeOfSocket(dockerHost); name != "" {
+				c.Preset, c.Known = Presets[name], true
+			}
+		}
+		return []Candidate{c}, nil
+	}
+
+	names := Order
+	if runtime != "" {
+		names = []string{runtime}
+	}
+	var candidates, missing []string
+	var found []Candidate
+	for _, name := range names {
+		preset := Presets[name]
+		for _, socket := range preset.Sockets {
+			path := expandHome(socket, home)
+			candidates = append(candidates, path)
+			if exists(path) {
+				// The engine's socket may belong to a desktop runtime; ask the daemon
+				found = append(found, Candidate{Preset: preset, DockerHost: "unix://" + path, Known: name != Engine || runtime != ""})
+			} else {
+				missing = append(missing, path)
+			}
+		}
+	}
+	if len(found) == 0 {
+		hint := "start your container runtime"
+		if runtime != "" {
+			hint = Presets[runtime].StartHint
+		}
+		return nil, fmt.Errorf("no Docker socket found at %s: %s, or set DOCKER_HOST to its endpoint", strings.Join(missing, ", "), hint)
+	}
+	return found, nil
+}
+
+// Identify names the runtime of a daemon from its info.
+func Identify(info system.Info) string {
+	switch {
+	case strings.Contains(info.OperatingSystem, "Docker Desktop"):
+		return DockerDesktop
+	case strings.Contains(info.OperatingSystem, "OrbStack"):
+		return OrbStack
+	case info.Name == "colima" || strings.HasPrefix(info.Name, "colima-"):
+		return Colima
+	case strings.Contains(info.Name, "rancher-desktop"):
+		return RancherDesktop
+	default:
+		return Engine
+	}
+}
+
+// CheckListenHost returns an actionable error if containers on the runtime cannot reach a
+// runtime listening on host.
+func (p Preset) CheckListenHost(host string) error {
+	if p.LoopbackReachable {
+		return nil
+	}
+	if ip := net.ParseIP(host); host != "localhost" && (ip == nil || !ip.IsLoopback()) {
+		return nil
+	}
+	return fmt.Errorf("sandboxes on %s cannot reach the runtime listening on %s: set SANDBOXAID_HOST=0.0.0.0 (or the docker0 address, e.g. 172.17.0.1), or set SANDBOXAID_RUNTIME_HOST to an address they can reach", p.Runtime, host)
+}
+
+// Names returns the names of the presets, sorted.
+func Names() []string {
+	names := make([]string, 0, len(Presets))
+	for name := range Presets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// runtimeOfSocket names the runtime whose socket a DOCKER_HOST points at, or "".
+func runtimeOfSocket(dockerHost string) string {
+	for _, name := range Order {
+		for _, socket := range Presets[name].Sockets {
+			if name != Engine && strings.HasSuffix(dockerHost, strings.TrimPrefix(socket, "~")) {
+				return name
+			}
+		}
+	}
+	return ""
+}
+
+func expandHome(path, home string) string {
+	if rest, ok := strings.CutPrefix(path, "~/"); ok {
+		return filepath.Join(home, rest)
+	}
+	return path
+}
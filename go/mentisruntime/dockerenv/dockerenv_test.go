@@ -0,0 +1,64 @@
+package dockerenv
+
+import (
+	"testing"
+
+	"github.com/docker/docker/api/types/system"
+	"github.com/stretchr/testify/require"
+)
+
+func existing(paths ...string) func(string) bool {
+	return func(path string) bool {
+		for _, p := range paths {
+			if p == path {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+func TestCandidates_findsSockets(t *testing.T) {
+	// Colima's socket is tried before the engine's, which it may be linked to
+	candidates, err := Candidates("", "", "/home/dev", existing("/home/dev/.colima/default/docker.sock", "/var/run/docker.sock"))
+	require.NoError(t, err)
+	require.Len(t, candidates, 2)
+	require.Equal(t, Colima, candidates[0].Runtime)
+	require.Equal(t, "unix:///home/dev/.colima/default/docker.sock", candidates[0].DockerHost)
+	require.Equal(t, "host.lima.internal", candidates[0].CallbackHost)
+	require.True(t, candidates[0].Known)
+	require.False(t, candidates[1].Known) // Identified once connected
+
+	// A configured runtime only looks for its own sockets
+	_, err = Candidates(OrbStack, "", "/home/dev", existing("/var/run/docker.sock"))
+	require.ErrorContains(t, err, "/home/dev/.orbstack/run/docker.sock")
+	require.ErrorContains(t, err, "orb start")
+
+	_, err = Candidates("podman", "", "/home/dev", existing())
+	require.ErrorContains(t, err, "unknown Docker runtime")
+}
+
+func TestCandidates_dockerHost(t *testing.T) {
+	candidates, err := Candidates("", "unix:///Users/dev/.rd/docker.sock", "/Users/dev", existing())
+	require.NoError(t, err)
+	require.Equal(t, []Candidate{{Preset: Presets[RancherDesktop], Known: true}}, candidates)
+
+	candidates, err = Candidates("", "tcp://10.0.0.5:2376", "/Users/dev", existing())
+	require.NoError(t, err)
+	require.False(t, candidates[0].Known)
+}
+
+func TestIdentify(t *testing.T) {
+	require.Equal(t, DockerDesktop, Identify(system.Info{Name: "docker-desktop", OperatingSystem: "Docker Desktop"}))
+	require.Equal(t, OrbStack, Identify(system.Info{Name: "orbstack", OperatingSystem: "OrbStack"}))
+	require.Equal(t, Colima, Identify(system.Info{Name: "colima-work", OperatingSystem: "Ubuntu 24.04 LTS"}))
+	require.Equal(t, RancherDesktop, Identify(system.Info{Name: "lima-rancher-desktop", OperatingSystem: "Alpine Linux v3.20"}))
+	require.Equal(t, Engine, Identify(system.Info{Name: "build-01", OperatingSystem: "Debian GNU/Linux 12"}))
+}
+
+func TestPreset_CheckListenHost(t *testing.T) {
+	require.NoError(t, Presets[Colima].CheckListenHost("127.0.0.1"))
+	require.ErrorContains(t, Presets[Engine].CheckListenHost("127.0.0.1"), "SANDBOXAID_HOST=0.0.0.0")
+	require.Error(t, Presets[Engine].CheckListenHost("localhost"))
+	require.NoError(t, Presets[Engine].CheckListenHost("0.0.0.0"))
+}
@@ -0,0 +1,396 @@
+package fake
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/foreveryh/sandboxai/go/mentisruntime/msgpack"
+)
+
+// Shell runs the commands and IPython cells of fake agents.
+type Shell func(command string) Result
+
+// Result is the output of a command run by a Shell.
+type Result struct {
+	Stdout   string
+	Stderr   string
+	ExitCode int
+	Delay    time.Duration // How long the agent waits before sending the output
+	// Reported in the "result" like the real agent reports a command killed by a signal
+	Signal    string // Such as "SIGKILL"
+	OOMKilled bool
+	Progress  []Progress // Reported by shell commands before their output
+}
+
+// Progress is a "progress" observation of a command.
+type Progress struct {
+	Percent float64
+	Message string
+}
+
+// Echo is the default Shell: "echo" prints its arguments, "exit N" fails with code N and
+// any other command prints itself.
+func Echo(command string) Result {
+	command = strings.TrimSpace(command)
+	switch {
+	case command == "echo":
+		return Result{Stdout: "\n"}
+	case strings.HasPrefix(command, "echo "):
+		return Result{Stdout: strings.TrimSpace(strings.TrimPrefix(command, "echo ")) + "\n"}
+	case strings.HasPrefix(command, "exit "):
+		code, err := strconv.Atoi(strings.TrimSpace(strings.TrimPrefix(command, "exit ")))
+		if err != nil {
+			return Result{Stderr: "exit: numeric argument required\n", ExitCode: 2}
+		}
+		return Result{ExitCode: code}
+	default:
+		return Result{Stdout: command + "\n"}
+	}
+}
+
+// Agent implements the protocol of the in-container agent (python/mentis_executor) for
+// hermetic tests of the runtime and the fake backend. It answers health checks, runs shell
+// commands and IPython cells through its Shell and pushes their output to ObservationURL
+// the way the real agent does: "stream" observations (base64 frames for lines that are not
+// UTF-8, or raw chunked uploads for large_output commands), then a "result" observation,
+// before the action request returns. It also accepts filesystem watches, whose events tests
+// send with Event, named IPython kernels and the /shutdown call. Containers created with a
+// Jupyter token also get a stand-in Jupyter server under JupyterBaseURL that answers
+// GET api with its version. Every request is recorded for Calls.
+type Agent struct {
+	SandboxID      string
+	ObservationURL string
+	Encoding       string   // Observations are pushed as MessagePack when "msgpack", else as JSON
+	Shell          Shell    // nil means Echo
+	Shells         []string // Reported in health checks as the shells commands can choose; nil means DefaultShells
+	JupyterToken   string   // Required by the Jupyter server; empty means there is none
+	JupyterBaseURL string
+
+	mu      sync.Mutex
+	calls   []Call
+	watches map[string]string // Watch ID -> path
+	kernels map[string]bool   // Named kernels, besides "default"
+}
+
+// AgentVersion is the version fake agents report in their health checks.
+const AgentVersion = "fake"
+
+// MissingPath is a directory that does not exist for agents: watches of paths below it fail
+// with 404, as for paths missing in a real sandbox.
+const MissingPath = "/missing"
+
+// DefaultShells are the shells fake agents report unless their Shells is set.
+var DefaultShells = []string{"bash", "sh"}
+
+// Call is a request received by an Agent.
+type Call struct {
+	Method string
+	Path   string
+	Body   json.RawMessage // nil for requests without a body
+}
+
+// Chunk sizes of the real agent.
+const (
+	binaryChunkBytes = 192 * 1024 // Decoded bytes per base64 "stream" frame
+	rawChunkBytes    = 64 * 1024  // Bytes per chunk of a raw output upload
+)
+
+type agentActionRequest struct {
+	ActionID    string `json:"action_id"`
+	Command     string `json:"command"`
+	Code        string `json:"code"`
+	LargeOutput bool   `json:"large_output"`
+	KernelID    string `json:"kernel_id"`
+}
+
+type agentWatchRequest struct {
+	WatchID string `json:"watch_id"`
+	Path    string `json:"path"`
+}
+
+func (a *Agent) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	a.record(r, body)
+
+	switch {
+	case a.JupyterToken != "" && strings.HasPrefix(r.URL.Path, a.JupyterBaseURL):
+		a.serveJupyter(w, r, strings.TrimPrefix(r.URL.Path, a.JupyterBaseURL))
+	case r.URL.Path == "/health" && r.Method == http.MethodGet:
+		w.Header().Set("Content-Type", "application/json")
+		shells := a.Shells
+		if shells == nil {
+			shells = DefaultShells
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"status": "ok", "version": AgentVersion, "shells": shells})
+	case r.URL.Path == "/tools:run_shell_command" && r.Method == http.MethodPost:
+		var req agentActionRequest
+		if err := json.Unmarshal(body, &req); err != nil || req.Command == "" {
+			http.Error(w, "command is required", http.StatusUnprocessableEntity)
+			return
+		}
+		started := time.Now()
+		res := a.run(r.Context(), req.Command)
+		for _, p := range res.Progress {
+			a.send(map[string]interface{}{"observation_type": "progress", "action_id": req.ActionID, "percent": p.Percent, "message": p.Message})
+		}
+		if req.LargeOutput {
+			a.sendRaw(req.ActionID, "stdout", res.Stdout)
+			a.sendRaw(req.ActionID, "stderr", res.Stderr)
+		} else {
+			a.sendLines(req.ActionID, "stdout", res.Stdout)
+			a.sendLines(req.ActionID, "stderr", res.Stderr)
+		}
+		result := map[string]interface{}{"observation_type": "result", "action_id": req.ActionID, "exit_code": res.ExitCode, "error": nil, "usage": usageSince(started)}
+		if res.ExitCode != 0 && res.Stderr != "" {
+			result["error"] = strings.TrimSpace(res.Stderr)
+		}
+		if res.Signal != "" {
+			result["signal"] = res.Signal
+		}
+		if res.OOMKilled {
+			result["oom_killed"] = true
+		}
+		a.send(result)
+		w.WriteHeader(http.StatusOK)
+	case r.URL.Path == "/tools:run_ipython_cell" && r.Method == http.MethodPost:
+		var req agentActionRequest
+		if err := json.Unmarshal(body, &req); err != nil {
+			http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+			return
+		}
+		a.mu.Lock()
+		known := req.KernelID == "" || req.KernelID == "default" || a.kernels[req.KernelID]
+		a.mu.Unlock()
+		if !known {
+			http.Error(w, "kernel not found", http.StatusNotFound)
+			return
+		}
+		started := time.Now()
+		res := a.run(r.Context(), req.Code)
+		// Cells send their whole output in one observation per stream
+		for _, out := range []struct{ stream, text string }{{"stdout", res.Stdout}, {"stderr", res.Stderr}} {
+			if out.text != "" {
+				a.send(map[string]interface{}{"observation_type": "stream", "action_id": req.ActionID, "stream": out.stream, "line": out.text})
+			}
+		}
+		result := map[string]interface{}{"observation_type": "result", "action_id": req.ActionID, "exit_code": res.ExitCode, "status": "ok", "usage": usageSince(started)}
+		if res.ExitCode != 0 {
+			result["status"], result["error_name"], result["error_value"] = "error", "Error", strings.TrimSpace(res.Stderr)
+		}
+		a.send(result)
+		w.WriteHeader(http.StatusOK)
+	case r.URL.Path == "/watches" && r.Method == http.MethodPost:
+		var req agentWatchRequest
+		if err := json.Unmarshal(body, &req); err != nil || req.WatchID == "" || req.Path == "" {
+			http.Error(w, "watch_id and path are required", http.StatusBadRequest)
+			return
+		}
+		if req.Path == MissingPath || strings.HasPrefix(req.Path, MissingPath+"/") {
+			http.Error(w, "path "+req.Path+" does not exist", http.StatusNotFound)
+			return
+		}
+		a.mu.Lock()
+		if a.watches == nil {
+			a.watches = make(map[string]string)
+		}
+		a.watches[req.WatchID] = req.Path
+		a.mu.Unlock()
+		w.WriteHeader(http.StatusOK)
+	case strings.HasPrefix(r.URL.Path, "/watches/") && r.Method == http.MethodDelete:
+		a.mu.Lock()
+		delete(a.watches, strings.TrimPrefix(r.URL.Path, "/watches/"))
+		a.mu.Unlock()
+		w.WriteHeader(http.StatusOK)
+	case r.URL.Path == "/kernels" && r.Method == http.MethodPost:
+		var req struct {
+			KernelID string `json:"kernel_id"`
+		}
+		if err := json.Unmarshal(body, &req); err != nil || req.KernelID == "" {
+			http.Error(w, "kernel_id is required", http.StatusBadRequest)
+			return
+		}
+		a.mu.Lock()
+		defer a.mu.Unlock()
+		if req.KernelID == "default" || a.kernels[req.KernelID] {
+			http.Error(w, "kernel exists", http.StatusConflict)
+			return
+		}
+		if a.kernels == nil {
+			a.kernels = make(map[string]bool)
+		}
+		a.kernels[req.KernelID] = true
+		w.WriteHeader(http.StatusOK)
+	case strings.HasPrefix(r.URL.Path, "/kernels/") && r.Method == http.MethodDelete:
+		a.mu.Lock()
+		delete(a.kernels, strings.TrimPrefix(r.URL.Path, "/kernels/"))
+		a.mu.Unlock()
+		w.WriteHeader(http.StatusOK)
+	case r.URL.Path == "/shutdown" && r.Method == http.MethodPost:
+		a.mu.Lock()
+		a.watches = nil
+		a.mu.Unlock()
+		a.send(map[string]interface{}{"observation_type": "shutdown", "action_id": nil, "terminated_commands": 0})
+		w.WriteHeader(http.StatusOK)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// serveJupyter answers a request to the Jupyter server at path, relative to its base URL.
+func (a *Agent) serveJupyter(w http.ResponseWriter, r *http.Request, path string) {
+	if r.Header.Get("Authorization") != "token "+a.JupyterToken {
+		http.Error(w, "invalid token", http.StatusForbidden)
+		return
+	}
+	if path != "api" || r.Method != http.MethodGet {
+		http.NotFound(w, r)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"version": AgentVersion})
+}
+
+func (a *Agent) record(r *http.Request, body []byte) {
+	call := Call{Method: r.Method, Path: r.URL.Path}
+	if len(body) > 0 {
+		call.Body = body
+	}
+	a.mu.Lock()
+	a.calls = append(a.calls, call)
+	a.mu.Unlock()
+}
+
+// Calls returns the requests received so far, in order.
+func (a *Agent) Calls() []Call {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return append([]Call(nil), a.calls...)
+}
+
+// Event sends an "fs_event" observation for a watch, as if path changed. It reports false if
+// the watch does not exist.
+func (a *Agent) Event(watchID, path, event string, isDir bool) bool {
+	a.mu.Lock()
+	_, ok := a.watches[watchID]
+	a.mu.Unlock()
+	if !ok {
+		return false
+	}
+	a.send(map[string]interface{}{
+		"observation_type": "fs_event",
+		"action_id":        "",
+		"watch_id":         watchID,
+		"data":             map[string]interface{}{"watch_id": watchID, "path": path, "event": event, "is_dir": isDir},
+	})
+	return true
+}
+
+// usageSince returns the "usage" of a "result": fake commands use no CPU time.
+func usageSince(started time.Time) map[string]int64 {
+	return map[string]int64{"duration_ms": time.Since(started).Milliseconds(), "user_cpu_ms": 0, "system_cpu_ms": 0}
+}
+
+// run runs a command, waiting for its Delay unless the request ends first.
+func (a *Agent) run(ctx context.Context, command string) Result {
+	shell := a.Shell
+	if shell == nil {
+		shell = Echo
+	}
+	res := shell(command)
+	if res.Delay > 0 {
+		timer := time.NewTimer(res.Delay)
+		defer timer.Stop()
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+		}
+	}
+	return res
+}
+
+// sendLines sends output line by line, skipping empty lines like the real agent. Lines that
+// are not valid UTF-8 are sent as base64 frames.
+func (a *Agent) sendLines(actionID, stream, output string) {
+	for _, line := range strings.Split(strings.TrimRight(output, "\n"), "\n") {
+		switch {
+		case line == "":
+		case !utf8.ValidString(line):
+			a.sendBinary(actionID, stream, []byte(line))
+		default:
+			a.send(map[string]interface{}{"observation_type": "stream", "action_id": actionID, "stream": stream, "line": line})
+		}
+	}
+}
+
+// sendBinary sends data as base64 "stream" frames sharing a chunk ID.
+func (a *Agent) sendBinary(actionID, stream string, data []byte) {
+	chunkID := fmt.Sprintf("%s-%s-%d", actionID, stream, time.Now().UnixNano())
+	for index := 0; index == 0 || index*binaryChunkBytes < len(data); index++ {
+		chunk := data[index*binaryChunkBytes : min((index+1)*binaryChunkBytes, len(data))]
+		a.send(map[string]interface{}{
+			"observation_type": "stream",
+			"action_id":        actionID,
+			"stream":           stream,
+			"encoding":         "base64",
+			"mime_type":        "application/octet-stream",
+			"chunk_id":         chunkID,
+			"chunk_index":      index,
+			"final":            (index+1)*binaryChunkBytes >= len(data),
+			"line":             base64.StdEncoding.EncodeToString(chunk),
+		})
+	}
+}
+
+// sendRaw uploads the output of a large_output command as one chunked request.
+func (a *Agent) sendRaw(actionID, stream, output string) {
+	if a.ObservationURL == "" || output == "" {
+		return
+	}
+	// Only the reader's methods are exposed, so the request is sent with chunked encoding
+	body := struct{ io.Reader }{bufio.NewReaderSize(strings.NewReader(output), rawChunkBytes)}
+	resp, err := http.Post(a.ObservationURL+"/output/"+actionID+"?stream="+stream, "application/octet-stream", body)
+	if err != nil {
+		return
+	}
+	resp.Body.Close()
+}
+
+// send posts an observation to the runtime. Failures are ignored, as the real agent only
+// logs them.
+func (a *Agent) send(observation map[string]interface{}) {
+	if a.ObservationURL == "" {
+		return
+	}
+	observation["timestamp"] = time.Now().UTC().Format(time.RFC3339Nano)
+	body, err := json.Marshal(observation)
+	if err != nil {
+		return
+	}
+	contentType := "application/json"
+	if a.Encoding == "msgpack" {
+		if body, err = msgpack.FromJSON(body); err != nil {
+			return
+		}
+		contentType = msgpack.ContentType
+	}
+	resp, err := http.Post(a.ObservationURL, contentType, bytes.NewReader(body))
+	if err != nil {
+		return
+	}
+	resp.Body.Close()
+}
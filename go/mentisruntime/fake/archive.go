@@ -0,0 +1,184 @@
+package fake
+
+import (
+	"archive/tar"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/docker/docker/api/types/container"
+)
+
+// fakeFile is a file or directory in the in-memory filesystem of a container, which the
+// archive endpoints of the Docker API copy in and out. Commands run by agents do not see it.
+type fakeFile struct {
+	mode  os.FileMode // os.ModeDir is set for directories
+	data  []byte
+	mtime time.Time
+	owner string // "uid:gid" of the archive entry, or the container's user if copied with copyUIDGID
+}
+
+// WriteFile creates or replaces a file in a container's filesystem, along with its parent
+// directories.
+func (f *Docker) WriteFile(containerID, name string, data []byte) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	c := f.lookupLocked(containerID)
+	if c == nil {
+		return fmt.Errorf("no such container: %s", containerID)
+	}
+	name = path.Clean("/" + name)
+	c.mkdirAllLocked(path.Dir(name))
+	c.files[name] = &fakeFile{mode: 0o644, data: append([]byte(nil), data...), mtime: time.Now().UTC()}
+	return nil
+}
+
+// ReadFile returns the contents of a file in a container's filesystem, and whether it exists.
+func (f *Docker) ReadFile(containerID, name string) ([]byte, bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	c := f.lookupLocked(containerID)
+	if c == nil {
+		return nil, false
+	}
+	file, ok := c.files[path.Clean("/"+name)]
+	if !ok || file.mode.IsDir() {
+		return nil, false
+	}
+	return append([]byte(nil), file.data...), true
+}
+
+// FileOwner returns the owner of a file in a container's filesystem, and whether it exists.
+func (f *Docker) FileOwner(containerID, name string) (string, bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	c := f.lookupLocked(containerID)
+	if c == nil {
+		return "", false
+	}
+	file, ok := c.files[path.Clean("/"+name)]
+	if !ok {
+		return "", false
+	}
+	return file.owner, true
+}
+
+// serveArchive serves the archive endpoints of a container: HEAD stats a path, GET copies it
+// out as a tar archive and PUT extracts an archive into a directory. Callers must hold f.mu.
+func (f *Docker) serveArchive(w http.ResponseWriter, r *http.Request, c *containerRecord) {
+	name := path.Clean("/" + r.URL.Query().Get("path"))
+	if name == "/" {
+		c.mkdirAllLocked(name) // The root always exists
+	}
+	file, ok := c.files[name]
+	if !ok {
+		writeDockerError(w, http.StatusNotFound, "Could not find the file "+name+" in container "+c.name)
+		return
+	}
+
+	if r.Method == http.MethodPut {
+		if !file.mode.IsDir() {
+			writeDockerError(w, http.StatusBadRequest, "extraction point is not a directory")
+			return
+		}
+		owner := ""
+		if r.URL.Query().Get("copyUIDGID") == "true" {
+			owner = c.config.User
+		}
+		if err := c.extractLocked(name, tar.NewReader(r.Body), owner); err != nil {
+			writeDockerError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	stat, _ := json.Marshal(container.PathStat{Name: path.Base(name), Size: int64(len(file.data)), Mode: file.mode, Mtime: file.mtime})
+	w.Header().Set("X-Docker-Container-Path-Stat", base64.StdEncoding.EncodeToString(stat))
+	if r.Method == http.MethodHead {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+	w.Header().Set("Content-Type", "application/x-tar")
+	w.WriteHeader(http.StatusOK)
+	tw := tar.NewWriter(w)
+	for _, entry := range c.treeLocked(name) {
+		file := c.files[entry]
+		hdr := &tar.Header{Name: path.Join(path.Base(name), strings.TrimPrefix(entry, name)), Mode: int64(file.mode.Perm()), ModTime: file.mtime}
+		if file.mode.IsDir() {
+			hdr.Typeflag, hdr.Name = tar.TypeDir, hdr.Name+"/"
+		} else {
+			hdr.Typeflag, hdr.Size = tar.TypeReg, int64(len(file.data))
+		}
+		if tw.WriteHeader(hdr) != nil {
+			return
+		}
+		if _, err := tw.Write(file.data); err != nil {
+			return
+		}
+	}
+	tw.Close()
+}
+
+// treeLocked returns a path and, for a directory, everything below it, parents first.
+// Callers must hold f.mu.
+func (c *containerRecord) treeLocked(root string) []string {
+	entries := []string{root}
+	prefix := strings.TrimSuffix(root, "/") + "/"
+	for name := range c.files {
+		if name != root && strings.HasPrefix(name, prefix) {
+			entries = append(entries, name)
+		}
+	}
+	sort.Strings(entries[1:])
+	return entries
+}
+
+// extractLocked writes the entries of an archive below dir, owned by owner or, if it is
+// empty, by the owner of their entry. Callers must hold f.mu.
+func (c *containerRecord) extractLocked(dir string, tr *tar.Reader, owner string) error {
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("invalid archive: %w", err)
+		}
+		name := path.Join(dir, path.Clean("/"+hdr.Name))
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+			c.mkdirAllLocked(name)
+		case tar.TypeReg:
+			data, err := io.ReadAll(tr)
+			if err != nil {
+				return fmt.Errorf("invalid archive: %w", err)
+			}
+			c.mkdirAllLocked(path.Dir(name))
+			fileOwner := owner
+			if fileOwner == "" {
+				fileOwner = fmt.Sprintf("%d:%d", hdr.Uid, hdr.Gid)
+			}
+			c.files[name] = &fakeFile{mode: os.FileMode(hdr.Mode).Perm(), data: data, mtime: hdr.ModTime, owner: fileOwner}
+		}
+	}
+}
+
+// mkdirAllLocked creates a directory and its parents. Callers must hold f.mu.
+func (c *containerRecord) mkdirAllLocked(dir string) {
+	for ; ; dir = path.Dir(dir) {
+		if _, ok := c.files[dir]; !ok {
+			c.files[dir] = &fakeFile{mode: os.ModeDir | 0o755, mtime: time.Now().UTC()}
+		}
+		if dir == "/" {
+			return
+		}
+	}
+}
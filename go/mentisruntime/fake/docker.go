@@ -0,0 +1,558 @@
+// Package fake simulates the container backend of the runtime: an in-memory Docker engine
+// whose containers run stand-in agents with scripted command output. It serves the
+// SANDBOXAID_BACKEND=fake development mode, for client work and demos without Docker, and
+// the integration test harness.
+package fake
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/distribution/reference"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/image"
+	"github.com/docker/docker/api/types/network"
+	"github.com/docker/docker/client"
+	"github.com/docker/go-connections/nat"
+)
+
+// agentPort is the container port the runtime maps to reach a sandbox's agent, and
+// jupyterPort the one of its Jupyter server.
+const (
+	agentPort   = nat.Port("8000/tcp")
+	jupyterPort = nat.Port("8888/tcp")
+)
+
+// ServicePort is a port every running container publishes, served by its agent, standing in
+// for a service run in the sandbox, e.g. to test port forwarding.
+const ServicePort = 8080
+
+// apiVersionPrefix matches the "/v1.49" prefix of versioned Docker API paths.
+var apiVersionPrefix = regexp.MustCompile(`^/v[0-9.]+`)
+
+// Docker serves the part of the Docker Engine API the sandbox manager uses and keeps its
+// containers in memory. Starting a container starts an Agent for it on a local port, which
+// inspect reports as the mapping of the agent port. Files copied in and out live in memory,
+// unseen by the agents' commands. Image pulls always succeed, networks hand out made-up
+// addresses but connect nothing, volumes hold no data, and the events stream stays silent.
+// Stats of a running container report FakeMemoryBytes in use and half a CPU busy since it
+// started.
+type Docker struct {
+	shell  Shell
+	server *httptest.Server
+	done   chan struct{}
+
+	mu         sync.Mutex
+	runtimeURL string
+	containers map[string]*containerRecord
+	networks   map[string]*networkRecord
+	volumes    map[string]*volumeRecord // By name
+	pulls      []string                 // Images pulled, in order
+	platforms  map[string]string        // Platform of images pulled for one, by normalized reference; others are DefaultPlatform
+	nextID     int
+	nextIP     int           // Host part of the last address handed out on a user-defined network
+	down       bool          // Between StopDaemon and StartDaemon
+	stopped    chan struct{} // Closed by StopDaemon, to end the event streams of the daemon
+}
+
+// FakeMemoryBytes is the memory usage stats report for running containers.
+const FakeMemoryBytes = 64 << 20
+
+// DefaultPlatform is the platform of the images the fake has, unless pulled for another.
+const DefaultPlatform = "linux/amd64"
+
+type containerRecord struct {
+	id      string
+	name    string
+	created time.Time
+	started time.Time // Last start, for the CPU time stats report
+	config  *container.Config
+	host    *container.HostConfig
+	running bool
+	agent   *Agent
+	server  *httptest.Server // Serves agent while running
+
+	networks map[string]*network.EndpointSettings // User-defined networks it is attached to, by name
+	files    map[string]*fakeFile                 // Filesystem seen by the archive endpoints, by path
+}
+
+// NewDocker starts a fake Docker engine on a local port, whose agents run commands with
+// shell (Echo if nil). Close it when done.
+func NewDocker(shell Shell) *Docker {
+	f := &Docker{
+		shell:      shell,
+		done:       make(chan struct{}),
+		containers: make(map[string]*containerRecord),
+		networks:   make(map[string]*networkRecord),
+		volumes:    make(map[string]*volumeRecord),
+		platforms:  make(map[string]string),
+		stopped:    make(chan struct{}),
+	}
+	f.server = httptest.NewServer(f)
+	return f
+}
+
+// Client returns a Docker client talking to the fake. Each client gets its own http.Client,
+// as the Docker client wraps the transport of the one it is given.
+func (f *Docker) Client() (*client.Client, error) {
+	return client.NewClientWithOpts(
+		client.WithHost("tcp://"+f.server.Listener.Addr().String()),
+		client.WithHTTPClient(&http.Client{Transport: f.server.Client().Transport}),
+		client.WithAPIVersionNegotiation(),
+	)
+}
+
+// SetRuntimeURL makes the agents of containers started from now on post their observations
+// to the runtime at url: it replaces the scheme and host of the RUNTIME_OBSERVATION_URL
+// given to containers, which point at host.docker.internal.
+func (f *Docker) SetRuntimeURL(url string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.runtimeURL = url
+}
+
+// Close stops the agents of all containers and the API server.
+func (f *Docker) Close() {
+	close(f.done) // Ends event streams, which otherwise stay open until the client leaves
+	f.mu.Lock()
+	for _, c := range f.containers {
+		f.stopLocked(c)
+	}
+	f.mu.Unlock()
+	f.server.Close()
+}
+
+// StopDaemon simulates the daemon going away, as it does while it restarts: running
+// containers stop, event streams end, and API requests fail until StartDaemon.
+func (f *Docker) StopDaemon() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.down {
+		return
+	}
+	for _, c := range f.containers {
+		f.stopLocked(c)
+	}
+	f.down = true
+	close(f.stopped)
+}
+
+// StartDaemon brings back the daemon StopDaemon stopped. Its containers stay stopped.
+func (f *Docker) StartDaemon() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.down {
+		f.down = false
+		f.stopped = make(chan struct{})
+	}
+}
+
+// Containers returns the IDs of the existing containers.
+func (f *Docker) Containers() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	ids := make([]string, 0, len(f.containers))
+	for id := range f.containers {
+		ids = append(ids, id)
+	}
+	return ids
+}
+
+// Pulls returns the images pulled so far, in order.
+func (f *Docker) Pulls() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]string(nil), f.pulls...)
+}
+
+// Agent returns the agent of the running container of a sandbox, or nil.
+func (f *Docker) Agent(sandboxID string) *Agent {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, c := range f.containers {
+		if c.running && c.agent.SandboxID == sandboxID {
+			return c.agent
+		}
+	}
+	return nil
+}
+
+func (f *Docker) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	down, stopped := f.down, f.stopped
+	f.mu.Unlock()
+	if down {
+		// Clients see the connection drop, as they do when the daemon's socket goes away
+		if hijacker, ok := w.(http.Hijacker); ok {
+			if conn, _, err := hijacker.Hijack(); err == nil {
+				conn.Close()
+				return
+			}
+		}
+		writeDockerError(w, http.StatusServiceUnavailable, "daemon is stopped")
+		return
+	}
+	path := apiVersionPrefix.ReplaceAllString(r.URL.Path, "")
+	switch {
+	case path == "/_ping":
+		w.Header().Set("API-Version", "1.49")
+		w.Header().Set("OSType", "linux")
+		w.WriteHeader(http.StatusOK)
+		if r.Method == http.MethodGet {
+			w.Write([]byte("OK"))
+		}
+	case path == "/events":
+		f.serveEvents(w, r, stopped)
+	case path == "/images/json" && r.Method == http.MethodGet:
+		writeJSON(w, http.StatusOK, []image.Summary{})
+	case path == "/images/create" && r.Method == http.MethodPost:
+		ref := r.URL.Query().Get("fromImage")
+		if tag := r.URL.Query().Get("tag"); tag != "" {
+			ref += ":" + tag
+		}
+		f.mu.Lock()
+		f.pulls = append(f.pulls, ref)
+		if platform := r.URL.Query().Get("platform"); platform != "" {
+			f.platforms[normalizeRef(ref)] = platform
+		}
+		f.mu.Unlock()
+		writeJSON(w, http.StatusOK, map[string]string{"status": "Downloaded image for " + ref})
+	case strings.HasPrefix(path, "/images/") && strings.HasSuffix(path, "/json") && r.Method == http.MethodGet:
+		name := strings.TrimSuffix(strings.TrimPrefix(path, "/images/"), "/json")
+		inspect := image.InspectResponse{ID: "sha256:fake", RepoTags: []string{name}}
+		parts := strings.Split(f.imagePlatform(name), "/")
+		inspect.Os, inspect.Architecture = parts[0], parts[1]
+		if len(parts) > 2 {
+			inspect.Variant = parts[2]
+		}
+		writeJSON(w, http.StatusOK, inspect)
+	case path == "/containers/create" && r.Method == http.MethodPost:
+		f.createContainer(w, r)
+	case path == "/containers/json" && r.Method == http.MethodGet:
+		f.listContainers(w, r)
+	case strings.HasPrefix(path, "/containers/"):
+		f.serveContainer(w, r, strings.TrimPrefix(path, "/containers/"))
+	case path == "/networks" && r.Method == http.MethodGet:
+		f.listNetworks(w, r)
+	case path == "/networks/create" && r.Method == http.MethodPost:
+		f.createNetwork(w, r)
+	case strings.HasPrefix(path, "/networks/"):
+		f.serveNetwork(w, r, strings.TrimPrefix(path, "/networks/"))
+	case path == "/volumes" && r.Method == http.MethodGet:
+		f.listVolumes(w, r)
+	case path == "/volumes/create" && r.Method == http.MethodPost:
+		f.createVolume(w, r)
+	case strings.HasPrefix(path, "/volumes/"):
+		f.serveVolume(w, r, strings.TrimPrefix(path, "/volumes/"))
+	default:
+		writeDockerError(w, http.StatusNotImplemented, "not supported by the fake Docker engine: "+r.Method+" "+path)
+	}
+}
+
+// imagePlatform returns the platform of a local image.
+func (f *Docker) imagePlatform(name string) string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.imagePlatformLocked(name)
+}
+
+// imagePlatformLocked is imagePlatform for callers holding f.mu.
+func (f *Docker) imagePlatformLocked(name string) string {
+	if platform, ok := f.platforms[normalizeRef(name)]; ok {
+		return platform
+	}
+	return DefaultPlatform
+}
+
+// normalizeRef returns the fully qualified form of an image reference, as pulls name it.
+func normalizeRef(name string) string {
+	named, err := reference.ParseNormalizedNamed(name)
+	if err != nil {
+		return name
+	}
+	return reference.TagNameOnly(named).String()
+}
+
+func (f *Docker) serveEvents(w http.ResponseWriter, r *http.Request, stopped <-chan struct{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	if flusher, ok := w.(http.Flusher); ok {
+		flusher.Flush()
+	}
+	select {
+	case <-r.Context().Done():
+	case <-f.done:
+	case <-stopped:
+	}
+}
+
+func (f *Docker) createContainer(w http.ResponseWriter, r *http.Request) {
+	var req container.CreateRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Config == nil {
+		writeDockerError(w, http.StatusBadRequest, "invalid container config")
+		return
+	}
+	if req.HostConfig == nil {
+		req.HostConfig = &container.HostConfig{}
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if platform := r.URL.Query().Get("platform"); platform != "" && platform != f.imagePlatformLocked(req.Config.Image) {
+		// Docker refuses to run a local image built for another platform
+		writeDockerError(w, http.StatusNotFound, fmt.Sprintf("image with reference %s was found but does not match the specified platform: wanted %s", req.Config.Image, platform))
+		return
+	}
+	name := r.URL.Query().Get("name")
+	if name != "" && f.lookupLocked(name) != nil {
+		writeDockerError(w, http.StatusConflict, fmt.Sprintf("container name %q is already in use", name))
+		return
+	}
+	f.nextID++
+	id := fmt.Sprintf("%064x", f.nextID)
+	c := &containerRecord{id: id, name: name, created: time.Now().UTC(), config: req.Config, host: req.HostConfig, files: map[string]*fakeFile{}}
+	c.mkdirAllLocked("/tmp")
+	if mode := string(req.HostConfig.NetworkMode); f.lookupNetworkLocked(mode) != nil {
+		var settings *network.EndpointSettings
+		if req.NetworkingConfig != nil {
+			settings = req.NetworkingConfig.EndpointsConfig[mode]
+		}
+		f.attachLocked(c, mode, settings)
+	}
+	f.containers[id] = c
+	writeJSON(w, http.StatusCreated, container.CreateResponse{ID: id, Warnings: []string{}})
+}
+
+func (f *Docker) listContainers(w http.ResponseWriter, r *http.Request) {
+	labels, err := labelFilters(r.URL.Query().Get("filters"))
+	if err != nil {
+		writeDockerError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	all := r.URL.Query().Get("all") == "1" || r.URL.Query().Get("all") == "true"
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	list := []container.Summary{}
+	for _, c := range f.containers {
+		if (all || c.running) && c.matches(labels) {
+			list = append(list, c.summary())
+		}
+	}
+	writeJSON(w, http.StatusOK, list)
+}
+
+func (f *Docker) serveContainer(w http.ResponseWriter, r *http.Request, rest string) {
+	ref, op, _ := strings.Cut(rest, "/")
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	c := f.lookupLocked(ref)
+	if c == nil {
+		writeDockerError(w, http.StatusNotFound, "No such container: "+ref)
+		return
+	}
+	switch {
+	case op == "json" && r.Method == http.MethodGet:
+		writeJSON(w, http.StatusOK, c.inspect())
+	case op == "start" && r.Method == http.MethodPost:
+		if !c.running {
+			f.startLocked(c)
+		}
+		w.WriteHeader(http.StatusNoContent)
+	case (op == "stop" || op == "kill") && r.Method == http.MethodPost:
+		f.stopLocked(c)
+		w.WriteHeader(http.StatusNoContent)
+	case op == "restart" && r.Method == http.MethodPost:
+		f.stopLocked(c)
+		f.startLocked(c)
+		w.WriteHeader(http.StatusNoContent)
+	case op == "archive" && (r.Method == http.MethodGet || r.Method == http.MethodHead || r.Method == http.MethodPut):
+		f.serveArchive(w, r, c)
+	case op == "stats" && r.Method == http.MethodGet:
+		stats := container.StatsResponse{ID: c.id, Name: "/" + c.name, Read: time.Now().UTC()}
+		if c.running {
+			stats.CPUStats.CPUUsage.TotalUsage = uint64(time.Since(c.started) / 2)
+			stats.MemoryStats.Usage = FakeMemoryBytes
+		}
+		writeJSON(w, http.StatusOK, stats)
+	case op == "" && r.Method == http.MethodDelete:
+		if c.running && r.URL.Query().Get("force") != "1" {
+			writeDockerError(w, http.StatusConflict, "cannot remove a running container, stop it first or use force")
+			return
+		}
+		f.stopLocked(c)
+		delete(f.containers, c.id)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		writeDockerError(w, http.StatusNotImplemented, "not supported by the fake Docker engine: "+r.Method+" /containers/{id}/"+op)
+	}
+}
+
+// lookupLocked finds a container by ID, ID prefix or name. Callers must hold f.mu.
+func (f *Docker) lookupLocked(ref string) *containerRecord {
+	if c, ok := f.containers[ref]; ok {
+		return c
+	}
+	for id, c := range f.containers {
+		if c.name == strings.TrimPrefix(ref, "/") || (len(ref) >= 12 && strings.HasPrefix(id, ref)) {
+			return c
+		}
+	}
+	return nil
+}
+
+// startLocked starts the agent of a container. Callers must hold f.mu.
+func (f *Docker) startLocked(c *containerRecord) {
+	agent := &Agent{Shell: f.shell}
+	for _, env := range c.config.Env {
+		key, value, _ := strings.Cut(env, "=")
+		switch key {
+		case "SANDBOX_ID":
+			agent.SandboxID = value
+		case "RUNTIME_OBSERVATION_URL":
+			agent.ObservationURL = f.observationURL(value)
+		case "OBSERVATION_ENCODING":
+			agent.Encoding = value
+		case "SANDBOXAI_JUPYTER_TOKEN":
+			agent.JupyterToken = value
+		case "SANDBOXAI_JUPYTER_BASE_URL":
+			agent.JupyterBaseURL = value
+		}
+	}
+	c.agent = agent
+	c.server = httptest.NewServer(agent)
+	c.running = true
+	c.started = time.Now()
+}
+
+// stopLocked stops the agent of a container. Callers must hold f.mu.
+func (f *Docker) stopLocked(c *containerRecord) {
+	if c.server != nil {
+		c.server.Close()
+		c.server = nil
+	}
+	c.running = false
+}
+
+// observationURL rewrites the observation URL of a container. Callers must hold f.mu.
+func (f *Docker) observationURL(raw string) string {
+	if f.runtimeURL == "" {
+		return raw
+	}
+	u, err := url.Parse(raw)
+	if err != nil {
+		return raw
+	}
+	runtime, err := url.Parse(f.runtimeURL)
+	if err != nil {
+		return raw
+	}
+	u.Scheme, u.Host = runtime.Scheme, runtime.Host
+	return u.String()
+}
+
+func (c *containerRecord) matches(labels map[string]string) bool {
+	return matchLabels(c.config.Labels, labels)
+}
+
+// matchLabels reports whether labels pass the filters of labelFilters.
+func matchLabels(labels, filters map[string]string) bool {
+	for key, value := range filters {
+		if got, ok := labels[key]; !ok || (value != "" && got != value) {
+			return false
+		}
+	}
+	return true
+}
+
+func (c *containerRecord) state() string {
+	if c.running {
+		return "running"
+	}
+	return "exited"
+}
+
+func (c *containerRecord) summary() container.Summary {
+	return container.Summary{
+		ID:      c.id,
+		Names:   []string{"/" + c.name},
+		Image:   c.config.Image,
+		ImageID: "sha256:fake",
+		Created: c.created.Unix(),
+		Labels:  c.config.Labels,
+		State:   c.state(),
+		Status:  c.state(),
+		HostConfig: struct {
+			NetworkMode string            `json:",omitempty"`
+			Annotations map[string]string `json:",omitempty"`
+		}{NetworkMode: string(c.host.NetworkMode)},
+		NetworkSettings: &container.NetworkSettingsSummary{Networks: c.networkSettings()},
+	}
+}
+
+func (c *containerRecord) inspect() container.InspectResponse {
+	ports := nat.PortMap{}
+	if c.server != nil {
+		_, port, _ := strings.Cut(strings.TrimPrefix(c.server.URL, "http://"), ":")
+		ports[agentPort] = []nat.PortBinding{{HostIP: "127.0.0.1", HostPort: port}}
+		ports[nat.Port(fmt.Sprintf("%d/tcp", ServicePort))] = ports[agentPort]
+		if _, exposed := c.config.ExposedPorts[jupyterPort]; exposed {
+			ports[jupyterPort] = ports[agentPort] // The agent serves the Jupyter API too
+		}
+	}
+	return container.InspectResponse{
+		ContainerJSONBase: &container.ContainerJSONBase{
+			ID:      c.id,
+			Created: c.created.Format(time.RFC3339Nano),
+			Name:    "/" + c.name,
+			Image:   "sha256:fake",
+			State: &container.State{
+				Status:  c.state(),
+				Running: c.running,
+			},
+			HostConfig: c.host,
+		},
+		Config: c.config,
+		Mounts: c.mountPoints(),
+		NetworkSettings: &container.NetworkSettings{
+			NetworkSettingsBase: container.NetworkSettingsBase{Ports: ports},
+			Networks:            c.networkSettings(),
+		},
+	}
+}
+
+// labelFilters returns the "label" filters of a Docker filters query parameter, mapping each
+// label to its required value, or "" if any value matches.
+func labelFilters(raw string) (map[string]string, error) {
+	labels := map[string]string{}
+	if raw == "" {
+		return labels, nil
+	}
+	var filters map[string]map[string]bool
+	if err := json.Unmarshal([]byte(raw), &filters); err != nil {
+		return nil, fmt.Errorf("invalid filters: %w", err)
+	}
+	for label := range filters["label"] {
+		key, value, _ := strings.Cut(label, "=")
+		labels[key] = value
+	}
+	return labels, nil
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeDockerError(w http.ResponseWriter, status int, message string) {
+	writeJSON(w, status, map[string]string{"message": message})
+}
@@ -0,0 +1,63 @@
+package fake
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/filters"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDocker_runsAgents(t *testing.T) {
+	var observations []map[string]interface{}
+	runtime := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, "/v1/internal/observations/sb", r.URL.Path)
+		var obs map[string]interface{}
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&obs))
+		observations = append(observations, obs)
+	}))
+	defer runtime.Close()
+
+	f := NewDocker(nil)
+	defer f.Close()
+	f.SetRuntimeURL(runtime.URL)
+	cli, err := f.Client()
+	require.NoError(t, err)
+	ctx := t.Context()
+
+	created, err := cli.ContainerCreate(ctx, &container.Config{
+		Image:  "box",
+		Labels: map[string]string{"sandboxai.scope": "test"},
+		Env:    []string{"SANDBOX_ID=sb", "RUNTIME_OBSERVATION_URL=http://host.docker.internal:5266/v1/internal/observations/sb"},
+	}, nil, nil, nil, "sandboxai-test-sb")
+	require.NoError(t, err)
+	require.NoError(t, cli.ContainerStart(ctx, "sandboxai-test-sb", container.StartOptions{}))
+
+	info, err := cli.ContainerInspect(ctx, created.ID)
+	require.NoError(t, err)
+	require.True(t, info.State.Running)
+	agentURL := "http://127.0.0.1:" + info.NetworkSettings.Ports[agentPort][0].HostPort
+	resp, err := http.Post(agentURL+"/tools:run_shell_command", "application/json", strings.NewReader(`{"action_id":"a","command":"echo hi"}`))
+	require.NoError(t, err)
+	resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	require.Len(t, observations, 2)
+	require.Equal(t, "hi", observations[0]["line"])
+	require.Equal(t, "result", observations[1]["observation_type"])
+
+	list, err := cli.ContainerList(ctx, container.ListOptions{All: true, Filters: filters.NewArgs(filters.Arg("label", "sandboxai.scope=test"))})
+	require.NoError(t, err)
+	require.Len(t, list, 1)
+	list, err = cli.ContainerList(ctx, container.ListOptions{All: true, Filters: filters.NewArgs(filters.Arg("label", "sandboxai.scope=other"))})
+	require.NoError(t, err)
+	require.Empty(t, list)
+
+	require.NoError(t, cli.ContainerRemove(ctx, created.ID, container.RemoveOptions{Force: true}))
+	_, err = cli.ContainerInspect(ctx, created.ID)
+	require.Error(t, err)
+	require.Empty(t, f.Containers())
+}
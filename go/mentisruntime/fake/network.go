@@ -0,0 +1,184 @@
+package fake
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/docker/docker/api/types/network"
+)
+
+// networkRecord is a user-defined network of the fake engine. Containers attached to it are
+// recorded in their own networks.
+type networkRecord struct {
+	id      string
+	name    string
+	created time.Time
+	labels  map[string]string
+}
+
+// Networks returns the names of the user-defined networks.
+func (f *Docker) Networks() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	names := make([]string, 0, len(f.networks))
+	for _, n := range f.networks {
+		names = append(names, n.name)
+	}
+	return names
+}
+
+// NetworkAliases returns the aliases a container has on a network, and whether it is
+// attached to it.
+func (f *Docker) NetworkAliases(containerID, networkName string) ([]string, bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	c := f.lookupLocked(containerID)
+	if c == nil {
+		return nil, false
+	}
+	ep, ok := c.networks[networkName]
+	if !ok {
+		return nil, false
+	}
+	return ep.Aliases, true
+}
+
+func (f *Docker) createNetwork(w http.ResponseWriter, r *http.Request) {
+	var req network.CreateRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Name == "" {
+		writeDockerError(w, http.StatusBadRequest, "invalid network config")
+		return
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.lookupNetworkLocked(req.Name) != nil {
+		writeDockerError(w, http.StatusConflict, fmt.Sprintf("network with name %s already exists", req.Name))
+		return
+	}
+	f.nextID++
+	id := fmt.Sprintf("%064x", f.nextID)
+	f.networks[id] = &networkRecord{id: id, name: req.Name, created: time.Now().UTC(), labels: req.Labels}
+	writeJSON(w, http.StatusCreated, network.CreateResponse{ID: id})
+}
+
+func (f *Docker) listNetworks(w http.ResponseWriter, r *http.Request) {
+	labels, err := labelFilters(r.URL.Query().Get("filters"))
+	if err != nil {
+		writeDockerError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	list := []network.Summary{}
+	for _, n := range f.networks {
+		if matchLabels(n.labels, labels) {
+			list = append(list, f.inspectNetworkLocked(n))
+		}
+	}
+	writeJSON(w, http.StatusOK, list)
+}
+
+func (f *Docker) serveNetwork(w http.ResponseWriter, r *http.Request, rest string) {
+	ref, op, _ := strings.Cut(rest, "/")
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	n := f.lookupNetworkLocked(ref)
+	if n == nil {
+		writeDockerError(w, http.StatusNotFound, "network "+ref+" not found")
+		return
+	}
+	switch {
+	case op == "" && r.Method == http.MethodGet:
+		writeJSON(w, http.StatusOK, f.inspectNetworkLocked(n))
+	case (op == "connect" || op == "disconnect") && r.Method == http.MethodPost:
+		var req network.ConnectOptions // Disconnect requests name the container the same way
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeDockerError(w, http.StatusBadRequest, "invalid request")
+			return
+		}
+		c := f.lookupLocked(req.Container)
+		if c == nil {
+			writeDockerError(w, http.StatusNotFound, "No such container: "+req.Container)
+			return
+		}
+		if op == "disconnect" {
+			delete(c.networks, n.name)
+		} else {
+			f.attachLocked(c, n.name, req.EndpointConfig)
+		}
+		w.WriteHeader(http.StatusOK)
+	case op == "" && r.Method == http.MethodDelete:
+		for _, c := range f.containers {
+			if _, attached := c.networks[n.name]; attached {
+				writeDockerError(w, http.StatusForbidden, "error while removing network: network "+n.name+" has active endpoints")
+				return
+			}
+		}
+		delete(f.networks, n.id)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		writeDockerError(w, http.StatusNotImplemented, "not supported by the fake Docker engine: "+r.Method+" /networks/{id}/"+op)
+	}
+}
+
+// lookupNetworkLocked finds a network by ID or name. Callers must hold f.mu.
+func (f *Docker) lookupNetworkLocked(ref string) *networkRecord {
+	if n, ok := f.networks[ref]; ok {
+		return n
+	}
+	for _, n := range f.networks {
+		if n.name == ref {
+			return n
+		}
+	}
+	return nil
+}
+
+// inspectNetworkLocked describes a network and its attached containers. Callers must hold f.mu.
+func (f *Docker) inspectNetworkLocked(n *networkRecord) network.Inspect {
+	containers := map[string]network.EndpointResource{}
+	for _, c := range f.containers {
+		if _, attached := c.networks[n.name]; attached {
+			containers[c.id] = network.EndpointResource{Name: c.name, IPv4Address: c.networks[n.name].IPAddress + "/16"}
+		}
+	}
+	return network.Inspect{
+		Name:       n.name,
+		ID:         n.id,
+		Created:    n.created,
+		Scope:      "local",
+		Driver:     "bridge",
+		EnableIPv4: true,
+		Labels:     n.labels,
+		Containers: containers,
+	}
+}
+
+// attachLocked records a container as attached to a network and gives it an address there.
+// Callers must hold f.mu.
+func (f *Docker) attachLocked(c *containerRecord, name string, settings *network.EndpointSettings) {
+	if settings == nil {
+		settings = &network.EndpointSettings{}
+	}
+	f.nextIP++
+	settings.IPAddress = fmt.Sprintf("172.30.%d.%d", f.nextIP/254, f.nextIP%254+1)
+	if c.networks == nil {
+		c.networks = make(map[string]*network.EndpointSettings)
+	}
+	c.networks[name] = settings
+}
+
+// networkSettings returns the user-defined networks a container is attached to, by name.
+func (c *containerRecord) networkSettings() map[string]*network.EndpointSettings {
+	settings := make(map[string]*network.EndpointSettings, len(c.networks))
+	for name, ep := range c.networks {
+		settings[name] = ep
+	}
+	return settings
+}
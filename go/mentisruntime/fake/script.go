@@ -0,0 +1,75 @@
+package fake
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Script is a list of scripted command outputs, read from YAML:
+//
+//	commands:
+//	  - command: make test            # The exact command
+//	    stdout: "ok\n"
+//	  - pattern: "^pip install "      # Or a regular expression
+//	    stdout: "Successfully installed\n"
+//	    delay: 2s
+//	  - pattern: "^false$"
+//	    exit_code: 1
+//
+// The first matching entry answers a command; commands matching none are answered by Echo.
+type Script struct {
+	Commands []ScriptedCommand `yaml:"commands"`
+}
+
+// ScriptedCommand is the output of the commands matching Command or Pattern.
+type ScriptedCommand struct {
+	Command  string        `yaml:"command"`
+	Pattern  string        `yaml:"pattern"`
+	Stdout   string        `yaml:"stdout"`
+	Stderr   string        `yaml:"stderr"`
+	ExitCode int           `yaml:"exit_code"`
+	Delay    time.Duration `yaml:"delay"` // How long the command "runs" before its output is sent
+}
+
+// LoadScript reads a Script file and returns the Shell that plays it.
+func LoadScript(path string) (Shell, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return ParseScript(data)
+}
+
+// ParseScript parses a YAML Script and returns the Shell that plays it.
+func ParseScript(data []byte) (Shell, error) {
+	var script Script
+	if err := yaml.Unmarshal(data, &script); err != nil {
+		return nil, fmt.Errorf("invalid script: %w", err)
+	}
+	patterns := make([]*regexp.Regexp, len(script.Commands))
+	for i, c := range script.Commands {
+		if (c.Command == "") == (c.Pattern == "") {
+			return nil, fmt.Errorf("invalid script: command %d needs either a command or a pattern", i+1)
+		}
+		if c.Pattern == "" {
+			continue
+		}
+		re, err := regexp.Compile(c.Pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid script: command %d: %w", i+1, err)
+		}
+		patterns[i] = re
+	}
+	return func(command string) Result {
+		for i, c := range script.Commands {
+			if c.Command == command || (patterns[i] != nil && patterns[i].MatchString(command)) {
+				return Result{Stdout: c.Stdout, Stderr: c.Stderr, ExitCode: c.ExitCode, Delay: c.Delay}
+			}
+		}
+		return Echo(command)
+	}, nil
+}
@@ -0,0 +1,30 @@
+package fake
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseScript(t *testing.T) {
+	shell, err := ParseScript([]byte(`
+commands:
+  - command: make test
+    stdout: "ok\n"
+  - pattern: "^pip install "
+    stderr: "no network\n"
+    exit_code: 1
+    delay: 2s
+`))
+	require.NoError(t, err)
+	require.Equal(t, Result{Stdout: "ok\n"}, shell("make test"))
+	require.Equal(t, Result{Stderr: "no network\n", ExitCode: 1, Delay: 2 * time.Second}, shell("pip install requests"))
+	require.Equal(t, Result{Stdout: "hi\n"}, shell("echo hi"))
+	require.Equal(t, Result{ExitCode: 3}, shell("exit 3"))
+
+	_, err = ParseScript([]byte("commands:\n  - stdout: x\n"))
+	require.ErrorContains(t, err, "needs either a command or a pattern")
+	_, err = ParseScript([]byte("commands:\n  - pattern: \"(\"\n"))
+	require.ErrorContains(t, err, "command 1")
+}
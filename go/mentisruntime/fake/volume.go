@@ -0,0 +1,106 @@
+package fake
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/mount"
+	"github.com/docker/docker/api/types/volume"
+)
+
+// volumeRecord is a named volume of the fake engine. It holds no data: containers mounting
+// it do not share files.
+type volumeRecord struct {
+	name    string
+	created time.Time
+	labels  map[string]string
+}
+
+func (f *Docker) createVolume(w http.ResponseWriter, r *http.Request) {
+	var req volume.CreateOptions
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Name == "" {
+		writeDockerError(w, http.StatusBadRequest, "invalid volume config")
+		return
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	v, exists := f.volumes[req.Name]
+	if !exists { // Creating an existing volume returns it, as Docker does
+		v = &volumeRecord{name: req.Name, created: time.Now().UTC(), labels: req.Labels}
+		f.volumes[req.Name] = v
+	}
+	writeJSON(w, http.StatusCreated, v.inspect())
+}
+
+func (f *Docker) listVolumes(w http.ResponseWriter, r *http.Request) {
+	labels, err := labelFilters(r.URL.Query().Get("filters"))
+	if err != nil {
+		writeDockerError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	list := volume.ListResponse{Volumes: []*volume.Volume{}}
+	for _, v := range f.volumes {
+		if matchLabels(v.labels, labels) {
+			inspect := v.inspect()
+			list.Volumes = append(list.Volumes, &inspect)
+		}
+	}
+	writeJSON(w, http.StatusOK, list)
+}
+
+func (f *Docker) serveVolume(w http.ResponseWriter, r *http.Request, name string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	v, exists := f.volumes[name]
+	if !exists {
+		writeDockerError(w, http.StatusNotFound, "get "+name+": no such volume")
+		return
+	}
+	switch r.Method {
+	case http.MethodGet:
+		writeJSON(w, http.StatusOK, v.inspect())
+	case http.MethodDelete:
+		for _, c := range f.containers {
+			for _, m := range c.host.Mounts {
+				if m.Type == mount.TypeVolume && m.Source == name {
+					writeDockerError(w, http.StatusConflict, "remove "+name+": volume is in use - ["+c.id+"]")
+					return
+				}
+			}
+		}
+		delete(f.volumes, name)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		writeDockerError(w, http.StatusNotImplemented, "not supported by the fake Docker engine: "+r.Method+" /volumes/{name}")
+	}
+}
+
+// mountPoints describes the mounts of a container as inspect reports them.
+func (c *containerRecord) mountPoints() []container.MountPoint {
+	points := make([]container.MountPoint, 0, len(c.host.Mounts))
+	for _, m := range c.host.Mounts {
+		point := container.MountPoint{Type: m.Type, Source: m.Source, Destination: m.Target, RW: !m.ReadOnly}
+		if m.Type == mount.TypeVolume {
+			point.Name, point.Driver = m.Source, "local"
+		}
+		points = append(points, point)
+	}
+	return points
+}
+
+func (v *volumeRecord) inspect() volume.Volume {
+	return volume.Volume{
+		Name:       v.name,
+		Driver:     "local",
+		Mountpoint: "/var/lib/docker/volumes/" + v.name + "/_data",
+		CreatedAt:  v.created.Format(time.RFC3339),
+		Labels:     v.labels,
+		Scope:      "local",
+	}
+}
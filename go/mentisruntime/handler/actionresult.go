@@ -0,0 +1,87 @@
+package handler
+
+import (
+	"encoding/json"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/mux"
+)
+
+// Formats of action results, chosen with the Accept header.
+const (
+	resultFormatJSON   = "application/json"     // The manager.ActionResult
+	resultFormatText   = "text/plain"           // The stdout of the action
+	resultFormatNDJSON = "application/x-ndjson" // Its observations, one per line
+)
+
+// GetActionResultHandler returns the result of an ended action in the format the Accept
+// header asks for: JSON (the default), plain text holding only the action's stdout, or
+// NDJSON of its observations. The Exit-Code header holds the action's exit code in all three.
+func (h *APIHandler) GetActionResultHandler(w http.ResponseWriter, r *http.Request) {
+	sandboxState, ok := h.lookupSandboxInSpace(w, r)
+	if !ok {
+		return
+	}
+	format := negotiate(r.Header.Get("Accept"), resultFormatJSON, resultFormatText, resultFormatNDJSON)
+	if format == "" {
+		writeErrorCode(w, "Acceptable formats are "+strings.Join([]string{resultFormatJSON, resultFormatText, resultFormatNDJSON}, ", "), "not_acceptable", http.StatusNotAcceptable)
+		return
+	}
+
+	result, err := h.sandboxManager.ActionResult(r.Context(), sandboxState.ID, mux.Vars(r)["actionID"])
+	if err != nil {
+		h.writeManagerError(w, err, "Failed to get action result")
+		return
+	}
+
+	w.Header().Set("Exit-Code", strconv.Itoa(result.ExitCode))
+	switch format {
+	case resultFormatText:
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		io.WriteString(w, result.Stdout)
+	case resultFormatNDJSON:
+		w.Header().Set("Content-Type", resultFormatNDJSON)
+		for _, rec := range result.Observations {
+			w.Write(rec.Observation)
+			w.Write([]byte("\n"))
+		}
+	default:
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(result)
+	}
+}
+
+// negotiate returns the offer an Accept header prefers: the one with the highest quality,
+// the first offer for wildcards and for an empty header, and "" if it accepts none.
+func negotiate(accept string, offers ...string) string {
+	if strings.TrimSpace(accept) == "" {
+		return offers[0]
+	}
+	best, bestQ := "", 0.0
+	for _, part := range strings.Split(accept, ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+		q := 1.0
+		if raw, ok := params["q"]; ok {
+			if q, err = strconv.ParseFloat(raw, 64); err != nil {
+				continue
+			}
+		}
+		for _, offer := range offers {
+			matches := mediaType == offer || mediaType == "*/*" || (strings.HasSuffix(mediaType, "/*") && strings.HasPrefix(offer, strings.TrimSuffix(mediaType, "*")))
+			if matches && q > bestQ {
+				best, bestQ = offer, q
+			}
+			if matches {
+				break // Wildcards stand for the first offer they match
+			}
+		}
+	}
+	return best
+}
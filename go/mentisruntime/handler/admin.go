@@ -0,0 +1,77 @@
+package handler
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// RequireAdminToken protects admin routes with a static bearer token. An empty token
+// leaves the routes open, matching the rest of the API.
+func RequireAdminToken(token string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if token != "" {
+				got := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+				if subtle.ConstantTimeCompare([]byte(got), []byte(token)) != 1 {
+					WriteError(w, "Unauthorized", http.StatusUnauthorized)
+					return
+				}
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// GarbageCollectHandler removes Docker resources of this scope that no sandbox or space owns.
+// With ?dry_run=true it only reports them.
+func (h *APIHandler) GarbageCollectHandler(w http.ResponseWriter, r *http.Request) {
+	dryRun := false
+	if v := r.URL.Query().Get("dry_run"); v != "" {
+		parsed, err := strconv.ParseBool(v)
+		if err != nil {
+			WriteError(w, "Invalid 'dry_run' query parameter", http.StatusBadRequest)
+			return
+		}
+		dryRun = parsed
+	}
+
+	report, err := h.sandboxManager.GarbageCollect(r.Context(), dryRun)
+	if err != nil {
+		h.writeManagerError(w, err, "Garbage collection failed")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(report)
+}
+
+// HubStatsHandler reports WebSocket delivery health: connected clients, queue depths and
+// messages dropped because the hub or a client could not keep up.
+func (h *APIHandler) HubStatsHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(h.hub.Stats())
+}
+
+// PrewarmStatusHandler reports the pull status of the pre-warmed images.
+func (h *APIHandler) PrewarmStatusHandler(w http.ResponseWriter, r *http.Request) {
+	status, err := h.sandboxManager.GetPrewarmStatus()
+	if err != nil {
+		h.writeManagerError(w, err, "Failed to get pre-warm status")
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(status)
+}
+
+// RefreshPrewarmHandler pulls the pre-warmed images ahead of schedule. The pulls run in the
+// background; poll the status to follow them.
+func (h *APIHandler) RefreshPrewarmHandler(w http.ResponseWriter, r *http.Request) {
+	if err := h.sandboxManager.RefreshPrewarm(); err != nil {
+		h.writeManagerError(w, err, "Failed to refresh pre-warmed images")
+		return
+	}
+	w.WriteHeader(http.StatusAccepted)
+}
@@ -0,0 +1,68 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/gorilla/mux"
+)
+
+// CaptureArtifactRequest represents the request body for capturing an artifact.
+type CaptureArtifactRequest struct {
+	Path string `json:"path"`
+	Name string `json:"name,omitempty"`
+}
+
+// CaptureArtifactHandler copies a file or directory out of a sandbox into the artifact store.
+func (h *APIHandler) CaptureArtifactHandler(w http.ResponseWriter, r *http.Request) {
+	sandboxState, ok := h.lookupSandboxInSpace(w, r)
+	if !ok {
+		return
+	}
+
+	var req CaptureArtifactRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		WriteError(w, "Invalid request body: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := req.Validate(); err != nil {
+		writeValidationError(w, err)
+		return
+	}
+
+	artifact, err := h.sandboxManager.CaptureArtifact(r.Context(), sandboxState.ID, req.Path, req.Name)
+	if err != nil {
+		h.writeManagerError(w, err, "Failed to capture artifact")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(artifact)
+}
+
+// ListArtifactsHandler lists the artifacts of a sandbox. It keeps working after the sandbox is deleted.
+func (h *APIHandler) ListArtifactsHandler(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	artifacts, err := h.sandboxManager.ListArtifacts(r.Context(), vars["spaceID"], vars["sandboxID"])
+	if err != nil {
+		h.writeManagerError(w, err, "Failed to list artifacts")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(artifacts)
+}
+
+// GetArtifactHandler returns a single artifact with a fresh download URL.
+func (h *APIHandler) GetArtifactHandler(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	artifact, err := h.sandboxManager.GetArtifact(r.Context(), vars["spaceID"], vars["sandboxID"], vars["artifactID"])
+	if err != nil {
+		h.writeManagerError(w, err, "Failed to get artifact")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(artifact)
+}
@@ -0,0 +1,68 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+
+	"github.com/foreveryh/sandboxai/go/mentisruntime/manager"
+	"github.com/foreveryh/sandboxai/go/mentisruntime/validation"
+)
+
+// maxBatchDeleteIDs caps the number of sandbox IDs in one batch delete request.
+const maxBatchDeleteIDs = 1000
+
+// BatchDeleteSandboxesRequest names the sandboxes to delete, by ID or by label selector.
+type BatchDeleteSandboxesRequest struct {
+	SandboxIDs []string          `json:"sandbox_ids,omitempty"`
+	Selector   map[string]string `json:"selector,omitempty"` // Labels a sandbox must all have
+}
+
+// BatchDeleteSandboxesResponse lists the outcome for each sandbox.
+type BatchDeleteSandboxesResponse struct {
+	Results []manager.DeleteResult `json:"results"`
+}
+
+// Validate checks a batch delete request.
+func (req *BatchDeleteSandboxesRequest) Validate() error {
+	var v validation.Validator
+	switch {
+	case len(req.SandboxIDs) == 0 && len(req.Selector) == 0:
+		v.Add("sandbox_ids", "sandbox_ids or selector is required")
+	case len(req.SandboxIDs) > 0 && len(req.Selector) > 0:
+		v.Add("selector", "cannot be combined with sandbox_ids")
+	}
+	v.Check(len(req.SandboxIDs) <= maxBatchDeleteIDs, "sandbox_ids", "must have at most "+strconv.Itoa(maxBatchDeleteIDs)+" entries")
+	for i, id := range req.SandboxIDs {
+		v.Required("sandbox_ids["+strconv.Itoa(i)+"]", id)
+	}
+	return v.Err()
+}
+
+// BatchDeleteSandboxesHandler deletes several sandboxes of a space concurrently. It responds
+// 200 with a result per sandbox, even if some of the deletions failed.
+func (h *APIHandler) BatchDeleteSandboxesHandler(w http.ResponseWriter, r *http.Request) {
+	spaceID := mux.Vars(r)["spaceID"]
+	var req BatchDeleteSandboxesRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		WriteError(w, "Invalid request body: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := req.Validate(); err != nil {
+		writeValidationError(w, err)
+		return
+	}
+	force, ok := parseForce(w, r)
+	if !ok {
+		return
+	}
+	results, err := h.sandboxManager.DeleteSandboxes(r.Context(), spaceID, req.SandboxIDs, req.Selector, force)
+	if err != nil {
+		h.writeManagerError(w, err, "Failed to delete sandboxes in space "+spaceID)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(BatchDeleteSandboxesResponse{Results: results})
+}
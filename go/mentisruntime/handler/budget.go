@@ -0,0 +1,100 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/gorilla/mux"
+
+	"github.com/foreveryh/sandboxai/go/mentisruntime/manager"
+)
+
+// GetSpaceBudgetHandler reports the budget of a space and the usage charged to it.
+func (h *APIHandler) GetSpaceBudgetHandler(w http.ResponseWriter, r *http.Request) {
+	spaceID := mux.Vars(r)["spaceID"]
+	status, err := h.sandboxManager.GetSpaceBudget(r.Context(), spaceID)
+	if err != nil {
+		h.writeManagerError(w, err, "Failed to get budget of space "+spaceID)
+		return
+	}
+	if status == nil {
+		WriteError(w, "Space "+spaceID+" has no budget", http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(status)
+}
+
+// SetSpaceBudgetHandler sets the budget of a space, replacing any previous one.
+func (h *APIHandler) SetSpaceBudgetHandler(w http.ResponseWriter, r *http.Request) {
+	spaceID := mux.Vars(r)["spaceID"]
+	budget, ok := decodeBudget(w, r)
+	if !ok {
+		return
+	}
+	if err := h.sandboxManager.SetSpaceBudget(r.Context(), spaceID, budget); err != nil {
+		h.writeManagerError(w, err, "Failed to set budget of space "+spaceID)
+		return
+	}
+	h.GetSpaceBudgetHandler(w, r)
+}
+
+// DeleteSpaceBudgetHandler removes the budget of a space.
+func (h *APIHandler) DeleteSpaceBudgetHandler(w http.ResponseWriter, r *http.Request) {
+	spaceID := mux.Vars(r)["spaceID"]
+	if err := h.sandboxManager.SetSpaceBudget(r.Context(), spaceID, nil); err != nil {
+		h.writeManagerError(w, err, "Failed to remove budget of space "+spaceID)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// ListTenantBudgetsHandler reports the budgets of tenants and the usage charged to them.
+func (h *APIHandler) ListTenantBudgetsHandler(w http.ResponseWriter, r *http.Request) {
+	budgets, err := h.sandboxManager.ListTenantBudgets()
+	if err != nil {
+		h.writeManagerError(w, err, "Failed to list tenant budgets")
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(budgets)
+}
+
+// SetTenantBudgetHandler sets the budget of a tenant across all its spaces.
+func (h *APIHandler) SetTenantBudgetHandler(w http.ResponseWriter, r *http.Request) {
+	tenant := mux.Vars(r)["tenant"]
+	budget, ok := decodeBudget(w, r)
+	if !ok {
+		return
+	}
+	if err := h.sandboxManager.SetTenantBudget(tenant, budget); err != nil {
+		h.writeManagerError(w, err, "Failed to set budget of tenant "+tenant)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// DeleteTenantBudgetHandler removes the budget of a tenant.
+func (h *APIHandler) DeleteTenantBudgetHandler(w http.ResponseWriter, r *http.Request) {
+	tenant := mux.Vars(r)["tenant"]
+	if err := h.sandboxManager.SetTenantBudget(tenant, nil); err != nil {
+		h.writeManagerError(w, err, "Failed to remove budget of tenant "+tenant)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// decodeBudget reads and validates the budget of a request, writing the error response if
+// it is invalid.
+func decodeBudget(w http.ResponseWriter, r *http.Request) (*manager.Budget, bool) {
+	var budget manager.Budget
+	if err := json.NewDecoder(r.Body).Decode(&budget); err != nil {
+		WriteError(w, "Invalid request body", http.StatusBadRequest)
+		return nil, false
+	}
+	if err := validateBudget(budget); err != nil {
+		writeValidationError(w, err)
+		return nil, false
+	}
+	return &budget, true
+}
@@ -0,0 +1,43 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+)
+
+// CloneSandboxRequest is the optional body of a clone request.
+type CloneSandboxRequest struct {
+	SpaceID string `json:"space_id,omitempty"` // Target space; defaults to the source sandbox's space
+}
+
+// CloneSandboxHandler snapshots a sandbox's filesystem and starts a new sandbox from it.
+func (h *APIHandler) CloneSandboxHandler(w http.ResponseWriter, r *http.Request) {
+	sandboxState, ok := h.lookupSandboxInSpace(w, r)
+	if !ok {
+		return
+	}
+
+	var req CloneSandboxRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+		WriteError(w, "Invalid request body: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	defer r.Body.Close()
+
+	cloneID, err := h.sandboxManager.CloneSandbox(r.Context(), sandboxState.ID, req.SpaceID)
+	if err != nil {
+		h.writeManagerError(w, err, "Failed to clone sandbox")
+		return
+	}
+	cloneState, err := h.sandboxManager.GetSandbox(r.Context(), cloneID)
+	if err != nil {
+		h.writeManagerError(w, err, "Failed to retrieve cloned sandbox")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(cloneState)
+}
@@ -0,0 +1,26 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/foreveryh/sandboxai/go/mentisruntime/manager"
+)
+
+// SecurityProfilesResponse lists the profiles create requests can choose.
+type SecurityProfilesResponse struct {
+	SecurityProfiles []string `json:"security_profiles"`
+	SeccompProfiles  []string `json:"seccomp_profiles"`
+	AppArmorProfiles []string `json:"apparmor_profiles"`
+}
+
+// ListSecurityProfilesHandler lists the security, seccomp and AppArmor profiles sandboxes
+// can be created with.
+func (h *APIHandler) ListSecurityProfilesHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(SecurityProfilesResponse{
+		SecurityProfiles: []string{manager.SecurityProfileDefault, manager.SecurityProfileHardened},
+		SeccompProfiles:  h.sandboxManager.SeccompProfiles(),
+		AppArmorProfiles: h.sandboxManager.AppArmorProfiles(),
+	})
+}
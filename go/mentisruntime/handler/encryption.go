@@ -0,0 +1,44 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+)
+
+// ObservationKeysHandler lists the keys a space's persisted observations are sealed with.
+func (h *APIHandler) ObservationKeysHandler(w http.ResponseWriter, r *http.Request) {
+	spaceID := mux.Vars(r)["spaceID"]
+	keys, err := h.sandboxManager.ObservationKeys(r.Context(), spaceID)
+	if err != nil {
+		h.writeManagerError(w, err, "Failed to list observation keys")
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{"keys": keys})
+}
+
+// RotateObservationKeyHandler seals a space's observations with a new key from now on. With
+// ?reseal=true the space's history files are rewritten with the new key too.
+func (h *APIHandler) RotateObservationKeyHandler(w http.ResponseWriter, r *http.Request) {
+	spaceID := mux.Vars(r)["spaceID"]
+	reseal := false
+	if v := r.URL.Query().Get("reseal"); v != "" {
+		parsed, err := strconv.ParseBool(v)
+		if err != nil {
+			WriteError(w, "Invalid 'reseal' query parameter", http.StatusBadRequest)
+			return
+		}
+		reseal = parsed
+	}
+
+	rotation, err := h.sandboxManager.RotateObservationKey(r.Context(), spaceID, reseal)
+	if err != nil {
+		h.writeManagerError(w, err, "Failed to rotate observation key")
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(rotation)
+}
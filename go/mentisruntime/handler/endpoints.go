@@ -0,0 +1,22 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/gorilla/mux"
+)
+
+// GetSpaceEndpointsHandler returns the hostnames and addresses of the sandboxes on the
+// network of a space.
+func (h *APIHandler) GetSpaceEndpointsHandler(w http.ResponseWriter, r *http.Request) {
+	spaceID := mux.Vars(r)["spaceID"]
+	endpoints, err := h.sandboxManager.GetSpaceEndpoints(r.Context(), spaceID)
+	if err != nil {
+		h.writeManagerError(w, err, "Failed to list endpoints of space "+spaceID)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(endpoints)
+}
@@ -0,0 +1,49 @@
+package handler
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/foreveryh/sandboxai/go/mentisruntime/manager"
+)
+
+// statusForKind maps manager error kinds to HTTP status codes.
+var statusForKind = map[manager.ErrorKind]int{
+	manager.KindNotFound:    http.StatusNotFound,
+	manager.KindConflict:    http.StatusConflict,
+	manager.KindInvalid:     http.StatusBadRequest,
+	manager.KindQuota:       http.StatusTooManyRequests,
+	manager.KindTimeout:     http.StatusGatewayTimeout,
+	manager.KindBackend:     http.StatusBadGateway,
+	manager.KindUnavailable: http.StatusNotImplemented,
+}
+
+// writeErrorCode writes an error response carrying a machine-readable code.
+func writeErrorCode(w http.ResponseWriter, message, code string, statusCode int) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+	json.NewEncoder(w).Encode(ErrorResponse{Message: message, Code: code})
+}
+
+// writeManagerError maps a manager error to its HTTP status and error code. message
+// describes the failed operation, e.g. "Failed to create sandbox". Unclassified errors
+// are logged and reported as 500.
+func (h *APIHandler) writeManagerError(w http.ResponseWriter, err error, message string) {
+	kind := manager.KindOf(err)
+	status, ok := statusForKind[kind]
+	if !ok {
+		status = http.StatusInternalServerError
+	}
+	code := manager.CodeOf(err)
+	if code == "" {
+		code = string(kind)
+	}
+	if code == "" {
+		code = "internal"
+	}
+	if status >= http.StatusInternalServerError {
+		h.logger.Error(message, "error", err, "code", code)
+	}
+	writeErrorCode(w, fmt.Sprintf("%s: %v", message, err), code, status)
+}
@@ -0,0 +1,28 @@
+package handler
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/foreveryh/sandboxai/go/mentisruntime/manager"
+	"github.com/foreveryh/sandboxai/go/mentisruntime/ws"
+)
+
+// StreamEventsHandler streams the events of every space over a WebSocket, each with the
+// "space_id" it belongs to, for dashboards and audit pipelines. ?types=a,b sends only events
+// of those types; ?cursor resumes as on a sandbox stream.
+func (h *APIHandler) StreamEventsHandler(w http.ResponseWriter, r *http.Request) {
+	opts := []ws.StreamOption{ws.WithFormats(StreamFormats...)}
+	if v := r.URL.Query().Get("types"); v != "" {
+		var types []string
+		for _, t := range strings.Split(v, ",") {
+			if t = strings.TrimSpace(t); t == "" {
+				WriteError(w, "Invalid 'types' query parameter", http.StatusBadRequest)
+				return
+			}
+			types = append(types, t)
+		}
+		opts = append(opts, ws.WithTypes(types...))
+	}
+	ws.ServeStream(h.hub, h.sandboxManager, manager.EventStreamID, w, r, h.logger, opts...)
+}
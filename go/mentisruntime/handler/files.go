@@ -0,0 +1,87 @@
+package handler
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"path"
+
+	"github.com/foreveryh/sandboxai/go/mentisruntime/manager"
+)
+
+// FileChecksumsResponse lists the checksums of the regular files at or below a path.
+type FileChecksumsResponse struct {
+	Path  string                 `json:"path"`
+	Files []manager.FileChecksum `json:"files"`
+}
+
+// filePath returns the absolute path of the ?path query parameter, or writes an error.
+func filePath(w http.ResponseWriter, r *http.Request) (string, bool) {
+	p := r.URL.Query().Get("path")
+	if !path.IsAbs(p) {
+		WriteError(w, "Query parameter 'path' must be an absolute path", http.StatusBadRequest)
+		return "", false
+	}
+	return path.Clean(p), true
+}
+
+// ReadFilesHandler returns a file or directory of a sandbox as a tar archive whose root entry
+// is named after the last element of ?path.
+func (h *APIHandler) ReadFilesHandler(w http.ResponseWriter, r *http.Request) {
+	sandboxState, ok := h.lookupSandboxInSpace(w, r)
+	if !ok {
+		return
+	}
+	p, ok := filePath(w, r)
+	if !ok {
+		return
+	}
+	rc, err := h.sandboxManager.ReadFiles(r.Context(), sandboxState.SpaceID, sandboxState.ID, p)
+	if err != nil {
+		h.writeManagerError(w, err, "Failed to read files")
+		return
+	}
+	defer rc.Close()
+	w.Header().Set("Content-Type", "application/x-tar")
+	if _, err := io.Copy(w, rc); err != nil {
+		h.logger.Warn("Failed to send files", "sandboxID", sandboxState.ID, "path", p, "error", err)
+	}
+}
+
+// WriteFilesHandler extracts the tar archive of the request body into the directory ?path
+// of a sandbox, creating it if needed.
+func (h *APIHandler) WriteFilesHandler(w http.ResponseWriter, r *http.Request) {
+	sandboxState, ok := h.lookupSandboxInSpace(w, r)
+	if !ok {
+		return
+	}
+	p, ok := filePath(w, r)
+	if !ok {
+		return
+	}
+	if err := h.sandboxManager.WriteFiles(r.Context(), sandboxState.SpaceID, sandboxState.ID, p, r.Body); err != nil {
+		h.writeManagerError(w, err, "Failed to write files")
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// FileChecksumsHandler returns the SHA-256 checksums of the regular files at or below ?path
+// of a sandbox, so clients can skip copying unchanged files.
+func (h *APIHandler) FileChecksumsHandler(w http.ResponseWriter, r *http.Request) {
+	sandboxState, ok := h.lookupSandboxInSpace(w, r)
+	if !ok {
+		return
+	}
+	p, ok := filePath(w, r)
+	if !ok {
+		return
+	}
+	checksums, err := h.sandboxManager.FileChecksums(r.Context(), sandboxState.SpaceID, sandboxState.ID, p)
+	if err != nil {
+		h.writeManagerError(w, err, "Failed to checksum files")
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(FileChecksumsResponse{Path: p, Files: checksums})
+}
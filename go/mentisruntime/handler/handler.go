@@ -6,10 +6,14 @@ import (
 	"fmt"
 	"io"
 	"log/slog"
+	"mime"
 	"net/http"
-	"strings"
+	"strconv"
+	"time"
 
 	"github.com/foreveryh/sandboxai/go/mentisruntime/manager"
+	"github.com/foreveryh/sandboxai/go/mentisruntime/msgpack"
+	"github.com/foreveryh/sandboxai/go/mentisruntime/validation"
 	"github.com/foreveryh/sandboxai/go/mentisruntime/ws"
 	"github.com/gorilla/mux"
 )
@@ -23,7 +27,7 @@ type APIHandler struct {
 
 func NewAPIHandler(logger *slog.Logger, sandboxManager *manager.SandboxManager, spaceManager *manager.SpaceManager, hub *ws.Hub) *APIHandler {
 	return &APIHandler{
-		logger:         logger,
+		logger:         logger.With("component", "api-handler"),
 		sandboxManager: sandboxManager,
 		spaceManager:   spaceManager,
 		hub:           hub,
@@ -32,33 +36,11 @@ func NewAPIHandler(logger *slog.Logger, sandboxManager *manager.SandboxManager,
 
 // PostShellCommandHandler handles requests to execute a shell command asynchronously.
 func (h *APIHandler) PostShellCommandHandler(w http.ResponseWriter, r *http.Request) {
-	vars := mux.Vars(r)
-	spaceID := vars["spaceID"]     // Extract spaceID from path
-	sandboxID := vars["sandboxID"] // Corrected key based on route definition
-
-	if spaceID == "" || sandboxID == "" {
-		WriteError(w, "Missing spaceID or sandboxID in path", http.StatusBadRequest)
-		return
-	}
-
-	// --- Validation: Check if sandbox belongs to the space --- 
-	sandboxState, getErr := h.sandboxManager.GetSandbox(r.Context(), sandboxID)
-	if getErr != nil {
-		// If sandbox doesn't exist at all, return 404
-		if errors.Is(getErr, manager.ErrSandboxNotFound) || strings.Contains(getErr.Error(), "not found") {
-			WriteError(w, fmt.Sprintf("Sandbox %s not found", sandboxID), http.StatusNotFound)
-		} else {
-			h.logger.Error("Failed to get sandbox before initiating action", "spaceID", spaceID, "sandboxID", sandboxID, "error", getErr)
-			WriteError(w, "Failed to check sandbox before initiating action: "+getErr.Error(), http.StatusInternalServerError)
-		}
-		return
-	}
-	if sandboxState.SpaceID != spaceID {
-		h.logger.Warn("Attempt to run shell command on sandbox via incorrect space path", "requestedSpaceID", spaceID, "actualSpaceID", sandboxState.SpaceID, "sandboxID", sandboxID)
-		WriteError(w, fmt.Sprintf("Sandbox %s not found in space %s", sandboxID, spaceID), http.StatusNotFound)
+	sandboxState, ok := h.lookupSandboxInSpace(w, r)
+	if !ok {
 		return
 	}
-	// --- End Validation --- 
+	sandboxID := sandboxState.ID
 
 	var payload map[string]interface{} // Use map for flexibility
 	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
@@ -66,22 +48,14 @@ func (h *APIHandler) PostShellCommandHandler(w http.ResponseWriter, r *http.Requ
 		return
 	}
 
-	// Basic validation (ensure command exists, etc.) - can be expanded
-	if _, ok := payload["command"]; !ok {
-		WriteError(w, "Missing 'command' in request body", http.StatusBadRequest) // Use WriteError
+	if err := validateActionPayload(payload, "command"); err != nil {
+		writeValidationError(w, err)
 		return
 	}
 
 	actionID, err := h.sandboxManager.InitiateAction(r.Context(), sandboxID, "shell", payload)
 	if err != nil {
-		h.logger.Error("Failed to initiate shell action", "sandboxID", sandboxID, "error", err)
-		// Map manager errors to appropriate HTTP status codes
-		// Example: Check for specific errors like sandbox not found or not running
-		if strings.Contains(err.Error(), "not found or not running") { // Basic check, refine with specific errors
-			WriteError(w, fmt.Sprintf("Failed to initiate shell command: sandbox %s not found or not running", sandboxID), http.StatusNotFound)
-		} else {
-			WriteError(w, "Failed to initiate shell command: "+err.Error(), http.StatusInternalServerError)
-		}
+		h.writeManagerError(w, err, "Failed to initiate shell command")
 		return
 	}
 
@@ -92,33 +66,11 @@ func (h *APIHandler) PostShellCommandHandler(w http.ResponseWriter, r *http.Requ
 
 // PostIPythonCellHandler handles requests to execute an IPython cell asynchronously.
 func (h *APIHandler) PostIPythonCellHandler(w http.ResponseWriter, r *http.Request) {
-	vars := mux.Vars(r)
-	spaceID := vars["spaceID"]     // Extract spaceID from path
-	sandboxID := vars["sandboxID"] // Corrected key based on route definition
-
-	if spaceID == "" || sandboxID == "" {
-		WriteError(w, "Missing spaceID or sandboxID in path", http.StatusBadRequest)
+	sandboxState, ok := h.lookupSandboxInSpace(w, r)
+	if !ok {
 		return
 	}
-
-	// --- Validation: Check if sandbox belongs to the space --- 
-	sandboxState, getErr := h.sandboxManager.GetSandbox(r.Context(), sandboxID)
-	if getErr != nil {
-		// If sandbox doesn't exist at all, return 404
-		if errors.Is(getErr, manager.ErrSandboxNotFound) || strings.Contains(getErr.Error(), "not found") {
-			WriteError(w, fmt.Sprintf("Sandbox %s not found", sandboxID), http.StatusNotFound)
-		} else {
-			h.logger.Error("Failed to get sandbox before initiating action", "spaceID", spaceID, "sandboxID", sandboxID, "error", getErr)
-			WriteError(w, "Failed to check sandbox before initiating action: "+getErr.Error(), http.StatusInternalServerError)
-		}
-		return
-	}
-	if sandboxState.SpaceID != spaceID {
-		h.logger.Warn("Attempt to run ipython cell on sandbox via incorrect space path", "requestedSpaceID", spaceID, "actualSpaceID", sandboxState.SpaceID, "sandboxID", sandboxID)
-		WriteError(w, fmt.Sprintf("Sandbox %s not found in space %s", sandboxID, spaceID), http.StatusNotFound)
-		return
-	}
-	// --- End Validation --- 
+	sandboxID := sandboxState.ID
 
 	var payload map[string]interface{} // Use map for flexibility
 	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
@@ -126,22 +78,14 @@ func (h *APIHandler) PostIPythonCellHandler(w http.ResponseWriter, r *http.Reque
 		return
 	}
 
-	// Basic validation (ensure code exists, etc.) - can be expanded
-	if _, ok := payload["code"]; !ok {
-		WriteError(w, "Missing 'code' in request body", http.StatusBadRequest) // Use WriteError
+	if err := validateActionPayload(payload, "code"); err != nil {
+		writeValidationError(w, err)
 		return
 	}
 
 	actionID, err := h.sandboxManager.InitiateAction(r.Context(), sandboxID, "ipython", payload)
 	if err != nil {
-		h.logger.Error("Failed to initiate ipython action", "sandboxID", sandboxID, "error", err)
-		// Map manager errors to appropriate HTTP status codes
-		// Example: Check for specific errors like sandbox not found or not running
-		if strings.Contains(err.Error(), "not found or not running") { // Basic check, refine with specific errors
-			WriteError(w, fmt.Sprintf("Failed to initiate IPython cell execution: sandbox %s not found or not running", sandboxID), http.StatusNotFound)
-		} else {
-			WriteError(w, "Failed to initiate IPython cell execution: "+err.Error(), http.StatusInternalServerError)
-		}
+		h.writeManagerError(w, err, "Failed to initiate IPython cell execution")
 		return
 	}
 
@@ -171,9 +115,19 @@ func (h *APIHandler) InternalObservationHandler(w http.ResponseWriter, r *http.R
 	}
 	defer r.Body.Close() // Ensure body is closed
 
+	// Agents started with OBSERVATION_ENCODING=msgpack push MessagePack
+	if mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); mediaType == msgpack.ContentType {
+		if bodyBytes, err = msgpack.ToJSON(bodyBytes); err != nil {
+			WriteError(w, "Invalid MessagePack observation: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
 	// ******** 添加的日志行 ********
 	// Log the raw body received from the agent BEFORE passing it to the manager
-	h.logger.Debug("Received raw internal observation body", "sandboxID", sandboxID, "body", string(bodyBytes))
+	if h.logger.Enabled(r.Context(), slog.LevelDebug) { // Copying the body to a string costs on every output line
+		h.logger.Debug("Received raw internal observation body", "sandboxID", sandboxID, "body", string(bodyBytes))
+	}
 	// ***************************
 
 	// Pass the raw bytes to the manager for processing and broadcasting
@@ -194,6 +148,8 @@ func (h *APIHandler) InternalObservationHandler(w http.ResponseWriter, r *http.R
 // ErrorResponse represents an error response
 type ErrorResponse struct {
 	Message string `json:"message"`
+	Code    string `json:"code,omitempty"` // Machine-readable error code, e.g. "sandbox_not_found"
+	Fields  []validation.FieldError `json:"fields,omitempty"` // Per-field details of a 422 response
 	Detail  string `json:"detail,omitempty"`
 }
 
@@ -204,12 +160,90 @@ func WriteError(w http.ResponseWriter, message string, statusCode int) {
 	json.NewEncoder(w).Encode(ErrorResponse{Message: message})
 }
 
+// lookupSandboxInSpace resolves the spaceID/sandboxID path variables and verifies that the
+// sandbox belongs to the space. On failure it writes the error response and returns false.
+func (h *APIHandler) lookupSandboxInSpace(w http.ResponseWriter, r *http.Request) (*manager.SandboxState, bool) {
+	vars := mux.Vars(r)
+	spaceID := vars["spaceID"]
+	sandboxID := vars["sandboxID"]
+
+	if spaceID == "" || sandboxID == "" {
+		WriteError(w, "Missing spaceID or sandboxID in path", http.StatusBadRequest)
+		return nil, false
+	}
+
+	sandboxState, err := h.sandboxManager.GetSandbox(r.Context(), sandboxID)
+	if err != nil {
+		h.writeManagerError(w, err, "Failed to retrieve sandbox "+sandboxID)
+		return nil, false
+	}
+	if sandboxState.SpaceID != spaceID {
+		h.logger.Warn("Sandbox found but belongs to different space", "requestedSpaceID", spaceID, "actualSpaceID", sandboxState.SpaceID, "sandboxID", sandboxID)
+		writeErrorCode(w, fmt.Sprintf("Sandbox %s not found in space %s", sandboxID, spaceID), manager.ErrSandboxNotFound.Code, http.StatusNotFound)
+		return nil, false
+	}
+	return sandboxState, true
+}
+
 // CreateSandboxRequest represents the request body for creating a sandbox
 type CreateSandboxRequest struct {
 	SpaceID     string   `json:"space_id"` // Ensure this matches the expected JSON key
+	Name        string   `json:"name,omitempty"` // Unique in the space; routes accept it in place of the sandbox ID
 	Image       string   `json:"image,omitempty"`
-	Command     string   `json:"command,omitempty"` // Keep as string in request
+	Command     CommandArgs            `json:"command,omitempty"`    // Overrides the image CMD
+	Entrypoint  CommandArgs            `json:"entrypoint,omitempty"` // Overrides the image ENTRYPOINT
 	Metadata    map[string]interface{} `json:"metadata,omitempty"`
+	Env         map[string]string      `json:"env,omitempty"`
+	Secrets     []manager.SecretRef    `json:"secrets,omitempty"` // Injected as env vars or files; values never echoed back
+	SecurityProfile string             `json:"security_profile,omitempty"` // "default" or "hardened"
+	SeccompProfile  string             `json:"seccomp_profile,omitempty"`  // "docker-default", "deny-dangerous" or a host-provided profile
+	AppArmorProfile string             `json:"apparmor_profile,omitempty"` // "docker-default" or a profile loaded on the host
+	Tmpfs       map[string]string      `json:"tmpfs,omitempty"`      // Container path -> tmpfs mount options
+	DiskLimit   string                 `json:"disk_limit,omitempty"` // Writable layer size limit, e.g. "10G"
+	Ulimits     map[string]manager.Ulimit `json:"ulimits,omitempty"` // "nofile", "nproc" or "core" -> soft and hard limit
+	Workdir     string                 `json:"workdir,omitempty"`    // Absolute working directory for the agent and actions
+	User        string                 `json:"user,omitempty"`       // "user", "uid" or "uid:gid"; empty keeps the image default
+	SetupScript   string   `json:"setup_script,omitempty"`     // Shell script run before the sandbox is returned
+	SetupCommands []string `json:"setup_commands,omitempty"`   // Shell commands run in order, after setup_script
+	SetupTimeout  string   `json:"setup_timeout,omitempty"`    // Go duration for all setup commands, e.g. "5m"
+	SetupOnFailure string  `json:"setup_on_failure,omitempty"` // "delete" (default) or "keep"
+	Protected   bool                   `json:"protected,omitempty"`  // Deleting requires ?force=true
+	Labels      map[string]string      `json:"labels,omitempty"`     // User labels, e.g. for batch deletion by selector
+	ActionQueue bool                   `json:"action_queue,omitempty"` // Run actions one at a time, by "priority"
+	Jupyter     bool                   `json:"jupyter,omitempty"`      // Start a Jupyter server, proxied under .../jupyter/
+	Hostname    string                 `json:"hostname,omitempty"`     // Name sibling sandboxes reach it by on the space network
+	Platform    string                 `json:"platform,omitempty"`     // Image platform, e.g. "linux/arm64"; the host's if empty
+	DNS         []string `json:"dns,omitempty"`         // Nameserver IPs
+	DNSSearch   []string `json:"dns_search,omitempty"`  // Search domains
+	ExtraHosts  []string `json:"extra_hosts,omitempty"` // "hostname:ip" entries added to /etc/hosts
+	Network     string   `json:"network,omitempty"`     // Existing Docker network to attach to; "bridge" ("nat" on Windows) if empty
+	IPv6        bool     `json:"ipv6,omitempty"`        // Enable IPv6; the network must have IPv6 enabled
+	Sidecars    []manager.SidecarSpec `json:"sidecars,omitempty"` // Service containers started alongside the sandbox
+	Volumes     []manager.VolumeMount `json:"volumes,omitempty"`  // Sandbox-owned named volumes, shareable with sidecars
+	PrivateNetworks []string          `json:"private_networks,omitempty"` // Private networks shared with sidecars
+	Compose        string `json:"compose,omitempty"`         // Compose file (YAML or JSON) defining the sandbox and its sidecars
+	ComposeService string `json:"compose_service,omitempty"` // Compose service run as the sandbox; "sandbox" if empty
+}
+
+// CommandArgs is a command in exec form. It also accepts a JSON string, which is run
+// through "/bin/sh -c" like the shell form of a Dockerfile CMD.
+type CommandArgs []string
+
+func (c *CommandArgs) UnmarshalJSON(data []byte) error {
+	var shellForm string
+	if err := json.Unmarshal(data, &shellForm); err == nil {
+		*c = nil
+		if shellForm != "" {
+			*c = CommandArgs{"/bin/sh", "-c", shellForm}
+		}
+		return nil
+	}
+	var execForm []string
+	if err := json.Unmarshal(data, &execForm); err != nil {
+		return fmt.Errorf("command and entrypoint must be a string or an array of strings")
+	}
+	*c = execForm
+	return nil
 }
 
 // CreateSandboxHandler handles requests to create a new sandbox.
@@ -224,6 +258,17 @@ func (h *APIHandler) CreateSandboxHandler(w http.ResponseWriter, r *http.Request
 		return
 	}
 
+	// ?wait=false returns once creation has started, leaving clients to follow its progress
+	wait := true
+	if v := r.URL.Query().Get("wait"); v != "" {
+		parsed, err := strconv.ParseBool(v)
+		if err != nil {
+			WriteError(w, "Invalid 'wait' query parameter", http.StatusBadRequest)
+			return
+		}
+		wait = parsed
+	}
+
 	// --- Decode request body --- 
 	var req CreateSandboxRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
@@ -231,36 +276,83 @@ func (h *APIHandler) CreateSandboxHandler(w http.ResponseWriter, r *http.Request
 		return
 	}
 	defer r.Body.Close()
+	if err := req.applyCompose(); err != nil {
+		writeValidationError(w, err)
+		return
+	}
+	if err := req.Validate(); err != nil {
+		writeValidationError(w, err)
+		return
+	}
 
 	// --- Validate space exists --- 
-	_, spaceErr := h.spaceManager.GetSpace(r.Context(), spaceID)
-	if spaceErr != nil {
-		if errors.Is(spaceErr, manager.ErrSpaceNotFound) {
-			WriteError(w, fmt.Sprintf("Space %s not found", spaceID), http.StatusNotFound)
-		} else {
-			h.logger.Error("Failed to validate space during sandbox creation", "spaceID", spaceID, "error", spaceErr)
-			WriteError(w, "Failed to validate space: "+spaceErr.Error(), http.StatusInternalServerError)
-		}
+	if _, err := h.spaceManager.GetSpace(r.Context(), spaceID); err != nil {
+		h.writeManagerError(w, err, "Failed to validate space "+spaceID)
 		return
 	}
 
-	h.logger.Info("Received request to create sandbox", "spaceID", spaceID, "image", req.Image, "command", req.Command)
+	h.logger.Info("Received request to create sandbox", "spaceID", spaceID, "image", req.Image, "command", req.Command, "entrypoint", req.Entrypoint)
 
-	// --- Prepare command slice (currently unused due to previous fix) --- 
-	var commandSlice []string
-	// if req.Command != "" { 
-	// 	commandSlice = []string{req.Command}
-	// }
+	setup := req.SetupCommands
+	if req.SetupScript != "" {
+		setup = append([]string{req.SetupScript}, setup...)
+	}
+	setupTimeout, _ := time.ParseDuration(req.SetupTimeout) // Validated above; empty means the default
 
 	// --- Call manager to create sandbox --- 
-	sandboxID, err := h.sandboxManager.CreateSandbox(r.Context(), spaceID, req.Image, commandSlice) // Pass empty slice
-	if err != nil {
-		h.logger.Error("Failed to create sandbox", "spaceID", spaceID, "image", req.Image, "command", req.Command, "error", err)
-		if errors.Is(err, manager.ErrSpaceNotFound) { // Should be caught by space validation above, but keep for safety
-			WriteError(w, fmt.Sprintf("Space %s not found", spaceID), http.StatusNotFound)
-		} else {
-			WriteError(w, fmt.Sprintf("Failed to create sandbox: %v", err), http.StatusInternalServerError)
+	spec := manager.SandboxSpec{
+		Image:   req.Image,
+		Command: req.Command,
+		Entrypoint: req.Entrypoint,
+		Env:     req.Env,
+		Secrets: req.Secrets,
+		SecurityProfile: req.SecurityProfile,
+		SeccompProfile: req.SeccompProfile,
+		AppArmorProfile: req.AppArmorProfile,
+		Tmpfs: req.Tmpfs,
+		DiskLimit: req.DiskLimit,
+		Ulimits: req.Ulimits,
+		Workdir: req.Workdir,
+		User: req.User,
+		Setup: setup,
+		SetupTimeout: setupTimeout,
+		KeepOnSetupFailure: req.SetupOnFailure == "keep",
+		DNS: req.DNS,
+		DNSSearch: req.DNSSearch,
+		ExtraHosts: req.ExtraHosts,
+		Network: req.Network,
+		IPv6: req.IPv6,
+		Sidecars: req.Sidecars,
+		Volumes: req.Volumes,
+		PrivateNetworks: req.PrivateNetworks,
+		Protected: req.Protected,
+		Labels: req.Labels,
+		ActionQueue: req.ActionQueue,
+		Jupyter: req.Jupyter,
+		Hostname: req.Hostname,
+		Name: req.Name,
+		Platform: req.Platform,
+	}
+	if !wait {
+		sandboxID, err := h.sandboxManager.StartSandboxCreation(r.Context(), spaceID, spec)
+		if err != nil {
+			h.writeManagerError(w, err, "Failed to create sandbox")
+			return
 		}
+		progress, err := h.sandboxManager.GetCreationProgress(spaceID, sandboxID)
+		if err != nil {
+			h.writeManagerError(w, err, "Failed to create sandbox")
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Location", r.URL.Path+"/"+sandboxID+"/progress")
+		w.WriteHeader(http.StatusAccepted)
+		json.NewEncoder(w).Encode(progress)
+		return
+	}
+	sandboxID, err := h.sandboxManager.CreateSandbox(r.Context(), spaceID, spec)
+	if err != nil {
+		h.writeManagerError(w, err, "Failed to create sandbox")
 		return
 	}
 
@@ -298,38 +390,14 @@ func (h *APIHandler) GetSandboxHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// First, check if the space exists (optional but good practice)
-	_, err := h.spaceManager.GetSpace(r.Context(), spaceID)
-	if err != nil {
-		if errors.Is(err, manager.ErrSpaceNotFound) {
-			WriteError(w, fmt.Sprintf("Space %s not found", spaceID), http.StatusNotFound)
-		} else {
-			h.logger.Error("Failed to get space during sandbox retrieval", "spaceID", spaceID, "error", err)
-			WriteError(w, "Failed to check space existence: "+err.Error(), http.StatusInternalServerError)
-		}
+	if _, err := h.spaceManager.GetSpace(r.Context(), spaceID); err != nil {
+		h.writeManagerError(w, err, "Failed to check space "+spaceID)
 		return
 	}
 
-	// Get the sandbox state from the manager
-	sandboxState, err := h.sandboxManager.GetSandbox(r.Context(), sandboxID)
-	if err != nil {
-		// Check if the error indicates the sandbox wasn't found
-		// Assuming GetSandbox returns an error containing "not found" for that case.
-		// TODO: Refine manager.GetSandbox to return a specific error like ErrSandboxNotFound
-		if errors.Is(err, manager.ErrSandboxNotFound) { // Use ErrSandboxNotFound if defined in manager
-			WriteError(w, fmt.Sprintf("Sandbox %s not found in space %s", sandboxID, spaceID), http.StatusNotFound)
-		} else if strings.Contains(err.Error(), "not found") { // Fallback check
-			WriteError(w, fmt.Sprintf("Sandbox %s not found in space %s", sandboxID, spaceID), http.StatusNotFound)
-		} else {
-			h.logger.Error("Failed to get sandbox", "spaceID", spaceID, "sandboxID", sandboxID, "error", err)
-			WriteError(w, "Failed to retrieve sandbox: "+err.Error(), http.StatusInternalServerError)
-		}
-		return
-	}
-
-	// Check if the retrieved sandbox actually belongs to the requested space
-	if sandboxState.SpaceID != spaceID {
-		h.logger.Warn("Sandbox found but belongs to different space", "requestedSpaceID", spaceID, "actualSpaceID", sandboxState.SpaceID, "sandboxID", sandboxID)
-		WriteError(w, fmt.Sprintf("Sandbox %s not found in space %s", sandboxID, spaceID), http.StatusNotFound)
+	// Get the sandbox state from the manager, verifying it belongs to the requested space
+	sandboxState, ok := h.lookupSandboxInSpace(w, r)
+	if !ok {
 		return
 	}
 
@@ -351,49 +419,37 @@ func (h *APIHandler) DeleteSandboxHandler(w http.ResponseWriter, r *http.Request
 	}
 
 	// Optional: Check if space exists first (consistency)
-	_, spaceErr := h.spaceManager.GetSpace(r.Context(), spaceID)
-	if spaceErr != nil {
-		if errors.Is(spaceErr, manager.ErrSpaceNotFound) {
-			WriteError(w, fmt.Sprintf("Space %s not found", spaceID), http.StatusNotFound)
-		} else {
-			h.logger.Error("Failed to get space during sandbox deletion", "spaceID", spaceID, "error", spaceErr)
-			WriteError(w, "Failed to check space existence: "+spaceErr.Error(), http.StatusInternalServerError)
-		}
+	if _, err := h.spaceManager.GetSpace(r.Context(), spaceID); err != nil {
+		h.writeManagerError(w, err, "Failed to check space "+spaceID)
 		return
 	}
 
-	// Optional: Get sandbox first to verify it belongs to the space before deleting
+	force, ok := parseForce(w, r)
+	if !ok {
+		return
+	}
+	ignoreNotFound, ok := parseIgnoreNotFound(w, r)
+	if !ok {
+		return
+	}
+
+	// Get sandbox first to verify it belongs to the space before deleting
 	// This adds an extra check but prevents deleting a sandbox via the wrong space path.
-	sandboxState, getErr := h.sandboxManager.GetSandbox(r.Context(), sandboxID)
-	if getErr != nil {
-		// If sandbox doesn't exist at all, return 404
-		if errors.Is(getErr, manager.ErrSandboxNotFound) || strings.Contains(getErr.Error(), "not found") {
-			WriteError(w, fmt.Sprintf("Sandbox %s not found", sandboxID), http.StatusNotFound)
-		} else {
-			h.logger.Error("Failed to get sandbox before deletion", "spaceID", spaceID, "sandboxID", sandboxID, "error", getErr)
-			WriteError(w, "Failed to check sandbox before deletion: "+getErr.Error(), http.StatusInternalServerError)
-		}
+	if _, err := h.sandboxManager.GetSandbox(r.Context(), sandboxID); ignoreNotFound && errors.Is(err, manager.ErrSandboxNotFound) {
+		w.WriteHeader(http.StatusNoContent) // Already deleted, e.g. by an earlier attempt of a retried request
 		return
 	}
-	if sandboxState.SpaceID != spaceID {
-		h.logger.Warn("Attempt to delete sandbox via incorrect space path", "requestedSpaceID", spaceID, "actualSpaceID", sandboxState.SpaceID, "sandboxID", sandboxID)
-		WriteError(w, fmt.Sprintf("Sandbox %s not found in space %s", sandboxID, spaceID), http.StatusNotFound)
+	if _, ok := h.lookupSandboxInSpace(w, r); !ok {
 		return
 	}
 
 	// Proceed with deletion
-	err := h.sandboxManager.DeleteSandbox(r.Context(), sandboxID)
-	if err != nil {
-		h.logger.Error("Failed to delete sandbox", "spaceID", spaceID, "sandboxID", sandboxID, "error", err)
-		// Check if the error indicates the sandbox wasn't found (might be redundant due to check above, but safe)
-		// TODO: Refine manager.DeleteSandbox to return a specific ErrSandboxNotFound
-		if errors.Is(err, manager.ErrSandboxNotFound) { // Use ErrSandboxNotFound if defined in manager
-			WriteError(w, fmt.Sprintf("Sandbox %s not found", sandboxID), http.StatusNotFound)
-		} else if strings.Contains(err.Error(), "not found") { // Fallback check
-			WriteError(w, fmt.Sprintf("Sandbox %s not found", sandboxID), http.StatusNotFound)
-		} else {
-			WriteError(w, "Failed to delete sandbox: "+err.Error(), http.StatusInternalServerError)
+	if err := h.sandboxManager.DeleteSandbox(r.Context(), sandboxID, force); err != nil {
+		if ignoreNotFound && errors.Is(err, manager.ErrSandboxNotFound) {
+			w.WriteHeader(http.StatusNoContent) // Deleted concurrently
+			return
 		}
+		h.writeManagerError(w, err, "Failed to delete sandbox "+sandboxID)
 		return
 	}
 
@@ -413,6 +469,9 @@ func (h *APIHandler) CreateSpaceHandler(w http.ResponseWriter, r *http.Request)
 		Name        string                 `json:"name"`
 		Description string                 `json:"description,omitempty"`
 		Metadata    map[string]interface{} `json:"metadata,omitempty"`
+		Protected   bool                   `json:"protected,omitempty"`
+		Isolated    bool                   `json:"isolated,omitempty"` // Sandboxes stay off the space network
+		Volumes     []manager.SpaceVolume  `json:"volumes,omitempty"`  // Mounted read-only into its sandboxes
 	}
 
 	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
@@ -420,23 +479,34 @@ func (h *APIHandler) CreateSpaceHandler(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	if payload.Name == "" {
-		WriteError(w, "Name is required", http.StatusBadRequest)
+	if err := validateSpace(payload.Name, payload.Description, payload.Volumes, true); err != nil {
+		writeValidationError(w, err)
 		return
 	}
 
 	spaceID, err := h.spaceManager.CreateSpace(r.Context(), payload.Name, payload.Description, payload.Metadata)
 	if err != nil {
-		h.logger.Error("Failed to create space", "error", err)
-		// Check if the error indicates a duplicate name
-		// Use a simple string check for now, ideally SpaceManager returns a specific error type
-		if errors.Is(err, manager.ErrSpaceNameConflict) { // Assuming ErrSpaceNameConflict exists
-			WriteError(w, "Failed to create space: "+err.Error(), http.StatusConflict) // Return 409 Conflict
-		} else {
-			WriteError(w, "Failed to create space: "+err.Error(), http.StatusInternalServerError)
-		}
+		h.writeManagerError(w, err, "Failed to create space")
 		return
 	}
+	if payload.Protected {
+		if err := h.spaceManager.SetSpaceProtected(r.Context(), spaceID, true); err != nil {
+			h.writeManagerError(w, err, "Failed to protect space")
+			return
+		}
+	}
+	if payload.Isolated {
+		if err := h.spaceManager.SetSpaceIsolated(r.Context(), spaceID, true); err != nil {
+			h.writeManagerError(w, err, "Failed to isolate space")
+			return
+		}
+	}
+	if len(payload.Volumes) > 0 {
+		if err := h.spaceManager.SetSpaceVolumes(r.Context(), spaceID, payload.Volumes); err != nil {
+			h.writeManagerError(w, err, "Failed to set space volumes")
+			return
+		}
+	}
 
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusCreated)
@@ -446,6 +516,9 @@ func (h *APIHandler) CreateSpaceHandler(w http.ResponseWriter, r *http.Request)
 		"name":        payload.Name,
 		"description": payload.Description,
 		"metadata":    payload.Metadata,
+		"protected":   payload.Protected,
+		"isolated":    payload.Isolated,
+		"volumes":     payload.Volumes,
 	})
 }
 
@@ -460,12 +533,7 @@ func (h *APIHandler) GetSpaceHandler(w http.ResponseWriter, r *http.Request) {
 
 	space, err := h.spaceManager.GetSpace(r.Context(), spaceID)
 	if err != nil {
-		if errors.Is(err, manager.ErrSpaceNotFound) {
-			WriteError(w, fmt.Sprintf("Space %s not found", spaceID), http.StatusNotFound) // Use WriteError
-			return
-		}
-		h.logger.Error("Failed to get space", "spaceID", spaceID, "error", err)
-		WriteError(w, fmt.Sprintf("Failed to get space: %v", err), http.StatusInternalServerError) // Use WriteError
+		h.writeManagerError(w, err, "Failed to get space "+spaceID)
 		return
 	}
 
@@ -477,8 +545,7 @@ func (h *APIHandler) GetSpaceHandler(w http.ResponseWriter, r *http.Request) {
 func (h *APIHandler) ListSpacesHandler(w http.ResponseWriter, r *http.Request) {
 	spaces, err := h.spaceManager.ListSpaces(r.Context())
 	if err != nil {
-		h.logger.Error("Failed to list spaces", "error", err)
-		WriteError(w, "Failed to list spaces: "+err.Error(), http.StatusInternalServerError)
+		h.writeManagerError(w, err, "Failed to list spaces")
 		return
 	}
 
@@ -498,6 +565,9 @@ func (h *APIHandler) UpdateSpaceHandler(w http.ResponseWriter, r *http.Request)
 	var payload struct {
 		Description string                 `json:"description,omitempty"`
 		Metadata    map[string]interface{} `json:"metadata,omitempty"`
+		Protected   *bool                  `json:"protected,omitempty"` // Unchanged if omitted
+		Isolated    *bool                  `json:"isolated,omitempty"`  // Unchanged if omitted; applies to new sandboxes
+		Volumes     *[]manager.SpaceVolume `json:"volumes,omitempty"`   // Replaced if present; applies to new sandboxes
 	}
 
 	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
@@ -505,15 +575,37 @@ func (h *APIHandler) UpdateSpaceHandler(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
+	var volumes []manager.SpaceVolume
+	if payload.Volumes != nil {
+		volumes = *payload.Volumes
+	}
+	if err := validateSpace("", payload.Description, volumes, false); err != nil {
+		writeValidationError(w, err)
+		return
+	}
+
 	if err := h.spaceManager.UpdateSpace(r.Context(), spaceID, payload.Description, payload.Metadata); err != nil {
-		h.logger.Error("Failed to update space", "spaceID", spaceID, "error", err)
-		if errors.Is(err, manager.ErrSpaceNotFound) {
-			WriteError(w, fmt.Sprintf("Space %s not found", spaceID), http.StatusNotFound)
-		} else {
-			WriteError(w, "Failed to update space: "+err.Error(), http.StatusInternalServerError)
-		}
+		h.writeManagerError(w, err, "Failed to update space "+spaceID)
 		return
 	}
+	if payload.Protected != nil {
+		if err := h.spaceManager.SetSpaceProtected(r.Context(), spaceID, *payload.Protected); err != nil {
+			h.writeManagerError(w, err, "Failed to update space "+spaceID)
+			return
+		}
+	}
+	if payload.Isolated != nil {
+		if err := h.spaceManager.SetSpaceIsolated(r.Context(), spaceID, *payload.Isolated); err != nil {
+			h.writeManagerError(w, err, "Failed to update space "+spaceID)
+			return
+		}
+	}
+	if payload.Volumes != nil {
+		if err := h.spaceManager.SetSpaceVolumes(r.Context(), spaceID, volumes); err != nil {
+			h.writeManagerError(w, err, "Failed to update space "+spaceID)
+			return
+		}
+	}
 
 	w.WriteHeader(http.StatusNoContent)
 }
@@ -527,14 +619,14 @@ func (h *APIHandler) DeleteSpaceHandler(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	err := h.spaceManager.DeleteSpace(r.Context(), spaceID)
+	force, ok := parseForce(w, r)
+	if !ok {
+		return
+	}
+
+	err := h.sandboxManager.DeleteSpace(r.Context(), spaceID, force)
 	if err != nil {
-		h.logger.Error("Failed to delete space", "spaceID", spaceID, "error", err)
-		if errors.Is(err, manager.ErrSpaceNotFound) {
-			WriteError(w, fmt.Sprintf("Space %s not found", spaceID), http.StatusNotFound)
-		} else {
-			WriteError(w, "Failed to delete space: "+err.Error(), http.StatusInternalServerError)
-		}
+		h.writeManagerError(w, err, "Failed to delete space "+spaceID)
 		return
 	}
 
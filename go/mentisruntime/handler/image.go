@@ -0,0 +1,111 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"github.com/foreveryh/sandboxai/go/mentisruntime/manager"
+	"github.com/foreveryh/sandboxai/go/mentisruntime/ws"
+)
+
+// maxBuildRequestBytes caps the body of a build request, including the encoded context.
+const maxBuildRequestBytes = 256 << 20
+
+// BuildImageRequest represents the request body for building an image.
+type BuildImageRequest struct {
+	Tag            string            `json:"tag"`                       // Repository and tag of the new image, e.g. "team/box:1"
+	Dockerfile     string            `json:"dockerfile,omitempty"`      // Dockerfile text; added to the context
+	DockerfilePath string            `json:"dockerfile_path,omitempty"` // Path of the Dockerfile in the context or repository
+	Context        []byte            `json:"context,omitempty"`         // Base64 tar archive, optionally gzip-compressed
+	GitURL         string            `json:"git_url,omitempty"`         // Git repository to use as the context
+	BuildArgs      map[string]string `json:"build_args,omitempty"`
+	Target         string            `json:"target,omitempty"`  // Multi-stage build target
+	Timeout        string            `json:"timeout,omitempty"` // Go duration, e.g. "20m"
+}
+
+// BuildImageHandler starts an image build and returns the build immediately. The build
+// output is streamed on /v1/images/builds/{buildID}/stream.
+func (h *APIHandler) BuildImageHandler(w http.ResponseWriter, r *http.Request) {
+	var req BuildImageRequest
+	r.Body = http.MaxBytesReader(w, r.Body, maxBuildRequestBytes)
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		WriteError(w, "Invalid request body: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := req.Validate(); err != nil {
+		writeValidationError(w, err)
+		return
+	}
+
+	timeout, _ := time.ParseDuration(req.Timeout) // Validated above; empty means the default
+	build, err := h.sandboxManager.StartImageBuild(r.Context(), manager.ImageBuildSpec{
+		Tag:            req.Tag,
+		Context:        req.Context,
+		RemoteContext:  req.GitURL,
+		Dockerfile:     req.Dockerfile,
+		DockerfilePath: req.DockerfilePath,
+		BuildArgs:      req.BuildArgs,
+		Target:         req.Target,
+		Timeout:        timeout,
+	})
+	if err != nil {
+		h.writeManagerError(w, err, "Failed to start image build")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(build)
+}
+
+// GetImageBuildHandler returns the status of an image build.
+func (h *APIHandler) GetImageBuildHandler(w http.ResponseWriter, r *http.Request) {
+	build, err := h.sandboxManager.GetImageBuild(r.Context(), mux.Vars(r)["buildID"])
+	if err != nil {
+		h.writeManagerError(w, err, "Failed to get image build")
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(build)
+}
+
+// ListImageBuildObservationsHandler returns a page of a build's recorded output. It takes
+// the same query parameters as ListObservationsHandler.
+func (h *APIHandler) ListImageBuildObservationsHandler(w http.ResponseWriter, r *http.Request) {
+	q, err := parseObservationQuery(r.URL.Query())
+	if err != nil {
+		writeValidationError(w, err)
+		return
+	}
+	page, err := h.sandboxManager.ListBuildObservations(r.Context(), mux.Vars(r)["buildID"], q)
+	if err != nil {
+		h.writeManagerError(w, err, "Failed to list build observations")
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(page)
+}
+
+// StreamImageBuildHandler streams a build's output over a WebSocket, like a sandbox stream.
+func (h *APIHandler) StreamImageBuildHandler(w http.ResponseWriter, r *http.Request) {
+	buildID := mux.Vars(r)["buildID"]
+	if exists, _ := h.sandboxManager.BuildExists(r.Context(), buildID); !exists {
+		h.writeManagerError(w, manager.ErrBuildNotFound, "Failed to stream image build")
+		return
+	}
+	ws.ServeStream(h.hub, h.sandboxManager, buildID, w, r, h.logger, ws.WithFormats(StreamFormats...))
+}
+
+// ListImagesHandler lists the images built by the runtime.
+func (h *APIHandler) ListImagesHandler(w http.ResponseWriter, r *http.Request) {
+	images, err := h.sandboxManager.ListImages(r.Context())
+	if err != nil {
+		h.writeManagerError(w, err, "Failed to list images")
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(images)
+}
@@ -0,0 +1,42 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+// GetSandboxEnvHandler returns the environment of a sandbox's container, with secret values
+// redacted.
+func (h *APIHandler) GetSandboxEnvHandler(w http.ResponseWriter, r *http.Request) {
+	sandboxState, ok := h.lookupSandboxInSpace(w, r)
+	if !ok {
+		return
+	}
+
+	env, err := h.sandboxManager.GetSandboxEnv(r.Context(), sandboxState.ID)
+	if err != nil {
+		h.writeManagerError(w, err, "Failed to get sandbox environment")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(env)
+}
+
+// GetSandboxInfoHandler returns the image, mounts, networks, resource limits and agent
+// version of a sandbox.
+func (h *APIHandler) GetSandboxInfoHandler(w http.ResponseWriter, r *http.Request) {
+	sandboxState, ok := h.lookupSandboxInSpace(w, r)
+	if !ok {
+		return
+	}
+
+	info, err := h.sandboxManager.GetSandboxInfo(r.Context(), sandboxState.ID)
+	if err != nil {
+		h.writeManagerError(w, err, "Failed to get sandbox info")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(info)
+}
@@ -0,0 +1,50 @@
+package handler
+
+import (
+	"context"
+	"net/http"
+	"net/http/httputil"
+
+	"github.com/gorilla/mux"
+
+	"github.com/foreveryh/sandboxai/go/mentisruntime/manager"
+)
+
+// JupyterProxyHandler forwards requests under .../jupyter/ to the Jupyter server of a sandbox
+// created with "jupyter": true, so Jupyter clients (JupyterLab, nbclient through a gateway,
+// jupyter_client) can use its REST API and kernel WebSockets. The runtime's own access checks
+// apply; the server's token is added by the proxy. Connections end when the sandbox is deleted.
+func (h *APIHandler) JupyterProxyHandler(w http.ResponseWriter, r *http.Request) {
+	sandboxState, ok := h.lookupSandboxInSpace(w, r)
+	if !ok {
+		return
+	}
+
+	target, err := h.sandboxManager.JupyterTarget(r.Context(), sandboxState.ID)
+	if err != nil {
+		h.writeManagerError(w, err, "Failed to reach Jupyter server")
+		return
+	}
+
+	// The server's base URL is the canonical proxy path, whatever alias the request used
+	path := manager.JupyterBasePath(sandboxState.SpaceID, sandboxState.ID) + mux.Vars(r)["path"]
+	proxy := &httputil.ReverseProxy{
+		Rewrite: func(pr *httputil.ProxyRequest) {
+			pr.SetURL(target.URL)
+			pr.Out.URL.Path, pr.Out.URL.RawPath = path, ""
+			pr.Out.Header.Del("Cookie") // Runtime cookies are not the server's business
+			pr.Out.Header.Set("Authorization", "token "+target.Token)
+			pr.SetXForwarded()
+		},
+		ErrorHandler: func(w http.ResponseWriter, r *http.Request, err error) {
+			h.logger.Warn("Jupyter proxy request failed", "sandboxID", sandboxState.ID, "path", path, "error", err)
+			writeErrorCode(w, "Jupyter server unreachable (it may still be starting): "+err.Error(), "jupyter_unreachable", http.StatusBadGateway)
+		},
+	}
+
+	ctx, cancel := context.WithCancel(r.Context())
+	defer cancel()
+	stop := context.AfterFunc(target.Context, cancel)
+	defer stop()
+	proxy.ServeHTTP(w, r.WithContext(ctx))
+}
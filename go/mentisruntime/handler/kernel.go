@@ -0,0 +1,75 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/gorilla/mux"
+)
+
+// CreateKernelRequest represents the request body for starting an IPython kernel.
+type CreateKernelRequest struct {
+	KernelID string `json:"kernel_id"`
+}
+
+// CreateKernelHandler starts a named IPython kernel in a sandbox.
+// Cells run in it when they give its ID as "kernel_id".
+func (h *APIHandler) CreateKernelHandler(w http.ResponseWriter, r *http.Request) {
+	sandboxState, ok := h.lookupSandboxInSpace(w, r)
+	if !ok {
+		return
+	}
+
+	var req CreateKernelRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		WriteError(w, "Invalid request body: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := req.Validate(); err != nil {
+		writeValidationError(w, err)
+		return
+	}
+
+	kernel, err := h.sandboxManager.CreateKernel(r.Context(), sandboxState.ID, req.KernelID)
+	if err != nil {
+		h.writeManagerError(w, err, "Failed to create kernel")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(kernel)
+}
+
+// ListKernelsHandler lists the IPython kernels of a sandbox, including the default kernel.
+func (h *APIHandler) ListKernelsHandler(w http.ResponseWriter, r *http.Request) {
+	sandboxState, ok := h.lookupSandboxInSpace(w, r)
+	if !ok {
+		return
+	}
+
+	kernels, err := h.sandboxManager.ListKernels(r.Context(), sandboxState.ID)
+	if err != nil {
+		h.writeManagerError(w, err, "Failed to list kernels")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(kernels)
+}
+
+// DeleteKernelHandler stops an IPython kernel of a sandbox, discarding its variables.
+func (h *APIHandler) DeleteKernelHandler(w http.ResponseWriter, r *http.Request) {
+	sandboxState, ok := h.lookupSandboxInSpace(w, r)
+	if !ok {
+		return
+	}
+	kernelID := mux.Vars(r)["kernelID"]
+
+	if err := h.sandboxManager.DeleteKernel(r.Context(), sandboxState.ID, kernelID); err != nil {
+		h.writeManagerError(w, err, "Failed to delete kernel "+kernelID)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,90 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/foreveryh/sandboxai/go/mentisruntime/logging"
+	"github.com/foreveryh/sandboxai/go/mentisruntime/validation"
+)
+
+// LogLevels reports the log levels: the default, and those of components that override it.
+type LogLevels struct {
+	Default    string            `json:"default"`
+	Components map[string]string `json:"components"`
+}
+
+// SetLogLevelsRequest changes log levels. Omitted fields are left as they are; a component
+// whose level is "" logs at the default level again.
+type SetLogLevelsRequest struct {
+	Default    string            `json:"default,omitempty"`
+	Components map[string]string `json:"components,omitempty"`
+}
+
+// Validate checks the level names of a request.
+func (req *SetLogLevelsRequest) Validate() error {
+	var v validation.Validator
+	if req.Default != "" {
+		if _, err := logging.ParseLevel(req.Default); err != nil {
+			v.Add("default", "%s", err)
+		}
+	}
+	for component, name := range req.Components {
+		if component == "" {
+			v.Add("components", "component names must not be empty")
+			continue
+		}
+		if name == "" {
+			continue
+		}
+		if _, err := logging.ParseLevel(name); err != nil {
+			v.Add("components."+component, "%s", err)
+		}
+	}
+	return v.Err()
+}
+
+// LogLevelsHandler reports the log levels.
+func LogLevelsHandler(levels *logging.Levels) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		writeLogLevels(w, levels)
+	}
+}
+
+// SetLogLevelsHandler changes log levels while the runtime runs, and reports the new ones.
+// Changes are not persisted; a restart goes back to the configured levels.
+func SetLogLevelsHandler(levels *logging.Levels) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req SetLogLevelsRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			WriteError(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+		if err := req.Validate(); err != nil {
+			writeValidationError(w, err)
+			return
+		}
+		if req.Default != "" {
+			level, _ := logging.ParseLevel(req.Default)
+			levels.SetDefault(level)
+		}
+		for component, name := range req.Components {
+			if name == "" {
+				levels.Reset(component)
+				continue
+			}
+			level, _ := logging.ParseLevel(name)
+			levels.Set(component, level)
+		}
+		writeLogLevels(w, levels)
+	}
+}
+
+func writeLogLevels(w http.ResponseWriter, levels *logging.Levels) {
+	report := LogLevels{Default: logging.LevelName(levels.Default()), Components: make(map[string]string)}
+	for component, level := range levels.Components() {
+		report.Components[component] = logging.LevelName(level)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(report)
+}
@@ -0,0 +1,42 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/gorilla/mux"
+)
+
+// ListSandboxLogsHandler lists the log files of a sandbox. Logs remain listable after the
+// sandbox is deleted.
+func (h *APIHandler) ListSandboxLogsHandler(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	files, err := h.sandboxManager.ListSandboxLogs(r.Context(), vars["spaceID"], vars["sandboxID"])
+	if err != nil {
+		h.writeManagerError(w, err, "Failed to list sandbox logs")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(files)
+}
+
+// GetSandboxLogHandler returns a log file of a sandbox as plain text. Range requests are
+// supported, e.g. "Range: bytes=-65536" for the last 64 KiB.
+func (h *APIHandler) GetSandboxLogHandler(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	f, err := h.sandboxManager.OpenSandboxLog(r.Context(), vars["spaceID"], vars["sandboxID"], vars["file"])
+	if err != nil {
+		h.writeManagerError(w, err, "Failed to open sandbox log")
+		return
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		WriteError(w, "Failed to read sandbox log: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	http.ServeContent(w, r, info.Name(), info.ModTime(), f)
+}
@@ -0,0 +1,25 @@
+package handler
+
+import (
+	"net/http"
+
+	"github.com/gorilla/mux"
+)
+
+// ResolveSandboxNames lets sandbox routes of a space address the sandbox by name: it
+// rewrites the sandboxID route variable to the ID of the sandbox of that name. IDs win
+// over names.
+func (h *APIHandler) ResolveSandboxNames(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+		spaceID, inSpace := vars["spaceID"]
+		ref, ok := vars["sandboxID"]
+		if inSpace && ok {
+			if id := h.sandboxManager.ResolveSandboxID(spaceID, ref); id != ref {
+				vars["sandboxID"] = id
+				r = mux.SetURLVars(r, vars)
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
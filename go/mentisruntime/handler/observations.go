@@ -0,0 +1,78 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/foreveryh/sandboxai/go/mentisruntime/history"
+	"github.com/foreveryh/sandboxai/go/mentisruntime/validation"
+)
+
+// ListObservationsHandler returns a page of a sandbox's observation history. Query
+// parameters: cursor, limit, since, until (RFC 3339), action_id and observation_type
+// (repeatable or comma separated).
+func (h *APIHandler) ListObservationsHandler(w http.ResponseWriter, r *http.Request) {
+	sandboxState, ok := h.lookupSandboxInSpace(w, r)
+	if !ok {
+		return
+	}
+
+	q, err := parseObservationQuery(r.URL.Query())
+	if err != nil {
+		writeValidationError(w, err)
+		return
+	}
+
+	page, err := h.sandboxManager.ListObservations(r.Context(), sandboxState.ID, q)
+	if err != nil {
+		h.writeManagerError(w, err, "Failed to list observations")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(page)
+}
+
+func parseObservationQuery(values url.Values) (history.Query, error) {
+	var v validation.Validator
+	q := history.Query{
+		Cursor:   values.Get("cursor"),
+		ActionID: values.Get("action_id"),
+	}
+	if raw := values.Get("limit"); raw != "" {
+		limit, err := strconv.Atoi(raw)
+		if err != nil || limit < 1 || limit > history.MaxLimit {
+			v.Add("limit", "must be an integer between 1 and %d", history.MaxLimit)
+		}
+		q.Limit = limit
+	}
+	q.Since = parseTimeParam(&v, values, "since")
+	q.Until = parseTimeParam(&v, values, "until")
+	if !q.Since.IsZero() && !q.Until.IsZero() {
+		v.Check(q.Since.Before(q.Until), "until", "must be after since")
+	}
+	for _, raw := range values["observation_type"] {
+		for _, t := range strings.Split(raw, ",") {
+			if t = strings.TrimSpace(t); t != "" {
+				q.Types = append(q.Types, t)
+			}
+		}
+	}
+	return q, v.Err()
+}
+
+func parseTimeParam(v *validation.Validator, values url.Values, name string) time.Time {
+	raw := values.Get(name)
+	if raw == "" {
+		return time.Time{}
+	}
+	t, err := time.Parse(time.RFC3339Nano, raw)
+	if err != nil {
+		v.Add(name, "must be an RFC 3339 timestamp")
+	}
+	return t
+}
@@ -0,0 +1,23 @@
+package handler
+
+import (
+	"net/http"
+
+	"github.com/gorilla/mux"
+)
+
+// InternalOutputHandler receives the raw output an agent streams, usually with chunked
+// transfer encoding, for an action started with "large_output". The output is relayed to
+// stream clients while the request body is read.
+func (h *APIHandler) InternalOutputHandler(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	stream := r.URL.Query().Get("stream")
+	if stream == "" {
+		stream = "stdout"
+	}
+	if err := h.sandboxManager.ReceiveOutputStream(vars["sandboxID"], vars["actionID"], stream, r.Body); err != nil {
+		h.writeManagerError(w, err, "Failed to relay action output")
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
@@ -0,0 +1,102 @@
+package handler
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/gorilla/websocket"
+
+	"github.com/foreveryh/sandboxai/go/mentisruntime/manager"
+)
+
+// portDialTimeout bounds how long the runtime waits for a sandbox port to accept a connection.
+const portDialTimeout = 10 * time.Second
+
+var portForwardUpgrader = websocket.Upgrader{
+	ReadBufferSize:  32 * 1024,
+	WriteBufferSize: 32 * 1024,
+	CheckOrigin:     func(r *http.Request) bool { return true },
+}
+
+// PortForwardHandler tunnels a WebSocket connection to a TCP port of a sandbox: binary
+// messages carry the bytes of the TCP stream in each direction. Each connection is dialed
+// before the upgrade, so an unreachable port is reported with an HTTP error. Connections end
+// when either side closes or the sandbox is deleted.
+func (h *APIHandler) PortForwardHandler(w http.ResponseWriter, r *http.Request) {
+	sandboxState, ok := h.lookupSandboxInSpace(w, r)
+	if !ok {
+		return
+	}
+	port, err := strconv.Atoi(mux.Vars(r)["port"])
+	if err != nil {
+		h.writeManagerError(w, manager.ErrInvalidPort, "Invalid port")
+		return
+	}
+	target, err := h.sandboxManager.PortTarget(r.Context(), sandboxState.ID, port)
+	if err != nil {
+		h.writeManagerError(w, err, "Failed to forward port")
+		return
+	}
+	dialer := net.Dialer{Timeout: portDialTimeout}
+	tcpConn, err := dialer.DialContext(r.Context(), "tcp", target.Address)
+	if err != nil {
+		h.logger.Warn("Port forward dial failed", "sandboxID", sandboxState.ID, "port", port, "error", err)
+		writeErrorCode(w, "Sandbox port unreachable (nothing may be listening on it): "+err.Error(), manager.ErrPortUnreachable.Code, http.StatusBadGateway)
+		return
+	}
+	defer tcpConn.Close()
+
+	wsConn, err := portForwardUpgrader.Upgrade(w, r, nil)
+	if err != nil {
+		h.logger.Warn("Port forward upgrade failed", "sandboxID", sandboxState.ID, "port", port, "error", err)
+		return
+	}
+	defer wsConn.Close()
+	h.logger.Info("Port forward opened", "sandboxID", sandboxState.ID, "port", port, "remoteAddr", r.RemoteAddr)
+
+	ctx, cancel := context.WithCancel(r.Context())
+	defer cancel()
+	stop := context.AfterFunc(target.Context, cancel)
+	defer stop()
+	go func() {
+		<-ctx.Done()
+		tcpConn.Close()
+		wsConn.Close()
+	}()
+
+	go func() {
+		defer cancel()
+		buf := make([]byte, 32*1024)
+		for {
+			n, err := tcpConn.Read(buf)
+			if n > 0 {
+				if werr := wsConn.WriteMessage(websocket.BinaryMessage, buf[:n]); werr != nil {
+					return
+				}
+			}
+			if err != nil {
+				// Tell the client the port closed its side
+				wsConn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""), time.Now().Add(time.Second))
+				return
+			}
+		}
+	}()
+	for {
+		kind, data, err := wsConn.ReadMessage()
+		if err != nil {
+			break
+		}
+		if kind != websocket.BinaryMessage {
+			continue
+		}
+		if _, err := tcpConn.Write(data); err != nil {
+			break
+		}
+	}
+	cancel()
+	h.logger.Info("Port forward closed", "sandboxID", sandboxState.ID, "port", port)
+}
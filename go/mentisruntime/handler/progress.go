@@ -0,0 +1,27 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/gorilla/mux"
+)
+
+// GetCreationProgressHandler reports how far the creation of a sandbox has got, for
+// sandboxes created with ?wait=false. Created sandboxes are reported at step "ready".
+func (h *APIHandler) GetCreationProgressHandler(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	spaceID, sandboxID := vars["spaceID"], vars["sandboxID"]
+	if _, err := h.spaceManager.GetSpace(r.Context(), spaceID); err != nil {
+		h.writeManagerError(w, err, "Failed to get space "+spaceID)
+		return
+	}
+
+	progress, err := h.sandboxManager.GetCreationProgress(spaceID, sandboxID)
+	if err != nil {
+		h.writeManagerError(w, err, "Failed to get creation progress of sandbox "+sandboxID)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(progress)
+}
@@ -0,0 +1,66 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+)
+
+// UpdateSandboxRequest changes the mutable settings of a sandbox.
+type UpdateSandboxRequest struct {
+	Protected *bool `json:"protected"`
+}
+
+// UpdateSandboxHandler protects a sandbox from deletion or lifts the protection.
+func (h *APIHandler) UpdateSandboxHandler(w http.ResponseWriter, r *http.Request) {
+	state, ok := h.lookupSandboxInSpace(w, r)
+	if !ok {
+		return
+	}
+	var req UpdateSandboxRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		WriteError(w, "Invalid request body: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if req.Protected == nil {
+		WriteError(w, "Nothing to update", http.StatusBadRequest)
+		return
+	}
+	updated, err := h.sandboxManager.SetSandboxProtected(r.Context(), state.ID, *req.Protected)
+	if err != nil {
+		h.writeManagerError(w, err, "Failed to update sandbox "+state.ID)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(updated)
+}
+
+// parseForce reads the ?force query parameter of DELETE requests, writing an error response
+// if it is invalid.
+func parseForce(w http.ResponseWriter, r *http.Request) (bool, bool) {
+	v := r.URL.Query().Get("force")
+	if v == "" {
+		return false, true
+	}
+	force, err := strconv.ParseBool(v)
+	if err != nil {
+		WriteError(w, "Invalid 'force' query parameter", http.StatusBadRequest)
+		return false, false
+	}
+	return force, true
+}
+
+// parseIgnoreNotFound reads the ?ignore_not_found query parameter of DELETE requests, which
+// makes deleting a sandbox that no longer exists succeed, so retried deletes are safe.
+func parseIgnoreNotFound(w http.ResponseWriter, r *http.Request) (bool, bool) {
+	v := r.URL.Query().Get("ignore_not_found")
+	if v == "" {
+		return false, true
+	}
+	ignore, err := strconv.ParseBool(v)
+	if err != nil {
+		WriteError(w, "Invalid 'ignore_not_found' query parameter", http.StatusBadRequest)
+		return false, false
+	}
+	return ignore, true
+}
@@ -0,0 +1,65 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+)
+
+// ReadinessCheck reports whether a dependency is usable.
+type ReadinessCheck func(ctx context.Context) error
+
+// degradedError marks the failure of a check made with Degraded.
+type degradedError struct{ error }
+
+func (e degradedError) Unwrap() error { return e.error }
+
+// Degraded wraps a check whose failure slows the runtime down without making it unusable:
+// ReadyzHandler reports it as "degraded" and still answers 200.
+func Degraded(check ReadinessCheck) ReadinessCheck {
+	return func(ctx context.Context) error {
+		if err := check(ctx); err != nil {
+			return degradedError{err}
+		}
+		return nil
+	}
+}
+
+// ReadyzHandler runs every check and answers 503 if any fails, or 200 with status "degraded"
+// if only checks made with Degraded fail. Unlike /health, which only shows the process is
+// alive, this tells orchestrators whether to route traffic here.
+func ReadyzHandler(checks map[string]ReadinessCheck) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+		defer cancel()
+
+		status := http.StatusOK
+		degraded := false
+		results := make(map[string]string, len(checks))
+		for name, check := range checks {
+			if err := check(ctx); err != nil {
+				results[name] = err.Error()
+				var d degradedError
+				if errors.As(err, &d) {
+					degraded = true
+				} else {
+					status = http.StatusServiceUnavailable
+				}
+				continue
+			}
+			results[name] = "ok"
+		}
+
+		body := map[string]interface{}{"status": "ready", "checks": results}
+		if status != http.StatusOK {
+			body["status"] = "not_ready"
+		} else if degraded {
+			body["status"] = "degraded"
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		json.NewEncoder(w).Encode(body)
+	}
+}
@@ -0,0 +1,76 @@
+package handler
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"runtime/debug"
+
+	"github.com/foreveryh/sandboxai/go/mentisruntime/metrics"
+)
+
+var handlerPanics = metrics.Default.NewCounter("sandboxai_http_panics_total",
+	"Panics recovered in HTTP handlers.")
+
+// Recover recovers panics of handlers, logs them with their stack, and answers 500 with
+// code "internal" if the response has not started. WebSocket handlers are recovered too, but
+// their connection is closed without a response. http.ErrAbortHandler, with which handlers
+// abort a response on purpose, is passed on.
+func Recover(logger *slog.Logger) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			upgrade := r.Header.Get("Upgrade") != ""
+			rw := &recoverResponseWriter{ResponseWriter: w, started: upgrade} // Upgrades hijack the connection
+			defer func() {
+				p := recover()
+				if p == nil {
+					return
+				}
+				if err, ok := p.(error); ok && errors.Is(err, http.ErrAbortHandler) {
+					panic(p)
+				}
+				handlerPanics.Inc()
+				logger.Error("Recovered from panic in HTTP handler", "method", r.Method, "path", r.URL.Path,
+					"error", fmt.Sprint(p), "stack", string(debug.Stack()))
+				if !rw.started {
+					writeErrorCode(w, "Internal server error", "internal", http.StatusInternalServerError)
+				}
+			}()
+			if upgrade {
+				next.ServeHTTP(w, r) // The upgrader needs the server's writer to hijack it
+				return
+			}
+			next.ServeHTTP(rw, r)
+		})
+	}
+}
+
+// recoverResponseWriter records whether the response has started.
+type recoverResponseWriter struct {
+	http.ResponseWriter
+	started bool
+}
+
+func (w *recoverResponseWriter) WriteHeader(status int) {
+	w.started = true
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *recoverResponseWriter) Write(p []byte) (int, error) {
+	w.started = true
+	return w.ResponseWriter.Write(p)
+}
+
+// Flush passes flushes on, for streaming responses.
+func (w *recoverResponseWriter) Flush() {
+	w.started = true
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Unwrap gives http.ResponseController the underlying writer.
+func (w *recoverResponseWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
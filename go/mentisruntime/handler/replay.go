@@ -0,0 +1,74 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+)
+
+// ReplaySandboxRequest is the optional body of a replay request.
+type ReplaySandboxRequest struct {
+	SpaceID string `json:"space_id,omitempty"` // Space of the replay sandbox; defaults to the source sandbox's space
+}
+
+// ReplaySandboxHandler creates a fresh sandbox from the image of a sandbox and replays the
+// actions recorded for the sandbox into it. It returns the replay once the sandbox is created;
+// the actions run in the background.
+func (h *APIHandler) ReplaySandboxHandler(w http.ResponseWriter, r *http.Request) {
+	sandboxState, ok := h.lookupSandboxInSpace(w, r)
+	if !ok {
+		return
+	}
+
+	var req ReplaySandboxRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+		WriteError(w, "Invalid request body: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	defer r.Body.Close()
+
+	replay, err := h.sandboxManager.ReplaySandbox(r.Context(), sandboxState.ID, req.SpaceID)
+	if err != nil {
+		h.writeManagerError(w, err, "Failed to replay sandbox")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(replay)
+}
+
+// GetReplayHandler returns the progress of the replay that created a sandbox.
+func (h *APIHandler) GetReplayHandler(w http.ResponseWriter, r *http.Request) {
+	sandboxState, ok := h.lookupSandboxInSpace(w, r)
+	if !ok {
+		return
+	}
+
+	replay, err := h.sandboxManager.GetReplay(r.Context(), sandboxState.ID)
+	if err != nil {
+		h.writeManagerError(w, err, "Failed to get replay")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(replay)
+}
+
+// GetRecordingHandler returns the actions recorded for a sandbox.
+func (h *APIHandler) GetRecordingHandler(w http.ResponseWriter, r *http.Request) {
+	sandboxState, ok := h.lookupSandboxInSpace(w, r)
+	if !ok {
+		return
+	}
+
+	recording, err := h.sandboxManager.GetRecording(r.Context(), sandboxState.ID)
+	if err != nil {
+		h.writeManagerError(w, err, "Failed to get recording")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(recording)
+}
@@ -0,0 +1,77 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/gorilla/mux"
+)
+
+// CreateScheduleRequest represents the request body for scheduling a recurring action.
+type CreateScheduleRequest struct {
+	Cron       string                 `json:"cron"`
+	Timezone   string                 `json:"timezone,omitempty"`
+	ActionType string                 `json:"action_type"` // "shell" or "ipython"
+	Payload    map[string]interface{} `json:"payload"`     // Same body as the matching tools endpoint
+}
+
+// CreateScheduleHandler registers a cron schedule that runs an action inside a sandbox.
+func (h *APIHandler) CreateScheduleHandler(w http.ResponseWriter, r *http.Request) {
+	sandboxState, ok := h.lookupSandboxInSpace(w, r)
+	if !ok {
+		return
+	}
+
+	var req CreateScheduleRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		WriteError(w, "Invalid request body: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := req.Validate(); err != nil {
+		writeValidationError(w, err)
+		return
+	}
+
+	schedule, err := h.sandboxManager.CreateSchedule(r.Context(), sandboxState.ID, req.Cron, req.Timezone, req.ActionType, req.Payload)
+	if err != nil {
+		h.writeManagerError(w, err, "Failed to create schedule")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(schedule)
+}
+
+// ListSchedulesHandler lists the schedules of a sandbox.
+func (h *APIHandler) ListSchedulesHandler(w http.ResponseWriter, r *http.Request) {
+	sandboxState, ok := h.lookupSandboxInSpace(w, r)
+	if !ok {
+		return
+	}
+
+	schedules, err := h.sandboxManager.ListSchedules(r.Context(), sandboxState.ID)
+	if err != nil {
+		h.writeManagerError(w, err, "Failed to list schedules")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(schedules)
+}
+
+// DeleteScheduleHandler removes a schedule from a sandbox.
+func (h *APIHandler) DeleteScheduleHandler(w http.ResponseWriter, r *http.Request) {
+	sandboxState, ok := h.lookupSandboxInSpace(w, r)
+	if !ok {
+		return
+	}
+	scheduleID := mux.Vars(r)["scheduleID"]
+
+	if err := h.sandboxManager.DeleteSchedule(r.Context(), sandboxState.ID, scheduleID); err != nil {
+		h.writeManagerError(w, err, "Failed to delete schedule "+scheduleID)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
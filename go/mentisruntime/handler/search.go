@@ -0,0 +1,54 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/foreveryh/sandboxai/go/mentisruntime/manager"
+	"github.com/foreveryh/sandboxai/go/mentisruntime/validation"
+)
+
+// SearchResponse lists the spaces and sandboxes matching a search, best first.
+type SearchResponse struct {
+	Query   string                 `json:"query"`
+	Results []manager.SearchResult `json:"results"`
+}
+
+// SearchHandler finds spaces and sandboxes by ?q, matched against their names, IDs, labels,
+// metadata values and images. ?type=space or ?type=sandbox limits the kinds of results
+// and ?limit their number.
+func (h *APIHandler) SearchHandler(w http.ResponseWriter, r *http.Request) {
+	values := r.URL.Query()
+	var v validation.Validator
+	q := manager.SearchQuery{Text: strings.TrimSpace(values.Get("q"))}
+	v.Required("q", q.Text)
+	for _, raw := range values["type"] {
+		for _, t := range strings.Split(raw, ",") {
+			if t = strings.TrimSpace(t); t != "" {
+				v.OneOf("type", t, manager.SearchResultSpace, manager.SearchResultSandbox)
+				q.Types = append(q.Types, t)
+			}
+		}
+	}
+	if raw := values.Get("limit"); raw != "" {
+		limit, err := strconv.Atoi(raw)
+		if err != nil || limit < 1 || limit > manager.MaxSearchLimit {
+			v.Add("limit", "must be an integer between 1 and %d", manager.MaxSearchLimit)
+		}
+		q.Limit = limit
+	}
+	if err := v.Err(); err != nil {
+		writeValidationError(w, err)
+		return
+	}
+
+	results, err := h.sandboxManager.Search(r.Context(), q)
+	if err != nil {
+		h.writeManagerError(w, err, "Failed to search")
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(SearchResponse{Query: q.Text, Results: results})
+}
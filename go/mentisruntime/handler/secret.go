@@ -0,0 +1,74 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/gorilla/mux"
+)
+
+// PutSecretRequest represents the request body for creating or replacing a secret.
+type PutSecretRequest struct {
+	Name        string `json:"name"`
+	Value       string `json:"value"`
+	Description string `json:"description,omitempty"`
+}
+
+// CreateSecretHandler stores a secret. The response only contains metadata.
+func (h *APIHandler) CreateSecretHandler(w http.ResponseWriter, r *http.Request) {
+	var req PutSecretRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		WriteError(w, "Invalid request body", http.StatusBadRequest) // Never echo the body, it holds the value
+		return
+	}
+	if err := req.Validate(); err != nil {
+		writeValidationError(w, err)
+		return
+	}
+
+	meta, err := h.sandboxManager.PutSecret(r.Context(), req.Name, req.Value, req.Description)
+	if err != nil {
+		h.writeManagerError(w, err, "Failed to store secret")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(meta)
+}
+
+// ListSecretsHandler lists secret metadata.
+func (h *APIHandler) ListSecretsHandler(w http.ResponseWriter, r *http.Request) {
+	secrets, err := h.sandboxManager.ListSecrets(r.Context())
+	if err != nil {
+		h.writeManagerError(w, err, "Failed to list secrets")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(secrets)
+}
+
+// GetSecretHandler returns the metadata of a secret; the value is never returned.
+func (h *APIHandler) GetSecretHandler(w http.ResponseWriter, r *http.Request) {
+	name := mux.Vars(r)["name"]
+	meta, err := h.sandboxManager.GetSecret(r.Context(), name)
+	if err != nil {
+		h.writeManagerError(w, err, "Secret operation failed")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(meta)
+}
+
+// DeleteSecretHandler deletes a secret.
+func (h *APIHandler) DeleteSecretHandler(w http.ResponseWriter, r *http.Request) {
+	name := mux.Vars(r)["name"]
+	if err := h.sandboxManager.DeleteSecret(r.Context(), name); err != nil {
+		h.writeManagerError(w, err, "Secret operation failed")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,22 @@
+package handler
+
+import (
+	"net/http"
+
+	"github.com/gorilla/mux"
+
+	"github.com/foreveryh/sandboxai/go/mentisruntime/manager"
+	"github.com/foreveryh/sandboxai/go/mentisruntime/ws"
+)
+
+// StreamSpaceHandler streams the events of a space over a WebSocket: sandboxes created,
+// deleted and changing state, quota warnings and the outcome of every action run in the
+// space. It takes the same ?cursor parameter as a sandbox stream.
+func (h *APIHandler) StreamSpaceHandler(w http.ResponseWriter, r *http.Request) {
+	spaceID := mux.Vars(r)["spaceID"]
+	if _, err := h.spaceManager.GetSpace(r.Context(), spaceID); err != nil {
+		h.writeManagerError(w, err, "Failed to stream space "+spaceID)
+		return
+	}
+	ws.ServeStream(h.hub, h.sandboxManager, manager.SpaceStreamID(spaceID), w, r, h.logger, ws.WithFormats(StreamFormats...))
+}
@@ -0,0 +1,66 @@
+package handler
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/gorilla/mux"
+
+	"github.com/foreveryh/sandboxai/go/mentisruntime/manager"
+	"github.com/foreveryh/sandboxai/go/mentisruntime/validation"
+)
+
+// RequireTenant limits space routes to the spaces of the tenant named in header, which an
+// authenticating proxy in front of the runtime must set. The "default" space in a path
+// refers to the tenant's own default space, created on first use. Searches only find the
+// tenant's spaces and sandboxes, sandbox streams only serve them, and secrets are kept
+// apart per tenant. Other routes are not scoped to tenants.
+func (h *APIHandler) RequireTenant(header string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			route := mux.CurrentRoute(r)
+			if route == nil {
+				next.ServeHTTP(w, r)
+				return
+			}
+			tmpl, _ := route.GetPathTemplate()
+			if _, rest, ok := splitVersion(tmpl); !ok || !tenantScoped(rest) {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			tenant := r.Header.Get(header)
+			if tenant == "" {
+				WriteError(w, "Missing tenant", http.StatusUnauthorized)
+				return
+			}
+			var v validation.Validator
+			v.ResourceName("tenant", tenant)
+			if err := v.Err(); err != nil {
+				writeValidationError(w, err)
+				return
+			}
+			ctx := manager.WithTenant(r.Context(), tenant)
+			r = r.WithContext(ctx)
+
+			vars := mux.Vars(r)
+			if spaceID, ok := vars["spaceID"]; ok {
+				vars["spaceID"] = h.spaceManager.ResolveSpaceID(ctx, spaceID)
+				// Sandbox routes only check that the sandbox is in the space, so check the space here.
+				if _, err := h.spaceManager.GetSpace(ctx, vars["spaceID"]); err != nil {
+					h.writeManagerError(w, err, "Failed to get space "+spaceID)
+					return
+				}
+				r = mux.SetURLVars(r, vars)
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// tenantScoped reports whether a route, given by its path template without the version
+// prefix, is scoped to tenants.
+func tenantScoped(route string) bool {
+	return strings.HasPrefix(route, "/spaces") || strings.HasPrefix(route, "/secrets") ||
+		route == "/search" || route == "/sandboxes/{sandboxID}/stream"
+}
@@ -0,0 +1,38 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/foreveryh/sandboxai/go/mentisruntime/validation"
+)
+
+// GetTimelineHandler returns the actions and events of a sandbox's observation history as a
+// timeline. Query parameters: since and until (RFC 3339).
+func (h *APIHandler) GetTimelineHandler(w http.ResponseWriter, r *http.Request) {
+	sandboxState, ok := h.lookupSandboxInSpace(w, r)
+	if !ok {
+		return
+	}
+
+	var v validation.Validator
+	values := r.URL.Query()
+	since := parseTimeParam(&v, values, "since")
+	until := parseTimeParam(&v, values, "until")
+	if !since.IsZero() && !until.IsZero() {
+		v.Check(since.Before(until), "until", "must be after since")
+	}
+	if err := v.Err(); err != nil {
+		writeValidationError(w, err)
+		return
+	}
+
+	timeline, err := h.sandboxManager.GetTimeline(r.Context(), sandboxState.ID, since, until)
+	if err != nil {
+		h.writeManagerError(w, err, "Failed to build timeline")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(timeline)
+}
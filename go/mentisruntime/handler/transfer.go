@@ -0,0 +1,44 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/gorilla/mux"
+
+	"github.com/foreveryh/sandboxai/go/mentisruntime/manager"
+)
+
+// TransferRequest represents the request body for copying files between sandboxes.
+type TransferRequest struct {
+	Source      manager.TransferEndpoint `json:"source"`
+	Destination manager.TransferEndpoint `json:"destination"`
+}
+
+// CreateTransferHandler copies a file or directory from one sandbox of a space to another.
+func (h *APIHandler) CreateTransferHandler(w http.ResponseWriter, r *http.Request) {
+	spaceID := mux.Vars(r)["spaceID"]
+	var req TransferRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		WriteError(w, "Invalid request body: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := req.Validate(); err != nil {
+		writeValidationError(w, err)
+		return
+	}
+	if _, err := h.spaceManager.GetSpace(r.Context(), spaceID); err != nil {
+		h.writeManagerError(w, err, "Failed to validate space "+spaceID)
+		return
+	}
+
+	transfer, err := h.sandboxManager.TransferFiles(r.Context(), spaceID, req.Source, req.Destination)
+	if err != nil {
+		h.writeManagerError(w, err, "Failed to transfer files")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(transfer)
+}
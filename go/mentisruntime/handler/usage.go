@@ -0,0 +1,75 @@
+package handler
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/foreveryh/sandboxai/go/mentisruntime/manager"
+	"github.com/foreveryh/sandboxai/go/mentisruntime/validation"
+)
+
+// usageCSVHeader is the header row of CSV usage reports. Each row is the usage of a
+// sandbox, space or tenant, or the total, as named by its "level".
+var usageCSVHeader = []string{"level", "tenant", "space_id", "sandbox_id", "cpu_seconds", "memory_byte_seconds", "wall_seconds"}
+
+// GetUsageHandler reports the resource usage of sandboxes, per sandbox, space and tenant,
+// for chargeback. Query parameters: from and to (RFC 3339; by default all recorded usage up to
+// now) and format ("json" or "csv").
+func (h *APIHandler) GetUsageHandler(w http.ResponseWriter, r *http.Request) {
+	var v validation.Validator
+	values := r.URL.Query()
+	from := parseTimeParam(&v, values, "from")
+	to := parseTimeParam(&v, values, "to")
+	if to.IsZero() {
+		to = time.Now()
+	}
+	v.Check(from.Before(to), "to", "must be after from")
+	format := values.Get("format")
+	v.OneOf("format", format, "json", "csv")
+	if err := v.Err(); err != nil {
+		writeValidationError(w, err)
+		return
+	}
+
+	report, err := h.sandboxManager.GetUsageReport(r.Context(), from, to)
+	if err != nil {
+		h.writeManagerError(w, err, "Failed to get usage report")
+		return
+	}
+
+	if format == "csv" {
+		w.Header().Set("Content-Type", "text/csv")
+		w.Header().Set("Content-Disposition", `attachment; filename="usage.csv"`)
+		writeUsageCSV(w, report)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(report)
+}
+
+func writeUsageCSV(w http.ResponseWriter, report *manager.UsageReport) {
+	cw := csv.NewWriter(w)
+	cw.Write(usageCSVHeader)
+	row := func(level, tenant, spaceID, sandboxID string, t manager.UsageTotals) {
+		cw.Write([]string{
+			level, tenant, spaceID, sandboxID,
+			strconv.FormatFloat(t.CPUSeconds, 'f', 3, 64),
+			strconv.FormatFloat(t.MemoryByteSeconds, 'f', 0, 64),
+			strconv.FormatFloat(t.WallSeconds, 'f', 3, 64),
+		})
+	}
+	for _, s := range report.Sandboxes {
+		row("sandbox", s.Tenant, s.SpaceID, s.SandboxID, s.UsageTotals)
+	}
+	for _, s := range report.Spaces {
+		row("space", s.Tenant, s.SpaceID, "", s.UsageTotals)
+	}
+	for _, t := range report.Tenants {
+		row("tenant", t.Tenant, "", "", t.UsageTotals)
+	}
+	row("total", "", "", "", report.Total)
+	cw.Flush()
+}
@@ -0,0 +1,510 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/foreveryh/sandboxai/go/mentisruntime/compose"
+	"github.com/foreveryh/sandboxai/go/mentisruntime/cron"
+	"github.com/foreveryh/sandboxai/go/mentisruntime/manager"
+	"github.com/foreveryh/sandboxai/go/mentisruntime/validation"
+)
+
+// writeValidationError writes a 422 response listing every rejected field.
+func writeValidationError(w http.ResponseWriter, err error) {
+	var fieldErrs validation.Errors
+	errors.As(err, &fieldErrs)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusUnprocessableEntity)
+	json.NewEncoder(w).Encode(ErrorResponse{Message: "Request validation failed", Code: "validation_failed", Fields: fieldErrs})
+}
+
+// Validate checks a sandbox creation request before any Docker work happens.
+func (req *CreateSandboxRequest) Validate() error {
+	var v validation.Validator
+	v.Image("image", req.Image)
+	v.MaxLength("command", strings.Join(req.Command, " "), validation.MaxCommandBytes)
+	v.MaxLength("entrypoint", strings.Join(req.Entrypoint, " "), validation.MaxCommandBytes)
+	v.Env("env", req.Env)
+	for i, ref := range req.Secrets {
+		field := "secrets[" + strconv.Itoa(i) + "]"
+		v.Required(field+".name", ref.Name)
+		if ref.Env != "" {
+			v.EnvName(field+".env", ref.Env)
+		}
+		v.MaxLength(field+".file", ref.File, validation.MaxPathLength)
+	}
+	v.OneOf("security_profile", req.SecurityProfile, manager.SecurityProfileDefault, manager.SecurityProfileHardened)
+	if req.SeccompProfile != "" {
+		v.ResourceName("seccomp_profile", req.SeccompProfile)
+	}
+	if req.AppArmorProfile != "" {
+		v.ResourceName("apparmor_profile", req.AppArmorProfile)
+	}
+	for mountPath := range req.Tmpfs {
+		v.AbsPath("tmpfs."+mountPath, mountPath)
+	}
+	for name, limit := range req.Ulimits {
+		v.OneOf("ulimits", name, manager.UlimitNofile, manager.UlimitNproc, manager.UlimitCore)
+		v.Check(limit.Soft >= 0 && limit.Soft <= limit.Hard, "ulimits."+name, "soft limit must be between 0 and the hard limit")
+	}
+	if req.Workdir != "" {
+		v.AbsPath("workdir", req.Workdir)
+	}
+	v.User("user", req.User)
+	v.MaxLength("setup_script", req.SetupScript, validation.MaxCommandBytes)
+	v.Check(len(req.SetupCommands) <= maxSetupCommands, "setup_commands", "must have at most "+strconv.Itoa(maxSetupCommands)+" entries")
+	for i, command := range req.SetupCommands {
+		field := "setup_commands[" + strconv.Itoa(i) + "]"
+		if v.Required(field, command) {
+			v.MaxLength(field, command, validation.MaxCommandBytes)
+		}
+	}
+	if req.SetupTimeout != "" {
+		if d, err := time.ParseDuration(req.SetupTimeout); err != nil || d <= 0 {
+			v.Add("setup_timeout", "must be a positive duration such as \"10m\"")
+		}
+	}
+	v.OneOf("setup_on_failure", req.SetupOnFailure, "delete", "keep")
+	for i, server := range req.DNS {
+		v.IP("dns["+strconv.Itoa(i)+"]", server)
+	}
+	for i, domain := range req.DNSSearch {
+		v.Hostname("dns_search["+strconv.Itoa(i)+"]", domain)
+	}
+	for i, entry := range req.ExtraHosts {
+		v.ExtraHost("extra_hosts["+strconv.Itoa(i)+"]", entry)
+	}
+	if req.Network != "" {
+		v.NetworkName("network", req.Network)
+	}
+	if req.Name != "" {
+		v.ResourceName("name", req.Name)
+	}
+	if req.Hostname != "" {
+		// A single DNS label, resolved by the embedded DNS of the space network.
+		v.Check(!strings.Contains(req.Hostname, "."), "hostname", "must not contain dots")
+		v.Hostname("hostname", req.Hostname)
+	}
+	if req.Platform != "" {
+		v.Check(manager.ValidImagePlatform(req.Platform), "platform", `must be "os/arch" or "os/arch/variant", e.g. "linux/arm64"`)
+	}
+	v.Check(len(req.Sidecars) <= maxSidecars, "sidecars", "must have at most "+strconv.Itoa(maxSidecars)+" entries")
+	sidecarNames := make(map[string]bool, len(req.Sidecars))
+	for i, sc := range req.Sidecars {
+		field := "sidecars[" + strconv.Itoa(i) + "]"
+		if v.Required(field+".name", sc.Name) {
+			// The name becomes the sidecar's hostname on the sandbox's private network.
+			v.Check(!strings.Contains(sc.Name, "."), field+".name", "must not contain dots")
+			v.Hostname(field+".name", sc.Name)
+			v.Check(sc.Name != "sandbox", field+".name", "\"sandbox\" is reserved for the sandbox container")
+			v.Check(!sidecarNames[sc.Name], field+".name", "must be unique")
+			sidecarNames[sc.Name] = true
+		}
+		if v.Required(field+".image", sc.Image) {
+			v.Image(field+".image", sc.Image)
+		}
+		v.Env(field+".env", sc.Env)
+		v.MaxLength(field+".command", strings.Join(sc.Command, " "), validation.MaxCommandBytes)
+		v.MaxLength(field+".entrypoint", strings.Join(sc.Entrypoint, " "), validation.MaxCommandBytes)
+		if sc.Workdir != "" {
+			v.AbsPath(field+".workdir", sc.Workdir)
+		}
+		v.User(field+".user", sc.User)
+		checkVolumeMounts(&v, field+".volumes", sc.Volumes)
+		for j, name := range sc.Networks {
+			v.ResourceName(field+".networks["+strconv.Itoa(j)+"]", name)
+		}
+	}
+	checkVolumeMounts(&v, "volumes", req.Volumes)
+	for i, name := range req.PrivateNetworks {
+		v.ResourceName("private_networks["+strconv.Itoa(i)+"]", name)
+	}
+	v.Labels("labels", req.Labels)
+	return v.Err()
+}
+
+// applyCompose translates the compose file of a request, if any, into the request's image,
+// command, sidecars, volumes and private networks, so the result is validated like any other
+// request. Request env entries override those of the compose file.
+func (req *CreateSandboxRequest) applyCompose() error {
+	var v validation.Validator
+	if req.Compose == "" {
+		v.Check(req.ComposeService == "", "compose_service", "requires compose")
+		return v.Err()
+	}
+	v.MaxLength("compose", req.Compose, maxComposeBytes)
+	for _, c := range []struct {
+		field string
+		set   bool
+	}{
+		{"image", req.Image != ""},
+		{"command", len(req.Command) > 0},
+		{"entrypoint", len(req.Entrypoint) > 0},
+		{"workdir", req.Workdir != ""},
+		{"user", req.User != ""},
+		{"sidecars", len(req.Sidecars) > 0},
+		{"volumes", len(req.Volumes) > 0},
+		{"private_networks", len(req.PrivateNetworks) > 0},
+	} {
+		v.Check(!c.set, c.field, "cannot be combined with compose")
+	}
+	if err := v.Err(); err != nil {
+		return err
+	}
+	file, err := compose.Parse([]byte(req.Compose))
+	if err != nil {
+		v.Add("compose", "%s", err.Error())
+		return v.Err()
+	}
+	spec, err := file.SandboxSpec(req.ComposeService)
+	if err != nil {
+		v.Add("compose", "%s", err.Error())
+		return v.Err()
+	}
+	for k, val := range req.Env {
+		if spec.Env == nil {
+			spec.Env = make(map[string]string, len(req.Env))
+		}
+		spec.Env[k] = val
+	}
+	req.Image = spec.Image
+	req.Command = spec.Command
+	req.Entrypoint = spec.Entrypoint
+	req.Env = spec.Env
+	req.Workdir = spec.Workdir
+	req.User = spec.User
+	req.DNS = append(req.DNS, spec.DNS...)
+	req.DNSSearch = append(req.DNSSearch, spec.DNSSearch...)
+	req.ExtraHosts = append(req.ExtraHosts, spec.ExtraHosts...)
+	req.Sidecars = spec.Sidecars
+	req.Volumes = spec.Volumes
+	req.PrivateNetworks = spec.PrivateNetworks
+	return nil
+}
+
+// Validate checks a secret creation request.
+func (req *PutSecretRequest) Validate() error {
+	var v validation.Validator
+	if v.Required("name", req.Name) {
+		v.MaxLength("name", req.Name, validation.MaxNameLength)
+	}
+	v.Required("value", req.Value)
+	v.MaxLength("value", req.Value, validation.MaxSecretValueBytes)
+	v.MaxLength("description", req.Description, validation.MaxDescriptionLength)
+	return v.Err()
+}
+
+// Validate checks an image build request.
+func (req *BuildImageRequest) Validate() error {
+	var v validation.Validator
+	if v.Required("tag", req.Tag) {
+		v.Image("tag", req.Tag)
+	}
+	v.Check(len(req.Context) == 0 || req.GitURL == "", "git_url", "cannot be combined with context")
+	v.Check(len(req.Context) > 0 || req.GitURL != "" || req.Dockerfile != "", "dockerfile", "is required without context or git_url")
+	v.Check(req.GitURL == "" || req.Dockerfile == "", "dockerfile", "cannot be combined with git_url, use dockerfile_path")
+	v.Check(req.Dockerfile == "" || req.DockerfilePath == "", "dockerfile_path", "cannot be combined with dockerfile")
+	if req.GitURL != "" {
+		v.Check(strings.HasPrefix(req.GitURL, "https://") || strings.HasPrefix(req.GitURL, "git://") || strings.HasPrefix(req.GitURL, "git@"),
+			"git_url", "must be an https://, git:// or git@ repository URL")
+	}
+	v.Check(!strings.HasPrefix(req.DockerfilePath, "/") && !strings.Contains(req.DockerfilePath, ".."), "dockerfile_path", "must be a relative path inside the context")
+	for name := range req.BuildArgs {
+		v.EnvName("build_args."+name, name)
+	}
+	if req.Timeout != "" {
+		if d, err := time.ParseDuration(req.Timeout); err != nil || d <= 0 {
+			v.Add("timeout", "must be a positive duration such as \"20m\"")
+		}
+	}
+	return v.Err()
+}
+
+// Validate checks a watch creation request.
+func (req *CreateWatchRequest) Validate() error {
+	var v validation.Validator
+	v.AbsPath("path", req.Path)
+	for i, event := range req.Events {
+		field := "events[" + strconv.Itoa(i) + "]"
+		if v.Required(field, event) {
+			v.OneOf(field, event, manager.WatchEvents...)
+		}
+	}
+	return v.Err()
+}
+
+// Validate checks a kernel creation request.
+func (req *CreateKernelRequest) Validate() error {
+	var v validation.Validator
+	if v.Required("kernel_id", req.KernelID) {
+		v.ResourceName("kernel_id", req.KernelID)
+	}
+	return v.Err()
+}
+
+// Validate checks an artifact capture request.
+func (req *CaptureArtifactRequest) Validate() error {
+	var v validation.Validator
+	v.AbsPath("path", req.Path)
+	v.FileName("name", req.Name)
+	return v.Err()
+}
+
+// Validate checks a file transfer request.
+func (req *TransferRequest) Validate() error {
+	var v validation.Validator
+	v.Required("source.sandbox_id", req.Source.SandboxID)
+	v.AbsPath("source.path", req.Source.Path)
+	v.Required("destination.sandbox_id", req.Destination.SandboxID)
+	v.AbsPath("destination.path", req.Destination.Path)
+	return v.Err()
+}
+
+// validateActionPayload checks the source field ("command" or "code") of a shell or IPython action.
+func validateActionPayload(payload map[string]interface{}, field string) error {
+	var v validation.Validator
+	checkActionPayload(&v, payload, field, field)
+	if p, ok := payload["priority"]; ok {
+		f, isNumber := p.(float64)
+		v.Check(isNumber && f == math.Trunc(f), "priority", "must be an integer")
+	}
+	if coalesce, ok := payload["coalesce"]; ok {
+		spec, isObject := coalesce.(map[string]interface{})
+		v.Check(isObject, "coalesce", "must be an object")
+		checkInt(&v, spec, "window_ms", "coalesce.window_ms", maxCoalesceWindowMS)
+		checkInt(&v, spec, "max_bytes", "coalesce.max_bytes", maxCoalesceBytes)
+	}
+	if large, ok := payload["large_output"]; ok {
+		_, isBool := large.(bool)
+		v.Check(isBool, "large_output", "must be a boolean")
+		v.Check(field == "command", "large_output", "is only supported for shell commands")
+	}
+	if aggregate, ok := payload["aggregate"]; ok {
+		mode, isString := aggregate.(string)
+		v.Check(isString, "aggregate", "must be a string")
+		v.OneOf("aggregate", mode, manager.AggregateMerged, manager.AggregateSeparate)
+	}
+	if shell, ok := payload["shell"]; ok {
+		name, isString := shell.(string)
+		v.Check(isString, "shell", "must be a string")
+		v.OneOf("shell", name, "bash", "sh", "zsh", "powershell", "pwsh", "cmd")
+		v.Check(field == "command", "shell", "is only supported for shell commands")
+	}
+	if user, ok := payload["user"]; ok {
+		name, isString := user.(string)
+		v.Check(isString, "user", "must be a string")
+		if isString {
+			v.User("user", name)
+		}
+		v.Check(field == "command", "user", "is only supported for shell commands")
+	}
+	if login, ok := payload["login"]; ok {
+		_, isBool := login.(bool)
+		v.Check(isBool, "login", "must be a boolean")
+		v.Check(field == "command", "login", "is only supported for shell commands")
+	}
+	if kernel, ok := payload["kernel_id"]; ok {
+		id, isString := kernel.(string)
+		v.Check(isString, "kernel_id", "must be a string")
+		if isString {
+			v.ResourceName("kernel_id", id)
+		}
+		v.Check(field == "code", "kernel_id", "is only supported for IPython cells")
+	}
+	if cache, ok := payload["cache"]; ok {
+		_, isBool := cache.(bool)
+		v.Check(isBool, "cache", "must be a boolean")
+		large, _ := payload["large_output"].(bool)
+		v.Check(!large, "cache", "cannot be combined with large_output")
+	}
+	if cwd, ok := payload["cwd"]; ok {
+		dir, isString := cwd.(string)
+		v.Check(isString, "cwd", "must be a string")
+		if isString {
+			v.AbsPath("cwd", dir)
+		}
+	}
+	if env, ok := payload["env"]; ok {
+		checkActionEnv(&v, env)
+	}
+	if metadata, ok := payload["metadata"]; ok {
+		obj, isObject := metadata.(map[string]interface{})
+		v.Check(isObject, "metadata", "must be an object")
+		v.Check(len(obj) <= maxMetadataKeys, "metadata", "must have at most "+strconv.Itoa(maxMetadataKeys)+" keys")
+		_, hasEmptyKey := obj[""]
+		v.Check(!hasEmptyKey, "metadata", "must not have an empty key")
+		if isObject {
+			raw, _ := json.Marshal(obj)
+			v.Check(len(raw) <= maxMetadataBytes, "metadata", "must be at most "+strconv.Itoa(maxMetadataBytes)+" bytes as JSON")
+		}
+	}
+	return v.Err()
+}
+
+// checkActionEnv records errors for the "env" overrides of an action: an object of strings
+// whose keys are variable names.
+func checkActionEnv(v *validation.Validator, raw interface{}) {
+	obj, isObject := raw.(map[string]interface{})
+	if !isObject {
+		v.Add("env", "must be an object")
+		return
+	}
+	env := make(map[string]string, len(obj))
+	for name, value := range obj {
+		s, isString := value.(string)
+		v.Check(isString, "env."+name, "must be a string")
+		env[name] = s
+	}
+	v.Env("env", env)
+}
+
+// Bounds of the "metadata" of an action, which every observation of the action carries.
+const (
+	maxMetadataKeys  = 32
+	maxMetadataBytes = 4096
+)
+
+// Bounds of the "coalesce" policy of an action.
+const (
+	maxCoalesceWindowMS = 10000
+	maxCoalesceBytes    = 1 << 20
+)
+
+// checkInt records an error under name unless obj[key] is absent or an integer in [0, max].
+func checkInt(v *validation.Validator, obj map[string]interface{}, key, name string, max int) {
+	raw, ok := obj[key]
+	if !ok {
+		return
+	}
+	f, isNumber := raw.(float64)
+	v.Check(isNumber && f == math.Trunc(f) && f >= 0 && f <= float64(max), name, "must be an integer between 0 and "+strconv.Itoa(max))
+}
+
+// checkActionPayload records errors for the source field key of an action payload under name.
+func checkActionPayload(v *validation.Validator, payload map[string]interface{}, key, name string) {
+	source, ok := payload[key].(string)
+	switch {
+	case payload[key] == nil:
+		v.Add(name, "is required")
+	case !ok:
+		v.Add(name, "must be a string")
+	default:
+		v.Required(name, source)
+		v.MaxLength(name, source, validation.MaxCommandBytes)
+	}
+}
+
+// Validate checks a schedule creation request.
+func (req *CreateScheduleRequest) Validate() error {
+	var v validation.Validator
+	if v.Required("cron", req.Cron) {
+		if _, err := cron.Parse(req.Cron); err != nil {
+			v.Add("cron", "%v", err)
+		}
+	}
+	if req.Timezone != "" {
+		if _, err := time.LoadLocation(req.Timezone); err != nil {
+			v.Add("timezone", "is not a known IANA time zone")
+		}
+	}
+	switch req.ActionType {
+	case "shell":
+		checkActionPayload(&v, req.Payload, "command", "payload.command")
+	case "ipython":
+		checkActionPayload(&v, req.Payload, "code", "payload.code")
+	default:
+		v.Add("action_type", "must be one of shell, ipython")
+	}
+	return v.Err()
+}
+
+// maxSetupCommands caps the number of setup commands of a sandbox.
+const maxSetupCommands = 100
+
+func checkVolumeMounts(v *validation.Validator, field string, mounts []manager.VolumeMount) {
+	for i, m := range mounts {
+		mountField := field + "[" + strconv.Itoa(i) + "]"
+		v.ResourceName(mountField+".volume", m.Volume)
+		v.AbsPath(mountField+".path", m.Path)
+	}
+}
+
+// maxComposeBytes caps the size of a compose file.
+const maxComposeBytes = 256 << 10
+
+// maxSidecars caps the number of sidecars of a sandbox.
+const maxSidecars = 10
+
+// maxWorkflowSteps caps the number of steps in one workflow request.
+const maxWorkflowSteps = 100
+
+// Validate checks a workflow request.
+func (req *StartWorkflowRequest) Validate() error {
+	var v validation.Validator
+	v.Check(len(req.Steps) > 0, "steps", "must not be empty")
+	v.Check(len(req.Steps) <= maxWorkflowSteps, "steps", "must have at most "+strconv.Itoa(maxWorkflowSteps)+" entries")
+	for i, step := range req.Steps {
+		field := "steps[" + strconv.Itoa(i) + "]"
+		v.MaxLength(field+".name", step.Name, validation.MaxNameLength)
+		switch step.ActionType {
+		case "shell":
+			checkActionPayload(&v, step.Payload, "command", field+".payload.command")
+		case "ipython":
+			checkActionPayload(&v, step.Payload, "code", field+".payload.code")
+		default:
+			v.Add(field+".action_type", "must be one of shell, ipython")
+		}
+		v.OneOf(field+".run_if", step.RunIf, manager.RunOnSuccess, manager.RunOnFailure, manager.RunAlways)
+		if step.Timeout != "" {
+			if d, err := time.ParseDuration(step.Timeout); err != nil || d <= 0 {
+				v.Add(field+".timeout", "must be a positive duration such as \"10m\"")
+			}
+		}
+	}
+	return v.Err()
+}
+
+// validateSpace checks the fields of a space creation or update request.
+func validateSpace(name, description string, volumes []manager.SpaceVolume, requireName bool) error {
+	var v validation.Validator
+	if requireName {
+		v.Required("name", name)
+	}
+	v.MaxLength("name", name, validation.MaxNameLength)
+	v.MaxLength("description", description, validation.MaxDescriptionLength)
+	v.Check(len(volumes) <= maxSpaceVolumes, "volumes", "must have at most "+strconv.Itoa(maxSpaceVolumes)+" entries")
+	paths := make(map[string]bool, len(volumes))
+	for i, sv := range volumes {
+		field := "volumes[" + strconv.Itoa(i) + "]"
+		v.ResourceName(field+".volume", sv.Volume)
+		v.AbsPath(field+".path", sv.Path)
+		v.Check(!paths[sv.Path], field+".path", "is already the path of another volume")
+		paths[sv.Path] = true
+	}
+	return v.Err()
+}
+
+// maxSpaceVolumes caps the number of shared volumes of a space.
+const maxSpaceVolumes = 10
+
+// validateBudget checks a space or tenant budget.
+func validateBudget(b manager.Budget) error {
+	var v validation.Validator
+	v.Check(b.MaxRuntimeHours >= 0 && !math.IsInf(b.MaxRuntimeHours, 0), "max_runtime_hours", "must be a non-negative number")
+	v.Check(b.MaxCostUnits >= 0 && !math.IsInf(b.MaxCostUnits, 0), "max_cost_units", "must be a non-negative number")
+	v.Check(b.MaxRuntimeHours > 0 || b.MaxCostUnits > 0, "max_runtime_hours", "or max_cost_units must be set")
+	v.Check(len(b.WarnAt) <= maxBudgetThresholds, "warn_at", "must have at most "+strconv.Itoa(maxBudgetThresholds)+" entries")
+	for i, t := range b.WarnAt {
+		v.Check(t > 0 && t < 1, "warn_at["+strconv.Itoa(i)+"]", "must be between 0 and 1, exclusive")
+	}
+	return v.Err()
+}
+
+// maxBudgetThresholds caps the warning thresholds of a budget.
+const maxBudgetThresholds = 10
@@ -0,0 +1,184 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/foreveryh/sandboxai/go/mentisruntime/msgpack"
+	"github.com/foreveryh/sandboxai/go/mentisruntime/ws"
+)
+
+// V1ObservationsDeprecated is when the observation routes of API version 1 were superseded
+// by those of version 2.
+var V1ObservationsDeprecated = time.Date(2026, time.October, 17, 0, 0, 0, 0, time.UTC)
+
+// Deprecated marks the routes it wraps as deprecated since the given time (RFC 9745), links
+// the same route of the next API version as their successor and, unless sunset is zero,
+// announces when they will be removed (RFC 8594).
+func Deprecated(since, sunset time.Time) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Deprecation", "@"+strconv.FormatInt(since.Unix(), 10))
+			if !sunset.IsZero() {
+				w.Header().Set("Sunset", sunset.UTC().Format(http.TimeFormat))
+			}
+			if version, rest, ok := splitVersion(r.URL.Path); ok {
+				successor := "/v" + strconv.Itoa(version+1) + rest
+				w.Header().Add("Link", "<"+successor+`>; rel="successor-version"`)
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// Shim serves the routes of API version to that are unchanged from version from, by
+// rewriting the version prefix of the path and passing the request to the router of from.
+func Shim(to, from string, router http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r = r.Clone(r.Context())
+		r.URL.Path = "/" + from + strings.TrimPrefix(r.URL.Path, "/"+to)
+		if r.URL.RawPath != "" {
+			r.URL.RawPath = "/" + from + strings.TrimPrefix(r.URL.RawPath, "/"+to)
+		}
+		router.ServeHTTP(w, r)
+	})
+}
+
+// splitVersion splits a path such as "/v1/spaces" into its API version and the rest.
+func splitVersion(path string) (int, string, bool) {
+	if !strings.HasPrefix(path, "/v") {
+		return 0, "", false
+	}
+	end := strings.IndexByte(path[1:], '/') + 1
+	if end == 0 {
+		end = len(path)
+	}
+	version, err := strconv.Atoi(path[2:end])
+	if err != nil {
+		return 0, "", false
+	}
+	return version, path[end:], true
+}
+
+// TypedObservation is an observation in the schema of API version 2: the fields all
+// observations have, and those of its type under Data. Version 1 observations carry the
+// fields of some types, such as the lines of "stream" observations, at the top level.
+type TypedObservation struct {
+	Seq       uint64          `json:"seq,omitempty"`
+	Type      string          `json:"type"`
+	ActionID  string          `json:"action_id,omitempty"`
+	Timestamp json.RawMessage `json:"timestamp,omitempty"`
+	Metadata  json.RawMessage `json:"metadata,omitempty"` // Client metadata of the action
+	Data      json.RawMessage `json:"data"`
+}
+
+// envelopeFields are the top-level fields of version 1 observations that TypedObservation
+// keeps at the top level.
+var envelopeFields = []string{"seq", "observation_type", "action_id", "timestamp", "metadata", "data"}
+
+// NewTypedObservation converts a version 1 observation message.
+func NewTypedObservation(message []byte) (TypedObservation, error) {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(message, &fields); err != nil {
+		return TypedObservation{}, err
+	}
+	var obs TypedObservation
+	if err := json.Unmarshal(fields["observation_type"], &obs.Type); err != nil || obs.Type == "" {
+		return TypedObservation{}, errors.New("observation has no observation_type")
+	}
+	if raw, ok := fields["seq"]; ok {
+		json.Unmarshal(raw, &obs.Seq)
+	}
+	if raw, ok := fields["action_id"]; ok {
+		json.Unmarshal(raw, &obs.ActionID)
+	}
+	obs.Timestamp = fields["timestamp"]
+	obs.Metadata = fields["metadata"]
+
+	data := map[string]json.RawMessage{}
+	if raw, ok := fields["data"]; ok && json.Unmarshal(raw, &data) != nil {
+		// Data that is not an object is kept whole.
+		data = map[string]json.RawMessage{"data": raw}
+	}
+	for _, name := range envelopeFields {
+		delete(fields, name)
+	}
+	for name, raw := range fields {
+		data[name] = raw
+	}
+	var err error
+	obs.Data, err = json.Marshal(data)
+	return obs, err
+}
+
+// EncodeTypedObservation converts a version 1 observation message into a version 2 one.
+// Streams of API version 2 send their messages through it.
+func EncodeTypedObservation(message []byte) ([]byte, error) {
+	obs, err := NewTypedObservation(message)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(obs)
+}
+
+// StreamFormats are the formats clients of observation streams can negotiate as WebSocket
+// subprotocols, whichever API version they connect to. MessagePack messages are sent in
+// binary frames; their first byte is a map header, never the type byte of raw output frames.
+var StreamFormats = []ws.Format{
+	{Subprotocol: "observations.v2.msgpack", Encode: encodeTypedObservationMsgpack, Binary: true},
+	{Subprotocol: "observations.v2.json", Encode: EncodeTypedObservation},
+	{Subprotocol: "observations.v1.msgpack", Encode: msgpack.FromJSON, Binary: true},
+	{Subprotocol: "observations.v1.json"},
+}
+
+func encodeTypedObservationMsgpack(message []byte) ([]byte, error) {
+	typed, err := EncodeTypedObservation(message)
+	if err != nil {
+		return nil, err
+	}
+	return msgpack.FromJSON(typed)
+}
+
+// TypedObservationPage is a page of the observation history in the schema of API version 2.
+type TypedObservationPage struct {
+	Observations []TypedObservation `json:"observations"`
+	NextCursor   string             `json:"next_cursor,omitempty"`
+}
+
+// ListObservationsV2Handler is ListObservationsHandler returning TypedObservations.
+func (h *APIHandler) ListObservationsV2Handler(w http.ResponseWriter, r *http.Request) {
+	sandboxState, ok := h.lookupSandboxInSpace(w, r)
+	if !ok {
+		return
+	}
+
+	q, err := parseObservationQuery(r.URL.Query())
+	if err != nil {
+		writeValidationError(w, err)
+		return
+	}
+
+	page, err := h.sandboxManager.ListObservations(r.Context(), sandboxState.ID, q)
+	if err != nil {
+		h.writeManagerError(w, err, "Failed to list observations")
+		return
+	}
+
+	typed := TypedObservationPage{Observations: make([]TypedObservation, 0, len(page.Observations)), NextCursor: page.NextCursor}
+	for _, record := range page.Observations {
+		obs, err := NewTypedObservation(record.Observation)
+		if err != nil {
+			h.logger.Warn("Skipping observation that cannot be converted", "sandboxID", sandboxState.ID, "seq", record.Seq, "error", err)
+			continue
+		}
+		obs.Seq = record.Seq
+		typed.Observations = append(typed.Observations, obs)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(typed)
+}
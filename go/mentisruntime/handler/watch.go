@@ -0,0 +1,77 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/gorilla/mux"
+)
+
+// CreateWatchRequest represents the request body for subscribing to filesystem events.
+type CreateWatchRequest struct {
+	Path      string   `json:"path"`
+	Recursive bool     `json:"recursive,omitempty"`
+	Events    []string `json:"events,omitempty"`
+}
+
+// CreateWatchHandler registers a filesystem watch inside a sandbox.
+// Events are delivered as "fs_event" observations on the sandbox stream.
+func (h *APIHandler) CreateWatchHandler(w http.ResponseWriter, r *http.Request) {
+	sandboxState, ok := h.lookupSandboxInSpace(w, r)
+	if !ok {
+		return
+	}
+
+	var req CreateWatchRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		WriteError(w, "Invalid request body: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := req.Validate(); err != nil {
+		writeValidationError(w, err)
+		return
+	}
+
+	watch, err := h.sandboxManager.CreateWatch(r.Context(), sandboxState.ID, req.Path, req.Recursive, req.Events)
+	if err != nil {
+		h.writeManagerError(w, err, "Failed to create watch")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(watch)
+}
+
+// ListWatchesHandler lists the filesystem watches of a sandbox.
+func (h *APIHandler) ListWatchesHandler(w http.ResponseWriter, r *http.Request) {
+	sandboxState, ok := h.lookupSandboxInSpace(w, r)
+	if !ok {
+		return
+	}
+
+	watches, err := h.sandboxManager.ListWatches(r.Context(), sandboxState.ID)
+	if err != nil {
+		h.writeManagerError(w, err, "Failed to list watches")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(watches)
+}
+
+// DeleteWatchHandler removes a filesystem watch from a sandbox.
+func (h *APIHandler) DeleteWatchHandler(w http.ResponseWriter, r *http.Request) {
+	sandboxState, ok := h.lookupSandboxInSpace(w, r)
+	if !ok {
+		return
+	}
+	watchID := mux.Vars(r)["watchID"]
+
+	if err := h.sandboxManager.DeleteWatch(r.Context(), sandboxState.ID, watchID); err != nil {
+		h.writeManagerError(w, err, "Failed to delete watch "+watchID)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,100 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"github.com/foreveryh/sandboxai/go/mentisruntime/manager"
+)
+
+// WorkflowStepRequest is one step of a workflow request.
+type WorkflowStepRequest struct {
+	Name       string                 `json:"name,omitempty"`
+	ActionType string                 `json:"action_type"` // "shell" or "ipython"
+	Payload    map[string]interface{} `json:"payload"`     // Same body as the matching tools endpoint
+	RunIf      string                 `json:"run_if,omitempty"`
+	Timeout    string                 `json:"timeout,omitempty"` // Go duration, e.g. "10m"
+}
+
+// StartWorkflowRequest represents the request body for running several actions in sequence.
+type StartWorkflowRequest struct {
+	Steps []WorkflowStepRequest `json:"steps"`
+}
+
+// StartWorkflowHandler starts a server-side workflow and returns its ID immediately.
+func (h *APIHandler) StartWorkflowHandler(w http.ResponseWriter, r *http.Request) {
+	sandboxState, ok := h.lookupSandboxInSpace(w, r)
+	if !ok {
+		return
+	}
+
+	var req StartWorkflowRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		WriteError(w, "Invalid request body: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := req.Validate(); err != nil {
+		writeValidationError(w, err)
+		return
+	}
+
+	steps := make([]manager.WorkflowStepSpec, len(req.Steps))
+	for i, step := range req.Steps {
+		timeout, _ := time.ParseDuration(step.Timeout) // Validated above; empty means the default
+		steps[i] = manager.WorkflowStepSpec{
+			Name:       step.Name,
+			ActionType: step.ActionType,
+			Payload:    step.Payload,
+			RunIf:      step.RunIf,
+			Timeout:    timeout,
+		}
+	}
+
+	workflow, err := h.sandboxManager.StartWorkflow(r.Context(), sandboxState.ID, steps)
+	if err != nil {
+		h.writeManagerError(w, err, "Failed to start workflow")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(workflow)
+}
+
+// ListWorkflowsHandler lists the workflows of a sandbox.
+func (h *APIHandler) ListWorkflowsHandler(w http.ResponseWriter, r *http.Request) {
+	sandboxState, ok := h.lookupSandboxInSpace(w, r)
+	if !ok {
+		return
+	}
+
+	workflows, err := h.sandboxManager.ListWorkflows(r.Context(), sandboxState.ID)
+	if err != nil {
+		h.writeManagerError(w, err, "Failed to list workflows")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(workflows)
+}
+
+// GetWorkflowHandler returns the status of a workflow and its steps.
+func (h *APIHandler) GetWorkflowHandler(w http.ResponseWriter, r *http.Request) {
+	sandboxState, ok := h.lookupSandboxInSpace(w, r)
+	if !ok {
+		return
+	}
+	workflowID := mux.Vars(r)["workflowID"]
+
+	workflow, err := h.sandboxManager.GetWorkflow(r.Context(), sandboxState.ID, workflowID)
+	if err != nil {
+		h.writeManagerError(w, err, "Failed to get workflow "+workflowID)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(workflow)
+}
@@ -0,0 +1,420 @@
+// Package history records the observations of each sandbox with per-sandbox sequence
+// numbers and answers paginated, filtered queries over them.
+package history
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Query limits.
+const (
+	DefaultLimit = 100
+	MaxLimit     = 1000
+)
+
+// DefaultRetention is the number of observations kept per sandbox when none is configured.
+const DefaultRetention = 10000
+
+// ErrInvalidCursor is returned for cursors that were not produced by a previous page.
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// Record is a stored observation. Observation holds the message exactly as it was broadcast.
+type Record struct {
+	Seq             uint64          `json:"seq"`
+	ObservationType string          `json:"observation_type"`
+	ActionID        string          `json:"action_id,omitempty"`
+	Timestamp       time.Time       `json:"timestamp"`
+	Observation     json.RawMessage `json:"observation"`
+}
+
+// Query selects observations of one sandbox. Zero fields do not filter.
+type Query struct {
+	Cursor   string    // Return records after this cursor, as returned in Page.NextCursor
+	Since    time.Time // Inclusive lower bound on Timestamp
+	Until    time.Time // Exclusive upper bound on Timestamp
+	ActionID string
+	Types    []string // Observation types to include
+	Limit    int      // Page size; DefaultLimit if zero, capped at MaxLimit
+}
+
+// Page is one page of query results, ordered by sequence number. NextCursor is empty
+// when there are no further matching records.
+type Page struct {
+	Observations []Record `json:"observations"`
+	NextCursor   string   `json:"next_cursor,omitempty"`
+}
+
+// Meta is the metadata Append reads from an observation message.
+type Meta struct {
+	ObservationType string    `json:"observation_type"`
+	ActionID        string    `json:"action_id"`
+	Timestamp       time.Time `json:"timestamp"`
+}
+
+// Cipher encrypts the observations a Store writes to disk, for a stream. Metadata — sequence
+// number, type, action and timestamp — is written in clear text.
+type Cipher interface {
+	Seal(streamID string, plaintext, additionalData []byte) (keyID string, ciphertext []byte, err error)
+	Open(keyID string, ciphertext, additionalData []byte) ([]byte, error)
+}
+
+// fileRecord is a line of a history file: a Record, with its observation sealed if the
+// store has a cipher.
+type fileRecord struct {
+	Seq             uint64          `json:"seq"`
+	ObservationType string          `json:"observation_type"`
+	ActionID        string          `json:"action_id,omitempty"`
+	Timestamp       time.Time       `json:"timestamp"`
+	Observation     json.RawMessage `json:"observation,omitempty"`
+	KeyID           string          `json:"key_id,omitempty"`
+	Sealed          []byte          `json:"sealed,omitempty"`
+}
+
+// lineBuffers holds the buffers history file lines are encoded in.
+var lineBuffers = sync.Pool{New: func() any { return new(bytes.Buffer) }}
+
+type sandboxLog struct {
+	records []Record
+	lastSeq uint64
+	file    *os.File // Append-only JSON lines file; nil without a directory
+}
+
+// Store keeps the most recent observations of each sandbox in memory and, if it has a
+// directory, appends them to one JSON lines file per sandbox so history survives restarts.
+type Store struct {
+	mu        sync.Mutex
+	dir       string
+	retention int
+	cipher    Cipher // Seals observations written to disk; nil writes them in clear text
+	logs      map[string]*sandboxLog
+}
+
+// NewStore creates a store keeping up to retention observations per sandbox
+// (DefaultRetention if zero). If dir is non-empty, history is persisted there.
+func NewStore(dir string, retention int) (*Store, error) {
+	if retention <= 0 {
+		retention = DefaultRetention
+	}
+	if dir != "" {
+		if err := os.MkdirAll(dir, 0o700); err != nil {
+			return nil, fmt.Errorf("create history dir: %w", err)
+		}
+	}
+	return &Store{dir: dir, retention: retention, logs: make(map[string]*sandboxLog)}, nil
+}
+
+// SetCipher seals the observations written from now on with c. Files keep the records
+// written before in clear text; Reseal rewrites them.
+func (s *Store) SetCipher(c Cipher) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.cipher = c
+}
+
+// Append records an observation message for a sandbox and returns its sequence number.
+// Messages that are not valid JSON objects are stored with an empty type.
+func (s *Store) Append(sandboxID string, message []byte) (uint64, error) {
+	var meta Meta
+	_ = json.Unmarshal(message, &meta)
+	observation := append(json.RawMessage(nil), message...)
+	if !json.Valid(message) {
+		observation, _ = json.Marshal(string(message))
+	}
+	return s.AppendJSON(sandboxID, meta, observation)
+}
+
+// AppendJSON is Append for callers that already parsed the message: it skips parsing and
+// validation. message must be valid JSON and is kept, so it must not be modified afterwards.
+func (s *Store) AppendJSON(sandboxID string, meta Meta, message []byte) (uint64, error) {
+	if meta.Timestamp.IsZero() {
+		meta.Timestamp = time.Now().UTC()
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	log, err := s.open(sandboxID)
+	if err != nil {
+		return 0, err
+	}
+	log.lastSeq++
+	rec := Record{
+		Seq:             log.lastSeq,
+		ObservationType: meta.ObservationType,
+		ActionID:        meta.ActionID,
+		Timestamp:       meta.Timestamp,
+		Observation:     message,
+	}
+	// Dropping the oldest record only reslices; append copies the window when it next grows.
+	log.records = append(log.records, rec)
+	if over := len(log.records) - s.retention; over > 0 {
+		log.records = log.records[over:]
+	}
+	if log.file != nil {
+		buf := lineBuffers.Get().(*bytes.Buffer)
+		defer lineBuffers.Put(buf)
+		buf.Reset()
+		if err := s.encode(json.NewEncoder(buf), sandboxID, rec); err != nil {
+			return 0, err
+		}
+		if _, err := log.file.Write(buf.Bytes()); err != nil {
+			return 0, fmt.Errorf("write history: %w", err)
+		}
+	}
+	return rec.Seq, nil
+}
+
+// Query returns a page of a sandbox's observations matching q.
+func (s *Store) Query(sandboxID string, q Query) (*Page, error) {
+	var after uint64
+	if q.Cursor != "" {
+		var err error
+		after, err = strconv.ParseUint(q.Cursor, 10, 64)
+		if err != nil {
+			return nil, ErrInvalidCursor
+		}
+	}
+	limit := q.Limit
+	if limit <= 0 {
+		limit = DefaultLimit
+	}
+	if limit > MaxLimit {
+		limit = MaxLimit
+	}
+	types := make(map[string]bool, len(q.Types))
+	for _, t := range q.Types {
+		types[t] = true
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	log, err := s.open(sandboxID)
+	if err != nil {
+		return nil, err
+	}
+
+	page := &Page{Observations: []Record{}}
+	records := log.records
+	start := sort.Search(len(records), func(i int) bool { return records[i].Seq > after })
+	for _, rec := range records[start:] {
+		if q.ActionID != "" && rec.ActionID != q.ActionID {
+			continue
+		}
+		if len(types) > 0 && !types[rec.ObservationType] {
+			continue
+		}
+		if !q.Since.IsZero() && rec.Timestamp.Before(q.Since) {
+			continue
+		}
+		if !q.Until.IsZero() && !rec.Timestamp.Before(q.Until) {
+			continue
+		}
+		if len(page.Observations) == limit {
+			page.NextCursor = strconv.FormatUint(page.Observations[limit-1].Seq, 10)
+			break
+		}
+		page.Observations = append(page.Observations, rec)
+	}
+	return page, nil
+}
+
+// Delete drops a sandbox's history, including its file.
+func (s *Store) Delete(sandboxID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if log, ok := s.logs[sandboxID]; ok && log.file != nil {
+		log.file.Close()
+	}
+	delete(s.logs, sandboxID)
+	if s.dir == "" {
+		return nil
+	}
+	if err := os.Remove(s.path(sandboxID)); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("remove history file: %w", err)
+	}
+	return nil
+}
+
+// Reseal rewrites a stream's history file with the store's cipher, so that it holds no
+// observation sealed with an older key, or in clear text. Records beyond the retention are
+// dropped from the file.
+func (s *Store) Reseal(streamID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.dir == "" {
+		return nil
+	}
+	log, err := s.open(streamID)
+	if err != nil {
+		return err
+	}
+	if err := s.rewrite(streamID, log.records); err != nil {
+		return err
+	}
+	// The open file is the one rewrite replaced
+	log.file.Close()
+	file, err := os.OpenFile(s.path(streamID), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600)
+	if err != nil {
+		log.file = nil
+		delete(s.logs, streamID)
+		return fmt.Errorf("open history file: %w", err)
+	}
+	log.file = file
+	return nil
+}
+
+// Close closes all open history files.
+func (s *Store) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var firstErr error
+	for _, log := range s.logs {
+		if log.file != nil {
+			if err := log.file.Close(); err != nil && firstErr == nil {
+				firstErr = err
+			}
+			log.file = nil
+		}
+	}
+	return firstErr
+}
+
+func (s *Store) path(sandboxID string) string {
+	return filepath.Join(s.dir, filepath.Base(sandboxID)+".jsonl")
+}
+
+// open returns the log of a sandbox, loading it from disk on first use. Callers must hold s.mu.
+func (s *Store) open(sandboxID string) (*sandboxLog, error) {
+	if log, ok := s.logs[sandboxID]; ok {
+		return log, nil
+	}
+	log := &sandboxLog{}
+	if s.dir != "" {
+		if err := s.load(sandboxID, log); err != nil {
+			return nil, err
+		}
+		file, err := os.OpenFile(s.path(sandboxID), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600)
+		if err != nil {
+			return nil, fmt.Errorf("open history file: %w", err)
+		}
+		log.file = file
+	}
+	s.logs[sandboxID] = log
+	return log, nil
+}
+
+// load reads a sandbox's history file, keeping the newest records within retention. Files
+// holding more than twice the retention are rewritten so they do not grow without bound.
+func (s *Store) load(sandboxID string, log *sandboxLog) error {
+	file, err := os.Open(s.path(sandboxID))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("open history file: %w", err)
+	}
+	defer file.Close()
+
+	total := 0
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64<<10), 16<<20)
+	for scanner.Scan() {
+		var line fileRecord
+		if err := json.Unmarshal(scanner.Bytes(), &line); err != nil {
+			continue // Skip a line torn by a crash mid-write
+		}
+		rec, err := s.decode(sandboxID, line)
+		if err != nil {
+			return err
+		}
+		total++
+		log.lastSeq = rec.Seq
+		log.records = append(log.records, rec)
+		if len(log.records) > 2*s.retention {
+			log.records = append(log.records[:0:0], log.records[len(log.records)-s.retention:]...)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("read history file: %w", err)
+	}
+	if over := len(log.records) - s.retention; over > 0 {
+		log.records = append(log.records[:0:0], log.records[over:]...)
+	}
+	if total > 2*s.retention {
+		return s.rewrite(sandboxID, log.records)
+	}
+	return nil
+}
+
+func (s *Store) rewrite(sandboxID string, records []Record) error {
+	tmp := s.path(sandboxID) + ".tmp"
+	file, err := os.OpenFile(tmp, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o600)
+	if err != nil {
+		return fmt.Errorf("compact history file: %w", err)
+	}
+	w := bufio.NewWriter(file)
+	enc := json.NewEncoder(w)
+	for _, rec := range records {
+		if err := s.encode(enc, sandboxID, rec); err != nil {
+			file.Close()
+			return fmt.Errorf("compact history file: %w", err)
+		}
+	}
+	if err := w.Flush(); err != nil {
+		file.Close()
+		return fmt.Errorf("compact history file: %w", err)
+	}
+	if err := file.Close(); err != nil {
+		return fmt.Errorf("compact history file: %w", err)
+	}
+	return os.Rename(tmp, s.path(sandboxID))
+}
+
+// additionalData binds a sealed observation to its stream and sequence number, so it cannot
+// be moved to another record.
+func additionalData(streamID string, seq uint64) []byte {
+	return []byte(streamID + "/" + strconv.FormatUint(seq, 10))
+}
+
+// encode writes a record as a line of a stream's history file, sealing the observation if
+// the store has a cipher. Callers must hold s.mu.
+func (s *Store) encode(enc *json.Encoder, streamID string, rec Record) error {
+	line := fileRecord{Seq: rec.Seq, ObservationType: rec.ObservationType, ActionID: rec.ActionID, Timestamp: rec.Timestamp}
+	if s.cipher == nil {
+		line.Observation = rec.Observation
+		return enc.Encode(line)
+	}
+	keyID, sealed, err := s.cipher.Seal(streamID, rec.Observation, additionalData(streamID, rec.Seq))
+	if err != nil {
+		return fmt.Errorf("seal observation: %w", err)
+	}
+	line.KeyID, line.Sealed = keyID, sealed
+	return enc.Encode(line)
+}
+
+// decode returns the record of a line of a stream's history file, opening a sealed
+// observation. Callers must hold s.mu.
+func (s *Store) decode(streamID string, line fileRecord) (Record, error) {
+	rec := Record{Seq: line.Seq, ObservationType: line.ObservationType, ActionID: line.ActionID, Timestamp: line.Timestamp, Observation: line.Observation}
+	if line.KeyID == "" {
+		return rec, nil
+	}
+	if s.cipher == nil {
+		return Record{}, fmt.Errorf("history of %s is encrypted, but no cipher is configured", streamID)
+	}
+	plain, err := s.cipher.Open(line.KeyID, line.Sealed, additionalData(streamID, line.Seq))
+	if err != nil {
+		return Record{}, fmt.Errorf("open observation %d of %s: %w", line.Seq, streamID, err)
+	}
+	rec.Observation = plain
+	return rec, nil
+}
@@ -0,0 +1,141 @@
+package history
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func observation(obsType, actionID string, ts time.Time) []byte {
+	return []byte(fmt.Sprintf(`{"observation_type":%q,"action_id":%q,"timestamp":%q}`, obsType, actionID, ts.Format(time.RFC3339Nano)))
+}
+
+func TestStore_paginationAndFilters(t *testing.T) {
+	s, err := NewStore("", 0)
+	require.NoError(t, err)
+	base := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	for i := 0; i < 5; i++ {
+		_, err := s.Append("sb", observation("stream", "a1", base.Add(time.Duration(i)*time.Second)))
+		require.NoError(t, err)
+	}
+	_, err = s.Append("sb", observation("end", "a1", base.Add(5*time.Second)))
+	require.NoError(t, err)
+	_, err = s.Append("sb", observation("stream", "a2", base.Add(6*time.Second)))
+	require.NoError(t, err)
+
+	page, err := s.Query("sb", Query{ActionID: "a1", Limit: 4})
+	require.NoError(t, err)
+	require.Len(t, page.Observations, 4)
+	require.Equal(t, uint64(1), page.Observations[0].Seq)
+	require.Equal(t, "4", page.NextCursor)
+
+	page, err = s.Query("sb", Query{ActionID: "a1", Limit: 4, Cursor: page.NextCursor})
+	require.NoError(t, err)
+	require.Len(t, page.Observations, 2)
+	require.Equal(t, "end", page.Observations[1].ObservationType)
+	require.Empty(t, page.NextCursor)
+
+	page, err = s.Query("sb", Query{Types: []string{"stream"}, Since: base.Add(3 * time.Second), Until: base.Add(6 * time.Second)})
+	require.NoError(t, err)
+	require.Len(t, page.Observations, 2)
+	require.Equal(t, uint64(4), page.Observations[0].Seq)
+
+	_, err = s.Query("sb", Query{Cursor: "bogus"})
+	require.ErrorIs(t, err, ErrInvalidCursor)
+}
+
+func TestStore_persistenceAndRetention(t *testing.T) {
+	dir := t.TempDir()
+	s, err := NewStore(dir, 3)
+	require.NoError(t, err)
+	for i := 0; i < 10; i++ {
+		_, err := s.Append("sb", observation("stream", "a1", time.Now()))
+		require.NoError(t, err)
+	}
+	require.NoError(t, s.Close())
+
+	reopened, err := NewStore(dir, 3)
+	require.NoError(t, err)
+	page, err := reopened.Query("sb", Query{})
+	require.NoError(t, err)
+	require.Len(t, page.Observations, 3)
+	require.Equal(t, uint64(8), page.Observations[0].Seq)
+
+	seq, err := reopened.Append("sb", observation("end", "a1", time.Now()))
+	require.NoError(t, err)
+	require.Equal(t, uint64(11), seq, "sequence numbers continue after a restart")
+
+	require.NoError(t, reopened.Delete("sb"))
+	page, err = reopened.Query("sb", Query{})
+	require.NoError(t, err)
+	require.Empty(t, page.Observations)
+}
+
+// xorCipher is a stand-in for a real cipher. Its key IDs name the key, so any xorCipher
+// opens what another sealed, like a keyring keeping rotated keys.
+type xorCipher struct{ key byte }
+
+func (c *xorCipher) Seal(streamID string, plaintext, additionalData []byte) (string, []byte, error) {
+	sealed := make([]byte, len(plaintext))
+	for i, b := range plaintext {
+		sealed[i] = b ^ c.key
+	}
+	return fmt.Sprintf("%s/%d", streamID, c.key), sealed, nil
+}
+
+func (c *xorCipher) Open(keyID string, ciphertext, additionalData []byte) ([]byte, error) {
+	var key byte
+	if _, err := fmt.Sscanf(keyID[strings.LastIndex(keyID, "/")+1:], "%d", &key); err != nil {
+		return nil, err
+	}
+	plain := make([]byte, len(ciphertext))
+	for i, b := range ciphertext {
+		plain[i] = b ^ key
+	}
+	return plain, nil
+}
+
+func TestStore_cipher(t *testing.T) {
+	dir := t.TempDir()
+	base := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	s, err := NewStore(dir, 0)
+	require.NoError(t, err)
+	_, err = s.Append("sb", observation("clear", "a1", base))
+	require.NoError(t, err)
+	s.SetCipher(&xorCipher{key: 1})
+	_, err = s.Append("sb", observation("sealed", "a1", base))
+	require.NoError(t, err)
+
+	raw, err := os.ReadFile(filepath.Join(dir, "sb.jsonl"))
+	require.NoError(t, err)
+	require.Contains(t, string(raw), `"observation":{"observation_type":"clear"`)
+	require.Equal(t, 1, strings.Count(string(raw), `"key_id":"sb/1"`))
+
+	// A rotated cipher opens older keys; Reseal rewrites every record with the new one
+	rotated := &xorCipher{key: 2}
+	s.SetCipher(rotated)
+	require.NoError(t, s.Reseal("sb"))
+	_, err = s.Append("sb", observation("after", "a1", base))
+	require.NoError(t, err)
+	require.NoError(t, s.Close())
+	raw, err = os.ReadFile(filepath.Join(dir, "sb.jsonl"))
+	require.NoError(t, err)
+	require.Equal(t, 3, strings.Count(string(raw), `"key_id":"sb/2"`), string(raw))
+
+	reopened, err := NewStore(dir, 0)
+	require.NoError(t, err)
+	_, err = reopened.Query("sb", Query{})
+	require.Error(t, err, "sealed history needs a cipher")
+	reopened, err = NewStore(dir, 0)
+	require.NoError(t, err)
+	reopened.SetCipher(rotated)
+	page, err := reopened.Query("sb", Query{})
+	require.NoError(t, err)
+	require.Len(t, page.Observations, 3)
+	require.JSONEq(t, string(observation("sealed", "a1", base)), string(page.Observations[1].Observation))
+}
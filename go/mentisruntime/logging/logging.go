@@ -0,0 +1,238 @@
+// Package logging builds the runtime's logger: a JSON or text slog handler whose level can
+// be set for the whole process and for each component, at startup and while running.
+//
+// Components are named by the "component" attribute loggers add with With, such as
+// "sandbox-manager" or "websocket-hub". A record is logged if its level reaches the level of
+// its component, or the default level for components without one.
+package logging
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"math"
+	"strings"
+	"sync"
+)
+
+// ComponentKey is the attribute that names the component of a logger.
+const ComponentKey = "component"
+
+// Formats of the log output.
+const (
+	FormatJSON = "json"
+	FormatText = "text"
+)
+
+// Levels is the default log level and the levels of components that override it. It is safe
+// for concurrent use; changes apply to loggers created before them too.
+type Levels struct {
+	mu         sync.RWMutex
+	def        slog.Level
+	components map[string]slog.Level
+}
+
+// NewLevels returns levels with a default and no component overrides.
+func NewLevels(def slog.Level) *Levels {
+	return &Levels{def: def, components: make(map[string]slog.Level)}
+}
+
+// Default returns the level of components without one of their own.
+func (l *Levels) Default() slog.Level {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	return l.def
+}
+
+// SetDefault sets the level of components without one of their own.
+func (l *Levels) SetDefault(level slog.Level) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.def = level
+}
+
+// Set sets the level of a component.
+func (l *Levels) Set(component string, level slog.Level) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.components[component] = level
+}
+
+// Reset makes a component log at the default level again.
+func (l *Levels) Reset(component string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	delete(l.components, component)
+}
+
+// Components returns the levels of the components that have one, by component.
+func (l *Levels) Components() map[string]slog.Level {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	levels := make(map[string]slog.Level, len(l.components))
+	for component, level := range l.components {
+		levels[component] = level
+	}
+	return levels
+}
+
+// Of returns the level a component logs at.
+func (l *Levels) Of(component string) slog.Level {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	if level, ok := l.components[component]; ok {
+		return level
+	}
+	return l.def
+}
+
+// ParseLevel parses a level name ("debug", "info", "warn" or "error", optionally with an
+// offset such as "info+2"), in any case.
+func ParseLevel(s string) (slog.Level, error) {
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(strings.TrimSpace(s))); err != nil {
+		return 0, fmt.Errorf("invalid log level %q: use debug, info, warn or error", s)
+	}
+	return level, nil
+}
+
+// ParseComponentLevels parses component levels such as "websocket-hub=warn,sandbox-manager=debug".
+func ParseComponentLevels(s string) (map[string]slog.Level, error) {
+	levels := make(map[string]slog.Level)
+	for _, entry := range strings.Split(s, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		component, name, ok := strings.Cut(entry, "=")
+		component = strings.TrimSpace(component)
+		if !ok || component == "" {
+			return nil, fmt.Errorf("invalid component log level %q: use component=level", entry)
+		}
+		level, err := ParseLevel(name)
+		if err != nil {
+			return nil, err
+		}
+		levels[component] = level
+	}
+	return levels, nil
+}
+
+// New returns a logger writing to w in format (FormatJSON if empty) at levels.
+func New(w io.Writer, format string, levels *Levels) (*slog.Logger, error) {
+	// The inner handler logs everything; Handler.Enabled applies the levels
+	opts := &slog.HandlerOptions{Level: slog.Level(math.MinInt)}
+	var inner slog.Handler
+	switch format {
+	case "", FormatJSON:
+		inner = slog.NewJSONHandler(w, opts)
+	case FormatText:
+		inner = slog.NewTextHandler(w, opts)
+	default:
+		return nil, fmt.Errorf("invalid log format %q: use %s or %s", format, FormatJSON, FormatText)
+	}
+	return slog.New(NewHandler(inner, levels)), nil
+}
+
+// Handler filters the records of an inner handler by the level of their component.
+type Handler struct {
+	inner     slog.Handler
+	levels    *Levels
+	component string // Set by the last "component" attribute added with WithAttrs
+}
+
+// NewHandler filters the records of inner, which should log every level, by levels.
+func NewHandler(inner slog.Handler, levels *Levels) *Handler {
+	return &Handler{inner: inner, levels: levels}
+}
+
+func (h *Handler) Enabled(ctx context.Context, level slog.Level) bool {
+	return level >= h.levels.Of(h.component)
+}
+
+func (h *Handler) Handle(ctx context.Context, r slog.Record) error {
+	return h.inner.Handle(ctx, r)
+}
+
+func (h *Handler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	component := h.component
+	for _, attr := range attrs {
+		if attr.Key == ComponentKey {
+			component = attr.Value.String()
+		}
+	}
+	return &Handler{inner: h.inner.WithAttrs(attrs), levels: h.levels, component: component}
+}
+
+func (h *Handler) WithGroup(name string) slog.Handler {
+	return &Handler{inner: h.inner.WithGroup(name), levels: h.levels, component: h.component}
+}
+
+// LevelName returns the name of a level, as ParseLevel reads it.
+func LevelName(level slog.Level) string {
+	return strings.ToLower(level.String())
+}
+
+// WithRedaction returns a logger that passes the message and the string, error and
+// stringer attributes of its records through redact before logger handles them.
+func WithRedaction(logger *slog.Logger, redact func(string) string) *slog.Logger {
+	return slog.New(&redactHandler{inner: logger.Handler(), redact: redact})
+}
+
+// redactHandler redacts records before an inner handler handles them.
+type redactHandler struct {
+	inner  slog.Handler
+	redact func(string) string
+}
+
+func (h *redactHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return h.inner.Enabled(ctx, level)
+}
+
+func (h *redactHandler) Handle(ctx context.Context, r slog.Record) error {
+	redacted := slog.NewRecord(r.Time, r.Level, h.redact(r.Message), r.PC)
+	r.Attrs(func(attr slog.Attr) bool {
+		redacted.AddAttrs(h.redactAttr(attr))
+		return true
+	})
+	return h.inner.Handle(ctx, redacted)
+}
+
+func (h *redactHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	redacted := make([]slog.Attr, len(attrs))
+	for i, attr := range attrs {
+		redacted[i] = h.redactAttr(attr)
+	}
+	return &redactHandler{inner: h.inner.WithAttrs(redacted), redact: h.redact}
+}
+
+func (h *redactHandler) WithGroup(name string) slog.Handler {
+	return &redactHandler{inner: h.inner.WithGroup(name), redact: h.redact}
+}
+
+// redactAttr redacts the strings of an attribute, and of the attributes of a group.
+func (h *redactHandler) redactAttr(attr slog.Attr) slog.Attr {
+	value := attr.Value.Resolve()
+	switch value.Kind() {
+	case slog.KindString:
+		return slog.String(attr.Key, h.redact(value.String()))
+	case slog.KindGroup:
+		group := value.Group()
+		redacted := make([]any, len(group))
+		for i, a := range group {
+			redacted[i] = h.redactAttr(a)
+		}
+		return slog.Group(attr.Key, redacted...)
+	case slog.KindAny:
+		switch v := value.Any().(type) {
+		case error:
+			return slog.String(attr.Key, h.redact(v.Error()))
+		case fmt.Stringer:
+			return slog.String(attr.Key, h.redact(v.String()))
+		case []byte:
+			return slog.String(attr.Key, h.redact(string(v)))
+		}
+	}
+	return slog.Attr{Key: attr.Key, Value: value}
+}
@@ -0,0 +1,76 @@
+package logging
+
+import (
+	"bytes"
+	"errors"
+	"log/slog"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestHandler_componentLevels(t *testing.T) {
+	var out bytes.Buffer
+	levels := NewLevels(slog.LevelInfo)
+	logger, err := New(&out, FormatText, levels)
+	require.NoError(t, err)
+	hub := logger.With(ComponentKey, "websocket-hub")
+	manager := logger.With(ComponentKey, "sandbox-manager")
+
+	hub.Debug("hub debug")
+	manager.Info("manager info")
+	require.NotContains(t, out.String(), "hub debug")
+	require.Contains(t, out.String(), "manager info")
+
+	// Changes apply to existing loggers
+	levels.Set("websocket-hub", slog.LevelDebug)
+	levels.Set("sandbox-manager", slog.LevelWarn)
+	out.Reset()
+	hub.Debug("hub debug")
+	manager.Info("manager info")
+	require.Contains(t, out.String(), "hub debug")
+	require.NotContains(t, out.String(), "manager info")
+
+	levels.Reset("sandbox-manager")
+	levels.SetDefault(slog.LevelError)
+	out.Reset()
+	manager.Warn("manager warn")
+	logger.Error("root error")
+	require.NotContains(t, out.String(), "manager warn")
+	require.Contains(t, out.String(), "root error")
+}
+
+func TestParseComponentLevels(t *testing.T) {
+	levels, err := ParseComponentLevels(" websocket-hub=WARN, sandbox-manager=debug ,")
+	require.NoError(t, err)
+	require.Equal(t, map[string]slog.Level{"websocket-hub": slog.LevelWarn, "sandbox-manager": slog.LevelDebug}, levels)
+
+	for _, invalid := range []string{"websocket-hub", "=info", "websocket-hub=loud"} {
+		_, err := ParseComponentLevels(invalid)
+		require.Error(t, err, invalid)
+	}
+}
+
+func TestNew_format(t *testing.T) {
+	var out bytes.Buffer
+	logger, err := New(&out, "", NewLevels(slog.LevelInfo))
+	require.NoError(t, err)
+	logger.Info("hello")
+	require.True(t, strings.HasPrefix(out.String(), "{"), out.String())
+
+	_, err = New(&out, "xml", NewLevels(slog.LevelInfo))
+	require.Error(t, err)
+}
+
+func TestWithRedaction(t *testing.T) {
+	var out bytes.Buffer
+	logger, err := New(&out, FormatText, NewLevels(slog.LevelInfo))
+	require.NoError(t, err)
+	logger = WithRedaction(logger, func(s string) string { return strings.ReplaceAll(s, "hunter22", "[REDACTED]") })
+
+	logger.With("token", "hunter22").Info("password hunter22", "body", []byte("x=hunter22"),
+		"error", errors.New("bad hunter22"), slog.Group("request", "auth", "hunter22"))
+	require.NotContains(t, out.String(), "hunter22")
+	require.Equal(t, 5, strings.Count(out.String(), "[REDACTED]"), out.String())
+}
@@ -2,6 +2,7 @@ package main
 
 import (
 	"context"
+	"crypto/rand"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -11,16 +12,27 @@ import (
 	"net/http"
 	"os"
 	"os/signal"
+	"path/filepath"
+	"runtime"
+	"strconv"
 	"strings"
 	"syscall"
 	"time"
 
 	"github.com/docker/docker/client" // Docker client
-	"github.com/gorilla/mux"          // HTTP router
+	units "github.com/docker/go-units"
 
 	// Local packages (adjust paths if necessary)
-	"github.com/foreveryh/sandboxai/go/mentisruntime/handler"
+	"github.com/foreveryh/sandboxai/go/mentisruntime/artifact"
+	"github.com/foreveryh/sandboxai/go/mentisruntime/dockerenv"
+	"github.com/foreveryh/sandboxai/go/mentisruntime/fake"
+	"github.com/foreveryh/sandboxai/go/mentisruntime/history"
+	"github.com/foreveryh/sandboxai/go/mentisruntime/logging"
 	"github.com/foreveryh/sandboxai/go/mentisruntime/manager"
+	"github.com/foreveryh/sandboxai/go/mentisruntime/redact"
+	"github.com/foreveryh/sandboxai/go/mentisruntime/sandboxlog"
+	"github.com/foreveryh/sandboxai/go/mentisruntime/secret"
+	"github.com/foreveryh/sandboxai/go/mentisruntime/server"
 	"github.com/foreveryh/sandboxai/go/mentisruntime/ws"
 
 	// Specific client for cleanup, separate from the manager's client
@@ -45,83 +57,417 @@ func main() {
 	if val, ok := os.LookupEnv("SANDBOXAID_DELETE_ON_SHUTDOWN"); ok {
 		deleteOnShutdown = strings.ToLower(strings.TrimSpace(val)) == "true"
 	}
+	dataDir, ok := os.LookupEnv("SANDBOXAID_DATA_DIR")
+	if !ok {
+		dataDir = "sandboxai-data"
+	}
+	publicURL, ok := os.LookupEnv("SANDBOXAID_PUBLIC_URL")
+	if !ok {
+		publicURL = fmt.Sprintf("http://%s:%s", host, port)
+	}
 
 	// --- Logger --- 
-	logger := slog.New(slog.NewJSONHandler(os.Stderr, &slog.HandlerOptions{Level: slog.LevelDebug}))
+	// Level of every component (SANDBOXAID_LOG_LEVEL, default info), levels of single components
+	// (SANDBOXAID_LOG_LEVELS, e.g. "websocket-hub=warn,sandbox-manager=debug"), and JSON or text
+	// output (SANDBOXAID_LOG_FORMAT); levels can be changed at runtime under /v1/admin/log-levels
+	logLevels, err := newLogLevels()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Invalid log settings:", err)
+		os.Exit(1)
+	}
+	logger, err := logging.New(os.Stderr, os.Getenv("SANDBOXAID_LOG_FORMAT"), logLevels)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Invalid log settings:", err)
+		os.Exit(1)
+	}
+	// Credentials are masked in logs and observations unless SANDBOXAID_REDACT=false; patterns
+	// in SANDBOXAID_REDACT_PATTERNS_FILE, one per line, are masked too
+	redactor, err := newRedactor()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Invalid redaction settings:", err)
+		os.Exit(1)
+	}
+	if redactor != nil {
+		logger = logging.WithRedaction(logger, redactor.String)
+	}
 	slog.SetDefault(logger)
 
 	// --- Initialize Managers ---
-	// Create Docker client
-	dockerClient, err := client.NewClientWithOpts(client.FromEnv, client.WithAPIVersionNegotiation())
+	// Create Docker client, for the local Docker or the in-memory fake backend (SANDBOXAID_BACKEND=fake)
+	backend := os.Getenv("SANDBOXAID_BACKEND")
+	var fakeDocker *fake.Docker
+	var dockerClient *client.Client
+	var dockerPreset dockerenv.Preset // Local container runtime serving the Docker API
+	switch backend {
+	case "", "docker":
+		dockerClient, dockerPreset, err = connectDocker(context.Background())
+	case "fake":
+		var shell fake.Shell
+		if scriptPath := os.Getenv("SANDBOXAID_FAKE_SCRIPT"); scriptPath != "" {
+			if shell, err = fake.LoadScript(scriptPath); err != nil {
+				logger.Error("Failed to load fake backend script", "path", scriptPath, "error", err)
+				os.Exit(1)
+			}
+		}
+		fakeDocker = fake.NewDocker(shell)
+		defer fakeDocker.Close()
+		dockerClient, err = fakeDocker.Client()
+		logger.Warn("Using the fake backend: sandboxes are simulated and run no commands")
+	default:
+		logger.Error("Invalid SANDBOXAID_BACKEND", "value", backend)
+		os.Exit(1)
+	}
 	if err != nil {
 		logger.Error("Failed to create Docker client", "error", err)
 		os.Exit(1)
 	}
-	logger.Info("Docker client initialized")
+	logger.Info("Docker client initialized", "runtime", dockerPreset.Runtime)
 	
 	// Create WebSocket hub
-	hub := ws.NewHub(logger)
-	go hub.Run()
-	logger.Info("WebSocket hub started")
+	wsConfig := ws.Config{
+		WriteWait:      envDuration("SANDBOXAID_WS_WRITE_WAIT", 0),
+		PongWait:       envDuration("SANDBOXAID_WS_PONG_WAIT", 0),
+		SendBuffer:     envInt("SANDBOXAID_WS_SEND_BUFFER", 0),
+		MaxMessageSize: envBytes("SANDBOXAID_WS_MAX_MESSAGE_BYTES", 0),
+		Compression:    envBool("SANDBOXAID_WS_COMPRESSION", false),
+	}
+	if err := wsConfig.Validate(); err != nil {
+		logger.Error("Invalid WebSocket settings", "error", err)
+		os.Exit(1)
+	}
 
-	// Create Space Manager first
-	spaceManager := manager.NewSpaceManager(logger)
-	logger.Info("Space manager initialized")
-	
-	// Create Sandbox Manager (depends on Space Manager)
-	sandboxManager, err := manager.NewSandboxManager(
-		context.Background(),
-		dockerClient,
-		hub,
-		spaceManager, // Add SpaceManager parameter
-		logger,
-		os.Getenv("SANDBOX_SCOPE"),
-	)
+	// Optional manager features
+	var managerOpts []manager.Option
+	if redactor != nil {
+		managerOpts = append(managerOpts, manager.WithRedactor(redactor))
+	}
+
+	// Container OS and host architecture of the sandboxes, asked of the Docker daemon unless
+	// SANDBOXAID_CONTAINER_OS and SANDBOXAID_CONTAINER_ARCH are set
+	platform := manager.Platform{
+		OS:          os.Getenv("SANDBOXAID_CONTAINER_OS"),
+		Arch:        os.Getenv("SANDBOXAID_CONTAINER_ARCH"),
+		RuntimeHost: os.Getenv("SANDBOXAID_RUNTIME_HOST"),
+	}
+	if fakeDocker == nil && (platform.OS == "" || platform.Arch == "") {
+		detected := manager.DetectPlatform(context.Background(), dockerClient)
+		if platform.OS == "" {
+			platform.OS = detected.OS
+		}
+		if platform.Arch == "" {
+			platform.Arch = detected.Arch
+		}
+	}
+	switch platform.OS {
+	case "":
+		platform.OS = manager.PlatformLinux
+	case manager.PlatformLinux, manager.PlatformWindows:
+	default:
+		logger.Error("Invalid SANDBOXAID_CONTAINER_OS", "value", platform.OS)
+		os.Exit(1)
+	}
+	// Linux sandboxes call back through the host name of the local runtime's preset, unless
+	// SANDBOXAID_RUNTIME_HOST says otherwise
+	if platform.RuntimeHost == "" && platform.OS == manager.PlatformLinux && fakeDocker == nil {
+		platform.RuntimeHost = dockerPreset.CallbackHost
+		platform.RuntimeHostGateway = dockerPreset.HostGateway
+		if err := dockerPreset.CheckListenHost(host); err != nil {
+			logger.Error("Sandboxes cannot reach the runtime", "error", err)
+			os.Exit(1)
+		}
+	}
+	managerOpts = append(managerOpts, manager.WithPlatform(platform))
+	logger.Info("Container platform", "os", platform.OS, "arch", platform.Arch)
+
+	// Artifact store (disabled unless SANDBOXAID_ARTIFACT_STORE is set)
+	artifactStore, artifactDownloads, err := newArtifactStore(dataDir, publicURL)
 	if err != nil {
-		logger.Error("Failed to create sandbox manager", "error", err)
+		logger.Error("Failed to configure artifact store", "error", err)
+		os.Exit(1)
+	}
+	if artifactStore != nil {
+		managerOpts = append(managerOpts, manager.WithArtifactStore(artifactStore, envDuration("SANDBOXAID_ARTIFACT_URL_TTL", time.Hour)))
+		logger.Info("Artifact store configured", "type", os.Getenv("SANDBOXAID_ARTIFACT_STORE"))
+	}
+
+	// Secret store (disabled unless a master key is configured)
+	if masterKey, ok := os.LookupEnv("SANDBOXAID_MASTER_KEY"); ok {
+		key, err := secret.ParseMasterKey(masterKey)
+		if err != nil {
+			logger.Error("Invalid SANDBOXAID_MASTER_KEY", "error", err)
+			os.Exit(1)
+		}
+		secretStore, err := secret.NewStore(key, filepath.Join(dataDir, "secrets.json"))
+		if err != nil {
+			logger.Error("Failed to open secret store", "error", err)
+			os.Exit(1)
+		}
+		managerOpts = append(managerOpts, manager.WithSecretStore(secretStore))
+		logger.Info("Secret store configured")
+	}
+
+	// Security profile applied to sandboxes that don't request one ("default" or "hardened")
+	if profile, ok := os.LookupEnv("SANDBOXAID_SECURITY_PROFILE"); ok {
+		managerOpts = append(managerOpts, manager.WithDefaultSecurityProfile(profile))
+	}
+	if seccompPath, ok := os.LookupEnv("SANDBOXAID_SECCOMP_PROFILE"); ok {
+		seccompJSON, err := os.ReadFile(seccompPath)
+		if err != nil {
+			logger.Error("Failed to read seccomp profile", "path", seccompPath, "error", err)
+			os.Exit(1)
+		}
+		managerOpts = append(managerOpts, manager.WithSeccompProfile(string(seccompJSON)))
+	}
+	// Seccomp and AppArmor profiles sandboxes can choose, besides those shipped with the runtime
+	if dir := os.Getenv("SANDBOXAID_SECCOMP_PROFILE_DIR"); dir != "" {
+		paths, err := filepath.Glob(filepath.Join(dir, "*.json"))
+		if err != nil {
+			logger.Error("Invalid SANDBOXAID_SECCOMP_PROFILE_DIR", "value", dir, "error", err)
+			os.Exit(1)
+		}
+		profiles := make(map[string]string, len(paths))
+		for _, path := range paths {
+			profileJSON, err := os.ReadFile(path)
+			if err != nil || !json.Valid(profileJSON) {
+				logger.Error("Failed to read seccomp profile", "path", path, "error", err)
+				os.Exit(1)
+			}
+			profiles[strings.TrimSuffix(filepath.Base(path), ".json")] = string(profileJSON)
+		}
+		managerOpts = append(managerOpts, manager.WithSeccompProfiles(profiles))
+		logger.Info("Seccomp profiles loaded", "dir", dir, "count", len(profiles))
+	}
+	if name := os.Getenv("SANDBOXAID_DEFAULT_SECCOMP_PROFILE"); name != "" {
+		managerOpts = append(managerOpts, manager.WithDefaultSeccompProfile(name))
+	}
+	if names := os.Getenv("SANDBOXAID_APPARMOR_PROFILES"); names != "" {
+		managerOpts = append(managerOpts, manager.WithAppArmorProfiles(strings.Split(names, ",")...))
+	}
+
+	// Disk usage monitor (disabled unless an interval is set)
+	if interval := envDuration("SANDBOXAID_DISK_CHECK_INTERVAL", 0); interval > 0 {
+		var killThreshold int64
+		if threshold := os.Getenv("SANDBOXAID_DISK_KILL_THRESHOLD"); threshold != "" {
+			killThreshold, err = units.RAMInBytes(threshold)
+			if err != nil {
+				logger.Error("Invalid SANDBOXAID_DISK_KILL_THRESHOLD", "value", threshold, "error", err)
+				os.Exit(1)
+			}
+		}
+		managerOpts = append(managerOpts, manager.WithDiskMonitor(interval, killThreshold))
+	}
+
+	// Agent health monitor (disabled unless an interval is set)
+	if interval := envDuration("SANDBOXAID_HEALTH_CHECK_INTERVAL", 0); interval > 0 {
+		switch policy := os.Getenv("SANDBOXAID_HEALTH_RECOVERY_POLICY"); policy {
+		case "", manager.RecoveryPolicyNone, manager.RecoveryPolicyRestart:
+		default:
+			logger.Error("Invalid SANDBOXAID_HEALTH_RECOVERY_POLICY", "value", policy)
+			os.Exit(1)
+		}
+		managerOpts = append(managerOpts, manager.WithHealthMonitor(manager.HealthConfig{
+			Interval:         interval,
+			FailureThreshold: envInt("SANDBOXAID_HEALTH_FAILURE_THRESHOLD", 3),
+			RecoveryPolicy:   os.Getenv("SANDBOXAID_HEALTH_RECOVERY_POLICY"),
+			MaxRestarts:      envInt("SANDBOXAID_HEALTH_MAX_RESTARTS", 3),
+		}))
+	}
+
+	// State reconciliation with Docker (SANDBOXAID_RECONCILE_INTERVAL=0 disables it)
+	if interval := envDuration("SANDBOXAID_RECONCILE_INTERVAL", time.Minute); interval > 0 {
+		policy := os.Getenv("SANDBOXAID_ORPHAN_POLICY")
+		switch policy {
+		case "", manager.OrphanPolicyAdopt, manager.OrphanPolicyRemove, manager.OrphanPolicyIgnore:
+		default:
+			logger.Error("Invalid SANDBOXAID_ORPHAN_POLICY", "value", policy)
+			os.Exit(1)
+		}
+		managerOpts = append(managerOpts, manager.WithReconciler(interval, policy))
+	}
+
+	// Images pulled at startup and every SANDBOXAID_PREWARM_INTERVAL, so creation never waits on them;
+	// SANDBOXAID_PREWARM_FILE is read again on SIGHUP
+	prewarmFile := os.Getenv("SANDBOXAID_PREWARM_FILE")
+	if prewarmImages, err := readPrewarmImages(prewarmFile); err != nil {
+		logger.Error("Failed to read pre-warmed images", "path", prewarmFile, "error", err)
 		os.Exit(1)
+	} else if len(prewarmImages) > 0 || prewarmFile != "" {
+		managerOpts = append(managerOpts, manager.WithImagePrewarm(prewarmImages, envDuration("SANDBOXAID_PREWARM_INTERVAL", 6*time.Hour)))
 	}
-	logger.Info("Sandbox manager initialized")
 
-	// --- Initialize API Handler ---
-	apiHandler := handler.NewAPIHandler(logger, sandboxManager, spaceManager, hub)
-	logger.Info("API handler initialized")
+	// Scheduled garbage collection of orphaned containers, volumes and networks
+	if interval := envDuration("SANDBOXAID_GC_INTERVAL", 0); interval > 0 {
+		managerOpts = append(managerOpts, manager.WithGarbageCollection(interval))
+	}
 
-	// --- Router --- 
-	router := mux.NewRouter()
+	// Docker network per space, where sibling sandboxes reach each other by sandbox ID (SANDBOXAID_SPACE_NETWORKS=false disables it)
+	if envBool("SANDBOXAID_SPACE_NETWORKS", true) {
+		managerOpts = append(managerOpts, manager.WithSpaceNetworks())
+	}
+
+	// Periodic status observations on sandbox streams (disabled unless set)
+	if interval := envDuration("SANDBOXAID_STATUS_INTERVAL", 0); interval > 0 {
+		managerOpts = append(managerOpts, manager.WithStatusHeartbeat(interval))
+	}
+
+	// CPU, memory and running time accounting per sandbox, for /v1/usage (disabled unless set)
+	if interval := envDuration("SANDBOXAID_USAGE_INTERVAL", 0); interval > 0 {
+		managerOpts = append(managerOpts, manager.WithUsageAccounting(interval))
+	}
+	// Prices of usage in cost units, for budgets with max_cost_units
+	managerOpts = append(managerOpts, manager.WithCostRates(manager.CostRates{
+		CPUHour:     envFloat("SANDBOXAID_COST_CPU_HOUR", 0),
+		GBHour:      envFloat("SANDBOXAID_COST_GB_HOUR", 0),
+		RuntimeHour: envFloat("SANDBOXAID_COST_RUNTIME_HOUR", 0),
+	}))
+
+	// Soft limits on host load past which new actions are held back (disabled unless a limit is set)
+	pressureLimits := manager.PressureLimits{
+		Interval:      envDuration("SANDBOXAID_PRESSURE_INTERVAL", 5*time.Second),
+		MaxLoadPerCPU: envFloat("SANDBOXAID_PRESSURE_MAX_LOAD_PER_CPU", 0),
+		MinFreeMemory: envFloat("SANDBOXAID_PRESSURE_MIN_FREE_MEMORY", 0),
+		MaxDelay:      envDuration("SANDBOXAID_PRESSURE_MAX_DELAY", time.Minute),
+	}
+	if pressureLimits.MaxLoadPerCPU > 0 || pressureLimits.MinFreeMemory > 0 {
+		managerOpts = append(managerOpts, manager.WithHostPressureLimits(pressureLimits))
+	}
+
+	// Reconnection to the Docker daemon once it stops answering, e.g. while it restarts ("0" disables the check)
+	newDockerClient := func() (*client.Client, error) {
+		return client.NewClientWithOpts(client.FromEnv, client.WithAPIVersionNegotiation())
+	}
+	if fakeDocker != nil {
+		newDockerClient = fakeDocker.Client
+	}
+	managerOpts = append(managerOpts, manager.WithDockerReconnect(manager.DockerReconnect{
+		Interval:     envDuration("SANDBOXAID_DOCKER_CHECK_INTERVAL", 5*time.Second),
+		QueueTimeout: envDuration("SANDBOXAID_DOCKER_QUEUE_TIMEOUT", 30*time.Second),
+		NewClient:    newDockerClient,
+	}))
+
+	// Running actions allowed per sandbox; more are rejected with 429 ("0" disables the limit)
+	managerOpts = append(managerOpts, manager.WithMaxConcurrentActions(envInt("SANDBOXAID_MAX_CONCURRENT_ACTIONS", 64)))
+
+	// Worker pools for actions, observation processing and Docker operations ("0" keeps a default)
+	managerOpts = append(managerOpts, manager.WithWorkerPools(manager.PoolSizes{
+		Actions:      envInt("SANDBOXAID_ACTION_WORKERS", 0),
+		Observations: envInt("SANDBOXAID_OBSERVATION_WORKERS", 0),
+		Docker:       envInt("SANDBOXAID_DOCKER_WORKERS", 0),
+		Queue:        envInt("SANDBOXAID_WORKER_QUEUE", 0),
+	}))
 
-	// Register handlers
-	api := router.PathPrefix("/v1").Subrouter()
-	api.HandleFunc("/health", handler.HealthCheckHandler).Methods("GET")
+	// Graceful agent shutdown before a sandbox container is stopped ("0" stops it straight away)
+	managerOpts = append(managerOpts, manager.WithShutdownTimeout(envDuration("SANDBOXAID_SHUTDOWN_TIMEOUT", 10*time.Second)))
 
-	// Space routes (using chi style params)
-	api.HandleFunc("/spaces", apiHandler.CreateSpaceHandler).Methods("POST")
-	api.HandleFunc("/spaces", apiHandler.ListSpacesHandler).Methods("GET")
-	api.HandleFunc("/spaces/{spaceID}", apiHandler.GetSpaceHandler).Methods("GET")
-	api.HandleFunc("/spaces/{spaceID}", apiHandler.UpdateSpaceHandler).Methods("PUT")
-	api.HandleFunc("/spaces/{spaceID}", apiHandler.DeleteSpaceHandler).Methods("DELETE")
+	// Stream output caps ("0" disables a cap); full output of truncated actions goes to the artifact store
+	managerOpts = append(managerOpts, manager.WithOutputLimits(manager.OutputLimits{
+		MaxLineBytes:   int(envBytes("SANDBOXAID_MAX_LINE_BYTES", 256<<10)),
+		MaxActionBytes: envBytes("SANDBOXAID_MAX_ACTION_OUTPUT_BYTES", 16<<20),
+	}))
 
-	// Sandbox routes (associated with a space, using chi style params)
-	api.HandleFunc("/spaces/{spaceID}/sandboxes", apiHandler.CreateSandboxHandler).Methods("POST")
-	api.HandleFunc("/spaces/{spaceID}/sandboxes/{sandboxID}", apiHandler.GetSandboxHandler).Methods("GET")    // Added GET sandbox
-	api.HandleFunc("/spaces/{spaceID}/sandboxes/{sandboxID}", apiHandler.DeleteSandboxHandler).Methods("DELETE") // Corrected DELETE sandbox path
+	// Default coalescing of stream lines into batched observations (unset disables it; actions may override)
+	managerOpts = append(managerOpts, manager.WithStreamCoalescing(manager.CoalescePolicy{
+		Window:   envDuration("SANDBOXAID_COALESCE_WINDOW", 0),
+		MaxBytes: int(envBytes("SANDBOXAID_COALESCE_BYTES", 0)),
+	}))
 
-	// Action routes (associated with a specific sandbox)
-	api.HandleFunc("/spaces/{spaceID}/sandboxes/{sandboxID}/tools:run_shell_command", apiHandler.PostShellCommandHandler).Methods("POST") // Corrected shell path
-	api.HandleFunc("/spaces/{spaceID}/sandboxes/{sandboxID}/tools:run_ipython_cell", apiHandler.PostIPythonCellHandler).Methods("POST") // Corrected ipython path
+	// Results kept for actions run with "cache": true ("0" disables caching)
+	managerOpts = append(managerOpts, manager.WithResultCache(envBytes("SANDBOXAID_RESULT_CACHE_BYTES", 64<<20)))
+
+	// Encoding agents push observations in ("json" or "msgpack"; unset leaves the agent default)
+	switch encoding := os.Getenv("SANDBOXAID_AGENT_ENCODING"); encoding {
+	case "":
+	case manager.AgentEncodingJSON, manager.AgentEncodingMsgpack:
+		managerOpts = append(managerOpts, manager.WithAgentEncoding(encoding))
+	default:
+		logger.Error("Invalid SANDBOXAID_AGENT_ENCODING", "value", encoding)
+		os.Exit(1)
+	}
+
+	// Observation history, persisted under the data dir (SANDBOXAID_OBSERVATION_HISTORY=false disables it)
+	if envBool("SANDBOXAID_OBSERVATION_HISTORY", true) {
+		historyStore, err := history.NewStore(filepath.Join(dataDir, "observations"), envInt("SANDBOXAID_OBSERVATION_RETENTION", history.DefaultRetention))
+		if err != nil {
+			logger.Error("Failed to open observation history", "error", err)
+			os.Exit(1)
+		}
+		defer historyStore.Close()
+		managerOpts = append(managerOpts, manager.WithObservationHistory(historyStore))
+
+		// Envelope encryption of the persisted history, with a key per space wrapped by the
+		// master key (SANDBOXAID_OBSERVATION_ENCRYPTION=true)
+		if envBool("SANDBOXAID_OBSERVATION_ENCRYPTION", false) {
+			key, err := secret.ParseMasterKey(os.Getenv("SANDBOXAID_MASTER_KEY"))
+			if err != nil {
+				logger.Error("Observation encryption needs a valid SANDBOXAID_MASTER_KEY", "error", err)
+				os.Exit(1)
+			}
+			keyring, err := secret.NewKeyring(key, filepath.Join(dataDir, "observation-keys.json"))
+			if err != nil {
+				logger.Error("Failed to open observation keyring", "error", err)
+				os.Exit(1)
+			}
+			managerOpts = append(managerOpts, manager.WithObservationEncryption(keyring))
+			logger.Info("Observation history encryption enabled")
+		}
+	}
 
-	// Internal Observation Route
-	api.HandleFunc("/internal/observations/{sandboxID}", apiHandler.InternalObservationHandler).Methods("POST") // Changed to sandboxID
+	// Per-sandbox log files of container output and observations (disabled unless SANDBOXAID_SANDBOX_LOGS=true)
+	if envBool("SANDBOXAID_SANDBOX_LOGS", false) {
+		logStore, err := sandboxlog.NewStore(filepath.Join(dataDir, "logs"), sandboxlog.Config{
+			MaxBytes:  envBytes("SANDBOXAID_SANDBOX_LOG_MAX_BYTES", sandboxlog.DefaultMaxBytes),
+			MaxFiles:  envInt("SANDBOXAID_SANDBOX_LOG_MAX_FILES", sandboxlog.DefaultMaxFiles),
+			Retention: envDuration("SANDBOXAID_SANDBOX_LOG_RETENTION", sandboxlog.DefaultRetention),
+		})
+		if err != nil {
+			logger.Error("Failed to open sandbox log store", "error", err)
+			os.Exit(1)
+		}
+		managerOpts = append(managerOpts, manager.WithSandboxLogs(logStore))
+	}
 
-	// WebSocket Route (associated with a specific sandbox)
-	router.HandleFunc("/v1/sandboxes/{sandboxID}/stream", func(w http.ResponseWriter, r *http.Request) { // Changed to sandboxID
-		// Assuming ServeWs signature: hub, checker, w, r, logger
-		// Pass sandboxManager as it implements the SandboxChecker interface
-		ws.ServeWs(hub, sandboxManager, w, r, logger)
+	// --- Server ---
+	// The managers, hub and router, as programs embedding the runtime compose them
+	srv, err := server.NewServer(server.Config{
+		Docker:            dockerClient,
+		Logger:            logger,
+		Scope:             scope, // Must match the scope used for cleanup so labels line up
+		ManagerOptions:    managerOpts,
+		WebSocket:         wsConfig,
+		DataDir:           dataDir,
+		AdminToken:        os.Getenv("SANDBOXAID_ADMIN_TOKEN"),
+		TenantHeader:      os.Getenv("SANDBOXAID_TENANT_HEADER"),
+		LogLevels:         logLevels,
+		Gzip:              envBool("SANDBOXAID_HTTP_GZIP", true),
+		UI:                envBool("SANDBOXAID_UI", true),
+		V1Sunset:          envDate("SANDBOXAID_V1_SUNSET"), // Sunset date (YYYY-MM-DD) of deprecated version 1 routes
+		ArtifactDownloads: artifactDownloads,
 	})
+	if err != nil {
+		logger.Error("Failed to create server", "error", err)
+		os.Exit(1)
+	}
+	logger.Info("Sandbox manager and WebSocket hub started")
+
+	// Reload the pre-warmed images on SIGHUP
+	if prewarmFile != "" {
+		reloadChan := make(chan os.Signal, 1)
+		signal.Notify(reloadChan, syscall.SIGHUP)
+		go func() {
+			for range reloadChan {
+				images, err := readPrewarmImages(prewarmFile)
+				if err != nil {
+					logger.Error("Failed to reload pre-warmed images", "path", prewarmFile, "error", err)
+					continue
+				}
+				srv.Manager.SetPrewarmImages(images)
+			}
+		}()
+	}
 
 	// --- Cleanup Logic (using separate, original client) --- 
-	if deleteOnShutdown {
+	// Fake sandboxes go away with the process
+	if deleteOnShutdown && fakeDocker == nil {
 		defer func() {
 			logger.Info("Cleanup: Ensuring all sandboxes are deleted")
 			// Use the original docker client specifically for cleanup as manager might not expose ListAll
@@ -157,19 +503,23 @@ func main() {
 	}
 
 	// --- HTTP Server --- 
-	server := &http.Server{
+	httpServer := &http.Server{
 		Addr:    fmt.Sprintf("%s:%s", host, port),
-		Handler: router, // Use the mux router
+		Handler: srv,
 	}
 
 	// --- Start Server Goroutine --- 
 	go func() {
-		ln, err := net.Listen("tcp", server.Addr)
+		ln, err := net.Listen("tcp", httpServer.Addr)
 		if err != nil {
-			logger.Error("Failed to listen", "address", server.Addr, "error", err)
+			logger.Error("Failed to listen", "address", httpServer.Addr, "error", err)
 			os.Exit(1)
 		}
 		addr := ln.Addr().(*net.TCPAddr)
+		if fakeDocker != nil {
+			// Fake agents run in this process and reach it directly, not via host.docker.internal
+			fakeDocker.SetRuntimeURL("http://" + ln.Addr().String())
+		}
 		if port == "0" {
 			// If "any free port" was specified, output the selected port.
 			if err := json.NewEncoder(os.Stdout).Encode(serverInfo{Host: addr.IP.String(), Port: addr.Port}); err != nil {
@@ -178,7 +528,7 @@ func main() {
 			}
 		}
 		logger.Info("Listening and starting HTTP server", "address", addr.String())
-		if err := server.Serve(ln); !errors.Is(err, http.ErrServerClosed) {
+		if err := httpServer.Serve(ln); !errors.Is(err, http.ErrServerClosed) {
 			logger.Error("HTTP server error", "error", err)
 			os.Exit(1)
 		}
@@ -196,10 +546,13 @@ func main() {
 
 	logger.Info("Received signal, shutting down", "signal", sig.String(), "grace_period", gracePeriod)
 
-	if err := server.Shutdown(shutdownCtx); err != nil {
+	if err := httpServer.Shutdown(shutdownCtx); err != nil {
 		logger.Error("Error shutting down HTTP server", "error", err)
 		os.Exit(1) // Exit with error on shutdown failure
 	}
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		logger.Warn("Timed out stopping the sandbox manager and WebSocket hub", "error", err)
+	}
 	logger.Info("Graceful shutdown complete")
 }
 
@@ -209,3 +562,245 @@ type serverInfo struct {
 	Host string `json:"host"`
 	Port int    `json:"port"`
 }
+
+// newArtifactStore builds the artifact store selected by SANDBOXAID_ARTIFACT_STORE ("local", "s3" or "gcs").
+// For the local store it also returns the handler serving signed download URLs.
+func newArtifactStore(dataDir, publicURL string) (artifact.Store, http.Handler, error) {
+	switch kind := os.Getenv("SANDBOXAID_ARTIFACT_STORE"); kind {
+	case "":
+		return nil, nil, nil
+	case "local":
+		dir, ok := os.LookupEnv("SANDBOXAID_ARTIFACT_DIR")
+		if !ok {
+			dir = filepath.Join(dataDir, "artifacts")
+		}
+		signingKey := []byte(os.Getenv("SANDBOXAID_ARTIFACT_SIGNING_KEY"))
+		if len(signingKey) == 0 {
+			// Without a configured key, download URLs stop working after a restart.
+			signingKey = make([]byte, 32)
+			if _, err := rand.Read(signingKey); err != nil {
+				return nil, nil, err
+			}
+		}
+		store, err := artifact.NewLocalStore(dir, strings.TrimRight(publicURL, "/")+"/v1/artifacts/download", signingKey)
+		if err != nil {
+			return nil, nil, err
+		}
+		return store, store, nil
+	case "s3", "gcs":
+		cfg := artifact.S3Config{
+			Endpoint:  os.Getenv("SANDBOXAID_ARTIFACT_ENDPOINT"),
+			Region:    os.Getenv("SANDBOXAID_ARTIFACT_REGION"),
+			Bucket:    os.Getenv("SANDBOXAID_ARTIFACT_BUCKET"),
+			AccessKey: os.Getenv("AWS_ACCESS_KEY_ID"),
+			SecretKey: os.Getenv("AWS_SECRET_ACCESS_KEY"),
+			PathStyle: envBool("SANDBOXAID_ARTIFACT_PATH_STYLE", false),
+		}
+		if kind == "gcs" {
+			// GCS XML API interoperability mode with HMAC keys.
+			if cfg.Endpoint == "" {
+				cfg.Endpoint = "https://storage.googleapis.com"
+			}
+			if cfg.Region == "" {
+				cfg.Region = "auto"
+			}
+		}
+		store, err := artifact.NewS3Store(cfg, &http.Client{Timeout: 5 * time.Minute})
+		return store, nil, err
+	default:
+		return nil, nil, fmt.Errorf("unknown artifact store %q", kind)
+	}
+}
+
+// readPrewarmImages lists the images of SANDBOXAID_PREWARM_IMAGES (comma-separated) and of
+// the file at path, if set, which holds one image per line; blank lines and lines starting
+// with "#" are skipped.
+func readPrewarmImages(path string) ([]string, error) {
+	images := strings.Split(os.Getenv("SANDBOXAID_PREWARM_IMAGES"), ",")
+	if path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		images = append(images, strings.Split(string(data), "\n")...)
+	}
+	var list []string
+	for _, img := range images {
+		if img = strings.TrimSpace(img); img != "" && !strings.HasPrefix(img, "#") {
+			list = append(list, img)
+		}
+	}
+	return list, nil
+}
+
+// envBool reads a boolean environment variable, returning def when unset.
+func envBool(key string, def bool) bool {
+	val, ok := os.LookupEnv(key)
+	if !ok {
+		return def
+	}
+	return strings.ToLower(strings.TrimSpace(val)) == "true"
+}
+
+// envDuration reads a duration environment variable such as "30s", returning def when unset or invalid.
+func envDuration(key string, def time.Duration) time.Duration {
+	val, ok := os.LookupEnv(key)
+	if !ok {
+		return def
+	}
+	d, err := time.ParseDuration(strings.TrimSpace(val))
+	if err != nil {
+		slog.Warn("Invalid duration in environment, using default", "key", key, "value", val, "default", def)
+		return def
+	}
+	return d
+}
+
+// envDate reads a date environment variable such as "2027-01-31", returning the zero time when unset or invalid.
+func envDate(key string) time.Time {
+	val, ok := os.LookupEnv(key)
+	if !ok {
+		return time.Time{}
+	}
+	t, err := time.Parse(time.DateOnly, strings.TrimSpace(val))
+	if err != nil {
+		slog.Warn("Invalid date in environment, ignoring", "key", key, "value", val)
+		return time.Time{}
+	}
+	return t
+}
+
+// envInt reads an integer environment variable, returning def when unset or invalid.
+func envInt(key string, def int) int {
+	val, ok := os.LookupEnv(key)
+	if !ok {
+		return def
+	}
+	n, err := strconv.Atoi(strings.TrimSpace(val))
+	if err != nil {
+		slog.Warn("Invalid integer in environment, using default", "key", key, "value", val, "default", def)
+		return def
+	}
+	return n
+}
+
+// newLogLevels reads the log levels from SANDBOXAID_LOG_LEVEL and SANDBOXAID_LOG_LEVELS.
+func newLogLevels() (*logging.Levels, error) {
+	level := slog.LevelInfo
+	if name := os.Getenv("SANDBOXAID_LOG_LEVEL"); name != "" {
+		var err error
+		if level, err = logging.ParseLevel(name); err != nil {
+			return nil, err
+		}
+	}
+	levels := logging.NewLevels(level)
+	components, err := logging.ParseComponentLevels(os.Getenv("SANDBOXAID_LOG_LEVELS"))
+	if err != nil {
+		return nil, err
+	}
+	for component, level := range components {
+		levels.Set(component, level)
+	}
+	return levels, nil
+}
+
+// newRedactor returns the redactor of logs and observations, or nil if SANDBOXAID_REDACT is
+// false.
+func newRedactor() (*redact.Redactor, error) {
+	if val, ok := os.LookupEnv("SANDBOXAID_REDACT"); ok && strings.ToLower(strings.TrimSpace(val)) == "false" {
+		return nil, nil
+	}
+	patterns := append([]string(nil), redact.DefaultPatterns...)
+	if path := os.Getenv("SANDBOXAID_REDACT_PATTERNS_FILE"); path != "" {
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		extra, err := redact.ReadPatterns(f)
+		if err != nil {
+			return nil, fmt.Errorf("read %s: %w", path, err)
+		}
+		patterns = append(patterns, extra...)
+	}
+	return redact.New(patterns)
+}
+
+// connectDocker connects to the local container runtime: DOCKER_HOST if set, else the first
+// of the sockets of the runtimes dockerenv knows whose daemon answers. It returns the preset
+// of that runtime, or an error saying how to start one.
+func connectDocker(ctx context.Context) (*client.Client, dockerenv.Preset, error) {
+	dockerHost := os.Getenv("DOCKER_HOST")
+	if dockerHost == "" && runtime.GOOS == "windows" {
+		dockerHost = client.DefaultDockerHost // The named pipe; there are no sockets to look for
+	}
+	home, _ := os.UserHomeDir()
+	candidates, err := dockerenv.Candidates(os.Getenv("SANDBOXAID_DOCKER_RUNTIME"), dockerHost, home, func(path string) bool {
+		_, err := os.Stat(path)
+		return err == nil
+	})
+	if err != nil {
+		return nil, dockerenv.Preset{}, err
+	}
+	var failures []string
+	for _, c := range candidates {
+		opts := []client.Opt{client.FromEnv, client.WithAPIVersionNegotiation()}
+		endpoint := dockerHost
+		if c.DockerHost != "" {
+			opts = append(opts, client.WithHost(c.DockerHost))
+			endpoint = c.DockerHost
+		}
+		dockerClient, err := client.NewClientWithOpts(opts...)
+		if err == nil {
+			pingCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+			_, err = dockerClient.Ping(pingCtx)
+			cancel()
+			if err != nil {
+				dockerClient.Close()
+			}
+		}
+		if err != nil {
+			failures = append(failures, fmt.Sprintf("%s: %v (%s)", endpoint, err, c.StartHint))
+			continue
+		}
+		preset := c.Preset
+		if !c.Known {
+			if info, err := dockerClient.Info(ctx); err == nil {
+				preset = dockerenv.Presets[dockerenv.Identify(info)]
+			}
+		}
+		if c.DockerHost != "" {
+			os.Setenv("DOCKER_HOST", c.DockerHost) // The cleanup client connects to the same daemon
+		}
+		return dockerClient, preset, nil
+	}
+	return nil, dockerenv.Preset{}, fmt.Errorf("cannot reach the Docker daemon at %s", strings.Join(failures, "; "))
+}
+
+// envFloat reads a number environment variable, returning def when unset or invalid.
+func envFloat(key string, def float64) float64 {
+	val, ok := os.LookupEnv(key)
+	if !ok {
+		return def
+	}
+	f, err := strconv.ParseFloat(strings.TrimSpace(val), 64)
+	if err != nil {
+		slog.Warn("Invalid number in environment, using default", "key", key, "value", val, "default", def)
+		return def
+	}
+	return f
+}
+
+// envBytes reads a size environment variable such as "16m", returning def when unset or invalid.
+func envBytes(key string, def int64) int64 {
+	val, ok := os.LookupEnv(key)
+	if !ok {
+		return def
+	}
+	n, err := units.RAMInBytes(strings.TrimSpace(val))
+	if err != nil {
+		slog.Warn("Invalid size in environment, using default", "key", key, "value", val, "default", def)
+		return def
+	}
+	return n
+}
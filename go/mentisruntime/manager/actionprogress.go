@@ -0,0 +1,89 @@
+package manager
+
+import (
+	"encoding/json"
+	"math"
+	"time"
+)
+
+// Limits of the "progress" observations of agents.
+const (
+	maxProgressMessageBytes = 1024
+	progressInterval        = 250 * time.Millisecond // Least time between forwarded observations of an action
+)
+
+// actionProgress is the progress an action reported so far, to throttle its "progress"
+// observations and estimate when it completes.
+type actionProgress struct {
+	since        time.Time // When the action reported startPercent, the base of its rate
+	startPercent float64
+	sent         time.Time // When its last observation was forwarded
+	percent      *float64
+	message      string
+}
+
+// update records an observation of the action at now. It reports whether to forward it, and
+// the estimated seconds until the action completes if percent moved forward since the base.
+// Observations are forwarded at most every progressInterval, except those changing the
+// message or reaching 100 percent.
+func (p *actionProgress) update(now time.Time, percent *float64, message string) (bool, *float64) {
+	first := p.sent.IsZero()
+	if percent != nil && (p.since.IsZero() || (p.percent != nil && *percent < *p.percent)) {
+		p.since, p.startPercent = now, *percent // A new phase, such as a second download, starts over
+	}
+	forward := first || message != p.message || (percent != nil && *percent == 100) || now.Sub(p.sent) >= progressInterval
+	p.percent, p.message = percent, message
+	if !forward {
+		return false, nil
+	}
+	p.sent = now
+	if percent == nil || *percent <= p.startPercent {
+		return true, nil
+	}
+	elapsed := now.Sub(p.since).Seconds()
+	eta := elapsed * (100 - *percent) / (*percent - p.startPercent)
+	eta = math.Round(eta*10) / 10
+	return true, &eta
+}
+
+// checkProgress validates a "progress" observation of an agent, returning the bytes to
+// forward with the estimated time to completion added, or nil to drop it. Observations of
+// actions that are not running in the sandbox, with a percent outside 0 to 100 or with a
+// long message are dropped, as are those coming faster than progressInterval.
+func (m *SandboxManager) checkProgress(sandboxID string, obs *internalObservation, observationBytes []byte) []byte {
+	invalid := ""
+	switch {
+	case obs.Percent != nil && (math.IsNaN(*obs.Percent) || *obs.Percent < 0 || *obs.Percent > 100):
+		invalid = "percent out of range"
+	case len(obs.Message) > maxProgressMessageBytes:
+		invalid = "message too long"
+	}
+	if invalid != "" {
+		m.logger.Warn("Dropping invalid progress observation", "sandboxID", sandboxID, "actionID", obs.ActionID, "reason", invalid)
+		return nil
+	}
+
+	m.mu.Lock()
+	if m.activeActions[obs.ActionID] != sandboxID || obs.ActionID == "" {
+		m.mu.Unlock()
+		m.logger.Warn("Dropping progress observation of an action not running in the sandbox", "sandboxID", sandboxID, "actionID", obs.ActionID)
+		return nil
+	}
+	p := m.actionProgress[obs.ActionID]
+	if p == nil {
+		p = &actionProgress{}
+		m.actionProgress[obs.ActionID] = p
+	}
+	forward, eta := p.update(time.Now(), obs.Percent, obs.Message)
+	m.mu.Unlock()
+
+	if !forward {
+		return nil
+	}
+	if eta != nil && obs.EtaSeconds == nil { // Agents that know better keep their own estimate
+		if value, err := json.Marshal(*eta); err == nil {
+			observationBytes = withField(observationBytes, "eta_seconds", value)
+		}
+	}
+	return observationBytes
+}
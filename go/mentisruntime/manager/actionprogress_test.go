@@ -0,0 +1,56 @@
+package manager
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/foreveryh/sandboxai/go/mentisruntime/history"
+)
+
+func TestActionProgress_update(t *testing.T) {
+	percent := func(p float64) *float64 { return &p }
+	start := time.Date(2026, 10, 17, 10, 0, 0, 0, time.UTC)
+	var p actionProgress
+
+	forward, eta := p.update(start, percent(20), "downloading")
+	require.True(t, forward)
+	require.Nil(t, eta)
+	forward, _ = p.update(start.Add(100*time.Millisecond), percent(21), "downloading")
+	require.False(t, forward) // Throttled
+	forward, eta = p.update(start.Add(10*time.Second), percent(60), "downloading")
+	require.True(t, forward)
+	require.Equal(t, 10.0, *eta) // 40 points in 10s, 40 to go
+
+	// Going backwards starts a new phase
+	forward, eta = p.update(start.Add(11*time.Second), percent(0), "installing")
+	require.True(t, forward)
+	require.Nil(t, eta)
+	forward, eta = p.update(start.Add(11*time.Second+time.Millisecond), percent(100), "installing")
+	require.True(t, forward) // Completion is never throttled
+	require.Equal(t, 0.0, *eta)
+
+	forward, eta = p.update(start.Add(20*time.Second), nil, "cleaning up")
+	require.True(t, forward)
+	require.Nil(t, eta)
+}
+
+func TestReceiveInternalObservation_progress(t *testing.T) {
+	m := newObservationTestManager(t)
+	m.activeActions = map[string]string{"a": "sb"}
+	m.actionProgress = make(map[string]*actionProgress)
+
+	for _, msg := range []string{
+		`{"observation_type":"progress","action_id":"a","percent":101}`,
+		`{"observation_type":"progress","action_id":"a","percent":-1}`,
+		`{"observation_type":"progress","action_id":"b","percent":10}`,
+		`{"observation_type":"progress","action_id":"a","percent":10,"message":"x"}`,
+	} {
+		require.NoError(t, m.ReceiveInternalObservation("sb", []byte(msg)))
+	}
+	page, err := m.history.Query("sb", history.Query{})
+	require.NoError(t, err)
+	require.Len(t, page.Observations, 1)
+	require.JSONEq(t, `{"observation_type":"progress","action_id":"a","percent":10,"message":"x"}`, string(page.Observations[0].Observation))
+}
@@ -0,0 +1,95 @@
+package manager
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"strings"
+
+	"github.com/foreveryh/sandboxai/go/mentisruntime/history"
+)
+
+// Errors of ActionResult.
+var (
+	ErrActionRunning        = newError(KindConflict, "action_running", "action has not ended")
+	ErrActionResultNotFound = newError(KindNotFound, "action_result_not_found", "no ended action with this ID is recorded")
+)
+
+// ActionResult is an ended action, rebuilt from the observation history.
+type ActionResult struct {
+	ActionID     string             `json:"action_id"`
+	ExitCode     int                `json:"exit_code"`
+	Stdout       string             `json:"stdout"` // The "stream" lines of the action, one per line
+	Stderr       string             `json:"stderr"`
+	End          EndObservationData `json:"end"` // The data of its "end" observation
+	Observations []history.Record   `json:"-"`   // All its observations, in order
+}
+
+// ActionResult returns the result of an ended action of a sandbox. Raw output frames of
+// "large_output" actions are not recorded, so their output is missing from it.
+func (m *SandboxManager) ActionResult(ctx context.Context, sandboxID, actionID string) (*ActionResult, error) {
+	result := &ActionResult{ActionID: actionID}
+	ended := false
+	var stdout, stderr strings.Builder
+	q := history.Query{ActionID: actionID, Limit: history.MaxLimit}
+	for {
+		page, err := m.ListObservations(ctx, sandboxID, q)
+		if err != nil {
+			return nil, err
+		}
+		for _, rec := range page.Observations {
+			result.Observations = append(result.Observations, rec)
+			switch rec.ObservationType {
+			case "stream":
+				var obs internalObservation
+				if json.Unmarshal(rec.Observation, &obs) != nil || obs.Line == nil {
+					continue
+				}
+				out := &stdout
+				if obs.Stream == "stderr" {
+					out = &stderr
+				}
+				appendStreamLine(out, &obs)
+			case "end":
+				var end struct {
+					Data EndObservationData `json:"data"`
+				}
+				if err := json.Unmarshal(rec.Observation, &end); err == nil {
+					result.End, ended = end.Data, true
+				}
+			}
+		}
+		if page.NextCursor == "" {
+			break
+		}
+		q.Cursor = page.NextCursor
+	}
+
+	if !ended {
+		m.mu.RLock()
+		running := m.activeActions[actionID] == sandboxID
+		m.mu.RUnlock()
+		if running {
+			return nil, ErrActionRunning
+		}
+		return nil, ErrActionResultNotFound
+	}
+	result.ExitCode = result.End.ExitCode
+	result.Stdout, result.Stderr = stdout.String(), stderr.String()
+	return result, nil
+}
+
+// appendStreamLine appends the line of a "stream" observation to out: text lines ending with
+// a newline, binary frames as their decoded bytes.
+func appendStreamLine(out *strings.Builder, obs *internalObservation) {
+	if obs.Encoding == EncodingBase64 {
+		if data, err := base64.StdEncoding.DecodeString(*obs.Line); err == nil {
+			out.Write(data)
+		}
+		return
+	}
+	out.WriteString(*obs.Line)
+	if !strings.HasSuffix(*obs.Line, "\n") {
+		out.WriteByte('\n')
+	}
+}
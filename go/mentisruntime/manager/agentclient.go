@@ -0,0 +1,124 @@
+package manager
+
+import (
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Agent HTTP client settings.
+const (
+	agentDialTimeout    = 5 * time.Second
+	agentCallTimeout    = 10 * time.Second // Control calls; action requests last as long as the action
+	agentMaxIdlePerHost = 8
+	agentDialAttempts   = 3
+	agentRetryDelay     = 100 * time.Millisecond // Doubled on each retry, plus up to as much jitter
+	breakerThreshold    = 5                      // Consecutive failures that open a sandbox's circuit
+	breakerCooldown     = 30 * time.Second       // How long an open circuit rejects calls
+)
+
+var ErrAgentCircuitOpen = newError(KindBackend, "agent_circuit_open", "agent calls suspended after repeated connection failures")
+
+// newAgentTransport returns the transport shared by the agent clients. Connections are
+// pooled per agent address, so actions on one sandbox reuse them.
+func newAgentTransport() *http.Transport {
+	return &http.Transport{
+		Proxy:               nil, // Agents are local; never go through a proxy
+		DialContext:         (&net.Dialer{Timeout: agentDialTimeout, KeepAlive: 30 * time.Second}).DialContext,
+		MaxIdleConns:        256,
+		MaxIdleConnsPerHost: agentMaxIdlePerHost,
+		IdleConnTimeout:     90 * time.Second,
+	}
+}
+
+// agentBreakers is a circuit breaker per sandbox. After breakerThreshold consecutive
+// connection failures, calls to the sandbox's agent fail fast for breakerCooldown; the
+// first call after that is let through, and closes the circuit if it succeeds. The zero
+// value is ready to use.
+type agentBreakers struct {
+	mu       sync.Mutex
+	failures map[string]int       // Map sandboxID to consecutive failures
+	openTill map[string]time.Time // Map sandboxID to the end of its open period
+}
+
+// allow returns ErrAgentCircuitOpen while a sandbox's circuit is open.
+func (b *agentBreakers) allow(sandboxID string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if until, open := b.openTill[sandboxID]; open && time.Now().Before(until) {
+		return fmt.Errorf("%w: %q until %s", ErrAgentCircuitOpen, sandboxID, until.Format(time.RFC3339))
+	}
+	return nil
+}
+
+// record counts the outcome of a call, opening the circuit when the threshold is reached.
+// It reports whether the circuit was opened.
+func (b *agentBreakers) record(sandboxID string, failed bool) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if !failed {
+		delete(b.failures, sandboxID)
+		delete(b.openTill, sandboxID)
+		return false
+	}
+	if b.failures == nil {
+		b.failures = make(map[string]int)
+		b.openTill = make(map[string]time.Time)
+	}
+	b.failures[sandboxID]++
+	if b.failures[sandboxID] < breakerThreshold {
+		return false
+	}
+	b.openTill[sandboxID] = time.Now().Add(breakerCooldown)
+	return true
+}
+
+// reset forgets a sandbox's failures, e.g. after its agent was restarted or it was deleted.
+func (b *agentBreakers) reset(sandboxID string) {
+	b.record(sandboxID, false)
+}
+
+// doAgent sends a request to a sandbox's agent through the sandbox's circuit breaker. When
+// no connection can be made the request never reached the agent, so it is retried with
+// jitter whatever its method.
+func (m *SandboxManager) doAgent(client *http.Client, sandboxID string, req *http.Request) (*http.Response, error) {
+	if err := m.breakers.allow(sandboxID); err != nil {
+		return nil, err
+	}
+	ctx := req.Context()
+	resp, err := client.Do(req)
+	for attempt := 1; err != nil && attempt < agentDialAttempts && isDialError(err); attempt++ {
+		delay := agentRetryDelay << (attempt - 1)
+		delay += rand.N(delay)
+		m.logger.Debug("Retrying agent request after connection failure", "sandboxID", sandboxID, "url", req.URL.String(), "attempt", attempt, "delay", delay, "error", err)
+		select {
+		case <-ctx.Done():
+			return nil, err
+		case <-time.After(delay):
+		}
+		retry := req.Clone(ctx)
+		if req.GetBody != nil {
+			if retry.Body, err = req.GetBody(); err != nil {
+				return nil, err
+			}
+		}
+		resp, err = client.Do(retry)
+	}
+	// Failures caused by the caller giving up say nothing about the agent.
+	if err == nil || ctx.Err() == nil {
+		if m.breakers.record(sandboxID, err != nil) {
+			m.logger.Warn("Agent circuit opened after repeated failures", "sandboxID", sandboxID, "cooldown", breakerCooldown, "error", err)
+		}
+	}
+	return resp, err
+}
+
+// isDialError reports whether err happened while connecting, before anything was sent.
+func isDialError(err error) bool {
+	var opErr *net.OpError
+	return errors.As(err, &opErr) && opErr.Op == "dial"
+}
@@ -0,0 +1,45 @@
+package manager
+
+import (
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestDoAgent_retriesDialErrorsAndOpensCircuit(t *testing.T) {
+	agent := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	agentURL := agent.URL
+	agent.Close() // Connections are now refused
+
+	m := &SandboxManager{logger: slog.Default()}
+	client := &http.Client{Transport: newAgentTransport()}
+	for i := 0; i < breakerThreshold-1; i++ {
+		m.breakers.record("sb", true)
+	}
+	req, err := http.NewRequest("POST", agentURL+"/tools:run_shell_command", strings.NewReader(`{"command":"ls"}`))
+	require.NoError(t, err)
+	_, err = m.doAgent(client, "sb", req) // Retried, then the last failure opens the circuit
+	require.True(t, isDialError(err), "%v", err)
+
+	req, err = http.NewRequest("GET", agentURL+"/health", nil)
+	require.NoError(t, err)
+	_, err = m.doAgent(client, "sb", req)
+	require.ErrorIs(t, err, ErrAgentCircuitOpen)
+	require.NoError(t, m.breakers.allow("other"))
+
+	m.breakers.reset("sb")
+	require.NoError(t, m.breakers.allow("sb"))
+}
+
+func TestAgentBreakers_successCloses(t *testing.T) {
+	var b agentBreakers
+	for i := 0; i < breakerThreshold-1; i++ {
+		require.False(t, b.record("sb", true))
+	}
+	b.record("sb", false)
+	require.False(t, b.record("sb", true), "failures start over after a success")
+}
@@ -0,0 +1,191 @@
+package manager
+
+import (
+	"archive/tar"
+	"context"
+	"fmt"
+	"io"
+	"mime"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/docker/docker/client"
+	"github.com/google/uuid"
+)
+
+var (
+	ErrArtifactsDisabled = newError(KindUnavailable, "artifacts_disabled", "artifact store not configured")
+	ErrArtifactNotFound  = newError(KindNotFound, "artifact_not_found", "artifact not found")
+	// ErrInvalidArtifactName is returned for names that are not a single path element, which
+	// would place the artifact's key outside its sandbox's prefix.
+	ErrInvalidArtifactName = newError(KindInvalid, "invalid_artifact_name", "artifact name must be a file name")
+)
+
+// Artifact is a file or directory captured from a sandbox into the artifact store.
+// Directories are stored as tar archives.
+type Artifact struct {
+	ID          string    `json:"artifact_id"`
+	SandboxID   string    `json:"sandbox_id"`
+	SpaceID     string    `json:"space_id"`
+	SourcePath  string    `json:"source_path"`
+	Name        string    `json:"name"`
+	Key         string    `json:"key"`
+	Size        int64     `json:"size"`
+	ContentType string    `json:"content_type"`
+	CreatedAt   time.Time `json:"created_at"`
+	URL         string    `json:"url,omitempty"` // Signed download URL, filled in on read
+}
+
+// CaptureArtifact copies sourcePath out of the sandbox container and uploads it to the artifact store.
+func (m *SandboxManager) CaptureArtifact(ctx context.Context, sandboxID, sourcePath, name string) (*Artifact, error) {
+	if m.artifactStore == nil {
+		return nil, ErrArtifactsDisabled
+	}
+
+	if name != "" && !validArtifactName(name) {
+		return nil, fmt.Errorf("%w: %q", ErrInvalidArtifactName, name)
+	}
+	m.mu.RLock()
+	state, exists := m.sandboxes[sandboxID]
+	m.mu.RUnlock()
+	if !exists {
+		return nil, ErrSandboxNotFound
+	}
+
+	rc, stat, err := m.docker().CopyFromContainer(ctx, state.ContainerID, sourcePath)
+	if err != nil {
+		if client.IsErrNotFound(err) {
+			return nil, &Error{Kind: KindNotFound, Code: "path_not_found", Message: "path not found in sandbox: " + sourcePath, Err: err}
+		}
+		return nil, backendError("copy_failed", "failed to copy "+sourcePath+" from sandbox", err)
+	}
+	defer rc.Close()
+
+	// Spool to a temporary file first: object stores need the content length up front.
+	tmp, err := os.CreateTemp("", "sandboxai-artifact-*")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create temp file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	if name == "" {
+		name = stat.Name
+	}
+	if !validArtifactName(name) {
+		name = "artifact" // The source path is the root
+	}
+	var contentType string
+	if stat.Mode.IsDir() {
+		// Keep the tar stream Docker returns as-is.
+		if _, err := io.Copy(tmp, rc); err != nil {
+			return nil, fmt.Errorf("failed to read directory archive: %w", err)
+		}
+		if path.Ext(name) != ".tar" {
+			name += ".tar"
+		}
+		contentType = "application/x-tar"
+	} else {
+		tr := tar.NewReader(rc)
+		if _, err := tr.Next(); err != nil {
+			return nil, fmt.Errorf("failed to read file archive: %w", err)
+		}
+		if _, err := io.Copy(tmp, tr); err != nil {
+			return nil, fmt.Errorf("failed to read file contents: %w", err)
+		}
+		contentType = mime.TypeByExtension(path.Ext(name))
+		if contentType == "" {
+			contentType = "application/octet-stream"
+		}
+	}
+
+	size, err := tmp.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := tmp.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+
+	artifact := &Artifact{
+		ID:          uuid.NewString(),
+		SandboxID:   sandboxID,
+		SpaceID:     state.SpaceID,
+		SourcePath:  sourcePath,
+		Name:        name,
+		Size:        size,
+		ContentType: contentType,
+		CreatedAt:   time.Now().UTC(),
+	}
+	artifact.Key = path.Join(state.SpaceID, sandboxID, artifact.ID, name)
+
+	if err := m.artifactStore.Put(ctx, artifact.Key, tmp, size, contentType); err != nil {
+		m.logger.Error("Failed to upload artifact", "sandboxID", sandboxID, "path", sourcePath, "key", artifact.Key, "error", err)
+		return nil, fmt.Errorf("failed to upload artifact: %w", err)
+	}
+
+	m.mu.Lock()
+	m.artifacts[sandboxID] = append(m.artifacts[sandboxID], artifact)
+	m.mu.Unlock()
+
+	m.logger.Info("Artifact captured", "sandboxID", sandboxID, "artifactID", artifact.ID, "path", sourcePath, "size", size)
+	return m.withSignedURL(ctx, artifact)
+}
+
+// ListArtifacts returns the artifacts captured from a sandbox, including those of deleted sandboxes.
+func (m *SandboxManager) ListArtifacts(ctx context.Context, spaceID, sandboxID string) ([]*Artifact, error) {
+	if m.artifactStore == nil {
+		return nil, ErrArtifactsDisabled
+	}
+
+	m.mu.RLock()
+	stored := m.artifacts[sandboxID]
+	m.mu.RUnlock()
+
+	artifacts := make([]*Artifact, 0, len(stored))
+	for _, a := range stored {
+		if a.SpaceID != spaceID {
+			continue
+		}
+		signed, err := m.withSignedURL(ctx, a)
+		if err != nil {
+			return nil, err
+		}
+		artifacts = append(artifacts, signed)
+	}
+	return artifacts, nil
+}
+
+// GetArtifact returns a single artifact with a fresh download URL.
+func (m *SandboxManager) GetArtifact(ctx context.Context, spaceID, sandboxID, artifactID string) (*Artifact, error) {
+	if m.artifactStore == nil {
+		return nil, ErrArtifactsDisabled
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	for _, a := range m.artifacts[sandboxID] {
+		if a.ID == artifactID && a.SpaceID == spaceID {
+			return m.withSignedURL(ctx, a)
+		}
+	}
+	return nil, ErrArtifactNotFound
+}
+
+// withSignedURL returns a copy of a with a freshly signed download URL.
+func (m *SandboxManager) withSignedURL(ctx context.Context, a *Artifact) (*Artifact, error) {
+	signedURL, err := m.artifactStore.SignedURL(ctx, a.Key, m.artifactURLTTL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to sign artifact URL: %w", err)
+	}
+	artifactCopy := *a
+	artifactCopy.URL = signedURL
+	return &artifactCopy, nil
+}
+
+// validArtifactName reports whether name is a single path element.
+func validArtifactName(name string) bool {
+	return name != "" && name != "." && name != ".." && !strings.ContainsAny(name, `/\`)
+}
@@ -0,0 +1,132 @@
+package manager
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// batchDeleteConcurrency caps the deletions of a batch that run at once.
+const batchDeleteConcurrency = 8
+
+var ErrBatchTargetMissing = newError(KindInvalid, "batch_target_missing", "sandbox IDs or a label selector are required")
+
+// DeleteResult is the outcome of deleting one sandbox of a batch.
+type DeleteResult struct {
+	SandboxID string `json:"sandbox_id"`
+	Deleted   bool   `json:"deleted"`
+	Code      string `json:"code,omitempty"`
+	Error     string `json:"error,omitempty"`
+}
+
+// DeleteSandboxes deletes sandboxes of a space concurrently: those named in sandboxIDs, or,
+// if there are none, those whose labels include every entry of selector. Failures of single
+// sandboxes, including IDs that are not in the space, are reported in the results, which
+// follow the order of sandboxIDs, or of sandbox IDs for a selector.
+func (m *SandboxManager) DeleteSandboxes(ctx context.Context, spaceID string, sandboxIDs []string, selector map[string]string, force bool) ([]DeleteResult, error) {
+	if len(sandboxIDs) == 0 && len(selector) == 0 {
+		return nil, ErrBatchTargetMissing
+	}
+	if _, err := m.spaceManager.GetSpace(ctx, spaceID); err != nil {
+		return nil, err
+	}
+	inSpace, err := m.spaceManager.getSpaceSandboxes(spaceID)
+	if err != nil {
+		return nil, err
+	}
+	members := make(map[string]bool, len(inSpace))
+	for _, id := range inSpace {
+		members[id] = true
+	}
+
+	targets := dedupe(sandboxIDs)
+	if len(targets) == 0 {
+		targets = m.selectSandboxes(inSpace, selector)
+	}
+	m.logger.Info("Deleting sandboxes in batch", "spaceID", spaceID, "count", len(targets), "selector", selector, "force", force)
+
+	results := make([]DeleteResult, len(targets))
+	sem := make(chan struct{}, batchDeleteConcurrency)
+	var wg sync.WaitGroup
+	for i, id := range targets {
+		if !members[id] {
+			results[i] = deleteResult(id, fmt.Errorf("%w: %q", ErrSandboxNotFound, id))
+			continue
+		}
+		sem <- struct{}{}
+		wg.Add(1)
+		err := m.submit(ctx, m.dockerPool, func() {
+			defer wg.Done()
+			defer func() { <-sem }()
+			results[i] = deleteResult(id, m.DeleteSandbox(ctx, id, force))
+		})
+		if err != nil {
+			results[i] = deleteResult(id, err)
+			<-sem
+			wg.Done()
+		}
+	}
+	wg.Wait()
+	return results, nil
+}
+
+// selectSandboxes returns the sorted IDs among ids whose labels match selector.
+func (m *SandboxManager) selectSandboxes(ids []string, selector map[string]string) []string {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	var selected []string
+	for _, id := range ids {
+		if state, exists := m.sandboxes[id]; exists && matchesSelector(state.Labels, selector) {
+			selected = append(selected, id)
+		}
+	}
+	sort.Strings(selected)
+	return selected
+}
+
+// matchesSelector reports whether labels include every entry of selector.
+func matchesSelector(labels, selector map[string]string) bool {
+	for k, v := range selector {
+		if got, ok := labels[k]; !ok || got != v {
+			return false
+		}
+	}
+	return true
+}
+
+// userLabels returns the container labels that are not the runtime's own "sandboxai." labels.
+func userLabels(labels map[string]string) map[string]string {
+	var user map[string]string
+	for k, v := range labels {
+		if strings.HasPrefix(k, "sandboxai.") {
+			continue
+		}
+		if user == nil {
+			user = make(map[string]string)
+		}
+		user[k] = v
+	}
+	return user
+}
+
+func deleteResult(sandboxID string, err error) DeleteResult {
+	if err != nil {
+		return DeleteResult{SandboxID: sandboxID, Code: CodeOf(err), Error: err.Error()}
+	}
+	return DeleteResult{SandboxID: sandboxID, Deleted: true}
+}
+
+// dedupe returns ids without repeated entries, keeping the first occurrence.
+func dedupe(ids []string) []string {
+	seen := make(map[string]bool, len(ids))
+	out := make([]string, 0, len(ids))
+	for _, id := range ids {
+		if !seen[id] {
+			seen[id] = true
+			out = append(out, id)
+		}
+	}
+	return out
+}
@@ -0,0 +1,45 @@
+package manager
+
+import (
+	"context"
+	"log/slog"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestDeleteSandboxes_reportsPerSandbox(t *testing.T) {
+	ctx := context.Background()
+	sm := NewSpaceManager(slog.Default())
+	spaceID, err := sm.CreateSpace(ctx, "eval", "", nil)
+	require.NoError(t, err)
+	m := &SandboxManager{
+		logger:        slog.Default(),
+		spaceManager:  sm,
+		sandboxes:     map[string]*SandboxState{},
+		activeActions: map[string]string{},
+	}
+	for _, id := range []string{"a", "b"} {
+		state := &SandboxState{ID: id, SpaceID: spaceID, Phase: PhaseReady, Protected: true, Labels: map[string]string{"run": id}}
+		m.sandboxes[id] = state
+		require.NoError(t, sm.addSandboxToSpace(spaceID, id, state))
+	}
+
+	results, err := m.DeleteSandboxes(ctx, spaceID, []string{"a", "missing", "a"}, nil, false)
+	require.NoError(t, err)
+	require.Len(t, results, 2)
+	require.Equal(t, ErrSandboxProtected.Code, results[0].Code)
+	require.Equal(t, ErrSandboxNotFound.Code, results[1].Code)
+
+	results, err = m.DeleteSandboxes(ctx, spaceID, nil, map[string]string{"run": "b"}, false)
+	require.NoError(t, err)
+	require.Equal(t, []DeleteResult{{SandboxID: "b", Code: ErrSandboxProtected.Code, Error: `sandbox is protected from deletion: "b"`}}, results)
+
+	_, err = m.DeleteSandboxes(ctx, spaceID, nil, nil, false)
+	require.ErrorIs(t, err, ErrBatchTargetMissing)
+}
+
+func TestUserLabels(t *testing.T) {
+	require.Equal(t, map[string]string{"team": "ml"}, userLabels(map[string]string{"sandboxai.id": "x", "team": "ml"}))
+	require.Nil(t, userLabels(map[string]string{"sandboxai.scope": "default"}))
+}
@@ -0,0 +1,288 @@
+package manager
+
+import (
+	"context"
+	"fmt"
+)
+
+var ErrBudgetExceeded = newError(KindQuota, "budget_exceeded", "budget exceeded")
+
+// Budget events, broadcast on the streams of the spaces a budget applies to.
+const (
+	SpaceEventBudgetWarning  = "budget_warning"
+	SpaceEventBudgetExceeded = "budget_exceeded"
+)
+
+// DefaultBudgetWarnAt is the share of a budget past which a warning is sent, for budgets
+// that set no thresholds of their own.
+var DefaultBudgetWarnAt = []float64{0.8}
+
+// Budget caps the usage of the sandboxes of a space or tenant, summed over the usage kept
+// by usage accounting. Once either limit is reached, new sandboxes and actions are refused
+// with ErrBudgetExceeded. A zero limit is no limit.
+type Budget struct {
+	MaxRuntimeHours float64   `json:"max_runtime_hours,omitempty"` // Wall-clock hours of the sandboxes' containers
+	MaxCostUnits    float64   `json:"max_cost_units,omitempty"`    // Cost under the rates of WithCostRates
+	WarnAt          []float64 `json:"warn_at,omitempty"`           // Shares of the budget, in (0, 1), that send a "budget_warning"; DefaultBudgetWarnAt if empty
+}
+
+// CostRates price usage in cost units, for budgets with MaxCostUnits.
+type CostRates struct {
+	CPUHour     float64 `json:"cpu_hour"`     // Per CPU-hour
+	GBHour      float64 `json:"gb_hour"`      // Per GiB of memory held for an hour
+	RuntimeHour float64 `json:"runtime_hour"` // Per hour a sandbox's container is up
+}
+
+// WithCostRates sets the rates budgets with MaxCostUnits are charged at.
+func WithCostRates(rates CostRates) Option {
+	return func(m *SandboxManager) {
+		m.costRates = rates
+	}
+}
+
+// cost returns the cost units of usage under rates.
+func (r CostRates) cost(t UsageTotals) float64 {
+	return t.CPUSeconds/3600*r.CPUHour + t.MemoryByteSeconds/(3600*(1<<30))*r.GBHour + t.WallSeconds/3600*r.RuntimeHour
+}
+
+// BudgetStatus is a budget with the usage it is charged.
+type BudgetStatus struct {
+	Budget       Budget  `json:"budget"`
+	RuntimeHours float64 `json:"runtime_hours"`
+	CostUnits    float64 `json:"cost_units"`
+	Share        float64 `json:"share"` // Of the budget used, 1 when exhausted
+	Exceeded     bool    `json:"exceeded"`
+}
+
+// BudgetEventData is the data of "budget_warning" and "budget_exceeded" events. Tenant is
+// set for the budgets of tenants, SpaceID for those of spaces.
+type BudgetEventData struct {
+	Tenant  string `json:"tenant,omitempty"`
+	SpaceID string `json:"space_id,omitempty"`
+	BudgetStatus
+}
+
+// budgetKey names the budget of a space or a tenant in the ledger.
+func budgetKey(spaceID, tenant string) string {
+	if spaceID != "" {
+		return "space:" + spaceID
+	}
+	return "tenant:" + tenant
+}
+
+// status charges usage to the budget.
+func (b Budget) status(usage UsageTotals, rates CostRates) BudgetStatus {
+	s := BudgetStatus{Budget: b, RuntimeHours: usage.WallSeconds / 3600, CostUnits: rates.cost(usage)}
+	if b.MaxRuntimeHours > 0 {
+		s.Share = s.RuntimeHours / b.MaxRuntimeHours
+	}
+	if b.MaxCostUnits > 0 {
+		s.Share = max(s.Share, s.CostUnits/b.MaxCostUnits)
+	}
+	s.Exceeded = s.Share >= 1
+	return s
+}
+
+// level returns the highest threshold of the budget that share has reached, 1 once the
+// budget is exhausted, or 0.
+func (b Budget) level(share float64) float64 {
+	if share >= 1 {
+		return 1
+	}
+	warnAt := b.WarnAt
+	if len(warnAt) == 0 {
+		warnAt = DefaultBudgetWarnAt
+	}
+	level := 0.0
+	for _, t := range warnAt {
+		if share >= t && t > level {
+			level = t
+		}
+	}
+	return level
+}
+
+// SetSpaceBudget sets the budget of a space, or removes it if nil. Budgets need usage
+// accounting.
+func (m *SandboxManager) SetSpaceBudget(ctx context.Context, spaceID string, budget *Budget) error {
+	if m.usage == nil {
+		return ErrUsageDisabled
+	}
+	if err := m.spaceManager.setSpaceBudget(ctx, spaceID, budget); err != nil {
+		return err
+	}
+	m.resetBudgetWarnings(budgetKey(spaceID, ""))
+	m.evaluateBudgets()
+	return nil
+}
+
+// GetSpaceBudget reports the budget of a space and its usage, or nil if it has none.
+func (m *SandboxManager) GetSpaceBudget(ctx context.Context, spaceID string) (*BudgetStatus, error) {
+	if m.usage == nil {
+		return nil, ErrUsageDisabled
+	}
+	space, err := m.spaceManager.GetSpace(ctx, spaceID)
+	if err != nil {
+		return nil, err
+	}
+	if space.Budget == nil {
+		return nil, nil
+	}
+	status := space.Budget.status(m.usageOf(spaceID, ""), m.costRates)
+	return &status, nil
+}
+
+// SetTenantBudget sets the budget of a tenant across its spaces, or removes it if nil.
+func (m *SandboxManager) SetTenantBudget(tenant string, budget *Budget) error {
+	if m.usage == nil {
+		return ErrUsageDisabled
+	}
+	m.usage.mu.Lock()
+	if budget == nil {
+		delete(m.usage.tenantBudgets, tenant)
+	} else {
+		m.usage.tenantBudgets[tenant] = budget
+	}
+	m.usage.mu.Unlock()
+	m.resetBudgetWarnings(budgetKey("", tenant))
+	m.evaluateBudgets()
+	return nil
+}
+
+// ListTenantBudgets reports the budgets of tenants and their usage, by tenant.
+func (m *SandboxManager) ListTenantBudgets() (map[string]BudgetStatus, error) {
+	if m.usage == nil {
+		return nil, ErrUsageDisabled
+	}
+	m.usage.mu.Lock()
+	budgets := make(map[string]Budget, len(m.usage.tenantBudgets))
+	for tenant, b := range m.usage.tenantBudgets {
+		budgets[tenant] = *b
+	}
+	m.usage.mu.Unlock()
+	statuses := make(map[string]BudgetStatus, len(budgets))
+	for tenant, b := range budgets {
+		statuses[tenant] = b.status(m.usageOf("", tenant), m.costRates)
+	}
+	return statuses, nil
+}
+
+// usageOf sums the usage kept for the sandboxes of a space, or of a tenant if spaceID is "".
+func (m *SandboxManager) usageOf(spaceID, tenant string) UsageTotals {
+	m.usage.mu.Lock()
+	defer m.usage.mu.Unlock()
+	var totals UsageTotals
+	for _, meter := range m.usage.meters {
+		if (spaceID != "" && meter.spaceID != spaceID) || (spaceID == "" && meter.tenant != tenant) {
+			continue
+		}
+		for _, bucket := range meter.buckets {
+			totals.add(*bucket)
+		}
+	}
+	return totals
+}
+
+// checkBudget refuses work in a space whose budget, or whose tenant's budget, is exhausted.
+func (m *SandboxManager) checkBudget(spaceID string) error {
+	if m.usage == nil {
+		return nil
+	}
+	tenant := ""
+	if space, err := m.spaceManager.GetSpace(context.Background(), spaceID); err == nil {
+		tenant = space.Tenant
+	}
+	m.usage.mu.Lock()
+	defer m.usage.mu.Unlock()
+	if m.usage.exceeded[budgetKey(spaceID, "")] {
+		return fmt.Errorf("%w: space %q", ErrBudgetExceeded, spaceID)
+	}
+	if tenant != "" && m.usage.exceeded[budgetKey("", tenant)] {
+		return fmt.Errorf("%w: tenant %q", ErrBudgetExceeded, tenant)
+	}
+	return nil
+}
+
+// resetBudgetWarnings lets a changed budget warn again at thresholds already announced.
+func (m *SandboxManager) resetBudgetWarnings(key string) {
+	m.usage.mu.Lock()
+	delete(m.usage.warned, key)
+	m.usage.mu.Unlock()
+}
+
+// evaluateBudgets charges every budget its usage, after each usage sample and budget change,
+// and announces the thresholds newly reached to the spaces concerned.
+func (m *SandboxManager) evaluateBudgets() {
+	spaces, err := m.spaceManager.ListSpaces(context.Background())
+	if err != nil {
+		return
+	}
+	type event struct {
+		spaces []string
+		typ    string
+		data   BudgetEventData
+	}
+	var events []event
+	tenantSpaces := make(map[string][]string)
+	for _, space := range spaces {
+		if space.Tenant != "" {
+			tenantSpaces[space.Tenant] = append(tenantSpaces[space.Tenant], space.ID)
+		}
+	}
+
+	exceeded := make(map[string]bool)
+	charge := func(key string, b Budget, usage UsageTotals, data BudgetEventData, to []string) {
+		status := b.status(usage, m.costRates)
+		exceeded[key] = status.Exceeded
+		level := b.level(status.Share)
+		m.usage.mu.Lock()
+		announced := m.usage.warned[key]
+		m.usage.warned[key] = level
+		m.usage.mu.Unlock()
+		if level <= announced {
+			return
+		}
+		data.BudgetStatus = status
+		typ := SpaceEventBudgetWarning
+		if status.Exceeded {
+			typ = SpaceEventBudgetExceeded
+			m.logger.Warn("Budget exceeded", "spaceID", data.SpaceID, "tenant", data.Tenant, "runtimeHours", status.RuntimeHours, "costUnits", status.CostUnits)
+		}
+		events = append(events, event{spaces: to, typ: typ, data: data})
+	}
+	for _, space := range spaces {
+		if space.Budget != nil {
+			charge(budgetKey(space.ID, ""), *space.Budget, m.usageOf(space.ID, ""), BudgetEventData{SpaceID: space.ID}, []string{space.ID})
+		}
+	}
+	m.usage.mu.Lock()
+	tenantBudgets := make(map[string]Budget, len(m.usage.tenantBudgets))
+	for tenant, b := range m.usage.tenantBudgets {
+		tenantBudgets[tenant] = *b
+	}
+	m.usage.mu.Unlock()
+	for tenant, b := range tenantBudgets {
+		charge(budgetKey("", tenant), b, m.usageOf("", tenant), BudgetEventData{Tenant: tenant}, tenantSpaces[tenant])
+	}
+
+	m.usage.mu.Lock()
+	m.usage.exceeded = exceeded
+	m.usage.mu.Unlock()
+	for _, e := range events {
+		for _, spaceID := range e.spaces {
+			m.pushSpaceEvent(spaceID, e.typ, e.data)
+		}
+	}
+}
+
+// setSpaceBudget sets or removes the budget of a space.
+func (sm *SpaceManager) setSpaceBudget(ctx context.Context, spaceID string, budget *Budget) error {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+	space, exists := sm.spaces[spaceID]
+	if !exists || !visible(ctx, space) {
+		return ErrSpaceNotFound
+	}
+	space.Budget = budget
+	return nil
+}
@@ -0,0 +1,30 @@
+package manager
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestBudget_status(t *testing.T) {
+	rates := CostRates{CPUHour: 2, GBHour: 1, RuntimeHour: 0.5}
+	usage := UsageTotals{CPUSeconds: 3600, MemoryByteSeconds: 2 * 3600 * (1 << 30), WallSeconds: 7200}
+
+	// Cost: 2 (CPU) + 2 (memory) + 1 (runtime)
+	status := Budget{MaxRuntimeHours: 10, MaxCostUnits: 10}.status(usage, rates)
+	require.InDelta(t, 2, status.RuntimeHours, 1e-9)
+	require.InDelta(t, 5, status.CostUnits, 1e-9)
+	require.InDelta(t, 0.5, status.Share, 1e-9) // The larger share of the two limits
+	require.False(t, status.Exceeded)
+
+	require.True(t, Budget{MaxRuntimeHours: 2}.status(usage, rates).Exceeded)
+}
+
+func TestBudget_level(t *testing.T) {
+	b := Budget{MaxRuntimeHours: 1, WarnAt: []float64{0.9, 0.5}}
+	require.Equal(t, 0.0, b.level(0.4))
+	require.Equal(t, 0.5, b.level(0.7))
+	require.Equal(t, 0.9, b.level(0.95))
+	require.Equal(t, 1.0, b.level(1.2))
+	require.Equal(t, 0.8, Budget{}.level(0.85)) // DefaultBudgetWarnAt
+}
@@ -0,0 +1,382 @@
+package manager
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/filters"
+	"github.com/docker/docker/api/types/image"
+	"github.com/docker/docker/client"
+	"github.com/google/uuid"
+
+	"github.com/foreveryh/sandboxai/go/mentisruntime/history"
+)
+
+var (
+	ErrBuildNotFound   = newError(KindNotFound, "build_not_found", "image build not found")
+	ErrImageTagInUse   = newError(KindConflict, "image_tag_in_use", "tag belongs to an image the runtime did not build")
+	ErrInvalidBuildCtx = newError(KindInvalid, "invalid_build_context", "build context must be a tar archive, optionally gzip-compressed")
+)
+
+// Build statuses.
+const (
+	BuildRunning   = "running"
+	BuildSucceeded = "succeeded"
+	BuildFailed    = "failed"
+)
+
+// DefaultBuildTimeout bounds an image build without its own timeout.
+const DefaultBuildTimeout = 30 * time.Minute
+
+// maxRetainedBuilds caps how many finished builds are remembered.
+const maxRetainedBuilds = 100
+
+// inlineDockerfile is the context path of a Dockerfile passed as text.
+const inlineDockerfile = ".sandboxai.Dockerfile"
+
+// ImageBuildSpec describes an image build. The build context is either a tar archive
+// (Context), a Git URL (RemoteContext), or nothing at all when the Dockerfile is inline.
+type ImageBuildSpec struct {
+	Tag            string
+	Context        []byte // Tar archive, optionally gzip-compressed
+	RemoteContext  string // Git repository URL
+	Dockerfile     string // Inline Dockerfile text; added to the context
+	DockerfilePath string // Path of the Dockerfile in the context; "Dockerfile" if empty
+	BuildArgs      map[string]string
+	Target         string
+	Timeout        time.Duration // DefaultBuildTimeout if zero
+}
+
+// ImageBuild is a build together with its progress. Build output is pushed as "stream"
+// observations, and an "end" observation reports the result, all with the build ID as both
+// stream key and action ID.
+type ImageBuild struct {
+	ID         string     `json:"build_id"`
+	Tag        string     `json:"tag"`
+	Status     string     `json:"status"`
+	ImageID    string     `json:"image_id,omitempty"`
+	Error      string     `json:"error,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+	FinishedAt *time.Time `json:"finished_at,omitempty"`
+}
+
+// BuiltImage is an image produced by a build of this runtime.
+type BuiltImage struct {
+	ID      string    `json:"image_id"`
+	Tags    []string  `json:"tags"`
+	BuildID string    `json:"build_id"`
+	Size    int64     `json:"size"`
+	Created time.Time `json:"created"`
+}
+
+// buildMessage is one message of the Docker build output stream.
+type buildMessage struct {
+	Stream      string    `json:"stream"`
+	Status      string    `json:"status"`
+	ID          string    `json:"id"`
+	Progress    *struct{} `json:"progressDetail"`
+	Error       string    `json:"error"`
+	ErrorDetail *struct {
+		Message string `json:"message"`
+	} `json:"errorDetail"`
+	Aux json.RawMessage `json:"aux"`
+}
+
+// StartImageBuild starts building an image in the background and returns the new build.
+// Built images are labelled with the manager's scope, which registers them for ListImages and
+// lets CreateSandbox use the tag without pulling. A tag held by an image the runtime did not
+// build is refused, so builds cannot replace images other users depend on.
+func (m *SandboxManager) StartImageBuild(ctx context.Context, spec ImageBuildSpec) (*ImageBuild, error) {
+	inspectCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	existing, _, err := m.docker().ImageInspectWithRaw(inspectCtx, spec.Tag)
+	if err == nil {
+		if existing.Config == nil || existing.Config.Labels["sandboxai.scope"] != m.scope {
+			return nil, fmt.Errorf("%w: %q", ErrImageTagInUse, spec.Tag)
+		}
+	} else if !client.IsErrNotFound(err) {
+		return nil, backendError("image_inspect_failed", "failed to inspect image "+spec.Tag, err)
+	}
+
+	buildCtx, dockerfile, err := buildContext(spec)
+	if err != nil {
+		return nil, err
+	}
+
+	b := &ImageBuild{
+		ID:        "build-" + uuid.NewString(),
+		Tag:       spec.Tag,
+		Status:    BuildRunning,
+		CreatedAt: time.Now().UTC(),
+	}
+	m.mu.Lock()
+	m.pruneBuildsLocked()
+	m.builds[b.ID] = b
+	m.mu.Unlock()
+
+	opts := types.ImageBuildOptions{
+		Tags:          []string{spec.Tag},
+		RemoteContext: spec.RemoteContext,
+		Dockerfile:    dockerfile,
+		Target:        spec.Target,
+		Remove:        true,
+		ForceRemove:   true,
+		Labels: map[string]string{
+			"sandboxai.scope": m.scope,
+			"sandboxai.build": b.ID,
+		},
+	}
+	if len(spec.BuildArgs) > 0 {
+		opts.BuildArgs = make(map[string]*string, len(spec.BuildArgs))
+		for k, v := range spec.BuildArgs {
+			v := v
+			opts.BuildArgs[k] = &v
+		}
+	}
+	timeout := spec.Timeout
+	if timeout <= 0 {
+		timeout = DefaultBuildTimeout
+	}
+	m.logger.Info("Image build started", "buildID", b.ID, "tag", spec.Tag, "remoteContext", spec.RemoteContext)
+	m.goSafe("image_build", func() { m.runImageBuild(b.ID, buildCtx, opts, timeout) })
+	return b, nil
+}
+
+func (m *SandboxManager) runImageBuild(buildID string, buildCtx io.Reader, opts types.ImageBuildOptions, timeout time.Duration) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	imageID, err := m.streamImageBuild(ctx, buildID, buildCtx, opts)
+	if err == nil && imageID == "" {
+		// Older daemons do not report the image ID in the stream.
+		inspected, _, inspectErr := m.docker().ImageInspectWithRaw(ctx, opts.Tags[0])
+		if inspectErr != nil {
+			err = fmt.Errorf("built image not found: %w", inspectErr)
+		}
+		imageID = inspected.ID
+	}
+	if ctx.Err() == context.DeadlineExceeded {
+		err = fmt.Errorf("build timed out after %s", timeout)
+	}
+
+	now := time.Now().UTC()
+	m.mu.Lock()
+	b := m.builds[buildID]
+	b.FinishedAt = &now
+	if err != nil {
+		b.Status = BuildFailed
+		b.Error = err.Error()
+	} else {
+		b.Status = BuildSucceeded
+		b.ImageID = imageID
+	}
+	m.mu.Unlock()
+
+	if err != nil {
+		m.logger.Warn("Image build failed", "buildID", buildID, "tag", opts.Tags[0], "error", err)
+		m.pushObservation(buildID, buildID, "end", EndObservationData{ExitCode: 1, Error: err.Error()})
+		return
+	}
+	m.logger.Info("Image build succeeded", "buildID", buildID, "tag", opts.Tags[0], "imageID", imageID)
+	m.pushObservation(buildID, buildID, "end", EndObservationData{ExitCode: 0})
+}
+
+// streamImageBuild runs a build, pushing its output as observations, and returns the ID of
+// the built image if the daemon reports it.
+func (m *SandboxManager) streamImageBuild(ctx context.Context, buildID string, buildCtx io.Reader, opts types.ImageBuildOptions) (string, error) {
+	resp, err := m.docker().ImageBuild(ctx, buildCtx, opts)
+	if err != nil {
+		return "", fmt.Errorf("failed to start build: %w", err)
+	}
+	defer resp.Body.Close()
+
+	var imageID string
+	dec := json.NewDecoder(resp.Body)
+	for {
+		var msg buildMessage
+		if err := dec.Decode(&msg); err != nil {
+			if errors.Is(err, io.EOF) {
+				return imageID, nil
+			}
+			return "", fmt.Errorf("failed reading build output: %w", err)
+		}
+		switch {
+		case msg.ErrorDetail != nil || msg.Error != "":
+			if msg.ErrorDetail != nil && msg.ErrorDetail.Message != "" {
+				return "", errors.New(msg.ErrorDetail.Message)
+			}
+			return "", errors.New(msg.Error)
+		case msg.Aux != nil:
+			var aux struct {
+				ID string `json:"ID"`
+			}
+			if json.Unmarshal(msg.Aux, &aux) == nil && aux.ID != "" {
+				imageID = aux.ID
+			}
+		case msg.Stream != "":
+			for _, line := range strings.SplitAfter(msg.Stream, "\n") {
+				if line != "" {
+					m.pushObservation(buildID, buildID, "stream", StreamObservationData{Stream: "stdout", Line: line})
+				}
+			}
+		case msg.Status != "" && msg.Progress == nil:
+			// Layer pull progress updates are dropped; their start and end statuses are kept.
+			line := msg.Status
+			if msg.ID != "" {
+				line = msg.ID + ": " + line
+			}
+			m.pushObservation(buildID, buildID, "stream", StreamObservationData{Stream: "stdout", Line: line + "\n"})
+		}
+	}
+}
+
+// buildContext returns the build context to send to Docker and the Dockerfile path in it.
+// An inline Dockerfile is added to the context archive, which is created if there is none.
+func buildContext(spec ImageBuildSpec) (io.Reader, string, error) {
+	if spec.Dockerfile == "" {
+		if spec.RemoteContext != "" {
+			return nil, spec.DockerfilePath, nil
+		}
+		return bytes.NewReader(spec.Context), spec.DockerfilePath, nil
+	}
+
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	if len(spec.Context) > 0 {
+		if err := copyTar(tw, spec.Context); err != nil {
+			return nil, "", err
+		}
+	}
+	hdr := &tar.Header{Name: inlineDockerfile, Mode: 0o644, Size: int64(len(spec.Dockerfile)), ModTime: time.Now()}
+	if err := tw.WriteHeader(hdr); err != nil {
+		return nil, "", err
+	}
+	if _, err := io.WriteString(tw, spec.Dockerfile); err != nil {
+		return nil, "", err
+	}
+	if err := tw.Close(); err != nil {
+		return nil, "", err
+	}
+	return &buf, inlineDockerfile, nil
+}
+
+// copyTar copies the entries of a tar archive, which may be gzip-compressed, into tw.
+func copyTar(tw *tar.Writer, archive []byte) error {
+	r := bufio.NewReader(bytes.NewReader(archive))
+	var src io.Reader = r
+	if magic, _ := r.Peek(2); len(magic) == 2 && magic[0] == 0x1f && magic[1] == 0x8b {
+		gz, err := gzip.NewReader(r)
+		if err != nil {
+			return fmt.Errorf("%w: %v", ErrInvalidBuildCtx, err)
+		}
+		defer gz.Close()
+		src = gz
+	}
+	tr := tar.NewReader(src)
+	for {
+		hdr, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("%w: %v", ErrInvalidBuildCtx, err)
+		}
+		if hdr.Name == inlineDockerfile {
+			continue
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+		if _, err := io.Copy(tw, tr); err != nil {
+			return fmt.Errorf("%w: %v", ErrInvalidBuildCtx, err)
+		}
+	}
+}
+
+// pruneBuildsLocked forgets the oldest finished builds beyond maxRetainedBuilds. Must be
+// called with m.mu held.
+func (m *SandboxManager) pruneBuildsLocked() {
+	for len(m.builds) >= maxRetainedBuilds {
+		var oldest *ImageBuild
+		for _, b := range m.builds {
+			if b.Status != BuildRunning && (oldest == nil || b.CreatedAt.Before(oldest.CreatedAt)) {
+				oldest = b
+			}
+		}
+		if oldest == nil {
+			return
+		}
+		delete(m.builds, oldest.ID)
+	}
+}
+
+// GetImageBuild returns a copy of a build.
+func (m *SandboxManager) GetImageBuild(ctx context.Context, buildID string) (*ImageBuild, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	b, exists := m.builds[buildID]
+	if !exists {
+		return nil, ErrBuildNotFound
+	}
+	copied := *b
+	return &copied, nil
+}
+
+// BuildExists reports whether a build is known. It lets the build output stream share the
+// WebSocket hub with sandboxes.
+func (m *SandboxManager) BuildExists(ctx context.Context, buildID string) (bool, error) {
+	m.mu.RLock()
+	_, exists := m.builds[buildID]
+	m.mu.RUnlock()
+	return exists, nil
+}
+
+// ListBuildObservations returns a page of a build's recorded output.
+func (m *SandboxManager) ListBuildObservations(ctx context.Context, buildID string, q history.Query) (*history.Page, error) {
+	if m.history == nil {
+		return nil, ErrHistoryDisabled
+	}
+	if exists, _ := m.BuildExists(ctx, buildID); !exists {
+		return nil, ErrBuildNotFound
+	}
+	return m.queryHistory(buildID, q)
+}
+
+// ListImages returns the images built by this runtime. They are found by label, so images
+// built before a restart are included.
+func (m *SandboxManager) ListImages(ctx context.Context) ([]BuiltImage, error) {
+	listCtx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+	summaries, err := m.docker().ImageList(listCtx, image.ListOptions{Filters: filters.NewArgs(
+		filters.Arg("label", "sandboxai.scope="+m.scope),
+		filters.Arg("label", "sandboxai.build"),
+	)})
+	if err != nil {
+		return nil, backendError("image_list_failed", "failed to list images", err)
+	}
+	images := make([]BuiltImage, 0, len(summaries))
+	for _, s := range summaries {
+		tags := s.RepoTags
+		if tags == nil {
+			tags = []string{}
+		}
+		images = append(images, BuiltImage{
+			ID:      s.ID,
+			Tags:    tags,
+			BuildID: s.Labels["sandboxai.build"],
+			Size:    s.Size,
+			Created: time.Unix(s.Created, 0).UTC(),
+		})
+	}
+	return images, nil
+}
@@ -0,0 +1,46 @@
+package manager
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestBuildContext_addsInlineDockerfile(t *testing.T) {
+	var archive bytes.Buffer
+	gz := gzip.NewWriter(&archive)
+	tw := tar.NewWriter(gz)
+	require.NoError(t, tw.WriteHeader(&tar.Header{Name: "app.py", Mode: 0o644, Size: 5}))
+	_, err := tw.Write([]byte("print"))
+	require.NoError(t, err)
+	require.NoError(t, tw.Close())
+	require.NoError(t, gz.Close())
+
+	r, dockerfile, err := buildContext(ImageBuildSpec{Context: archive.Bytes(), Dockerfile: "FROM python:3.12-slim\n"})
+	require.NoError(t, err)
+	require.Equal(t, inlineDockerfile, dockerfile)
+
+	files := map[string]string{}
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		require.NoError(t, err)
+		data, err := io.ReadAll(tr)
+		require.NoError(t, err)
+		files[hdr.Name] = string(data)
+	}
+	require.Equal(t, map[string]string{"app.py": "print", inlineDockerfile: "FROM python:3.12-slim\n"}, files)
+}
+
+func TestBuildContext_rejectsInvalidArchive(t *testing.T) {
+	_, _, err := buildContext(ImageBuildSpec{Context: []byte("not a tar archive at all"), Dockerfile: "FROM scratch\n"})
+	require.ErrorIs(t, err, ErrInvalidBuildCtx)
+}
@@ -0,0 +1,95 @@
+package manager
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/foreveryh/sandboxai/go/mentisruntime/ws"
+)
+
+// outputChunkBytes is the most output read from the agent per binary frame.
+const outputChunkBytes = 64 * 1024
+
+var (
+	ErrActionNotFound = newError(KindNotFound, "action_not_found", "action is not running")
+	ErrInvalidStream  = newError(KindInvalid, "invalid_stream", `stream must be "stdout" or "stderr"`)
+)
+
+// chunkBuffers holds the buffers output is read into before it is copied into its frame.
+var chunkBuffers = sync.Pool{New: func() any { return new([outputChunkBytes]byte) }}
+
+// ReceiveOutputStream relays the raw output an agent streams for an action started with
+// "large_output" to the sandbox's stream clients, as binary frames (see ws.ParseOutputFrame)
+// sent as the output arrives. The output is not recorded in the observation history. It
+// counts against the action's output limit like stream observations: output beyond it is
+// dropped after a "truncated" observation, and only kept in the saved full output.
+func (m *SandboxManager) ReceiveOutputStream(sandboxID, actionID, stream string, body io.Reader) error {
+	code, ok := ws.StreamCode(stream)
+	if !ok {
+		return fmt.Errorf("%w: %q", ErrInvalidStream, stream)
+	}
+	m.mu.RLock()
+	owner, active := m.activeActions[actionID]
+	m.mu.RUnlock()
+	if !active || owner != sandboxID || len(actionID) > ws.MaxFrameActionID {
+		return fmt.Errorf("%w: %q", ErrActionNotFound, actionID)
+	}
+
+	header := ws.AppendOutputHeader(nil, actionID, code)
+	buf := chunkBuffers.Get().(*[outputChunkBytes]byte)
+	defer chunkBuffers.Put(buf)
+	var relayed int64
+	for {
+		n, err := body.Read(buf[:])
+		if n > 0 {
+			// Masking is per chunk: a credential split across two reads is not masked
+			chunk, limitReached := m.limitOutputChunk(sandboxID, actionID, m.redactor.Bytes(buf[:n]))
+			if len(chunk) > 0 && m.hub != nil {
+				// The frame is the only copy: the hub sends these bytes to every client.
+				frame := make([]byte, 0, len(header)+len(chunk))
+				m.hub.SubmitBinary(sandboxID, append(append(frame, header...), chunk...))
+				relayed += int64(len(chunk))
+			}
+			if limitReached {
+				m.pushTruncatedObservation(sandboxID, actionID)
+			}
+		}
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("read %s of action %q: %w", stream, actionID, err)
+		}
+	}
+	m.logger.Debug("Output stream ended", "sandboxID", sandboxID, "actionID", actionID, "stream", stream, "relayedBytes", relayed)
+	return nil
+}
+
+// limitOutputChunk counts a chunk of raw output against the action's output limit. It
+// returns the part to relay, cut at the limit, and whether this chunk reached the limit.
+// The whole chunk is spooled.
+func (m *SandboxManager) limitOutputChunk(sandboxID, actionID string, chunk []byte) ([]byte, bool) {
+	limit := m.outputLimits.MaxActionBytes
+	m.mu.Lock()
+	out := m.actionOutputLocked(sandboxID, actionID)
+	relay, limitReached := chunk, false
+	switch {
+	case out.truncated:
+		relay = nil
+	case limit > 0 && out.bytes+int64(len(chunk)) > limit:
+		relay = chunk[:limit-out.bytes]
+		out.truncated = true
+		limitReached = true
+		outputTruncated.With("action").Inc()
+	}
+	out.bytes += int64(len(relay))
+	m.mu.Unlock()
+
+	m.spoolOutput(out, actionID, chunk)
+	if limitReached {
+		m.logger.Warn("Action output limit reached, dropping further output", "sandboxID", sandboxID, "actionID", actionID, "limit", limit)
+	}
+	return relay, limitReached
+}
@@ -0,0 +1,42 @@
+package manager
+
+import (
+	"io"
+	"log/slog"
+	"strings"
+	"testing"
+	"testing/iotest"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/foreveryh/sandboxai/go/mentisruntime/history"
+)
+
+func TestReceiveOutputStream_limitsOutput(t *testing.T) {
+	store, err := history.NewStore("", 0)
+	require.NoError(t, err)
+	m := &SandboxManager{
+		logger:        slog.New(slog.NewTextHandler(io.Discard, nil)),
+		history:       store,
+		activeActions: map[string]string{"a1": "sb"},
+		outputs:       make(map[string]*actionOutput),
+		outputLimits:  OutputLimits{MaxActionBytes: 10},
+	}
+
+	body := iotest.HalfReader(strings.NewReader(strings.Repeat("x", 25)))
+	require.NoError(t, m.ReceiveOutputStream("sb", "a1", "stdout", body))
+	require.EqualValues(t, 10, m.outputs["a1"].bytes)
+	require.True(t, m.outputs["a1"].truncated)
+
+	page, err := store.Query("sb", history.Query{Types: []string{"truncated"}})
+	require.NoError(t, err)
+	require.Len(t, page.Observations, 1, "the limit is reported once")
+
+	chunk, limitReached := m.limitOutputChunk("sb", "a1", []byte("more"))
+	require.Empty(t, chunk)
+	require.False(t, limitReached)
+
+	require.ErrorIs(t, m.ReceiveOutputStream("sb", "a1", "stdin", body), ErrInvalidStream)
+	require.ErrorIs(t, m.ReceiveOutputStream("other", "a1", "stdout", body), ErrActionNotFound)
+	require.ErrorIs(t, m.ReceiveOutputStream("sb", "a2", "stdout", body), ErrActionNotFound)
+}
@@ -0,0 +1,132 @@
+package manager
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/image"
+	"github.com/google/uuid"
+)
+
+// cloneImageRepo is the local repository holding committed clone images.
+const cloneImageRepo = "sandboxai-clone"
+
+// ErrCloneSecretFiles is returned for sandboxes with secret files, which committing the
+// container would copy into the clone image.
+var ErrCloneSecretFiles = newError(KindConflict, "clone_secret_files", "sandboxes with secret files cannot be cloned")
+
+// CloneSandbox commits the filesystem of a sandbox's container to an image and starts a new
+// sandbox from it in targetSpaceID (the source's space if empty). Env, secret references,
+// security settings and user labels are copied from the source. The image is removed when
+// the clone is deleted. Content of tmpfs mounts is not part of the clone. Sandboxes with
+// secret files are not cloned.
+func (m *SandboxManager) CloneSandbox(ctx context.Context, sandboxID, targetSpaceID string) (string, error) {
+	m.mu.RLock()
+	source, exists := m.sandboxes[sandboxID]
+	var src SandboxState
+	if exists {
+		src = *source
+	}
+	m.mu.RUnlock()
+	if !exists {
+		return "", ErrSandboxNotFound
+	}
+	for _, ref := range src.Secrets {
+		if ref.File != "" {
+			return "", fmt.Errorf("%w: %s is written to %s", ErrCloneSecretFiles, ref.Name, ref.File)
+		}
+	}
+	if targetSpaceID == "" {
+		targetSpaceID = src.SpaceID
+	}
+	if _, err := m.spaceManager.GetSpace(ctx, targetSpaceID); err != nil {
+		return "", err
+	}
+
+	inspectCtx, inspectCancel := context.WithTimeout(ctx, 10*time.Second)
+	inspect, err := m.docker().ContainerInspect(inspectCtx, src.ContainerID)
+	inspectCancel()
+	if err != nil {
+		return "", backendError("container_inspect_failed", "failed to inspect source container", err)
+	}
+	var labels map[string]string
+	if inspect.Config != nil {
+		labels = userLabels(inspect.Config.Labels)
+	}
+
+	imageRef := cloneImageRepo + ":" + uuid.NewString()
+	commitCtx, commitCancel := context.WithTimeout(ctx, 5*time.Minute)
+	defer commitCancel()
+	_, err = m.docker().ContainerCommit(commitCtx, src.ContainerID, container.CommitOptions{
+		Reference: imageRef,
+		Comment:   "sandboxai clone of " + sandboxID,
+		Pause:     true,
+		// Docker merges the container's env into the image config; blanking the secret
+		// variables keeps their values out of it. The clone gets fresh values on creation.
+		Config: &container.Config{Env: cloneImageEnv(src.Secrets)},
+		Changes: []string{
+			fmt.Sprintf("LABEL sandboxai.scope=%q", m.scope),
+			fmt.Sprintf("LABEL sandboxai.clone-of=%q", sandboxID),
+		},
+	})
+	if err != nil {
+		return "", backendError("container_commit_failed", "failed to commit source container", err)
+	}
+	m.logger.Info("Committed sandbox for clone", "sandboxID", sandboxID, "image", imageRef)
+
+	cloneID, err := m.CreateSandbox(ctx, targetSpaceID, SandboxSpec{
+		Image:           imageRef,
+		Env:             src.Env,
+		Secrets:         src.Secrets,
+		SecurityProfile: src.SecurityProfile,
+		SeccompProfile:  src.SeccompProfile,
+		AppArmorProfile: src.AppArmorProfile,
+		Tmpfs:           src.Tmpfs,
+		DiskLimit:       src.DiskLimit,
+		Ulimits:         src.Ulimits,
+		Workdir:         src.Workdir,
+		Command:         src.Command,
+		Entrypoint:      src.Entrypoint,
+		DNS:             src.DNS,
+		DNSSearch:       src.DNSSearch,
+		ExtraHosts:      src.ExtraHosts,
+		Network:         src.Network,
+		IPv6:            src.IPv6,
+		Platform:        src.Platform,
+		Sidecars:        sidecarSpecs(src.Sidecars),
+		Volumes:         src.Volumes,
+		PrivateNetworks: src.PrivateNetworks,
+		User:            src.User,
+		Labels:          labels,
+		ActionQueue:     src.ActionQueue,
+		Jupyter:         src.Jupyter,
+		ClonedFrom:      sandboxID,
+	})
+	if err != nil {
+		m.removeCloneImage(imageRef)
+		return "", err
+	}
+	m.logger.Info("Sandbox cloned", "sourceSandboxID", sandboxID, "sandboxID", cloneID, "spaceID", targetSpaceID)
+	return cloneID, nil
+}
+
+// cloneImageEnv returns empty assignments for the runtime-provided variables of a sandbox.
+func cloneImageEnv(secrets []SecretRef) []string {
+	env := []string{"SANDBOX_ID=", "RUNTIME_OBSERVATION_URL=", "OBSERVATION_ENCODING=", jupyterTokenEnv + "=", jupyterBaseURLEnv + "="}
+	for _, ref := range secrets {
+		if name, ok := secretEnvName(ref); ok {
+			env = append(env, name+"=")
+		}
+	}
+	return env
+}
+
+func (m *SandboxManager) removeCloneImage(imageRef string) {
+	rmCtx, rmCancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer rmCancel()
+	if _, err := m.docker().ImageRemove(rmCtx, imageRef, image.RemoveOptions{PruneChildren: true}); err != nil {
+		m.logger.Error("Failed to remove clone image", "image", imageRef, "error", err)
+	}
+}
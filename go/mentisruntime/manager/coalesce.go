@@ -0,0 +1,191 @@
+package manager
+
+import (
+	"encoding/json"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/foreveryh/sandboxai/go/mentisruntime/history"
+)
+
+// Coalescing defaults, used when a policy sets only one of its limits.
+const (
+	defaultCoalesceWindow   = 100 * time.Millisecond
+	defaultCoalesceMaxBytes = 64 * 1024
+)
+
+// CoalescePolicy batches the consecutive text "stream" observations of an action into one
+// observation, sent when the first batched line is Window old or the batch holds MaxBytes,
+// and before any other observation of the action so ordering is preserved. A zero policy
+// sends every line as it comes.
+type CoalescePolicy struct {
+	Window   time.Duration
+	MaxBytes int
+}
+
+func (p CoalescePolicy) enabled() bool {
+	return p.Window > 0 || p.MaxBytes > 0
+}
+
+// WithStreamCoalescing sets the coalescing policy of actions whose request has no
+// "coalesce" object.
+func WithStreamCoalescing(policy CoalescePolicy) Option {
+	return func(m *SandboxManager) {
+		m.coalesce = policy
+	}
+}
+
+// actionCoalescePolicy reads the optional "coalesce" object of an action payload,
+// {"window_ms": 50, "max_bytes": 16384}, falling back to def. Zeros in the object disable
+// coalescing for the action.
+func actionCoalescePolicy(payload map[string]interface{}, def CoalescePolicy) CoalescePolicy {
+	spec, ok := payload["coalesce"].(map[string]interface{})
+	if !ok {
+		return def
+	}
+	windowMS, _ := spec["window_ms"].(float64) // JSON numbers
+	maxBytes, _ := spec["max_bytes"].(float64)
+	return CoalescePolicy{Window: time.Duration(windowMS) * time.Millisecond, MaxBytes: int(maxBytes)}
+}
+
+// streamBatch holds the stream lines of an action waiting to be sent together.
+type streamBatch struct {
+	mu        sync.Mutex // Held while the batch is sent, so sends keep their order
+	sandboxID string
+	actionID  string
+	window    time.Duration
+	maxBytes  int
+
+	stream    string
+	streamSeq uint64 // stream_seq of the first batched line
+	text      strings.Builder
+	lines     int
+	truncated bool
+	first     time.Time // Timestamp of the first batched line
+	timer     *time.Timer
+}
+
+// CoalescedStreamObservation is the message sent for a batch: the format of the agent's
+// "stream" observations, with the batched lines in Line, separated by newlines, and their
+// number in Coalesced.
+type CoalescedStreamObservation struct {
+	ObservationType string `json:"observation_type"` // "stream"
+	ActionID        string `json:"action_id"`
+	Timestamp       string `json:"timestamp"`
+	Stream          string `json:"stream"`
+	Line            string `json:"line"`
+	Coalesced       int    `json:"coalesced"`
+	Truncated       bool   `json:"truncated,omitempty"`  // Some line was cut by the output limits
+	StreamSeq       uint64 `json:"stream_seq,omitempty"` // Of the first line; the others follow it
+}
+
+// startCoalescingLocked sets up the batch of an action if its policy coalesces. Callers must
+// hold m.mu.
+func (m *SandboxManager) startCoalescingLocked(sandboxID, actionID string, policy CoalescePolicy) {
+	if !policy.enabled() {
+		return
+	}
+	if policy.Window <= 0 {
+		policy.Window = defaultCoalesceWindow
+	}
+	if policy.MaxBytes <= 0 {
+		policy.MaxBytes = defaultCoalesceMaxBytes
+	}
+	if m.batches == nil {
+		m.batches = make(map[string]*streamBatch)
+	}
+	m.batches[actionID] = &streamBatch{sandboxID: sandboxID, actionID: actionID, window: policy.Window, maxBytes: policy.MaxBytes}
+}
+
+// coalesceLine adds a text stream observation of a sandbox to its action's batch. It reports
+// false if the action does not coalesce, and the observation must be sent on its own.
+func (m *SandboxManager) coalesceLine(sandboxID string, obs *internalObservation) bool {
+	if obs.Line == nil || obs.Encoding == EncodingBase64 {
+		return false
+	}
+	m.mu.RLock()
+	b := m.batches[obs.ActionID]
+	m.mu.RUnlock()
+	if b == nil || b.sandboxID != sandboxID {
+		return false
+	}
+	stream := obs.Stream
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.lines > 0 && b.stream != stream {
+		m.sendBatchLocked(b)
+	}
+	if b.lines == 0 {
+		b.stream = stream
+		b.streamSeq = obs.StreamSeq
+		b.first = obs.Timestamp
+		if b.first.IsZero() {
+			b.first = time.Now().UTC()
+		}
+		b.timer = time.AfterFunc(b.window, func() { m.flushBatch(b) })
+	} else if t := b.text.String(); !strings.HasSuffix(t, "\n") {
+		b.text.WriteByte('\n')
+	}
+	b.text.WriteString(*obs.Line)
+	b.lines++
+	b.truncated = b.truncated || obs.Truncated
+	if b.text.Len() >= b.maxBytes {
+		m.sendBatchLocked(b)
+	}
+	return true
+}
+
+// flushBatchOf sends the pending lines of an action, if any, before another observation of
+// the action is sent.
+func (m *SandboxManager) flushBatchOf(actionID string) {
+	m.mu.RLock()
+	b := m.batches[actionID]
+	m.mu.RUnlock()
+	if b != nil {
+		m.flushBatch(b)
+	}
+}
+
+func (m *SandboxManager) flushBatch(b *streamBatch) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	m.sendBatchLocked(b)
+}
+
+// sendBatchLocked sends and empties a batch. Callers must hold b.mu.
+func (m *SandboxManager) sendBatchLocked(b *streamBatch) {
+	if b.lines == 0 {
+		return
+	}
+	b.timer.Stop()
+	msg, err := json.Marshal(CoalescedStreamObservation{
+		ObservationType: "stream",
+		ActionID:        b.actionID,
+		Timestamp:       b.first.Format(time.RFC3339Nano),
+		Stream:          b.stream,
+		Line:            b.text.String(),
+		Coalesced:       b.lines,
+		Truncated:       b.truncated,
+		StreamSeq:       b.streamSeq,
+	})
+	b.text.Reset()
+	b.lines, b.truncated = 0, false
+	if err != nil {
+		m.logger.Error("Failed to marshal coalesced stream observation", "actionID", b.actionID, "error", err)
+		return
+	}
+	m.sendObservation(b.sandboxID, history.Meta{ObservationType: "stream", ActionID: b.actionID, Timestamp: b.first}, msg)
+}
+
+// stopCoalescing sends the pending lines of an ended action and forgets its batch.
+func (m *SandboxManager) stopCoalescing(actionID string) {
+	m.mu.Lock()
+	b := m.batches[actionID]
+	delete(m.batches, actionID)
+	m.mu.Unlock()
+	if b != nil {
+		m.flushBatch(b)
+	}
+}
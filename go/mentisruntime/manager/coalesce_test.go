@@ -0,0 +1,58 @@
+package manager
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/foreveryh/sandboxai/go/mentisruntime/history"
+)
+
+func TestActionCoalescePolicy(t *testing.T) {
+	def := CoalescePolicy{Window: time.Second}
+	require.Equal(t, def, actionCoalescePolicy(map[string]interface{}{"command": "ls"}, def))
+	require.Equal(t, CoalescePolicy{Window: 50 * time.Millisecond, MaxBytes: 1024},
+		actionCoalescePolicy(map[string]interface{}{"coalesce": map[string]interface{}{"window_ms": float64(50), "max_bytes": float64(1024)}}, def))
+	require.False(t, actionCoalescePolicy(map[string]interface{}{"coalesce": map[string]interface{}{}}, def).enabled())
+}
+
+func TestCoalesceLine_batchesLinesInOrder(t *testing.T) {
+	m := newObservationTestManager(t)
+	m.startCoalescingLocked("sb", "a", CoalescePolicy{Window: time.Hour, MaxBytes: 8})
+
+	stream := func(line string) string {
+		return `{"observation_type":"stream","action_id":"a","timestamp":"2025-01-02T03:04:05Z","stream":"stdout","line":"` + line + `"}`
+	}
+	require.NoError(t, m.ReceiveInternalObservation("sb", []byte(stream(`one\n`))))
+	require.NoError(t, m.ReceiveInternalObservation("sb", []byte(stream(`two\n`)))) // Reaches MaxBytes
+	require.NoError(t, m.ReceiveInternalObservation("sb", []byte(stream(`three`))))
+	require.NoError(t, m.ReceiveInternalObservation("sb", []byte(`{"observation_type":"start","action_id":"a"}`)))
+
+	page, err := m.history.Query("sb", history.Query{})
+	require.NoError(t, err)
+	require.Len(t, page.Observations, 3)
+
+	var batches []CoalescedStreamObservation
+	for _, rec := range page.Observations[:2] {
+		var batch CoalescedStreamObservation
+		require.NoError(t, json.Unmarshal(rec.Observation, &batch))
+		batches = append(batches, batch)
+	}
+	require.Equal(t, "one\ntwo\n", batches[0].Line)
+	require.Equal(t, 2, batches[0].Coalesced)
+	require.Equal(t, "three", batches[1].Line)
+	require.Equal(t, 1, batches[1].Coalesced)
+	require.Equal(t, "start", page.Observations[2].ObservationType)
+
+	// Ended actions send their pending lines, later lines go out on their own.
+	require.NoError(t, m.ReceiveInternalObservation("sb", []byte(stream(`four`))))
+	m.stopCoalescing("a")
+	require.NoError(t, m.ReceiveInternalObservation("sb", []byte(stream(`five`))))
+	page, err = m.history.Query("sb", history.Query{})
+	require.NoError(t, err)
+	require.Len(t, page.Observations, 5)
+	require.Contains(t, string(page.Observations[3].Observation), `"coalesced":1`)
+	require.JSONEq(t, stream(`five`), string(page.Observations[4].Observation))
+}
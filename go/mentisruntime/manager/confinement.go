@@ -0,0 +1,124 @@
+package manager
+
+import (
+	_ "embed"
+	"fmt"
+	"slices"
+	"sort"
+)
+
+// denyDangerousSeccomp is the seccomp profile of SeccompProfileDenyDangerous.
+//
+//go:embed seccomp/deny-dangerous.json
+var denyDangerousSeccomp string
+
+var (
+	ErrUnknownSeccompProfile  = newError(KindInvalid, "unknown_seccomp_profile", "unknown seccomp profile")
+	ErrUnknownAppArmorProfile = newError(KindInvalid, "unknown_apparmor_profile", "unknown AppArmor profile")
+)
+
+// Seccomp profiles shipped with the runtime. Host-provided ones are added with
+// WithSeccompProfiles.
+const (
+	SeccompProfileDockerDefault = "docker-default" // Docker's default profile
+	// SeccompProfileDenyDangerous allows every syscall but those loading kernel code, changing
+	// mounts, namespaces, keyrings, memory policies or the clock, using io_uring, and tracing
+	// other processes. It denies them whatever the capabilities of the container, and replaces
+	// Docker's default profile. It is not the default: Docker's profile is an allowlist, which
+	// already blocks these for containers without added capabilities and also blocks syscalls
+	// unknown to it, so replacing it everywhere would loosen sandboxes.
+	SeccompProfileDenyDangerous = "deny-dangerous"
+)
+
+// AppArmorProfileDockerDefault is the AppArmor profile Docker applies on hosts with AppArmor.
+// Other profiles must be loaded on the host and listed with WithAppArmorProfiles.
+const AppArmorProfileDockerDefault = "docker-default"
+
+// WithSeccompProfiles adds host-provided seccomp profiles, JSON documents by name, that
+// sandboxes can choose. They cannot replace the shipped profiles.
+func WithSeccompProfiles(profiles map[string]string) Option {
+	return func(m *SandboxManager) {
+		if m.seccompProfiles == nil {
+			m.seccompProfiles = make(map[string]string)
+		}
+		for name, profileJSON := range profiles {
+			m.seccompProfiles[name] = profileJSON
+		}
+	}
+}
+
+// WithDefaultSeccompProfile selects the seccomp profile of sandboxes that choose none and
+// whose security profile has none of its own. By default they keep Docker's.
+func WithDefaultSeccompProfile(name string) Option {
+	return func(m *SandboxManager) {
+		m.defaultSeccompProfile = name
+	}
+}
+
+// WithAppArmorProfiles lists the AppArmor profiles loaded on the host that sandboxes can
+// choose, besides AppArmorProfileDockerDefault.
+func WithAppArmorProfiles(names ...string) Option {
+	return func(m *SandboxManager) {
+		m.appArmorProfiles = append(m.appArmorProfiles, names...)
+	}
+}
+
+// SeccompProfiles returns the names of the seccomp profiles sandboxes can choose, sorted.
+func (m *SandboxManager) SeccompProfiles() []string {
+	names := []string{SeccompProfileDockerDefault, SeccompProfileDenyDangerous}
+	for name := range m.seccompProfiles {
+		if !slices.Contains(names, name) {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// AppArmorProfiles returns the names of the AppArmor profiles sandboxes can choose, sorted.
+func (m *SandboxManager) AppArmorProfiles() []string {
+	names := []string{AppArmorProfileDockerDefault}
+	for _, name := range m.appArmorProfiles {
+		if !slices.Contains(names, name) {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// applyConfinement sets the seccomp and AppArmor profiles a spec chooses on its security
+// profile. Security profiles with a seccomp profile of their own, such as hardened with one
+// set by WithSeccompProfile, keep it: choosing another is an error, as it could weaken it. It
+// returns the names of the profiles applied, empty for those left as they were.
+func (m *SandboxManager) applyConfinement(spec SandboxSpec, profile *SecurityProfile) (seccomp, appArmor string, err error) {
+	seccomp = spec.SeccompProfile
+	if seccomp != "" && profile.Seccomp != "" {
+		return "", "", fmt.Errorf("%w: profile %q has its own seccomp profile", ErrIncompatibleSecurityProfile, profile.Name)
+	}
+	if seccomp == "" && profile.Seccomp == "" {
+		seccomp = m.defaultSeccompProfile
+	}
+	switch seccomp {
+	case "":
+	case SeccompProfileDockerDefault:
+		profile.Seccomp = ""
+	case SeccompProfileDenyDangerous:
+		profile.Seccomp = denyDangerousSeccomp
+	default:
+		profileJSON, ok := m.seccompProfiles[seccomp]
+		if !ok {
+			return "", "", fmt.Errorf("%w: %s", ErrUnknownSeccompProfile, seccomp)
+		}
+		profile.Seccomp = profileJSON
+	}
+
+	appArmor = spec.AppArmorProfile
+	if appArmor != "" {
+		if appArmor != AppArmorProfileDockerDefault && !slices.Contains(m.appArmorProfiles, appArmor) {
+			return "", "", fmt.Errorf("%w: %s", ErrUnknownAppArmorProfile, appArmor)
+		}
+		profile.AppArmor = appArmor
+	}
+	return seccomp, appArmor, nil
+}
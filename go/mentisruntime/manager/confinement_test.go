@@ -0,0 +1,65 @@
+package manager
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestDenyDangerousSeccomp(t *testing.T) {
+	var profile struct {
+		DefaultAction string `json:"defaultAction"`
+		Syscalls      []struct {
+			Names  []string `json:"names"`
+			Action string   `json:"action"`
+		} `json:"syscalls"`
+	}
+	require.NoError(t, json.Unmarshal([]byte(denyDangerousSeccomp), &profile))
+	require.Equal(t, "SCMP_ACT_ALLOW", profile.DefaultAction)
+	denied := map[string]bool{}
+	for _, rule := range profile.Syscalls {
+		require.Equal(t, "SCMP_ACT_ERRNO", rule.Action)
+		for _, name := range rule.Names {
+			denied[name] = true
+		}
+	}
+	for _, name := range []string{"mount", "ptrace", "init_module", "kexec_load", "bpf", "unshare", "setns", "clone3", "io_uring_setup", "io_uring_enter", "io_uring_register", "set_mempolicy"} {
+		require.True(t, denied[name], name)
+	}
+	require.False(t, denied["execve"])
+}
+
+func TestApplyConfinement(t *testing.T) {
+	m := &SandboxManager{seccompProfiles: map[string]string{"deny-dangerous": "{}", "host": `{"a":1}`}, defaultSeccompProfile: SeccompProfileDenyDangerous}
+
+	// The default applies to profiles without seccomp; host profiles cannot shadow shipped ones
+	profile := SecurityProfile{}
+	seccomp, appArmor, err := m.applyConfinement(SandboxSpec{}, &profile)
+	require.NoError(t, err)
+	require.Equal(t, SeccompProfileDenyDangerous, seccomp)
+	require.Empty(t, appArmor)
+	require.Equal(t, denyDangerousSeccomp, profile.Seccomp)
+
+	profile = SecurityProfile{}
+	_, _, err = m.applyConfinement(SandboxSpec{SeccompProfile: SeccompProfileDockerDefault, AppArmorProfile: AppArmorProfileDockerDefault}, &profile)
+	require.NoError(t, err)
+	require.Empty(t, profile.Seccomp)
+	require.Equal(t, AppArmorProfileDockerDefault, profile.AppArmor)
+
+	// A security profile's own seccomp profile is neither replaced by the default nor by a choice
+	profile = SecurityProfile{Name: SecurityProfileHardened, Seccomp: "hardened"}
+	seccomp, _, err = m.applyConfinement(SandboxSpec{}, &profile)
+	require.NoError(t, err)
+	require.Empty(t, seccomp)
+	require.Equal(t, "hardened", profile.Seccomp)
+	for _, name := range []string{SeccompProfileDockerDefault, SeccompProfileDenyDangerous, "host"} {
+		_, _, err = m.applyConfinement(SandboxSpec{SeccompProfile: name}, &profile)
+		require.ErrorIs(t, err, ErrIncompatibleSecurityProfile, name)
+		require.Equal(t, "hardened", profile.Seccomp)
+	}
+
+	_, _, err = m.applyConfinement(SandboxSpec{AppArmorProfile: "other"}, &profile)
+	require.ErrorIs(t, err, ErrUnknownAppArmorProfile)
+	require.Equal(t, []string{"deny-dangerous", "docker-default", "host"}, m.SeccompProfiles())
+}
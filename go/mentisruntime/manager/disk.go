@@ -0,0 +1,176 @@
+package manager
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/docker/docker/api/types/container"
+	units "github.com/docker/go-units"
+)
+
+var ErrInvalidDiskLimit = newError(KindInvalid, "invalid_disk_limit", "invalid disk limit")
+
+// SandboxStats reports resource usage of a sandbox.
+type SandboxStats struct {
+	SandboxID      string    `json:"sandbox_id"`
+	DiskUsageBytes int64     `json:"disk_usage_bytes"`          // Size of the container's writable layer
+	DiskLimit      string    `json:"disk_limit,omitempty"`      // storage-opt size requested at creation
+	DiskKillBytes  int64     `json:"disk_kill_bytes,omitempty"` // Usage above which the monitor kills the sandbox
+	CheckedAt      time.Time `json:"checked_at"`
+}
+
+// SandboxKilledObservationData is pushed when the runtime kills a sandbox.
+type SandboxKilledObservationData struct {
+	Reason         string `json:"reason"`
+	DiskUsageBytes int64  `json:"disk_usage_bytes,omitempty"`
+	LimitBytes     int64  `json:"limit_bytes,omitempty"`
+}
+
+// WithDiskMonitor periodically measures sandbox disk usage. If killThreshold is positive,
+// sandboxes whose writable layer grows beyond it are killed.
+func WithDiskMonitor(interval time.Duration, killThreshold int64) Option {
+	return func(m *SandboxManager) {
+		m.diskCheckInterval = interval
+		m.diskKillThreshold = killThreshold
+	}
+}
+
+// validateDiskLimit checks a storage-opt size value such as "10G".
+func validateDiskLimit(limit string) error {
+	if limit == "" {
+		return nil
+	}
+	if _, err := units.RAMInBytes(limit); err != nil {
+		return fmt.Errorf("%w %q: %v", ErrInvalidDiskLimit, limit, err)
+	}
+	return nil
+}
+
+// GetSandboxStats measures the current disk usage of a sandbox.
+func (m *SandboxManager) GetSandboxStats(ctx context.Context, sandboxID string) (*SandboxStats, error) {
+	m.mu.RLock()
+	state, exists := m.sandboxes[sandboxID]
+	m.mu.RUnlock()
+	if !exists {
+		return nil, ErrSandboxNotFound
+	}
+
+	usage, err := m.containerDiskUsage(ctx, state.ContainerID)
+	if err != nil {
+		return nil, err
+	}
+	stats := &SandboxStats{
+		SandboxID:      sandboxID,
+		DiskUsageBytes: usage,
+		DiskLimit:      state.DiskLimit,
+		DiskKillBytes:  m.diskKillThreshold,
+		CheckedAt:      time.Now().UTC(),
+	}
+
+	m.mu.Lock()
+	m.stats[sandboxID] = stats
+	m.mu.Unlock()
+	return stats, nil
+}
+
+// containerDiskUsage returns the size of a container's writable layer in bytes.
+func (m *SandboxManager) containerDiskUsage(ctx context.Context, containerID string) (int64, error) {
+	inspectCtx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+	info, _, err := m.docker().ContainerInspectWithRaw(inspectCtx, containerID, true)
+	if err != nil {
+		return 0, fmt.Errorf("failed to inspect container size: %w", err)
+	}
+	if info.SizeRw == nil {
+		return 0, nil
+	}
+	return *info.SizeRw, nil
+}
+
+// runDiskMonitor checks the disk usage of every running sandbox until ctx is done.
+func (m *SandboxManager) runDiskMonitor(ctx context.Context) {
+	ticker := time.NewTicker(m.diskCheckInterval)
+	defer ticker.Stop()
+	m.logger.Info("Disk monitor started", "interval", m.diskCheckInterval, "killThreshold", m.diskKillThreshold)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			m.checkDiskUsage(ctx)
+		}
+	}
+}
+
+func (m *SandboxManager) checkDiskUsage(ctx context.Context) {
+	m.mu.RLock()
+	var running []string
+	for id, state := range m.sandboxes {
+		if state.IsRunning {
+			running = append(running, id)
+		}
+	}
+	m.mu.RUnlock()
+
+	for _, sandboxID := range running {
+		m.mu.RLock()
+		previous := m.stats[sandboxID]
+		m.mu.RUnlock()
+		stats, err := m.GetSandboxStats(ctx, sandboxID)
+		if err != nil {
+			m.logger.Warn("Disk usage check failed", "sandboxID", sandboxID, "error", err)
+			continue
+		}
+		if m.diskKillThreshold > 0 && stats.DiskUsageBytes > m.diskKillThreshold {
+			m.killForDiskUsage(ctx, sandboxID, stats.DiskUsageBytes)
+		} else if warn := int64(float64(m.diskKillThreshold) * diskWarnRatio); warn > 0 && stats.DiskUsageBytes > warn && (previous == nil || previous.DiskUsageBytes <= warn) {
+			// Warn once per crossing, not on every check
+			m.warnDiskUsage(sandboxID, stats.DiskUsageBytes)
+		}
+	}
+}
+
+// killForDiskUsage kills a sandbox that exceeded the disk threshold. Its state is kept so
+// clients can still inspect and delete it.
+func (m *SandboxManager) killForDiskUsage(ctx context.Context, sandboxID string, usage int64) {
+	m.mu.Lock()
+	state, exists := m.sandboxes[sandboxID]
+	if !exists || !state.IsRunning {
+		m.mu.Unlock()
+		return
+	}
+	change, changed := m.transition(state, PhaseFailed, "disk_limit_exceeded")
+	containerID := state.ContainerID
+	m.mu.Unlock()
+	m.announcePhase(sandboxID, change, changed)
+
+	m.logger.Warn("Killing sandbox over disk threshold", "sandboxID", sandboxID, "usage", usage, "threshold", m.diskKillThreshold)
+	killCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	if err := m.docker().ContainerKill(killCtx, containerID, "SIGKILL"); err != nil {
+		m.logger.Error("Failed to kill sandbox container", "sandboxID", sandboxID, "containerID", containerID, "error", err)
+	}
+	m.pushObservation(sandboxID, "", "sandbox_killed", SandboxKilledObservationData{
+		Reason:         "disk_limit_exceeded",
+		DiskUsageBytes: usage,
+		LimitBytes:     m.diskKillThreshold,
+	})
+}
+
+// applyStorageLimits maps tmpfs mounts and the disk limit onto the host config.
+func applyStorageLimits(spec SandboxSpec, hostCfg *container.HostConfig) {
+	if len(spec.Tmpfs) > 0 {
+		if hostCfg.Tmpfs == nil {
+			hostCfg.Tmpfs = make(map[string]string)
+		}
+		for mountPath, opts := range spec.Tmpfs {
+			hostCfg.Tmpfs[mountPath] = opts
+		}
+	}
+	if spec.DiskLimit != "" {
+		// Only honoured by storage drivers with quota support (e.g. overlay2 on xfs with pquota).
+		hostCfg.StorageOpt = map[string]string{"size": spec.DiskLimit}
+	}
+}
@@ -0,0 +1,181 @@
+package manager
+
+import (
+	"context"
+	"time"
+
+	"github.com/docker/docker/client"
+
+	"github.com/foreveryh/sandboxai/go/mentisruntime/metrics"
+)
+
+// Backoff between attempts to reconnect to the Docker daemon.
+const (
+	reconnectInitialBackoff = 500 * time.Millisecond
+	reconnectMaxBackoff     = 10 * time.Second
+)
+
+var (
+	dockerReconnects = metrics.Default.NewCounter("sandboxai_docker_reconnects_total",
+		"Reconnections to the Docker daemon after it stopped answering.")
+	dockerConnected = metrics.Default.NewGauge("sandboxai_docker_connected",
+		"Whether the Docker daemon answered the last check of the connection (1) or is being reconnected to (0).")
+)
+
+// DockerReconnect configures the check of the connection to the Docker daemon.
+type DockerReconnect struct {
+	Interval     time.Duration                  // Ping period; zero disables the check
+	QueueTimeout time.Duration                  // Longest a Docker call waits for a reconnection before it is attempted anyway
+	NewClient    func() (*client.Client, error) // Connects to the daemon anew; the client is kept if nil
+}
+
+// WithDockerReconnect pings the Docker daemon at cfg.Interval. Once it stops answering, as
+// when the daemon restarts, the manager connects to it anew with backoff, meanwhile holding
+// Docker calls back for up to cfg.QueueTimeout instead of failing them, and once reconnected
+// re-verifies the containers of its sandboxes, which a restart of the daemon stops.
+func WithDockerReconnect(cfg DockerReconnect) Option {
+	return func(m *SandboxManager) {
+		m.reconnect = cfg
+	}
+}
+
+// docker returns the Docker client. While the manager reconnects to the daemon, it first
+// waits for the reconnection for up to the queue timeout, so calls made during a restart of
+// the daemon go through once it is back.
+func (m *SandboxManager) docker() *client.Client {
+	m.dockerMu.RLock()
+	dockerClient, up := m.dockerClient, m.dockerUp
+	m.dockerMu.RUnlock()
+	if up == nil || m.reconnect.QueueTimeout <= 0 {
+		return dockerClient
+	}
+	select {
+	case <-up:
+		return m.currentDocker()
+	default:
+	}
+	timer := time.NewTimer(m.reconnect.QueueTimeout)
+	defer timer.Stop()
+	select {
+	case <-up:
+		return m.currentDocker()
+	case <-timer.C:
+	case <-m.ctx.Done():
+	}
+	return dockerClient
+}
+
+// currentDocker returns the Docker client without waiting for a reconnection.
+func (m *SandboxManager) currentDocker() *client.Client {
+	m.dockerMu.RLock()
+	defer m.dockerMu.RUnlock()
+	return m.dockerClient
+}
+
+// dockerReconnecting reports whether the manager is reconnecting to the daemon.
+func (m *SandboxManager) dockerReconnecting() bool {
+	m.dockerMu.RLock()
+	up := m.dockerUp
+	m.dockerMu.RUnlock()
+	if up == nil {
+		return false
+	}
+	select {
+	case <-up:
+		return false
+	default:
+		return true
+	}
+}
+
+// runDockerMonitor pings the Docker daemon until ctx is done, reconnecting whenever it stops
+// answering.
+func (m *SandboxManager) runDockerMonitor(ctx context.Context) {
+	ticker := time.NewTicker(m.reconnect.Interval)
+	defer ticker.Stop()
+	m.logger.Info("Docker connection monitor started", "interval", m.reconnect.Interval, "queueTimeout", m.reconnect.QueueTimeout)
+	dockerConnected.Set(1)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		if err := pingDocker(ctx, m.currentDocker()); err != nil {
+			m.reconnectDocker(ctx, err)
+		}
+	}
+}
+
+// reconnectDocker connects to the daemon anew until it answers or ctx is done, holding
+// Docker calls back meanwhile, then re-verifies the containers of the sandboxes.
+func (m *SandboxManager) reconnectDocker(ctx context.Context, cause error) {
+	m.logger.Warn("Docker daemon unreachable, reconnecting", "error", cause)
+	dockerConnected.Set(0)
+	up := make(chan struct{})
+	m.dockerMu.Lock()
+	m.dockerUp = up
+	m.dockerMu.Unlock()
+
+	lost := time.Now()
+	backoff := reconnectInitialBackoff
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(backoff):
+		}
+		backoff = min(backoff*2, reconnectMaxBackoff)
+
+		dockerClient := m.currentDocker()
+		if m.reconnect.NewClient != nil {
+			fresh, err := m.reconnect.NewClient()
+			if err != nil {
+				m.logger.Warn("Failed to create Docker client", "error", err)
+				continue
+			}
+			dockerClient = fresh
+		}
+		if err := pingDocker(ctx, dockerClient); err != nil {
+			m.logger.Debug("Docker daemon still unreachable", "error", err, "backoff", backoff)
+			if dockerClient != m.currentDocker() {
+				dockerClient.Close()
+			}
+			continue
+		}
+
+		m.dockerMu.Lock()
+		previous := m.dockerClient
+		m.dockerClient = dockerClient
+		m.dockerMu.Unlock()
+		close(up)
+		if previous != dockerClient {
+			previous.Close() // Drops the connections to the daemon that went away
+		}
+		dockerReconnects.Inc()
+		dockerConnected.Set(1)
+		m.logger.Info("Reconnected to the Docker daemon", "downtime", time.Since(lost).Round(time.Millisecond))
+		m.verifyContainers(ctx)
+		return
+	}
+}
+
+// verifyContainers checks the containers of the sandboxes against the daemon after a
+// reconnection: by the reconciler if it runs, else by a pass that leaves orphans alone.
+func (m *SandboxManager) verifyContainers(ctx context.Context) {
+	if m.reconcileInterval > 0 {
+		m.requestReconcile()
+		return
+	}
+	if _, err := m.Reconcile(ctx); err != nil {
+		m.logger.Error("Failed to verify sandbox containers after reconnecting to Docker", "error", err)
+	}
+}
+
+func pingDocker(ctx context.Context, dockerClient *client.Client) error {
+	pingCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	_, err := dockerClient.Ping(pingCtx)
+	return err
+}
@@ -0,0 +1,16 @@
+package manager
+
+// Encodings of the observations agents push to the runtime.
+const (
+	AgentEncodingJSON    = "json"
+	AgentEncodingMsgpack = "msgpack"
+)
+
+// WithAgentEncoding asks the agents of new sandboxes to push observations in encoding,
+// through their OBSERVATION_ENCODING variable. MessagePack cuts the cost of encoding heavy
+// output streams; agents that cannot produce it keep sending JSON, which is always accepted.
+func WithAgentEncoding(encoding string) Option {
+	return func(m *SandboxManager) {
+		m.agentEncoding = encoding
+	}
+}
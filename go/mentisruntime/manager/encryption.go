@@ -0,0 +1,131 @@
+package manager
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/foreveryh/sandboxai/go/mentisruntime/secret"
+)
+
+// runtimeKeyScope is the key scope of streams that belong to no space, such as image builds.
+const runtimeKeyScope = "_runtime"
+
+var ErrObservationEncryptionDisabled = newError(KindUnavailable, "observation_encryption_disabled", "observation encryption is not enabled")
+
+// ObservationKeyRotation reports a rotation of the key of a space's observations.
+type ObservationKeyRotation struct {
+	Key      secret.DataKey `json:"key"`
+	Resealed []string       `json:"resealed,omitempty"` // Streams whose history file was rewritten with the key
+	Failed   []string       `json:"failed,omitempty"`   // Streams whose history file could not be rewritten
+}
+
+// WithObservationEncryption seals the persisted observation history with keys of keyring,
+// one per space. It has no effect without WithObservationHistory.
+func WithObservationEncryption(keyring *secret.Keyring) Option {
+	return func(m *SandboxManager) {
+		m.observationKeys = &observationCipher{keyring: keyring, spaces: make(map[string]string)}
+	}
+}
+
+// observationCipher seals the history of each stream with the keys of its space. It keeps
+// the space of each sandbox stream itself: broadcasts may happen with m.mu held.
+type observationCipher struct {
+	keyring *secret.Keyring
+
+	mu     sync.RWMutex
+	spaces map[string]string // Space of each sandbox stream
+}
+
+func (c *observationCipher) Seal(streamID string, plaintext, additionalData []byte) (string, []byte, error) {
+	return c.keyring.Seal(c.scope(streamID), plaintext, additionalData)
+}
+
+func (c *observationCipher) Open(keyID string, ciphertext, additionalData []byte) ([]byte, error) {
+	return c.keyring.Open(keyID, ciphertext, additionalData)
+}
+
+// scope returns the key scope of a stream: its space, or runtimeKeyScope.
+func (c *observationCipher) scope(streamID string) string {
+	if spaceID, ok := strings.CutPrefix(streamID, SpaceStreamID("")); ok {
+		return spaceID
+	}
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	if spaceID, ok := c.spaces[streamID]; ok {
+		return spaceID
+	}
+	return runtimeKeyScope
+}
+
+// assignStream records the space of a sandbox's stream.
+func (m *SandboxManager) assignStream(sandboxID, spaceID string) {
+	if m.observationKeys == nil {
+		return
+	}
+	m.observationKeys.mu.Lock()
+	defer m.observationKeys.mu.Unlock()
+	m.observationKeys.spaces[sandboxID] = spaceID
+}
+
+// forgetStream drops the space of a deleted sandbox's stream.
+func (m *SandboxManager) forgetStream(sandboxID string) {
+	if m.observationKeys == nil {
+		return
+	}
+	m.observationKeys.mu.Lock()
+	defer m.observationKeys.mu.Unlock()
+	delete(m.observationKeys.spaces, sandboxID)
+}
+
+// ObservationKeys returns the metadata of the keys of a space's observations, oldest first.
+func (m *SandboxManager) ObservationKeys(ctx context.Context, spaceID string) ([]secret.DataKey, error) {
+	if m.observationKeys == nil || m.history == nil {
+		return nil, ErrObservationEncryptionDisabled
+	}
+	if _, err := m.spaceManager.GetSpace(ctx, spaceID); err != nil {
+		return nil, err
+	}
+	return m.observationKeys.keyring.Keys(spaceID), nil
+}
+
+// RotateObservationKey seals a space's observations with a new key from now on. Older keys
+// are kept to read what they sealed; with reseal, the history files of the space's streams
+// are rewritten with the new key.
+func (m *SandboxManager) RotateObservationKey(ctx context.Context, spaceID string, reseal bool) (*ObservationKeyRotation, error) {
+	if m.observationKeys == nil || m.history == nil {
+		return nil, ErrObservationEncryptionDisabled
+	}
+	if _, err := m.spaceManager.GetSpace(ctx, spaceID); err != nil {
+		return nil, err
+	}
+	key, err := m.observationKeys.keyring.Rotate(spaceID)
+	if err != nil {
+		return nil, err
+	}
+	m.logger.Info("Observation key rotated", "spaceID", spaceID, "keyID", key.ID)
+	rotation := &ObservationKeyRotation{Key: *key}
+	if !reseal {
+		return rotation, nil
+	}
+
+	streams := []string{SpaceStreamID(spaceID)}
+	m.observationKeys.mu.RLock()
+	for streamID, space := range m.observationKeys.spaces {
+		if space == spaceID {
+			streams = append(streams, streamID)
+		}
+	}
+	m.observationKeys.mu.RUnlock()
+	sort.Strings(streams[1:])
+	for _, streamID := range streams {
+		if err := m.history.Reseal(streamID); err != nil {
+			m.logger.Error("Failed to reseal observation history", "spaceID", spaceID, "streamID", streamID, "error", err)
+			rotation.Failed = append(rotation.Failed, streamID)
+			continue
+		}
+		rotation.Resealed = append(rotation.Resealed, streamID)
+	}
+	return rotation, nil
+}
@@ -0,0 +1,94 @@
+package manager
+
+import (
+	"context"
+	"errors"
+)
+
+// ErrorKind classifies manager errors so callers can react without matching on messages.
+type ErrorKind string
+
+const (
+	KindNotFound    ErrorKind = "not_found"
+	KindConflict    ErrorKind = "conflict"
+	KindInvalid     ErrorKind = "invalid"
+	KindQuota       ErrorKind = "quota"
+	KindTimeout     ErrorKind = "timeout"
+	KindBackend     ErrorKind = "backend"     // Docker or the in-sandbox agent failed
+	KindUnavailable ErrorKind = "unavailable" // The feature is not configured on this runtime
+)
+
+// Error is a classified manager error. Code is a stable, machine-readable identifier
+// such as "sandbox_not_found"; Err, if set, is the underlying cause.
+type Error struct {
+	Kind    ErrorKind
+	Code    string
+	Message string
+	Err     error
+}
+
+func (e *Error) Error() string {
+	if e.Err != nil {
+		return e.Message + ": " + e.Err.Error()
+	}
+	return e.Message
+}
+
+func (e *Error) Unwrap() error { return e.Err }
+
+// Is makes every error match the kind sentinel (ErrNotFound, ErrConflict, ...) of its kind.
+func (e *Error) Is(target error) bool {
+	t, ok := target.(*Error)
+	return ok && t.Code == "" && t.Kind == e.Kind
+}
+
+// Kind sentinels, for use with errors.Is.
+var (
+	ErrNotFound    = &Error{Kind: KindNotFound, Message: "not found"}
+	ErrConflict    = &Error{Kind: KindConflict, Message: "conflict"}
+	ErrInvalid     = &Error{Kind: KindInvalid, Message: "invalid request"}
+	ErrQuota       = &Error{Kind: KindQuota, Message: "quota exceeded"}
+	ErrTimeout     = &Error{Kind: KindTimeout, Message: "timed out"}
+	ErrBackend     = &Error{Kind: KindBackend, Message: "backend error"}
+	ErrUnavailable = &Error{Kind: KindUnavailable, Message: "unavailable"}
+)
+
+func newError(kind ErrorKind, code, message string) *Error {
+	return &Error{Kind: kind, Code: code, Message: message}
+}
+
+// backendError wraps a Docker or agent failure, classifying deadlines as timeouts.
+func backendError(code, message string, err error) error {
+	kind := KindBackend
+	if errors.Is(err, context.DeadlineExceeded) {
+		kind = KindTimeout
+	}
+	return &Error{Kind: kind, Code: code, Message: message, Err: err}
+}
+
+// KindOf returns the kind of err, or "" if it is not classified.
+func KindOf(err error) ErrorKind {
+	var e *Error
+	if errors.As(err, &e) {
+		return e.Kind
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		return KindTimeout
+	}
+	return ""
+}
+
+// CodeOf returns the most specific code in err's chain, or "" if there is none.
+func CodeOf(err error) string {
+	for err != nil {
+		var e *Error
+		if !errors.As(err, &e) {
+			return ""
+		}
+		if e.Code != "" {
+			return e.Code
+		}
+		err = e.Err
+	}
+	return ""
+}
@@ -0,0 +1,29 @@
+package manager
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestError_kindsAndCodes(t *testing.T) {
+	wrapped := fmt.Errorf("%w: hardened-plus", ErrUnknownSecurityProfile)
+	require.ErrorIs(t, wrapped, ErrUnknownSecurityProfile)
+	require.ErrorIs(t, wrapped, ErrInvalid)
+	require.NotErrorIs(t, wrapped, ErrNotFound)
+	require.Equal(t, KindInvalid, KindOf(wrapped))
+	require.Equal(t, "unknown_security_profile", CodeOf(wrapped))
+
+	require.NotErrorIs(t, ErrSandboxNotFound, ErrSpaceNotFound)
+	require.ErrorIs(t, ErrSandboxNotFound, ErrNotFound)
+
+	timeout := backendError("container_start_failed", "failed to start container", context.DeadlineExceeded)
+	require.Equal(t, KindTimeout, KindOf(timeout))
+	require.ErrorIs(t, timeout, context.DeadlineExceeded)
+
+	require.Equal(t, ErrorKind(""), KindOf(errors.New("boom")))
+	require.Equal(t, "", CodeOf(errors.New("boom")))
+}
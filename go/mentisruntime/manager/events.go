@@ -0,0 +1,37 @@
+package manager
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/foreveryh/sandboxai/go/mentisruntime/history"
+)
+
+// EventStreamID is the ID the events of every space are broadcast and recorded under, for
+// the admin event stream. Sandbox IDs are UUIDs and space streams are prefixed, so it
+// names no other stream.
+const EventStreamID = "runtime-events"
+
+// RuntimeEvent is a message of the admin event stream: a space event, with its space.
+type RuntimeEvent struct {
+	ObservationType string      `json:"observation_type"`
+	SpaceID         string      `json:"space_id"`
+	Timestamp       string      `json:"timestamp"`
+	Data            interface{} `json:"data,omitempty"`
+}
+
+// pushRuntimeEvent broadcasts a space event on the admin event stream.
+func (m *SandboxManager) pushRuntimeEvent(spaceID, eventType string, data interface{}) {
+	now := time.Now().UTC()
+	message, err := json.Marshal(RuntimeEvent{
+		ObservationType: eventType,
+		SpaceID:         spaceID,
+		Timestamp:       now.Format(time.RFC3339Nano),
+		Data:            data,
+	})
+	if err != nil {
+		m.logger.Error("Failed to marshal runtime event", "error", err, "spaceID", spaceID, "type", eventType)
+		return
+	}
+	m.broadcastObservation(EventStreamID, history.Meta{ObservationType: eventType, Timestamp: now}, message)
+}
@@ -0,0 +1,157 @@
+package manager
+
+import (
+	"archive/tar"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"path"
+	"strings"
+
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/client"
+)
+
+// FileChecksum is the checksum of a regular file below a path of a sandbox.
+type FileChecksum struct {
+	Path   string `json:"path"` // Relative to the path, with "/" separators; empty for the path itself
+	Size   int64  `json:"size"`
+	Mode   int64  `json:"mode"` // Permission bits
+	SHA256 string `json:"sha256"`
+}
+
+// ReadFiles returns a file or directory of a sandbox as a "docker cp" tar archive, whose
+// root entry is named after the last element of p.
+func (m *SandboxManager) ReadFiles(ctx context.Context, spaceID, sandboxID, p string) (io.ReadCloser, error) {
+	state, err := m.sandboxInSpace(spaceID, sandboxID)
+	if err != nil {
+		return nil, err
+	}
+	rc, _, err := m.docker().CopyFromContainer(ctx, state.ContainerID, p)
+	if err != nil {
+		return nil, copyError(err, sandboxID, p, "failed to copy "+p+" from sandbox "+sandboxID)
+	}
+	return rc, nil
+}
+
+// WriteFiles extracts a tar archive into a directory of a sandbox, creating the directory
+// and its missing parents. Existing files are replaced.
+func (m *SandboxManager) WriteFiles(ctx context.Context, spaceID, sandboxID, dir string, archive io.Reader) error {
+	state, err := m.sandboxInSpace(spaceID, sandboxID)
+	if err != nil {
+		return err
+	}
+
+	// Extract into the nearest existing ancestor, with the missing directories prefixed
+	// to the entries, since the archive endpoint only extracts into existing directories.
+	target, prefix := path.Clean(dir), ""
+	for {
+		stat, err := m.docker().ContainerStatPath(ctx, state.ContainerID, target)
+		if err == nil && stat.Mode.IsDir() {
+			break
+		}
+		if err == nil {
+			return newError(KindConflict, "not_a_directory", "not a directory in sandbox "+sandboxID+": "+target)
+		}
+		if !client.IsErrNotFound(err) || target == "/" {
+			return copyError(err, sandboxID, target, "failed to stat "+target+" in sandbox "+sandboxID)
+		}
+		prefix = path.Join(path.Base(target), prefix)
+		target = path.Dir(target)
+	}
+
+	pr, pw := io.Pipe()
+	copied := make(chan error, 1)
+	go func() {
+		err := prefixArchive(tar.NewReader(archive), tar.NewWriter(pw), prefix)
+		pw.CloseWithError(err)
+		copied <- err
+	}()
+	err = m.docker().CopyToContainer(ctx, state.ContainerID, target, pr, container.CopyToContainerOptions{})
+	pr.CloseWithError(err) // Unblocks the writer if the sandbox gave up early
+	if copyErr := <-copied; err == nil && copyErr != nil {
+		return newError(KindInvalid, "invalid_archive", "invalid tar archive: "+copyErr.Error())
+	}
+	if err != nil {
+		return copyError(err, sandboxID, dir, "failed to copy files to "+dir+" in sandbox "+sandboxID)
+	}
+	return nil
+}
+
+// FileChecksums returns the SHA-256 checksums of the regular files at or below a path of a
+// sandbox, in archive order. The files are read through the runtime, so this costs as much
+// as copying them out.
+func (m *SandboxManager) FileChecksums(ctx context.Context, spaceID, sandboxID, p string) ([]FileChecksum, error) {
+	state, err := m.sandboxInSpace(spaceID, sandboxID)
+	if err != nil {
+		return nil, err
+	}
+	rc, stat, err := m.docker().CopyFromContainer(ctx, state.ContainerID, p)
+	if err != nil {
+		return nil, copyError(err, sandboxID, p, "failed to copy "+p+" from sandbox "+sandboxID)
+	}
+	defer rc.Close()
+
+	checksums := []FileChecksum{}
+	tr := tar.NewReader(rc)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return checksums, nil
+		}
+		if err != nil {
+			return nil, backendError("copy_failed", "failed to read "+p+" from sandbox "+sandboxID, err)
+		}
+		if hdr.Typeflag != tar.TypeReg {
+			continue
+		}
+		h := sha256.New()
+		n, err := io.Copy(h, tr)
+		if err != nil {
+			return nil, backendError("copy_failed", "failed to read "+p+" from sandbox "+sandboxID, err)
+		}
+		rel := ""
+		if hdr.Name != stat.Name {
+			rel = strings.TrimPrefix(hdr.Name, stat.Name+"/")
+		}
+		checksums = append(checksums, FileChecksum{Path: rel, Size: n, Mode: hdr.Mode & 0o7777, SHA256: hex.EncodeToString(h.Sum(nil))})
+	}
+}
+
+// copyError reports a failed copy of a sandbox path, as path_not_found if it does not exist.
+func copyError(err error, sandboxID, p, message string) error {
+	if client.IsErrNotFound(err) {
+		return &Error{Kind: KindNotFound, Code: "path_not_found", Message: "path not found in sandbox " + sandboxID + ": " + p, Err: err}
+	}
+	return backendError("copy_failed", message, err)
+}
+
+// prefixArchive copies a tar archive, prefixing the names of its entries with a directory
+// unless it is empty.
+func prefixArchive(tr *tar.Reader, tw *tar.Writer, prefix string) error {
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return tw.Close()
+		}
+		if err != nil {
+			return err
+		}
+		if prefix != "" {
+			hdr.Name = path.Join(prefix, hdr.Name)
+			if hdr.Typeflag == tar.TypeDir {
+				hdr.Name += "/"
+			}
+			if hdr.Typeflag == tar.TypeLink {
+				hdr.Linkname = path.Join(prefix, hdr.Linkname)
+			}
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+		if _, err := io.Copy(tw, tr); err != nil {
+			return err
+		}
+	}
+}
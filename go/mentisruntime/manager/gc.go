@@ -0,0 +1,155 @@
+package manager
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/filters"
+	"github.com/docker/docker/api/types/network"
+	"github.com/docker/docker/api/types/volume"
+
+	"github.com/foreveryh/sandboxai/go/mentisruntime/metrics"
+)
+
+var gcRemoved = metrics.Default.NewCounterVec("sandboxai_gc_removed_total",
+	"Orphaned Docker resources removed by garbage collection, by resource type.", "resource")
+
+// GCReport lists the orphaned resources found (and, unless DryRun, removed) by a GC pass.
+type GCReport struct {
+	DryRun     bool      `json:"dry_run"`
+	Containers []string  `json:"containers"`
+	Volumes    []string  `json:"volumes"`
+	Networks   []string  `json:"networks"`
+	Errors     []string  `json:"errors,omitempty"`
+	StartedAt  time.Time `json:"started_at"`
+	FinishedAt time.Time `json:"finished_at"`
+}
+
+// WithGarbageCollection runs a GC pass periodically.
+func WithGarbageCollection(interval time.Duration) Option {
+	return func(m *SandboxManager) {
+		m.gcInterval = interval
+	}
+}
+
+func (m *SandboxManager) runGarbageCollector(ctx context.Context) {
+	ticker := time.NewTicker(m.gcInterval)
+	defer ticker.Stop()
+	m.logger.Info("Garbage collector started", "interval", m.gcInterval)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if _, err := m.GarbageCollect(ctx, false); err != nil {
+				m.logger.Error("Garbage collection failed", "error", err)
+			}
+		}
+	}
+}
+
+// GarbageCollect finds containers, volumes and networks labelled with the manager's scope that
+// no longer belong to a known sandbox or space, and removes them unless dryRun is set.
+func (m *SandboxManager) GarbageCollect(ctx context.Context, dryRun bool) (*GCReport, error) {
+	report := &GCReport{DryRun: dryRun, Containers: []string{}, Volumes: []string{}, Networks: []string{}, StartedAt: time.Now().UTC()}
+	scopeFilter := filters.NewArgs(filters.Arg("label", "sandboxai.scope="+m.scope))
+
+	listCtx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+	containers, err := m.docker().ContainerList(listCtx, container.ListOptions{All: true, Filters: scopeFilter})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list scope containers: %w", err)
+	}
+	volumes, err := m.docker().VolumeList(listCtx, volume.ListOptions{Filters: scopeFilter})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list scope volumes: %w", err)
+	}
+	networks, err := m.docker().NetworkList(listCtx, network.ListOptions{Filters: scopeFilter})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list scope networks: %w", err)
+	}
+
+	m.mu.RLock()
+	knownContainers := make(map[string]bool, len(m.sandboxes))
+	for _, state := range m.sandboxes {
+		knownContainers[state.ContainerID] = true
+	}
+	m.mu.RUnlock()
+
+	for _, c := range containers {
+		// The grace period protects containers that CreateSandbox has not registered yet.
+		if knownContainers[c.ID] || m.isLiveSidecar(c.Labels) || time.Since(time.Unix(c.Created, 0)) < orphanGracePeriod {
+			continue
+		}
+		report.Containers = append(report.Containers, c.ID)
+		if dryRun {
+			continue
+		}
+		rmCtx, rmCancel := context.WithTimeout(ctx, 15*time.Second)
+		err := m.docker().ContainerRemove(rmCtx, c.ID, container.RemoveOptions{Force: true, RemoveVolumes: true})
+		rmCancel()
+		m.recordGCResult(report, "container", c.ID, err)
+	}
+
+	for _, v := range volumes.Volumes {
+		if m.ownerExists(ctx, v.Labels) {
+			continue
+		}
+		report.Volumes = append(report.Volumes, v.Name)
+		if dryRun {
+			continue
+		}
+		rmCtx, rmCancel := context.WithTimeout(ctx, 15*time.Second)
+		err := m.docker().VolumeRemove(rmCtx, v.Name, false) // In-use volumes are left alone
+		rmCancel()
+		m.recordGCResult(report, "volume", v.Name, err)
+	}
+
+	for _, n := range networks {
+		if m.ownerExists(ctx, n.Labels) {
+			continue
+		}
+		report.Networks = append(report.Networks, n.ID)
+		if dryRun {
+			continue
+		}
+		rmCtx, rmCancel := context.WithTimeout(ctx, 15*time.Second)
+		err := m.docker().NetworkRemove(rmCtx, n.ID)
+		rmCancel()
+		m.recordGCResult(report, "network", n.ID, err)
+	}
+
+	report.FinishedAt = time.Now().UTC()
+	m.logger.Info("Garbage collection finished", "dryRun", dryRun, "containers", len(report.Containers),
+		"volumes", len(report.Volumes), "networks", len(report.Networks), "errors", len(report.Errors))
+	return report, nil
+}
+
+// ownerExists reports whether the sandbox or space named by a resource's labels still exists.
+// Resources labelled with neither are kept, since their owner cannot be determined.
+func (m *SandboxManager) ownerExists(ctx context.Context, labels map[string]string) bool {
+	if sandboxID := labels["sandboxai.id"]; sandboxID != "" {
+		m.mu.RLock()
+		_, exists := m.sandboxes[sandboxID]
+		m.mu.RUnlock()
+		return exists
+	}
+	if spaceID := labels["sandboxai.space"]; spaceID != "" {
+		_, err := m.spaceManager.GetSpace(ctx, spaceID)
+		return err == nil
+	}
+	return true
+}
+
+func (m *SandboxManager) recordGCResult(report *GCReport, resource, id string, err error) {
+	if err != nil {
+		m.logger.Error("Failed to remove orphaned resource", "resource", resource, "id", id, "error", err)
+		report.Errors = append(report.Errors, fmt.Sprintf("%s %s: %v", resource, id, err))
+		return
+	}
+	m.logger.Info("Removed orphaned resource", "resource", resource, "id", id)
+	gcRemoved.With(resource).Inc()
+}
@@ -0,0 +1,245 @@
+package manager
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/go-connections/nat"
+)
+
+// Sandbox health values reported in SandboxState.Health.
+const (
+	HealthHealthy  = "healthy"
+	HealthDegraded = "degraded"
+)
+
+// Recovery policies for sandboxes whose agent stops answering health checks.
+const (
+	RecoveryPolicyNone    = "none"
+	RecoveryPolicyRestart = "restart"
+)
+
+// HealthConfig configures continuous agent health monitoring.
+type HealthConfig struct {
+	Interval         time.Duration // Probe period; zero disables monitoring
+	FailureThreshold int           // Consecutive failures before a sandbox is marked degraded
+	RecoveryPolicy   string        // RecoveryPolicyNone or RecoveryPolicyRestart
+	MaxRestarts      int           // Restarts allowed per sandbox; zero means unlimited
+}
+
+// SandboxHealthObservationData is pushed when a sandbox's health changes.
+type SandboxHealthObservationData struct {
+	Health              string `json:"health"`
+	ConsecutiveFailures int    `json:"consecutive_failures,omitempty"`
+	RestartCount        int    `json:"restart_count,omitempty"`
+	Error               string `json:"error,omitempty"`
+}
+
+// WithHealthMonitor probes every running sandbox's agent periodically.
+func WithHealthMonitor(cfg HealthConfig) Option {
+	return func(m *SandboxManager) {
+		if cfg.FailureThreshold <= 0 {
+			cfg.FailureThreshold = 3
+		}
+		if cfg.RecoveryPolicy == "" {
+			cfg.RecoveryPolicy = RecoveryPolicyNone
+		}
+		m.health = cfg
+	}
+}
+
+// runHealthMonitor probes agents until ctx is done.
+func (m *SandboxManager) runHealthMonitor(ctx context.Context) {
+	ticker := time.NewTicker(m.health.Interval)
+	defer ticker.Stop()
+	m.logger.Info("Health monitor started", "interval", m.health.Interval, "failureThreshold", m.health.FailureThreshold, "recoveryPolicy", m.health.RecoveryPolicy)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			m.checkAgentHealth(ctx)
+		}
+	}
+}
+
+func (m *SandboxManager) checkAgentHealth(ctx context.Context) {
+	type target struct{ id, agentURL string }
+	m.mu.RLock()
+	var targets []target
+	for id, state := range m.sandboxes {
+		if state.IsRunning {
+			targets = append(targets, target{id, state.AgentURL})
+		}
+	}
+	m.mu.RUnlock()
+
+	for _, t := range targets {
+		err := m.probeAgent(ctx, t.agentURL)
+		m.recordHealth(ctx, t.id, err)
+	}
+}
+
+// probeAgent performs a single GET /health against an agent.
+func (m *SandboxManager) probeAgent(ctx context.Context, agentURL string) error {
+	probeCtx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+	req, err := http.NewRequestWithContext(probeCtx, "GET", agentURL+"/health", nil)
+	if err != nil {
+		return err
+	}
+	resp, err := m.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("agent health returned status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// recordHealth updates the failure count of a sandbox and triggers degradation or recovery.
+func (m *SandboxManager) recordHealth(ctx context.Context, sandboxID string, probeErr error) {
+	m.mu.Lock()
+	state, exists := m.sandboxes[sandboxID]
+	if !exists || !state.IsRunning {
+		m.mu.Unlock()
+		return
+	}
+	if probeErr == nil {
+		m.healthFailures[sandboxID] = 0
+		recovered := state.Health == HealthDegraded
+		state.Health = HealthHealthy
+		var change SandboxStateObservationData
+		changed := false
+		if state.Phase == PhaseDegraded {
+			change, changed = m.transition(state, PhaseReady, "health_check_passed")
+		}
+		m.mu.Unlock()
+		m.announcePhase(sandboxID, change, changed)
+		if recovered {
+			m.logger.Info("Sandbox agent healthy again", "sandboxID", sandboxID)
+			m.pushObservation(sandboxID, "", "sandbox_health", SandboxHealthObservationData{Health: HealthHealthy})
+		}
+		return
+	}
+
+	m.healthFailures[sandboxID]++
+	failures := m.healthFailures[sandboxID]
+	if failures < m.health.FailureThreshold {
+		m.mu.Unlock()
+		m.logger.Debug("Agent health probe failed", "sandboxID", sandboxID, "failures", failures, "error", probeErr)
+		return
+	}
+	becameDegraded := state.Health != HealthDegraded
+	state.Health = HealthDegraded
+	change, changed := m.transition(state, PhaseDegraded, "health_check_failed")
+	restart := m.health.RecoveryPolicy == RecoveryPolicyRestart &&
+		(m.health.MaxRestarts == 0 || state.RestartCount < m.health.MaxRestarts)
+	restartCount := state.RestartCount
+	m.mu.Unlock()
+	m.announcePhase(sandboxID, change, changed)
+
+	if becameDegraded {
+		m.logger.Warn("Sandbox agent degraded", "sandboxID", sandboxID, "failures", failures, "error", probeErr)
+		m.pushObservation(sandboxID, "", "sandbox_health", SandboxHealthObservationData{
+			Health:              HealthDegraded,
+			ConsecutiveFailures: failures,
+			RestartCount:        restartCount,
+			Error:               probeErr.Error(),
+		})
+	}
+	if restart {
+		m.restartSandbox(ctx, sandboxID)
+	}
+}
+
+// restartSandbox restarts a degraded sandbox's container and waits for its agent.
+func (m *SandboxManager) restartSandbox(ctx context.Context, sandboxID string) {
+	m.mu.Lock()
+	state, exists := m.sandboxes[sandboxID]
+	if !exists || !state.IsRunning {
+		m.mu.Unlock()
+		return
+	}
+	change, changed := m.transition(state, PhaseStarting, "restart") // The restart's "die" event is expected
+	if !changed {
+		m.mu.Unlock()
+		return
+	}
+	state.RestartCount++
+	containerID := state.ContainerID
+	restartCount := state.RestartCount
+	m.mu.Unlock()
+	m.announcePhase(sandboxID, change, changed)
+
+	m.logger.Warn("Restarting degraded sandbox", "sandboxID", sandboxID, "containerID", containerID, "restartCount", restartCount)
+	restartCtx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+	stopTimeout := 5
+	if err := m.docker().ContainerRestart(restartCtx, containerID, container.StopOptions{Timeout: &stopTimeout}); err != nil {
+		m.logger.Error("Failed to restart sandbox container", "sandboxID", sandboxID, "error", err)
+		m.failRestart(sandboxID)
+		return
+	}
+
+	// The host port mapping is reassigned on restart.
+	info, err := m.docker().ContainerInspect(restartCtx, containerID)
+	if err != nil {
+		m.logger.Error("Failed to inspect restarted sandbox container", "sandboxID", sandboxID, "error", err)
+		m.failRestart(sandboxID)
+		return
+	}
+	agentURL := ""
+	if info.NetworkSettings != nil {
+		if bindings := info.NetworkSettings.Ports[nat.Port("8000/tcp")]; len(bindings) > 0 && bindings[0].HostPort != "" {
+			agentURL = fmt.Sprintf("http://localhost:%s", bindings[0].HostPort)
+		}
+	}
+	if agentURL == "" {
+		m.logger.Error("Restarted sandbox has no agent port mapping", "sandboxID", sandboxID)
+		m.failRestart(sandboxID)
+		return
+	}
+	if err := m.waitForAgentReady(ctx, agentURL+"/health", 30*time.Second); err != nil {
+		m.logger.Error("Agent not ready after restart", "sandboxID", sandboxID, "error", err)
+		m.failRestart(sandboxID)
+		return
+	}
+
+	m.mu.Lock()
+	if state, exists := m.sandboxes[sandboxID]; exists {
+		state.AgentURL = agentURL
+		state.shells = nil           // The restarted agent may report others
+		state.jupyter = nil          // Its ports are mapped anew
+		delete(m.kernels, sandboxID) // Kernels lived in the old agent process
+		state.Health = HealthHealthy
+		change, changed = m.transition(state, PhaseReady, "restarted")
+		m.healthFailures[sandboxID] = 0
+	}
+	m.mu.Unlock()
+	m.announcePhase(sandboxID, change, changed)
+
+	m.breakers.reset(sandboxID)
+	m.logger.Info("Sandbox recovered by restart", "sandboxID", sandboxID, "agentURL", agentURL)
+	m.pushObservation(sandboxID, "", "sandbox_health", SandboxHealthObservationData{Health: HealthHealthy, RestartCount: restartCount})
+}
+
+// failRestart marks a sandbox whose restart did not bring its agent back as failed.
+func (m *SandboxManager) failRestart(sandboxID string) {
+	var change SandboxStateObservationData
+	changed := false
+	m.mu.Lock()
+	if state, exists := m.sandboxes[sandboxID]; exists {
+		change, changed = m.transition(state, PhaseFailed, "restart_failed")
+	}
+	m.mu.Unlock()
+	m.announcePhase(sandboxID, change, changed)
+}
@@ -0,0 +1,232 @@
+package manager
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/docker/docker/api/types/container"
+)
+
+// RedactedValue replaces the values of secret environment variables.
+const RedactedValue = "[REDACTED]"
+
+// SandboxEnv is the environment a sandbox's container runs with, as resolved by Docker: the
+// variables of the image, of the sandbox and those the runtime sets for the agent.
+type SandboxEnv struct {
+	SandboxID string            `json:"sandbox_id"`
+	Env       map[string]string `json:"env"`
+	Redacted  []string          `json:"redacted,omitempty"` // Variables set from secrets, whose values are redacted
+}
+
+// SandboxInfo describes where and how a sandbox's container runs, for debugging differences
+// between sandboxes.
+type SandboxInfo struct {
+	SandboxID    string        `json:"sandbox_id"`
+	ContainerID  string        `json:"container_id"`
+	Image        string        `json:"image"`                   // As requested
+	ImageID      string        `json:"image_id"`                // ID of the image the container runs
+	ImageDigests []string      `json:"image_digests,omitempty"` // Repository digests of that image
+	Status       string        `json:"status"`                  // Docker container status
+	StartedAt    string        `json:"started_at,omitempty"`
+	Hostname     string        `json:"hostname,omitempty"`
+	User         string        `json:"user,omitempty"`
+	Workdir      string        `json:"workdir,omitempty"`
+	Mounts       []MountInfo   `json:"mounts"`
+	Networks     []NetworkInfo `json:"networks"`
+	Limits       LimitsInfo    `json:"limits"`
+	AgentURL     string        `json:"agent_url,omitempty"`
+	AgentVersion string        `json:"agent_version,omitempty"` // Empty if the agent does not report one
+	AgentShells  []string      `json:"agent_shells,omitempty"`  // Shells shell actions can choose
+}
+
+// MountInfo is a mount of a sandbox's container.
+type MountInfo struct {
+	Type        string `json:"type"`
+	Source      string `json:"source,omitempty"`
+	Destination string `json:"destination"`
+	ReadOnly    bool   `json:"read_only"`
+}
+
+// NetworkInfo is a network a sandbox's container is attached to.
+type NetworkInfo struct {
+	Name        string   `json:"name"`
+	IPAddress   string   `json:"ip_address,omitempty"`
+	IPv6Address string   `json:"ipv6_address,omitempty"`
+	Gateway     string   `json:"gateway,omitempty"`
+	Aliases     []string `json:"aliases,omitempty"`
+}
+
+// LimitsInfo are the resource limits of a sandbox's container. Zero means unlimited.
+type LimitsInfo struct {
+	NanoCPUs    int64             `json:"nano_cpus,omitempty"`
+	MemoryBytes int64             `json:"memory_bytes,omitempty"`
+	PidsLimit   int64             `json:"pids_limit,omitempty"`
+	DiskLimit   string            `json:"disk_limit,omitempty"`
+	Tmpfs       map[string]string `json:"tmpfs,omitempty"`
+	ReadOnly    bool              `json:"read_only_rootfs,omitempty"`
+	Ulimits     map[string]Ulimit `json:"ulimits,omitempty"`
+}
+
+// GetSandboxEnv returns the environment of a sandbox's container, with the values of the
+// variables set from secrets redacted.
+func (m *SandboxManager) GetSandboxEnv(ctx context.Context, sandboxID string) (*SandboxEnv, error) {
+	state, info, err := m.inspectSandbox(ctx, sandboxID)
+	if err != nil {
+		return nil, err
+	}
+	secret := make(map[string]bool)
+	for _, ref := range state.Secrets {
+		if name, ok := secretEnvName(ref); ok {
+			secret[name] = true
+		}
+	}
+
+	env := &SandboxEnv{SandboxID: sandboxID, Env: make(map[string]string)}
+	if info.Config != nil {
+		for _, kv := range info.Config.Env {
+			key, value, _ := strings.Cut(kv, "=")
+			if secret[key] {
+				value = RedactedValue
+				env.Redacted = append(env.Redacted, key)
+			}
+			env.Env[key] = value
+		}
+	}
+	sort.Strings(env.Redacted)
+	return env, nil
+}
+
+// GetSandboxInfo returns the image, mounts, networks and resource limits of a sandbox's
+// container, and the version of its agent.
+func (m *SandboxManager) GetSandboxInfo(ctx context.Context, sandboxID string) (*SandboxInfo, error) {
+	state, info, err := m.inspectSandbox(ctx, sandboxID)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &SandboxInfo{
+		SandboxID:   sandboxID,
+		ContainerID: info.ID,
+		Image:       state.Image,
+		ImageID:     info.Image,
+		Mounts:      []MountInfo{},
+		Networks:    []NetworkInfo{},
+		Limits:      LimitsInfo{DiskLimit: state.DiskLimit},
+		AgentURL:    state.AgentURL,
+	}
+	if info.State != nil {
+		result.Status = info.State.Status
+		result.StartedAt = info.State.StartedAt
+	}
+	if info.Config != nil {
+		result.Hostname = info.Config.Hostname
+		result.User = info.Config.User
+		result.Workdir = info.Config.WorkingDir
+	}
+	for _, mp := range info.Mounts {
+		result.Mounts = append(result.Mounts, MountInfo{Type: string(mp.Type), Source: mp.Source, Destination: mp.Destination, ReadOnly: !mp.RW})
+	}
+	if host := info.HostConfig; host != nil {
+		result.Limits.NanoCPUs = host.NanoCPUs
+		result.Limits.MemoryBytes = host.Memory
+		if host.PidsLimit != nil {
+			result.Limits.PidsLimit = *host.PidsLimit
+		}
+		result.Limits.Tmpfs = host.Tmpfs
+		result.Limits.ReadOnly = host.ReadonlyRootfs
+		for _, limit := range host.Ulimits {
+			if result.Limits.Ulimits == nil {
+				result.Limits.Ulimits = make(map[string]Ulimit)
+			}
+			result.Limits.Ulimits[limit.Name] = Ulimit{Soft: limit.Soft, Hard: limit.Hard}
+		}
+		// Docker lists tmpfs mounts in HostConfig only.
+		for dest := range host.Tmpfs {
+			result.Mounts = append(result.Mounts, MountInfo{Type: "tmpfs", Destination: dest})
+		}
+	}
+	sort.Slice(result.Mounts, func(i, j int) bool { return result.Mounts[i].Destination < result.Mounts[j].Destination })
+	if info.NetworkSettings != nil {
+		for name, ep := range info.NetworkSettings.Networks {
+			if ep == nil {
+				continue
+			}
+			result.Networks = append(result.Networks, NetworkInfo{Name: name, IPAddress: ep.IPAddress, IPv6Address: ep.GlobalIPv6Address, Gateway: ep.Gateway, Aliases: ep.Aliases})
+		}
+		sort.Slice(result.Networks, func(i, j int) bool { return result.Networks[i].Name < result.Networks[j].Name })
+	}
+
+	if info.Image != "" {
+		inspectCtx, cancel := context.WithTimeout(ctx, 30*time.Second)
+		img, err := m.docker().ImageInspect(inspectCtx, info.Image)
+		cancel()
+		if err != nil {
+			// The image may have been removed since the container was created.
+			m.logger.Debug("Cannot inspect sandbox image", "sandboxID", sandboxID, "image", info.Image, "error", err)
+		} else {
+			result.ImageDigests = img.RepoDigests
+		}
+	}
+	if state.IsRunning && state.AgentURL != "" {
+		if health, ok := m.agentHealthOf(ctx, state.AgentURL); ok {
+			result.AgentVersion = health.Version
+			result.AgentShells = health.Shells
+		}
+	}
+	return result, nil
+}
+
+// inspectSandbox returns a copy of the state of a sandbox and the inspection of its container.
+func (m *SandboxManager) inspectSandbox(ctx context.Context, sandboxID string) (SandboxState, container.InspectResponse, error) {
+	m.mu.RLock()
+	state, exists := m.sandboxes[sandboxID]
+	var snapshot SandboxState
+	if exists {
+		snapshot = *state
+	}
+	m.mu.RUnlock()
+	if !exists {
+		return SandboxState{}, container.InspectResponse{}, ErrSandboxNotFound
+	}
+
+	inspectCtx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+	info, err := m.docker().ContainerInspect(inspectCtx, snapshot.ContainerID)
+	if err != nil {
+		return SandboxState{}, container.InspectResponse{}, backendError("container_inspect_failed", "failed to inspect sandbox container", err)
+	}
+	return snapshot, info, nil
+}
+
+// agentHealth is what an agent reports in its /health response. Older agents report
+// neither field.
+type agentHealth struct {
+	Version string   `json:"version"`
+	Shells  []string `json:"shells"` // Shells commands can choose, such as "bash"
+}
+
+// agentHealthOf returns the /health response of an agent, or false if it cannot be reached
+// or its response cannot be read.
+func (m *SandboxManager) agentHealthOf(ctx context.Context, agentURL string) (agentHealth, bool) {
+	probeCtx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+	req, err := http.NewRequestWithContext(probeCtx, "GET", agentURL+"/health", nil)
+	if err != nil {
+		return agentHealth{}, false
+	}
+	resp, err := m.httpClient.Do(req)
+	if err != nil {
+		return agentHealth{}, false
+	}
+	defer resp.Body.Close()
+	var health agentHealth
+	if resp.StatusCode != http.StatusOK || json.NewDecoder(io.LimitReader(resp.Body, 64<<10)).Decode(&health) != nil {
+		return agentHealth{}, false
+	}
+	return health, true
+}
@@ -0,0 +1,117 @@
+package manager
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/docker/go-connections/nat"
+)
+
+var ErrJupyterNotEnabled = newError(KindNotFound, "jupyter_not_enabled", "the sandbox was not created with jupyter enabled")
+
+// JupyterPort is the container port of the Jupyter server that the agent of a sandbox created
+// with Jupyter starts. The runtime maps it like the agent port but never hands it out: clients
+// reach the server through the runtime's proxy.
+const JupyterPort = nat.Port("8888/tcp")
+
+// Environment of the agent that makes it start a Jupyter server.
+const (
+	jupyterTokenEnv   = "SANDBOXAI_JUPYTER_TOKEN"    // Token the runtime authenticates with
+	jupyterBaseURLEnv = "SANDBOXAI_JUPYTER_BASE_URL" // Path prefix of the server: the proxy path
+)
+
+// JupyterBasePath returns the runtime path under which the Jupyter server of a sandbox is
+// proxied. The server is started with it as its base URL, so requests are forwarded as is.
+func JupyterBasePath(spaceID, sandboxID string) string {
+	return "/v1/spaces/" + url.PathEscape(spaceID) + "/sandboxes/" + url.PathEscape(sandboxID) + "/jupyter/"
+}
+
+// JupyterTarget is where the runtime forwards the Jupyter requests of a sandbox.
+type JupyterTarget struct {
+	URL   *url.URL // Scheme and host of the sandbox's Jupyter server
+	Token string   // Sent by the proxy; clients never see it
+	// Context is done when the sandbox is deleted or the runtime stops, which must end
+	// proxied connections such as kernel WebSockets.
+	Context context.Context
+}
+
+// jupyterEndpoint caches the Jupyter server of a sandbox, found by inspecting its container.
+type jupyterEndpoint struct {
+	agentURL string // Agent URL it was found for; a restart maps the ports anew
+	url      *url.URL
+	token    string
+}
+
+// jupyterEnv returns the agent environment that starts a Jupyter server for a sandbox.
+func jupyterEnv(spaceID, sandboxID string) ([]string, error) {
+	token := make([]byte, 24)
+	if _, err := rand.Read(token); err != nil {
+		return nil, fmt.Errorf("failed to generate jupyter token: %w", err)
+	}
+	return []string{
+		jupyterTokenEnv + "=" + hex.EncodeToString(token),
+		jupyterBaseURLEnv + "=" + JupyterBasePath(spaceID, sandboxID),
+	}, nil
+}
+
+// JupyterTarget returns the Jupyter server of a running sandbox. The port mapping and token
+// are read from the container on first use, so they survive runtime restarts and adoption.
+func (m *SandboxManager) JupyterTarget(ctx context.Context, sandboxID string) (JupyterTarget, error) {
+	m.mu.RLock()
+	state, exists := m.sandboxes[sandboxID]
+	var endpoint *jupyterEndpoint
+	var containerID, agentURL string
+	var sandboxCtx context.Context
+	if exists {
+		endpoint, containerID, agentURL, sandboxCtx = state.jupyter, state.ContainerID, state.AgentURL, state.ctx
+	}
+	running := exists && state.IsRunning
+	m.mu.RUnlock()
+	if !exists {
+		return JupyterTarget{}, ErrSandboxNotFound
+	}
+	if !running {
+		return JupyterTarget{}, ErrSandboxNotRunning
+	}
+	if sandboxCtx == nil {
+		sandboxCtx = context.Background()
+	}
+
+	if endpoint == nil || endpoint.agentURL != agentURL {
+		info, err := m.docker().ContainerInspect(ctx, containerID)
+		if err != nil {
+			return JupyterTarget{}, backendError("inspect_failed", "failed to inspect sandbox container", err)
+		}
+		var token string
+		if info.Config != nil {
+			for _, env := range info.Config.Env {
+				if value, ok := strings.CutPrefix(env, jupyterTokenEnv+"="); ok {
+					token = value
+				}
+			}
+		}
+		if token == "" {
+			return JupyterTarget{}, ErrJupyterNotEnabled
+		}
+		var hostPort string
+		if info.NetworkSettings != nil {
+			if bindings := info.NetworkSettings.Ports[JupyterPort]; len(bindings) > 0 {
+				hostPort = bindings[0].HostPort
+			}
+		}
+		if hostPort == "" {
+			return JupyterTarget{}, newError(KindBackend, "jupyter_unreachable", "the sandbox's jupyter port is not mapped")
+		}
+		endpoint = &jupyterEndpoint{agentURL: agentURL, url: &url.URL{Scheme: "http", Host: "localhost:" + hostPort}, token: token}
+		m.mu.Lock()
+		if state, exists := m.sandboxes[sandboxID]; exists && state.AgentURL == agentURL {
+			state.jupyter = endpoint
+		}
+		m.mu.Unlock()
+	}
+	return JupyterTarget{URL: endpoint.url, Token: endpoint.token, Context: sandboxCtx}, nil
+}
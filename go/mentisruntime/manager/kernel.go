@@ -0,0 +1,175 @@
+package manager
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"time"
+)
+
+var (
+	ErrKernelNotFound = newError(KindNotFound, "kernel_not_found", "kernel not found")
+	ErrKernelExists   = newError(KindConflict, "kernel_exists", "a kernel with this ID already exists")
+	ErrKernelBusy     = newError(KindConflict, "kernel_busy", "the kernel is running a cell")
+	ErrDefaultKernel  = newError(KindInvalid, "default_kernel", "the default kernel cannot be deleted")
+)
+
+// DefaultKernel is the IPython kernel of cells that name none. Every sandbox has it.
+const DefaultKernel = "default"
+
+// Kernel describes an IPython kernel of a sandbox: a namespace that keeps the variables and
+// imports of the cells run in it. Cells choose theirs with "kernel_id".
+type Kernel struct {
+	ID              string     `json:"kernel_id"`
+	SandboxID       string     `json:"sandbox_id"`
+	CreatedAt       time.Time  `json:"created_at"` // For the default kernel, when the runtime first listed or used it
+	LastUsedAt      *time.Time `json:"last_used_at,omitempty"`
+	Executions      int        `json:"executions"`                  // Cells started in the kernel
+	RunningActionID string     `json:"running_action_id,omitempty"` // Cell running in the kernel, if any
+}
+
+// actionKernelOf returns the "kernel_id" of an IPython action payload, or DefaultKernel.
+func actionKernelOf(payload map[string]interface{}) string {
+	if id, _ := payload["kernel_id"].(string); id != "" {
+		return id
+	}
+	return DefaultKernel
+}
+
+// CreateKernel asks the sandbox agent to start a kernel with the given ID.
+func (m *SandboxManager) CreateKernel(ctx context.Context, sandboxID, kernelID string) (*Kernel, error) {
+	m.mu.RLock()
+	state, exists := m.sandboxes[sandboxID]
+	_, kernelExists := m.kernels[sandboxID][kernelID]
+	m.mu.RUnlock()
+	if !exists {
+		return nil, ErrSandboxNotFound
+	}
+	if !state.IsRunning {
+		return nil, ErrSandboxNotRunning
+	}
+	if kernelExists || kernelID == DefaultKernel {
+		return nil, ErrKernelExists
+	}
+
+	body := map[string]string{"kernel_id": kernelID}
+	if err := m.callAgent(ctx, sandboxID, http.MethodPost, state.AgentURL+"/kernels", body, nil); err != nil {
+		m.logger.Error("Failed to start kernel on agent", "sandboxID", sandboxID, "kernelID", kernelID, "error", err)
+		return nil, fmt.Errorf("failed to start kernel: %w", err)
+	}
+
+	kernel := &Kernel{ID: kernelID, SandboxID: sandboxID, CreatedAt: time.Now().UTC()}
+	m.mu.Lock()
+	m.kernelsOfLocked(sandboxID)[kernelID] = kernel
+	m.mu.Unlock()
+
+	m.logger.Info("Kernel created", "sandboxID", sandboxID, "kernelID", kernelID)
+	return kernel, nil
+}
+
+// ListKernels returns the kernels of a sandbox, the default kernel first.
+func (m *SandboxManager) ListKernels(ctx context.Context, sandboxID string) ([]*Kernel, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, exists := m.sandboxes[sandboxID]; !exists {
+		return nil, ErrSandboxNotFound
+	}
+	tracked := m.kernelsOfLocked(sandboxID)
+	kernels := make([]*Kernel, 0, len(tracked))
+	for _, k := range tracked {
+		kernelCopy := *k
+		kernels = append(kernels, &kernelCopy)
+	}
+	sort.Slice(kernels, func(i, j int) bool {
+		if kernels[i].ID == DefaultKernel || kernels[j].ID == DefaultKernel {
+			return kernels[i].ID == DefaultKernel
+		}
+		return kernels[i].CreatedAt.Before(kernels[j].CreatedAt)
+	})
+	return kernels, nil
+}
+
+// DeleteKernel stops a kernel on the agent and forgets about it. A kernel running a cell is
+// not deleted.
+func (m *SandboxManager) DeleteKernel(ctx context.Context, sandboxID, kernelID string) error {
+	if kernelID == DefaultKernel {
+		return ErrDefaultKernel
+	}
+	m.mu.RLock()
+	state, exists := m.sandboxes[sandboxID]
+	kernel, kernelExists := m.kernels[sandboxID][kernelID]
+	busy := kernelExists && kernel.RunningActionID != ""
+	m.mu.RUnlock()
+	if !exists {
+		return ErrSandboxNotFound
+	}
+	if !kernelExists {
+		return ErrKernelNotFound
+	}
+	if busy {
+		return ErrKernelBusy
+	}
+
+	if err := m.callAgent(ctx, sandboxID, http.MethodDelete, state.AgentURL+"/kernels/"+url.PathEscape(kernelID), nil, nil); err != nil {
+		// The kernel is dropped locally regardless; its namespace goes away with the agent.
+		m.logger.Warn("Failed to stop kernel on agent", "sandboxID", sandboxID, "kernelID", kernelID, "error", err)
+	}
+
+	m.mu.Lock()
+	delete(m.kernels[sandboxID], kernelID)
+	m.mu.Unlock()
+
+	m.logger.Info("Kernel deleted", "sandboxID", sandboxID, "kernelID", kernelID)
+	return nil
+}
+
+// kernelsOfLocked returns the kernels of a sandbox, creating its map with the default kernel
+// if needed. Callers must hold m.mu.
+func (m *SandboxManager) kernelsOfLocked(sandboxID string) map[string]*Kernel {
+	kernels := m.kernels[sandboxID]
+	if kernels == nil {
+		kernels = map[string]*Kernel{DefaultKernel: {ID: DefaultKernel, SandboxID: sandboxID, CreatedAt: time.Now().UTC()}}
+		m.kernels[sandboxID] = kernels
+	}
+	return kernels
+}
+
+// checkActionKernel returns ErrKernelNotFound if an IPython action names a kernel that the
+// sandbox does not have.
+func (m *SandboxManager) checkActionKernel(sandboxID string, payload map[string]interface{}) error {
+	kernelID := actionKernelOf(payload)
+	if kernelID == DefaultKernel {
+		return nil
+	}
+	m.mu.RLock()
+	_, exists := m.kernels[sandboxID][kernelID]
+	m.mu.RUnlock()
+	if !exists {
+		return fmt.Errorf("%w: %q", ErrKernelNotFound, kernelID)
+	}
+	return nil
+}
+
+// startKernelLocked records that an IPython action runs in its kernel. Callers must hold m.mu.
+func (m *SandboxManager) startKernelLocked(sandboxID, actionID string, payload map[string]interface{}) {
+	kernel := m.kernelsOfLocked(sandboxID)[actionKernelOf(payload)]
+	if kernel == nil {
+		return // Deleted since checkActionKernel
+	}
+	now := time.Now().UTC()
+	kernel.LastUsedAt = &now
+	kernel.Executions++
+	kernel.RunningActionID = actionID
+}
+
+// endKernelLocked clears the running cell of the kernel an action ran in. Callers must hold m.mu.
+func (m *SandboxManager) endKernelLocked(sandboxID, actionID string) {
+	for _, kernel := range m.kernels[sandboxID] {
+		if kernel.RunningActionID == actionID {
+			kernel.RunningActionID = ""
+		}
+	}
+}
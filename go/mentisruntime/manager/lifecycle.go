@@ -0,0 +1,152 @@
+package manager
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/docker/docker/api/types/events"
+	"github.com/docker/docker/api/types/filters"
+)
+
+// Reasons reported in sandbox_terminated observations.
+const (
+	TerminationReasonOOMKilled = "oom_killed"
+	TerminationReasonExited    = "exited"
+)
+
+// SandboxTerminatedObservationData is pushed when a sandbox container dies without being deleted.
+type SandboxTerminatedObservationData struct {
+	Reason   string `json:"reason"`
+	ExitCode int    `json:"exit_code"`
+	Error    string `json:"error,omitempty"`
+}
+
+// Bounds of the delay before resubscribing to Docker events.
+const (
+	minEventsBackoff = time.Second
+	maxEventsBackoff = 30 * time.Second
+)
+
+// watchContainerEvents follows Docker events for containers in this scope so the manager
+// notices containers that die on their own. It reconnects until ctx is done, backing off
+// while subscriptions keep failing.
+func (m *SandboxManager) watchContainerEvents(ctx context.Context) {
+	backoff := minEventsBackoff
+	for {
+		start, received := time.Now(), false
+		err := m.consumeContainerEvents(ctx, func() { received = true })
+		// A subscription that delivered events or stayed up was healthy: start over, so
+		// occasional blips do not add up to the longest delay.
+		if received || time.Since(start) >= maxEventsBackoff {
+			backoff = minEventsBackoff
+		}
+		if err != nil && ctx.Err() == nil {
+			m.logger.Warn("Docker event stream interrupted, reconnecting", "error", err, "backoff", backoff)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(backoff):
+		}
+		if backoff < maxEventsBackoff {
+			backoff *= 2
+		}
+	}
+}
+
+// consumeContainerEvents handles container events until the subscription fails, calling
+// received for each.
+func (m *SandboxManager) consumeContainerEvents(ctx context.Context, received func()) error {
+	args := filters.NewArgs(
+		filters.Arg("type", string(events.ContainerEventType)),
+		filters.Arg("label", "sandboxai.scope="+m.scope),
+		filters.Arg("event", string(events.ActionStart)),
+		filters.Arg("event", string(events.ActionOOM)),
+		filters.Arg("event", string(events.ActionDie)),
+		filters.Arg("event", string(events.ActionDestroy)),
+	)
+	msgs, errs := m.docker().Events(ctx, events.ListOptions{Filters: args})
+	m.logger.Info("Subscribed to Docker container events", "scope", m.scope)
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case err := <-errs:
+			return err
+		case msg := <-msgs:
+			received()
+			m.handleContainerEvent(ctx, msg)
+		}
+	}
+}
+
+func (m *SandboxManager) handleContainerEvent(ctx context.Context, msg events.Message) {
+	sandboxID := msg.Actor.Attributes["sandboxai.id"]
+	if sandboxID == "" {
+		return
+	}
+
+	switch msg.Action {
+	case events.ActionStart:
+		// Follows both new containers and restarts; the stream of a container ends when it stops.
+		m.followContainerLogs(sandboxID, msg.Actor.Attributes["sandboxai.space"], msg.Actor.ID, time.Unix(0, msg.TimeNano))
+	case events.ActionDestroy:
+		m.mu.RLock()
+		state, exists := m.sandboxes[sandboxID]
+		stale := exists && state.ContainerID == msg.Actor.ID
+		m.mu.RUnlock()
+		if stale && m.reconcileInterval > 0 {
+			// Removed behind our back (e.g. docker rm); let the reconciler drop the record.
+			m.requestReconcile()
+		}
+	case events.ActionOOM:
+		// Docker sends "oom" before "die"; remember it in case inspect races with removal.
+		m.mu.Lock()
+		m.oomKilled[sandboxID] = true
+		m.mu.Unlock()
+	case events.ActionDie:
+		m.mu.Lock()
+		state, exists := m.sandboxes[sandboxID]
+		wasRunning := exists && state.IsRunning
+		oom := m.oomKilled[sandboxID]
+		delete(m.oomKilled, sandboxID)
+		m.mu.Unlock()
+
+		if !wasRunning {
+			// Deleted, killed or restarted by the runtime itself; nothing unexpected happened.
+			return
+		}
+
+		data := SandboxTerminatedObservationData{Reason: TerminationReasonExited}
+		if code, err := strconv.Atoi(msg.Actor.Attributes["exitCode"]); err == nil {
+			data.ExitCode = code
+		}
+		inspectCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+		info, err := m.docker().ContainerInspect(inspectCtx, msg.Actor.ID)
+		cancel()
+		if err == nil && info.State != nil {
+			oom = oom || info.State.OOMKilled
+			data.ExitCode = info.State.ExitCode
+			data.Error = info.State.Error
+		}
+		if oom {
+			data.Reason = TerminationReasonOOMKilled
+		}
+
+		phase := PhaseStopped
+		if oom || data.ExitCode != 0 {
+			phase = PhaseFailed
+		}
+		m.mu.Lock()
+		change, changed := m.transition(state, phase, data.Reason)
+		m.mu.Unlock()
+		if !changed {
+			return // Deleted or restarted meanwhile
+		}
+		m.announcePhase(sandboxID, change, changed)
+
+		m.logger.Warn("Sandbox container terminated unexpectedly", "sandboxID", sandboxID, "containerID", msg.Actor.ID, "reason", data.Reason, "exitCode", data.ExitCode)
+		m.pushObservation(sandboxID, "", "sandbox_terminated", data)
+	}
+}
@@ -0,0 +1,124 @@
+package manager
+
+import (
+	"context"
+	"io"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/docker/docker/api/types/container"
+
+	"github.com/foreveryh/sandboxai/go/mentisruntime/sandboxlog"
+)
+
+var (
+	ErrLogsDisabled = newError(KindUnavailable, "logs_disabled", "sandbox log files not configured")
+	ErrLogNotFound  = newError(KindNotFound, "log_not_found", "sandbox log not found")
+)
+
+// WithSandboxLogs writes the container output and observations of each sandbox to log files
+// in store. The files are kept after the sandbox is deleted, for post-mortems.
+func WithSandboxLogs(store *sandboxlog.Store) Option {
+	return func(m *SandboxManager) {
+		m.logs = store
+	}
+}
+
+// followContainerLogs copies the output of a sandbox container since a point in time to its
+// container log until the container stops. Each container is followed at most once at a time.
+func (m *SandboxManager) followContainerLogs(sandboxID, spaceID, containerID string, since time.Time) {
+	if m.logs == nil {
+		return
+	}
+	m.mu.Lock()
+	if m.logFollowers[containerID] {
+		m.mu.Unlock()
+		return
+	}
+	m.logFollowers[containerID] = true
+	m.mu.Unlock()
+
+	go func() {
+		defer func() {
+			m.mu.Lock()
+			delete(m.logFollowers, containerID)
+			_, known := m.sandboxes[sandboxID]
+			m.mu.Unlock()
+			if !known {
+				m.logs.Close(sandboxID)
+			}
+		}()
+		if err := m.logs.Register(sandboxID, spaceID); err != nil {
+			m.logger.Error("Failed to register sandbox logs", "sandboxID", sandboxID, "error", err)
+			return
+		}
+		// The container has a TTY, so stdout and stderr arrive as one unframed stream.
+		out, err := m.docker().ContainerLogs(context.Background(), containerID, container.LogsOptions{
+			ShowStdout: true,
+			ShowStderr: true,
+			Follow:     true,
+			Since:      strconv.FormatInt(since.Unix(), 10),
+		})
+		if err != nil {
+			m.logger.Warn("Failed to follow container logs", "sandboxID", sandboxID, "containerID", containerID, "error", err)
+			return
+		}
+		defer out.Close()
+		buf := make([]byte, 32<<10)
+		for {
+			n, err := out.Read(buf)
+			if n > 0 {
+				if appendErr := m.logs.Append(sandboxID, sandboxlog.ContainerLog, buf[:n]); appendErr != nil {
+					m.logger.Error("Failed to write container log", "sandboxID", sandboxID, "error", appendErr)
+				}
+			}
+			if err != nil {
+				if err != io.EOF {
+					m.logger.Warn("Container log stream ended", "sandboxID", sandboxID, "containerID", containerID, "error", err)
+				}
+				return
+			}
+		}
+	}()
+}
+
+// logObservation appends a broadcast observation to the sandbox's observations log.
+func (m *SandboxManager) logObservation(sandboxID string, message []byte) {
+	buf := logLines.Get().(*[]byte)
+	defer logLines.Put(buf)
+	line := append(append((*buf)[:0], message...), '\n')
+	*buf = line
+	if err := m.logs.Append(sandboxID, sandboxlog.ObservationsLog, line); err != nil {
+		m.logger.Error("Failed to write observations log", "sandboxID", sandboxID, "error", err)
+	}
+}
+
+// logLines holds the buffers observation log lines are built in; the log copies each line
+// out before Append returns.
+var logLines = sync.Pool{New: func() any { return new([]byte) }}
+
+// ListSandboxLogs lists the log files of a sandbox, which may already be deleted.
+func (m *SandboxManager) ListSandboxLogs(ctx context.Context, spaceID, sandboxID string) ([]sandboxlog.FileInfo, error) {
+	if m.logs == nil {
+		return nil, ErrLogsDisabled
+	}
+	owner, files, err := m.logs.List(sandboxID)
+	if err != nil || owner != spaceID {
+		return nil, ErrLogNotFound
+	}
+	return files, nil
+}
+
+// OpenSandboxLog opens a log file of a sandbox for reading.
+func (m *SandboxManager) OpenSandboxLog(ctx context.Context, spaceID, sandboxID, file string) (*os.File, error) {
+	if _, err := m.ListSandboxLogs(ctx, spaceID, sandboxID); err != nil {
+		return nil, err
+	}
+	f, err := m.logs.Open(sandboxID, file)
+	if err != nil {
+		return nil, ErrLogNotFound
+	}
+	return f, nil
+}
@@ -8,6 +8,7 @@ import (
 	"fmt"
 	"io"
 	"log/slog"
+	"net"
 	"net/http"
 	"os"
 	"sync"
@@ -20,17 +21,28 @@ import (
 	"github.com/docker/docker/client"
 	"github.com/docker/go-connections/nat"
 	"github.com/google/uuid"
-
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+
+	"github.com/foreveryh/sandboxai/go/mentisruntime/artifact"
+	"github.com/foreveryh/sandboxai/go/mentisruntime/history"
+	"github.com/foreveryh/sandboxai/go/mentisruntime/redact"
+	"github.com/foreveryh/sandboxai/go/mentisruntime/sandboxlog"
+	"github.com/foreveryh/sandboxai/go/mentisruntime/secret"
+	"github.com/foreveryh/sandboxai/go/mentisruntime/workpool"
 	"github.com/foreveryh/sandboxai/go/mentisruntime/ws"
 )
 
 // Define package-level errors
 var (
-	ErrSpaceNotFound     = errors.New("space not found")
-	ErrSpaceNameConflict = errors.New("space name conflict")
-	ErrSandboxNotFound   = errors.New("sandbox not found")
+	ErrSpaceNotFound     = newError(KindNotFound, "space_not_found", "space not found")
+	ErrSpaceNameConflict = newError(KindConflict, "space_name_conflict", "space name conflict")
+	ErrSandboxNotFound   = newError(KindNotFound, "sandbox_not_found", "sandbox not found")
+	ErrSandboxNotRunning = newError(KindConflict, "sandbox_not_running", "sandbox not running")
 )
 
+// AgentPort is the container port of the agent of a sandbox, which only the runtime calls.
+const AgentPort = nat.Port("8000/tcp")
+
 // SpaceState represents the state of a space
 type SpaceState struct {
 	ID          string
@@ -39,53 +51,335 @@ type SpaceState struct {
 	CreatedAt   time.Time
 	UpdatedAt   time.Time
 	Metadata    map[string]interface{}
+	Protected   bool                     `json:",omitempty"` // Deleting requires force
+	Tenant      string                   `json:",omitempty"` // Owning tenant; empty for spaces shared by all requests
+	Isolated    bool                     `json:",omitempty"` // Sandboxes stay off the space network
+	Volumes     []SpaceVolume            `json:",omitempty"` // Mounted read-only into every new sandbox
+	Budget      *Budget                  `json:",omitempty"` // Caps the usage of its sandboxes
 	Sandboxes   map[string]*SandboxState // Map sandboxID to its state
 }
 
 // SandboxState represents the state of a sandbox
 type SandboxState struct {
-	ID          string `json:"sandbox_id"` // Changed JSON tag back to sandbox_id
-	ContainerID string `json:"container_id,omitempty"` // Add JSON tags for consistency
-	AgentURL    string `json:"agent_url,omitempty"`    // Add JSON tags for consistency
-	IsRunning   bool   `json:"is_running"`           // Add JSON tags for consistency
-	SpaceID     string `json:"space_id,omitempty"`     // Add JSON tags for consistency
+	ID              string            `json:"sandbox_id"`             // Changed JSON tag back to sandbox_id
+	Name            string            `json:"name,omitempty"`         // Unique in the space; routes accept it in place of the ID
+	ContainerID     string            `json:"container_id,omitempty"` // Add JSON tags for consistency
+	AgentURL        string            `json:"agent_url,omitempty"`    // Add JSON tags for consistency
+	Phase           SandboxPhase      `json:"state"`                  // Lifecycle phase; changed only through transition
+	IsRunning       bool              `json:"is_running"`             // Whether the agent accepts actions; follows Phase
+	SpaceID         string            `json:"space_id,omitempty"`     // Add JSON tags for consistency
+	Image           string            `json:"image,omitempty"`
+	Env             map[string]string `json:"env,omitempty"`     // Plain env vars only; secret values are never stored here
+	Secrets         []SecretRef       `json:"secrets,omitempty"` // Secret references, without values
+	SecurityProfile string            `json:"security_profile,omitempty"`
+	SeccompProfile  string            `json:"seccomp_profile,omitempty"`  // Chosen seccomp profile; empty for the security profile's
+	AppArmorProfile string            `json:"apparmor_profile,omitempty"` // Chosen AppArmor profile; empty for Docker's default
+	Tmpfs           map[string]string `json:"tmpfs,omitempty"`
+	DiskLimit       string            `json:"disk_limit,omitempty"`
+	Ulimits         map[string]Ulimit `json:"ulimits,omitempty"`       // Ulimits set by the spec, over the security profile's
+	Health          string            `json:"health,omitempty"`        // HealthHealthy or HealthDegraded
+	RestartCount    int               `json:"restart_count,omitempty"` // Restarts done by the health monitor
+	ClonedFrom      string            `json:"cloned_from,omitempty"`   // Source sandbox of a clone
+	Workdir         string            `json:"workdir,omitempty"`
+	Command         []string          `json:"command,omitempty"`
+	Entrypoint      []string          `json:"entrypoint,omitempty"`
+	SetupStatus     string            `json:"setup_status,omitempty"` // SetupRunning, SetupSucceeded or SetupFailed
+	SetupError      string            `json:"setup_error,omitempty"`
+	DNS             []string          `json:"dns,omitempty"`
+	DNSSearch       []string          `json:"dns_search,omitempty"`
+	ExtraHosts      []string          `json:"extra_hosts,omitempty"`
+	Network         string            `json:"network,omitempty"`
+	Hostname        string            `json:"hostname,omitempty"` // Name sibling sandboxes reach it by on the space network
+	IPv6            bool              `json:"ipv6,omitempty"`
+	Sidecars        []SidecarState    `json:"sidecars,omitempty"`
+	Volumes         []VolumeMount     `json:"volumes,omitempty"`
+	SpaceVolumes    []SpaceVolume     `json:"space_volumes,omitempty"` // Shared volumes of the space, mounted read-only
+	PrivateNetworks []string          `json:"private_networks,omitempty"`
+	User            string            `json:"user,omitempty"`
+	Protected       bool              `json:"protected,omitempty"`    // Deleting requires force
+	Labels          map[string]string `json:"labels,omitempty"`       // User labels, without the runtime's "sandboxai." ones
+	ActionQueue     bool              `json:"action_queue,omitempty"` // Actions run one at a time, by priority
+	Jupyter         bool              `json:"jupyter,omitempty"`      // Runs a Jupyter server, proxied under .../jupyter/
+	Platform        string            `json:"platform,omitempty"`     // Image platform ("linux/arm64") the container was created for
 	// Add other relevant state fields
+
+	ctx       context.Context // Bounds agent requests; canceled on deletion and runtime shutdown
+	cancel    context.CancelCauseFunc
+	shells    []string         // Shells the agent reports, asked for by the first action choosing one; nil until then
+	jupyter   *jupyterEndpoint // Jupyter server, found on first use of the proxy
+	setup     []string         // Setup commands, run again by replays; nil for adopted sandboxes
+	setupHash string           // Hash of the Setup commands, part of the result cache key
+	imageID   string           // ID of the container's image, read on the first cached action
+	startedAt time.Time        // When the container was started; usage is metered from then
+}
+
+// SandboxSpec describes how a sandbox container should be created.
+type SandboxSpec struct {
+	Image string
+	// Command and Entrypoint override the image CMD and ENTRYPOINT (exec form). The resulting
+	// process must still start the agent, or the sandbox never becomes ready.
+	Command    []string
+	Entrypoint []string
+	Env        map[string]string
+	Secrets    []SecretRef
+	// SecurityProfile names a built-in profile ("default", "hardened"); empty uses the runtime default.
+	SecurityProfile string
+	// SeccompProfile and AppArmorProfile name the seccomp and AppArmor profiles of the
+	// container, shipped with the runtime or provided by the host. An empty SeccompProfile
+	// keeps the runtime default, an empty AppArmorProfile Docker's.
+	SeccompProfile  string
+	AppArmorProfile string
+	// Tmpfs maps container paths to tmpfs mount options (e.g. "rw,size=64m").
+	Tmpfs map[string]string
+	// DiskLimit caps the writable layer via storage-opt size (e.g. "10G").
+	DiskLimit string
+	// Ulimits sets "nofile", "nproc" and "core" ulimits of the container by name, over the
+	// defaults of the security profile, whose hard limits they may only lower.
+	Ulimits map[string]Ulimit
+	// Labels are added to the container; "sandboxai." keys are reserved for the runtime.
+	Labels map[string]string
+	// ClonedFrom is the source sandbox when Image was committed by CloneSandbox.
+	ClonedFrom string
+	// Workdir is the working directory of the agent and its actions; empty keeps the image default.
+	Workdir string
+	// User runs the container as "user", "uid" or "uid:gid"; empty keeps the image default.
+	User string
+	// Setup holds shell commands run through the agent before the sandbox is handed out.
+	Setup []string
+	// SetupTimeout bounds all Setup commands together; DefaultSetupTimeout if zero.
+	SetupTimeout time.Duration
+	// KeepOnSetupFailure keeps a sandbox whose setup failed, with SetupStatus SetupFailed,
+	// instead of deleting it and failing the creation.
+	KeepOnSetupFailure bool
+	// DNS and DNSSearch set the nameservers and search domains of the container's resolver;
+	// ExtraHosts adds "hostname:ip" entries to its /etc/hosts.
+	DNS        []string
+	DNSSearch  []string
+	ExtraHosts []string
+	// Network is an existing Docker network to attach to; DefaultNetwork ("nat" on Windows) if empty.
+	Network string
+	// IPv6 enables IPv6 in the container; the network must have IPv6 enabled.
+	IPv6 bool
+	// Sidecars are started before the sandbox and removed together with it.
+	Sidecars []SidecarSpec
+	// Volumes mounts sandbox-owned named volumes, which sidecars may mount too.
+	Volumes []VolumeMount
+	// PrivateNetworks are the sandbox's private networks it joins; DefaultPrivateNetwork if
+	// empty and there are sidecars.
+	PrivateNetworks []string
+	// Protected makes deleting the sandbox require force.
+	Protected bool
+	// ActionQueue runs the sandbox's actions one at a time, highest "priority" first, instead
+	// of sending them to the agent concurrently.
+	ActionQueue bool
+	// Jupyter makes the agent start a Jupyter server, which Jupyter clients reach through the
+	// runtime's proxy. The image must have jupyter_server installed.
+	Jupyter bool
+	// Hostname is a name, unique in the space, that sibling sandboxes reach the sandbox by on
+	// the space network, besides its ID. It needs space networks.
+	Hostname string
+	// Name is a name, unique in the space, that API routes accept in place of the sandbox ID.
+	// It is also part of the container name.
+	Name string
+	// Platform is the image platform ("os/arch[/variant]", e.g. "linux/arm64") to pull and run
+	// the image for; the host's if empty.
+	Platform string
 }
 
 type SandboxManager struct {
 	mu           sync.RWMutex
-	sandboxes    map[string]*SandboxState  // Map sandboxID to its state
-	httpClient   *http.Client
+	ctx          context.Context               // Parent of the sandbox contexts; done when the runtime shuts down
+	sandboxes    map[string]*SandboxState      // Map sandboxID to its state
+	watches      map[string]map[string]*Watch  // Map sandboxID to its filesystem watches
+	kernels      map[string]map[string]*Kernel // Map sandboxID to its IPython kernels, once one is used
+	httpClient   *http.Client                  // Agent control calls and health probes, with agentCallTimeout
+	actionClient *http.Client                  // Action requests, which last as long as the action
+	breakers     agentBreakers                 // Circuit breaker per sandbox for agent calls
 	logger       *slog.Logger
-	dockerClient *client.Client // Docker client for container operations
-	hub          *ws.Hub          // WebSocket Hub for broadcasting observations
-	spaceManager *SpaceManager    // Add reference to SpaceManager
-	scope        string           // Scope for managing containers
+	dockerMu     sync.RWMutex   // Guards dockerClient and dockerUp, which a reconnection replaces
+	dockerClient *client.Client // Docker client for container operations; use m.docker()
+	dockerUp     chan struct{}  // Closed once the daemon answers again; nil until a reconnection
+	hub          *ws.Hub        // WebSocket Hub for broadcasting observations
+	spaceManager *SpaceManager  // Add reference to SpaceManager
+	scope        string         // Scope for managing containers
+
+	artifactStore   artifact.Store         // Optional object storage for captured artifacts
+	artifactURLTTL  time.Duration          // Lifetime of artifact download URLs
+	artifacts       map[string][]*Artifact // Map sandboxID to captured artifacts; kept after sandbox deletion
+	secretStore     *secret.Store          // Optional encrypted secret store
+	redactor        *redact.Redactor       // Masks credentials in observations; nil disables
+	subs            subscriptions          // In-process receivers of observations (StreamObservations)
+	observationKeys *observationCipher     // Seals the persisted history per space; nil disables
+
+	defaultSecurityProfile string            // Profile applied when a create request names none
+	seccompProfile         string            // Seccomp profile JSON used by the hardened profile
+	seccompProfiles        map[string]string // Host-provided seccomp profiles sandboxes can choose, JSON by name
+	defaultSeccompProfile  string            // Seccomp profile of sandboxes choosing none; empty keeps their security profile's
+	appArmorProfiles       []string          // Host AppArmor profiles sandboxes can choose
+
+	diskCheckInterval time.Duration            // Disk monitor period; zero disables the monitor
+	diskKillThreshold int64                    // Writable layer size that gets a sandbox killed; zero disables
+	stats             map[string]*SandboxStats // Map sandboxID to its last measured stats
+	oomKilled         map[string]bool          // Sandboxes with a pending Docker "oom" event
+
+	health         HealthConfig   // Agent health monitoring; zero interval disables it
+	healthFailures map[string]int // Map sandboxID to consecutive failed health probes
+
+	reconcileInterval time.Duration // Reconciler period; zero disables the reconciler
+	orphanPolicy      string        // What the reconciler does with unknown scope containers
+	reconcileNow      chan struct{} // Requests an immediate reconciliation pass
+	gcInterval        time.Duration // Scheduled GC period; zero disables scheduled GC
+	prewarm           *prewarmer    // Images pulled ahead of sandbox creation; nil if disabled
+
+	spaceNetworks bool // Sandboxes join a network of their space
+
+	history *history.Store // Optional observation history
+
+	schedules            map[string]map[string]*Schedule // Map sandboxID to its scheduled actions
+	workflows            map[string]map[string]*Workflow // Map sandboxID to its workflows
+	actionWaiters        map[string]chan int             // Map actionID to the channel receiving its exit code
+	activeActions        map[string]string               // Map actionID to the sandboxID of actions not yet ended
+	actionMetadata       map[string]json.RawMessage      // Map actionID to the client metadata added to its observations, until its "end"
+	actionStreams        map[string]*actionStreams       // Map actionID to the stream numbering and aggregate of active actions
+	actionProgress       map[string]*actionProgress      // Map actionID to the progress reported by active actions
+	resultCache          *resultCache                    // Results of cached actions; nil unless WithResultCache
+	recordings           map[string]*actionRecording     // Map sandboxID to the actions issued against it, for replays
+	replays              map[string]*Replay              // Map the sandboxID of replay sandboxes to their replay
+	actionQueues         map[string]*actionQueue         // Map sandboxID to its action queue, for sandboxes in queue mode
+	maxConcurrentActions int                             // Running actions allowed per sandbox; zero means unlimited
+	coalesce             CoalescePolicy                  // Stream coalescing of actions that do not set their own
+	batches              map[string]*streamBatch         // Map actionID to its pending stream lines, for coalescing actions
+
+	outputLimits OutputLimits             // Caps on stream output per line and per action
+	outputs      map[string]*actionOutput // Map actionID to its stream output accounting
+
+	builds map[string]*ImageBuild // Map buildID to its image build
+
+	creationsMu  sync.Mutex                    // Not m.mu, so progress reports never wait on sandbox operations
+	creations    map[string]*CreationProgress  // Map sandboxID to creations in progress or recently failed
+	reservations map[string]sandboxReservation // Map sandboxID to the name and hostname of sandboxes being created; guarded by m.mu
+	networkMu    sync.Mutex                    // Serializes the creation of space networks
+
+	logs         *sandboxlog.Store // Optional per-sandbox log files
+	logFollowers map[string]bool   // Containers whose output is being copied to their log
+
+	statusInterval time.Duration // Status heartbeat period; zero disables the heartbeat
+
+	usage     *usageLedger // Resource usage per sandbox and budgets; nil unless WithUsageAccounting
+	costRates CostRates    // Prices of usage, for budgets in cost units
+
+	pressure *hostPressure // Host load against its soft limits; nil unless WithHostPressureLimits
+
+	reconnect DockerReconnect // Check of the connection to the Docker daemon; zero interval disables it
+
+	platform Platform // OS of the sandboxes' containers
+
+	shutdownTimeout time.Duration // Time the agent gets to shut down before its container is stopped
+
+	agentEncoding string // Encoding agents push observations in; empty leaves the agent default (JSON)
+
+	poolSizes       PoolSizes
+	actionPool      *workpool.Pool // Sends actions to agents
+	observationPool *workpool.Pool // Post-processes observations
+	dockerPool      *workpool.Pool // Docker calls fanned out over sandboxes
+	loops           workpool.Group // Background loops, which return when ctx ends
 }
 
 // NewSandboxManager creates a new SandboxManager.
-func NewSandboxManager(ctx context.Context, dockerClient *client.Client, hub *ws.Hub, spaceManager *SpaceManager, logger *slog.Logger, scope string) (*SandboxManager, error) {
+func NewSandboxManager(ctx context.Context, dockerClient *client.Client, hub *ws.Hub, spaceManager *SpaceManager, logger *slog.Logger, scope string, opts ...Option) (*SandboxManager, error) {
+	transport := newAgentTransport()
 	m := &SandboxManager{
-		sandboxes:    make(map[string]*SandboxState),
-		httpClient:   &http.Client{Timeout: 10 * time.Second}, // Add a default timeout
-		logger:       logger.With("component", "sandbox-manager"),
-		dockerClient: dockerClient,
-		hub:          hub,
-		spaceManager: spaceManager, // Store SpaceManager
-		scope:        scope,
+		ctx:            ctx,
+		sandboxes:      make(map[string]*SandboxState),
+		watches:        make(map[string]map[string]*Watch),
+		kernels:        make(map[string]map[string]*Kernel),
+		httpClient:     &http.Client{Transport: transport, Timeout: agentCallTimeout},
+		actionClient:   &http.Client{Transport: transport}, // No overall timeout: the agent answers when the action ends
+		logger:         logger.With("component", "sandbox-manager"),
+		dockerClient:   dockerClient,
+		hub:            hub,
+		spaceManager:   spaceManager, // Store SpaceManager
+		scope:          scope,
+		artifacts:      make(map[string][]*Artifact),
+		stats:          make(map[string]*SandboxStats),
+		oomKilled:      make(map[string]bool),
+		healthFailures: make(map[string]int),
+		reconcileNow:   make(chan struct{}, 1),
+		schedules:      make(map[string]map[string]*Schedule),
+		workflows:      make(map[string]map[string]*Workflow),
+		actionWaiters:  make(map[string]chan int),
+		activeActions:  make(map[string]string),
+		actionMetadata: make(map[string]json.RawMessage),
+		actionStreams:  make(map[string]*actionStreams),
+		actionProgress: make(map[string]*actionProgress),
+		actionQueues:   make(map[string]*actionQueue),
+		outputs:        make(map[string]*actionOutput),
+		builds:         make(map[string]*ImageBuild),
+		logFollowers:   make(map[string]bool),
+	}
+	for _, opt := range opts {
+		opt(m)
+	}
+	// A misspelt default profile would otherwise only fail the first sandbox creation
+	if _, err := m.resolveSecurityProfile(""); err != nil {
+		return nil, err
+	}
+	m.loadSecretValues()
+	if m.observationKeys != nil && m.history != nil {
+		m.history.SetCipher(m.observationKeys)
+	}
+	m.startPools()
+	m.background("container_events", m.watchContainerEvents)
+	m.background("scheduler", m.runScheduler)
+	if m.diskCheckInterval > 0 {
+		m.background("disk_monitor", m.runDiskMonitor)
+	}
+	if m.health.Interval > 0 {
+		m.background("health_monitor", m.runHealthMonitor)
+	}
+	if m.reconcileInterval > 0 {
+		m.background("reconciler", m.runReconciler)
+	}
+	if m.gcInterval > 0 {
+		m.background("garbage_collector", m.runGarbageCollector)
+	}
+	if m.prewarm != nil {
+		m.background("prewarmer", m.runPrewarmer)
+	}
+	if m.statusInterval > 0 {
+		m.background("status_heartbeat", m.runStatusHeartbeat)
+	}
+	if m.usage != nil {
+		m.background("usage_sampler", m.runUsageSampler)
+	}
+	if m.pressure != nil {
+		m.background("pressure_monitor", m.runPressureMonitor)
+	}
+	if m.reconnect.Interval > 0 {
+		m.background("docker_monitor", m.runDockerMonitor)
 	}
-
-	// TODO: Consider reconciling existing Docker containers managed by this scope on startup?
 
 	return m, nil
 }
 
-// SandboxExists checks if a sandbox with the given ID is known to the manager.
+// SandboxExists checks if a sandbox with the given ID is known to the manager, and, for
+// contexts with a tenant, is in one of the tenant's spaces.
 // This method implements the ws.SandboxChecker interface.
 func (m *SandboxManager) SandboxExists(ctx context.Context, sandboxID string) (bool, error) {
-	m.mu.RLock()
-	_, exists := m.sandboxes[sandboxID]
-	m.mu.RUnlock()
+	// Streams carry the progress of its creation
+	spaceID, exists := m.creationSpace(sandboxID)
+	if !exists {
+		m.mu.RLock()
+		state, ok := m.sandboxes[sandboxID]
+		if ok {
+			spaceID, exists = state.SpaceID, true
+		}
+		m.mu.RUnlock()
+	}
+	if exists && TenantFromContext(ctx) != "" {
+		_, err := m.spaceManager.GetSpace(ctx, spaceID)
+		exists = err == nil
+	}
 	// In this basic implementation, we don't return an error, just existence.
 	// A more complex implementation might check Docker or other sources.
 	return exists, nil
@@ -95,12 +389,55 @@ func (m *SandboxManager) SandboxExists(ctx context.Context, sandboxID string) (b
 // It generates an action ID, validates the sandbox state, launches a goroutine
 // for execution, and returns the action ID immediately.
 func (m *SandboxManager) InitiateAction(ctx context.Context, sandboxID string, actionType string, payload map[string]interface{}) (string, error) {
+	if err := m.checkSetupDone(sandboxID); err != nil {
+		return "", err
+	}
+	return m.initiateAction(ctx, sandboxID, actionType, payload, nil)
+}
+
+// initiateAction implements InitiateAction. If done is non-nil, the action's exit code is
+// sent on it when the action ends; it must be buffered.
+func (m *SandboxManager) initiateAction(ctx context.Context, sandboxID string, actionType string, payload map[string]interface{}, done chan int) (string, error) {
 	m.mu.RLock()
 	state, exists := m.sandboxes[sandboxID]
 	m.mu.RUnlock()
 
-	if !exists || !state.IsRunning {
-		return "", fmt.Errorf("sandbox %s not found or not running", sandboxID)
+	if !exists {
+		return "", ErrSandboxNotFound
+	}
+	if !state.IsRunning {
+		return "", ErrSandboxNotRunning
+	}
+	if err := m.checkBudget(state.SpaceID); err != nil {
+		return "", err
+	}
+	if actionType == "shell" {
+		if err := m.checkActionShell(ctx, sandboxID, payload); err != nil {
+			return "", err
+		}
+		if err := m.checkActionUser(state, payload); err != nil {
+			return "", err
+		}
+	}
+	if actionType == "ipython" {
+		if err := m.checkActionKernel(sandboxID, payload); err != nil {
+			return "", err
+		}
+	}
+
+	var cacheKey string
+	if cache, _ := payload["cache"].(bool); cache {
+		key, result, err := m.lookupResult(ctx, sandboxID, actionType, payload)
+		if err != nil {
+			return "", err
+		}
+		if result != nil {
+			actionID := uuid.NewString()
+			m.recordAction(sandboxID, cachedRecord(actionID, actionType, payload, result))
+			m.replayResult(sandboxID, actionID, payload, result, done)
+			return actionID, nil
+		}
+		cacheKey = key
 	}
 
 	actionID := uuid.NewString()
@@ -110,6 +447,9 @@ func (m *SandboxManager) InitiateAction(ctx context.Context, sandboxID string, a
 		"action_id": actionID,
 	}
 	for k, v := range payload {
+		if runtimeActionFields[k] {
+			continue
+		}
 		requestPayload[k] = v // Copy original payload (command, code, etc.)
 	}
 
@@ -125,12 +465,52 @@ func (m *SandboxManager) InitiateAction(ctx context.Context, sandboxID string, a
 	case "ipython":
 		agentURL = fmt.Sprintf("%s/tools:run_ipython_cell", state.AgentURL) // Corrected path
 	default:
-		return "", fmt.Errorf("unsupported action type: %s", actionType)
+		return "", &Error{Kind: KindInvalid, Code: "unsupported_action_type", Message: "unsupported action type: " + actionType}
+	}
+
+	m.mu.Lock()
+	if limit := m.maxConcurrentActions; limit > 0 && !state.ActionQueue {
+		if n := m.activeActionCountLocked(sandboxID); n >= limit {
+			spaceID := state.SpaceID
+			m.mu.Unlock()
+			m.pushSpaceEvent(spaceID, SpaceEventQuotaWarning, QuotaWarningData{SandboxID: sandboxID, Quota: "concurrent_actions", Used: int64(n), Limit: int64(limit)})
+			return "", fmt.Errorf("%w: %q has %d of %d", ErrTooManyActions, sandboxID, n, limit)
+		}
+	}
+	m.activeActions[actionID] = sandboxID
+	if done != nil {
+		m.actionWaiters[actionID] = done
+	}
+	m.startCoalescingLocked(sandboxID, actionID, actionCoalescePolicy(payload, m.coalesce))
+	if metadata := actionMetadataOf(payload); metadata != nil {
+		m.actionMetadata[actionID] = metadata
+	}
+	m.startStreamsLocked(actionID, payload)
+	if actionType == "ipython" {
+		m.startKernelLocked(sandboxID, actionID, payload)
 	}
+	if cacheKey != "" {
+		m.startRecordingLocked(actionID, cacheKey)
+	}
+	var record *RecordedAction
+	if state.SetupStatus != SetupRunning { // Replays run the setup commands themselves
+		record = m.startRecordLocked(actionID, actionType, payload)
+	}
+	m.mu.Unlock()
 
-	// Launch the goroutine to handle the actual execution and streaming
-	m.logger.Debug("Initiating action goroutine", "sandboxID", sandboxID, "actionID", actionID, "actionType", actionType) // 添加这行
-	go m.handleActionExecution(context.Background(), sandboxID, actionID, agentURL, requestBody, actionType)
+	// Launch the goroutine to handle the actual execution and streaming, or wait for the sandbox's earlier actions
+	action := &queuedAction{id: actionID, actionType: actionType, agentURL: agentURL, body: requestBody, priority: actionPriority(payload)}
+	if state.ActionQueue {
+		m.enqueueAction(sandboxID, action)
+	} else if err := m.dispatchAction(sandboxID, action); err != nil {
+		m.actionEnded(actionID, -1)
+		m.setActionMetadata(actionID, nil)
+		m.endStreams(actionID, nil)
+		return "", err
+	}
+	if record != nil {
+		m.recordAction(sandboxID, record)
+	}
 
 	m.logger.Info("Action initiated", "sandboxID", sandboxID, "actionID", actionID, "actionType", actionType)
 	return actionID, nil // Return immediately
@@ -140,17 +520,31 @@ func (m *SandboxManager) InitiateAction(ctx context.Context, sandboxID string, a
 type Observation struct {
 	ObservationType string      `json:"observation_type"` // Corrected JSON tag
 	ActionID        string      `json:"action_id"`        // Corrected JSON tag
-	Timestamp       string      `json:"timestamp"`       // Corrected JSON tag
-	Data            interface{} `json:"data,omitempty"`  // Corrected JSON tag
+	Timestamp       string      `json:"timestamp"`        // Corrected JSON tag
+	Data            interface{} `json:"data,omitempty"`   // Corrected JSON tag
 }
 
 type StartObservationData struct {
 	// Add relevant start data if needed
 }
 
+// Stream frame encodings.
+const (
+	EncodingUTF8   = "utf-8"  // Line is text (the default when encoding is absent)
+	EncodingBase64 = "base64" // Line is base64-encoded binary data
+)
+
+// StreamObservationData describes a "stream" frame. Binary payloads such as images are sent
+// base64-encoded; large ones are split into frames sharing a ChunkID, with increasing
+// ChunkIndex and Final set on the last frame.
 type StreamObservationData struct {
-	Stream string `json:"stream"` // Corrected JSON tag
-	Line   string `json:"line"`   // Corrected JSON tag
+	Stream     string `json:"stream"` // Corrected JSON tag
+	Line       string `json:"line"`   // Corrected JSON tag
+	Encoding   string `json:"encoding,omitempty"`
+	MimeType   string `json:"mime_type,omitempty"`
+	ChunkID    string `json:"chunk_id,omitempty"`
+	ChunkIndex int    `json:"chunk_index,omitempty"`
+	Final      bool   `json:"final,omitempty"`
 }
 
 type ErrorObservationData struct {
@@ -160,22 +554,44 @@ type ErrorObservationData struct {
 type EndObservationData struct {
 	ExitCode int    `json:"exit_code"`       // Corrected JSON tag
 	Error    string `json:"error,omitempty"` // Corrected JSON tag
+	// The output of actions asking for an aggregate: Output with AggregateMerged, Stdout
+	// and Stderr with AggregateSeparate
+	Output          *string `json:"output,omitempty"`
+	Stdout          *string `json:"stdout,omitempty"`
+	Stderr          *string `json:"stderr,omitempty"`
+	OutputTruncated bool    `json:"output_truncated,omitempty"` // The aggregate stops at maxAggregateBytes
+	// How the action ended and what it used, as reported by the agent in its "result"
+	Signal    string         `json:"signal,omitempty"`     // Signal that killed the command, such as "SIGKILL"
+	OOMKilled bool           `json:"oom_killed,omitempty"` // Killed by the kernel's out-of-memory killer
+	Usage     *ResourceUsage `json:"usage,omitempty"`
+	CacheHit  bool           `json:"cache_hit,omitempty"` // Answered from the result cache without running
+}
+
+// ResourceUsage is what an action used, measured by the agent. IPython cells run in the
+// agent's process, so their CPU time is that of the thread running them and they have no
+// MaxRSSBytes of their own.
+type ResourceUsage struct {
+	DurationMS  int64 `json:"duration_ms"` // Wall-clock time
+	UserCPUMS   int64 `json:"user_cpu_ms"`
+	SystemCPUMS int64 `json:"system_cpu_ms"`
+	MaxRSSBytes int64 `json:"max_rss_bytes,omitempty"` // Peak resident memory of the command and the children it waited for
 }
 
 // AgentObservation defines the structure expected from the agent's streaming response lines.
 type AgentObservation struct {
-	Type     string          `json:"type"`               // Corrected JSON tag
-	Stream   string          `json:"stream,omitempty"`   // Corrected JSON tag
-	Line     string          `json:"line,omitempty"`     // Corrected JSON tag
-	ExitCode *int            `json:"exit_code,omitempty"` // Corrected JSON tag
-	Error    string          `json:"error,omitempty"`     // Corrected JSON tag
+	Type     string `json:"type"`                // Corrected JSON tag
+	Stream   string `json:"stream,omitempty"`    // Corrected JSON tag
+	Line     string `json:"line,omitempty"`      // Corrected JSON tag
+	ExitCode *int   `json:"exit_code,omitempty"` // Corrected JSON tag
+	Error    string `json:"error,omitempty"`     // Corrected JSON tag
 }
 
 // handleActionExecution runs in a goroutine to execute the action via the internal agent.
 // It only handles the initial request and immediate HTTP errors.
 // Subsequent observations (stream, result) are handled by ReceiveInternalObservation.
 func (m *SandboxManager) handleActionExecution(ctx context.Context, sandboxID, actionID, agentURL string, requestBody []byte, actionType string) {
-	m.logger.Debug("Goroutine started for action", "sandboxID", sandboxID, "actionID", actionID, "actionType", actionType) 
+	defer m.recoverPanic("action", func(err error) { m.abortAction(sandboxID, actionID, err) })
+	m.logger.Debug("Goroutine started for action", "sandboxID", sandboxID, "actionID", actionID, "actionType", actionType)
 	// Send StartObservation immediately via the Hub
 	m.pushObservation(sandboxID, actionID, "start", StartObservationData{})
 
@@ -183,18 +599,21 @@ func (m *SandboxManager) handleActionExecution(ctx context.Context, sandboxID, a
 	if err != nil {
 		errMsg := fmt.Sprintf("Failed to create request to agent: %v", err)
 		m.pushErrorObservation(sandboxID, actionID, errMsg)
-		m.pushObservation(sandboxID, actionID, "end", EndObservationData{ExitCode: -1, Error: errMsg})
+		m.pushEndObservation(sandboxID, actionID, EndObservationData{ExitCode: -1, Error: errMsg})
 		return
 	}
 	req.Header.Set("Content-Type", "application/json")
 	// We don't strictly need Accept header anymore if we don't read the body for observations
-	// req.Header.Set("Accept", "application/x-ndjson") 
+	// req.Header.Set("Accept", "application/x-ndjson")
 
-	resp, err := m.httpClient.Do(req)
+	resp, err := m.doAgent(m.actionClient, sandboxID, req)
 	if err != nil {
 		errMsg := fmt.Sprintf("Failed to execute action request via agent: %v", err)
+		if ctx.Err() != nil {
+			errMsg = fmt.Sprintf("Action cancelled: %v", context.Cause(ctx))
+		}
 		m.pushErrorObservation(sandboxID, actionID, errMsg)
-		m.pushObservation(sandboxID, actionID, "end", EndObservationData{ExitCode: -1, Error: errMsg})
+		m.pushEndObservation(sandboxID, actionID, EndObservationData{ExitCode: -1, Error: errMsg})
 		return
 	}
 	defer resp.Body.Close()
@@ -209,7 +628,7 @@ func (m *SandboxManager) handleActionExecution(ctx context.Context, sandboxID, a
 			errorMsg += fmt.Sprintf(" (failed to read error body: %v)", readErr)
 		}
 		m.pushErrorObservation(sandboxID, actionID, errorMsg)
-		m.pushObservation(sandboxID, actionID, "end", EndObservationData{ExitCode: -1, Error: errorMsg})
+		m.pushEndObservation(sandboxID, actionID, EndObservationData{ExitCode: -1, Error: errorMsg})
 		return
 	}
 
@@ -222,12 +641,44 @@ func (m *SandboxManager) handleActionExecution(ctx context.Context, sandboxID, a
 	// Let ReceiveInternalObservation handle stream/result/end logic based on pushed data.
 }
 
+// pushEndObservation sends the "end" observation of an action that failed before reaching the agent.
+func (m *SandboxManager) pushEndObservation(sandboxID, actionID string, data EndObservationData) {
+	adv := m.actionEnded(actionID, data.ExitCode)
+	m.endStreams(actionID, &data)
+	m.pushObservation(sandboxID, actionID, "end", data)
+	m.announceActionEnd(sandboxID, actionID, data)
+	m.setActionMetadata(actionID, nil)
+	m.startNext(adv)
+}
+
+// actionEnded delivers an action's exit code to whoever waits for it. For sandboxes in queue
+// mode it returns the queue's next action, which the caller passes to startNext after
+// pushing the "end" observation.
+func (m *SandboxManager) actionEnded(actionID string, exitCode int) queueAdvance {
+	m.stopCoalescing(actionID)
+	m.finishActionOutput(actionID)
+	m.mu.Lock()
+	adv := m.advanceQueueLocked(m.activeActions[actionID], actionID)
+	m.endKernelLocked(m.activeActions[actionID], actionID)
+	m.finishRecordLocked(actionID, exitCode)
+	delete(m.activeActions, actionID)
+	delete(m.actionProgress, actionID)
+	done, ok := m.actionWaiters[actionID]
+	delete(m.actionWaiters, actionID)
+	m.mu.Unlock()
+	if ok {
+		done <- exitCode
+	}
+	return adv
+}
+
 // pushObservation formats and sends an observation via the hub.
 func (m *SandboxManager) pushObservation(sandboxID, actionID, obsType string, data interface{}) {
+	now := time.Now().UTC()
 	obs := Observation{
 		ObservationType: obsType, // Use the renamed field
 		ActionID:        actionID,
-		Timestamp:       time.Now().UTC().Format(time.RFC3339Nano), // Add current timestamp
+		Timestamp:       now.Format(time.RFC3339Nano), // Add current timestamp
 		Data:            data,
 	}
 
@@ -236,10 +687,11 @@ func (m *SandboxManager) pushObservation(sandboxID, actionID, obsType string, da
 		m.logger.Error("Failed to marshal observation", "error", err, "sandboxID", sandboxID, "actionID", actionID, "type", obsType)
 		return
 	}
+	jsonData = m.redactor.Bytes(jsonData)
 
 	m.logger.Debug("Pushing observation via Hub", "sandboxID", sandboxID, "actionID", actionID, "type", obsType, "size", len(jsonData))
-	// Send via Hub
-	m.hub.SubmitBroadcast(sandboxID, jsonData)
+	// Send via Hub; the message was just marshaled, so the history need not parse it again
+	m.broadcastObservation(sandboxID, history.Meta{ObservationType: obsType, ActionID: actionID, Timestamp: now}, jsonData)
 }
 
 // pushErrorObservation formats and sends an error observation.
@@ -251,13 +703,37 @@ func (m *SandboxManager) pushErrorObservation(sandboxID, actionID, errorMsg stri
 // CreateSandbox creates and starts a new sandbox container within a specific space.
 // It pulls the necessary image, creates and starts the container,
 // discovers its IP address, performs a health check on the agent,
-// and stores its state.
-func (m *SandboxManager) CreateSandbox(ctx context.Context, spaceID string, imageArg string, command []string) (string, error) { // command is now []string
-	m.mu.Lock()
-	defer m.mu.Unlock()
+// and stores its state. If the spec has setup commands, they run before CreateSandbox returns.
+// Each step is reported by a "creation_progress" observation on the sandbox's stream.
+func (m *SandboxManager) CreateSandbox(ctx context.Context, spaceID string, spec SandboxSpec) (string, error) {
+	return m.createSandboxWithID(ctx, spaceID, uuid.NewString(), spec)
+}
 
+func (m *SandboxManager) createSandboxWithID(ctx context.Context, spaceID, sandboxID string, spec SandboxSpec) (string, error) {
+	m.assignStream(sandboxID, spaceID)
+	m.beginCreation(sandboxID, spaceID)
+	err := m.checkBudget(spaceID)
+	if err == nil {
+		_, err = m.createSandbox(ctx, spaceID, sandboxID, spec)
+	}
+	if err == nil {
+		m.beginUsage(sandboxID)
+		m.announceCreated(sandboxID)
+	}
+	if err == nil && len(spec.Setup) > 0 {
+		m.reportCreation(sandboxID, CreationRunningSetup, "", nil)
+		err = m.setupSandbox(ctx, sandboxID, spec)
+	}
+	m.endCreation(sandboxID, err)
+	if err != nil {
+		return "", err
+	}
+	return sandboxID, nil
+}
+
+func (m *SandboxManager) createSandbox(ctx context.Context, spaceID, sandboxID string, spec SandboxSpec) (string, error) {
 	// Check if space exists using SpaceManager
-	_, err := m.spaceManager.GetSpace(ctx, spaceID)
+	space, err := m.spaceManager.GetSpace(ctx, spaceID)
 	if err != nil {
 		if errors.Is(err, ErrSpaceNotFound) {
 			return "", ErrSpaceNotFound // Return the specific error
@@ -267,154 +743,276 @@ func (m *SandboxManager) CreateSandbox(ctx context.Context, spaceID string, imag
 		}
 	}
 
-	sandboxID := uuid.NewString() // Generate a unique ID
+	// Docker work runs without m.mu, so other sandboxes stay usable meanwhile; the
+	// reservation keeps concurrent creations from taking the same name or hostname.
+	if err := m.reserveSandbox(space, sandboxID, spec); err != nil {
+		return "", err
+	}
+	defer m.releaseSandbox(sandboxID)
+	registered := false
+
+	// Pull and run the image for the requested platform, else the host's, so arm64 hosts do
+	// not run amd64 images under emulation
+	imagePlatform := m.platform.imagePlatform(spec.Platform)
+	var ociPlatform *ocispec.Platform
+	if imagePlatform != "" {
+		if ociPlatform, err = parseImagePlatform(imagePlatform); err != nil {
+			return "", err
+		}
+	}
 
 	// Get image name from environment variable or use default
-	imageName := imageArg
+	imageName := spec.Image
 	if imageName == "" {
-		imageName = os.Getenv("BOX_IMAGE")
-		if imageName == "" {
-			imageName = "mentisai/sandboxai-box:latest" // Default if no environment variable set
-		}
+		imageName = m.platform.boxImage(imagePlatform)
 	}
-	m.logger.Debug("Using box image", "image", imageName)
+	m.logger.Debug("Using box image", "image", imageName, "platform", imagePlatform)
 
-	agentPortInt := 8000
-	agentPortProto := "tcp"
-	agentPortString := fmt.Sprintf("%d/%s", agentPortInt, agentPortProto)
+	agentPortInt := AgentPort.Int()
+	agentPortString := string(AgentPort)
 
-	m.logger.Info("Creating sandbox", "sandboxID", sandboxID, "spaceID", spaceID, "image", imageName)
+	m.logger.Info("Creating sandbox", "sandboxID", sandboxID, "name", spec.Name, "spaceID", spaceID, "image", imageName)
 
 	// 1. Ensure image exists locally
-	// Use a shorter timeout for image pull check/pull
-	pullCtx, pullCancel := context.WithTimeout(ctx, 5*time.Minute)
-	defer pullCancel()
-
-	// First check if image exists locally
-	inspectCtx, inspectCancel := context.WithTimeout(ctx, 10*time.Second)
-	defer inspectCancel()
-	_, _, errInspect := m.dockerClient.ImageInspectWithRaw(inspectCtx, imageName)
-	if errInspect == nil {
-		// Image exists locally, no need to pull
-		m.logger.Info("Image exists locally, skipping pull", "image", imageName)
-	} else {
-		// Try to pull the image only if it doesn't exist locally
-		m.logger.Info("Image not found locally, attempting to pull", "image", imageName)
-		// Corrected: Use image.PullOptions{} instead of types.
-		out, err := m.dockerClient.ImagePull(pullCtx, imageName, image.PullOptions{})
-		if err != nil {
-			m.logger.Error("Failed to pull image", "image", imageName, "error", err)
-			return "", fmt.Errorf("failed to pull image %s: %w", imageName, err)
-		}
-		// IMPORTANT: Block and drain the output to ensure the pull completes before proceeding.
-		// Discard the output, but log errors if reading fails.
-		defer out.Close()
-		if _, err = io.Copy(io.Discard, out); err != nil {
-			m.logger.Error("Failed reading image pull output", "image", imageName, "error", err)
-			return "", fmt.Errorf("failed reading image pull output for %s: %w", imageName, err)
-		}
-		m.logger.Info("Image pull completed", "image", imageName)
+	err = m.ensureImage(ctx, imageName, imagePlatform, func(percent int) {
+		m.reportCreation(sandboxID, CreationPullingImage, imageName, &percent)
+	})
+	if err != nil {
+		return "", err
 	}
-
-	// Add an explicit check after pulling to ensure the image exists locally
-	// Use a new context for this inspection to avoid using the already potentially cancelled inspectCtx
-	inspectCtx2, inspectCancel2 := context.WithTimeout(ctx, 10*time.Second)
-	defer inspectCancel2()
-	_, _, errInspect2 := m.dockerClient.ImageInspectWithRaw(inspectCtx2, imageName)
-	if errInspect2 != nil {
-		m.logger.Error("Image inspect failed after pull", "image", imageName, "error", errInspect2)
-		return "", fmt.Errorf("image %s not found locally after pull attempt: %w", imageName, errInspect2)
-	}
-	m.logger.Info("Image confirmed to exist locally", "image", imageName)
+	m.reportCreation(sandboxID, CreationCreatingContainer, imageName, nil)
 
 	// 2. Create the container
-	containerName := fmt.Sprintf("sandboxai-%s-%s", m.scope, sandboxID)
-	labels := map[string]string{
-		"sandboxai.scope": m.scope,
-		"sandboxai.id":    sandboxID,
-		"sandboxai.space": spaceID, // Add space label
+	containerName := m.containerName(sandboxID, spec.Name)
+	labels := make(map[string]string, len(spec.Labels)+4)
+	for k, v := range spec.Labels {
+		labels[k] = v
+	}
+	labels["sandboxai.scope"] = m.scope
+	labels["sandboxai.id"] = sandboxID
+	labels["sandboxai.space"] = spaceID // Add space label
+	if spec.ClonedFrom != "" {
+		labels["sandboxai.clone-of"] = spec.ClonedFrom
+	}
+	if spec.Name != "" {
+		labels["sandboxai.name"] = spec.Name
+	}
+	if len(spec.Setup) > 0 {
+		labels["sandboxai.setup-hash"] = setupHashOf(spec.Setup)
+	}
+	if imagePlatform != "" {
+		labels["sandboxai.platform"] = imagePlatform
+	}
+	// Resolve secrets and the security profile before touching Docker so bad references fail fast.
+	secretEnv, secretFiles, err := m.resolveSecrets(space.Tenant, spec.Secrets)
+	if err != nil {
+		return "", err
+	}
+	securityProfile, err := m.resolveSecurityProfile(spec.SecurityProfile)
+	if err != nil {
+		return "", err
+	}
+	seccompProfile, appArmorProfile, err := m.applyConfinement(spec, &securityProfile)
+	if err != nil {
+		return "", err
+	}
+	if err := m.platform.checkSpec(spec, securityProfile); err != nil {
+		return "", err
+	}
+	if err := validateDiskLimit(spec.DiskLimit); err != nil {
+		return "", err
+	}
+	if err := validateUlimits(spec.Ulimits); err != nil {
+		return "", err
+	}
+	if err := checkUlimits(securityProfile, spec); err != nil {
+		return "", err
+	}
+	networkName, err := m.resolveNetwork(ctx, spec)
+	if err != nil {
+		return "", err
 	}
 	// Determine the host address Runtime is listening on, as seen from the container
-	// Using host.docker.internal which works for Docker Desktop. Might need configuration for other environments.
-	runtimeHost := "host.docker.internal"
+	runtimeHost, err := m.runtimeHost(ctx, networkName)
+	if err != nil {
+		return "", err
+	}
 	// Get the port Runtime is listening on (assuming it's passed via env var or default)
 	runtimePort := os.Getenv("SANDBOXAID_PORT")
 	if runtimePort == "" {
 		runtimePort = "5266" // Default port used in main.go
 	}
-	internalObservationURL := fmt.Sprintf("http://%s:%s/v1/internal/observations/%s", runtimeHost, runtimePort, sandboxID)
+	internalObservationURL := fmt.Sprintf("http://%s/v1/internal/observations/%s", net.JoinHostPort(runtimeHost, runtimePort), sandboxID)
+	if spec.Hostname != "" {
+		labels["sandboxai.hostname"] = spec.Hostname
+	}
+	spaceMounts, err := m.spaceVolumeMounts(ctx, space, spec)
+	if err != nil {
+		return "", err
+	}
+	spaceNetwork, err := m.ensureSpaceNetwork(ctx, space)
+	if err != nil {
+		return "", err
+	}
+	if securityProfile.ReadonlyRootfs && len(secretFiles) > 0 {
+		// Docker refuses to copy files into a read-only root filesystem.
+		return "", fmt.Errorf("%w %q: secret files need a writable rootfs, inject them as env vars instead", ErrIncompatibleSecurityProfile, securityProfile.Name)
+	}
 
-	envVars := []string{
+	m.redactEnv(spec.Env)
+	var envVars []string
+	for k, v := range spec.Env {
+		envVars = append(envVars, fmt.Sprintf("%s=%s", k, v))
+	}
+	envVars = append(envVars, secretEnv...)
+	envVars = append(envVars,
 		fmt.Sprintf("SANDBOX_ID=%s", sandboxID),
 		// Add other necessary env vars for the agent
 		fmt.Sprintf("RUNTIME_OBSERVATION_URL=%s", internalObservationURL), // Add URL for agent to push observations
+	)
+	if m.agentEncoding != "" {
+		envVars = append(envVars, fmt.Sprintf("OBSERVATION_ENCODING=%s", m.agentEncoding))
+	}
+	if spec.Workdir != "" {
+		// The agent changes into it on startup, in case the image entrypoint changes directory.
+		envVars = append(envVars, fmt.Sprintf("SANDBOX_WORKDIR=%s", spec.Workdir))
+	}
+	if spec.Jupyter {
+		jupyterVars, err := jupyterEnv(spaceID, sandboxID)
+		if err != nil {
+			return "", err
+		}
+		envVars = append(envVars, jupyterVars...)
+	}
+
+	var sidecars []SidecarState
+	if spec.hasPrivateResources() {
+		if sidecars, err = m.startSidecars(ctx, sandboxID, spaceID, spec); err != nil {
+			return "", err
+		}
+		defer func() {
+			if !registered {
+				m.removeSidecars(sandboxID)
+			}
+		}()
 	}
 
 	// Use a shorter timeout for container operations
 	createCtx, createCancel := context.WithTimeout(ctx, 30*time.Second)
 	defer createCancel()
 
-	resp, err := m.dockerClient.ContainerCreate(
-		createCtx,
-		&container.Config{
-			Image:        imageName,
-			Labels:       labels,
-			Env:          envVars,
-			// Expose agent port
-			ExposedPorts: nat.PortSet{nat.Port(agentPortString): struct{}{}},
-			Tty:          true,
-			OpenStdin:    true,
-		},
-		&container.HostConfig{
-			NetworkMode: "bridge",
-			// Re-introduce PortBindings for reliable connection
-			PortBindings: nat.PortMap{
-				nat.Port(agentPortString): []nat.PortBinding{
-					{
-						HostIP:   "0.0.0.0", // Bind to all host interfaces
-						HostPort: "",      // Let Docker assign a random available port
-					},
+	containerConfig := &container.Config{
+		Image:  imageName,
+		Labels: labels,
+		Env:    envVars,
+		// Expose agent port
+		ExposedPorts: nat.PortSet{nat.Port(agentPortString): struct{}{}},
+		Tty:          true,
+		OpenStdin:    true,
+		Cmd:          spec.Command,
+		Entrypoint:   spec.Entrypoint,
+		WorkingDir:   spec.Workdir,
+		User:         spec.User,
+	}
+	hostConfig := &container.HostConfig{
+		// Re-introduce PortBindings for reliable connection
+		PortBindings: nat.PortMap{
+			nat.Port(agentPortString): []nat.PortBinding{
+				{
+					HostIP:   "0.0.0.0", // Bind to all host interfaces
+					HostPort: "",        // Let Docker assign a random available port
 				},
 			},
-			// AutoRemove: true, // Consider adding this if desired
 		},
+		// AutoRemove: true, // Consider adding this if desired
+	}
+	if spec.Jupyter {
+		containerConfig.ExposedPorts[JupyterPort] = struct{}{}
+		hostConfig.PortBindings[JupyterPort] = []nat.PortBinding{{HostIP: "0.0.0.0", HostPort: ""}}
+	}
+	securityProfile.apply(containerConfig, hostConfig)
+	applyStorageLimits(spec, hostConfig)
+	applyUlimits(securityProfile, spec, hostConfig)
+	applyNetworkConfig(spec, networkName, hostConfig)
+	if m.platform.RuntimeHostGateway {
+		hostConfig.ExtraHosts = append(hostConfig.ExtraHosts, runtimeHost+":host-gateway")
+	}
+	hostConfig.Mounts = append(hostConfig.Mounts, m.volumeMounts(sandboxID, spec.Volumes)...)
+	hostConfig.Mounts = append(hostConfig.Mounts, spaceMounts...)
+
+	resp, err := m.docker().ContainerCreate(
+		createCtx,
+		containerConfig,
+		hostConfig,
 		&network.NetworkingConfig{ // Default network is usually fine
 		},
-		nil, // Platform is usually nil
+		ociPlatform, // nil lets Docker pick the image's platform
 		containerName,
 	)
 	if err != nil {
 		m.logger.Error("Failed to create container", "sandboxID", sandboxID, "name", containerName, "error", err)
-		return "", fmt.Errorf("failed to create container: %w", err)
+		return "", backendError("container_create_failed", "failed to create container", err)
 	}
 
 	m.logger.Info("Container created", "sandboxID", sandboxID, "containerID", resp.ID, "name", containerName)
 
+	if networks := spec.sandboxPrivateNetworks(); len(networks) > 0 {
+		if err := m.connectPrivateNetworks(ctx, sandboxID, resp.ID, networks, "sandbox"); err != nil {
+			rmCtx, rmCancel := context.WithTimeout(context.Background(), 10*time.Second)
+			defer rmCancel()
+			_ = m.docker().ContainerRemove(rmCtx, resp.ID, container.RemoveOptions{Force: true})
+			return "", err
+		}
+	}
+	var hostname string
+	if spaceNetwork != "" {
+		if err := m.joinSpaceNetwork(ctx, spaceNetwork, sandboxID, spec.Hostname, resp.ID); err != nil {
+			rmCtx, rmCancel := context.WithTimeout(context.Background(), 10*time.Second)
+			defer rmCancel()
+			_ = m.docker().ContainerRemove(rmCtx, resp.ID, container.RemoveOptions{Force: true})
+			return "", err
+		}
+		hostname = spaceAliases(sandboxID, spec.Hostname)[0]
+	}
+
+	// Secret files are copied in before start so they exist when the agent boots.
+	if len(secretFiles) > 0 {
+		if err := m.injectSecretFiles(ctx, resp.ID, secretFiles); err != nil {
+			m.logger.Error("Failed to inject secret files", "sandboxID", sandboxID, "containerID", resp.ID, "error", err)
+			rmCtx, rmCancel := context.WithTimeout(context.Background(), 10*time.Second)
+			defer rmCancel()
+			_ = m.docker().ContainerRemove(rmCtx, resp.ID, container.RemoveOptions{Force: true})
+			return "", err
+		}
+	}
+
 	// 3. Start the container
+	m.reportCreation(sandboxID, CreationStartingContainer, "", nil)
 	startCtx, startCancel := context.WithTimeout(ctx, 15*time.Second)
 	defer startCancel()
-	if err := m.dockerClient.ContainerStart(startCtx, resp.ID, container.StartOptions{}); err != nil {
+	startedAt := time.Now().UTC()
+	if err := m.docker().ContainerStart(startCtx, resp.ID, container.StartOptions{}); err != nil {
 		m.logger.Error("Failed to start container", "sandboxID", sandboxID, "containerID", resp.ID, "error", err)
 		// Attempt to remove the created container on start failure
 		rmCtx, rmCancel := context.WithTimeout(context.Background(), 10*time.Second)
 		defer rmCancel()
-		if rmErr := m.dockerClient.ContainerRemove(rmCtx, resp.ID, container.RemoveOptions{Force: true}); rmErr != nil {
+		if rmErr := m.docker().ContainerRemove(rmCtx, resp.ID, container.RemoveOptions{Force: true}); rmErr != nil {
 			m.logger.Error("Failed to remove container after start failure", "containerID", resp.ID, "removeError", rmErr)
 		}
-		return "", fmt.Errorf("failed to start container %s: %w", resp.ID, err)
+		return "", backendError("container_start_failed", "failed to start container "+resp.ID, err)
 	}
-	
+
 	// 添加诊断日志，查看容器是否成功启动
 	m.logger.Info("Container started, checking status", "sandboxID", sandboxID, "containerID", resp.ID)
-	
+
 	// 立即检查容器状态，添加更多诊断信息
 	diagCtx, diagCancel := context.WithTimeout(ctx, 5*time.Second)
 	defer diagCancel()
-	inspectAfterStart, diagErr := m.dockerClient.ContainerInspect(diagCtx, resp.ID)
+	inspectAfterStart, diagErr := m.docker().ContainerInspect(diagCtx, resp.ID)
 	if diagErr != nil {
 		m.logger.Warn("Failed to inspect container after start for diagnostics", "error", diagErr)
 	} else {
-		m.logger.Info("Container status after start", 
+		m.logger.Info("Container status after start",
 			"state", inspectAfterStart.State.Status,
 			"running", inspectAfterStart.State.Running,
 			"exitCode", inspectAfterStart.State.ExitCode,
@@ -435,7 +1033,7 @@ func (m *SandboxManager) CreateSandbox(ctx context.Context, spaceID string, imag
 	var lastInspectErr error
 	for retry := 0; retry < maxRetries; retry++ {
 		inspectCtxRetry, inspectCancelRetry := context.WithTimeout(ctx, 10*time.Second)
-		inspectData, lastInspectErr = m.dockerClient.ContainerInspect(inspectCtxRetry, resp.ID)
+		inspectData, lastInspectErr = m.docker().ContainerInspect(inspectCtxRetry, resp.ID)
 		inspectCancelRetry()
 
 		if lastInspectErr != nil {
@@ -470,7 +1068,7 @@ func (m *SandboxManager) CreateSandbox(ctx context.Context, spaceID string, imag
 		m.logger.Warn("Could not find mapped port after retries, falling back to container IP method", "sandboxID", sandboxID)
 		for retry := 0; retry < maxRetries; retry++ {
 			inspectCtxIP, inspectCancelIP := context.WithTimeout(ctx, 10*time.Second)
-			inspectDataIP, inspectErrIP := m.dockerClient.ContainerInspect(inspectCtxIP, resp.ID)
+			inspectDataIP, inspectErrIP := m.docker().ContainerInspect(inspectCtxIP, resp.ID)
 			inspectCancelIP()
 
 			if inspectErrIP != nil {
@@ -517,7 +1115,7 @@ func (m *SandboxManager) CreateSandbox(ctx context.Context, spaceID string, imag
 		// Cleanup container
 		rmCtx, rmCancel := context.WithTimeout(context.Background(), 10*time.Second)
 		defer rmCancel()
-		_ = m.dockerClient.ContainerRemove(rmCtx, resp.ID, container.RemoveOptions{Force: true})
+		_ = m.docker().ContainerRemove(rmCtx, resp.ID, container.RemoveOptions{Force: true})
 		return "", fmt.Errorf("failed to determine agent URL for container %s after %d retries", resp.ID, maxRetries)
 	}
 
@@ -528,27 +1126,73 @@ func (m *SandboxManager) CreateSandbox(ctx context.Context, spaceID string, imag
 	agentReadyTimeout := 30 * time.Second // Adjust timeout as needed
 	m.logger.Info("Starting agent health check", "sandboxID", sandboxID, "healthURL", healthCheckURL, "timeout", agentReadyTimeout)
 
+	m.reportCreation(sandboxID, CreationWaitingForAgent, "", nil)
 	if err := m.waitForAgentReady(ctx, healthCheckURL, agentReadyTimeout); err != nil {
 		m.logger.Error("Agent health check failed", "sandboxID", sandboxID, "healthURL", healthCheckURL, "error", err)
 		// Cleanup container
 		rmCtx, rmCancel := context.WithTimeout(context.Background(), 10*time.Second)
 		defer rmCancel()
-		_ = m.dockerClient.ContainerRemove(rmCtx, resp.ID, container.RemoveOptions{Force: true})
-		return "", fmt.Errorf("agent health check failed: %w", err)
+		_ = m.docker().ContainerRemove(rmCtx, resp.ID, container.RemoveOptions{Force: true})
+		return "", backendError("agent_not_ready", "agent health check failed", err)
 	}
 	m.logger.Info("Agent health check successful", "sandboxID", sandboxID)
 
 	// 7. 创建沙箱状态并存储 (Renumbered from 6)
 	state := &SandboxState{
-		ID:          sandboxID,
-		ContainerID: resp.ID,
-		AgentURL:    agentURL,
-		IsRunning:   true,
-		SpaceID:     spaceID,
+		ID:              sandboxID,
+		Name:            spec.Name,
+		ContainerID:     resp.ID,
+		AgentURL:        agentURL,
+		Phase:           PhaseCreating,
+		SpaceID:         spaceID,
+		Image:           imageName,
+		Env:             spec.Env,
+		Secrets:         spec.Secrets,
+		SecurityProfile: securityProfile.Name,
+		SeccompProfile:  seccompProfile,
+		AppArmorProfile: appArmorProfile,
+		Tmpfs:           spec.Tmpfs,
+		DiskLimit:       spec.DiskLimit,
+		Ulimits:         spec.Ulimits,
+		Health:          HealthHealthy,
+		startedAt:       startedAt,
+		ClonedFrom:      spec.ClonedFrom,
+		Workdir:         spec.Workdir,
+		User:            spec.User,
+		Command:         spec.Command,
+		Entrypoint:      spec.Entrypoint,
+		DNS:             spec.DNS,
+		DNSSearch:       spec.DNSSearch,
+		ExtraHosts:      spec.ExtraHosts,
+		Network:         networkName,
+		Hostname:        hostname,
+		Platform:        imagePlatform,
+		IPv6:            spec.IPv6,
+		Sidecars:        sidecars,
+		Volumes:         spec.Volumes,
+		SpaceVolumes:    space.Volumes,
+		PrivateNetworks: spec.PrivateNetworks,
+		Protected:       spec.Protected,
+		Labels:          spec.Labels,
+		ActionQueue:     spec.ActionQueue,
+		Jupyter:         spec.Jupyter,
+		setup:           spec.Setup,
+		setupHash:       setupHashOf(spec.Setup),
 	}
+	m.attachContext(state)
+	initialPhase := PhaseReady
+	if len(spec.Setup) > 0 {
+		state.SetupStatus = SetupRunning
+		initialPhase = PhaseStarting
+	}
+
+	m.mu.Lock()
+	change, changed := m.transition(state, initialPhase, "created")
 
-	// Add sandbox to manager's map
+	// Add sandbox to manager's map, which takes over from the reservation
 	m.sandboxes[sandboxID] = state
+	delete(m.reservations, sandboxID)
+	registered = true
 
 	// Add sandbox reference to the space using SpaceManager
 	if err := m.spaceManager.addSandboxToSpace(spaceID, sandboxID, state); err != nil {
@@ -556,11 +1200,60 @@ func (m *SandboxManager) CreateSandbox(ctx context.Context, spaceID string, imag
 		m.logger.Error("Failed to add sandbox reference to space after creating container", "spaceID", spaceID, "sandboxID", sandboxID, "error", err)
 		// Consider cleanup? For now, log and continue, sandbox exists but space link failed.
 	}
+	m.mu.Unlock()
 
 	m.logger.Info("Sandbox created and registered successfully", "sandboxID", sandboxID, "containerID", resp.ID, "agentURL", agentURL, "spaceID", spaceID)
+	m.announcePhase(sandboxID, change, changed)
 	return sandboxID, nil
 }
 
+// ensureImage pulls imageName unless it already exists locally. Unless nil, onPull is called
+// with 0 when a pull starts and with the percentage downloaded as it progresses.
+func (m *SandboxManager) ensureImage(ctx context.Context, imageName, platform string, onPull func(percent int)) error {
+	// Use a shorter timeout for image pull check/pull
+	pullCtx, pullCancel := context.WithTimeout(ctx, 5*time.Minute)
+	defer pullCancel()
+
+	// First check if image exists locally
+	inspectCtx, inspectCancel := context.WithTimeout(ctx, 10*time.Second)
+	defer inspectCancel()
+	local, _, errInspect := m.docker().ImageInspectWithRaw(inspectCtx, imageName)
+	if errInspect == nil && imageMatchesPlatform(local, platform) {
+		// Image exists locally, no need to pull
+		m.logger.Info("Image exists locally, skipping pull", "image", imageName)
+	} else {
+		// Try to pull the image only if it doesn't exist locally, or only for another platform
+		m.logger.Info("Image not found locally for platform, attempting to pull", "image", imageName, "platform", platform)
+		out, err := m.docker().ImagePull(pullCtx, imageName, image.PullOptions{Platform: platform})
+		if err != nil {
+			m.logger.Error("Failed to pull image", "image", imageName, "error", err)
+			return backendError("image_pull_failed", "failed to pull image "+imageName, err)
+		}
+		// IMPORTANT: Block and drain the output to ensure the pull completes before proceeding.
+		defer out.Close()
+		if onPull != nil {
+			onPull(0)
+		}
+		if err = drainPull(out, onPull); err != nil {
+			m.logger.Error("Image pull failed", "image", imageName, "error", err)
+			return backendError("image_pull_failed", "failed to pull image "+imageName, err)
+		}
+		m.logger.Info("Image pull completed", "image", imageName)
+	}
+
+	// Add an explicit check after pulling to ensure the image exists locally
+	// Use a new context for this inspection to avoid using the already potentially cancelled inspectCtx
+	inspectCtx2, inspectCancel2 := context.WithTimeout(ctx, 10*time.Second)
+	defer inspectCancel2()
+	_, _, errInspect2 := m.docker().ImageInspectWithRaw(inspectCtx2, imageName)
+	if errInspect2 != nil {
+		m.logger.Error("Image inspect failed after pull", "image", imageName, "error", errInspect2)
+		return fmt.Errorf("image %s not found locally after pull attempt: %w", imageName, errInspect2)
+	}
+	m.logger.Info("Image confirmed to exist locally", "image", imageName)
+	return nil
+}
+
 // Add the waitForAgentReady helper function (if not already present)
 func (m *SandboxManager) waitForAgentReady(ctx context.Context, healthURL string, timeout time.Duration) error {
 	ctx, cancel := context.WithTimeout(ctx, timeout)
@@ -604,8 +1297,61 @@ func (m *SandboxManager) waitForAgentReady(ctx context.Context, healthURL string
 	}
 }
 
-// DeleteSandbox stops and removes a sandbox container.
-func (m *SandboxManager) DeleteSandbox(ctx context.Context, sandboxID string) error {
+// callAgent sends a JSON request to an agent endpoint and fails on any non-2xx status.
+// If out is non-nil, the response body is decoded into it.
+func (m *SandboxManager) callAgent(ctx context.Context, sandboxID, method, agentURL string, body interface{}, out interface{}) error {
+	var reader io.Reader
+	if body != nil {
+		payload, err := json.Marshal(body)
+		if err != nil {
+			return fmt.Errorf("failed to marshal agent request: %w", err)
+		}
+		reader = bytes.NewReader(payload)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, agentURL, reader)
+	if err != nil {
+		return fmt.Errorf("failed to create agent request: %w", err)
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := m.doAgent(m.httpClient, sandboxID, req)
+	if err != nil {
+		if errors.Is(err, ErrAgentCircuitOpen) {
+			return err
+		}
+		return backendError("agent_unreachable", "agent request failed", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		bodyBytes, _ := io.ReadAll(resp.Body)
+		return &Error{Kind: KindBackend, Code: "agent_error", Message: "agent request failed", Err: &agentStatusError{StatusCode: resp.StatusCode, Body: string(bodyBytes)}}
+	}
+	if out != nil {
+		if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+			return fmt.Errorf("failed to decode agent response: %w", err)
+		}
+	}
+	return nil
+}
+
+// agentStatusError is a non-2xx response of the agent, for callers that map some statuses.
+type agentStatusError struct {
+	StatusCode int
+	Body       string
+}
+
+func (e *agentStatusError) Error() string {
+	return fmt.Sprintf("agent returned status %d: %s", e.StatusCode, e.Body)
+}
+
+// DeleteSandbox stops and removes a sandbox container. Unless force is set, protected
+// sandboxes and sandboxes with running actions are refused. A container that no longer
+// exists counts as removed.
+func (m *SandboxManager) DeleteSandbox(ctx context.Context, sandboxID string, force bool) error {
 	m.logger.Info("Attempting to delete sandbox", "sandboxID", sandboxID)
 
 	m.mu.Lock() // Lock for modifying sandboxes map
@@ -615,8 +1361,23 @@ func (m *SandboxManager) DeleteSandbox(ctx context.Context, sandboxID string) er
 		m.logger.Warn("Sandbox not found in manager state during deletion attempt", "sandboxID", sandboxID)
 		return ErrSandboxNotFound
 	}
+	if !force {
+		if err := m.checkDeletableLocked(state); err != nil {
+			m.mu.Unlock()
+			return err
+		}
+	}
 	spaceID := state.SpaceID // Get spaceID before deleting state
-	m.mu.Unlock() // Unlock early, Docker operations can be slow
+	agentRunning := state.IsRunning
+	change, changed := m.transition(state, PhaseStopping, "delete_requested") // The coming "die" event is expected
+	m.mu.Unlock()                                                             // Unlock early, Docker operations can be slow
+	m.announcePhase(sandboxID, change, changed)
+
+	// Let the agent stop running commands and flush their output first
+	if agentRunning {
+		m.requestAgentShutdown(ctx, sandboxID, state.AgentURL)
+	}
+	state.cancelRequests() // Action requests the agent did not answer would wait on a dead agent
 
 	// Attempt to stop the container
 	stopTimeoutDuration := 5 * time.Second
@@ -624,7 +1385,7 @@ func (m *SandboxManager) DeleteSandbox(ctx context.Context, sandboxID string) er
 	m.logger.Info("Stopping container", "containerID", state.ContainerID, "sandboxID", sandboxID, "timeout", stopTimeoutDuration)
 	stopCtx, stopCancel := context.WithTimeout(ctx, stopTimeoutDuration+2*time.Second) // Give slightly more time
 	defer stopCancel()
-	err := m.dockerClient.ContainerStop(stopCtx, state.ContainerID, container.StopOptions{Timeout: &stopTimeoutSeconds})
+	err := m.docker().ContainerStop(stopCtx, state.ContainerID, container.StopOptions{Timeout: &stopTimeoutSeconds})
 	if err != nil {
 		m.logger.Error("Failed to stop container, proceeding with removal attempt", "containerID", state.ContainerID, "sandboxID", sandboxID, "error", err)
 	} else {
@@ -635,9 +1396,14 @@ func (m *SandboxManager) DeleteSandbox(ctx context.Context, sandboxID string) er
 	m.logger.Info("Removing container", "containerID", state.ContainerID, "sandboxID", sandboxID)
 	rmCtx, rmCancel := context.WithTimeout(ctx, 15*time.Second)
 	defer rmCancel()
-	err = m.dockerClient.ContainerRemove(rmCtx, state.ContainerID, container.RemoveOptions{
+	err = m.docker().ContainerRemove(rmCtx, state.ContainerID, container.RemoveOptions{
 		Force: true,
 	})
+	if client.IsErrNotFound(err) {
+		// Already removed, by a concurrent delete or behind our back; retried deletes succeed
+		m.logger.Info("Container already removed", "containerID", state.ContainerID, "sandboxID", sandboxID)
+		err = nil
+	}
 	if err != nil {
 		m.logger.Error("Failed to remove container", "containerID", state.ContainerID, "sandboxID", sandboxID, "error", err)
 		// Don't return yet, still need to clean up maps
@@ -645,16 +1411,20 @@ func (m *SandboxManager) DeleteSandbox(ctx context.Context, sandboxID string) er
 		m.logger.Info("Container removed successfully", "containerID", state.ContainerID, "sandboxID", sandboxID)
 	}
 
-	// Remove from manager's sandbox map
+	m.removeSidecars(sandboxID)
+
+	// Clone images belong to the clone alone
+	if err == nil && state.ClonedFrom != "" {
+		m.removeCloneImage(state.Image)
+	}
+
 	m.mu.Lock()
-	delete(m.sandboxes, sandboxID)
+	change, changed = m.transition(state, PhaseDeleted, "")
 	m.mu.Unlock()
+	m.announcePhase(sandboxID, change, changed)
 
-	// Remove sandbox reference from the space using SpaceManager
-	if errSpace := m.spaceManager.removeSandboxFromSpace(spaceID, sandboxID); errSpace != nil {
-		// Log error but don't make the overall deletion fail because of this
-		m.logger.Error("Failed to remove sandbox reference from space", "spaceID", spaceID, "sandboxID", sandboxID, "error", errSpace)
-	}
+	// Remove from manager's sandbox map and its space
+	m.forgetSandbox(sandboxID, spaceID)
 
 	m.logger.Info("Sandbox deleted successfully from manager state", "sandboxID", sandboxID)
 
@@ -665,6 +1435,52 @@ func (m *SandboxManager) DeleteSandbox(ctx context.Context, sandboxID string) er
 	return nil
 }
 
+// forgetSandbox drops all manager state of a sandbox and its space reference.
+func (m *SandboxManager) forgetSandbox(sandboxID, spaceID string) {
+	defer m.closeSubscriptions(sandboxID)
+	m.mu.Lock()
+	running := false
+	if state, exists := m.sandboxes[sandboxID]; exists {
+		state.cancelRequests()
+		running = containerUp(state.Phase)
+	}
+	delete(m.sandboxes, sandboxID)
+	delete(m.watches, sandboxID)
+	delete(m.kernels, sandboxID)
+	delete(m.stats, sandboxID)
+	delete(m.healthFailures, sandboxID)
+	delete(m.schedules, sandboxID)
+	delete(m.workflows, sandboxID)
+	delete(m.recordings, sandboxID)
+	delete(m.replays, sandboxID)
+	delete(m.actionQueues, sandboxID)
+	m.breakers.reset(sandboxID)
+	for actionID, owner := range m.activeActions {
+		if owner == sandboxID {
+			delete(m.activeActions, actionID)
+		}
+	}
+	m.mu.Unlock()
+	m.endUsage(sandboxID, running)
+	m.dropSandboxOutputs(sandboxID)
+	if m.logs != nil {
+		m.logs.Close(sandboxID)
+	}
+
+	if m.history != nil {
+		if err := m.history.Delete(sandboxID); err != nil {
+			m.logger.Error("Failed to delete observation history", "sandboxID", sandboxID, "error", err)
+		}
+	}
+	m.forgetStream(sandboxID)
+
+	// Remove sandbox reference from the space using SpaceManager
+	if errSpace := m.spaceManager.removeSandboxFromSpace(spaceID, sandboxID); errSpace != nil {
+		// Log error but don't make the overall deletion fail because of this
+		m.logger.Error("Failed to remove sandbox reference from space", "spaceID", spaceID, "sandboxID", sandboxID, "error", errSpace)
+	}
+}
+
 // GetSandbox retrieves the state of a specific sandbox by its ID.
 func (m *SandboxManager) GetSandbox(ctx context.Context, sandboxID string) (*SandboxState, error) {
 	m.mu.RLock()
@@ -680,7 +1496,7 @@ func (m *SandboxManager) GetSandbox(ctx context.Context, sandboxID string) (*San
 	// Optionally, inspect the container to get the latest status from Docker
 	// This adds overhead but provides the most up-to-date info.
 	// For now, we return the cached state.
-	// _, err := m.dockerClient.ContainerInspect(ctx, state.ContainerID)
+	// _, err := m.docker().ContainerInspect(ctx, state.ContainerID)
 	// if err != nil {
 	// 	 if client.IsErrNotFound(err) {
 	// 		 // Container doesn't exist in Docker anymore, update our state?
@@ -709,18 +1525,12 @@ func (m *SandboxManager) ReceiveInternalObservation(sandboxID string, observatio
 		m.logger.Warn("Received internal observation for non-existent or deleted sandbox", "sandboxID", sandboxID)
 		return nil // Don't return error to agent, just ignore
 	}
+	// Masked before anything records it: the spool, the history, logs and clients all see the masked bytes
+	observationBytes = m.redactor.Bytes(observationBytes)
 
-	// Parse the observation to understand its type and potentially trigger actions (like sending 'end')
-	// MODIFIED: Added ExitCode and Error fields (pointers) to capture top-level result/error data
-	var obs struct {
-		ObservationType string          `json:"observation_type"`
-		ActionID        string          `json:"action_id"`
-		Timestamp       time.Time       `json:"timestamp"`
-		Data            json.RawMessage `json:"data"` // Keep data raw initially for flexibility
-		ExitCode        *int            `json:"exit_code,omitempty"` // Added for result/error
-		Error           *string         `json:"error,omitempty"`     // Added for result/error
-	}
-
+	// Parse the observation once to understand its type and potentially trigger actions (like sending 'end');
+	// the bytes are forwarded as they are unless output limits rewrite them
+	var obs internalObservation
 	if err := json.Unmarshal(observationBytes, &obs); err != nil {
 		m.logger.Error("Failed to parse internal observation JSON", "sandboxID", sandboxID, "rawData", string(observationBytes), "error", err)
 		// Decide if we should still broadcast the unparseable message? Maybe as an error type?
@@ -728,25 +1538,47 @@ func (m *SandboxManager) ReceiveInternalObservation(sandboxID string, observatio
 		// Let's broadcast the raw bytes if parsing fails, so client at least gets something.
 		if m.hub != nil {
 			m.logger.Warn("Broadcasting unparseable raw observation data", "sandboxID", sandboxID)
-			m.hub.SubmitBroadcast(sandboxID, observationBytes)
+			m.broadcast(sandboxID, observationBytes)
 		}
 		return fmt.Errorf("failed to parse observation JSON: %w", err)
 	}
 
-	m.logger.Debug("Parsed internal observation struct",
-		"sandboxID", sandboxID,
-		"parsedActionID", obs.ActionID,
-		"parsedObservationType", obs.ObservationType,
-		"parsedTimestamp", obs.Timestamp,
-		"rawData", string(observationBytes)) // Log raw data along with parsed info
+	// Only build the raw data string when it will be logged: this runs for every output line
+	if m.logger.Enabled(context.Background(), slog.LevelDebug) {
+		m.logger.Debug("Parsed internal observation struct",
+			"sandboxID", sandboxID,
+			"parsedActionID", obs.ActionID,
+			"parsedObservationType", obs.ObservationType,
+			"parsedTimestamp", obs.Timestamp,
+			"rawData", string(observationBytes)) // Log raw data along with parsed info
+	}
 
-	// Broadcast the parsed (original) bytes AFTER successful parsing
-	if m.hub != nil {
-		m.logger.Debug("Broadcasting successfully parsed observation data", "sandboxID", sandboxID, "type", obs.ObservationType)
-		m.hub.SubmitBroadcast(sandboxID, observationBytes)
+	// Drop invalid and too frequent progress reports
+	if obs.ObservationType == "progress" {
+		if observationBytes = m.checkProgress(sandboxID, &obs, observationBytes); observationBytes == nil {
+			return nil
+		}
 	}
 
-	m.logger.Debug("Received internal observation", "sandboxID", sandboxID, "actionID", obs.ActionID, "type", obs.ObservationType)
+	// Cap stream output so a huge command output cannot flood the hub and its clients
+	limitReached := false
+	if obs.ObservationType == "stream" {
+		observationBytes, limitReached = m.limitStreamOutput(sandboxID, &obs, observationBytes)
+		if observationBytes != nil {
+			observationBytes = m.sequenceStream(&obs, observationBytes)
+		}
+	}
+	if obs.ActionID != "" && (observationBytes == nil || (obs.ObservationType != "stream" && obs.ObservationType != "result" && obs.ObservationType != "progress")) {
+		m.skipResultCache(obs.ActionID) // The cache only replays stream lines
+	}
+
+	// Broadcast the parsed (original) bytes AFTER successful parsing, or batch stream lines of coalescing actions
+	if m.hub != nil && observationBytes != nil && !(obs.ObservationType == "stream" && m.coalesceLine(sandboxID, &obs)) {
+		m.broadcastObservation(sandboxID, history.Meta{ObservationType: obs.ObservationType, ActionID: obs.ActionID, Timestamp: obs.Timestamp}, observationBytes)
+	}
+	if limitReached {
+		m.pushTruncatedObservation(sandboxID, obs.ActionID)
+	}
 
 	// Process specific observation types (e.g., 'result' triggers 'end')
 	// MODIFIED: Pass the whole parsed obs struct to processParsedObservation
@@ -758,16 +1590,29 @@ func (m *SandboxManager) ReceiveInternalObservation(sandboxID string, observatio
 	return nil
 }
 
-// processParsedObservation handles logic based on the observation type.
-// MODIFIED: Takes the parsed observation struct pointer as input
-func (m *SandboxManager) processParsedObservation(sandboxID string, obs *struct {
+// internalObservation is an observation pushed by an agent, as far as the manager reads it.
+type internalObservation struct {
 	ObservationType string          `json:"observation_type"`
 	ActionID        string          `json:"action_id"`
 	Timestamp       time.Time       `json:"timestamp"`
-	Data            json.RawMessage `json:"data"`
-	ExitCode        *int            `json:"exit_code,omitempty"`
+	Data            json.RawMessage `json:"data"`                // Keep data raw initially for flexibility
+	ExitCode        *int            `json:"exit_code,omitempty"` // Top-level in "result" and "error"
 	Error           *string         `json:"error,omitempty"`
-}) error {
+	Stream          string          `json:"stream,omitempty"` // Top-level in "stream"
+	Line            *string         `json:"line,omitempty"`
+	Encoding        string          `json:"encoding,omitempty"`
+	Truncated       bool            `json:"truncated,omitempty"`  // Set by limitStreamOutput when it cuts Line
+	StreamSeq       uint64          `json:"stream_seq,omitempty"` // Set by sequenceStream
+	Signal          string          `json:"signal,omitempty"`     // Top-level in "result"
+	OOMKilled       bool            `json:"oom_killed,omitempty"`
+	Usage           *ResourceUsage  `json:"usage,omitempty"`
+	Percent         *float64        `json:"percent,omitempty"` // Top-level in "progress"
+	Message         string          `json:"message,omitempty"`
+	EtaSeconds      *float64        `json:"eta_seconds,omitempty"`
+}
+
+// processParsedObservation handles logic based on the observation type.
+func (m *SandboxManager) processParsedObservation(sandboxID string, obs *internalObservation) error {
 	switch obs.ObservationType {
 	case "result":
 		m.logger.Info("Received 'result' observation, sending 'end'", "sandboxID", sandboxID, "actionID", obs.ActionID)
@@ -779,7 +1624,7 @@ func (m *SandboxManager) processParsedObservation(sandboxID string, obs *struct
 		} else {
 			m.logger.Warn("Received 'result' observation without an exit_code, defaulting to 0", "sandboxID", sandboxID, "actionID", obs.ActionID)
 		}
-		m.sendEndObservation(sandboxID, obs.ActionID, exitCode)
+		m.sendEndObservation(sandboxID, obs.ActionID, EndObservationData{ExitCode: exitCode, Signal: obs.Signal, OOMKilled: obs.OOMKilled, Usage: obs.Usage})
 
 	case "error":
 		// Log agent-side errors
@@ -797,40 +1642,26 @@ func (m *SandboxManager) processParsedObservation(sandboxID string, obs *struct
 		if obs.ExitCode != nil {
 			exitCode = *obs.ExitCode
 		}
-		m.sendEndObservation(sandboxID, obs.ActionID, exitCode)
+		m.sendEndObservation(sandboxID, obs.ActionID, EndObservationData{ExitCode: exitCode})
 
-	// Add cases for other types if needed (e.g., 'start', 'stream')
-	// Currently, 'start' is sent by InitiateAction, and 'stream' is just broadcast.
+		// Add cases for other types if needed (e.g., 'start', 'stream')
+		// Currently, 'start' is sent by InitiateAction, and 'stream' is just broadcast.
 	}
 	return nil
 }
 
 // sendEndObservation constructs and broadcasts an 'end' observation.
-func (m *SandboxManager) sendEndObservation(sandboxID, actionID string, exitCode int) {
+func (m *SandboxManager) sendEndObservation(sandboxID, actionID string, data EndObservationData) {
+	adv := m.actionEnded(actionID, data.ExitCode)
+	defer m.startNext(adv) // After the "end", so the next queued action starts after it
+	defer m.setActionMetadata(actionID, nil)
+	m.endStreams(actionID, &data)
 	if m.hub == nil {
 		return
 	}
 
-	endData := map[string]interface{}{
-		"exit_code": exitCode,
-	}
-
-	// Construct the end observation message
-	endMsg := map[string]interface{}{
-		"observation_type": "end",
-		"action_id":        actionID,
-		"timestamp":        time.Now().UTC().Format(time.RFC3339Nano),
-		"data":             endData,
-	}
-
-	endBytes, err := json.Marshal(endMsg)
-	if err != nil {
-		m.logger.Error("Failed to marshal 'end' observation", "sandboxID", sandboxID, "actionID", actionID, "error", err)
-		return
-	}
-
-	m.logger.Debug("Pushing observation via Hub", "sandboxID", sandboxID, "actionID", actionID, "type", "end", "size", len(endBytes))
-	m.hub.SubmitBroadcast(sandboxID, endBytes)
+	m.pushObservation(sandboxID, actionID, "end", data)
+	m.announceActionEnd(sandboxID, actionID, data)
 }
 
 // CreateSpace delegates to SpaceManager.
@@ -853,8 +1684,28 @@ func (m *SandboxManager) UpdateSpace(ctx context.Context, spaceID string, descri
 	return m.spaceManager.UpdateSpace(ctx, spaceID, description, metadata)
 }
 
-// DeleteSpace deletes a space and all its sandboxes.
-func (m *SandboxManager) DeleteSpace(ctx context.Context, spaceID string) error {
+// DeleteSpace deletes a space and all its sandboxes. Unless force is set, nothing is deleted
+// if the space or any of its sandboxes is protected, or a sandbox has running actions.
+func (m *SandboxManager) DeleteSpace(ctx context.Context, spaceID string, force bool) error {
+	space, err := m.spaceManager.GetSpace(ctx, spaceID)
+	if err != nil {
+		return err // Not found, or owned by another tenant
+	}
+	if !force {
+		if space.Protected {
+			return fmt.Errorf("%w: %q", ErrSpaceProtected, spaceID)
+		}
+		m.mu.RLock()
+		for id := range space.Sandboxes {
+			if state, exists := m.sandboxes[id]; exists {
+				if err := m.checkDeletableLocked(state); err != nil {
+					m.mu.RUnlock()
+					return err
+				}
+			}
+		}
+		m.mu.RUnlock()
+	}
 	// Get list of sandbox IDs in the space first
 	sandboxIDs, err := m.spaceManager.getSpaceSandboxes(spaceID)
 	if err != nil {
@@ -868,7 +1719,7 @@ func (m *SandboxManager) DeleteSpace(ctx context.Context, spaceID string) error
 	// Delete all sandboxes associated with the space
 	var firstErr error
 	for _, sandboxID := range sandboxIDs {
-		if delErr := m.DeleteSandbox(ctx, sandboxID); delErr != nil {
+		if delErr := m.DeleteSandbox(ctx, sandboxID, true); delErr != nil {
 			// Log error and store the first one encountered
 			m.logger.Error("Failed to delete sandbox while deleting space", "spaceID", spaceID, "sandboxID", sandboxID, "error", delErr)
 			if firstErr == nil && !errors.Is(delErr, ErrSandboxNotFound) { // Ignore not found errors during cleanup
@@ -878,11 +1729,13 @@ func (m *SandboxManager) DeleteSpace(ctx context.Context, spaceID string) error
 	}
 
 	// After attempting to delete all sandboxes, delete the space entry itself
-	if spaceDelErr := m.spaceManager.DeleteSpace(ctx, spaceID); spaceDelErr != nil {
+	if spaceDelErr := m.spaceManager.DeleteSpace(ctx, spaceID, true); spaceDelErr != nil {
 		m.logger.Error("Failed to delete space entry after deleting sandboxes", "spaceID", spaceID, "error", spaceDelErr)
 		if firstErr == nil { // Prioritize sandbox deletion errors
 			firstErr = spaceDelErr
 		}
+	} else {
+		m.removeSpaceNetwork(spaceID)
 	}
 
 	if firstErr != nil {
@@ -892,4 +1745,15 @@ func (m *SandboxManager) DeleteSpace(ctx context.Context, spaceID string) error
 
 	m.logger.Info("Space and associated sandboxes deleted successfully", "spaceID", spaceID)
 	return nil
-}
\ No newline at end of file
+}
+
+// PingDocker checks that the Docker daemon is reachable.
+func (m *SandboxManager) PingDocker(ctx context.Context) error {
+	if m.dockerReconnecting() {
+		return fmt.Errorf("docker daemon unreachable: reconnecting")
+	}
+	if _, err := m.currentDocker().Ping(ctx); err != nil {
+		return fmt.Errorf("docker daemon unreachable: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,65 @@
+package manager
+
+import (
+	"bytes"
+	"encoding/json"
+	"strconv"
+)
+
+// actionMetadataOf returns the "metadata" object of an action payload, marshaled, or nil if
+// the payload has none. Clients attach it to correlate the action's observations with their
+// own traces, such as an agent step or conversation ID.
+func actionMetadataOf(payload map[string]interface{}) json.RawMessage {
+	metadata, ok := payload["metadata"].(map[string]interface{})
+	if !ok || len(metadata) == 0 {
+		return nil
+	}
+	raw, err := json.Marshal(metadata)
+	if err != nil {
+		return nil
+	}
+	return raw
+}
+
+// setActionMetadata records the metadata of an action, or forgets it if metadata is nil.
+func (m *SandboxManager) setActionMetadata(actionID string, metadata json.RawMessage) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if metadata == nil {
+		delete(m.actionMetadata, actionID)
+		return
+	}
+	m.actionMetadata[actionID] = metadata
+}
+
+// metadataOf returns the metadata of an action, or nil.
+func (m *SandboxManager) metadataOf(actionID string) json.RawMessage {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.actionMetadata[actionID]
+}
+
+// withMetadata adds a "metadata" field to a JSON object message. Other messages are returned
+// as is.
+func withMetadata(message []byte, metadata json.RawMessage) []byte {
+	return withField(message, "metadata", metadata)
+}
+
+// withField adds a field with a JSON value to a JSON object message, before its other
+// fields. Other messages are returned as is.
+func withField(message []byte, name string, value json.RawMessage) []byte {
+	body := bytes.TrimLeft(message, " \t\r\n")
+	if len(body) == 0 || body[0] != '{' {
+		return message
+	}
+	rest := bytes.TrimLeft(body[1:], " \t\r\n")
+	out := make([]byte, 0, len(body)+len(name)+len(value)+4)
+	out = append(out, '{')
+	out = strconv.AppendQuote(out, name)
+	out = append(out, ':')
+	out = append(out, value...)
+	if len(rest) > 0 && rest[0] != '}' {
+		out = append(out, ',')
+	}
+	return append(out, rest...)
+}
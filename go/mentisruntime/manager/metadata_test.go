@@ -0,0 +1,32 @@
+package manager
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestActionMetadataOf(t *testing.T) {
+	require.Nil(t, actionMetadataOf(map[string]interface{}{"command": "ls"}))
+	require.Nil(t, actionMetadataOf(map[string]interface{}{"metadata": map[string]interface{}{}}))
+	require.Nil(t, actionMetadataOf(map[string]interface{}{"metadata": "step-1"}))
+	metadata := actionMetadataOf(map[string]interface{}{"metadata": map[string]interface{}{"step_id": "s1", "turn": 3.0}})
+	require.JSONEq(t, `{"step_id":"s1","turn":3}`, string(metadata))
+}
+
+func TestWithMetadata(t *testing.T) {
+	metadata := json.RawMessage(`{"step_id":"s1"}`)
+	require.JSONEq(t, `{"metadata":{"step_id":"s1"},"observation_type":"end","data":{"exit_code":0}}`,
+		string(withMetadata([]byte(`{"observation_type":"end","data":{"exit_code":0}}`), metadata)))
+	require.JSONEq(t, `{"metadata":{"step_id":"s1"}}`, string(withMetadata([]byte(` { }`), metadata)))
+	require.Equal(t, "[1]", string(withMetadata([]byte("[1]"), metadata)))
+}
+
+func TestSetActionMetadata(t *testing.T) {
+	m := &SandboxManager{actionMetadata: map[string]json.RawMessage{}}
+	m.setActionMetadata("a1", json.RawMessage(`{"conversation_id":"c1"}`))
+	require.JSONEq(t, `{"conversation_id":"c1"}`, string(m.metadataOf("a1")))
+	m.setActionMetadata("a1", nil)
+	require.Nil(t, m.metadataOf("a1"))
+}
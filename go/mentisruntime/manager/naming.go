@@ -0,0 +1,85 @@
+package manager
+
+import "fmt"
+
+// ErrSandboxNameTaken is returned when a sandbox is created with the name or ID of another
+// sandbox of its space.
+var ErrSandboxNameTaken = newError(KindConflict, "sandbox_name_taken", "sandbox name is already used in the space")
+
+// sandboxReservation is the name and hostname of a sandbox being created, which other
+// sandboxes cannot take until it is registered or its creation fails.
+type sandboxReservation struct {
+	spaceID  string
+	name     string
+	hostname string
+}
+
+// reserveSandbox checks the name and hostname of a sandbox about to be created and reserves
+// them. releaseSandbox frees them again.
+func (m *SandboxManager) reserveSandbox(space *SpaceState, sandboxID string, spec SandboxSpec) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if spec.Name != "" {
+		if err := m.checkSandboxName(space.ID, spec.Name); err != nil {
+			return err
+		}
+	}
+	if spec.Hostname != "" {
+		if err := m.checkSpaceHostname(space, spec.Hostname); err != nil {
+			return err
+		}
+	}
+	if m.reservations == nil {
+		m.reservations = make(map[string]sandboxReservation)
+	}
+	m.reservations[sandboxID] = sandboxReservation{spaceID: space.ID, name: spec.Name, hostname: spec.Hostname}
+	return nil
+}
+
+// releaseSandbox drops the reservation of a sandbox, if it still has one.
+func (m *SandboxManager) releaseSandbox(sandboxID string) {
+	m.mu.Lock()
+	delete(m.reservations, sandboxID)
+	m.mu.Unlock()
+}
+
+// checkSandboxName checks that a sandbox can be created with a name in a space. Callers
+// must hold m.mu.
+func (m *SandboxManager) checkSandboxName(spaceID, name string) error {
+	for id, state := range m.sandboxes {
+		if state.SpaceID == spaceID && (state.Name == name || id == name) {
+			return fmt.Errorf("%w: %q", ErrSandboxNameTaken, name)
+		}
+	}
+	for id, r := range m.reservations {
+		if r.spaceID == spaceID && (r.name == name || id == name) {
+			return fmt.Errorf("%w: %q", ErrSandboxNameTaken, name)
+		}
+	}
+	return nil
+}
+
+// ResolveSandboxID returns the ID of the sandbox of a space named ref. IDs win over names,
+// so ref is returned as is if it is a sandbox ID, or if no sandbox of the space has that name.
+func (m *SandboxManager) ResolveSandboxID(spaceID, ref string) string {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	if _, exists := m.sandboxes[ref]; exists {
+		return ref
+	}
+	for id, state := range m.sandboxes {
+		if state.SpaceID == spaceID && state.Name == ref {
+			return id
+		}
+	}
+	return ref
+}
+
+// containerName returns the Docker container name of a sandbox, which includes its name,
+// if it has one, so "docker ps" is readable.
+func (m *SandboxManager) containerName(sandboxID, name string) string {
+	if name == "" {
+		return fmt.Sprintf("sandboxai-%s-%s", m.scope, sandboxID)
+	}
+	return fmt.Sprintf("sandboxai-%s-%s-%s", m.scope, name, sandboxID)
+}
@@ -0,0 +1,22 @@
+package manager
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestReserveSandbox_holdsNameUntilReleased(t *testing.T) {
+	m := &SandboxManager{sandboxes: map[string]*SandboxState{}, spaceNetworks: true}
+	space := &SpaceState{ID: "sp"}
+
+	require.NoError(t, m.reserveSandbox(space, "sb-1", SandboxSpec{Name: "web", Hostname: "web"}))
+	// A creation in progress holds its name and hostname without m.mu
+	require.ErrorIs(t, m.reserveSandbox(space, "sb-2", SandboxSpec{Name: "web"}), ErrSandboxNameTaken)
+	require.ErrorIs(t, m.reserveSandbox(space, "sb-2", SandboxSpec{Hostname: "web"}), ErrHostnameTaken)
+	require.ErrorIs(t, m.reserveSandbox(space, "sb-2", SandboxSpec{Name: "sb-1"}), ErrSandboxNameTaken)
+	require.NoError(t, m.reserveSandbox(&SpaceState{ID: "other"}, "sb-3", SandboxSpec{Name: "web"}))
+
+	m.releaseSandbox("sb-1")
+	require.NoError(t, m.reserveSandbox(space, "sb-2", SandboxSpec{Name: "web", Hostname: "web"}))
+}
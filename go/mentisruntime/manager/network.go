@@ -0,0 +1,60 @@
+package manager
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/network"
+	"github.com/docker/docker/client"
+)
+
+var (
+	ErrNetworkNotFound = newError(KindInvalid, "network_not_found", "network not found")
+	ErrNetworkNoIPv6   = newError(KindInvalid, "network_ipv6_disabled", "network does not have IPv6 enabled")
+)
+
+// DefaultNetwork is the Docker network sandboxes join when the spec names none.
+const DefaultNetwork = "bridge"
+
+// resolveNetwork checks that the network named by spec exists and, if IPv6 is requested,
+// has IPv6 enabled. It returns the network's name.
+func (m *SandboxManager) resolveNetwork(ctx context.Context, spec SandboxSpec) (string, error) {
+	name := spec.Network
+	if name == "" {
+		name = m.platform.defaultNetwork()
+	}
+	if name == m.platform.defaultNetwork() && !spec.IPv6 {
+		return name, nil
+	}
+	inspectCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	nw, err := m.docker().NetworkInspect(inspectCtx, name, network.InspectOptions{})
+	if err != nil {
+		if client.IsErrNotFound(err) {
+			return "", fmt.Errorf("%w: %q", ErrNetworkNotFound, name)
+		}
+		return "", backendError("network_inspect_failed", "failed to inspect network "+name, err)
+	}
+	if spec.IPv6 && !nw.EnableIPv6 {
+		return "", fmt.Errorf("%w: %q", ErrNetworkNoIPv6, name)
+	}
+	return nw.Name, nil
+}
+
+// applyNetworkConfig attaches the container to networkName and maps the IPv6, resolver and
+// /etc/hosts settings of a spec onto the host config.
+func applyNetworkConfig(spec SandboxSpec, networkName string, hostCfg *container.HostConfig) {
+	hostCfg.NetworkMode = container.NetworkMode(networkName)
+	if spec.IPv6 {
+		// Docker disables IPv6 inside containers unless asked otherwise.
+		if hostCfg.Sysctls == nil {
+			hostCfg.Sysctls = make(map[string]string)
+		}
+		hostCfg.Sysctls["net.ipv6.conf.all.disable_ipv6"] = "0"
+	}
+	hostCfg.DNS = append(hostCfg.DNS, spec.DNS...)
+	hostCfg.DNSSearch = append(hostCfg.DNSSearch, spec.DNSSearch...)
+	hostCfg.ExtraHosts = append(hostCfg.ExtraHosts, spec.ExtraHosts...)
+}
@@ -0,0 +1,150 @@
+package manager
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"strconv"
+
+	"github.com/foreveryh/sandboxai/go/mentisruntime/history"
+	"github.com/foreveryh/sandboxai/go/mentisruntime/ws"
+)
+
+var (
+	ErrHistoryDisabled = newError(KindUnavailable, "observation_history_disabled", "observation history is not enabled")
+	ErrInvalidCursor   = newError(KindInvalid, "invalid_cursor", "invalid cursor")
+)
+
+// WithObservationHistory records every broadcast observation in store.
+func WithObservationHistory(store *history.Store) Option {
+	return func(m *SandboxManager) {
+		m.history = store
+	}
+}
+
+// broadcast records an observation in the history, if enabled, and sends it to stream clients.
+// Recorded observations carry their sequence number, which clients use to resume a stream.
+func (m *SandboxManager) broadcast(sandboxID string, message []byte) {
+	if m.history != nil {
+		if seq, err := m.history.Append(sandboxID, message); err != nil {
+			m.logger.Error("Failed to record observation", "sandboxID", sandboxID, "error", err)
+		} else {
+			message = withSeq(message, seq)
+		}
+	}
+	m.deliver(sandboxID, message)
+}
+
+// broadcastObservation is broadcast for messages the manager marshaled or parsed itself,
+// whose metadata is known: the history records meta instead of parsing the message again,
+// and the sequence number is added without validating the message again. Stream lines the
+// action's coalescer holds are sent first.
+func (m *SandboxManager) broadcastObservation(sandboxID string, meta history.Meta, message []byte) {
+	if meta.ActionID != "" {
+		m.flushBatchOf(meta.ActionID)
+	}
+	m.sendObservation(sandboxID, meta, message)
+}
+
+// sendObservation implements broadcastObservation. Observations of actions with client
+// metadata carry it in a "metadata" field.
+func (m *SandboxManager) sendObservation(sandboxID string, meta history.Meta, message []byte) {
+	if meta.ActionID != "" {
+		if metadata := m.metadataOf(meta.ActionID); metadata != nil {
+			message = withMetadata(message, metadata)
+		}
+	}
+	if m.history != nil {
+		body := bytes.TrimLeft(message, " \t\r\n")
+		if len(body) == 0 || body[0] != '{' {
+			m.broadcast(sandboxID, message) // Valid JSON, but not an object
+			return
+		}
+		if seq, err := m.history.AppendJSON(sandboxID, meta, body); err != nil {
+			m.logger.Error("Failed to record observation", "sandboxID", sandboxID, "error", err)
+		} else {
+			message = prependSeq(body, seq)
+		}
+	}
+	m.deliver(sandboxID, message)
+}
+
+// deliver writes a broadcast message to the sandbox's observations log and hands the same
+// bytes to the hub, which sends them to every stream client as they are, and to in-process
+// subscriptions.
+func (m *SandboxManager) deliver(sandboxID string, message []byte) {
+	if m.logs != nil {
+		m.logObservation(sandboxID, message)
+	}
+	m.publish(sandboxID, message)
+	if m.hub != nil {
+		m.hub.SubmitBroadcast(sandboxID, message)
+	}
+}
+
+// ListObservations returns a page of a sandbox's recorded observations.
+func (m *SandboxManager) ListObservations(ctx context.Context, sandboxID string, q history.Query) (*history.Page, error) {
+	if m.history == nil {
+		return nil, ErrHistoryDisabled
+	}
+	m.mu.RLock()
+	_, exists := m.sandboxes[sandboxID]
+	m.mu.RUnlock()
+	if !exists {
+		return nil, ErrSandboxNotFound
+	}
+	return m.queryHistory(sandboxID, q)
+}
+
+func (m *SandboxManager) queryHistory(streamID string, q history.Query) (*history.Page, error) {
+	page, err := m.history.Query(streamID, q)
+	if errors.Is(err, history.ErrInvalidCursor) {
+		return nil, ErrInvalidCursor
+	}
+	return page, err
+}
+
+// MessagesAfter returns the observations of a stream recorded after seq as they were
+// broadcast. It implements ws.Resumer; callers check that the stream exists.
+func (m *SandboxManager) MessagesAfter(streamID string, seq uint64, limit int) ([]ws.RecordedMessage, error) {
+	if m.history == nil {
+		return nil, ErrHistoryDisabled
+	}
+	page, err := m.queryHistory(streamID, history.Query{Cursor: strconv.FormatUint(seq, 10), Limit: limit})
+	if err != nil {
+		return nil, err
+	}
+	messages := make([]ws.RecordedMessage, 0, len(page.Observations))
+	for _, rec := range page.Observations {
+		message := []byte(rec.Observation)
+		// Messages that were not JSON are recorded as JSON strings.
+		var raw string
+		if json.Unmarshal(message, &raw) == nil {
+			message = []byte(raw)
+		}
+		messages = append(messages, ws.RecordedMessage{Seq: rec.Seq, Message: withSeq(message, rec.Seq)})
+	}
+	return messages, nil
+}
+
+// withSeq adds a "seq" field to a JSON object message. Other messages are returned as is.
+func withSeq(message []byte, seq uint64) []byte {
+	body := bytes.TrimLeft(message, " \t\r\n")
+	if len(body) == 0 || body[0] != '{' || !json.Valid(body) {
+		return message
+	}
+	return prependSeq(body, seq)
+}
+
+// prependSeq adds a "seq" field to body, which must be a JSON object starting with '{'.
+func prependSeq(body []byte, seq uint64) []byte {
+	rest := bytes.TrimLeft(body[1:], " \t\r\n")
+	out := make([]byte, 0, len(body)+24)
+	out = append(out, `{"seq":`...)
+	out = strconv.AppendUint(out, seq, 10)
+	if rest[0] != '}' {
+		out = append(out, ',')
+	}
+	return append(out, rest...)
+}
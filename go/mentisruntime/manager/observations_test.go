@@ -0,0 +1,79 @@
+package manager
+
+import (
+	"io"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/foreveryh/sandboxai/go/mentisruntime/history"
+	"github.com/foreveryh/sandboxai/go/mentisruntime/ws"
+)
+
+func TestWithSeq(t *testing.T) {
+	require.Equal(t, `{"seq":7,"observation_type":"end"}`, string(withSeq([]byte(`{"observation_type":"end"}`), 7)))
+	require.Equal(t, `{"seq":1}`, string(withSeq([]byte(` { }`), 1)))
+	require.Equal(t, `not json`, string(withSeq([]byte(`not json`), 1)))
+}
+
+func TestMessagesAfter_replaysBroadcastMessages(t *testing.T) {
+	store, err := history.NewStore("", 0)
+	require.NoError(t, err)
+	m := &SandboxManager{history: store, logger: slog.Default()}
+
+	m.broadcast("sb", []byte(`{"observation_type":"start","action_id":"a"}`))
+	m.broadcast("sb", []byte(`raw output`))
+	m.broadcast("sb", []byte(`{"observation_type":"end","action_id":"a"}`))
+
+	messages, err := m.MessagesAfter("sb", 1, 10)
+	require.NoError(t, err)
+	require.Len(t, messages, 2)
+	require.Equal(t, uint64(2), messages[0].Seq)
+	require.Equal(t, "raw output", string(messages[0].Message))
+	require.Equal(t, `{"seq":3,"observation_type":"end","action_id":"a"}`, string(messages[1].Message))
+
+	_, err = (&SandboxManager{}).MessagesAfter("sb", 0, 10)
+	require.ErrorIs(t, err, ErrHistoryDisabled)
+}
+
+func newObservationTestManager(t testing.TB) *SandboxManager {
+	store, err := history.NewStore("", 0)
+	require.NoError(t, err)
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	return &SandboxManager{
+		logger:       logger,
+		sandboxes:    map[string]*SandboxState{"sb": {ID: "sb"}},
+		history:      store,
+		hub:          ws.NewHub(logger),
+		outputs:      make(map[string]*actionOutput),
+		outputLimits: OutputLimits{MaxLineBytes: 1 << 20, MaxActionBytes: 1 << 40},
+	}
+}
+
+func TestReceiveInternalObservation_recordsParsedMetadata(t *testing.T) {
+	m := newObservationTestManager(t)
+	msg := `{"observation_type":"stream","action_id":"a","timestamp":"2025-01-02T03:04:05Z","stream":"stdout","line":"hi\n"}`
+	require.NoError(t, m.ReceiveInternalObservation("sb", []byte(msg)))
+
+	page, err := m.history.Query("sb", history.Query{})
+	require.NoError(t, err)
+	require.Len(t, page.Observations, 1)
+	rec := page.Observations[0]
+	require.Equal(t, "stream", rec.ObservationType)
+	require.Equal(t, "a", rec.ActionID)
+	require.Equal(t, time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC), rec.Timestamp)
+	require.JSONEq(t, msg, string(rec.Observation))
+}
+
+func BenchmarkReceiveInternalObservation(b *testing.B) {
+	m := newObservationTestManager(b)
+	msg := []byte(`{"observation_type":"stream","action_id":"a","timestamp":"2025-01-02T03:04:05Z","stream":"stdout","line":"    Compiling serde v1.0.210 (/root/.cargo/registry/src/serde-1.0.210)\n"}`)
+	b.ReportAllocs()
+	for b.Loop() {
+		if err := m.ReceiveInternalObservation("sb", msg); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
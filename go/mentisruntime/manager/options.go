@@ -0,0 +1,19 @@
+package manager
+
+import (
+	"time"
+
+	"github.com/foreveryh/sandboxai/go/mentisruntime/artifact"
+)
+
+// Option configures optional SandboxManager behaviour.
+type Option func(*SandboxManager)
+
+// WithArtifactStore enables artifact capture into store. Download URLs handed out to
+// clients are valid for urlTTL.
+func WithArtifactStore(store artifact.Store, urlTTL time.Duration) Option {
+	return func(m *SandboxManager) {
+		m.artifactStore = store
+		m.artifactURLTTL = urlTTL
+	}
+}
@@ -0,0 +1,332 @@
+package manager
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/google/uuid"
+
+	"github.com/foreveryh/sandboxai/go/mentisruntime/metrics"
+)
+
+var outputTruncated = metrics.Default.NewCounterVec("sandboxai_output_truncated_total",
+	"Stream observations cut by output limits, by limit.", "limit")
+
+// OutputLimits caps the stream output of an action. Zero values disable a limit.
+type OutputLimits struct {
+	MaxLineBytes   int   // Longer lines are cut and flagged with "truncated": true
+	MaxActionBytes int64 // Stream bytes per action; later output is dropped after a "truncated" observation
+}
+
+// TruncatedObservationData is the data payload of a "truncated" observation.
+type TruncatedObservationData struct {
+	Reason     string `json:"reason"` // "action_output_limit"
+	LimitBytes int64  `json:"limit_bytes"`
+}
+
+// OutputSavedObservationData is the data payload of an "output_saved" observation, sent
+// when the full output of a truncated action has been stored as an artifact.
+type OutputSavedObservationData struct {
+	ArtifactID string `json:"artifact_id"`
+	Name       string `json:"name"`
+	Size       int64  `json:"size"`
+	URL        string `json:"url,omitempty"`
+}
+
+// actionOutput tracks the stream output of one action.
+type actionOutput struct {
+	sandboxID string
+	bytes     int64
+	truncated bool
+
+	// The full output is kept if it may have to be saved as an artifact: in memory up to the
+	// action limit, then in a spool file. spoolMu serializes writes with closing the file.
+	keep    bool
+	spoolMu sync.Mutex
+	pending []byte
+	spool   *os.File
+	closed  bool
+}
+
+// WithOutputLimits enforces per-line and per-action caps on stream observations.
+func WithOutputLimits(limits OutputLimits) Option {
+	return func(m *SandboxManager) {
+		m.outputLimits = limits
+	}
+}
+
+// limitStreamOutput applies the output limits to a "stream" observation from the agent,
+// parsed as obs. It returns the message to broadcast, or nil if the observation must be
+// dropped, and whether this observation reached the action limit. A cut line is also set
+// in obs.
+func (m *SandboxManager) limitStreamOutput(sandboxID string, obs *internalObservation, message []byte) ([]byte, bool) {
+	limits := m.outputLimits
+	if limits.MaxLineBytes <= 0 && limits.MaxActionBytes <= 0 {
+		return message, false
+	}
+	if obs.Line == nil {
+		return message, false
+	}
+	actionID, line := obs.ActionID, *obs.Line
+	if obs.Encoding == EncodingBase64 {
+		return m.limitBinaryFrame(sandboxID, actionID, message, line)
+	}
+
+	m.mu.Lock()
+	out := m.actionOutputLocked(sandboxID, actionID)
+	if out.truncated {
+		m.mu.Unlock()
+		m.spoolOutput(out, actionID, []byte(line))
+		return nil, false
+	}
+
+	cut := false
+	if limits.MaxLineBytes > 0 && len(line) > limits.MaxLineBytes {
+		line = truncateUTF8(line, limits.MaxLineBytes)
+		cut = true
+		outputTruncated.With("line").Inc()
+	}
+	hitActionLimit := false
+	if limits.MaxActionBytes > 0 && out.bytes+int64(len(line)) > limits.MaxActionBytes {
+		line = truncateUTF8(line, int(limits.MaxActionBytes-out.bytes))
+		cut = true
+		hitActionLimit = true
+		out.truncated = true
+		outputTruncated.With("action").Inc()
+	}
+	out.bytes += int64(len(line))
+	m.mu.Unlock()
+	m.spoolOutput(out, actionID, []byte(*obs.Line))
+
+	if hitActionLimit {
+		m.logger.Warn("Action output limit reached, dropping further output", "sandboxID", sandboxID, "actionID", actionID, "limit", limits.MaxActionBytes)
+	}
+	if !cut {
+		return message, false
+	}
+	if line == "" {
+		return nil, hitActionLimit
+	}
+	obs.Line, obs.Truncated = &line, true
+	// Only cut lines are decoded in full, to rewrite them with every other field kept.
+	var fields map[string]interface{}
+	if err := json.Unmarshal(message, &fields); err != nil {
+		return nil, hitActionLimit
+	}
+	fields["line"] = line
+	fields["truncated"] = true
+	limited, err := json.Marshal(fields)
+	if err != nil {
+		return nil, hitActionLimit
+	}
+	return limited, hitActionLimit
+}
+
+// actionOutputLocked returns the output accounting of an action, creating it. Its full
+// output is kept if it may be truncated and saved. Callers must hold m.mu.
+func (m *SandboxManager) actionOutputLocked(sandboxID, actionID string) *actionOutput {
+	out := m.outputs[actionID]
+	if out == nil {
+		out = &actionOutput{sandboxID: sandboxID, keep: m.artifactStore != nil && m.outputLimits.MaxActionBytes > 0}
+		m.outputs[actionID] = out
+	}
+	return out
+}
+
+// limitBinaryFrame counts the decoded size of a base64 frame against the action limit.
+// Frames are never cut, since a partial chunk is useless; one that does not fit is dropped.
+// Binary frames are not part of the spooled text output.
+func (m *SandboxManager) limitBinaryFrame(sandboxID, actionID string, message []byte, payload string) ([]byte, bool) {
+	decoded, err := base64.StdEncoding.DecodeString(payload)
+	if err != nil {
+		m.logger.Warn("Dropping stream frame with invalid base64 payload", "sandboxID", sandboxID, "actionID", actionID, "error", err)
+		return nil, false
+	}
+	limit := m.outputLimits.MaxActionBytes
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	out := m.outputs[actionID]
+	if out == nil {
+		out = &actionOutput{sandboxID: sandboxID}
+		m.outputs[actionID] = out
+	}
+	if out.truncated {
+		return nil, false
+	}
+	if limit > 0 && out.bytes+int64(len(decoded)) > limit {
+		out.truncated = true
+		outputTruncated.With("action").Inc()
+		return nil, true
+	}
+	out.bytes += int64(len(decoded))
+	return message, false
+}
+
+// pushTruncatedObservation tells clients that an action's further output is dropped.
+func (m *SandboxManager) pushTruncatedObservation(sandboxID, actionID string) {
+	m.pushObservation(sandboxID, actionID, "truncated", TruncatedObservationData{Reason: "action_output_limit", LimitBytes: m.outputLimits.MaxActionBytes})
+}
+
+// spoolOutput adds data to the full output of an action, if it is kept. The spool file is
+// only created once the output passes the action limit, before which it cannot be truncated.
+func (m *SandboxManager) spoolOutput(out *actionOutput, actionID string, data []byte) {
+	if !out.keep {
+		return
+	}
+	out.spoolMu.Lock()
+	defer out.spoolMu.Unlock()
+	if out.closed {
+		return
+	}
+	if out.spool == nil {
+		if int64(len(out.pending)+len(data)) <= m.outputLimits.MaxActionBytes {
+			out.pending = append(out.pending, data...)
+			return
+		}
+		spool, err := os.CreateTemp("", "sandboxai-output-*")
+		if err != nil {
+			m.logger.Warn("Failed to create output spool file", "actionID", actionID, "error", err)
+			out.closed, out.pending = true, nil
+			return
+		}
+		out.spool = spool
+		data = append(out.pending, data...)
+		out.pending = nil
+	}
+	if _, err := out.spool.Write(data); err != nil {
+		m.logger.Warn("Failed to spool action output", "actionID", actionID, "error", err)
+	}
+}
+
+// closeSpool stops spooling the output of an action and returns its spool file, if any.
+func (out *actionOutput) closeSpool() *os.File {
+	out.spoolMu.Lock()
+	defer out.spoolMu.Unlock()
+	out.closed, out.pending = true, nil
+	return out.spool
+}
+
+// finishActionOutput releases the output tracking of an ended action. If its output was
+// truncated and spooled, the full output is uploaded as an artifact in the background.
+func (m *SandboxManager) finishActionOutput(actionID string) {
+	m.mu.Lock()
+	out := m.outputs[actionID]
+	delete(m.outputs, actionID)
+	m.mu.Unlock()
+	if out == nil {
+		return
+	}
+	spool := out.closeSpool()
+	if spool == nil {
+		return
+	}
+	if !out.truncated {
+		spool.Close()
+		os.Remove(spool.Name())
+		return
+	}
+	metadata := m.metadataOf(actionID) // Forgotten once the "end" is sent, before the output is saved
+	save := func() { m.saveFullOutput(out.sandboxID, actionID, metadata, spool) }
+	if err := m.submit(m.sandboxContext(out.sandboxID), m.observationPool, save); err != nil {
+		save() // Pool closed or sandbox gone: save on this goroutine rather than lose the output
+	}
+}
+
+func (m *SandboxManager) saveFullOutput(sandboxID, actionID string, metadata json.RawMessage, spool *os.File) {
+	defer os.Remove(spool.Name())
+	defer spool.Close()
+
+	m.mu.RLock()
+	state, exists := m.sandboxes[sandboxID]
+	var spaceID string
+	if exists {
+		spaceID = state.SpaceID
+	}
+	m.mu.RUnlock()
+	if !exists {
+		return
+	}
+
+	size, err := spool.Seek(0, io.SeekEnd)
+	if err == nil {
+		_, err = spool.Seek(0, io.SeekStart)
+	}
+	if err != nil {
+		m.logger.Error("Failed to read spooled output", "actionID", actionID, "error", err)
+		return
+	}
+	artifact := &Artifact{
+		ID:          uuid.NewString(),
+		SandboxID:   sandboxID,
+		SpaceID:     spaceID,
+		Name:        fmt.Sprintf("output-%s.txt", actionID),
+		Size:        size,
+		ContentType: "text/plain; charset=utf-8",
+		CreatedAt:   time.Now().UTC(),
+	}
+	artifact.Key = path.Join(spaceID, sandboxID, artifact.ID, artifact.Name)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+	defer cancel()
+	if err := m.artifactStore.Put(ctx, artifact.Key, spool, size, artifact.ContentType); err != nil {
+		m.logger.Error("Failed to upload full action output", "sandboxID", sandboxID, "actionID", actionID, "error", err)
+		return
+	}
+	m.mu.Lock()
+	m.artifacts[sandboxID] = append(m.artifacts[sandboxID], artifact)
+	m.mu.Unlock()
+
+	data := OutputSavedObservationData{ArtifactID: artifact.ID, Name: artifact.Name, Size: size}
+	if signed, err := m.withSignedURL(ctx, artifact); err == nil {
+		data.URL = signed.URL
+	}
+	m.logger.Info("Full output of truncated action saved", "sandboxID", sandboxID, "actionID", actionID, "artifactID", artifact.ID, "size", size)
+	if metadata != nil {
+		m.setActionMetadata(actionID, metadata)
+		defer m.setActionMetadata(actionID, nil)
+	}
+	m.pushObservation(sandboxID, actionID, "output_saved", data)
+}
+
+// dropSandboxOutputs discards the output tracking of a deleted sandbox's unfinished actions.
+func (m *SandboxManager) dropSandboxOutputs(sandboxID string) {
+	m.mu.Lock()
+	var outs []*actionOutput
+	for actionID, out := range m.outputs {
+		if out.sandboxID != sandboxID {
+			continue
+		}
+		outs = append(outs, out)
+		delete(m.outputs, actionID)
+	}
+	m.mu.Unlock()
+	for _, out := range outs {
+		if spool := out.closeSpool(); spool != nil {
+			spool.Close()
+			os.Remove(spool.Name())
+		}
+	}
+}
+
+// truncateUTF8 cuts s to at most n bytes without splitting a multi-byte character.
+func truncateUTF8(s string, n int) string {
+	if n <= 0 {
+		return ""
+	}
+	if len(s) <= n {
+		return s
+	}
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+	return s[:n]
+}
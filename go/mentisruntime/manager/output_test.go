@@ -0,0 +1,125 @@
+package manager
+
+import (
+	"encoding/json"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/foreveryh/sandboxai/go/mentisruntime/artifact"
+)
+
+func TestLimitStreamOutput(t *testing.T) {
+	m := &SandboxManager{
+		logger:       slog.New(slog.NewTextHandler(io.Discard, nil)),
+		outputs:      make(map[string]*actionOutput),
+		outputLimits: OutputLimits{MaxLineBytes: 8, MaxActionBytes: 12},
+	}
+	stream := func(line string) []byte {
+		msg, _ := json.Marshal(map[string]string{"observation_type": "stream", "action_id": "a1", "stream": "stdout", "line": line})
+		return msg
+	}
+	lineOf := func(msg []byte) (string, bool) {
+		var obs struct {
+			Line      string `json:"line"`
+			Truncated bool   `json:"truncated"`
+		}
+		require.NoError(t, json.Unmarshal(msg, &obs))
+		return obs.Line, obs.Truncated
+	}
+
+	msg, hit := limitMessage(t, m, stream("short\n"))
+	require.False(t, hit)
+	line, truncated := lineOf(msg)
+	require.Equal(t, "short\n", line)
+	require.False(t, truncated)
+
+	msg, hit = limitMessage(t, m, stream(strings.Repeat("x", 20)))
+	require.True(t, hit, "6 + 8 bytes exceeds the action limit")
+	line, truncated = lineOf(msg)
+	require.Equal(t, "xxxxxx", line)
+	require.True(t, truncated)
+
+	msg, hit = limitMessage(t, m, stream("dropped\n"))
+	require.Nil(t, msg)
+	require.False(t, hit)
+
+	m.finishActionOutput("a1")
+	require.Empty(t, m.outputs)
+}
+
+func TestTruncateUTF8(t *testing.T) {
+	require.Equal(t, "ab", truncateUTF8("ab", 5))
+	require.Equal(t, "a", truncateUTF8("a€", 3), "must not split the 3-byte euro sign")
+	require.Equal(t, "", truncateUTF8("€", 0))
+}
+
+func TestLimitStreamOutput_binaryFrames(t *testing.T) {
+	m := &SandboxManager{
+		logger:       slog.New(slog.NewTextHandler(io.Discard, nil)),
+		outputs:      make(map[string]*actionOutput),
+		outputLimits: OutputLimits{MaxLineBytes: 4, MaxActionBytes: 10},
+	}
+	frame := func(payload string) []byte {
+		msg, _ := json.Marshal(map[string]string{"observation_type": "stream", "action_id": "a1", "stream": "stdout", "encoding": EncodingBase64, "line": payload})
+		return msg
+	}
+
+	msg, hit := limitMessage(t, m, frame("AAECAwQFBgc=")) // 8 bytes, not subject to the line cap
+	require.False(t, hit)
+	require.Equal(t, frame("AAECAwQFBgc="), msg)
+
+	msg, hit = limitMessage(t, m, frame("not base64!"))
+	require.Nil(t, msg)
+	require.False(t, hit)
+
+	msg, hit = limitMessage(t, m, frame("AAECAw==")) // 4 more bytes exceed the action limit
+	require.Nil(t, msg, "binary frames are dropped whole, never cut")
+	require.True(t, hit)
+}
+
+func TestLimitStreamOutput_spoolsPastLimit(t *testing.T) {
+	store, err := artifact.NewLocalStore(t.TempDir(), "", []byte("key"))
+	require.NoError(t, err)
+	m := &SandboxManager{
+		logger:        slog.New(slog.NewTextHandler(io.Discard, nil)),
+		outputs:       make(map[string]*actionOutput),
+		outputLimits:  OutputLimits{MaxActionBytes: 12},
+		artifactStore: store,
+	}
+	stream := func(line string) []byte {
+		msg, _ := json.Marshal(map[string]string{"observation_type": "stream", "action_id": "a1", "stream": "stdout", "line": line})
+		return msg
+	}
+
+	// Output within the limit stays in memory
+	limitMessage(t, m, stream("short\n"))
+	out := m.outputs["a1"]
+	require.Nil(t, out.spool)
+	require.Equal(t, "short\n", string(out.pending))
+
+	// Passing it moves everything to the spool file
+	limitMessage(t, m, stream("longer line\n"))
+	limitMessage(t, m, stream("dropped\n"))
+	require.NotNil(t, out.spool)
+	require.Nil(t, out.pending)
+	spooled, err := os.ReadFile(out.spool.Name())
+	require.NoError(t, err)
+	require.Equal(t, "short\nlonger line\ndropped\n", string(spooled))
+
+	// Output arriving after the spool is closed is dropped, not written to a closed file
+	m.dropSandboxOutputs("sb")
+	m.spoolOutput(out, "a1", []byte("late\n"))
+	require.NoFileExists(t, out.spool.Name())
+}
+
+// limitMessage parses a stream observation of sandbox "sb" and applies the output limits.
+func limitMessage(t *testing.T, m *SandboxManager, msg []byte) ([]byte, bool) {
+	var obs internalObservation
+	require.NoError(t, json.Unmarshal(msg, &obs))
+	return m.limitStreamOutput("sb", &obs, msg)
+}
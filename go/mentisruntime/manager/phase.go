@@ -0,0 +1,78 @@
+package manager
+
+// SandboxPhase is the lifecycle state of a sandbox.
+type SandboxPhase string
+
+// Sandbox phases.
+const (
+	PhaseCreating SandboxPhase = "creating" // Container being created
+	PhaseStarting SandboxPhase = "starting" // Container up, agent or setup not ready yet, also during restarts
+	PhaseReady    SandboxPhase = "ready"    // Agent serving actions
+	PhaseDegraded SandboxPhase = "degraded" // Agent failing health probes
+	PhaseStopping SandboxPhase = "stopping" // Being deleted
+	PhaseStopped  SandboxPhase = "stopped"  // Container exited cleanly
+	PhaseFailed   SandboxPhase = "failed"   // Container died, was killed, or could not recover
+	PhaseDeleted  SandboxPhase = "deleted"  // Removed; only seen in observations
+)
+
+// phaseTransitions lists the phases each phase may move to. Any live phase may move to
+// PhaseStopping when the sandbox is deleted.
+var phaseTransitions = map[SandboxPhase][]SandboxPhase{
+	PhaseCreating: {PhaseStarting, PhaseReady, PhaseFailed, PhaseStopping},
+	PhaseStarting: {PhaseReady, PhaseStopped, PhaseFailed, PhaseStopping},
+	PhaseReady:    {PhaseDegraded, PhaseStopped, PhaseFailed, PhaseStopping},
+	PhaseDegraded: {PhaseReady, PhaseStarting, PhaseStopped, PhaseFailed, PhaseStopping},
+	PhaseStopping: {PhaseDeleted},
+	PhaseStopped:  {PhaseStopping},
+	PhaseFailed:   {PhaseStopping},
+}
+
+// SandboxStateObservationData is pushed when a sandbox changes phase.
+type SandboxStateObservationData struct {
+	State    SandboxPhase `json:"state"`
+	Previous SandboxPhase `json:"previous,omitempty"`
+	Reason   string       `json:"reason,omitempty"`
+	spaceID  string       // Space whose stream is told of the change too
+}
+
+// canTransition reports whether a sandbox may move from one phase to another.
+func canTransition(from, to SandboxPhase) bool {
+	for _, next := range phaseTransitions[from] {
+		if next == to {
+			return true
+		}
+	}
+	return false
+}
+
+// transition moves a sandbox to a new phase and keeps IsRunning in step: it is true while
+// the agent accepts actions, which includes setup commands run while Starting. Callers must
+// hold m.mu and pass the result to announcePhase after unlocking. It returns false, leaving
+// the state unchanged, for transitions that are not allowed.
+func (m *SandboxManager) transition(state *SandboxState, to SandboxPhase, reason string) (SandboxStateObservationData, bool) {
+	from := state.Phase
+	if from == to {
+		return SandboxStateObservationData{}, false
+	}
+	if !canTransition(from, to) {
+		m.logger.Debug("Ignoring sandbox phase transition", "sandboxID", state.ID, "from", from, "to", to, "reason", reason)
+		return SandboxStateObservationData{}, false
+	}
+	state.Phase = to
+	state.IsRunning = to == PhaseReady || to == PhaseDegraded || (to == PhaseStarting && state.SetupStatus == SetupRunning)
+	return SandboxStateObservationData{State: to, Previous: from, Reason: reason, spaceID: state.SpaceID}, true
+}
+
+// announcePhase pushes a "sandbox_state" observation for a transition made by transition,
+// and the matching events on the stream of the sandbox's space.
+func (m *SandboxManager) announcePhase(sandboxID string, change SandboxStateObservationData, ok bool) {
+	if !ok {
+		return
+	}
+	m.logger.Info("Sandbox phase changed", "sandboxID", sandboxID, "from", change.Previous, "to", change.State, "reason", change.Reason)
+	m.pushObservation(sandboxID, "", "sandbox_state", change)
+	m.pushSpaceEvent(change.spaceID, SpaceEventSandboxState, SpaceStateEventData{SandboxID: sandboxID, SandboxStateObservationData: change})
+	if change.State == PhaseDeleted {
+		m.pushSpaceEvent(change.spaceID, SpaceEventSandboxDeleted, SpaceSandboxEventData{SandboxID: sandboxID})
+	}
+}
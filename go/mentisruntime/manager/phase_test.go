@@ -0,0 +1,39 @@
+package manager
+
+import (
+	"log/slog"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestTransition(t *testing.T) {
+	m := &SandboxManager{logger: slog.Default()}
+	state := &SandboxState{ID: "sb", Phase: PhaseCreating, SetupStatus: SetupRunning}
+
+	change, ok := m.transition(state, PhaseStarting, "created")
+	require.True(t, ok)
+	require.Equal(t, SandboxStateObservationData{State: PhaseStarting, Previous: PhaseCreating, Reason: "created"}, change)
+	require.True(t, state.IsRunning, "setup commands run while starting")
+
+	state.SetupStatus = SetupSucceeded
+	_, ok = m.transition(state, PhaseReady, "setup_succeeded")
+	require.True(t, ok)
+	require.True(t, state.IsRunning)
+
+	_, ok = m.transition(state, PhaseReady, "")
+	require.False(t, ok, "no change")
+
+	_, ok = m.transition(state, PhaseDegraded, "health_check_failed")
+	require.True(t, ok)
+	_, ok = m.transition(state, PhaseStarting, "restart")
+	require.True(t, ok)
+	require.False(t, state.IsRunning, "restarts are not running")
+
+	_, ok = m.transition(state, PhaseStopping, "delete_requested")
+	require.True(t, ok)
+	_, ok = m.transition(state, PhaseReady, "restarted")
+	require.False(t, ok, "a deleted sandbox cannot come back")
+	require.Equal(t, PhaseStopping, state.Phase)
+	require.False(t, state.IsRunning)
+}
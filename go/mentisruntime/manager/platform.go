@@ -0,0 +1,265 @@
+package manager
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/docker/docker/api/types/image"
+	"github.com/docker/docker/api/types/network"
+	"github.com/docker/docker/client"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+// Operating systems of the containers sandboxes run in.
+const (
+	PlatformLinux   = "linux"
+	PlatformWindows = "windows"
+)
+
+var (
+	ErrUnsupportedOnPlatform = newError(KindInvalid, "unsupported_on_platform", "not supported by the container platform")
+	ErrInvalidImagePlatform  = newError(KindInvalid, "invalid_platform", `invalid image platform: use "os/arch" or "os/arch/variant"`)
+)
+
+// imagePlatformRe matches image platforms such as "linux/arm64" or "linux/arm/v7".
+var imagePlatformRe = regexp.MustCompile(`^[a-z0-9]+/[a-z0-9_]+(/[a-z0-9]+)?$`)
+
+// Platform describes the containers sandboxes run in: Linux, or Windows containers for
+// PowerShell and .NET workloads, which have no bridge network, no host.docker.internal on
+// Windows Server, drive-letter paths and none of the Linux hardening options.
+type Platform struct {
+	OS          string // PlatformLinux or PlatformWindows; PlatformLinux if empty
+	Arch        string // CPU architecture of the Docker host ("amd64", "arm64"); images are pulled and run for it if set
+	RuntimeHost string // Host agents push observations to; if empty, host.docker.internal on Linux and the gateway of the sandbox's network on Windows
+	// RuntimeHostGateway maps RuntimeHost to the host gateway in containers' /etc/hosts, for
+	// Docker engines that do not resolve it themselves, such as a native engine on Linux.
+	RuntimeHostGateway bool
+	Image              string // Default box image; the image of the platform's variant if empty
+}
+
+// WithPlatform sets the platform of the sandboxes' containers.
+func WithPlatform(p Platform) Option {
+	return func(m *SandboxManager) {
+		m.platform = p
+	}
+}
+
+// DetectPlatform asks the Docker daemon which OS its containers run and the architecture of
+// its host, falling back to Linux and no architecture if the daemon cannot tell.
+func DetectPlatform(ctx context.Context, dockerClient *client.Client) Platform {
+	infoCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	info, err := dockerClient.Info(infoCtx)
+	if err != nil {
+		return Platform{OS: PlatformLinux}
+	}
+	p := Platform{OS: PlatformLinux, Arch: normalizeArch(info.Architecture)}
+	if info.OSType == PlatformWindows {
+		p.OS = PlatformWindows
+	}
+	return p
+}
+
+// normalizeArch maps the kernel's names for architectures, which the Docker daemon reports,
+// onto those of image platforms.
+func normalizeArch(arch string) string {
+	switch arch {
+	case "x86_64":
+		return "amd64"
+	case "aarch64":
+		return "arm64"
+	case "armv7l":
+		return "arm"
+	default:
+		return arch
+	}
+}
+
+// imagePlatform returns the platform images of a sandbox are pulled and run for: override,
+// which a create request may set, or the host's if its architecture is known, or "" to
+// leave the choice to Docker.
+func (p Platform) imagePlatform(override string) string {
+	if override != "" || p.Arch == "" {
+		return override
+	}
+	osName := p.OS
+	if osName == "" {
+		osName = PlatformLinux
+	}
+	return osName + "/" + p.Arch
+}
+
+// parseImagePlatform parses an "os/arch[/variant]" image platform.
+func parseImagePlatform(platform string) (*ocispec.Platform, error) {
+	if !imagePlatformRe.MatchString(platform) {
+		return nil, fmt.Errorf("%w: %q", ErrInvalidImagePlatform, platform)
+	}
+	parts := strings.Split(platform, "/")
+	p := &ocispec.Platform{OS: parts[0], Architecture: parts[1]}
+	if len(parts) == 3 {
+		p.Variant = parts[2]
+	}
+	return p, nil
+}
+
+// imageMatchesPlatform reports whether a local image was built for an "os/arch[/variant]"
+// platform, or for any if platform is "". Images that report no architecture match any.
+func imageMatchesPlatform(img image.InspectResponse, platform string) bool {
+	if platform == "" || img.Architecture == "" {
+		return true
+	}
+	want, err := parseImagePlatform(platform)
+	if err != nil {
+		return true
+	}
+	return img.Os == want.OS && img.Architecture == want.Architecture && (want.Variant == "" || img.Variant == want.Variant)
+}
+
+// ValidImagePlatform reports whether platform is an "os/arch[/variant]" image platform.
+func ValidImagePlatform(platform string) bool {
+	return imagePlatformRe.MatchString(platform)
+}
+
+func (p Platform) windows() bool {
+	return p.OS == PlatformWindows
+}
+
+// defaultNetwork is the Docker network sandboxes join when the spec names none.
+func (p Platform) defaultNetwork() string {
+	if p.windows() {
+		return "nat"
+	}
+	return DefaultNetwork
+}
+
+// networkDriver is the driver of the networks the runtime creates.
+func (p Platform) networkDriver() string {
+	if p.windows() {
+		return "nat"
+	}
+	return "bridge"
+}
+
+// boxImage is the box image of sandboxes whose spec names none, for an image platform:
+// BOX_IMAGE_<ARCH> (e.g. BOX_IMAGE_ARM64), for registries without multi-arch images, else
+// BOX_IMAGE, else the platform's default.
+func (p Platform) boxImage(imagePlatform string) string {
+	if parts := strings.Split(imagePlatform, "/"); len(parts) > 1 {
+		if image := os.Getenv("BOX_IMAGE_" + strings.ToUpper(parts[1])); image != "" {
+			return image
+		}
+	}
+	if image := os.Getenv("BOX_IMAGE"); image != "" {
+		return image
+	}
+	return p.defaultImage()
+}
+
+// defaultImage is the box image of sandboxes whose spec names none, unless BOX_IMAGE is set.
+func (p Platform) defaultImage() string {
+	switch {
+	case p.Image != "":
+		return p.Image
+	case p.windows():
+		return "mentisai/sandboxai-box:windows"
+	default:
+		return "mentisai/sandboxai-box:latest"
+	}
+}
+
+// secretDir is where secret files without a path are written.
+func (p Platform) secretDir() string {
+	if p.windows() {
+		return "C:/ProgramData/sandboxai/secrets"
+	}
+	return defaultSecretDir
+}
+
+// isAbs reports whether a container path is absolute: rooted at "/" on Linux, and also at a
+// drive ("C:\" or "C:/") on Windows.
+func (p Platform) isAbs(name string) bool {
+	if p.windows() && hasDrive(name) {
+		return len(name) > 2 && (name[2] == '\\' || name[2] == '/')
+	}
+	return path.IsAbs(name)
+}
+
+// joinPath joins container path elements with forward slashes, which Windows accepts too.
+func (p Platform) joinPath(elem ...string) string {
+	if p.windows() {
+		for i := range elem {
+			elem[i] = strings.ReplaceAll(elem[i], `\`, "/")
+		}
+	}
+	return path.Join(elem...)
+}
+
+// archivePath returns the name an absolute container path takes in an archive copied to the
+// root of the container: relative to "/", or to the system drive on Windows.
+func (p Platform) archivePath(name string) string {
+	if p.windows() {
+		name = strings.ReplaceAll(name, `\`, "/")
+		if hasDrive(name) {
+			name = name[2:]
+		}
+	}
+	return strings.TrimPrefix(path.Clean(name), "/")
+}
+
+func hasDrive(name string) bool {
+	return len(name) >= 2 && name[1] == ':' && (name[0]|0x20 >= 'a' && name[0]|0x20 <= 'z')
+}
+
+// checkSpec refuses the settings of a spec and its security profile that only Linux
+// containers support.
+func (p Platform) checkSpec(spec SandboxSpec, profile SecurityProfile) error {
+	if !p.windows() {
+		return nil
+	}
+	var unsupported []string
+	if len(spec.Tmpfs) > 0 {
+		unsupported = append(unsupported, "tmpfs")
+	}
+	if spec.IPv6 {
+		unsupported = append(unsupported, "ipv6")
+	}
+	if len(spec.Ulimits) > 0 {
+		unsupported = append(unsupported, "ulimits")
+	}
+	if profile.ReadonlyRootfs || len(profile.CapDrop) > 0 || len(profile.CapAdd) > 0 || profile.NoNewPrivileges ||
+		profile.Seccomp != "" || profile.AppArmor != "" || len(profile.Tmpfs) > 0 || profile.User != "" || len(profile.Ulimits) > 0 {
+		unsupported = append(unsupported, "security profile "+profile.Name)
+	}
+	if len(unsupported) > 0 {
+		return fmt.Errorf("%w: %s on Windows containers", ErrUnsupportedOnPlatform, strings.Join(unsupported, ", "))
+	}
+	return nil
+}
+
+// runtimeHost returns the host agents on networkName push observations to. Windows Server
+// has no host.docker.internal, but the gateway of a nat network is the host.
+func (m *SandboxManager) runtimeHost(ctx context.Context, networkName string) (string, error) {
+	if m.platform.RuntimeHost != "" {
+		return m.platform.RuntimeHost, nil
+	}
+	if !m.platform.windows() {
+		return "host.docker.internal", nil
+	}
+	inspectCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	nw, err := m.docker().NetworkInspect(inspectCtx, networkName, network.InspectOptions{})
+	if err != nil {
+		return "", backendError("network_inspect_failed", "failed to inspect network "+networkName, err)
+	}
+	for _, cfg := range nw.IPAM.Config {
+		if cfg.Gateway != "" {
+			return cfg.Gateway, nil
+		}
+	}
+	return "", newError(KindBackend, "runtime_host_unknown", "network "+networkName+" has no gateway to reach the runtime at; set the runtime host")
+}
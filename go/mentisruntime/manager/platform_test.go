@@ -0,0 +1,56 @@
+package manager
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestPlatform_paths(t *testing.T) {
+	linux, windows := Platform{}, Platform{OS: PlatformWindows}
+
+	require.True(t, linux.isAbs("/run/secrets/token"))
+	require.False(t, linux.isAbs(`C:\secrets\token`))
+	require.True(t, windows.isAbs(`C:\secrets\token`))
+	require.True(t, windows.isAbs("c:/secrets/token"))
+	require.False(t, windows.isAbs("C:token"))
+	require.False(t, windows.isAbs("token"))
+
+	require.Equal(t, "/run/secrets/token", linux.joinPath(linux.secretDir(), "token"))
+	require.Equal(t, "C:/ProgramData/sandboxai/secrets/token", windows.joinPath(windows.secretDir(), "token"))
+
+	require.Equal(t, "run/secrets/token", linux.archivePath("/run/secrets/token"))
+	require.Equal(t, "secrets/token", windows.archivePath(`C:\secrets\token`))
+}
+
+func TestPlatform_checkSpec(t *testing.T) {
+	profiles := securityProfiles("")
+	windows := Platform{OS: PlatformWindows}
+
+	require.NoError(t, Platform{}.checkSpec(SandboxSpec{Tmpfs: map[string]string{"/tmp": ""}}, profiles[SecurityProfileHardened]))
+	require.NoError(t, windows.checkSpec(SandboxSpec{}, profiles[SecurityProfileDefault]))
+
+	err := windows.checkSpec(SandboxSpec{Tmpfs: map[string]string{"/tmp": ""}, IPv6: true}, profiles[SecurityProfileHardened])
+	require.ErrorIs(t, err, ErrUnsupportedOnPlatform)
+	require.ErrorContains(t, err, "tmpfs, ipv6, security profile hardened")
+}
+
+func TestPlatform_imagePlatform(t *testing.T) {
+	require.Equal(t, "", Platform{}.imagePlatform(""))
+	require.Equal(t, "linux/arm64", Platform{Arch: normalizeArch("aarch64")}.imagePlatform(""))
+	require.Equal(t, "windows/amd64", Platform{OS: PlatformWindows, Arch: "amd64"}.imagePlatform(""))
+	require.Equal(t, "linux/arm/v7", Platform{Arch: "arm64"}.imagePlatform("linux/arm/v7"))
+
+	p, err := parseImagePlatform("linux/arm/v7")
+	require.NoError(t, err)
+	require.Equal(t, "arm", p.Architecture)
+	require.Equal(t, "v7", p.Variant)
+	_, err = parseImagePlatform("arm64")
+	require.ErrorIs(t, err, ErrInvalidImagePlatform)
+
+	t.Setenv("BOX_IMAGE", "box:generic")
+	t.Setenv("BOX_IMAGE_ARM64", "box:arm64")
+	require.Equal(t, "box:arm64", Platform{}.boxImage("linux/arm64"))
+	require.Equal(t, "box:generic", Platform{}.boxImage("linux/amd64"))
+	require.Equal(t, "box:generic", Platform{}.boxImage(""))
+}
@@ -0,0 +1,89 @@
+package manager
+
+import (
+	"context"
+
+	"github.com/foreveryh/sandboxai/go/mentisruntime/workpool"
+)
+
+// Default worker pool sizes.
+const (
+	defaultActionWorkers      = 256 // A worker is busy for the whole action
+	defaultObservationWorkers = 8
+	defaultDockerWorkers      = 16
+	defaultPoolQueue          = 1024
+)
+
+var ErrRuntimeBusy = newError(KindQuota, "runtime_busy", "too many actions waiting to start")
+
+// PoolSizes sets the worker pools of a manager. Zero fields keep their default.
+type PoolSizes struct {
+	Actions      int // Action requests to agents, across all sandboxes
+	Observations int // Observation post-processing, such as saving the full output of actions
+	Docker       int // Docker calls fanned out over sandboxes, such as stats sampling and batch deletion
+	Queue        int // Tasks each pool holds while its workers are busy
+}
+
+// WithWorkerPools sizes the pools that run actions, observation processing and Docker
+// operations. Actions submitted while the action pool's queue is full are rejected with
+// ErrRuntimeBusy.
+func WithWorkerPools(sizes PoolSizes) Option {
+	return func(m *SandboxManager) {
+		m.poolSizes = sizes
+	}
+}
+
+// startPools creates the worker pools.
+func (m *SandboxManager) startPools() {
+	sizeOr := func(n, def int) int {
+		if n > 0 {
+			return n
+		}
+		return def
+	}
+	queue := sizeOr(m.poolSizes.Queue, defaultPoolQueue)
+	m.actionPool = workpool.New("actions", sizeOr(m.poolSizes.Actions, defaultActionWorkers), queue)
+	m.observationPool = workpool.New("observations", sizeOr(m.poolSizes.Observations, defaultObservationWorkers), queue)
+	m.dockerPool = workpool.New("docker", sizeOr(m.poolSizes.Docker, defaultDockerWorkers), queue)
+}
+
+// Wait waits, once the context passed to NewSandboxManager has ended, for the manager's
+// background loops to return and for the tasks left in its pools to finish.
+func (m *SandboxManager) Wait() {
+	m.loops.Wait()
+	for _, pool := range []*workpool.Pool{m.actionPool, m.observationPool, m.dockerPool} {
+		if pool != nil {
+			pool.Close()
+		}
+	}
+}
+
+// trySubmit runs task on pool without waiting for room in its queue. Managers built without
+// NewSandboxManager have no pools and run task on a new goroutine. A panicking task is
+// recovered, leaving the pool's worker running.
+func (m *SandboxManager) trySubmit(pool *workpool.Pool, task func()) error {
+	task = m.guardTask(task)
+	if pool == nil {
+		go task()
+		return nil
+	}
+	return pool.TrySubmit(task)
+}
+
+// submit runs task on pool, waiting for room in its queue until ctx ends.
+func (m *SandboxManager) submit(ctx context.Context, pool *workpool.Pool, task func()) error {
+	task = m.guardTask(task)
+	if pool == nil {
+		go task()
+		return nil
+	}
+	return pool.Submit(ctx, task)
+}
+
+// guardTask wraps a pool task so that it recovers from panics.
+func (m *SandboxManager) guardTask(task func()) func() {
+	return func() {
+		defer m.recoverPanic("pool_task", nil)
+		task()
+	}
+}
@@ -0,0 +1,32 @@
+package manager
+
+import (
+	"log/slog"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/foreveryh/sandboxai/go/mentisruntime/workpool"
+)
+
+func TestInitiateAction_runtimeBusy(t *testing.T) {
+	pool := workpool.New("test-actions", 1, 0)
+	release := make(chan struct{})
+	require.NoError(t, pool.Submit(t.Context(), func() { <-release })) // Occupies the only worker
+	defer pool.Close()
+	defer close(release)
+
+	m := &SandboxManager{
+		logger:        slog.Default(),
+		sandboxes:     map[string]*SandboxState{"sb": {ID: "sb", IsRunning: true}},
+		activeActions: map[string]string{},
+		actionWaiters: map[string]chan int{},
+		actionQueues:  map[string]*actionQueue{},
+		outputs:       map[string]*actionOutput{},
+		actionPool:    pool,
+	}
+	_, err := m.InitiateAction(t.Context(), "sb", "shell", map[string]interface{}{"command": "ls"})
+	require.ErrorIs(t, err, ErrRuntimeBusy)
+	require.ErrorIs(t, err, ErrQuota)
+	require.Empty(t, m.activeActions)
+}
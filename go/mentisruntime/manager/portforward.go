@@ -0,0 +1,71 @@
+package manager
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strconv"
+
+	"github.com/docker/go-connections/nat"
+)
+
+var (
+	ErrInvalidPort     = newError(KindInvalid, "invalid_port", "invalid port")
+	ErrPortUnreachable = newError(KindBackend, "port_unreachable", "the sandbox port is neither published nor reachable on a network")
+)
+
+// PortTarget is where the runtime connects to forward a TCP port of a sandbox.
+type PortTarget struct {
+	Address string // host:port the runtime dials
+	// Context is done when the sandbox is deleted or the runtime stops, which must end
+	// forwarded connections.
+	Context context.Context
+}
+
+// PortTarget returns the address of a TCP port of a running sandbox: the host port Docker
+// publishes it on, if it is published, or else the sandbox's address on its network.
+// The ports of the agent and its Jupyter server are not forwarded: clients reach them
+// through the runtime only.
+func (m *SandboxManager) PortTarget(ctx context.Context, sandboxID string, port int) (PortTarget, error) {
+	if port < 1 || port > 65535 {
+		return PortTarget{}, fmt.Errorf("%w: port must be between 1 and 65535", ErrInvalidPort)
+	}
+	if p := nat.Port(strconv.Itoa(port) + "/tcp"); p == AgentPort || p == JupyterPort {
+		return PortTarget{}, fmt.Errorf("%w: port %d is reserved for the runtime", ErrInvalidPort, port)
+	}
+	m.mu.RLock()
+	state, exists := m.sandboxes[sandboxID]
+	var containerID string
+	var sandboxCtx context.Context
+	if exists {
+		containerID, sandboxCtx = state.ContainerID, state.ctx
+	}
+	running := exists && state.IsRunning
+	m.mu.RUnlock()
+	if !exists {
+		return PortTarget{}, ErrSandboxNotFound
+	}
+	if !running {
+		return PortTarget{}, ErrSandboxNotRunning
+	}
+	if sandboxCtx == nil {
+		sandboxCtx = context.Background()
+	}
+
+	info, err := m.docker().ContainerInspect(ctx, containerID)
+	if err != nil {
+		return PortTarget{}, backendError("inspect_failed", "failed to inspect sandbox container", err)
+	}
+	if info.NetworkSettings == nil {
+		return PortTarget{}, ErrPortUnreachable
+	}
+	if bindings := info.NetworkSettings.Ports[nat.Port(strconv.Itoa(port)+"/tcp")]; len(bindings) > 0 && bindings[0].HostPort != "" {
+		return PortTarget{Address: net.JoinHostPort("localhost", bindings[0].HostPort), Context: sandboxCtx}, nil
+	}
+	for _, endpoint := range info.NetworkSettings.Networks {
+		if endpoint != nil && endpoint.IPAddress != "" {
+			return PortTarget{Address: net.JoinHostPort(endpoint.IPAddress, strconv.Itoa(port)), Context: sandboxCtx}, nil
+		}
+	}
+	return PortTarget{}, ErrPortUnreachable
+}
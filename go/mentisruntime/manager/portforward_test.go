@@ -0,0 +1,16 @@
+package manager
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestPortTarget_refusesReservedPorts(t *testing.T) {
+	m := &SandboxManager{sandboxes: map[string]*SandboxState{"sb": {ID: "sb", IsRunning: true}}}
+	for _, port := range []int{0, 65536, AgentPort.Int(), JupyterPort.Int()} {
+		_, err := m.PortTarget(context.Background(), "sb", port)
+		require.ErrorIs(t, err, ErrInvalidPort, "port %d", port)
+	}
+}
@@ -0,0 +1,225 @@
+package manager
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/foreveryh/sandboxai/go/mentisruntime/metrics"
+)
+
+var ErrHostPressure = newError(KindUnavailable, "host_pressure", "host under pressure")
+
+var actionsThrottled = metrics.Default.NewCounter("sandboxai_actions_throttled_total",
+	"Actions whose dispatch was held back because the host was under pressure.")
+
+// Backoff between checks of whether a throttled action may be dispatched.
+const (
+	throttleInitialBackoff = 100 * time.Millisecond
+	throttleMaxBackoff     = 5 * time.Second
+)
+
+// HostLoad is a reading of the load and memory of the host.
+type HostLoad struct {
+	Load1           float64 `json:"load1"` // 1-minute load average
+	CPUs            int     `json:"cpus"`
+	MemoryTotal     uint64  `json:"memory_total_bytes"`
+	MemoryAvailable uint64  `json:"memory_available_bytes"`
+}
+
+// PressureLimits are the soft limits on host load past which the dispatch of new actions is
+// held back, so the host slows down instead of the Docker daemon running out of memory.
+type PressureLimits struct {
+	Interval      time.Duration            // How often the host is read
+	MaxLoadPerCPU float64                  // 1-minute load average per CPU above which the host is under pressure; zero disables
+	MinFreeMemory float64                  // Share of memory available below which the host is under pressure; zero disables
+	MaxDelay      time.Duration            // Longest an action is held back before it is dispatched anyway
+	Read          func() (HostLoad, error) // Reads the host; ReadHostLoad if nil
+}
+
+// ThrottledObservationData is pushed for an action whose dispatch is held back by host
+// pressure. Its "start" follows once the pressure eases or MaxDelay has passed.
+type ThrottledObservationData struct {
+	Reason string `json:"reason"`
+}
+
+// hostPressure is the last reading of the host and whether it exceeds the limits.
+type hostPressure struct {
+	limits PressureLimits
+
+	mu     sync.Mutex
+	load   HostLoad
+	reason string // Why the host is under pressure; "" if it is not
+}
+
+// WithHostPressureLimits reads the host's load and memory at limits.Interval and, while
+// either exceeds its limit, holds back new actions with backoff and reports the runtime as
+// degraded.
+func WithHostPressureLimits(limits PressureLimits) Option {
+	return func(m *SandboxManager) {
+		if limits.Read == nil {
+			limits.Read = ReadHostLoad
+		}
+		m.pressure = &hostPressure{limits: limits}
+	}
+}
+
+// exceeded returns why a reading exceeds the limits, or "" if it does not.
+func (l PressureLimits) exceeded(load HostLoad) string {
+	if l.MaxLoadPerCPU > 0 && load.CPUs > 0 {
+		if perCPU := load.Load1 / float64(load.CPUs); perCPU > l.MaxLoadPerCPU {
+			return fmt.Sprintf("load %.2f per CPU is above %.2f", perCPU, l.MaxLoadPerCPU)
+		}
+	}
+	if l.MinFreeMemory > 0 && load.MemoryTotal > 0 {
+		if free := float64(load.MemoryAvailable) / float64(load.MemoryTotal); free < l.MinFreeMemory {
+			return fmt.Sprintf("%.0f%% of memory available is below %.0f%%", free*100, l.MinFreeMemory*100)
+		}
+	}
+	return ""
+}
+
+// ReadHostLoad reads the load average and memory of a Linux host from /proc.
+func ReadHostLoad() (HostLoad, error) {
+	load := HostLoad{CPUs: runtime.NumCPU()}
+	if runtime.GOOS != "linux" {
+		return load, fmt.Errorf("host load is only read on Linux hosts, not %s", runtime.GOOS)
+	}
+	data, err := os.ReadFile("/proc/loadavg")
+	if err != nil {
+		return load, err
+	}
+	if load.Load1, err = parseLoadavg(data); err != nil {
+		return load, err
+	}
+	if data, err = os.ReadFile("/proc/meminfo"); err != nil {
+		return load, err
+	}
+	load.MemoryTotal, load.MemoryAvailable, err = parseMeminfo(data)
+	return load, err
+}
+
+// parseLoadavg returns the 1-minute load average of /proc/loadavg.
+func parseLoadavg(data []byte) (float64, error) {
+	fields := strings.Fields(string(data))
+	if len(fields) == 0 {
+		return 0, fmt.Errorf("empty loadavg")
+	}
+	return strconv.ParseFloat(fields[0], 64)
+}
+
+// parseMeminfo returns the total and available memory of /proc/meminfo, in bytes.
+func parseMeminfo(data []byte) (total, available uint64, err error) {
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		key, value, ok := strings.Cut(scanner.Text(), ":")
+		if !ok || (key != "MemTotal" && key != "MemAvailable") {
+			continue
+		}
+		kb, err := strconv.ParseUint(strings.TrimSuffix(strings.TrimSpace(value), " kB"), 10, 64)
+		if err != nil {
+			return 0, 0, fmt.Errorf("invalid %s: %w", key, err)
+		}
+		if key == "MemTotal" {
+			total = kb * 1024
+		} else {
+			available = kb * 1024
+		}
+	}
+	if total == 0 {
+		return 0, 0, fmt.Errorf("no MemTotal in meminfo")
+	}
+	return total, available, scanner.Err()
+}
+
+// runPressureMonitor reads the host until ctx is done.
+func (m *SandboxManager) runPressureMonitor(ctx context.Context) {
+	ticker := time.NewTicker(m.pressure.limits.Interval)
+	defer ticker.Stop()
+	m.logger.Info("Host pressure monitor started", "interval", m.pressure.limits.Interval,
+		"maxLoadPerCPU", m.pressure.limits.MaxLoadPerCPU, "minFreeMemory", m.pressure.limits.MinFreeMemory)
+
+	for {
+		m.samplePressure()
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// samplePressure reads the host once. A failed read leaves the previous reading in place.
+func (m *SandboxManager) samplePressure() {
+	p := m.pressure
+	load, err := p.limits.Read()
+	if err != nil {
+		m.logger.Warn("Failed to read host load", "error", err)
+		return
+	}
+	reason := p.limits.exceeded(load)
+	p.mu.Lock()
+	previous := p.reason
+	p.load, p.reason = load, reason
+	p.mu.Unlock()
+	switch {
+	case reason != "" && previous == "":
+		m.logger.Warn("Host under pressure, throttling new actions", "reason", reason)
+	case reason == "" && previous != "":
+		m.logger.Info("Host pressure eased")
+	}
+}
+
+// underPressure returns why the host is under pressure, or "" if it is not or the
+// monitor is disabled.
+func (m *SandboxManager) underPressure() string {
+	if m.pressure == nil {
+		return ""
+	}
+	m.pressure.mu.Lock()
+	defer m.pressure.mu.Unlock()
+	return m.pressure.reason
+}
+
+// CheckHostPressure is a readiness check that fails while the host is under pressure.
+func (m *SandboxManager) CheckHostPressure(ctx context.Context) error {
+	if reason := m.underPressure(); reason != "" {
+		return fmt.Errorf("%w: %s", ErrHostPressure, reason)
+	}
+	return nil
+}
+
+// throttleAction holds back an accepted action while the host is under pressure, checking
+// again with exponential backoff, and dispatches it once the pressure eases, MaxDelay has
+// passed or the runtime shuts down.
+func (m *SandboxManager) throttleAction(sandboxID string, action *queuedAction, reason string) {
+	actionsThrottled.Inc()
+	m.logger.Info("Action throttled by host pressure", "sandboxID", sandboxID, "actionID", action.id, "reason", reason)
+	m.pushObservation(sandboxID, action.id, "throttled", ThrottledObservationData{Reason: reason})
+	m.loops.Go(func() error {
+		defer m.recoverPanic("throttle", func(err error) { m.abortAction(sandboxID, action.id, err) })
+		deadline := time.Now().Add(m.pressure.limits.MaxDelay)
+		backoff := throttleInitialBackoff
+		for m.underPressure() != "" && time.Now().Before(deadline) {
+			select {
+			case <-m.ctx.Done():
+				deadline = time.Time{}
+			case <-time.After(min(backoff, time.Until(deadline))):
+			}
+			backoff = min(backoff*2, throttleMaxBackoff)
+		}
+		if err := m.submitAction(sandboxID, action); err != nil {
+			errMsg := fmt.Sprintf("Action not started: %v", err)
+			m.pushErrorObservation(sandboxID, action.id, errMsg)
+			m.pushEndObservation(sandboxID, action.id, EndObservationData{ExitCode: -1, Error: errMsg})
+		}
+		return nil
+	})
+}
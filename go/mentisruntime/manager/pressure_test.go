@@ -0,0 +1,37 @@
+package manager
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseHostLoad(t *testing.T) {
+	load, err := parseLoadavg([]byte("3.52 2.10 1.05 2/812 40213\n"))
+	require.NoError(t, err)
+	require.Equal(t, 3.52, load)
+
+	total, available, err := parseMeminfo([]byte("MemTotal:       16384000 kB\nMemFree:         1024000 kB\nMemAvailable:    4096000 kB\n"))
+	require.NoError(t, err)
+	require.Equal(t, uint64(16384000*1024), total)
+	require.Equal(t, uint64(4096000*1024), available)
+
+	_, _, err = parseMeminfo([]byte("MemFree: 1 kB\n"))
+	require.Error(t, err)
+}
+
+func TestPressureLimits_exceeded(t *testing.T) {
+	limits := PressureLimits{MaxLoadPerCPU: 2, MinFreeMemory: 0.1}
+	calm := HostLoad{Load1: 7, CPUs: 4, MemoryTotal: 100, MemoryAvailable: 50}
+	require.Empty(t, limits.exceeded(calm))
+
+	loaded := calm
+	loaded.Load1 = 9
+	require.Contains(t, limits.exceeded(loaded), "per CPU")
+
+	short := calm
+	short.MemoryAvailable = 5
+	require.Contains(t, limits.exceeded(short), "memory")
+
+	require.Empty(t, PressureLimits{}.exceeded(loaded))
+}
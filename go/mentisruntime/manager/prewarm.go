@@ -0,0 +1,207 @@
+package manager
+
+import (
+	"context"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/docker/docker/api/types/image"
+
+	"github.com/foreveryh/sandboxai/go/mentisruntime/metrics"
+)
+
+var ErrPrewarmDisabled = newError(KindUnavailable, "prewarm_disabled", "image pre-warming is not enabled on this runtime")
+
+var prewarmPulls = metrics.Default.NewCounterVec("sandboxai_image_prewarm_pulls_total",
+	"Image pulls made to keep pre-warmed images fresh, by result.", "result")
+
+// Pre-warmed image states.
+const (
+	PrewarmPending = "pending" // Not pulled yet
+	PrewarmPulling = "pulling"
+	PrewarmReady   = "ready"
+	PrewarmFailed  = "failed" // The last pull failed; an earlier copy may still be present
+)
+
+// PrewarmImage is the pull status of a pre-warmed image.
+type PrewarmImage struct {
+	Image        string     `json:"image"`
+	State        string     `json:"state"`
+	ImageID      string     `json:"image_id,omitempty"` // Local image the name resolved to after the last pull
+	LastPulledAt *time.Time `json:"last_pulled_at,omitempty"`
+	LastError    string     `json:"last_error,omitempty"`
+}
+
+// PrewarmStatus lists the pre-warmed images and when they are next refreshed.
+type PrewarmStatus struct {
+	Interval  string         `json:"interval"`
+	LastRunAt *time.Time     `json:"last_run_at,omitempty"`
+	NextRunAt *time.Time     `json:"next_run_at,omitempty"`
+	Images    []PrewarmImage `json:"images"`
+}
+
+// prewarmer keeps the list of images pulled ahead of sandbox creation and their status.
+type prewarmer struct {
+	interval time.Duration
+	refresh  chan struct{} // Requests a pass ahead of schedule
+
+	mu        sync.Mutex
+	images    []string
+	status    map[string]*PrewarmImage
+	lastRunAt *time.Time
+	nextRunAt *time.Time
+}
+
+// WithImagePrewarm pulls images in the background when the manager starts and again every
+// interval (unless zero), so sandboxes created from them never wait for a pull and pick up
+// updated tags.
+func WithImagePrewarm(images []string, interval time.Duration) Option {
+	return func(m *SandboxManager) {
+		m.prewarm = &prewarmer{interval: interval, refresh: make(chan struct{}, 1), status: map[string]*PrewarmImage{}}
+		m.prewarm.setImages(images)
+	}
+}
+
+// SetPrewarmImages replaces the pre-warmed images, as when the configuration is reloaded,
+// and pulls the new list straight away.
+func (m *SandboxManager) SetPrewarmImages(images []string) error {
+	if m.prewarm == nil {
+		return ErrPrewarmDisabled
+	}
+	m.prewarm.setImages(images)
+	m.logger.Info("Pre-warmed images updated", "images", images)
+	return m.RefreshPrewarm()
+}
+
+// RefreshPrewarm pulls the pre-warmed images ahead of schedule. The pass runs in the
+// background; requests made while one is pending are merged into it.
+func (m *SandboxManager) RefreshPrewarm() error {
+	if m.prewarm == nil {
+		return ErrPrewarmDisabled
+	}
+	select {
+	case m.prewarm.refresh <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// GetPrewarmStatus reports the pull status of the pre-warmed images.
+func (m *SandboxManager) GetPrewarmStatus() (*PrewarmStatus, error) {
+	p := m.prewarm
+	if p == nil {
+		return nil, ErrPrewarmDisabled
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	status := &PrewarmStatus{Interval: p.interval.String(), LastRunAt: p.lastRunAt, NextRunAt: p.nextRunAt, Images: make([]PrewarmImage, 0, len(p.images))}
+	for _, name := range p.images {
+		status.Images = append(status.Images, *p.status[name])
+	}
+	return status, nil
+}
+
+func (m *SandboxManager) runPrewarmer(ctx context.Context) {
+	p := m.prewarm
+	m.logger.Info("Image pre-warmer started", "interval", p.interval)
+	for {
+		m.prewarmPass(ctx)
+		var scheduled <-chan time.Time // Passes only run on refresh without an interval
+		if p.interval > 0 {
+			scheduled = time.After(p.interval)
+			p.mu.Lock()
+			next := time.Now().UTC().Add(p.interval)
+			p.nextRunAt = &next
+			p.mu.Unlock()
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-scheduled:
+		case <-p.refresh:
+		}
+	}
+}
+
+// prewarmPass pulls every pre-warmed image, one at a time so that pre-warming does not
+// compete with the pulls of sandbox creation for bandwidth.
+func (m *SandboxManager) prewarmPass(ctx context.Context) {
+	p := m.prewarm
+	p.mu.Lock()
+	now := time.Now().UTC()
+	p.lastRunAt, p.nextRunAt = &now, nil
+	images := slices.Clone(p.images)
+	p.mu.Unlock()
+
+	for _, name := range images {
+		if ctx.Err() != nil {
+			return
+		}
+		p.update(name, func(s *PrewarmImage) { s.State = PrewarmPulling })
+		imageID, err := m.pullImage(ctx, name)
+		if err != nil {
+			prewarmPulls.With("failed").Inc()
+			m.logger.Warn("Failed to pre-warm image", "image", name, "error", err)
+			p.update(name, func(s *PrewarmImage) { s.State, s.LastError = PrewarmFailed, err.Error() })
+			continue
+		}
+		prewarmPulls.With("pulled").Inc()
+		m.logger.Info("Image pre-warmed", "image", name, "imageID", imageID)
+		pulledAt := time.Now().UTC()
+		p.update(name, func(s *PrewarmImage) {
+			s.State, s.ImageID, s.LastPulledAt, s.LastError = PrewarmReady, imageID, &pulledAt, ""
+		})
+	}
+}
+
+// pullImage pulls an image, even if present locally, and returns the ID it resolves to.
+func (m *SandboxManager) pullImage(ctx context.Context, name string) (string, error) {
+	pullCtx, cancel := context.WithTimeout(ctx, 30*time.Minute)
+	defer cancel()
+	out, err := m.docker().ImagePull(pullCtx, name, image.PullOptions{})
+	if err != nil {
+		return "", err
+	}
+	defer out.Close()
+	if err := drainPull(out, nil); err != nil {
+		return "", err
+	}
+
+	inspectCtx, inspectCancel := context.WithTimeout(ctx, 10*time.Second)
+	defer inspectCancel()
+	inspect, _, err := m.docker().ImageInspectWithRaw(inspectCtx, name)
+	if err != nil {
+		return "", err
+	}
+	return inspect.ID, nil
+}
+
+// setImages replaces the list of images, keeping the status of those still on it.
+func (p *prewarmer) setImages(images []string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.images = p.images[:0:0]
+	status := make(map[string]*PrewarmImage, len(images))
+	for _, name := range images {
+		if _, dup := status[name]; dup {
+			continue
+		}
+		p.images = append(p.images, name)
+		if s, ok := p.status[name]; ok {
+			status[name] = s
+		} else {
+			status[name] = &PrewarmImage{Image: name, State: PrewarmPending}
+		}
+	}
+	p.status = status
+}
+
+// update changes the status of an image unless it was dropped from the list meanwhile.
+func (p *prewarmer) update(name string, change func(*PrewarmImage)) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if s, ok := p.status[name]; ok {
+		change(s)
+	}
+}
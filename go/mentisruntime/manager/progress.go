@@ -0,0 +1,211 @@
+package manager
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Creation steps, reported in order by "creation_progress" observations. Steps that do not
+// apply, such as pulling an image that is present, are skipped.
+const (
+	CreationPending           = "pending" // Accepted, not started yet
+	CreationPullingImage      = "pulling_image"
+	CreationCreatingContainer = "creating_container" // Along with sidecars, volumes and networks
+	CreationStartingContainer = "starting_container"
+	CreationWaitingForAgent   = "waiting_for_agent"
+	CreationRunningSetup      = "running_setup"
+	CreationReady             = "ready"
+	CreationFailed            = "failed"
+)
+
+// creationRetention is how long the progress of a failed creation remains available.
+const creationRetention = 10 * time.Minute
+
+// CreationProgress is how far the creation of a sandbox has got.
+type CreationProgress struct {
+	SandboxID string `json:"sandbox_id"`
+	SpaceID   string `json:"space_id"`
+	Step      string `json:"step"`
+	Image     string `json:"image,omitempty"`
+	Percent   *int   `json:"percent,omitempty"` // Of the image layers downloaded, while pulling
+	Error     string `json:"error,omitempty"`   // Why it failed
+}
+
+// StartSandboxCreation creates a sandbox in the background and returns its ID straight away.
+// Clients follow the creation through the "creation_progress" observations of the sandbox's
+// stream, which accepts them before the sandbox exists, or GetCreationProgress. A failed
+// creation leaves no sandbox behind.
+func (m *SandboxManager) StartSandboxCreation(ctx context.Context, spaceID string, spec SandboxSpec) (string, error) {
+	if _, err := m.spaceManager.GetSpace(ctx, spaceID); err != nil {
+		return "", err
+	}
+	if err := m.checkBudget(spaceID); err != nil {
+		return "", err
+	}
+	sandboxID := uuid.NewString()
+	m.beginCreation(sandboxID, spaceID)
+
+	// The creation outlives the request, but not the runtime; the tenant of ctx carries over.
+	createCtx, cancel := context.WithCancel(context.WithoutCancel(ctx))
+	stop := context.AfterFunc(m.ctx, cancel)
+	m.loops.Go(func() error {
+		defer cancel()
+		defer stop()
+		defer m.recoverPanic("create_sandbox", func(err error) { m.endCreation(sandboxID, err) })
+		if _, err := m.createSandboxWithID(createCtx, spaceID, sandboxID, spec); err != nil {
+			m.logger.Warn("Background sandbox creation failed", "sandboxID", sandboxID, "spaceID", spaceID, "error", err)
+		}
+		return nil
+	})
+	return sandboxID, nil
+}
+
+// GetCreationProgress reports how far the creation of a sandbox of the space has got. Once
+// created, a sandbox is reported at CreationReady.
+func (m *SandboxManager) GetCreationProgress(spaceID, sandboxID string) (*CreationProgress, error) {
+	m.creationsMu.Lock()
+	p, ok := m.creations[sandboxID]
+	if ok {
+		copied := *p
+		p = &copied
+	}
+	m.creationsMu.Unlock()
+	if ok && p.SpaceID == spaceID {
+		return p, nil
+	}
+	state, err := m.sandboxInSpace(spaceID, sandboxID)
+	if err != nil {
+		return nil, err
+	}
+	return &CreationProgress{SandboxID: sandboxID, SpaceID: spaceID, Step: CreationReady, Image: state.Image}, nil
+}
+
+// creationSpace returns the space of a sandbox being created, or recently failed to be.
+func (m *SandboxManager) creationSpace(sandboxID string) (string, bool) {
+	m.creationsMu.Lock()
+	defer m.creationsMu.Unlock()
+	p, ok := m.creations[sandboxID]
+	if !ok {
+		return "", false
+	}
+	return p.SpaceID, true
+}
+
+// beginCreation records a creation about to start, unless already recorded.
+func (m *SandboxManager) beginCreation(sandboxID, spaceID string) {
+	m.creationsMu.Lock()
+	defer m.creationsMu.Unlock()
+	if m.creations == nil {
+		m.creations = make(map[string]*CreationProgress)
+	}
+	if _, ok := m.creations[sandboxID]; !ok {
+		m.creations[sandboxID] = &CreationProgress{SandboxID: sandboxID, SpaceID: spaceID, Step: CreationPending}
+	}
+}
+
+// reportCreation moves a creation to a step, keeping the image once known, and pushes a
+// "creation_progress" observation.
+func (m *SandboxManager) reportCreation(sandboxID, step, image string, percent *int) {
+	m.creationsMu.Lock()
+	p, ok := m.creations[sandboxID]
+	if !ok {
+		m.creationsMu.Unlock()
+		return
+	}
+	p.Step, p.Percent = step, percent
+	if image != "" {
+		p.Image = image
+	}
+	data := *p
+	m.creationsMu.Unlock()
+	m.pushObservation(sandboxID, "", "creation_progress", data)
+}
+
+// endCreation reports the outcome of a creation. A successful one is forgotten, as the
+// sandbox now exists; a failed one is kept for creationRetention.
+func (m *SandboxManager) endCreation(sandboxID string, err error) {
+	m.creationsMu.Lock()
+	p, ok := m.creations[sandboxID]
+	if !ok {
+		m.creationsMu.Unlock()
+		return
+	}
+	p.Percent = nil
+	if err == nil {
+		p.Step = CreationReady
+		delete(m.creations, sandboxID)
+	} else {
+		p.Step, p.Error = CreationFailed, err.Error()
+		time.AfterFunc(creationRetention, func() {
+			m.creationsMu.Lock()
+			defer m.creationsMu.Unlock()
+			delete(m.creations, sandboxID)
+		})
+	}
+	data := *p
+	m.creationsMu.Unlock()
+	m.pushObservation(sandboxID, "", "creation_progress", data)
+}
+
+// drainPull reads the progress stream of an image pull to its end. Unless nil, progress is
+// called with the percentage of the layer bytes downloaded each time it grows by 5 points.
+// Pulls that fail once started, such as on a missing tag, report it in the stream.
+func drainPull(out io.Reader, progress func(percent int)) error {
+	type layer struct{ current, total int64 }
+	layers := map[string]*layer{}
+	reported := 0
+	dec := json.NewDecoder(out)
+	for {
+		var msg struct {
+			ID             string `json:"id"`
+			Status         string `json:"status"`
+			ProgressDetail struct {
+				Current int64 `json:"current"`
+				Total   int64 `json:"total"`
+			} `json:"progressDetail"`
+			Error string `json:"error"`
+		}
+		if err := dec.Decode(&msg); err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		if msg.Error != "" {
+			return errors.New(msg.Error)
+		}
+		if progress == nil || msg.ID == "" {
+			continue
+		}
+		l := layers[msg.ID]
+		if l == nil {
+			l = &layer{}
+			layers[msg.ID] = l
+		}
+		switch msg.Status {
+		case "Downloading":
+			if msg.ProgressDetail.Total > 0 {
+				l.current, l.total = msg.ProgressDetail.Current, msg.ProgressDetail.Total
+			}
+		case "Download complete", "Pull complete":
+			l.current = l.total
+		}
+		var current, total int64
+		for _, l := range layers {
+			current += l.current
+			total += l.total
+		}
+		if total == 0 {
+			continue
+		}
+		// Layers sized later can lower the percentage; only increases are reported.
+		if percent := int(current * 100 / total); percent >= reported+5 || (percent == 100 && reported < 100) {
+			reported = percent
+			progress(percent)
+		}
+	}
+}
@@ -0,0 +1,28 @@
+package manager
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestDrainPull(t *testing.T) {
+	stream := strings.Join([]string{
+		`{"status":"Pulling from library/python","id":"3.12"}`,
+		`{"status":"Pulling fs layer","id":"a"}`,
+		`{"status":"Downloading","progressDetail":{"current":10,"total":100},"id":"a"}`,
+		`{"status":"Downloading","progressDetail":{"current":12,"total":100},"id":"a"}`,
+		`{"status":"Downloading","progressDetail":{"current":50,"total":300},"id":"b"}`,
+		`{"status":"Download complete","id":"a"}`,
+		`{"status":"Download complete","id":"b"}`,
+		`{"status":"Pull complete","id":"b"}`,
+		`{"status":"Status: Downloaded newer image for python:3.12"}`,
+	}, "\n")
+	var reported []int
+	require.NoError(t, drainPull(strings.NewReader(stream), func(percent int) { reported = append(reported, percent) }))
+	require.Equal(t, []int{10, 15, 37, 100}, reported)
+
+	failed := `{"status":"Pulling from library/python","id":"nope"}` + "\n" + `{"error":"manifest unknown"}`
+	require.EqualError(t, drainPull(strings.NewReader(failed), nil), "manifest unknown")
+}
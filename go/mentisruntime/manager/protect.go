@@ -0,0 +1,49 @@
+package manager
+
+import (
+	"context"
+	"fmt"
+)
+
+var (
+	ErrSandboxProtected = newError(KindConflict, "sandbox_protected", "sandbox is protected from deletion")
+	ErrSandboxBusy      = newError(KindConflict, "sandbox_busy", "sandbox has running actions")
+	ErrSpaceProtected   = newError(KindConflict, "space_protected", "space is protected from deletion")
+)
+
+// SetSandboxProtected protects a sandbox from deletion without force, or lifts the protection.
+func (m *SandboxManager) SetSandboxProtected(ctx context.Context, sandboxID string, protected bool) (*SandboxState, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	state, exists := m.sandboxes[sandboxID]
+	if !exists {
+		return nil, ErrSandboxNotFound
+	}
+	state.Protected = protected
+	stateCopy := *state
+	return &stateCopy, nil
+}
+
+// SetSpaceProtected protects a space from deletion without force, or lifts the protection.
+func (sm *SpaceManager) SetSpaceProtected(ctx context.Context, spaceID string, protected bool) error {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+	space, exists := sm.spaces[spaceID]
+	if !exists || !visible(ctx, space) {
+		return ErrSpaceNotFound
+	}
+	space.Protected = protected
+	return nil
+}
+
+// checkDeletableLocked refuses to delete a protected sandbox or one with running actions.
+// Callers must hold m.mu.
+func (m *SandboxManager) checkDeletableLocked(state *SandboxState) error {
+	if state.Protected {
+		return fmt.Errorf("%w: %q", ErrSandboxProtected, state.ID)
+	}
+	if n := m.activeActionCountLocked(state.ID); n > 0 {
+		return fmt.Errorf("%w: %q has %d", ErrSandboxBusy, state.ID, n)
+	}
+	return nil
+}
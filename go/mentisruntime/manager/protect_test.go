@@ -0,0 +1,35 @@
+package manager
+
+import (
+	"context"
+	"log/slog"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestDeleteSandbox_refusesWithoutForce(t *testing.T) {
+	m := &SandboxManager{
+		logger:        slog.Default(),
+		sandboxes:     map[string]*SandboxState{"sb": {ID: "sb", Phase: PhaseReady, IsRunning: true, Protected: true}},
+		activeActions: map[string]string{},
+	}
+	require.ErrorIs(t, m.DeleteSandbox(context.Background(), "sb", false), ErrSandboxProtected)
+
+	_, err := m.SetSandboxProtected(context.Background(), "sb", false)
+	require.NoError(t, err)
+	m.activeActions["action-1"] = "sb"
+	require.ErrorIs(t, m.DeleteSandbox(context.Background(), "sb", false), ErrSandboxBusy)
+	require.Equal(t, PhaseReady, m.sandboxes["sb"].Phase)
+}
+
+func TestSpaceManager_DeleteSpace_protected(t *testing.T) {
+	ctx := context.Background()
+	sm := NewSpaceManager(slog.Default())
+	spaceID, err := sm.CreateSpace(ctx, "work", "", nil)
+	require.NoError(t, err)
+	require.NoError(t, sm.SetSpaceProtected(ctx, spaceID, true))
+
+	require.ErrorIs(t, sm.DeleteSpace(ctx, spaceID, false), ErrSpaceProtected)
+	require.NoError(t, sm.DeleteSpace(ctx, spaceID, true))
+}
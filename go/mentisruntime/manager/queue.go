@@ -0,0 +1,187 @@
+package manager
+
+import (
+	"fmt"
+	"sort"
+)
+
+var ErrTooManyActions = newError(KindQuota, "too_many_actions", "sandbox has too many running actions")
+
+// WithMaxConcurrentActions caps the actions running at once in a sandbox. Beyond it, new
+// actions are rejected with ErrTooManyActions, except in sandboxes in queue mode, which run
+// one action at a time and queue the others. Zero disables the limit.
+func WithMaxConcurrentActions(n int) Option {
+	return func(m *SandboxManager) {
+		m.maxConcurrentActions = n
+	}
+}
+
+// queuedAction is an action ready to be sent to the agent.
+type queuedAction struct {
+	id         string
+	actionType string
+	agentURL   string
+	body       []byte
+	priority   int
+	position   int // Last position reported in a "queued" observation
+}
+
+// actionQueue serializes the actions of a sandbox in queue mode.
+type actionQueue struct {
+	running string          // Action sent to the agent and not ended yet; "" if idle
+	pending []*queuedAction // Highest priority first, FIFO within a priority
+}
+
+// QueuedObservationData is pushed when an action has to wait in its sandbox's queue, and
+// again whenever its position changes. Position 1 runs next.
+type QueuedObservationData struct {
+	Position int `json:"position"`
+	Priority int `json:"priority,omitempty"`
+}
+
+// actionPriority reads the optional integer "priority" of an action payload.
+func actionPriority(payload map[string]interface{}) int {
+	p, _ := payload["priority"].(float64) // JSON numbers
+	return int(p)
+}
+
+// dispatchAction hands an action to the action pool, which sends it to the agent, or holds
+// it back while the host is under pressure. It fails with ErrRuntimeBusy if the pool's queue
+// is full.
+func (m *SandboxManager) dispatchAction(sandboxID string, action *queuedAction) error {
+	if reason := m.underPressure(); reason != "" {
+		m.throttleAction(sandboxID, action, reason)
+		return nil
+	}
+	return m.submitAction(sandboxID, action)
+}
+
+// submitAction hands an action to the action pool.
+func (m *SandboxManager) submitAction(sandboxID string, action *queuedAction) error {
+	m.logger.Debug("Dispatching action", "sandboxID", sandboxID, "actionID", action.id, "actionType", action.actionType)
+	ctx := m.sandboxContext(sandboxID)
+	err := m.trySubmit(m.actionPool, func() {
+		m.handleActionExecution(ctx, sandboxID, action.id, action.agentURL, action.body, action.actionType)
+	})
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrRuntimeBusy, err)
+	}
+	return nil
+}
+
+// startQueued dispatches an action taken from a sandbox's queue. The action was already
+// accepted, so if it cannot be dispatched it ends with an error.
+func (m *SandboxManager) startQueued(sandboxID string, action *queuedAction) {
+	if err := m.dispatchAction(sandboxID, action); err != nil {
+		errMsg := fmt.Sprintf("Action not started: %v", err)
+		m.pushErrorObservation(sandboxID, action.id, errMsg)
+		m.pushEndObservation(sandboxID, action.id, EndObservationData{ExitCode: -1, Error: errMsg})
+	}
+}
+
+// enqueueAction dispatches an action of a sandbox in queue mode if the sandbox is idle, and
+// queues it by priority otherwise.
+func (m *SandboxManager) enqueueAction(sandboxID string, action *queuedAction) {
+	m.mu.Lock()
+	q := m.actionQueues[sandboxID]
+	if q == nil {
+		q = &actionQueue{}
+		m.actionQueues[sandboxID] = q
+	}
+	if q.running == "" {
+		q.running = action.id
+		m.mu.Unlock()
+		m.startQueued(sandboxID, action)
+		return
+	}
+	i := sort.Search(len(q.pending), func(i int) bool { return q.pending[i].priority < action.priority })
+	q.pending = append(q.pending, nil)
+	copy(q.pending[i+1:], q.pending[i:])
+	q.pending[i] = action
+	moved := q.renumber()
+	position, running := action.position, q.running
+	m.mu.Unlock()
+
+	m.logger.Info("Action queued", "sandboxID", sandboxID, "actionID", action.id, "position", position, "running", running)
+	m.pushQueuePositions(sandboxID, moved)
+}
+
+// advanceQueueLocked takes an ended action out of its sandbox's queue and returns the action
+// to run next, if any. Callers must hold m.mu and pass the result to startNext after
+// unlocking.
+func (m *SandboxManager) advanceQueueLocked(sandboxID, actionID string) queueAdvance {
+	q := m.actionQueues[sandboxID]
+	if q == nil {
+		return queueAdvance{}
+	}
+	adv := queueAdvance{sandboxID: sandboxID}
+	if q.running == actionID {
+		q.running = ""
+		if len(q.pending) > 0 {
+			adv.next = q.pending[0]
+			q.pending = q.pending[1:]
+			q.running = adv.next.id
+		}
+	} else {
+		for i, a := range q.pending {
+			if a.id == actionID {
+				q.pending = append(q.pending[:i], q.pending[i+1:]...)
+				break
+			}
+		}
+	}
+	adv.moved = q.renumber()
+	if q.running == "" && len(q.pending) == 0 {
+		delete(m.actionQueues, sandboxID)
+	}
+	return adv
+}
+
+// queueAdvance is the outcome of advanceQueueLocked.
+type queueAdvance struct {
+	sandboxID string
+	next      *queuedAction
+	moved     []queuePosition
+}
+
+// queuePosition is a new position of a pending action, reported after unlocking.
+type queuePosition struct {
+	actionID string
+	data     QueuedObservationData
+}
+
+// startNext dispatches the next queued action and reports the new positions of the others.
+func (m *SandboxManager) startNext(adv queueAdvance) {
+	if adv.next != nil {
+		m.startQueued(adv.sandboxID, adv.next)
+	}
+	m.pushQueuePositions(adv.sandboxID, adv.moved)
+}
+
+// renumber updates the positions of pending actions and returns those that changed.
+func (q *actionQueue) renumber() []queuePosition {
+	var moved []queuePosition
+	for i, a := range q.pending {
+		if a.position != i+1 {
+			a.position = i + 1
+			moved = append(moved, queuePosition{a.id, QueuedObservationData{Position: a.position, Priority: a.priority}})
+		}
+	}
+	return moved
+}
+
+// pushQueuePositions pushes a "queued" observation for each action whose position changed.
+func (m *SandboxManager) pushQueuePositions(sandboxID string, moved []queuePosition) {
+	for _, p := range moved {
+		m.pushObservation(sandboxID, p.actionID, "queued", p.data)
+	}
+}
+
+// queuedActionCountLocked returns the number of actions of a sandbox waiting in its queue.
+// Callers must hold m.mu.
+func (m *SandboxManager) queuedActionCountLocked(sandboxID string) int {
+	if q := m.actionQueues[sandboxID]; q != nil {
+		return len(q.pending)
+	}
+	return 0
+}
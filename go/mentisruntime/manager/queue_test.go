@@ -0,0 +1,70 @@
+package manager
+
+import (
+	"log/slog"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestActionQueue_ordersByPriority(t *testing.T) {
+	m := &SandboxManager{
+		logger:        slog.Default(),
+		activeActions: map[string]string{},
+		actionQueues:  map[string]*actionQueue{"sb": {running: "a"}},
+	}
+	for _, a := range []*queuedAction{{id: "b"}, {id: "c", priority: 5}, {id: "d"}} {
+		m.activeActions[a.id] = "sb"
+		m.enqueueAction("sb", a)
+	}
+	pending := func() (ids []string, positions []int) {
+		for _, a := range m.actionQueues["sb"].pending {
+			ids = append(ids, a.id)
+			positions = append(positions, a.position)
+		}
+		return ids, positions
+	}
+	ids, positions := pending()
+	require.Equal(t, []string{"c", "b", "d"}, ids)
+	require.Equal(t, []int{1, 2, 3}, positions)
+	require.Equal(t, 3, m.queuedActionCountLocked("sb"))
+
+	// A pending action that ends leaves the queue without starting another.
+	adv := m.advanceQueueLocked("sb", "b")
+	require.Nil(t, adv.next)
+	require.Equal(t, []queuePosition{{"d", QueuedObservationData{Position: 2}}}, adv.moved)
+
+	adv = m.advanceQueueLocked("sb", "a")
+	require.Equal(t, "c", adv.next.id)
+	require.Equal(t, "c", m.actionQueues["sb"].running)
+	ids, _ = pending()
+	require.Equal(t, []string{"d"}, ids)
+
+	m.advanceQueueLocked("sb", "c")
+	m.advanceQueueLocked("sb", "d")
+	require.NotContains(t, m.actionQueues, "sb")
+}
+
+func TestActionPriority(t *testing.T) {
+	require.Equal(t, 0, actionPriority(map[string]interface{}{"command": "ls"}))
+	require.Equal(t, 3, actionPriority(map[string]interface{}{"priority": float64(3)}))
+}
+
+func TestInitiateAction_concurrencyLimit(t *testing.T) {
+	m := &SandboxManager{
+		logger:               slog.Default(),
+		sandboxes:            map[string]*SandboxState{"sb": {ID: "sb", IsRunning: true}, "queued": {ID: "queued", IsRunning: true, ActionQueue: true}},
+		activeActions:        map[string]string{"a": "sb", "b": "queued"},
+		actionWaiters:        map[string]chan int{},
+		actionQueues:         map[string]*actionQueue{"queued": {running: "b"}},
+		maxConcurrentActions: 1,
+	}
+	_, err := m.InitiateAction(t.Context(), "sb", "shell", map[string]interface{}{"command": "ls"})
+	require.ErrorIs(t, err, ErrTooManyActions)
+	require.ErrorIs(t, err, ErrQuota)
+
+	// Sandboxes in queue mode queue the action instead.
+	actionID, err := m.InitiateAction(t.Context(), "queued", "shell", map[string]interface{}{"command": "ls"})
+	require.NoError(t, err)
+	require.Equal(t, actionID, m.actionQueues["queued"].pending[0].id)
+}
@@ -0,0 +1,240 @@
+package manager
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/filters"
+
+	"github.com/foreveryh/sandboxai/go/mentisruntime/metrics"
+)
+
+// Policies for containers labelled with our scope that the manager has no record of.
+const (
+	OrphanPolicyAdopt  = "adopt"  // Re-register running orphans, remove the rest
+	OrphanPolicyRemove = "remove" // Remove every orphan
+	OrphanPolicyIgnore = "ignore" // Only report orphans
+)
+
+// orphanGracePeriod protects containers that are still being set up by CreateSandbox.
+const orphanGracePeriod = 2 * time.Minute
+
+var (
+	reconcileRuns = metrics.Default.NewCounter("sandboxai_reconcile_runs_total",
+		"Completed state reconciliation passes.")
+	reconcileDrift = metrics.Default.NewCounterVec("sandboxai_reconcile_drift_total",
+		"Differences found between manager state and Docker, by kind.", "kind")
+	managedSandboxes = metrics.Default.NewGauge("sandboxai_sandboxes",
+		"Sandboxes known to the manager after the last reconciliation.")
+)
+
+// ReconcileReport summarises one reconciliation pass.
+type ReconcileReport struct {
+	Stale          []string `json:"stale,omitempty"`           // Sandboxes whose container is gone
+	StatusFixed    []string `json:"status_fixed,omitempty"`    // Sandboxes whose running flag was corrected
+	OrphansAdopted []string `json:"orphans_adopted,omitempty"` // Container IDs re-registered as sandboxes
+	OrphansRemoved []string `json:"orphans_removed,omitempty"` // Container IDs removed
+	OrphansIgnored []string `json:"orphans_ignored,omitempty"` // Container IDs left alone
+}
+
+// WithReconciler periodically reconciles manager state with the containers labelled with
+// the manager's scope. Container destroy events also trigger a pass.
+func WithReconciler(interval time.Duration, orphanPolicy string) Option {
+	return func(m *SandboxManager) {
+		if orphanPolicy == "" {
+			orphanPolicy = OrphanPolicyAdopt
+		}
+		m.reconcileInterval = interval
+		m.orphanPolicy = orphanPolicy
+	}
+}
+
+// runReconciler reconciles on every tick and whenever a pass is requested, until ctx is done.
+func (m *SandboxManager) runReconciler(ctx context.Context) {
+	ticker := time.NewTicker(m.reconcileInterval)
+	defer ticker.Stop()
+	m.logger.Info("Reconciler started", "interval", m.reconcileInterval, "orphanPolicy", m.orphanPolicy)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-m.reconcileNow:
+		}
+		if _, err := m.Reconcile(ctx); err != nil {
+			m.logger.Error("Reconciliation failed", "error", err)
+		}
+	}
+}
+
+// requestReconcile asks the reconciler for a pass without blocking.
+func (m *SandboxManager) requestReconcile() {
+	select {
+	case m.reconcileNow <- struct{}{}:
+	default:
+	}
+}
+
+// Reconcile compares the manager's sandboxes with the scope's containers and repairs drift.
+func (m *SandboxManager) Reconcile(ctx context.Context) (*ReconcileReport, error) {
+	listCtx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+	containers, err := m.docker().ContainerList(listCtx, container.ListOptions{
+		All:     true,
+		Filters: filters.NewArgs(filters.Arg("label", "sandboxai.scope="+m.scope)),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list scope containers: %w", err)
+	}
+
+	byID := make(map[string]container.Summary, len(containers))
+	for _, c := range containers {
+		byID[c.ID] = c
+	}
+
+	report := &ReconcileReport{}
+	var stale []*SandboxState
+	known := make(map[string]bool)
+	changes := make(map[string]SandboxStateObservationData)
+
+	m.mu.Lock()
+	for id, state := range m.sandboxes {
+		known[state.ContainerID] = true
+		c, ok := byID[state.ContainerID]
+		if !ok {
+			stale = append(stale, state)
+			report.Stale = append(report.Stale, id)
+			continue
+		}
+		if state.IsRunning && c.State != "running" {
+			// Restarts by the health monitor clear IsRunning first, so only this direction is drift.
+			if change, ok := m.transition(state, PhaseStopped, "container_not_running"); ok {
+				changes[id] = change
+			}
+			report.StatusFixed = append(report.StatusFixed, id)
+		}
+	}
+	m.mu.Unlock()
+	for id, change := range changes {
+		m.announcePhase(id, change, true)
+	}
+
+	for _, state := range stale {
+		m.logger.Warn("Removing stale sandbox whose container no longer exists", "sandboxID", state.ID, "containerID", state.ContainerID)
+		m.forgetSandbox(state.ID, state.SpaceID)
+	}
+
+	var sidecars []container.Summary
+	for _, c := range containers {
+		if known[c.ID] || time.Since(time.Unix(c.Created, 0)) < orphanGracePeriod {
+			continue
+		}
+		if c.Labels["sandboxai.sidecar-of"] != "" {
+			sidecars = append(sidecars, c)
+			continue
+		}
+		m.handleOrphan(ctx, c, report)
+	}
+	// Sidecars are judged after adoption, so those of adopted sandboxes are kept.
+	for _, c := range sidecars {
+		if !m.isLiveSidecar(c.Labels) {
+			m.handleOrphan(ctx, c, report)
+		}
+	}
+
+	reconcileRuns.Inc()
+	reconcileDrift.With("stale").Add(int64(len(report.Stale)))
+	reconcileDrift.With("status").Add(int64(len(report.StatusFixed)))
+	reconcileDrift.With("orphan_adopted").Add(int64(len(report.OrphansAdopted)))
+	reconcileDrift.With("orphan_removed").Add(int64(len(report.OrphansRemoved)))
+	reconcileDrift.With("orphan_ignored").Add(int64(len(report.OrphansIgnored)))
+	m.mu.RLock()
+	managedSandboxes.Set(int64(len(m.sandboxes)))
+	m.mu.RUnlock()
+
+	if len(report.Stale)+len(report.StatusFixed)+len(report.OrphansAdopted)+len(report.OrphansRemoved) > 0 {
+		m.logger.Info("Reconciliation repaired drift", "stale", len(report.Stale), "statusFixed", len(report.StatusFixed),
+			"adopted", len(report.OrphansAdopted), "removed", len(report.OrphansRemoved))
+	}
+	return report, nil
+}
+
+// handleOrphan applies the orphan policy to a container the manager has no record of.
+func (m *SandboxManager) handleOrphan(ctx context.Context, c container.Summary, report *ReconcileReport) {
+	if m.orphanPolicy == OrphanPolicyIgnore || m.orphanPolicy == "" {
+		// No reconciler; passes after a reconnection to Docker only verify known sandboxes
+		report.OrphansIgnored = append(report.OrphansIgnored, c.ID)
+		return
+	}
+	if m.orphanPolicy == OrphanPolicyAdopt && m.adoptContainer(ctx, c) {
+		report.OrphansAdopted = append(report.OrphansAdopted, c.ID)
+		return
+	}
+
+	m.logger.Warn("Removing orphaned sandbox container", "containerID", c.ID, "sandboxID", c.Labels["sandboxai.id"])
+	rmCtx, cancel := context.WithTimeout(ctx, 15*time.Second)
+	defer cancel()
+	if err := m.docker().ContainerRemove(rmCtx, c.ID, container.RemoveOptions{Force: true}); err != nil {
+		m.logger.Error("Failed to remove orphaned container", "containerID", c.ID, "error", err)
+		return
+	}
+	report.OrphansRemoved = append(report.OrphansRemoved, c.ID)
+}
+
+// adoptContainer re-registers a running orphan whose space still exists and whose agent answers.
+func (m *SandboxManager) adoptContainer(ctx context.Context, c container.Summary) bool {
+	sandboxID := c.Labels["sandboxai.id"]
+	spaceID := c.Labels["sandboxai.space"]
+	if sandboxID == "" || spaceID == "" || c.State != "running" {
+		return false
+	}
+	if _, err := m.spaceManager.GetSpace(ctx, spaceID); err != nil {
+		return false
+	}
+	var agentURL string
+	for _, p := range c.Ports {
+		if p.PrivatePort == 8000 && p.PublicPort != 0 {
+			agentURL = fmt.Sprintf("http://localhost:%d", p.PublicPort)
+			break
+		}
+	}
+	if agentURL == "" || m.probeAgent(ctx, agentURL) != nil {
+		return false
+	}
+
+	state := &SandboxState{
+		ID:          sandboxID,
+		Name:        c.Labels["sandboxai.name"],
+		ContainerID: c.ID,
+		AgentURL:    agentURL,
+		Phase:       PhaseReady,
+		IsRunning:   true,
+		SpaceID:     spaceID,
+		Image:       c.Image,
+		Health:      HealthHealthy,
+		ClonedFrom:  c.Labels["sandboxai.clone-of"],
+		Network:     c.HostConfig.NetworkMode,
+		Hostname:    m.spaceHostname(c, sandboxID, spaceID),
+		Platform:    c.Labels["sandboxai.platform"],
+		Labels:      userLabels(c.Labels),
+		setupHash:   c.Labels["sandboxai.setup-hash"],
+	}
+	m.attachContext(state)
+	m.mu.Lock()
+	if _, exists := m.sandboxes[sandboxID]; exists {
+		m.mu.Unlock()
+		return false
+	}
+	m.sandboxes[sandboxID] = state
+	m.mu.Unlock()
+	m.assignStream(sandboxID, spaceID)
+	if err := m.spaceManager.addSandboxToSpace(spaceID, sandboxID, state); err != nil {
+		m.logger.Error("Failed to add adopted sandbox to space", "spaceID", spaceID, "sandboxID", sandboxID, "error", err)
+	}
+	m.followContainerLogs(sandboxID, spaceID, c.ID, time.Now())
+	m.logger.Info("Adopted orphaned sandbox container", "sandboxID", sandboxID, "containerID", c.ID, "agentURL", agentURL)
+	return true
+}
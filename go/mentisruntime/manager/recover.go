@@ -0,0 +1,76 @@
+package manager
+
+import (
+	"context"
+	"fmt"
+	"runtime/debug"
+	"time"
+
+	"github.com/foreveryh/sandboxai/go/mentisruntime/metrics"
+)
+
+// loopRestartDelay is how long a background loop that panicked waits before it runs again.
+const loopRestartDelay = time.Second
+
+var goroutinePanics = metrics.Default.NewCounterVec("sandboxai_goroutine_panics_total",
+	"Panics recovered in the manager's goroutines, which would otherwise end the process, by goroutine.", "goroutine")
+
+// recoverPanic, deferred at the top of a goroutine, recovers a panic of the goroutine and
+// logs it with its stack, so that one failing goroutine does not end the runtime. onPanic,
+// if non-nil, is then called with the panic as an error, to clean up after the goroutine.
+func (m *SandboxManager) recoverPanic(goroutine string, onPanic func(err error)) {
+	p := recover()
+	if p == nil {
+		return
+	}
+	goroutinePanics.With(goroutine).Inc()
+	err := fmt.Errorf("panic: %v", p)
+	m.logger.Error("Recovered from panic", "goroutine", goroutine, "error", err, "stack", string(debug.Stack()))
+	if onPanic != nil {
+		onPanic(err)
+	}
+}
+
+// goSafe runs f on a new goroutine that recovers from panics.
+func (m *SandboxManager) goSafe(goroutine string, f func()) {
+	go func() {
+		defer m.recoverPanic(goroutine, nil)
+		f()
+	}()
+}
+
+// background runs a loop that returns when the manager's context ends. A loop that panics
+// is run again after loopRestartDelay.
+func (m *SandboxManager) background(name string, loop func(context.Context)) {
+	m.loops.Go(func() error {
+		for m.runLoop(name, loop) && m.ctx.Err() == nil {
+			select {
+			case <-m.ctx.Done():
+			case <-time.After(loopRestartDelay):
+			}
+		}
+		return nil
+	})
+}
+
+// runLoop runs a background loop and reports whether it panicked.
+func (m *SandboxManager) runLoop(name string, loop func(context.Context)) (panicked bool) {
+	defer m.recoverPanic(name, func(error) {
+		panicked = true
+		m.logger.Warn("Restarting background loop after panic", "loop", name, "delay", loopRestartDelay)
+	})
+	loop(m.ctx)
+	return false
+}
+
+// abortAction ends an action whose goroutine panicked, unless it has ended already.
+func (m *SandboxManager) abortAction(sandboxID, actionID string, err error) {
+	m.mu.RLock()
+	_, active := m.activeActions[actionID]
+	m.mu.RUnlock()
+	errMsg := fmt.Sprintf("Action failed: internal error: %v", err)
+	m.pushErrorObservation(sandboxID, actionID, errMsg)
+	if active {
+		m.pushEndObservation(sandboxID, actionID, EndObservationData{ExitCode: -1, Error: errMsg})
+	}
+}
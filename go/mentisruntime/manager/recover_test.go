@@ -0,0 +1,45 @@
+package manager
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/foreveryh/sandboxai/go/mentisruntime/workpool"
+)
+
+func TestBackground_restartsLoopAfterPanic(t *testing.T) {
+	ctx, cancel := context.WithCancel(t.Context())
+	m := &SandboxManager{ctx: ctx, logger: slog.New(slog.NewTextHandler(io.Discard, nil))}
+	var runs atomic.Int32
+	m.background("test", func(ctx context.Context) {
+		if runs.Add(1) == 1 {
+			panic("boom")
+		}
+		<-ctx.Done()
+	})
+	require.Eventually(t, func() bool { return runs.Load() == 2 }, 5*time.Second, 10*time.Millisecond)
+	cancel()
+	m.loops.Wait()
+	require.EqualValues(t, 2, runs.Load())
+}
+
+func TestSubmit_recoversPanickingTask(t *testing.T) {
+	pool := workpool.New("test-panics", 1, 1)
+	defer pool.Close()
+	m := &SandboxManager{logger: slog.New(slog.NewTextHandler(io.Discard, nil))}
+
+	require.NoError(t, m.submit(t.Context(), pool, func() { panic("boom") }))
+	done := make(chan struct{})
+	require.NoError(t, m.submit(t.Context(), pool, func() { close(done) }))
+	select {
+	case <-done: // The worker survived the panic
+	case <-time.After(5 * time.Second):
+		t.Fatal("task after a panicking one did not run")
+	}
+}
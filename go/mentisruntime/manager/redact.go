@@ -0,0 +1,46 @@
+package manager
+
+import (
+	"regexp"
+
+	"github.com/foreveryh/sandboxai/go/mentisruntime/redact"
+)
+
+// sensitiveEnvName matches the names of sandbox env vars whose values are masked like secrets.
+var sensitiveEnvName = regexp.MustCompile(`(?i)(key|token|secret|password|passwd|credential|auth)`)
+
+// WithRedactor masks what r matches in observations, before they are recorded in the history,
+// streamed to clients or written to sandbox logs. The values of stored secrets, and of sandbox
+// env vars named like credentials, are added to r as they become known.
+func WithRedactor(r *redact.Redactor) Option {
+	return func(m *SandboxManager) {
+		m.redactor = r
+	}
+}
+
+// loadSecretValues adds the values of the stored secrets to the redactor.
+func (m *SandboxManager) loadSecretValues() {
+	if m.redactor == nil || m.secretStore == nil {
+		return
+	}
+	for _, s := range m.secretStore.All() {
+		value, err := m.secretStore.Value(s.Tenant, s.Name)
+		if err != nil {
+			m.logger.Warn("Failed to read secret for redaction", "name", s.Name, "error", err)
+			continue
+		}
+		m.redactor.AddValue(value)
+	}
+}
+
+// redactEnv adds the values of env vars named like credentials to the redactor.
+func (m *SandboxManager) redactEnv(env map[string]string) {
+	if m.redactor == nil {
+		return
+	}
+	for name, value := range env {
+		if sensitiveEnvName.MatchString(name) {
+			m.redactor.AddValue(value)
+		}
+	}
+}
@@ -0,0 +1,388 @@
+package manager
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"hash"
+	"strconv"
+	"time"
+)
+
+var (
+	ErrReplayNotFound      = newError(KindNotFound, "replay_not_found", "the sandbox was not created by a replay")
+	ErrRecordingIncomplete = newError(KindConflict, "recording_incomplete", "the sandbox ran more actions than were recorded")
+	ErrEmptyRecording      = newError(KindInvalid, "empty_recording", "the sandbox has no finished actions to replay")
+	ErrSetupUnknown        = newError(KindConflict, "setup_unknown", "the setup commands of the sandbox are not known to this runtime")
+)
+
+// maxRecordedActions caps the actions recorded per sandbox. A sandbox that ran more cannot
+// be replayed.
+const maxRecordedActions = 1000
+
+// Replay statuses.
+const (
+	ReplayRunning  = "running"
+	ReplayMatched  = "matched"  // Every action ended with the recorded exit code and output
+	ReplayDiverged = "diverged" // Some action did not
+	ReplayFailed   = "failed"   // The replay sandbox went away before the replay finished
+)
+
+// RecordedAction is an action issued against a sandbox, as recorded for replays. Setup
+// commands are not recorded: replays run them when creating their sandbox.
+type RecordedAction struct {
+	ActionID   string                 `json:"action_id"`
+	ActionType string                 `json:"action_type"` // "shell" or "ipython"
+	Payload    map[string]interface{} `json:"payload"`     // The fields sent to the agent
+	IssuedAt   time.Time              `json:"issued_at"`
+	ExitCode   *int                   `json:"exit_code,omitempty"` // Unset while the action runs
+	// Digest is the SHA-256 of the action's "stream" lines, in order and by stream, and of
+	// its exit code. Lines past the output limits are not part of it.
+	Digest   string `json:"digest,omitempty"`
+	CacheHit bool   `json:"cache_hit,omitempty"`
+}
+
+// Recording lists the actions issued against a sandbox, in the order they were issued.
+type Recording struct {
+	SandboxID string           `json:"sandbox_id"`
+	Actions   []RecordedAction `json:"actions"`
+	Truncated bool             `json:"truncated,omitempty"` // More than maxRecordedActions were issued
+}
+
+// actionRecording holds the recorded actions of a sandbox.
+type actionRecording struct {
+	actions   []*RecordedAction
+	truncated bool
+}
+
+// ReplayStep is a recorded action and how its replay went.
+type ReplayStep struct {
+	RecordedAction
+	ReplayActionID string `json:"replay_action_id,omitempty"`
+	ReplayExitCode *int   `json:"replay_exit_code,omitempty"`
+	ReplayDigest   string `json:"replay_digest,omitempty"`
+	Match          *bool  `json:"match,omitempty"` // Same exit code and digest; unset until the step ends
+	Error          string `json:"error,omitempty"` // Why the step did not end
+}
+
+// Replay runs the recorded actions of a sandbox, one at a time in the order they were
+// issued, in a fresh sandbox created from the same image ID with the same settings and setup
+// commands, and compares their observation digests with the recorded ones.
+type Replay struct {
+	SandboxID       string        `json:"sandbox_id"` // The fresh sandbox
+	SourceSandboxID string        `json:"source_sandbox_id"`
+	Image           string        `json:"image"` // Image ID both sandboxes run
+	Status          string        `json:"status"`
+	DivergedAt      *int          `json:"diverged_at,omitempty"` // Index of the first step that did not match
+	Steps           []*ReplayStep `json:"steps"`
+	CreatedAt       time.Time     `json:"created_at"`
+	FinishedAt      *time.Time    `json:"finished_at,omitempty"`
+}
+
+// ReplayStepObservationData is the data payload of a "replay_step" observation.
+type ReplayStepObservationData struct {
+	SourceSandboxID string `json:"source_sandbox_id"`
+	Step            int    `json:"step"`
+	SourceActionID  string `json:"source_action_id"`
+	Match           bool   `json:"match"`
+	Error           string `json:"error,omitempty"`
+}
+
+// ReplayEndObservationData is the data payload of a "replay_end" observation.
+type ReplayEndObservationData struct {
+	SourceSandboxID string `json:"source_sandbox_id"`
+	Status          string `json:"status"`
+	DivergedAt      *int   `json:"diverged_at,omitempty"`
+}
+
+// digestLine adds a "stream" line of an action to its observation digest.
+func digestLine(h hash.Hash, stream, line string) {
+	h.Write([]byte(stream))
+	h.Write([]byte{0})
+	h.Write([]byte(strconv.Itoa(len(line))))
+	h.Write([]byte{0})
+	h.Write([]byte(line))
+}
+
+// digestSum returns the observation digest of an action that ended with exitCode.
+func digestSum(h hash.Hash, exitCode int) string {
+	h.Write([]byte("exit\x00" + strconv.Itoa(exitCode)))
+	return "sha256:" + hex.EncodeToString(h.Sum(nil))
+}
+
+// startRecordLocked starts recording an action of a sandbox and digesting its output. The
+// record is added to the sandbox's recording by recordAction once the action is issued.
+// Callers must hold m.mu.
+func (m *SandboxManager) startRecordLocked(actionID, actionType string, payload map[string]interface{}) *RecordedAction {
+	record := &RecordedAction{ActionID: actionID, ActionType: actionType, Payload: agentFieldsOf(payload), IssuedAt: time.Now().UTC()}
+	if m.actionStreams == nil {
+		m.actionStreams = make(map[string]*actionStreams)
+	}
+	s := m.actionStreams[actionID]
+	if s == nil {
+		s = &actionStreams{}
+		m.actionStreams[actionID] = s
+	}
+	s.recordedAction, s.digest = record, sha256.New()
+	return record
+}
+
+// finishRecordLocked sets the exit code and digest of a recorded action that ended. Callers
+// must hold m.mu.
+func (m *SandboxManager) finishRecordLocked(actionID string, exitCode int) {
+	s := m.actionStreams[actionID]
+	if s == nil || s.recordedAction == nil {
+		return
+	}
+	s.recordedAction.ExitCode = &exitCode
+	s.recordedAction.Digest = digestSum(s.digest, exitCode)
+}
+
+// recordAction adds an issued action to the recording of its sandbox.
+func (m *SandboxManager) recordAction(sandboxID string, record *RecordedAction) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, exists := m.sandboxes[sandboxID]; !exists {
+		return
+	}
+	if m.recordings == nil {
+		m.recordings = make(map[string]*actionRecording)
+	}
+	rec := m.recordings[sandboxID]
+	if rec == nil {
+		rec = &actionRecording{}
+		m.recordings[sandboxID] = rec
+	}
+	if len(rec.actions) >= maxRecordedActions {
+		rec.truncated = true
+		return
+	}
+	rec.actions = append(rec.actions, record)
+}
+
+// cachedRecord returns the record of an action answered from the result cache.
+func cachedRecord(actionID, actionType string, payload map[string]interface{}, result *cachedResult) *RecordedAction {
+	h := sha256.New()
+	for _, l := range result.lines {
+		digestLine(h, l.stream, l.line)
+	}
+	exitCode := result.end.ExitCode
+	return &RecordedAction{
+		ActionID:   actionID,
+		ActionType: actionType,
+		Payload:    agentFieldsOf(payload),
+		IssuedAt:   time.Now().UTC(),
+		ExitCode:   &exitCode,
+		Digest:     digestSum(h, exitCode),
+		CacheHit:   true,
+	}
+}
+
+// GetRecording returns the actions issued against a sandbox.
+func (m *SandboxManager) GetRecording(ctx context.Context, sandboxID string) (*Recording, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	if _, exists := m.sandboxes[sandboxID]; !exists {
+		return nil, ErrSandboxNotFound
+	}
+	recording := &Recording{SandboxID: sandboxID, Actions: []RecordedAction{}}
+	if rec := m.recordings[sandboxID]; rec != nil {
+		for _, action := range rec.actions {
+			recording.Actions = append(recording.Actions, *action)
+		}
+		recording.Truncated = rec.truncated
+	}
+	return recording, nil
+}
+
+// ReplaySandbox creates a sandbox in targetSpaceID (the source's space if empty) from the
+// image ID of a sandbox, with its settings and setup commands, and replays the source's
+// finished actions into it in the background. Actions still running are left out, and so are
+// changes made through other endpoints, such as file uploads.
+func (m *SandboxManager) ReplaySandbox(ctx context.Context, sandboxID, targetSpaceID string) (*Replay, error) {
+	m.mu.RLock()
+	source, exists := m.sandboxes[sandboxID]
+	var src SandboxState
+	var steps []*ReplayStep
+	truncated := false
+	if exists {
+		src = *source
+		if rec := m.recordings[sandboxID]; rec != nil {
+			truncated = rec.truncated
+			for _, action := range rec.actions {
+				if action.ExitCode != nil {
+					steps = append(steps, &ReplayStep{RecordedAction: *action})
+				}
+			}
+		}
+	}
+	m.mu.RUnlock()
+	if !exists {
+		return nil, ErrSandboxNotFound
+	}
+	if truncated {
+		return nil, ErrRecordingIncomplete
+	}
+	if len(steps) == 0 {
+		return nil, ErrEmptyRecording
+	}
+	if src.setupHash != "" && src.setup == nil {
+		return nil, ErrSetupUnknown // Adopted after a runtime restart; only the hash is labeled
+	}
+	if targetSpaceID == "" {
+		targetSpaceID = src.SpaceID
+	}
+
+	imageID, err := m.imageIDOf(ctx, sandboxID)
+	if err != nil {
+		return nil, err
+	}
+	replayID, err := m.CreateSandbox(ctx, targetSpaceID, SandboxSpec{
+		Image:           imageID,
+		Env:             src.Env,
+		Secrets:         src.Secrets,
+		SecurityProfile: src.SecurityProfile,
+		SeccompProfile:  src.SeccompProfile,
+		AppArmorProfile: src.AppArmorProfile,
+		Tmpfs:           src.Tmpfs,
+		DiskLimit:       src.DiskLimit,
+		Ulimits:         src.Ulimits,
+		Workdir:         src.Workdir,
+		Command:         src.Command,
+		Entrypoint:      src.Entrypoint,
+		DNS:             src.DNS,
+		DNSSearch:       src.DNSSearch,
+		ExtraHosts:      src.ExtraHosts,
+		Network:         src.Network,
+		IPv6:            src.IPv6,
+		Platform:        src.Platform,
+		Sidecars:        sidecarSpecs(src.Sidecars),
+		Volumes:         src.Volumes,
+		PrivateNetworks: src.PrivateNetworks,
+		User:            src.User,
+		Labels:          src.Labels,
+		ActionQueue:     src.ActionQueue,
+		Jupyter:         src.Jupyter,
+		Setup:           src.setup,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	replay := &Replay{
+		SandboxID:       replayID,
+		SourceSandboxID: sandboxID,
+		Image:           imageID,
+		Status:          ReplayRunning,
+		Steps:           steps,
+		CreatedAt:       time.Now().UTC(),
+	}
+	m.mu.Lock()
+	if m.replays == nil {
+		m.replays = make(map[string]*Replay)
+	}
+	m.replays[replayID] = replay
+	snapshot := replay.snapshot()
+	m.mu.Unlock()
+
+	m.logger.Info("Replay started", "sourceSandboxID", sandboxID, "sandboxID", replayID, "actions", len(steps))
+	m.goSafe("replay", func() { m.runReplay(context.Background(), replay) })
+	return snapshot, nil
+}
+
+// GetReplay returns the replay that a sandbox was created by.
+func (m *SandboxManager) GetReplay(ctx context.Context, sandboxID string) (*Replay, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	if _, exists := m.sandboxes[sandboxID]; !exists {
+		return nil, ErrSandboxNotFound
+	}
+	replay, exists := m.replays[sandboxID]
+	if !exists {
+		return nil, ErrReplayNotFound
+	}
+	return replay.snapshot(), nil
+}
+
+// snapshot deep-copies the replay. Callers must hold m.mu.
+func (r *Replay) snapshot() *Replay {
+	replayCopy := *r
+	replayCopy.Steps = make([]*ReplayStep, len(r.Steps))
+	for i, step := range r.Steps {
+		stepCopy := *step
+		replayCopy.Steps[i] = &stepCopy
+	}
+	return &replayCopy
+}
+
+func (m *SandboxManager) runReplay(ctx context.Context, replay *Replay) {
+	status := ReplayMatched
+	for i, step := range replay.Steps {
+		actionID, exitCode, err := m.runReplayStep(ctx, replay.SandboxID, step)
+		match := false
+		m.mu.Lock()
+		step.ReplayActionID = actionID
+		if err != nil {
+			step.Error = err.Error()
+		} else {
+			step.ReplayExitCode = &exitCode
+			if s := m.recordings[replay.SandboxID]; s != nil {
+				for _, action := range s.actions {
+					if action.ActionID == actionID {
+						step.ReplayDigest = action.Digest
+					}
+				}
+			}
+			match = exitCode == *step.ExitCode && step.ReplayDigest == step.Digest
+		}
+		step.Match = &match
+		if !match && replay.DivergedAt == nil {
+			index := i
+			replay.DivergedAt = &index
+			status = ReplayDiverged
+		}
+		_, alive := m.sandboxes[replay.SandboxID]
+		m.mu.Unlock()
+
+		m.pushObservation(replay.SandboxID, actionID, "replay_step", ReplayStepObservationData{
+			SourceSandboxID: replay.SourceSandboxID, Step: i, SourceActionID: step.ActionID, Match: match, Error: step.Error,
+		})
+		if !alive {
+			status = ReplayFailed
+			break
+		}
+	}
+
+	m.mu.Lock()
+	finishedAt := time.Now().UTC()
+	replay.Status = status
+	replay.FinishedAt = &finishedAt
+	divergedAt := replay.DivergedAt
+	m.mu.Unlock()
+
+	m.logger.Info("Replay finished", "sourceSandboxID", replay.SourceSandboxID, "sandboxID", replay.SandboxID, "status", status)
+	m.pushObservation(replay.SandboxID, "", "replay_end", ReplayEndObservationData{
+		SourceSandboxID: replay.SourceSandboxID, Status: status, DivergedAt: divergedAt,
+	})
+}
+
+// runReplayStep runs a recorded action in the replay sandbox and waits for its exit code.
+// Named IPython kernels the action uses are created first.
+func (m *SandboxManager) runReplayStep(ctx context.Context, sandboxID string, step *ReplayStep) (string, int, error) {
+	if step.ActionType == "ipython" {
+		if kernelID := actionKernelOf(step.Payload); kernelID != DefaultKernel {
+			if _, err := m.CreateKernel(ctx, sandboxID, kernelID); err != nil && !errors.Is(err, ErrKernelExists) {
+				return "", 0, err
+			}
+		}
+	}
+	// Actions answered from the result cache run for real: replays check reproducibility
+	done := make(chan int, 1)
+	actionID, err := m.initiateAction(ctx, sandboxID, step.ActionType, step.Payload, done)
+	if err != nil {
+		return "", 0, err
+	}
+	exitCode, err := m.awaitAction(ctx, sandboxID, actionID, done, DefaultStepTimeout)
+	return actionID, exitCode, err
+}
@@ -0,0 +1,283 @@
+package manager
+
+import (
+	"container/list"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/foreveryh/sandboxai/go/mentisruntime/history"
+	"github.com/foreveryh/sandboxai/go/mentisruntime/metrics"
+)
+
+var resultCacheLookups = metrics.Default.NewCounterVec("sandboxai_result_cache_lookups_total",
+	"Lookups of cached action results, by result (hit or miss).", "result")
+
+var ErrResultCacheDisabled = newError(KindUnavailable, "result_cache_disabled", "result caching is not enabled on this runtime")
+
+// runtimeActionFields are the action payload fields the runtime handles itself. They are
+// not sent to the agent and are not part of an action's cache key.
+var runtimeActionFields = map[string]bool{
+	"priority":  true, // Action queue
+	"coalesce":  true, // Coalescer
+	"metadata":  true, // Observations
+	"aggregate": true, // "end" observation
+	"cache":     true, // Result cache
+}
+
+// WithResultCache keeps the results of actions run with "cache": true, up to maxBytes of
+// output, so that an identical action on a sandbox of the same image and setup returns the
+// result instead of running again. The least recently used results are evicted first.
+func WithResultCache(maxBytes int64) Option {
+	return func(m *SandboxManager) {
+		if maxBytes > 0 {
+			m.resultCache = &resultCache{maxBytes: maxBytes, entries: make(map[string]*list.Element), lru: list.New()}
+		}
+	}
+}
+
+// resultCache holds the results of successful cached actions, keyed by resultKey.
+type resultCache struct {
+	mu       sync.Mutex
+	maxBytes int64
+	size     int64
+	entries  map[string]*list.Element
+	lru      *list.List // Of *cachedResult, most recently used first
+}
+
+// cachedResult is the output and "end" data of an action, without aggregates.
+type cachedResult struct {
+	key      string
+	lines    []cachedLine
+	end      EndObservationData
+	bytes    int64
+	storedAt time.Time
+}
+
+type cachedLine struct {
+	stream string
+	line   string
+}
+
+// cachedStreamObservation is a "stream" observation replayed from the cache.
+type cachedStreamObservation struct {
+	ObservationType string `json:"observation_type"`
+	ActionID        string `json:"action_id"`
+	Timestamp       string `json:"timestamp"`
+	Stream          string `json:"stream"`
+	Line            string `json:"line"`
+	StreamSeq       uint64 `json:"stream_seq"`
+}
+
+func (c *resultCache) get(key string) *cachedResult {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	elem, ok := c.entries[key]
+	if !ok {
+		return nil
+	}
+	c.lru.MoveToFront(elem)
+	return elem.Value.(*cachedResult)
+}
+
+func (c *resultCache) put(result *cachedResult) {
+	if result.bytes > c.maxBytes {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if elem, ok := c.entries[result.key]; ok {
+		c.size -= elem.Value.(*cachedResult).bytes
+		c.lru.Remove(elem)
+	}
+	c.entries[result.key] = c.lru.PushFront(result)
+	c.size += result.bytes
+	for c.size > c.maxBytes {
+		oldest := c.lru.Back()
+		evicted := c.lru.Remove(oldest).(*cachedResult)
+		delete(c.entries, evicted.key)
+		c.size -= evicted.bytes
+	}
+}
+
+// setupHashOf returns the hash of a sandbox's setup commands, or "" if it has none.
+func setupHashOf(setup []string) string {
+	if len(setup) == 0 {
+		return ""
+	}
+	sum := sha256.Sum256([]byte(strings.Join(setup, "\x00")))
+	return hex.EncodeToString(sum[:])
+}
+
+// resultKey returns the cache key of an action: the hash of the sandbox's image ID, setup,
+// environment, secret references, working directory and user, and of the action's type and
+// agent fields. The image ID is read from the container once.
+func (m *SandboxManager) resultKey(ctx context.Context, sandboxID, actionType string, payload map[string]interface{}) (string, error) {
+	imageID, err := m.imageIDOf(ctx, sandboxID)
+	if err != nil {
+		return "", err
+	}
+	m.mu.RLock()
+	state, exists := m.sandboxes[sandboxID]
+	var key []interface{}
+	if exists {
+		key = []interface{}{imageID, state.setupHash, state.Env, state.Secrets, state.Workdir, state.User, actionType, agentFieldsOf(payload)}
+	}
+	m.mu.RUnlock()
+	if !exists {
+		return "", ErrSandboxNotFound
+	}
+	h := sha256.New()
+	if err := json.NewEncoder(h).Encode(key); err != nil { // Map keys are sorted, so equal actions encode equally
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// imageIDOf returns the ID of the image a sandbox's container runs, read from the
+// container on first use.
+func (m *SandboxManager) imageIDOf(ctx context.Context, sandboxID string) (string, error) {
+	m.mu.RLock()
+	state, exists := m.sandboxes[sandboxID]
+	var imageID, containerID string
+	if exists {
+		imageID, containerID = state.imageID, state.ContainerID
+	}
+	m.mu.RUnlock()
+	if !exists {
+		return "", ErrSandboxNotFound
+	}
+	if imageID != "" {
+		return imageID, nil
+	}
+	info, err := m.docker().ContainerInspect(ctx, containerID)
+	if err != nil {
+		return "", backendError("inspect_failed", "failed to inspect sandbox container", err)
+	}
+	m.mu.Lock()
+	state.imageID = info.Image
+	m.mu.Unlock()
+	return info.Image, nil
+}
+
+// agentFieldsOf returns the fields of an action payload that are sent to the agent.
+func agentFieldsOf(payload map[string]interface{}) map[string]interface{} {
+	fields := make(map[string]interface{}, len(payload))
+	for k, v := range payload {
+		if !runtimeActionFields[k] {
+			fields[k] = v
+		}
+	}
+	return fields
+}
+
+// lookupResult returns the cache key of an action run with "cache": true and its cached
+// result, if there is one.
+func (m *SandboxManager) lookupResult(ctx context.Context, sandboxID, actionType string, payload map[string]interface{}) (string, *cachedResult, error) {
+	if m.resultCache == nil {
+		return "", nil, ErrResultCacheDisabled
+	}
+	key, err := m.resultKey(ctx, sandboxID, actionType, payload)
+	if err != nil {
+		return "", nil, err
+	}
+	if result := m.resultCache.get(key); result != nil {
+		resultCacheLookups.With("hit").Inc()
+		return key, result, nil
+	}
+	resultCacheLookups.With("miss").Inc()
+	return key, nil, nil
+}
+
+// startRecordingLocked makes the stream output of an action be kept for the result cache
+// under key. Callers must hold m.mu.
+func (m *SandboxManager) startRecordingLocked(actionID, key string) {
+	s := m.actionStreams[actionID]
+	if s == nil {
+		s = &actionStreams{}
+		m.actionStreams[actionID] = s
+	}
+	s.cacheKey = key
+}
+
+// record keeps a stream observation for the result cache, if the action is cached. Actions
+// with binary, cut or more than maxAggregateBytes of output are not cached.
+func (s *actionStreams) record(obs *internalObservation) {
+	if s.cacheKey == "" || s.uncacheable {
+		return
+	}
+	if obs.Line == nil || obs.Encoding == EncodingBase64 || obs.Truncated || s.cachedBytes+len(*obs.Line) > maxAggregateBytes {
+		s.uncacheable, s.lines = true, nil
+		return
+	}
+	s.lines = append(s.lines, cachedLine{stream: obs.Stream, line: *obs.Line})
+	s.cachedBytes += len(*obs.Line)
+}
+
+// skipResultCache keeps the result of an action out of the cache: it had output the cache
+// cannot replay, such as rich IPython output, or output dropped by the output limits.
+func (m *SandboxManager) skipResultCache(actionID string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if s := m.actionStreams[actionID]; s != nil && s.cacheKey != "" {
+		s.uncacheable, s.lines = true, nil
+	}
+}
+
+// storeResult caches the result of an action whose output was recorded. Only actions that
+// succeeded are cached.
+func (m *SandboxManager) storeResult(s *actionStreams, data EndObservationData) {
+	if m.resultCache == nil || s.uncacheable || data.ExitCode != 0 || data.Error != "" || data.Signal != "" || data.OOMKilled {
+		return
+	}
+	data.Output, data.Stdout, data.Stderr, data.OutputTruncated = nil, nil, nil, false
+	m.resultCache.put(&cachedResult{key: s.cacheKey, lines: s.lines, end: data, bytes: int64(s.cachedBytes), storedAt: time.Now()})
+}
+
+// replayResult answers an action from the cache: it sends "start", the cached "stream"
+// observations and an "end" flagged with cache_hit under actionID, as if the action had run.
+// The agent is not involved.
+func (m *SandboxManager) replayResult(sandboxID, actionID string, payload map[string]interface{}, result *cachedResult, done chan int) {
+	metadata := actionMetadataOf(payload)
+	aggregate, _ := payload["aggregate"].(string)
+	replay := func() {
+		if metadata != nil {
+			m.setActionMetadata(actionID, metadata)
+			defer m.setActionMetadata(actionID, nil)
+		}
+		m.pushObservation(sandboxID, actionID, "start", StartObservationData{})
+		streams := &actionStreams{aggregate: aggregate, seq: make(map[string]uint64)}
+		for _, l := range result.lines {
+			streams.seq[l.stream]++
+			streams.add(l.stream, l.line)
+			now := time.Now().UTC()
+			message, err := json.Marshal(cachedStreamObservation{
+				ObservationType: "stream",
+				ActionID:        actionID,
+				Timestamp:       now.Format(time.RFC3339Nano),
+				Stream:          l.stream,
+				Line:            l.line,
+				StreamSeq:       streams.seq[l.stream],
+			})
+			if err != nil {
+				continue
+			}
+			m.sendObservation(sandboxID, history.Meta{ObservationType: "stream", ActionID: actionID, Timestamp: now}, message)
+		}
+		data := result.end
+		data.CacheHit = true
+		streams.fill(&data)
+		m.pushObservation(sandboxID, actionID, "end", data)
+		if done != nil {
+			done <- data.ExitCode
+		}
+	}
+	if err := m.submit(m.sandboxContext(sandboxID), m.observationPool, replay); err != nil {
+		replay()
+	}
+	m.logger.Info("Action answered from result cache", "sandboxID", sandboxID, "actionID", actionID, "cachedAt", result.storedAt)
+}
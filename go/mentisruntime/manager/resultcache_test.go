@@ -0,0 +1,31 @@
+package manager
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestResultCache_evictsLeastRecentlyUsed(t *testing.T) {
+	m := &SandboxManager{}
+	WithResultCache(10)(m)
+	c := m.resultCache
+	c.put(&cachedResult{key: "a", bytes: 4})
+	c.put(&cachedResult{key: "b", bytes: 4})
+	require.NotNil(t, c.get("a")) // Now more recently used than b
+	c.put(&cachedResult{key: "c", bytes: 4})
+	require.Nil(t, c.get("b"))
+	require.NotNil(t, c.get("a"))
+	require.NotNil(t, c.get("c"))
+	require.Equal(t, int64(8), c.size)
+
+	c.put(&cachedResult{key: "big", bytes: 11}) // Larger than the cache
+	require.Nil(t, c.get("big"))
+	require.NotNil(t, c.get("a"))
+}
+
+func TestSetupHashOf(t *testing.T) {
+	require.Empty(t, setupHashOf(nil))
+	require.Equal(t, setupHashOf([]string{"pip install x"}), setupHashOf([]string{"pip install x"}))
+	require.NotEqual(t, setupHashOf([]string{"a b"}), setupHashOf([]string{"a", "b"}))
+}
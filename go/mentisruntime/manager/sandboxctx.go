@@ -0,0 +1,43 @@
+package manager
+
+import (
+	"context"
+	"errors"
+)
+
+// errSandboxDeleted is the cause of the cancellation of a deleted sandbox's requests.
+var errSandboxDeleted = errors.New("sandbox deleted")
+
+// attachContext gives a new sandbox its context, a child of the manager's, before the
+// sandbox is registered.
+func (m *SandboxManager) attachContext(state *SandboxState) {
+	parent := m.ctx
+	if parent == nil {
+		parent = context.Background()
+	}
+	state.ctx, state.cancel = context.WithCancelCause(parent)
+}
+
+// sandboxContext returns the context bounding a sandbox's agent requests. It is already
+// canceled if the sandbox is gone.
+func (m *SandboxManager) sandboxContext(sandboxID string) context.Context {
+	m.mu.RLock()
+	state, exists := m.sandboxes[sandboxID]
+	m.mu.RUnlock()
+	if !exists {
+		ctx, cancel := context.WithCancelCause(context.Background())
+		cancel(errSandboxDeleted)
+		return ctx
+	}
+	if state.ctx == nil {
+		return context.Background()
+	}
+	return state.ctx
+}
+
+// cancelRequests ends the in-flight agent requests of a sandbox being deleted.
+func (state *SandboxState) cancelRequests() {
+	if state.cancel != nil {
+		state.cancel(errSandboxDeleted)
+	}
+}
@@ -0,0 +1,42 @@
+package manager
+
+import (
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCancelRequests_endsInFlightActions(t *testing.T) {
+	release := make(chan struct{})
+	agent := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release // An agent that never answers
+	}))
+	defer agent.Close()
+	defer close(release)
+
+	state := &SandboxState{ID: "sb", AgentURL: agent.URL, IsRunning: true}
+	m := &SandboxManager{
+		logger:        slog.Default(),
+		actionClient:  agent.Client(),
+		sandboxes:     map[string]*SandboxState{"sb": state},
+		activeActions: map[string]string{},
+		actionWaiters: map[string]chan int{},
+	}
+	m.attachContext(state)
+
+	done := make(chan int, 1)
+	_, err := m.initiateAction(t.Context(), "sb", "shell", map[string]interface{}{"command": "sleep 1000"}, done)
+	require.NoError(t, err)
+
+	state.cancelRequests()
+	select {
+	case exitCode := <-done:
+		require.Equal(t, -1, exitCode)
+	case <-time.After(5 * time.Second):
+		t.Fatal("action did not end after its sandbox was canceled")
+	}
+}
@@ -0,0 +1,178 @@
+package manager
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/foreveryh/sandboxai/go/mentisruntime/cron"
+)
+
+var ErrScheduleNotFound = newError(KindNotFound, "schedule_not_found", "schedule not found")
+
+// schedulerTick is how often the scheduler looks for due schedules.
+const schedulerTick = time.Second
+
+// Schedule runs an action in a sandbox whenever its cron expression fires. Each run is an
+// ordinary action whose observations go to the sandbox stream, along with a
+// "schedule_triggered" observation linking the action ID to the schedule.
+type Schedule struct {
+	ID           string                 `json:"schedule_id"`
+	SandboxID    string                 `json:"sandbox_id"`
+	Cron         string                 `json:"cron"`
+	Timezone     string                 `json:"timezone,omitempty"` // IANA name; empty means UTC
+	ActionType   string                 `json:"action_type"`        // "shell" or "ipython"
+	Payload      map[string]interface{} `json:"payload"`
+	CreatedAt    time.Time              `json:"created_at"`
+	NextRunAt    time.Time              `json:"next_run_at"`
+	LastRunAt    *time.Time             `json:"last_run_at,omitempty"`
+	LastActionID string                 `json:"last_action_id,omitempty"`
+	LastError    string                 `json:"last_error,omitempty"` // Why the last run could not start
+	RunCount     int                    `json:"run_count"`
+
+	expr     *cron.Schedule
+	location *time.Location
+}
+
+// ScheduleTriggeredObservationData is the data payload of a "schedule_triggered" observation.
+type ScheduleTriggeredObservationData struct {
+	ScheduleID string `json:"schedule_id"`
+}
+
+// CreateSchedule registers a recurring action on a sandbox.
+func (m *SandboxManager) CreateSchedule(ctx context.Context, sandboxID, cronExpr, timezone, actionType string, payload map[string]interface{}) (*Schedule, error) {
+	expr, err := cron.Parse(cronExpr)
+	if err != nil {
+		return nil, &Error{Kind: KindInvalid, Code: "invalid_cron", Message: "invalid cron expression", Err: err}
+	}
+	location := time.UTC
+	if timezone != "" {
+		if location, err = time.LoadLocation(timezone); err != nil {
+			return nil, &Error{Kind: KindInvalid, Code: "invalid_timezone", Message: "invalid timezone", Err: err}
+		}
+	}
+	if actionType != "shell" && actionType != "ipython" {
+		return nil, &Error{Kind: KindInvalid, Code: "unsupported_action_type", Message: "unsupported action type: " + actionType}
+	}
+	nextRun := expr.Next(time.Now().In(location))
+	if nextRun.IsZero() {
+		return nil, newError(KindInvalid, "invalid_cron", "cron expression never fires")
+	}
+
+	schedule := &Schedule{
+		ID:         uuid.NewString(),
+		SandboxID:  sandboxID,
+		Cron:       cronExpr,
+		Timezone:   timezone,
+		ActionType: actionType,
+		Payload:    payload,
+		CreatedAt:  time.Now().UTC(),
+		NextRunAt:  nextRun.UTC(),
+		expr:       expr,
+		location:   location,
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, exists := m.sandboxes[sandboxID]; !exists {
+		return nil, ErrSandboxNotFound
+	}
+	if m.schedules[sandboxID] == nil {
+		m.schedules[sandboxID] = make(map[string]*Schedule)
+	}
+	m.schedules[sandboxID][schedule.ID] = schedule
+
+	m.logger.Info("Schedule created", "sandboxID", sandboxID, "scheduleID", schedule.ID, "cron", cronExpr, "nextRunAt", schedule.NextRunAt)
+	scheduleCopy := *schedule
+	return &scheduleCopy, nil
+}
+
+// ListSchedules returns the schedules of a sandbox.
+func (m *SandboxManager) ListSchedules(ctx context.Context, sandboxID string) ([]*Schedule, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	if _, exists := m.sandboxes[sandboxID]; !exists {
+		return nil, ErrSandboxNotFound
+	}
+	schedules := make([]*Schedule, 0, len(m.schedules[sandboxID]))
+	for _, s := range m.schedules[sandboxID] {
+		scheduleCopy := *s
+		schedules = append(schedules, &scheduleCopy)
+	}
+	return schedules, nil
+}
+
+// DeleteSchedule stops and removes a schedule. Runs already started are not affected.
+func (m *SandboxManager) DeleteSchedule(ctx context.Context, sandboxID, scheduleID string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, exists := m.sandboxes[sandboxID]; !exists {
+		return ErrSandboxNotFound
+	}
+	if _, exists := m.schedules[sandboxID][scheduleID]; !exists {
+		return ErrScheduleNotFound
+	}
+	delete(m.schedules[sandboxID], scheduleID)
+	if len(m.schedules[sandboxID]) == 0 {
+		delete(m.schedules, sandboxID)
+	}
+	m.logger.Info("Schedule deleted", "sandboxID", sandboxID, "scheduleID", scheduleID)
+	return nil
+}
+
+func (m *SandboxManager) runScheduler(ctx context.Context) {
+	ticker := time.NewTicker(schedulerTick)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			m.runDueSchedules(ctx, now)
+		}
+	}
+}
+
+// runDueSchedules starts the action of every schedule whose next run time has passed.
+// Runs missed while the runtime was busy are not caught up; the schedule just moves on.
+func (m *SandboxManager) runDueSchedules(ctx context.Context, now time.Time) {
+	var due []Schedule
+	m.mu.Lock()
+	for _, schedules := range m.schedules {
+		for _, s := range schedules {
+			if s.NextRunAt.IsZero() || now.Before(s.NextRunAt) {
+				continue
+			}
+			due = append(due, *s)
+			s.NextRunAt = s.expr.Next(now.In(s.location)).UTC()
+		}
+	}
+	m.mu.Unlock()
+
+	for _, s := range due {
+		actionID, err := m.InitiateAction(ctx, s.SandboxID, s.ActionType, s.Payload)
+		if err != nil {
+			m.logger.Warn("Scheduled action could not start", "sandboxID", s.SandboxID, "scheduleID", s.ID, "error", err)
+		} else {
+			m.logger.Info("Scheduled action started", "sandboxID", s.SandboxID, "scheduleID", s.ID, "actionID", actionID)
+			m.pushObservation(s.SandboxID, actionID, "schedule_triggered", ScheduleTriggeredObservationData{ScheduleID: s.ID})
+		}
+
+		m.mu.Lock()
+		if stored, ok := m.schedules[s.SandboxID][s.ID]; ok {
+			runAt := now.UTC()
+			stored.LastRunAt = &runAt
+			stored.RunCount++
+			stored.LastActionID = actionID
+			stored.LastError = ""
+			if err != nil {
+				stored.LastError = err.Error()
+			}
+		}
+		m.mu.Unlock()
+	}
+}
@@ -0,0 +1,173 @@
+package manager
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Kinds of search results.
+const (
+	SearchResultSpace   = "space"
+	SearchResultSandbox = "sandbox"
+)
+
+// ErrEmptySearch is returned by Search for a query without text.
+var ErrEmptySearch = newError(KindInvalid, "empty_search", "search text must not be empty")
+
+// Search result limits.
+const (
+	DefaultSearchLimit = 50
+	MaxSearchLimit     = 500
+)
+
+// SearchQuery selects the spaces and sandboxes returned by Search.
+type SearchQuery struct {
+	Text  string   // Matched case-insensitively against names, IDs, labels, metadata values and images
+	Types []string // SearchResultSpace and/or SearchResultSandbox; both if empty
+	Limit int      // DefaultSearchLimit if zero
+}
+
+// SearchResult is a space or sandbox matching a query, with the field that matched best.
+type SearchResult struct {
+	Type      string `json:"type"` // SearchResultSpace or SearchResultSandbox
+	SpaceID   string `json:"space_id"`
+	SandboxID string `json:"sandbox_id,omitempty"`
+	Name      string `json:"name,omitempty"`
+	Field     string `json:"field"` // Such as "name", "labels.run" or "metadata.owner"
+	Value     string `json:"value"` // The matching value of Field
+	Rank      int    `json:"rank"`  // Higher is better
+}
+
+// Weights of the fields a search matches, so a matching name ranks above a matching image.
+const (
+	searchWeightName        = 4
+	searchWeightLabel       = 3
+	searchWeightMetadata    = 2
+	searchWeightImage       = 2
+	searchWeightDescription = 1
+)
+
+// Search returns the spaces and sandboxes of the context's tenant that match a query, best
+// first. A field matches if it equals the text (3 points), starts with it (2) or contains it
+// (1); the rank is that score times the weight of the field.
+func (m *SandboxManager) Search(ctx context.Context, q SearchQuery) ([]SearchResult, error) {
+	text := strings.ToLower(strings.TrimSpace(q.Text))
+	if text == "" {
+		return nil, ErrEmptySearch
+	}
+	limit := q.Limit
+	if limit <= 0 {
+		limit = DefaultSearchLimit
+	}
+	wants := func(kind string) bool {
+		if len(q.Types) == 0 {
+			return true
+		}
+		for _, t := range q.Types {
+			if t == kind {
+				return true
+			}
+		}
+		return false
+	}
+
+	spaces, err := m.spaceManager.ListSpaces(ctx)
+	if err != nil {
+		return nil, err
+	}
+	visibleSpaces := make(map[string]bool, len(spaces))
+	results := []SearchResult{}
+	for _, space := range spaces {
+		visibleSpaces[space.ID] = true
+		if !wants(SearchResultSpace) {
+			continue
+		}
+		var s searchScorer
+		s.match(text, "id", space.ID, searchWeightName)
+		s.match(text, "name", space.Name, searchWeightName)
+		s.match(text, "description", space.Description, searchWeightDescription)
+		s.matchMetadata(text, "metadata", space.Metadata)
+		if s.rank > 0 {
+			results = append(results, SearchResult{Type: SearchResultSpace, SpaceID: space.ID, Name: space.Name, Field: s.field, Value: s.value, Rank: s.rank})
+		}
+	}
+
+	if wants(SearchResultSandbox) {
+		m.mu.RLock()
+		for id, state := range m.sandboxes {
+			if !visibleSpaces[state.SpaceID] {
+				continue
+			}
+			var s searchScorer
+			s.match(text, "id", id, searchWeightName)
+			s.match(text, "name", state.Name, searchWeightName)
+			s.match(text, "hostname", state.Hostname, searchWeightName)
+			for k, v := range state.Labels {
+				s.match(text, "labels."+k, k+"="+v, searchWeightLabel)
+				s.match(text, "labels."+k, v, searchWeightLabel)
+			}
+			s.match(text, "image", state.Image, searchWeightImage)
+			if s.rank > 0 {
+				results = append(results, SearchResult{Type: SearchResultSandbox, SpaceID: state.SpaceID, SandboxID: id, Name: state.Name, Field: s.field, Value: s.value, Rank: s.rank})
+			}
+		}
+		m.mu.RUnlock()
+	}
+
+	sort.Slice(results, func(i, j int) bool {
+		a, b := results[i], results[j]
+		if a.Rank != b.Rank {
+			return a.Rank > b.Rank
+		}
+		if a.Type != b.Type {
+			return a.Type > b.Type // Spaces first
+		}
+		if a.SpaceID != b.SpaceID {
+			return a.SpaceID < b.SpaceID
+		}
+		return a.SandboxID < b.SandboxID
+	})
+	if len(results) > limit {
+		results = results[:limit]
+	}
+	return results, nil
+}
+
+// searchScorer keeps the best matching field of a search candidate.
+type searchScorer struct {
+	rank         int
+	field, value string
+}
+
+func (s *searchScorer) match(text, field, value string, weight int) {
+	lower := strings.ToLower(value)
+	score := 0
+	switch {
+	case value == "":
+	case lower == text:
+		score = 3
+	case strings.HasPrefix(lower, text):
+		score = 2
+	case strings.Contains(lower, text):
+		score = 1
+	}
+	// Ties go to the first field by name, since labels and metadata are maps
+	if rank := score * weight; rank > s.rank || (rank > 0 && rank == s.rank && field < s.field) {
+		s.rank, s.field, s.value = rank, field, value
+	}
+}
+
+// matchMetadata matches the string, number and boolean values of metadata, recursing into
+// nested objects.
+func (s *searchScorer) matchMetadata(text, field string, metadata map[string]interface{}) {
+	for k, v := range metadata {
+		switch v := v.(type) {
+		case map[string]interface{}:
+			s.matchMetadata(text, field+"."+k, v)
+		case string, float64, int, bool:
+			s.match(text, field+"."+k, fmt.Sprint(v), searchWeightMetadata)
+		}
+	}
+}
@@ -0,0 +1,52 @@
+package manager
+
+import (
+	"context"
+	"log/slog"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSearch(t *testing.T) {
+	sm := NewSpaceManager(slog.Default())
+	acme := WithTenant(context.Background(), "acme")
+	other := WithTenant(context.Background(), "other")
+	research, err := sm.CreateSpace(acme, "research", "Model evaluation runs", map[string]interface{}{"team": map[string]interface{}{"owner": "eval-team"}})
+	require.NoError(t, err)
+	hidden, err := sm.CreateSpace(other, "eval", "", nil)
+	require.NoError(t, err)
+	m := &SandboxManager{
+		spaceManager: sm,
+		sandboxes: map[string]*SandboxState{
+			"sb-1": {ID: "sb-1", SpaceID: research, Name: "eval", Image: "python:3.12"},
+			"sb-2": {ID: "sb-2", SpaceID: research, Image: "eval-runner:latest", Labels: map[string]string{"run": "evaluation-7"}},
+			"sb-3": {ID: "sb-3", SpaceID: research, Image: "ubuntu"},
+			"sb-4": {ID: "sb-4", SpaceID: hidden, Name: "eval"},
+		},
+	}
+
+	results, err := m.Search(acme, SearchQuery{Text: "EVAL"})
+	require.NoError(t, err)
+	require.Equal(t, []SearchResult{
+		{Type: SearchResultSandbox, SpaceID: research, SandboxID: "sb-1", Name: "eval", Field: "name", Value: "eval", Rank: 12},
+		{Type: SearchResultSandbox, SpaceID: research, SandboxID: "sb-2", Field: "labels.run", Value: "evaluation-7", Rank: 6},
+		{Type: SearchResultSpace, SpaceID: research, Name: "research", Field: "metadata.team.owner", Value: "eval-team", Rank: 4},
+	}, results)
+
+	results, err = m.Search(acme, SearchQuery{Text: "eval", Types: []string{SearchResultSpace}})
+	require.NoError(t, err)
+	require.Len(t, results, 1)
+	results, err = m.Search(acme, SearchQuery{Text: "eval", Limit: 1})
+	require.NoError(t, err)
+	require.Equal(t, "sb-1", results[0].SandboxID)
+	require.Len(t, results, 1)
+
+	// Without a tenant, all spaces are searched
+	results, err = m.Search(context.Background(), SearchQuery{Text: "eval", Types: []string{SearchResultSandbox}})
+	require.NoError(t, err)
+	require.Len(t, results, 3)
+
+	_, err = m.Search(acme, SearchQuery{Text: "  "})
+	require.ErrorIs(t, err, ErrEmptySearch)
+}
@@ -0,0 +1,164 @@
+package manager
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/docker/docker/api/types/container"
+
+	"github.com/foreveryh/sandboxai/go/mentisruntime/secret"
+)
+
+var ErrSecretsDisabled = newError(KindUnavailable, "secrets_disabled", "secret store not configured")
+
+// defaultSecretDir is where secrets are mounted when a reference asks for a file without a path.
+const defaultSecretDir = "/run/secrets"
+
+// SecretRef references a stored secret from a sandbox spec. The value is injected as an
+// environment variable (Env), a file (File), or both. With neither set, it is exposed as an
+// environment variable named after the secret.
+type SecretRef struct {
+	Name string `json:"name"`
+	Env  string `json:"env,omitempty"`
+	File string `json:"file,omitempty"`
+}
+
+// WithSecretStore enables /v1/secrets and secret references on sandbox creation.
+func WithSecretStore(store *secret.Store) Option {
+	return func(m *SandboxManager) {
+		m.secretStore = store
+	}
+}
+
+// PutSecret delegates to the secret store. Secrets belong to the tenant of ctx, and only
+// sandboxes in that tenant's spaces can reference them.
+func (m *SandboxManager) PutSecret(ctx context.Context, name, value, description string) (*secret.Secret, error) {
+	if m.secretStore == nil {
+		return nil, ErrSecretsDisabled
+	}
+	meta, err := m.secretStore.Put(TenantFromContext(ctx), name, value, description)
+	if err != nil {
+		return nil, secretError(err)
+	}
+	m.redactor.AddValue(value)
+	m.logger.Info("Secret stored", "name", name)
+	return meta, nil
+}
+
+// GetSecret delegates to the secret store. Only metadata is returned.
+func (m *SandboxManager) GetSecret(ctx context.Context, name string) (*secret.Secret, error) {
+	if m.secretStore == nil {
+		return nil, ErrSecretsDisabled
+	}
+	meta, err := m.secretStore.Get(TenantFromContext(ctx), name)
+	if err != nil {
+		return nil, secretError(err)
+	}
+	return meta, nil
+}
+
+// ListSecrets delegates to the secret store. Only metadata is returned.
+func (m *SandboxManager) ListSecrets(ctx context.Context) ([]*secret.Secret, error) {
+	if m.secretStore == nil {
+		return nil, ErrSecretsDisabled
+	}
+	return m.secretStore.List(TenantFromContext(ctx)), nil
+}
+
+// DeleteSecret delegates to the secret store. Running sandboxes keep the value they were created with.
+func (m *SandboxManager) DeleteSecret(ctx context.Context, name string) error {
+	if m.secretStore == nil {
+		return ErrSecretsDisabled
+	}
+	if err := m.secretStore.Delete(TenantFromContext(ctx), name); err != nil {
+		return secretError(err)
+	}
+	m.logger.Info("Secret deleted", "name", name)
+	return nil
+}
+
+// secretError classifies errors from the secret store.
+func secretError(err error) error {
+	switch {
+	case errors.Is(err, secret.ErrNotFound):
+		return &Error{Kind: KindNotFound, Code: "secret_not_found", Message: "secret not found"}
+	case errors.Is(err, secret.ErrInvalidName):
+		return &Error{Kind: KindInvalid, Code: "invalid_secret_name", Message: "invalid secret name: use 1-128 characters from [A-Za-z0-9_.-]"}
+	default:
+		return err
+	}
+}
+
+// resolveSecrets decrypts the referenced secrets of a tenant, the owner of the sandbox's
+// space, and returns the env entries and files (container path -> content) to inject.
+func (m *SandboxManager) resolveSecrets(tenant string, refs []SecretRef) ([]string, map[string][]byte, error) {
+	if len(refs) == 0 {
+		return nil, nil, nil
+	}
+	if m.secretStore == nil {
+		return nil, nil, ErrSecretsDisabled
+	}
+
+	var env []string
+	files := make(map[string][]byte)
+	for _, ref := range refs {
+		value, err := m.secretStore.Value(tenant, ref.Name)
+		if err != nil {
+			// A dangling reference is a bad request, not a missing resource.
+			return nil, nil, &Error{Kind: KindInvalid, Code: "unknown_secret", Message: fmt.Sprintf("secret %q", ref.Name), Err: secretError(err)}
+		}
+		m.redactor.AddValue(value)
+		if name, ok := secretEnvName(ref); ok {
+			env = append(env, name+"="+value)
+		}
+		if ref.File != "" {
+			filePath := ref.File
+			if !m.platform.isAbs(filePath) {
+				filePath = m.platform.joinPath(m.platform.secretDir(), filePath)
+			}
+			files[filePath] = []byte(value)
+		}
+	}
+	return env, files, nil
+}
+
+// secretEnvName returns the environment variable a secret reference sets, if any: Env, or
+// the secret's name for references that set neither a variable nor a file.
+func secretEnvName(ref SecretRef) (string, bool) {
+	if ref.Env == "" && ref.File == "" {
+		return ref.Name, true
+	}
+	return ref.Env, ref.Env != ""
+}
+
+// injectSecretFiles copies secret files into a created (not yet started) container, owned by
+// its user so that sandboxes not running as root can read them.
+func (m *SandboxManager) injectSecretFiles(ctx context.Context, containerID string, files map[string][]byte) error {
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	for filePath, content := range files {
+		hdr := &tar.Header{
+			Name: m.platform.archivePath(filePath),
+			Mode: 0o400,
+			Size: int64(len(content)),
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			return fmt.Errorf("failed to write secret archive: %w", err)
+		}
+		if _, err := tw.Write(content); err != nil {
+			return fmt.Errorf("failed to write secret archive: %w", err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return fmt.Errorf("failed to write secret archive: %w", err)
+	}
+	// Docker resolves the container's user in its /etc/passwd; Windows files have no owner.
+	opts := container.CopyToContainerOptions{CopyUIDGID: !m.platform.windows()}
+	if err := m.docker().CopyToContainer(ctx, containerID, "/", &buf, opts); err != nil {
+		return fmt.Errorf("failed to copy secret files into container: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,171 @@
+package manager
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/docker/docker/api/types/container"
+)
+
+var (
+	ErrUnknownSecurityProfile      = newError(KindInvalid, "unknown_security_profile", "unknown security profile")
+	ErrIncompatibleSecurityProfile = newError(KindInvalid, "incompatible_security_profile", "request is incompatible with security profile")
+	ErrActionUserNotAllowed        = newError(KindInvalid, "action_user_not_allowed", "security profile does not allow actions to run as this user")
+)
+
+const (
+	SecurityProfileDefault  = "default"
+	SecurityProfileHardened = "hardened"
+)
+
+// SecurityProfile describes the container hardening applied to a sandbox.
+type SecurityProfile struct {
+	Name            string            `json:"name"`
+	ReadonlyRootfs  bool              `json:"readonly_rootfs,omitempty"`
+	CapDrop         []string          `json:"cap_drop,omitempty"`
+	CapAdd          []string          `json:"cap_add,omitempty"`
+	NoNewPrivileges bool              `json:"no_new_privileges,omitempty"`
+	Seccomp         string            `json:"-"`              // Seccomp profile JSON; empty keeps Docker's default profile
+	User            string            `json:"user,omitempty"` // uid[:gid]; empty runs as the image user
+	Tmpfs           map[string]string `json:"tmpfs,omitempty"`
+	AppArmor        string            `json:"apparmor,omitempty"` // AppArmor profile name; empty keeps Docker's default
+	// ActionUsers are the users actions may ask the agent to run them as, or "*" for any.
+	// Switching users needs an agent running as root with CAP_SETUID.
+	ActionUsers []string `json:"action_users,omitempty"`
+	// Ulimits are the defaults of the sandbox's ulimits. Specs can override them, but not
+	// above their hard limits.
+	Ulimits map[string]Ulimit `json:"ulimits,omitempty"`
+}
+
+// securityProfiles returns the built-in profiles. seccompJSON, if set, is used by the hardened profile.
+func securityProfiles(seccompJSON string) map[string]SecurityProfile {
+	return map[string]SecurityProfile{
+		SecurityProfileDefault: {Name: SecurityProfileDefault, ActionUsers: []string{"*"}},
+		SecurityProfileHardened: {
+			Name:            SecurityProfileHardened,
+			ReadonlyRootfs:  true,
+			CapDrop:         []string{"ALL"},
+			NoNewPrivileges: true,
+			Seccomp:         seccompJSON,
+			User:            "65534:65534", // nobody
+			// Without capabilities the agent cannot switch users: actions only name its own
+			ActionUsers: []string{"nobody", "65534", "65534:65534"},
+			// The agent and user code still need scratch space.
+			Tmpfs: map[string]string{
+				"/tmp":  "rw,nosuid,nodev,size=256m",
+				"/work": "rw,nosuid,nodev,size=1g,uid=65534,gid=65534",
+			},
+			// Stop fork bombs and fd exhaustion at the container; nproc is shared by every
+			// sandbox running as nobody on the host.
+			Ulimits: map[string]Ulimit{
+				UlimitNofile: {Soft: 1024, Hard: 4096},
+				UlimitNproc:  {Soft: 4096, Hard: 4096},
+				UlimitCore:   {Soft: 0, Hard: 0},
+			},
+		},
+	}
+}
+
+// WithDefaultSecurityProfile selects the profile used when a create request does not name one.
+func WithDefaultSecurityProfile(name string) Option {
+	return func(m *SandboxManager) {
+		m.defaultSecurityProfile = name
+	}
+}
+
+// WithSeccompProfile sets the seccomp profile (JSON document) used by the hardened profile.
+func WithSeccompProfile(profileJSON string) Option {
+	return func(m *SandboxManager) {
+		m.seccompProfile = profileJSON
+	}
+}
+
+// resolveSecurityProfile looks up a profile by name, falling back to the configured default.
+func (m *SandboxManager) resolveSecurityProfile(name string) (SecurityProfile, error) {
+	if name == "" {
+		name = m.defaultSecurityProfile
+	}
+	if name == "" {
+		name = SecurityProfileDefault
+	}
+	profile, ok := securityProfiles(m.seccompProfile)[name]
+	if !ok {
+		return SecurityProfile{}, fmt.Errorf("%w: %s", ErrUnknownSecurityProfile, name)
+	}
+	return profile, nil
+}
+
+// apply maps the profile onto the container configuration.
+func (p SecurityProfile) apply(cfg *container.Config, hostCfg *container.HostConfig) {
+	hostCfg.ReadonlyRootfs = p.ReadonlyRootfs
+	hostCfg.CapDrop = append(hostCfg.CapDrop, p.CapDrop...)
+	hostCfg.CapAdd = append(hostCfg.CapAdd, p.CapAdd...)
+	if p.NoNewPrivileges {
+		hostCfg.SecurityOpt = append(hostCfg.SecurityOpt, "no-new-privileges:true")
+	}
+	if p.Seccomp != "" {
+		hostCfg.SecurityOpt = append(hostCfg.SecurityOpt, "seccomp="+p.Seccomp)
+	}
+	if p.AppArmor != "" {
+		hostCfg.SecurityOpt = append(hostCfg.SecurityOpt, "apparmor="+p.AppArmor)
+	}
+	if len(p.Tmpfs) > 0 {
+		if hostCfg.Tmpfs == nil {
+			hostCfg.Tmpfs = make(map[string]string)
+		}
+		for mountPath, opts := range p.Tmpfs {
+			hostCfg.Tmpfs[mountPath] = opts
+		}
+	}
+	if p.User != "" {
+		cfg.User = p.User
+		// Non-root users typically have no writable home directory in the box image.
+		if !hasEnv(cfg.Env, "HOME") {
+			cfg.Env = append(cfg.Env, "HOME=/tmp")
+		}
+	}
+}
+
+// checkActionUser returns an error unless the security profile of a sandbox lets an action
+// run as the user it asks for in its "user" field. Any user ("*") is only allowed while the
+// agent runs as root, as otherwise it could not switch to them.
+func (m *SandboxManager) checkActionUser(state *SandboxState, payload map[string]interface{}) error {
+	user, _ := payload["user"].(string)
+	if user == "" {
+		return nil
+	}
+	profile, err := m.resolveSecurityProfile(state.SecurityProfile)
+	if err != nil {
+		return err
+	}
+	agentUser := state.User
+	if profile.User != "" {
+		agentUser = profile.User
+	}
+	switch {
+	case user == agentUser || slices.Contains(profile.ActionUsers, user):
+		return nil
+	case slices.Contains(profile.ActionUsers, "*") && isRootUser(agentUser):
+		return nil
+	case slices.Contains(profile.ActionUsers, "*"):
+		return fmt.Errorf("%w: %q: the agent runs as %q, not root", ErrActionUserNotAllowed, user, agentUser)
+	}
+	return fmt.Errorf("%w: %q with profile %q", ErrActionUserNotAllowed, user, profile.Name)
+}
+
+// isRootUser reports whether a container user ("user", "uid" or "uid:gid") is root. Empty
+// keeps the image default, which is root for the box image.
+func isRootUser(user string) bool {
+	name, _, _ := strings.Cut(user, ":")
+	return name == "" || name == "root" || name == "0"
+}
+
+func hasEnv(env []string, key string) bool {
+	for _, kv := range env {
+		if strings.HasPrefix(kv, key+"=") {
+			return true
+		}
+	}
+	return false
+}
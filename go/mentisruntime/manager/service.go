@@ -0,0 +1,119 @@
+package manager
+
+import (
+	"context"
+	"sync"
+)
+
+// SubscriptionBuffer is the number of observations a subscription holds for a receiver that
+// has not read them yet. A subscription whose buffer is full is closed.
+const SubscriptionBuffer = 256
+
+// SandboxService is the sandbox lifecycle and actions of a runtime. SandboxManager implements
+// it over Docker; programs that embed the runtime call it in-process instead of over HTTP,
+// and may substitute another backend behind it.
+type SandboxService interface {
+	CreateSpace(ctx context.Context, name string, description string, metadata map[string]interface{}) (string, error)
+	GetSpace(ctx context.Context, spaceID string) (*SpaceState, error)
+	DeleteSpace(ctx context.Context, spaceID string, force bool) error
+
+	// CreateSandbox creates a sandbox in a space and returns its ID once its agent answers.
+	CreateSandbox(ctx context.Context, spaceID string, spec SandboxSpec) (string, error)
+	GetSandbox(ctx context.Context, sandboxID string) (*SandboxState, error)
+	DeleteSandbox(ctx context.Context, sandboxID string, force bool) error
+
+	// InitiateAction starts an action ("shell" or "ipython") and returns its ID. Its output
+	// arrives as observations on the sandbox's stream.
+	InitiateAction(ctx context.Context, sandboxID string, actionType string, payload map[string]interface{}) (string, error)
+
+	// StreamObservations returns the observations broadcast on a sandbox's stream from now
+	// on, as the JSON messages WebSocket clients receive. The channel is closed when ctx is
+	// done, the sandbox is deleted, or the receiver falls SubscriptionBuffer observations
+	// behind. Subscribe before initiating an action to receive all of its observations.
+	StreamObservations(ctx context.Context, sandboxID string) (<-chan []byte, error)
+}
+
+var _ SandboxService = (*SandboxManager)(nil)
+
+// subscription is an in-process receiver of a sandbox's observations.
+type subscription struct {
+	ch     chan []byte
+	done   chan struct{} // Closed with ch
+	closed bool          // Guarded by subscriptions.mu
+}
+
+// subscriptions are the in-process receivers of each sandbox's observations.
+type subscriptions struct {
+	mu        sync.Mutex
+	bySandbox map[string]map[*subscription]struct{}
+}
+
+// StreamObservations implements SandboxService.
+func (m *SandboxManager) StreamObservations(ctx context.Context, sandboxID string) (<-chan []byte, error) {
+	m.mu.RLock()
+	_, exists := m.sandboxes[sandboxID]
+	m.mu.RUnlock()
+	if !exists {
+		return nil, ErrSandboxNotFound
+	}
+
+	sub := &subscription{ch: make(chan []byte, SubscriptionBuffer), done: make(chan struct{})}
+	m.subs.mu.Lock()
+	if m.subs.bySandbox == nil {
+		m.subs.bySandbox = make(map[string]map[*subscription]struct{})
+	}
+	if m.subs.bySandbox[sandboxID] == nil {
+		m.subs.bySandbox[sandboxID] = make(map[*subscription]struct{})
+	}
+	m.subs.bySandbox[sandboxID][sub] = struct{}{}
+	m.subs.mu.Unlock()
+
+	m.goSafe("observation_subscription", func() {
+		select {
+		case <-ctx.Done():
+			m.subs.mu.Lock()
+			defer m.subs.mu.Unlock()
+			m.unsubscribeLocked(sandboxID, sub)
+		case <-sub.done:
+		}
+	})
+	return sub.ch, nil
+}
+
+// publish hands a broadcast message to the sandbox's subscriptions without blocking. The
+// message is shared, so receivers must not modify it.
+func (m *SandboxManager) publish(sandboxID string, message []byte) {
+	m.subs.mu.Lock()
+	defer m.subs.mu.Unlock()
+	for sub := range m.subs.bySandbox[sandboxID] {
+		select {
+		case sub.ch <- message:
+		default:
+			m.logger.Warn("Closing observation subscription that fell behind", "sandboxID", sandboxID)
+			m.unsubscribeLocked(sandboxID, sub)
+		}
+	}
+}
+
+// closeSubscriptions closes the subscriptions of a deleted sandbox.
+func (m *SandboxManager) closeSubscriptions(sandboxID string) {
+	m.subs.mu.Lock()
+	defer m.subs.mu.Unlock()
+	for sub := range m.subs.bySandbox[sandboxID] {
+		m.unsubscribeLocked(sandboxID, sub)
+	}
+}
+
+// unsubscribeLocked closes a subscription. Callers must hold m.subs.mu.
+func (m *SandboxManager) unsubscribeLocked(sandboxID string, sub *subscription) {
+	if sub.closed {
+		return
+	}
+	sub.closed = true
+	close(sub.ch)
+	close(sub.done)
+	delete(m.subs.bySandbox[sandboxID], sub)
+	if len(m.subs.bySandbox[sandboxID]) == 0 {
+		delete(m.subs.bySandbox, sandboxID)
+	}
+}
@@ -0,0 +1,103 @@
+package manager
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+var ErrSandboxSettingUp = newError(KindConflict, "sandbox_setting_up", "sandbox setup has not finished")
+
+// Setup statuses.
+const (
+	SetupRunning   = "running"
+	SetupSucceeded = "succeeded"
+	SetupFailed    = "failed"
+)
+
+// DefaultSetupTimeout bounds all setup commands of a sandbox together.
+const DefaultSetupTimeout = 10 * time.Minute
+
+// setupSandbox runs the setup commands of a freshly created sandbox in order through the
+// agent, stopping at the first failure. The commands are ordinary shell actions, so their
+// output is in the sandbox's observation history. Other actions are refused until setup ends.
+// A failed setup deletes the sandbox, unless spec.KeepOnSetupFailure is set.
+func (m *SandboxManager) setupSandbox(ctx context.Context, sandboxID string, spec SandboxSpec) error {
+	timeout := spec.SetupTimeout
+	if timeout <= 0 {
+		timeout = DefaultSetupTimeout
+	}
+	m.logger.Info("Running sandbox setup", "sandboxID", sandboxID, "commands", len(spec.Setup), "timeout", timeout)
+
+	err := m.runSetupCommands(ctx, sandboxID, spec.Setup, timeout)
+
+	var change SandboxStateObservationData
+	changed := false
+	m.mu.Lock()
+	if state, exists := m.sandboxes[sandboxID]; exists {
+		if err == nil {
+			state.SetupStatus = SetupSucceeded
+			change, changed = m.transition(state, PhaseReady, "setup_succeeded")
+		} else {
+			state.SetupStatus = SetupFailed
+			state.SetupError = err.Error()
+			// A kept sandbox stays usable so the failure can be investigated.
+			phase := PhaseFailed
+			if spec.KeepOnSetupFailure {
+				phase = PhaseReady
+			}
+			change, changed = m.transition(state, phase, "setup_failed")
+		}
+	}
+	m.mu.Unlock()
+	m.announcePhase(sandboxID, change, changed)
+
+	if err == nil {
+		m.logger.Info("Sandbox setup succeeded", "sandboxID", sandboxID)
+		return nil
+	}
+	m.logger.Warn("Sandbox setup failed", "sandboxID", sandboxID, "keep", spec.KeepOnSetupFailure, "error", err)
+	if spec.KeepOnSetupFailure {
+		return nil
+	}
+	if delErr := m.DeleteSandbox(context.Background(), sandboxID, true); delErr != nil {
+		m.logger.Error("Failed to delete sandbox after setup failure", "sandboxID", sandboxID, "error", delErr)
+	}
+	return &Error{Kind: KindInvalid, Code: "setup_failed", Message: "sandbox setup failed", Err: err}
+}
+
+func (m *SandboxManager) runSetupCommands(ctx context.Context, sandboxID string, commands []string, timeout time.Duration) error {
+	deadline := time.NewTimer(timeout)
+	defer deadline.Stop()
+
+	for i, command := range commands {
+		done := make(chan int, 1)
+		actionID, err := m.initiateAction(ctx, sandboxID, "shell", map[string]interface{}{"command": command}, done)
+		if err != nil {
+			return fmt.Errorf("setup command %d could not start: %w", i+1, err)
+		}
+		select {
+		case exitCode := <-done:
+			if exitCode != 0 {
+				return fmt.Errorf("setup command %d (action %s) exited with code %d", i+1, actionID, exitCode)
+			}
+		case <-deadline.C:
+			m.abandonAction(actionID)
+			return fmt.Errorf("setup timed out after %s", timeout)
+		case <-ctx.Done():
+			m.abandonAction(actionID)
+			return ctx.Err()
+		}
+	}
+	return nil
+}
+
+// checkSetupDone refuses actions while a sandbox's setup commands are running.
+func (m *SandboxManager) checkSetupDone(sandboxID string) error {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	if state, exists := m.sandboxes[sandboxID]; exists && state.SetupStatus == SetupRunning {
+		return ErrSandboxSettingUp
+	}
+	return nil
+}
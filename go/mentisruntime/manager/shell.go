@@ -0,0 +1,52 @@
+package manager
+
+import (
+	"context"
+	"slices"
+	"strings"
+)
+
+// checkActionShell returns an error if a shell action chooses a shell (its "shell" field)
+// that the agent of its sandbox does not report. Each agent is asked once; agents that
+// report no shells cannot choose one, as they would run the command with /bin/sh anyway.
+func (m *SandboxManager) checkActionShell(ctx context.Context, sandboxID string, payload map[string]interface{}) error {
+	shell, _ := payload["shell"].(string)
+	if shell == "" {
+		return nil
+	}
+	m.mu.RLock()
+	state, exists := m.sandboxes[sandboxID]
+	var shells []string
+	var agentURL string
+	if exists {
+		shells, agentURL = state.shells, state.AgentURL
+	}
+	m.mu.RUnlock()
+	if !exists {
+		return ErrSandboxNotFound
+	}
+
+	if shells == nil {
+		health, ok := m.agentHealthOf(ctx, agentURL)
+		if !ok {
+			return newError(KindBackend, "agent_unreachable", "cannot ask the sandbox's agent which shells it supports")
+		}
+		shells = health.Shells
+		if shells == nil {
+			shells = []string{} // Not asked again
+		}
+		m.mu.Lock()
+		if state, exists := m.sandboxes[sandboxID]; exists && state.AgentURL == agentURL {
+			state.shells = shells
+		}
+		m.mu.Unlock()
+	}
+
+	switch {
+	case len(shells) == 0:
+		return newError(KindInvalid, "unsupported_shell", "the sandbox's agent does not support choosing a shell")
+	case !slices.Contains(shells, shell):
+		return newError(KindInvalid, "unsupported_shell", "shell "+shell+" is not available in the sandbox; available: "+strings.Join(shells, ", "))
+	}
+	return nil
+}
@@ -0,0 +1,31 @@
+package manager
+
+import (
+	"context"
+	"time"
+)
+
+// WithShutdownTimeout makes DeleteSandbox ask the agent to shut down before stopping its
+// container, waiting at most timeout. The agent uses it to terminate running commands while
+// their output can still be sent. Zero stops the container straight away.
+func WithShutdownTimeout(timeout time.Duration) Option {
+	return func(m *SandboxManager) {
+		m.shutdownTimeout = timeout
+	}
+}
+
+// requestAgentShutdown calls POST /shutdown on an agent. Failures are only logged: agents
+// that are unresponsive or predate the endpoint are stopped regardless.
+func (m *SandboxManager) requestAgentShutdown(ctx context.Context, sandboxID, agentURL string) {
+	if m.shutdownTimeout <= 0 || agentURL == "" {
+		return
+	}
+	shutdownCtx, cancel := context.WithTimeout(ctx, m.shutdownTimeout)
+	defer cancel()
+	start := time.Now()
+	if err := m.callAgent(shutdownCtx, sandboxID, "POST", agentURL+"/shutdown", nil, nil); err != nil {
+		m.logger.Warn("Agent did not shut down gracefully, stopping container", "sandboxID", sandboxID, "error", err)
+		return
+	}
+	m.logger.Info("Agent shut down gracefully", "sandboxID", sandboxID, "duration", time.Since(start))
+}
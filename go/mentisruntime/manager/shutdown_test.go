@@ -0,0 +1,43 @@
+package manager
+
+import (
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRequestAgentShutdown(t *testing.T) {
+	calls := 0
+	agent := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, "POST", r.Method)
+		require.Equal(t, "/shutdown", r.URL.Path)
+		calls++
+	}))
+	defer agent.Close()
+
+	m := &SandboxManager{httpClient: agent.Client(), logger: slog.Default()}
+	m.requestAgentShutdown(t.Context(), "sb", agent.URL)
+	require.Equal(t, 0, calls, "disabled without a timeout")
+
+	m.shutdownTimeout = time.Second
+	m.requestAgentShutdown(t.Context(), "sb", agent.URL)
+	require.Equal(t, 1, calls)
+}
+
+func TestRequestAgentShutdownTimeout(t *testing.T) {
+	release := make(chan struct{})
+	agent := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer agent.Close()
+	defer close(release)
+
+	m := &SandboxManager{httpClient: agent.Client(), logger: slog.Default(), shutdownTimeout: 50 * time.Millisecond}
+	start := time.Now()
+	m.requestAgentShutdown(t.Context(), "sb", agent.URL)
+	require.Less(t, time.Since(start), 5*time.Second)
+}
@@ -0,0 +1,305 @@
+package manager
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/filters"
+	"github.com/docker/docker/api/types/mount"
+	"github.com/docker/docker/api/types/network"
+	"github.com/docker/docker/api/types/volume"
+)
+
+// DefaultPrivateNetwork is the private network that sidecars and the sandbox join when they
+// name no networks.
+const DefaultPrivateNetwork = "default"
+
+// SidecarSpec describes an auxiliary container, such as a database, started alongside a
+// sandbox. Sidecars share private networks with the sandbox, where each is reachable by its
+// name and the sandbox container by the alias "sandbox".
+type SidecarSpec struct {
+	Name       string            `json:"name"`
+	Image      string            `json:"image"`
+	Env        map[string]string `json:"env,omitempty"`
+	Command    []string          `json:"command,omitempty"`    // Overrides the image CMD
+	Entrypoint []string          `json:"entrypoint,omitempty"` // Overrides the image ENTRYPOINT
+	Workdir    string            `json:"workdir,omitempty"`
+	User       string            `json:"user,omitempty"`
+	Volumes    []VolumeMount     `json:"volumes,omitempty"`
+	Networks   []string          `json:"networks,omitempty"` // Private networks to join; DefaultPrivateNetwork if empty
+}
+
+// VolumeMount mounts a named volume owned by the sandbox. The volume is created with the
+// sandbox, can be shared between its containers, and is removed with it.
+type VolumeMount struct {
+	Volume   string `json:"volume"`
+	Path     string `json:"path"`
+	ReadOnly bool   `json:"read_only,omitempty"`
+}
+
+// SidecarState is a sidecar together with its container.
+type SidecarState struct {
+	SidecarSpec
+	ContainerID string `json:"container_id"`
+}
+
+// sidecarSpecs returns the specs of sidecars, e.g. to start fresh ones for a clone.
+func sidecarSpecs(sidecars []SidecarState) []SidecarSpec {
+	if len(sidecars) == 0 {
+		return nil
+	}
+	specs := make([]SidecarSpec, len(sidecars))
+	for i, sc := range sidecars {
+		specs[i] = sc.SidecarSpec
+	}
+	return specs
+}
+
+// hasPrivateResources reports whether a spec needs sidecars, private networks or volumes.
+func (spec SandboxSpec) hasPrivateResources() bool {
+	return len(spec.Sidecars) > 0 || len(spec.Volumes) > 0 || len(spec.PrivateNetworks) > 0
+}
+
+// sandboxPrivateNetworks returns the private networks the sandbox container joins.
+func (spec SandboxSpec) sandboxPrivateNetworks() []string {
+	if len(spec.PrivateNetworks) > 0 {
+		return spec.PrivateNetworks
+	}
+	if len(spec.Sidecars) > 0 {
+		return []string{DefaultPrivateNetwork}
+	}
+	return nil
+}
+
+func (sc SidecarSpec) privateNetworks() []string {
+	if len(sc.Networks) > 0 {
+		return sc.Networks
+	}
+	return []string{DefaultPrivateNetwork}
+}
+
+// privateNetworkName is the Docker name of a private network of a sandbox.
+func (m *SandboxManager) privateNetworkName(sandboxID, name string) string {
+	base := fmt.Sprintf("sandboxai-%s-%s", m.scope, sandboxID)
+	if name == DefaultPrivateNetwork {
+		return base
+	}
+	return base + "-" + name
+}
+
+// volumeName is the Docker name of a volume owned by a sandbox.
+func (m *SandboxManager) volumeName(sandboxID, name string) string {
+	return fmt.Sprintf("sandboxai-%s-%s-%s", m.scope, sandboxID, name)
+}
+
+func (m *SandboxManager) volumeMounts(sandboxID string, volumes []VolumeMount) []mount.Mount {
+	mounts := make([]mount.Mount, 0, len(volumes))
+	for _, v := range volumes {
+		mounts = append(mounts, mount.Mount{
+			Type:     mount.TypeVolume,
+			Source:   m.volumeName(sandboxID, v.Volume),
+			Target:   v.Path,
+			ReadOnly: v.ReadOnly,
+		})
+	}
+	return mounts
+}
+
+// startSidecars creates the private networks and volumes of a sandbox and starts its sidecars.
+// On failure everything created so far is removed again.
+func (m *SandboxManager) startSidecars(ctx context.Context, sandboxID, spaceID string, spec SandboxSpec) ([]SidecarState, error) {
+	labels := map[string]string{
+		"sandboxai.scope": m.scope,
+		"sandboxai.id":    sandboxID,
+		"sandboxai.space": spaceID,
+	}
+	networks := map[string]bool{}
+	volumes := map[string]bool{}
+	for _, name := range spec.sandboxPrivateNetworks() {
+		networks[name] = true
+	}
+	for _, v := range spec.Volumes {
+		volumes[v.Volume] = true
+	}
+	for _, sc := range spec.Sidecars {
+		for _, name := range sc.privateNetworks() {
+			networks[name] = true
+		}
+		for _, v := range sc.Volumes {
+			volumes[v.Volume] = true
+		}
+	}
+
+	createCtx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+	for _, name := range sortedKeys(networks) {
+		_, err := m.docker().NetworkCreate(createCtx, m.privateNetworkName(sandboxID, name), network.CreateOptions{Driver: m.platform.networkDriver(), Labels: labels})
+		if err != nil {
+			m.removeSidecars(sandboxID)
+			return nil, backendError("network_create_failed", "failed to create private network "+name, err)
+		}
+	}
+	for _, name := range sortedKeys(volumes) {
+		_, err := m.docker().VolumeCreate(createCtx, volume.CreateOptions{Name: m.volumeName(sandboxID, name), Labels: labels})
+		if err != nil {
+			m.removeSidecars(sandboxID)
+			return nil, backendError("volume_create_failed", "failed to create volume "+name, err)
+		}
+	}
+
+	sidecars := make([]SidecarState, 0, len(spec.Sidecars))
+	for _, sc := range spec.Sidecars {
+		containerID, err := m.startSidecar(ctx, sandboxID, sc)
+		if err != nil {
+			m.removeSidecars(sandboxID)
+			return nil, err
+		}
+		sidecars = append(sidecars, SidecarState{SidecarSpec: sc, ContainerID: containerID})
+	}
+	return sidecars, nil
+}
+
+func (m *SandboxManager) startSidecar(ctx context.Context, sandboxID string, spec SidecarSpec) (string, error) {
+	if err := m.ensureImage(ctx, spec.Image, m.platform.imagePlatform(""), nil); err != nil {
+		return "", err
+	}
+	env := make([]string, 0, len(spec.Env))
+	for k, v := range spec.Env {
+		env = append(env, k+"="+v)
+	}
+	// Sidecars carry sandboxai.sidecar-of instead of sandboxai.id, so their events and
+	// lifecycle are never mistaken for those of the sandbox container itself.
+	labels := map[string]string{
+		"sandboxai.scope":      m.scope,
+		"sandboxai.sidecar-of": sandboxID,
+		"sandboxai.sidecar":    spec.Name,
+	}
+	networks := spec.privateNetworks()
+	primary := m.privateNetworkName(sandboxID, networks[0])
+
+	createCtx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+	resp, err := m.docker().ContainerCreate(createCtx,
+		&container.Config{
+			Image:      spec.Image,
+			Env:        env,
+			Cmd:        spec.Command,
+			Entrypoint: spec.Entrypoint,
+			WorkingDir: spec.Workdir,
+			User:       spec.User,
+			Labels:     labels,
+		},
+		&container.HostConfig{
+			NetworkMode: container.NetworkMode(primary),
+			Mounts:      m.volumeMounts(sandboxID, spec.Volumes),
+		},
+		&network.NetworkingConfig{EndpointsConfig: map[string]*network.EndpointSettings{
+			primary: {Aliases: []string{spec.Name}},
+		}},
+		nil,
+		fmt.Sprintf("sandboxai-%s-%s-%s", m.scope, sandboxID, spec.Name),
+	)
+	if err != nil {
+		return "", backendError("sidecar_create_failed", "failed to create sidecar "+spec.Name, err)
+	}
+	if err := m.connectPrivateNetworks(ctx, sandboxID, resp.ID, networks[1:], spec.Name); err != nil {
+		return "", err
+	}
+	startCtx, startCancel := context.WithTimeout(ctx, 15*time.Second)
+	defer startCancel()
+	if err := m.docker().ContainerStart(startCtx, resp.ID, container.StartOptions{}); err != nil {
+		return "", backendError("sidecar_start_failed", "failed to start sidecar "+spec.Name, err)
+	}
+	m.logger.Info("Sidecar started", "sandboxID", sandboxID, "sidecar", spec.Name, "image", spec.Image, "containerID", resp.ID)
+	return resp.ID, nil
+}
+
+// connectPrivateNetworks connects a container to private networks of its sandbox, where it
+// is reachable as alias.
+func (m *SandboxManager) connectPrivateNetworks(ctx context.Context, sandboxID, containerID string, networks []string, alias string) error {
+	connectCtx, cancel := context.WithTimeout(ctx, 15*time.Second)
+	defer cancel()
+	for _, name := range networks {
+		err := m.docker().NetworkConnect(connectCtx, m.privateNetworkName(sandboxID, name), containerID, &network.EndpointSettings{
+			Aliases: []string{alias},
+		})
+		if err != nil {
+			return backendError("network_connect_failed", "failed to attach "+alias+" to private network "+name, err)
+		}
+	}
+	return nil
+}
+
+// removeSidecars removes the sidecars, private networks and volumes of a sandbox, if it has
+// any. They are found by label, so this also cleans up after adopted sandboxes. The sandbox
+// container must be gone already, or its networks and volumes are still in use.
+func (m *SandboxManager) removeSidecars(sandboxID string) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	containers, err := m.docker().ContainerList(ctx, container.ListOptions{
+		All: true,
+		Filters: filters.NewArgs(
+			filters.Arg("label", "sandboxai.scope="+m.scope),
+			filters.Arg("label", "sandboxai.sidecar-of="+sandboxID),
+		),
+	})
+	if err != nil {
+		m.logger.Error("Failed to list sidecars", "sandboxID", sandboxID, "error", err)
+		return
+	}
+	for _, c := range containers {
+		if err := m.docker().ContainerRemove(ctx, c.ID, container.RemoveOptions{Force: true, RemoveVolumes: true}); err != nil {
+			m.logger.Error("Failed to remove sidecar", "sandboxID", sandboxID, "containerID", c.ID, "error", err)
+			continue
+		}
+		m.logger.Info("Sidecar removed", "sandboxID", sandboxID, "sidecar", c.Labels["sandboxai.sidecar"], "containerID", c.ID)
+	}
+
+	owned := filters.NewArgs(
+		filters.Arg("label", "sandboxai.scope="+m.scope),
+		filters.Arg("label", "sandboxai.id="+sandboxID),
+	)
+	networks, err := m.docker().NetworkList(ctx, network.ListOptions{Filters: owned})
+	if err != nil {
+		m.logger.Error("Failed to list private networks", "sandboxID", sandboxID, "error", err)
+	}
+	for _, n := range networks {
+		if err := m.docker().NetworkRemove(ctx, n.ID); err != nil {
+			m.logger.Error("Failed to remove private network", "sandboxID", sandboxID, "network", n.Name, "error", err)
+		}
+	}
+	volumes, err := m.docker().VolumeList(ctx, volume.ListOptions{Filters: owned})
+	if err != nil {
+		m.logger.Error("Failed to list sandbox volumes", "sandboxID", sandboxID, "error", err)
+		return
+	}
+	for _, v := range volumes.Volumes {
+		if err := m.docker().VolumeRemove(ctx, v.Name, true); err != nil {
+			m.logger.Error("Failed to remove sandbox volume", "sandboxID", sandboxID, "volume", v.Name, "error", err)
+		}
+	}
+}
+
+// isLiveSidecar reports whether a container is a sidecar of a sandbox the manager knows.
+func (m *SandboxManager) isLiveSidecar(labels map[string]string) bool {
+	owner := labels["sandboxai.sidecar-of"]
+	if owner == "" {
+		return false
+	}
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	_, exists := m.sandboxes[owner]
+	return exists
+}
+
+func sortedKeys(set map[string]bool) []string {
+	keys := make([]string, 0, len(set))
+	for k := range set {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
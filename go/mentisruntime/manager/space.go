@@ -2,6 +2,7 @@ package manager
 
 import (
 	"context"
+	"fmt"
 	"log/slog"
 	"sync"
 	"time"
@@ -24,25 +25,26 @@ func NewSpaceManager(logger *slog.Logger) *SpaceManager {
 	}
 	// Create default space if it doesn't exist
 	defaultSpace := &SpaceState{
-		ID:        "default",
+		ID:        DefaultSpaceID,
 		Name:      "Default Space",
 		CreatedAt: time.Now(),
 		UpdatedAt: time.Now(),
 		Sandboxes: make(map[string]*SandboxState),
 	}
-	sm.spaces["default"] = defaultSpace
+	sm.spaces[DefaultSpaceID] = defaultSpace
 	sm.logger.Info("Default space created")
 	return sm
 }
 
-// CreateSpace creates a new space.
+// CreateSpace creates a new space, owned by the context's tenant.
 func (sm *SpaceManager) CreateSpace(ctx context.Context, name string, description string, metadata map[string]interface{}) (string, error) {
 	sm.mu.Lock()
 	defer sm.mu.Unlock()
+	tenant := TenantFromContext(ctx)
 
 	// Check for name conflict (optional, but good practice)
 	for _, existingSpace := range sm.spaces {
-		if existingSpace.Name == name {
+		if existingSpace.Name == name && existingSpace.Tenant == tenant {
 			sm.logger.Warn("Attempted to create space with conflicting name", "name", name)
 			return "", ErrSpaceNameConflict
 		}
@@ -56,6 +58,7 @@ func (sm *SpaceManager) CreateSpace(ctx context.Context, name string, descriptio
 		CreatedAt:   time.Now(),
 		UpdatedAt:   time.Now(),
 		Metadata:    metadata,
+		Tenant:      tenant,
 		Sandboxes:   make(map[string]*SandboxState),
 	}
 
@@ -70,7 +73,7 @@ func (sm *SpaceManager) GetSpace(ctx context.Context, spaceID string) (*SpaceSta
 	defer sm.mu.RUnlock()
 
 	space, exists := sm.spaces[spaceID]
-	if !exists {
+	if !exists || !visible(ctx, space) {
 		return nil, ErrSpaceNotFound
 	}
 	// Return a copy to prevent external modification? For now, return pointer. Be mindful of modifications.
@@ -88,6 +91,9 @@ func (sm *SpaceManager) ListSpaces(ctx context.Context) ([]*SpaceState, error) {
 
 	spaces := make([]*SpaceState, 0, len(sm.spaces))
 	for _, space := range sm.spaces {
+		if !visible(ctx, space) {
+			continue
+		}
 		// Return copies to prevent external modification
 		spaceCopy := *space // Shallow copy
 		// Deep copy Metadata/Sandboxes if necessary
@@ -103,7 +109,7 @@ func (sm *SpaceManager) UpdateSpace(ctx context.Context, spaceID string, descrip
 	defer sm.mu.Unlock()
 
 	space, exists := sm.spaces[spaceID]
-	if !exists {
+	if !exists || !visible(ctx, space) {
 		return ErrSpaceNotFound
 	}
 
@@ -116,17 +122,21 @@ func (sm *SpaceManager) UpdateSpace(ctx context.Context, spaceID string, descrip
 	return nil
 }
 
-// DeleteSpace deletes a space.
+// DeleteSpace deletes a space. Protected spaces are only deleted with force.
 // Note: This currently doesn't handle deleting associated sandboxes.
 // That logic might belong in SandboxManager or require coordination.
 // **UPDATE**: We will coordinate this from SandboxManager.DeleteSpace now.
-func (sm *SpaceManager) DeleteSpace(ctx context.Context, spaceID string) error {
+func (sm *SpaceManager) DeleteSpace(ctx context.Context, spaceID string, force bool) error {
 	sm.mu.Lock()
 	defer sm.mu.Unlock()
 
-	if _, exists := sm.spaces[spaceID]; !exists {
+	space, exists := sm.spaces[spaceID]
+	if !exists || !visible(ctx, space) {
 		return ErrSpaceNotFound
 	}
+	if space.Protected && !force {
+		return fmt.Errorf("%w: %q", ErrSpaceProtected, spaceID)
+	}
 
 	// The actual deletion of sandboxes should be handled by the caller (e.g., SandboxManager)
 	// before calling this method, or this method needs access to SandboxManager.
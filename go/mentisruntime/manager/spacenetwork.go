@@ -0,0 +1,225 @@
+package manager
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/network"
+	"github.com/docker/docker/client"
+)
+
+var (
+	ErrSpaceNetworksDisabled = newError(KindUnavailable, "space_networks_disabled", "space networks are not enabled on this runtime")
+	ErrSpaceIsolated         = newError(KindConflict, "space_isolated", "space is isolated and has no network")
+	ErrHostnameTaken         = newError(KindConflict, "hostname_taken", "hostname is already used in the space")
+)
+
+// SpaceEndpoint is a sandbox as its siblings reach it on the space network.
+type SpaceEndpoint struct {
+	SandboxID   string   `json:"sandbox_id"`
+	Hostname    string   `json:"hostname"`
+	Aliases     []string `json:"aliases"` // Names that resolve to the sandbox, its hostname among them
+	IPAddress   string   `json:"ip_address,omitempty"`
+	IPv6Address string   `json:"ipv6_address,omitempty"`
+}
+
+// SpaceEndpoints are the sandboxes attached to the network of a space.
+type SpaceEndpoints struct {
+	SpaceID   string          `json:"space_id"`
+	Network   string          `json:"network"`
+	Endpoints []SpaceEndpoint `json:"endpoints"` // By hostname
+}
+
+// WithSpaceNetworks gives each space a Docker network that its sandboxes join, where each is
+// reachable by its sandbox ID and the hostname it was created with, which Docker's embedded
+// DNS resolves. Sandboxes of isolated spaces join none.
+func WithSpaceNetworks() Option {
+	return func(m *SandboxManager) {
+		m.spaceNetworks = true
+	}
+}
+
+// SetSpaceIsolated sets whether the sandboxes of a space stay off its space network. It
+// applies to sandboxes created from then on.
+func (sm *SpaceManager) SetSpaceIsolated(ctx context.Context, spaceID string, isolated bool) error {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+	space, exists := sm.spaces[spaceID]
+	if !exists || !visible(ctx, space) {
+		return ErrSpaceNotFound
+	}
+	space.Isolated = isolated
+	return nil
+}
+
+// spaceNetworkName is the Docker name of the network of a space.
+func (m *SandboxManager) spaceNetworkName(spaceID string) string {
+	return fmt.Sprintf("sandboxai-%s-space-%s", m.scope, spaceID)
+}
+
+// ensureSpaceNetwork returns the network the sandboxes of a space join, creating it for the
+// first one, or "" if they join none.
+func (m *SandboxManager) ensureSpaceNetwork(ctx context.Context, space *SpaceState) (string, error) {
+	if !m.spaceNetworks || space.Isolated {
+		return "", nil
+	}
+	m.networkMu.Lock()
+	defer m.networkMu.Unlock()
+	name := m.spaceNetworkName(space.ID)
+	netCtx, cancel := context.WithTimeout(ctx, 15*time.Second)
+	defer cancel()
+	_, err := m.docker().NetworkInspect(netCtx, name, network.InspectOptions{})
+	if err == nil {
+		return name, nil
+	}
+	if !client.IsErrNotFound(err) {
+		return "", backendError("network_inspect_failed", "failed to inspect network of space "+space.ID, err)
+	}
+	_, err = m.docker().NetworkCreate(netCtx, name, network.CreateOptions{
+		Driver: m.platform.networkDriver(),
+		Labels: map[string]string{
+			"sandboxai.scope": m.scope,
+			"sandboxai.space": space.ID,
+		},
+	})
+	if err != nil {
+		return "", backendError("network_create_failed", "failed to create network of space "+space.ID, err)
+	}
+	m.logger.Info("Space network created", "spaceID", space.ID, "network", name)
+	return name, nil
+}
+
+// checkSpaceHostname checks that a sandbox can be created with a hostname in a space.
+// Callers must hold m.mu.
+func (m *SandboxManager) checkSpaceHostname(space *SpaceState, hostname string) error {
+	if !m.spaceNetworks {
+		return ErrSpaceNetworksDisabled
+	}
+	if space.Isolated {
+		return fmt.Errorf("%w: %q", ErrSpaceIsolated, space.ID)
+	}
+	for id, state := range m.sandboxes {
+		if state.SpaceID == space.ID && (state.Hostname == hostname || id == hostname) {
+			return fmt.Errorf("%w: %q", ErrHostnameTaken, hostname)
+		}
+	}
+	for id, r := range m.reservations {
+		if r.spaceID == space.ID && (r.hostname == hostname || id == hostname) {
+			return fmt.Errorf("%w: %q", ErrHostnameTaken, hostname)
+		}
+	}
+	return nil
+}
+
+// spaceAliases returns the names a sandbox is reachable by on its space network.
+func spaceAliases(sandboxID, hostname string) []string {
+	if hostname == "" || hostname == sandboxID {
+		return []string{sandboxID}
+	}
+	return []string{hostname, sandboxID}
+}
+
+// joinSpaceNetwork connects a sandbox container to its space network, where it is reachable
+// by its sandbox ID and hostname, if it has one.
+func (m *SandboxManager) joinSpaceNetwork(ctx context.Context, networkName, sandboxID, hostname, containerID string) error {
+	connectCtx, cancel := context.WithTimeout(ctx, 15*time.Second)
+	defer cancel()
+	err := m.docker().NetworkConnect(connectCtx, networkName, containerID, &network.EndpointSettings{
+		Aliases: spaceAliases(sandboxID, hostname),
+	})
+	if err != nil {
+		return backendError("network_connect_failed", "failed to attach sandbox to its space network", err)
+	}
+	return nil
+}
+
+// spaceHostname returns the hostname an adopted container is reachable by on its space
+// network, or "" if it is not attached to one.
+func (m *SandboxManager) spaceHostname(c container.Summary, sandboxID, spaceID string) string {
+	if c.NetworkSettings == nil {
+		return ""
+	}
+	if _, ok := c.NetworkSettings.Networks[m.spaceNetworkName(spaceID)]; !ok {
+		return ""
+	}
+	if hostname := c.Labels["sandboxai.hostname"]; hostname != "" {
+		return hostname
+	}
+	return sandboxID
+}
+
+// GetSpaceEndpoints returns the sandboxes on the network of a space, for service discovery.
+func (m *SandboxManager) GetSpaceEndpoints(ctx context.Context, spaceID string) (*SpaceEndpoints, error) {
+	space, err := m.spaceManager.GetSpace(ctx, spaceID)
+	if err != nil {
+		return nil, err
+	}
+	if !m.spaceNetworks {
+		return nil, ErrSpaceNetworksDisabled
+	}
+	result := &SpaceEndpoints{SpaceID: space.ID, Network: m.spaceNetworkName(space.ID), Endpoints: []SpaceEndpoint{}}
+	inspectCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	nw, err := m.docker().NetworkInspect(inspectCtx, result.Network, network.InspectOptions{})
+	if err != nil {
+		if !client.IsErrNotFound(err) {
+			return nil, backendError("network_inspect_failed", "failed to inspect network of space "+space.ID, err)
+		}
+		if space.Isolated {
+			return nil, fmt.Errorf("%w: %q", ErrSpaceIsolated, space.ID)
+		}
+		return result, nil // Created with the first sandbox
+	}
+
+	m.mu.RLock()
+	byContainer := make(map[string]*SandboxState)
+	for _, state := range m.sandboxes {
+		if state.SpaceID == space.ID && state.Hostname != "" {
+			byContainer[state.ContainerID] = state
+		}
+	}
+	for containerID, ep := range nw.Containers {
+		state := byContainer[containerID]
+		if state == nil {
+			continue // Being created or deleted
+		}
+		result.Endpoints = append(result.Endpoints, SpaceEndpoint{
+			SandboxID:   state.ID,
+			Hostname:    state.Hostname,
+			Aliases:     spaceAliases(state.ID, state.Hostname),
+			IPAddress:   stripPrefixLength(ep.IPv4Address),
+			IPv6Address: stripPrefixLength(ep.IPv6Address),
+		})
+	}
+	m.mu.RUnlock()
+	sort.Slice(result.Endpoints, func(i, j int) bool { return result.Endpoints[i].Hostname < result.Endpoints[j].Hostname })
+	return result, nil
+}
+
+// stripPrefixLength turns an address in CIDR notation, as networks report them, into a plain one.
+func stripPrefixLength(addr string) string {
+	ip, _, _ := strings.Cut(addr, "/")
+	return ip
+}
+
+// removeSpaceNetwork removes the network of a deleted space, if it has one. Networks left
+// behind, e.g. while still in use, are removed by garbage collection.
+func (m *SandboxManager) removeSpaceNetwork(spaceID string) {
+	if !m.spaceNetworks {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	defer cancel()
+	name := m.spaceNetworkName(spaceID)
+	if err := m.docker().NetworkRemove(ctx, name); err != nil {
+		if !client.IsErrNotFound(err) {
+			m.logger.Error("Failed to remove space network", "spaceID", spaceID, "network", name, "error", err)
+		}
+		return
+	}
+	m.logger.Info("Space network removed", "spaceID", spaceID, "network", name)
+}
@@ -0,0 +1,112 @@
+package manager
+
+// diskWarnRatio is the share of the disk kill threshold past which a space is warned
+// that one of its sandboxes is about to be killed.
+const diskWarnRatio = 0.8
+
+// Space events, broadcast on the stream of a space in addition to the observations of
+// its sandboxes.
+const (
+	SpaceEventSandboxCreated = "sandbox_created"
+	SpaceEventSandboxDeleted = "sandbox_deleted"
+	SpaceEventSandboxState   = "sandbox_state"
+	SpaceEventQuotaWarning   = "quota_warning"
+	SpaceEventActionDone     = "action_completed"
+)
+
+// SpaceSandboxEventData is the data of "sandbox_created" and "sandbox_deleted" events.
+type SpaceSandboxEventData struct {
+	SandboxID string            `json:"sandbox_id"`
+	Name      string            `json:"name,omitempty"`
+	Image     string            `json:"image,omitempty"`
+	Hostname  string            `json:"hostname,omitempty"`
+	Labels    map[string]string `json:"labels,omitempty"`
+}
+
+// SpaceStateEventData is the data of "sandbox_state" events: a sandbox's phase change.
+type SpaceStateEventData struct {
+	SandboxID string `json:"sandbox_id"`
+	SandboxStateObservationData
+}
+
+// QuotaWarningData is the data of "quota_warning" events. Quota is "concurrent_actions"
+// when an action was rejected for exceeding the limit, or "disk" when a sandbox's disk
+// usage nears the threshold at which it is killed.
+type QuotaWarningData struct {
+	SandboxID string `json:"sandbox_id"`
+	Quota     string `json:"quota"`
+	Used      int64  `json:"used"`
+	Limit     int64  `json:"limit"`
+}
+
+// ActionCompletedData is the data of "action_completed" events: the outcome of an action,
+// without its output.
+type ActionCompletedData struct {
+	SandboxID string `json:"sandbox_id"`
+	ActionID  string `json:"action_id"`
+	ExitCode  int    `json:"exit_code"`
+	Error     string `json:"error,omitempty"`
+	Signal    string `json:"signal,omitempty"`
+	OOMKilled bool   `json:"oom_killed,omitempty"`
+	CacheHit  bool   `json:"cache_hit,omitempty"`
+}
+
+// SpaceStreamID returns the ID the events of a space are broadcast and recorded under.
+// Stream IDs name history files, so it has no path separator.
+func SpaceStreamID(spaceID string) string {
+	return "space-" + spaceID
+}
+
+// pushSpaceEvent broadcasts an event on the stream of a space and on the admin event
+// stream. It takes no lock, so it may be called with m.mu held.
+func (m *SandboxManager) pushSpaceEvent(spaceID, eventType string, data interface{}) {
+	if spaceID == "" {
+		return
+	}
+	m.pushObservation(SpaceStreamID(spaceID), "", eventType, data)
+	m.pushRuntimeEvent(spaceID, eventType, data)
+}
+
+// spaceOf returns the space of a sandbox, or "" for unknown sandboxes.
+func (m *SandboxManager) spaceOf(sandboxID string) string {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	if state, exists := m.sandboxes[sandboxID]; exists {
+		return state.SpaceID
+	}
+	return ""
+}
+
+// announceCreated sends the "sandbox_created" event of a sandbox that just started.
+func (m *SandboxManager) announceCreated(sandboxID string) {
+	m.mu.RLock()
+	state, exists := m.sandboxes[sandboxID]
+	if !exists {
+		m.mu.RUnlock()
+		return
+	}
+	spaceID := state.SpaceID
+	data := SpaceSandboxEventData{SandboxID: sandboxID, Name: state.Name, Image: state.Image, Hostname: state.Hostname, Labels: state.Labels}
+	m.mu.RUnlock()
+	m.pushSpaceEvent(spaceID, SpaceEventSandboxCreated, data)
+}
+
+// announceActionEnd sends the "action_completed" event of an action to the space of its
+// sandbox.
+func (m *SandboxManager) announceActionEnd(sandboxID, actionID string, data EndObservationData) {
+	m.pushSpaceEvent(m.spaceOf(sandboxID), SpaceEventActionDone, ActionCompletedData{
+		SandboxID: sandboxID,
+		ActionID:  actionID,
+		ExitCode:  data.ExitCode,
+		Error:     data.Error,
+		Signal:    data.Signal,
+		OOMKilled: data.OOMKilled,
+		CacheHit:  data.CacheHit,
+	})
+}
+
+// warnDiskUsage sends the "quota_warning" event of a sandbox nearing the disk threshold.
+func (m *SandboxManager) warnDiskUsage(sandboxID string, usage int64) {
+	m.logger.Warn("Sandbox disk usage nears the kill threshold", "sandboxID", sandboxID, "usage", usage, "threshold", m.diskKillThreshold)
+	m.pushSpaceEvent(m.spaceOf(sandboxID), SpaceEventQuotaWarning, QuotaWarningData{SandboxID: sandboxID, Quota: "disk", Used: usage, Limit: m.diskKillThreshold})
+}
@@ -0,0 +1,68 @@
+package manager
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/docker/docker/api/types/mount"
+	"github.com/docker/docker/client"
+)
+
+var (
+	ErrVolumeNotFound     = newError(KindInvalid, "volume_not_found", "volume not found")
+	ErrVolumePathConflict = newError(KindInvalid, "volume_path_conflict", "path is already a mount of the space")
+)
+
+// SpaceVolume is an existing Docker volume, such as a dataset, mounted read-only at Path
+// into every sandbox created in its space.
+type SpaceVolume struct {
+	Volume string `json:"volume"`
+	Path   string `json:"path"`
+}
+
+// SetSpaceVolumes replaces the shared volumes of a space. They are mounted into sandboxes
+// created from then on.
+func (sm *SpaceManager) SetSpaceVolumes(ctx context.Context, spaceID string, volumes []SpaceVolume) error {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+	space, exists := sm.spaces[spaceID]
+	if !exists || !visible(ctx, space) {
+		return ErrSpaceNotFound
+	}
+	space.Volumes = volumes
+	return nil
+}
+
+// spaceVolumeMounts returns the read-only mounts of the shared volumes of a space, checking
+// that the volumes exist, since Docker would create missing ones empty, and that the spec
+// mounts nothing else at their paths.
+func (m *SandboxManager) spaceVolumeMounts(ctx context.Context, space *SpaceState, spec SandboxSpec) ([]mount.Mount, error) {
+	if len(space.Volumes) == 0 {
+		return nil, nil
+	}
+	taken := make(map[string]bool, len(spec.Volumes)+len(spec.Tmpfs))
+	for _, v := range spec.Volumes {
+		taken[v.Path] = true
+	}
+	for p := range spec.Tmpfs {
+		taken[p] = true
+	}
+
+	inspectCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	mounts := make([]mount.Mount, 0, len(space.Volumes))
+	for _, v := range space.Volumes {
+		if taken[v.Path] {
+			return nil, fmt.Errorf("%w: %q", ErrVolumePathConflict, v.Path)
+		}
+		if _, err := m.docker().VolumeInspect(inspectCtx, v.Volume); err != nil {
+			if client.IsErrNotFound(err) {
+				return nil, fmt.Errorf("%w: %q, shared by space %s", ErrVolumeNotFound, v.Volume, space.ID)
+			}
+			return nil, backendError("volume_inspect_failed", "failed to inspect volume "+v.Volume, err)
+		}
+		mounts = append(mounts, mount.Mount{Type: mount.TypeVolume, Source: v.Volume, Target: v.Path, ReadOnly: true})
+	}
+	return mounts, nil
+}
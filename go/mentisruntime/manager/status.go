@@ -0,0 +1,155 @@
+package manager
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+	"time"
+
+	"github.com/docker/docker/api/types/container"
+)
+
+// StatusObservationData is pushed periodically on the stream of each sandbox so clients can
+// show liveness without polling. Resource fields are omitted when Docker stats are unavailable.
+type StatusObservationData struct {
+	State            SandboxPhase `json:"state"`
+	Running          bool         `json:"running"`
+	Health           string       `json:"health,omitempty"`
+	ActiveActions    int          `json:"active_actions"`
+	QueuedActions    int          `json:"queued_actions,omitempty"` // Active actions waiting in the sandbox's queue
+	CPUPercent       float64      `json:"cpu_percent,omitempty"`
+	MemoryBytes      uint64       `json:"memory_bytes,omitempty"`
+	MemoryLimitBytes uint64       `json:"memory_limit_bytes,omitempty"`
+}
+
+// WithStatusHeartbeat pushes a "status" observation for every sandbox at the given interval.
+// Zero disables the heartbeat.
+func WithStatusHeartbeat(interval time.Duration) Option {
+	return func(m *SandboxManager) {
+		m.statusInterval = interval
+	}
+}
+
+// runStatusHeartbeat pushes status observations until ctx is done.
+func (m *SandboxManager) runStatusHeartbeat(ctx context.Context) {
+	ticker := time.NewTicker(m.statusInterval)
+	defer ticker.Stop()
+	m.logger.Info("Status heartbeat started", "interval", m.statusInterval)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			m.pushStatuses(ctx)
+		}
+	}
+}
+
+// pushStatuses samples every sandbox concurrently, since a stats sample takes about a second.
+func (m *SandboxManager) pushStatuses(ctx context.Context) {
+	type target struct {
+		sandboxID   string
+		containerID string
+		data        StatusObservationData
+	}
+	m.mu.RLock()
+	targets := make([]target, 0, len(m.sandboxes))
+	for id, state := range m.sandboxes {
+		targets = append(targets, target{
+			sandboxID:   id,
+			containerID: state.ContainerID,
+			data:        StatusObservationData{State: state.Phase, Running: state.IsRunning, Health: state.Health},
+		})
+	}
+	m.mu.RUnlock()
+
+	var wg sync.WaitGroup
+	for _, t := range targets {
+		wg.Add(1)
+		err := m.submit(ctx, m.dockerPool, func() {
+			defer wg.Done()
+			if t.data.Running {
+				m.sampleContainerStats(ctx, t.containerID, &t.data)
+			}
+			m.mu.RLock()
+			t.data.ActiveActions = m.activeActionCountLocked(t.sandboxID)
+			t.data.QueuedActions = m.queuedActionCountLocked(t.sandboxID)
+			m.mu.RUnlock()
+			m.pushStatus(t.sandboxID, t.data)
+		})
+		if err != nil {
+			wg.Done()
+		}
+	}
+	wg.Wait()
+}
+
+// sampleContainerStats fills in the CPU and memory usage of a container.
+func (m *SandboxManager) sampleContainerStats(ctx context.Context, containerID string, data *StatusObservationData) {
+	statsCtx, cancel := context.WithTimeout(ctx, m.statusInterval)
+	defer cancel()
+	resp, err := m.docker().ContainerStats(statsCtx, containerID, false)
+	if err != nil {
+		m.logger.Debug("Failed to sample container stats", "containerID", containerID, "error", err)
+		return
+	}
+	defer resp.Body.Close()
+	var stats container.StatsResponse
+	if err := json.NewDecoder(resp.Body).Decode(&stats); err != nil {
+		m.logger.Debug("Failed to decode container stats", "containerID", containerID, "error", err)
+		return
+	}
+	data.CPUPercent = cpuPercent(stats)
+	data.MemoryBytes = stats.MemoryStats.Usage
+	// Page cache is reclaimable, so it is not counted, matching "docker stats".
+	if cache, ok := stats.MemoryStats.Stats["inactive_file"]; ok && cache < data.MemoryBytes {
+		data.MemoryBytes -= cache
+	}
+	data.MemoryLimitBytes = stats.MemoryStats.Limit
+}
+
+// cpuPercent computes CPU usage between the previous and current sample, where 100 is one
+// fully used CPU.
+func cpuPercent(stats container.StatsResponse) float64 {
+	cpuDelta := float64(stats.CPUStats.CPUUsage.TotalUsage) - float64(stats.PreCPUStats.CPUUsage.TotalUsage)
+	systemDelta := float64(stats.CPUStats.SystemUsage) - float64(stats.PreCPUStats.SystemUsage)
+	if cpuDelta <= 0 || systemDelta <= 0 {
+		return 0
+	}
+	cpus := float64(stats.CPUStats.OnlineCPUs)
+	if cpus == 0 {
+		cpus = float64(len(stats.CPUStats.CPUUsage.PercpuUsage))
+	}
+	return cpuDelta / systemDelta * cpus * 100
+}
+
+// pushStatus sends a status observation to the sandbox's stream subscribers only. Statuses
+// are transient, so they are kept out of the history and the observations log.
+func (m *SandboxManager) pushStatus(sandboxID string, data StatusObservationData) {
+	if m.hub == nil {
+		return
+	}
+	message, err := json.Marshal(Observation{
+		ObservationType: "status",
+		Timestamp:       time.Now().UTC().Format(time.RFC3339Nano),
+		Data:            data,
+	})
+	if err != nil {
+		m.logger.Error("Failed to marshal status observation", "sandboxID", sandboxID, "error", err)
+		return
+	}
+	m.hub.SubmitBroadcast(sandboxID, message)
+}
+
+// activeActionCountLocked returns the number of actions of a sandbox that have not ended,
+// including queued ones. Callers must hold m.mu.
+func (m *SandboxManager) activeActionCountLocked(sandboxID string) int {
+	n := 0
+	for _, id := range m.activeActions {
+		if id == sandboxID {
+			n++
+		}
+	}
+	return n
+}
@@ -0,0 +1,23 @@
+package manager
+
+import (
+	"testing"
+
+	"github.com/docker/docker/api/types/container"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCPUPercent(t *testing.T) {
+	var stats container.StatsResponse
+	stats.PreCPUStats.CPUUsage.TotalUsage = 1000
+	stats.PreCPUStats.SystemUsage = 10000
+	stats.CPUStats.CPUUsage.TotalUsage = 1500
+	stats.CPUStats.SystemUsage = 12000
+	stats.CPUStats.OnlineCPUs = 2
+	require.InDelta(t, 50.0, cpuPercent(stats), 0.001)
+
+	// A one-shot sample has no previous reading.
+	stats.PreCPUStats = container.CPUStats{}
+	stats.CPUStats.SystemUsage = 0
+	require.Zero(t, cpuPercent(stats))
+}
@@ -0,0 +1,141 @@
+package manager
+
+import (
+	"hash"
+	"strconv"
+	"strings"
+)
+
+// Aggregates of an action's output that its "end" observation can carry, chosen with the
+// "aggregate" field of the action.
+const (
+	AggregateMerged   = "merged"   // "output": stdout and stderr lines in the order received
+	AggregateSeparate = "separate" // "stdout" and "stderr"
+)
+
+// maxAggregateBytes caps the output an "end" observation carries. Lines past it are left
+// out, and the "end" is flagged with "output_truncated".
+const maxAggregateBytes = 1 << 20
+
+// actionStreams numbers the "stream" observations of an action and collects its aggregate.
+type actionStreams struct {
+	seq       map[string]uint64 // Last stream_seq, by stream
+	aggregate string
+	output    map[string]*strings.Builder // By stream, or under "" for AggregateMerged
+	size      int
+	truncated bool
+	// Output kept for the result cache, for actions run with "cache": true
+	cacheKey    string
+	lines       []cachedLine
+	cachedBytes int
+	uncacheable bool
+	// Record of the action for replays, and the digest of its lines
+	recordedAction *RecordedAction
+	digest         hash.Hash
+}
+
+// startStreamsLocked records the aggregate an action asks for, if any. Callers must hold m.mu.
+func (m *SandboxManager) startStreamsLocked(actionID string, payload map[string]interface{}) {
+	if aggregate, _ := payload["aggregate"].(string); aggregate != "" {
+		m.actionStreams[actionID] = &actionStreams{aggregate: aggregate}
+	}
+}
+
+// sequenceStream numbers a "stream" observation of an active action with stream_seq: 1 for
+// its first observation of that stream, counting up from there. Together with seq, which
+// orders all observations of a sandbox, clients can check that they hold every line of a
+// stream and rebuild the interleaving of stdout and stderr. Text lines are added to the
+// action's aggregate. It returns the message with the number.
+func (m *SandboxManager) sequenceStream(obs *internalObservation, message []byte) []byte {
+	if obs.ActionID == "" || obs.Stream == "" {
+		return message
+	}
+	m.mu.Lock()
+	if _, active := m.activeActions[obs.ActionID]; !active {
+		m.mu.Unlock()
+		return message
+	}
+	s := m.actionStreams[obs.ActionID]
+	if s == nil {
+		s = &actionStreams{}
+		m.actionStreams[obs.ActionID] = s
+	}
+	if s.seq == nil {
+		s.seq = make(map[string]uint64)
+	}
+	s.seq[obs.Stream]++
+	obs.StreamSeq = s.seq[obs.Stream]
+	if obs.Line != nil && obs.Encoding != EncodingBase64 {
+		s.add(obs.Stream, *obs.Line)
+	}
+	s.record(obs)
+	if s.digest != nil && obs.Line != nil {
+		digestLine(s.digest, obs.Stream, *obs.Line)
+	}
+	m.mu.Unlock()
+	return withField(message, "stream_seq", strconv.AppendUint(nil, obs.StreamSeq, 10))
+}
+
+// add appends a line of a stream to the aggregate, if the action asked for one.
+func (s *actionStreams) add(stream, line string) {
+	if s.aggregate == "" || s.truncated {
+		return
+	}
+	if !strings.HasSuffix(line, "\n") {
+		line += "\n"
+	}
+	if s.size+len(line) > maxAggregateBytes {
+		s.truncated = true
+		return
+	}
+	key := stream
+	if s.aggregate == AggregateMerged {
+		key = ""
+	}
+	if s.output == nil {
+		s.output = make(map[string]*strings.Builder)
+	}
+	b := s.output[key]
+	if b == nil {
+		b = &strings.Builder{}
+		s.output[key] = b
+	}
+	b.WriteString(line)
+	s.size += len(line)
+}
+
+// endStreams forgets the streams of an ended action and adds its aggregate, if it asked for
+// one, to data, which may be nil. The result of an action run with "cache": true is cached.
+func (m *SandboxManager) endStreams(actionID string, data *EndObservationData) {
+	m.mu.Lock()
+	s := m.actionStreams[actionID]
+	delete(m.actionStreams, actionID)
+	m.mu.Unlock()
+	if s == nil || data == nil {
+		return
+	}
+	if s.cacheKey != "" {
+		m.storeResult(s, *data)
+	}
+	s.fill(data)
+}
+
+// fill adds the aggregate of an action to its "end" data, if it asked for one.
+func (s *actionStreams) fill(data *EndObservationData) {
+	text := func(key string) *string {
+		t := ""
+		if b := s.output[key]; b != nil {
+			t = b.String()
+		}
+		return &t
+	}
+	switch s.aggregate {
+	case AggregateMerged:
+		data.Output = text("")
+	case AggregateSeparate:
+		data.Stdout, data.Stderr = text("stdout"), text("stderr")
+	default:
+		return
+	}
+	data.OutputTruncated = s.truncated
+}
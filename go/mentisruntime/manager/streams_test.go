@@ -0,0 +1,47 @@
+package manager
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSequenceStream_numbersEachStream(t *testing.T) {
+	m := &SandboxManager{activeActions: map[string]string{"a": "sb"}, actionStreams: map[string]*actionStreams{}}
+	m.startStreamsLocked("a", map[string]interface{}{"aggregate": AggregateMerged})
+
+	var seqs []uint64
+	for _, line := range []struct{ stream, text string }{{"stdout", "one"}, {"stderr", "oops"}, {"stdout", "two"}} {
+		text := line.text
+		obs := &internalObservation{ActionID: "a", Stream: line.stream, Line: &text}
+		msg := m.sequenceStream(obs, []byte(`{"observation_type":"stream"}`))
+		require.Contains(t, string(msg), `"stream_seq":`)
+		seqs = append(seqs, obs.StreamSeq)
+	}
+	require.Equal(t, []uint64{1, 1, 2}, seqs)
+
+	data := EndObservationData{}
+	m.endStreams("a", &data)
+	require.Equal(t, "one\noops\ntwo\n", *data.Output)
+	require.Nil(t, data.Stdout)
+	require.Empty(t, m.actionStreams)
+
+	// Observations of ended actions are not numbered
+	text := "late"
+	obs := &internalObservation{ActionID: "b", Stream: "stdout", Line: &text}
+	require.Equal(t, `{}`, string(m.sequenceStream(obs, []byte(`{}`))))
+}
+
+func TestEndStreams_separateAndTruncated(t *testing.T) {
+	s := &actionStreams{aggregate: AggregateSeparate}
+	s.add("stdout", "out")
+	s.add("stderr", strings.Repeat("x", maxAggregateBytes))
+	m := &SandboxManager{actionStreams: map[string]*actionStreams{"a": s}}
+
+	data := EndObservationData{}
+	m.endStreams("a", &data)
+	require.Equal(t, "out\n", *data.Stdout)
+	require.Equal(t, "", *data.Stderr)
+	require.True(t, data.OutputTruncated)
+}
@@ -0,0 +1,64 @@
+package manager
+
+import (
+	"context"
+	"time"
+)
+
+// DefaultSpaceID is the space used when a request names the "default" space. Tenants get
+// their own default space instead, see TenantDefaultSpaceID.
+const DefaultSpaceID = "default"
+
+type tenantKey struct{}
+
+// WithTenant returns a context whose space operations are limited to the spaces of tenant.
+// Contexts without a tenant see all spaces, as do internal operations of the runtime.
+func WithTenant(ctx context.Context, tenant string) context.Context {
+	return context.WithValue(ctx, tenantKey{}, tenant)
+}
+
+// TenantFromContext returns the tenant of a context, or "" if it has none.
+func TenantFromContext(ctx context.Context) string {
+	tenant, _ := ctx.Value(tenantKey{}).(string)
+	return tenant
+}
+
+// TenantDefaultSpaceID returns the ID of a tenant's default space.
+func TenantDefaultSpaceID(tenant string) string {
+	if tenant == "" {
+		return DefaultSpaceID
+	}
+	return DefaultSpaceID + "-" + tenant
+}
+
+// ResolveSpaceID maps the "default" space to the default space of the context's tenant,
+// creating it on first use. Other space IDs are returned as is.
+func (sm *SpaceManager) ResolveSpaceID(ctx context.Context, spaceID string) string {
+	tenant := TenantFromContext(ctx)
+	if spaceID != DefaultSpaceID || tenant == "" {
+		return spaceID
+	}
+	spaceID = TenantDefaultSpaceID(tenant)
+
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+	if _, exists := sm.spaces[spaceID]; !exists {
+		now := time.Now()
+		sm.spaces[spaceID] = &SpaceState{
+			ID:        spaceID,
+			Name:      "Default Space",
+			Tenant:    tenant,
+			CreatedAt: now,
+			UpdatedAt: now,
+			Sandboxes: make(map[string]*SandboxState),
+		}
+		sm.logger.Info("Tenant default space created", "spaceID", spaceID, "tenant", tenant)
+	}
+	return spaceID
+}
+
+// visible reports whether a space may be accessed with ctx. Callers must hold sm.mu.
+func visible(ctx context.Context, space *SpaceState) bool {
+	tenant := TenantFromContext(ctx)
+	return tenant == "" || space.Tenant == tenant
+}
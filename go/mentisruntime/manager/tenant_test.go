@@ -0,0 +1,89 @@
+package manager
+
+import (
+	"context"
+	"log/slog"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/foreveryh/sandboxai/go/mentisruntime/secret"
+)
+
+func TestSpaceManager_isolatesTenants(t *testing.T) {
+	sm := NewSpaceManager(slog.Default())
+	acme := WithTenant(context.Background(), "acme")
+	globex := WithTenant(context.Background(), "globex")
+
+	spaceID := sm.ResolveSpaceID(acme, DefaultSpaceID)
+	require.Equal(t, "default-acme", spaceID)
+	require.Equal(t, spaceID, sm.ResolveSpaceID(acme, DefaultSpaceID))
+	require.Equal(t, "other", sm.ResolveSpaceID(acme, "other"))
+	require.Equal(t, DefaultSpaceID, sm.ResolveSpaceID(context.Background(), DefaultSpaceID))
+
+	_, err := sm.GetSpace(globex, spaceID)
+	require.ErrorIs(t, err, ErrSpaceNotFound)
+	_, err = sm.GetSpace(globex, DefaultSpaceID)
+	require.ErrorIs(t, err, ErrSpaceNotFound)
+	require.ErrorIs(t, sm.DeleteSpace(globex, spaceID, false), ErrSpaceNotFound)
+
+	// The same name may be used by different tenants.
+	_, err = sm.CreateSpace(acme, "work", "", nil)
+	require.NoError(t, err)
+	_, err = sm.CreateSpace(globex, "work", "", nil)
+	require.NoError(t, err)
+	_, err = sm.CreateSpace(acme, "work", "", nil)
+	require.ErrorIs(t, err, ErrSpaceNameConflict)
+
+	spaces, err := sm.ListSpaces(acme)
+	require.NoError(t, err)
+	require.Len(t, spaces, 2)
+	spaces, err = sm.ListSpaces(context.Background())
+	require.NoError(t, err)
+	require.Len(t, spaces, 4)
+}
+
+func TestSandboxExists_onlyInTenantSpaces(t *testing.T) {
+	sm := NewSpaceManager(slog.Default())
+	acme := WithTenant(context.Background(), "acme")
+	globex := WithTenant(context.Background(), "globex")
+	spaceID := sm.ResolveSpaceID(acme, DefaultSpaceID)
+	m := &SandboxManager{
+		spaceManager: sm,
+		sandboxes:    map[string]*SandboxState{"sb": {ID: "sb", SpaceID: spaceID}},
+		creations:    map[string]*CreationProgress{"new": {SandboxID: "new", SpaceID: spaceID}},
+	}
+
+	for _, sandboxID := range []string{"sb", "new"} {
+		exists, err := m.SandboxExists(acme, sandboxID)
+		require.NoError(t, err)
+		require.True(t, exists, sandboxID)
+		exists, err = m.SandboxExists(globex, sandboxID)
+		require.NoError(t, err)
+		require.False(t, exists, "another tenant's sandbox %s", sandboxID)
+		exists, err = m.SandboxExists(context.Background(), sandboxID)
+		require.NoError(t, err)
+		require.True(t, exists, sandboxID)
+	}
+}
+
+func TestSecrets_isolateTenants(t *testing.T) {
+	store, err := secret.NewStore(make([]byte, 32), "")
+	require.NoError(t, err)
+	m := &SandboxManager{logger: slog.Default(), secretStore: store}
+	acme := WithTenant(context.Background(), "acme")
+	_, err = m.PutSecret(acme, "TOKEN", "acme-value", "")
+	require.NoError(t, err)
+
+	env, _, err := m.resolveSecrets("acme", []SecretRef{{Name: "TOKEN"}})
+	require.NoError(t, err)
+	require.Equal(t, []string{"TOKEN=acme-value"}, env)
+	// Sandboxes of other tenants cannot reference it, nor can other tenants see it
+	_, _, err = m.resolveSecrets("globex", []SecretRef{{Name: "TOKEN"}})
+	require.ErrorIs(t, err, ErrInvalid)
+	_, err = m.GetSecret(WithTenant(context.Background(), "globex"), "TOKEN")
+	require.ErrorIs(t, err, ErrNotFound)
+	secrets, err := m.ListSecrets(context.Background())
+	require.NoError(t, err)
+	require.Empty(t, secrets)
+}
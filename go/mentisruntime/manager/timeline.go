@@ -0,0 +1,182 @@
+package manager
+
+import (
+	"context"
+	"encoding/json"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/foreveryh/sandboxai/go/mentisruntime/history"
+)
+
+// maxTimelineLabel caps the command or code shown as the label of a timeline span.
+const maxTimelineLabel = 120
+
+// Timeline is a sandbox session as spans of actions and point events over time, built from
+// the observation history, for rendering Gantt-style traces.
+type Timeline struct {
+	SandboxID string          `json:"sandbox_id"`
+	Start     *time.Time      `json:"start,omitempty"` // First observation in range
+	End       *time.Time      `json:"end,omitempty"`   // Last observation in range
+	Actions   []*TimelineSpan `json:"actions"`         // By start time
+	Events    []TimelineEvent `json:"events"`          // Observations of no action, such as "sandbox_state"
+}
+
+// TimelineSpan is an action from its "start" to its "end" observation.
+type TimelineSpan struct {
+	ActionID   string     `json:"action_id"`
+	ActionType string     `json:"action_type,omitempty"` // From the action recording, if still recorded
+	Label      string     `json:"label,omitempty"`       // First line of the command or code
+	Start      time.Time  `json:"start"`
+	End        *time.Time `json:"end,omitempty"` // Unset while the action runs
+	DurationMS *int64     `json:"duration_ms,omitempty"`
+	// FirstOutputMS is when the first "stream" line arrived, after Start
+	FirstOutputMS *int64         `json:"first_output_ms,omitempty"`
+	ExitCode      *int           `json:"exit_code,omitempty"`
+	Lines         map[string]int `json:"lines,omitempty"` // "stream" lines by stream
+	Bytes         int            `json:"bytes"`           // Of "stream" lines
+	Observations  int            `json:"observations"`
+	// Partial is set when the history no longer holds the action's "start", which was
+	// dropped by the retention limit or lies before the queried range
+	Partial bool            `json:"partial,omitempty"`
+	Events  []TimelineEvent `json:"events,omitempty"` // Other observations of the action, such as "error"
+}
+
+// TimelineEvent is an observation shown as a point in time.
+type TimelineEvent struct {
+	Seq             uint64    `json:"seq"`
+	ObservationType string    `json:"observation_type"`
+	Timestamp       time.Time `json:"timestamp"`
+}
+
+// timelineObservation holds the fields of an observation the timeline reads.
+type timelineObservation struct {
+	Stream    string `json:"stream"`
+	Line      string `json:"line"`
+	Coalesced int    `json:"coalesced"`
+	Data      struct {
+		ExitCode *int `json:"exit_code"`
+	} `json:"data"`
+}
+
+// GetTimeline returns the timeline of a sandbox's recorded observations between since
+// (inclusive) and until (exclusive); zero times do not bound it.
+func (m *SandboxManager) GetTimeline(ctx context.Context, sandboxID string, since, until time.Time) (*Timeline, error) {
+	if m.history == nil {
+		return nil, ErrHistoryDisabled
+	}
+	m.mu.RLock()
+	_, exists := m.sandboxes[sandboxID]
+	m.mu.RUnlock()
+	if !exists {
+		return nil, ErrSandboxNotFound
+	}
+
+	var records []history.Record
+	q := history.Query{Since: since, Until: until, Limit: history.MaxLimit}
+	for {
+		page, err := m.queryHistory(sandboxID, q)
+		if err != nil {
+			return nil, err
+		}
+		records = append(records, page.Observations...)
+		if page.NextCursor == "" {
+			break
+		}
+		q.Cursor = page.NextCursor
+	}
+
+	timeline := buildTimeline(sandboxID, records)
+	m.labelSpans(sandboxID, timeline.Actions)
+	return timeline, nil
+}
+
+// buildTimeline turns a sandbox's observations, in sequence order, into a timeline.
+func buildTimeline(sandboxID string, records []history.Record) *Timeline {
+	timeline := &Timeline{SandboxID: sandboxID, Actions: []*TimelineSpan{}, Events: []TimelineEvent{}}
+	spans := make(map[string]*TimelineSpan)
+	for _, rec := range records {
+		if timeline.Start == nil {
+			start := rec.Timestamp
+			timeline.Start = &start
+		}
+		end := rec.Timestamp
+		timeline.End = &end
+		event := TimelineEvent{Seq: rec.Seq, ObservationType: rec.ObservationType, Timestamp: rec.Timestamp}
+		if rec.ActionID == "" {
+			timeline.Events = append(timeline.Events, event)
+			continue
+		}
+
+		span := spans[rec.ActionID]
+		if span == nil {
+			span = &TimelineSpan{ActionID: rec.ActionID, Start: rec.Timestamp, Partial: rec.ObservationType != "start"}
+			spans[rec.ActionID] = span
+			timeline.Actions = append(timeline.Actions, span)
+		}
+		span.Observations++
+		var obs timelineObservation
+		switch rec.ObservationType {
+		case "start":
+		case "stream":
+			if json.Unmarshal(rec.Observation, &obs) != nil || obs.Stream == "" {
+				break
+			}
+			if span.Lines == nil {
+				span.Lines = make(map[string]int)
+			}
+			span.Lines[obs.Stream] += max(obs.Coalesced, 1)
+			span.Bytes += len(obs.Line)
+			if span.FirstOutputMS == nil {
+				ms := rec.Timestamp.Sub(span.Start).Milliseconds()
+				span.FirstOutputMS = &ms
+			}
+		case "end":
+			end := rec.Timestamp
+			ms := end.Sub(span.Start).Milliseconds()
+			span.End, span.DurationMS = &end, &ms
+			if json.Unmarshal(rec.Observation, &obs) == nil {
+				span.ExitCode = obs.Data.ExitCode
+			}
+		case "result":
+			// The agent's report; the "end" that follows closes the span
+		default:
+			span.Events = append(span.Events, event)
+		}
+	}
+	sort.SliceStable(timeline.Actions, func(i, j int) bool {
+		return timeline.Actions[i].Start.Before(timeline.Actions[j].Start)
+	})
+	return timeline
+}
+
+// labelSpans sets the action type and label of spans from the sandbox's action recording.
+func (m *SandboxManager) labelSpans(sandboxID string, spans []*TimelineSpan) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	rec := m.recordings[sandboxID]
+	if rec == nil {
+		return
+	}
+	byID := make(map[string]*RecordedAction, len(rec.actions))
+	for _, action := range rec.actions {
+		byID[action.ActionID] = action
+	}
+	for _, span := range spans {
+		action := byID[span.ActionID]
+		if action == nil {
+			continue
+		}
+		span.ActionType = action.ActionType
+		source, _ := action.Payload["command"].(string)
+		if action.ActionType == "ipython" {
+			source, _ = action.Payload["code"].(string)
+		}
+		source, _, _ = strings.Cut(strings.TrimSpace(source), "\n")
+		if len(source) > maxTimelineLabel {
+			source = strings.ToValidUTF8(source[:maxTimelineLabel], "") + "…"
+		}
+		span.Label = source
+	}
+}
@@ -0,0 +1,53 @@
+package manager
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/foreveryh/sandboxai/go/mentisruntime/history"
+)
+
+func TestBuildTimeline(t *testing.T) {
+	t0 := time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC)
+	at := func(ms int) time.Time { return t0.Add(time.Duration(ms) * time.Millisecond) }
+	var seq uint64
+	rec := func(obsType, actionID string, ms int, observation string) history.Record {
+		seq++
+		return history.Record{Seq: seq, ObservationType: obsType, ActionID: actionID, Timestamp: at(ms), Observation: json.RawMessage(observation)}
+	}
+	timeline := buildTimeline("sb", []history.Record{
+		rec("stream", "old", 0, `{"stream":"stdout","line":"tail"}`), // Its start is no longer recorded
+		rec("sandbox_state", "", 5, `{}`),
+		rec("start", "a", 10, `{}`),
+		rec("stream", "a", 40, `{"stream":"stdout","line":"one\ntwo","coalesced":2}`),
+		rec("stream", "a", 50, `{"stream":"stderr","line":"oops"}`),
+		rec("error", "a", 55, `{}`),
+		rec("result", "a", 60, `{"exit_code":1}`),
+		rec("end", "a", 70, `{"data":{"exit_code":1}}`),
+		rec("start", "b", 80, `{}`),
+	})
+
+	require.Equal(t, at(0), *timeline.Start)
+	require.Equal(t, at(80), *timeline.End)
+	require.Equal(t, []TimelineEvent{{Seq: 2, ObservationType: "sandbox_state", Timestamp: at(5)}}, timeline.Events)
+	require.Len(t, timeline.Actions, 3)
+	require.True(t, timeline.Actions[0].Partial)
+	require.Nil(t, timeline.Actions[0].End)
+
+	a := timeline.Actions[1]
+	require.False(t, a.Partial)
+	require.Equal(t, int64(60), *a.DurationMS)
+	require.Equal(t, int64(30), *a.FirstOutputMS)
+	require.Equal(t, 1, *a.ExitCode)
+	require.Equal(t, map[string]int{"stdout": 2, "stderr": 1}, a.Lines)
+	require.Equal(t, 11, a.Bytes)
+	require.Equal(t, 6, a.Observations)
+	require.Equal(t, []TimelineEvent{{Seq: 6, ObservationType: "error", Timestamp: at(55)}}, a.Events)
+
+	b := timeline.Actions[2]
+	require.Nil(t, b.End)
+	require.Nil(t, b.DurationMS)
+}
@@ -0,0 +1,143 @@
+package manager
+
+import (
+	"archive/tar"
+	"context"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/client"
+)
+
+// TransferEndpoint is a path in a sandbox that files are copied from or to.
+type TransferEndpoint struct {
+	SandboxID string `json:"sandbox_id"`
+	Path      string `json:"path"`
+}
+
+// FileTransfer is a file or directory copied from one sandbox of a space to another.
+type FileTransfer struct {
+	SpaceID     string           `json:"space_id"`
+	Source      TransferEndpoint `json:"source"`
+	Destination TransferEndpoint `json:"destination"`
+	Files       int              `json:"files"` // Regular files copied
+	Bytes       int64            `json:"bytes"` // Of regular files
+	StartedAt   time.Time        `json:"started_at"`
+	FinishedAt  time.Time        `json:"finished_at"`
+}
+
+// TransferFiles copies a file or directory between two sandboxes of a space, streaming it
+// from one container to the other through the runtime. Paths follow "docker cp": if the
+// destination is an existing directory the source is copied into it, otherwise it is
+// copied to the destination path, whose parent directory must exist.
+func (m *SandboxManager) TransferFiles(ctx context.Context, spaceID string, src, dst TransferEndpoint) (*FileTransfer, error) {
+	srcState, err := m.sandboxInSpace(spaceID, src.SandboxID)
+	if err != nil {
+		return nil, err
+	}
+	dstState, err := m.sandboxInSpace(spaceID, dst.SandboxID)
+	if err != nil {
+		return nil, err
+	}
+	transfer := &FileTransfer{SpaceID: spaceID, Source: src, Destination: dst, StartedAt: time.Now().UTC()}
+
+	// Where the archive is extracted, and what its root entry is called there
+	targetDir, targetName := dst.Path, ""
+	stat, err := m.docker().ContainerStatPath(ctx, dstState.ContainerID, dst.Path)
+	switch {
+	case err == nil && stat.Mode.IsDir():
+	case err == nil || client.IsErrNotFound(err):
+		targetDir, targetName = path.Dir(path.Clean(dst.Path)), path.Base(dst.Path)
+	default:
+		return nil, backendError("copy_failed", "failed to stat "+dst.Path+" in sandbox "+dst.SandboxID, err)
+	}
+
+	rc, srcStat, err := m.docker().CopyFromContainer(ctx, srcState.ContainerID, src.Path)
+	if err != nil {
+		if client.IsErrNotFound(err) {
+			return nil, &Error{Kind: KindNotFound, Code: "path_not_found", Message: "path not found in sandbox " + src.SandboxID + ": " + src.Path, Err: err}
+		}
+		return nil, backendError("copy_failed", "failed to copy "+src.Path+" from sandbox "+src.SandboxID, err)
+	}
+	defer rc.Close()
+
+	pr, pw := io.Pipe()
+	copied := make(chan error, 1)
+	go func() {
+		err := renameArchive(tar.NewReader(rc), tar.NewWriter(pw), srcStat.Name, targetName, transfer)
+		pw.CloseWithError(err)
+		copied <- err
+	}()
+	err = m.docker().CopyToContainer(ctx, dstState.ContainerID, targetDir, pr, container.CopyToContainerOptions{})
+	pr.CloseWithError(err) // Unblocks the writer if the destination gave up early
+	if copyErr := <-copied; err == nil {
+		err = copyErr
+	}
+	if err != nil {
+		if client.IsErrNotFound(err) {
+			return nil, &Error{Kind: KindNotFound, Code: "path_not_found", Message: "directory not found in sandbox " + dst.SandboxID + ": " + targetDir, Err: err}
+		}
+		return nil, backendError("copy_failed", "failed to copy "+src.Path+" to sandbox "+dst.SandboxID, err)
+	}
+
+	transfer.FinishedAt = time.Now().UTC()
+	m.logger.Info("Files transferred", "spaceID", spaceID, "from", src.SandboxID, "source", src.Path,
+		"to", dst.SandboxID, "destination", dst.Path, "files", transfer.Files, "bytes", transfer.Bytes)
+	return transfer, nil
+}
+
+// sandboxInSpace returns a sandbox, which must belong to the space.
+func (m *SandboxManager) sandboxInSpace(spaceID, sandboxID string) (*SandboxState, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	state, exists := m.sandboxes[sandboxID]
+	if !exists || state.SpaceID != spaceID {
+		return nil, fmt.Errorf("%w: %q", ErrSandboxNotFound, sandboxID)
+	}
+	return state, nil
+}
+
+// renameArchive copies a "docker cp" archive, whose entries are rooted at from, renaming
+// the root to to unless that is empty, and counts the regular files in transfer.
+func renameArchive(tr *tar.Reader, tw *tar.Writer, from, to string, transfer *FileTransfer) error {
+	rename := func(name string) string {
+		if to == "" {
+			return name
+		}
+		if name == from {
+			return to
+		}
+		if rest, ok := strings.CutPrefix(name, from+"/"); ok {
+			return to + "/" + rest
+		}
+		return name
+	}
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return tw.Close()
+		}
+		if err != nil {
+			return err
+		}
+		hdr.Name = rename(hdr.Name)
+		if hdr.Typeflag == tar.TypeLink {
+			hdr.Linkname = rename(hdr.Linkname)
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+		n, err := io.Copy(tw, tr)
+		if err != nil {
+			return err
+		}
+		if hdr.Typeflag == tar.TypeReg {
+			transfer.Files++
+			transfer.Bytes += n
+		}
+	}
+}
@@ -0,0 +1,69 @@
+package manager
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/docker/docker/api/types/container"
+)
+
+var ErrInvalidUlimit = newError(KindInvalid, "invalid_ulimit", "invalid ulimit")
+
+// Ulimits sandboxes can set. Without them the container gets the Docker daemon's defaults.
+const (
+	UlimitNofile = "nofile" // Open file descriptors per process
+	UlimitNproc  = "nproc"  // Processes of the container's uid, counted across the host
+	UlimitCore   = "core"   // Core dump size in bytes
+)
+
+// Ulimit is a soft and a hard resource limit.
+type Ulimit struct {
+	Soft int64 `json:"soft"`
+	Hard int64 `json:"hard"`
+}
+
+// validateUlimits checks the names of ulimits and that 0 <= soft <= hard.
+func validateUlimits(ulimits map[string]Ulimit) error {
+	for name, limit := range ulimits {
+		switch name {
+		case UlimitNofile, UlimitNproc, UlimitCore:
+		default:
+			return fmt.Errorf("%w %q: must be one of %s, %s, %s", ErrInvalidUlimit, name, UlimitNofile, UlimitNproc, UlimitCore)
+		}
+		if limit.Soft < 0 || limit.Soft > limit.Hard {
+			return fmt.Errorf("%w %q: soft limit must be between 0 and the hard limit", ErrInvalidUlimit, name)
+		}
+	}
+	return nil
+}
+
+// checkUlimits rejects ulimits of a spec above the hard limits of its security profile, which
+// they may only lower.
+func checkUlimits(profile SecurityProfile, spec SandboxSpec) error {
+	for name, limit := range spec.Ulimits {
+		if ceiling, ok := profile.Ulimits[name]; ok && limit.Hard > ceiling.Hard {
+			return fmt.Errorf("%w: %s hard limit %d is above %d of profile %q", ErrIncompatibleSecurityProfile, name, limit.Hard, ceiling.Hard, profile.Name)
+		}
+	}
+	return nil
+}
+
+// applyUlimits sets the ulimits of a spec on the host config, over those of its security
+// profile. checkUlimits keeps them within the profile's.
+func applyUlimits(profile SecurityProfile, spec SandboxSpec, hostCfg *container.HostConfig) {
+	ulimits := make(map[string]Ulimit, len(profile.Ulimits)+len(spec.Ulimits))
+	for name, limit := range profile.Ulimits {
+		ulimits[name] = limit
+	}
+	for name, limit := range spec.Ulimits {
+		ulimits[name] = limit
+	}
+	names := make([]string, 0, len(ulimits))
+	for name := range ulimits {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		hostCfg.Ulimits = append(hostCfg.Ulimits, &container.Ulimit{Name: name, Soft: ulimits[name].Soft, Hard: ulimits[name].Hard})
+	}
+}
@@ -0,0 +1,376 @@
+package manager
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/docker/docker/api/types/container"
+)
+
+var (
+	ErrUsageDisabled     = newError(KindUnavailable, "usage_disabled", "usage accounting is not enabled on this runtime")
+	ErrInvalidUsageRange = newError(KindInvalid, "invalid_usage_range", "invalid usage range")
+)
+
+const (
+	usageBucket    = time.Hour           // Granularity of usage reports
+	usageRetention = 90 * 24 * time.Hour // Age past which usage buckets are dropped
+)
+
+// UsageTotals is the resource usage of a sandbox, or the sum of that of several.
+type UsageTotals struct {
+	CPUSeconds        float64 `json:"cpu_seconds"`
+	MemoryByteSeconds float64 `json:"memory_byte_seconds"`
+	WallSeconds       float64 `json:"wall_seconds"` // Time the sandbox's container was up
+}
+
+func (t *UsageTotals) add(o UsageTotals) {
+	t.CPUSeconds += o.CPUSeconds
+	t.MemoryByteSeconds += o.MemoryByteSeconds
+	t.WallSeconds += o.WallSeconds
+}
+
+// scaled returns the share of t a fraction of its period accounts for.
+func (t UsageTotals) scaled(fraction float64) UsageTotals {
+	return UsageTotals{
+		CPUSeconds:        t.CPUSeconds * fraction,
+		MemoryByteSeconds: t.MemoryByteSeconds * fraction,
+		WallSeconds:       t.WallSeconds * fraction,
+	}
+}
+
+// SandboxUsage is the usage of a sandbox in a report. Deleted sandboxes remain in reports.
+type SandboxUsage struct {
+	SandboxID string `json:"sandbox_id"`
+	SpaceID   string `json:"space_id"`
+	Tenant    string `json:"tenant,omitempty"`
+	Deleted   bool   `json:"deleted,omitempty"`
+	UsageTotals
+}
+
+// SpaceUsage is the usage of the sandboxes of a space in a report.
+type SpaceUsage struct {
+	SpaceID string `json:"space_id"`
+	Tenant  string `json:"tenant,omitempty"`
+	UsageTotals
+}
+
+// TenantUsage is the usage of the sandboxes of a tenant in a report. Sandboxes of spaces
+// shared by all requests are reported under the empty tenant.
+type TenantUsage struct {
+	Tenant string `json:"tenant"`
+	UsageTotals
+}
+
+// UsageReport is the usage of the hourly buckets that start in [From, To).
+type UsageReport struct {
+	From      time.Time      `json:"from"`
+	To        time.Time      `json:"to"`
+	Total     UsageTotals    `json:"total"`
+	Tenants   []TenantUsage  `json:"tenants"`
+	Spaces    []SpaceUsage   `json:"spaces"`
+	Sandboxes []SandboxUsage `json:"sandboxes"`
+}
+
+// usageMeter accumulates the usage of a sandbox in hourly buckets.
+type usageMeter struct {
+	spaceID   string
+	tenant    string
+	sampledAt time.Time // End of the period accounted so far
+	cpuNanos  uint64    // Cumulative CPU time of the container at sampledAt
+	deleted   bool
+	buckets   map[time.Time]*UsageTotals // By bucket start
+}
+
+// record accounts the usage of the period from sampledAt to now, spread over the buckets it
+// covers in proportion to their share of the period.
+func (u *usageMeter) record(now time.Time, totals UsageTotals) {
+	from := u.sampledAt
+	u.sampledAt = now
+	period := now.Sub(from)
+	if period <= 0 {
+		return
+	}
+	for from.Before(now) {
+		start := from.Truncate(usageBucket)
+		end := start.Add(usageBucket)
+		if end.After(now) {
+			end = now
+		}
+		bucket, ok := u.buckets[start]
+		if !ok {
+			bucket = &UsageTotals{}
+			u.buckets[start] = bucket
+		}
+		bucket.add(totals.scaled(float64(end.Sub(from)) / float64(period)))
+		from = end
+	}
+}
+
+// usageLedger is the usage accounting of a manager.
+type usageLedger struct {
+	interval time.Duration
+
+	mu            sync.Mutex
+	meters        map[string]*usageMeter // By sandbox ID, kept after deletion until their buckets expire
+	tenantBudgets map[string]*Budget     // By tenant
+	warned        map[string]float64     // Highest threshold announced, by budget key
+	exceeded      map[string]bool        // Exhausted budgets, by budget key, as of the last evaluation
+}
+
+// WithUsageAccounting samples the CPU time and memory of every sandbox at the given interval
+// and keeps the usage of each, per hour, for reports.
+func WithUsageAccounting(interval time.Duration) Option {
+	return func(m *SandboxManager) {
+		m.usage = &usageLedger{
+			interval:      interval,
+			meters:        make(map[string]*usageMeter),
+			tenantBudgets: make(map[string]*Budget),
+			warned:        make(map[string]float64),
+		}
+	}
+}
+
+// beginUsage starts metering a sandbox that was just created from the start of its
+// container, unless a sample beat it to it.
+func (m *SandboxManager) beginUsage(sandboxID string) {
+	if m.usage == nil {
+		return
+	}
+	m.mu.RLock()
+	state, exists := m.sandboxes[sandboxID]
+	if !exists {
+		m.mu.RUnlock()
+		return
+	}
+	spaceID, startedAt := state.SpaceID, state.startedAt
+	m.mu.RUnlock()
+	if startedAt.IsZero() {
+		startedAt = time.Now().UTC()
+	}
+	meter := &usageMeter{spaceID: spaceID, sampledAt: startedAt, buckets: make(map[time.Time]*UsageTotals)}
+	if space, err := m.spaceManager.GetSpace(context.Background(), spaceID); err == nil {
+		meter.tenant = space.Tenant
+	}
+	m.usage.mu.Lock()
+	if _, sampled := m.usage.meters[sandboxID]; !sampled {
+		m.usage.meters[sandboxID] = meter
+	}
+	m.usage.mu.Unlock()
+}
+
+// containerUp reports whether the container of a sandbox in a phase is up and consuming
+// resources.
+func containerUp(phase SandboxPhase) bool {
+	return phase != PhaseStopped && phase != PhaseFailed && phase != PhaseDeleted
+}
+
+// endUsage accounts the running time of a sandbox since its last sample as it is deleted.
+func (m *SandboxManager) endUsage(sandboxID string, running bool) {
+	if m.usage == nil {
+		return
+	}
+	m.usage.mu.Lock()
+	defer m.usage.mu.Unlock()
+	meter, ok := m.usage.meters[sandboxID]
+	if !ok || meter.deleted {
+		return
+	}
+	now := time.Now().UTC()
+	var totals UsageTotals
+	if running {
+		totals.WallSeconds = now.Sub(meter.sampledAt).Seconds()
+	}
+	meter.record(now, totals)
+	meter.deleted = true
+}
+
+// runUsageSampler samples the usage of every sandbox, and charges it to budgets, until ctx
+// is done.
+func (m *SandboxManager) runUsageSampler(ctx context.Context) {
+	ticker := time.NewTicker(m.usage.interval)
+	defer ticker.Stop()
+	m.logger.Info("Usage accounting started", "interval", m.usage.interval)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			m.sampleUsage(ctx)
+			m.pruneUsage(time.Now().UTC().Add(-usageRetention))
+			m.evaluateBudgets()
+		}
+	}
+}
+
+// sampleUsage measures every sandbox concurrently, like the status heartbeat.
+func (m *SandboxManager) sampleUsage(ctx context.Context) {
+	type target struct {
+		sandboxID   string
+		spaceID     string
+		containerID string
+		running     bool
+	}
+	m.mu.RLock()
+	targets := make([]target, 0, len(m.sandboxes))
+	for id, state := range m.sandboxes {
+		targets = append(targets, target{sandboxID: id, spaceID: state.SpaceID, containerID: state.ContainerID, running: containerUp(state.Phase)})
+	}
+	m.mu.RUnlock()
+
+	var wg sync.WaitGroup
+	for _, t := range targets {
+		wg.Add(1)
+		err := m.submit(ctx, m.dockerPool, func() {
+			defer wg.Done()
+			var cpuNanos, memoryBytes uint64
+			sampled := false
+			if t.running {
+				cpuNanos, memoryBytes, sampled = m.containerUsage(ctx, t.containerID)
+			}
+			m.recordUsage(t.sandboxID, t.spaceID, time.Now().UTC(), t.running, sampled, cpuNanos, memoryBytes)
+		})
+		if err != nil {
+			wg.Done()
+		}
+	}
+	wg.Wait()
+}
+
+// containerUsage returns the cumulative CPU time and the current memory usage of a container.
+func (m *SandboxManager) containerUsage(ctx context.Context, containerID string) (cpuNanos, memoryBytes uint64, ok bool) {
+	statsCtx, cancel := context.WithTimeout(ctx, m.usage.interval)
+	defer cancel()
+	resp, err := m.docker().ContainerStatsOneShot(statsCtx, containerID)
+	if err != nil {
+		m.logger.Debug("Failed to sample container usage", "containerID", containerID, "error", err)
+		return 0, 0, false
+	}
+	defer resp.Body.Close()
+	var stats container.StatsResponse
+	if err := json.NewDecoder(resp.Body).Decode(&stats); err != nil {
+		m.logger.Debug("Failed to decode container usage", "containerID", containerID, "error", err)
+		return 0, 0, false
+	}
+	memoryBytes = stats.MemoryStats.Usage
+	if cache, ok := stats.MemoryStats.Stats["inactive_file"]; ok && cache < memoryBytes {
+		memoryBytes -= cache
+	}
+	return stats.CPUStats.CPUUsage.TotalUsage, memoryBytes, true
+}
+
+// recordUsage accounts a sample of a sandbox. Sandboxes metered since their creation count
+// their CPU time from zero; others, such as adopted ones, start metering at their first sample.
+func (m *SandboxManager) recordUsage(sandboxID, spaceID string, now time.Time, running, sampled bool, cpuNanos, memoryBytes uint64) {
+	m.usage.mu.Lock()
+	defer m.usage.mu.Unlock()
+	meter, ok := m.usage.meters[sandboxID]
+	if ok && meter.deleted {
+		return // Deleted since the sample was taken
+	}
+	if !ok {
+		if exists, _ := m.SandboxExists(context.Background(), sandboxID); !exists {
+			return
+		}
+		meter = &usageMeter{spaceID: spaceID, sampledAt: now, cpuNanos: cpuNanos, buckets: make(map[time.Time]*UsageTotals)}
+		if space, err := m.spaceManager.GetSpace(context.Background(), spaceID); err == nil {
+			meter.tenant = space.Tenant
+		}
+		m.usage.meters[sandboxID] = meter
+		return
+	}
+	var totals UsageTotals
+	if running {
+		elapsed := now.Sub(meter.sampledAt).Seconds()
+		totals.WallSeconds = elapsed
+		if sampled {
+			cpu := cpuNanos
+			if cpu >= meter.cpuNanos {
+				cpu -= meter.cpuNanos
+			} // Otherwise the container restarted, and its counter with it
+			totals.CPUSeconds = float64(cpu) / float64(time.Second)
+			totals.MemoryByteSeconds = float64(memoryBytes) * elapsed
+			meter.cpuNanos = cpuNanos
+		}
+	}
+	meter.record(now, totals)
+}
+
+// pruneUsage drops the buckets that start before cutoff, and the meters of deleted
+// sandboxes left without any.
+func (m *SandboxManager) pruneUsage(cutoff time.Time) {
+	m.usage.mu.Lock()
+	defer m.usage.mu.Unlock()
+	for sandboxID, meter := range m.usage.meters {
+		for start := range meter.buckets {
+			if start.Before(cutoff) {
+				delete(meter.buckets, start)
+			}
+		}
+		if meter.deleted && len(meter.buckets) == 0 {
+			delete(m.usage.meters, sandboxID)
+		}
+	}
+}
+
+// GetUsageReport sums the usage of the hourly buckets starting in [from, to), per sandbox,
+// space and tenant. Requests of a tenant see only the usage of their own spaces. Usage since
+// the last sample of each sandbox is not counted yet.
+func (m *SandboxManager) GetUsageReport(ctx context.Context, from, to time.Time) (*UsageReport, error) {
+	if m.usage == nil {
+		return nil, ErrUsageDisabled
+	}
+	if !from.Before(to) {
+		return nil, fmt.Errorf("%w: from %s is not before to %s", ErrInvalidUsageRange, from.Format(time.RFC3339), to.Format(time.RFC3339))
+	}
+	tenant := TenantFromContext(ctx)
+	first := from.UTC().Truncate(usageBucket)
+	report := &UsageReport{From: from.UTC(), To: to.UTC(), Tenants: []TenantUsage{}, Spaces: []SpaceUsage{}, Sandboxes: []SandboxUsage{}}
+	spaces := make(map[string]*SpaceUsage)
+	tenants := make(map[string]*TenantUsage)
+
+	m.usage.mu.Lock()
+	for sandboxID, meter := range m.usage.meters {
+		if tenant != "" && meter.tenant != tenant {
+			continue
+		}
+		var totals UsageTotals
+		found := false
+		for start, bucket := range meter.buckets {
+			if !start.Before(first) && start.Before(to) {
+				totals.add(*bucket)
+				found = true
+			}
+		}
+		if !found {
+			continue
+		}
+		report.Sandboxes = append(report.Sandboxes, SandboxUsage{SandboxID: sandboxID, SpaceID: meter.spaceID, Tenant: meter.tenant, Deleted: meter.deleted, UsageTotals: totals})
+		if spaces[meter.spaceID] == nil {
+			spaces[meter.spaceID] = &SpaceUsage{SpaceID: meter.spaceID, Tenant: meter.tenant}
+		}
+		spaces[meter.spaceID].add(totals)
+		if tenants[meter.tenant] == nil {
+			tenants[meter.tenant] = &TenantUsage{Tenant: meter.tenant}
+		}
+		tenants[meter.tenant].add(totals)
+		report.Total.add(totals)
+	}
+	m.usage.mu.Unlock()
+
+	for _, space := range spaces {
+		report.Spaces = append(report.Spaces, *space)
+	}
+	for _, t := range tenants {
+		report.Tenants = append(report.Tenants, *t)
+	}
+	sort.Slice(report.Sandboxes, func(i, j int) bool { return report.Sandboxes[i].SandboxID < report.Sandboxes[j].SandboxID })
+	sort.Slice(report.Spaces, func(i, j int) bool { return report.Spaces[i].SpaceID < report.Spaces[j].SpaceID })
+	sort.Slice(report.Tenants, func(i, j int) bool { return report.Tenants[i].Tenant < report.Tenants[j].Tenant })
+	return report, nil
+}
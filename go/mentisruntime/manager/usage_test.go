@@ -0,0 +1,20 @@
+package manager
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestUsageMeter_spreadsOverHours(t *testing.T) {
+	start := time.Date(2026, 1, 1, 9, 30, 0, 0, time.UTC)
+	meter := &usageMeter{sampledAt: start, buckets: make(map[time.Time]*UsageTotals)}
+	meter.record(start.Add(time.Hour), UsageTotals{CPUSeconds: 60, MemoryByteSeconds: 3600, WallSeconds: 3600})
+
+	require.Equal(t, map[time.Time]*UsageTotals{
+		start.Truncate(time.Hour):                {CPUSeconds: 30, MemoryByteSeconds: 1800, WallSeconds: 1800},
+		start.Truncate(time.Hour).Add(time.Hour): {CPUSeconds: 30, MemoryByteSeconds: 1800, WallSeconds: 1800},
+	}, meter.buckets)
+	require.Equal(t, start.Add(time.Hour), meter.sampledAt)
+}
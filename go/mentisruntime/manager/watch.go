@@ -0,0 +1,125 @@
+package manager
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+var (
+	ErrWatchNotFound     = newError(KindNotFound, "watch_not_found", "watch not found")
+	ErrWatchPathNotFound = newError(KindNotFound, "watch_path_not_found", "watch path not found")
+)
+
+// WatchEvents are the filesystem events watches can select.
+var WatchEvents = []string{"create", "modify", "delete", "move"}
+
+// Watch describes a filesystem watch registered with a sandbox's agent.
+// Matching filesystem changes are delivered as "fs_event" observations on the sandbox stream.
+type Watch struct {
+	ID        string    `json:"watch_id"`
+	SandboxID string    `json:"sandbox_id"`
+	Path      string    `json:"path"`
+	Recursive bool      `json:"recursive"`
+	Events    []string  `json:"events,omitempty"` // e.g. create, modify, delete, move. Empty means all.
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// FsEventObservationData is the data payload of an "fs_event" observation pushed by the agent.
+type FsEventObservationData struct {
+	WatchID string `json:"watch_id"`
+	Path    string `json:"path"`
+	Event   string `json:"event"`
+	IsDir   bool   `json:"is_dir,omitempty"`
+}
+
+// CreateWatch asks the sandbox agent to start watching path for filesystem changes.
+func (m *SandboxManager) CreateWatch(ctx context.Context, sandboxID, path string, recursive bool, events []string) (*Watch, error) {
+	m.mu.RLock()
+	state, exists := m.sandboxes[sandboxID]
+	m.mu.RUnlock()
+	if !exists {
+		return nil, ErrSandboxNotFound
+	}
+	if !state.IsRunning {
+		return nil, ErrSandboxNotRunning
+	}
+
+	watch := &Watch{
+		ID:        uuid.NewString(),
+		SandboxID: sandboxID,
+		Path:      path,
+		Recursive: recursive,
+		Events:    events,
+		CreatedAt: time.Now().UTC(),
+	}
+
+	if err := m.callAgent(ctx, sandboxID, http.MethodPost, state.AgentURL+"/watches", watch, nil); err != nil {
+		var statusErr *agentStatusError
+		if errors.As(err, &statusErr) && statusErr.StatusCode == http.StatusNotFound {
+			return nil, fmt.Errorf("%w: %s", ErrWatchPathNotFound, path)
+		}
+		m.logger.Error("Failed to register watch with agent", "sandboxID", sandboxID, "path", path, "error", err)
+		return nil, fmt.Errorf("failed to register watch: %w", err)
+	}
+
+	m.mu.Lock()
+	if m.watches[sandboxID] == nil {
+		m.watches[sandboxID] = make(map[string]*Watch)
+	}
+	m.watches[sandboxID][watch.ID] = watch
+	m.mu.Unlock()
+
+	m.logger.Info("Watch created", "sandboxID", sandboxID, "watchID", watch.ID, "path", path, "recursive", recursive)
+	return watch, nil
+}
+
+// ListWatches returns the active watches of a sandbox.
+func (m *SandboxManager) ListWatches(ctx context.Context, sandboxID string) ([]*Watch, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	if _, exists := m.sandboxes[sandboxID]; !exists {
+		return nil, ErrSandboxNotFound
+	}
+	watches := make([]*Watch, 0, len(m.watches[sandboxID]))
+	for _, w := range m.watches[sandboxID] {
+		watchCopy := *w
+		watches = append(watches, &watchCopy)
+	}
+	return watches, nil
+}
+
+// DeleteWatch stops a watch on the agent and forgets about it.
+func (m *SandboxManager) DeleteWatch(ctx context.Context, sandboxID, watchID string) error {
+	m.mu.RLock()
+	state, exists := m.sandboxes[sandboxID]
+	_, watchExists := m.watches[sandboxID][watchID]
+	m.mu.RUnlock()
+	if !exists {
+		return ErrSandboxNotFound
+	}
+	if !watchExists {
+		return ErrWatchNotFound
+	}
+
+	if err := m.callAgent(ctx, sandboxID, http.MethodDelete, state.AgentURL+"/watches/"+url.PathEscape(watchID), nil, nil); err != nil {
+		// The watch is dropped locally regardless; the agent cleans up its watchers when it exits.
+		m.logger.Warn("Failed to stop watch on agent", "sandboxID", sandboxID, "watchID", watchID, "error", err)
+	}
+
+	m.mu.Lock()
+	delete(m.watches[sandboxID], watchID)
+	if len(m.watches[sandboxID]) == 0 {
+		delete(m.watches, sandboxID)
+	}
+	m.mu.Unlock()
+
+	m.logger.Info("Watch deleted", "sandboxID", sandboxID, "watchID", watchID)
+	return nil
+}
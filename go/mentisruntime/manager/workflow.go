@@ -0,0 +1,292 @@
+package manager
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+var ErrWorkflowNotFound = newError(KindNotFound, "workflow_not_found", "workflow not found")
+
+// Step run conditions.
+const (
+	RunOnSuccess = "on_success" // Run only while every earlier step succeeded (the default)
+	RunOnFailure = "on_failure" // Run only after an earlier step failed
+	RunAlways    = "always"
+)
+
+// Workflow and step statuses.
+const (
+	WorkflowPending   = "pending"
+	WorkflowRunning   = "running"
+	WorkflowSucceeded = "succeeded"
+	WorkflowFailed    = "failed"
+	WorkflowSkipped   = "skipped" // Steps only
+)
+
+// DefaultStepTimeout bounds how long a workflow waits for a step without its own timeout.
+const DefaultStepTimeout = time.Hour
+
+// WorkflowStepSpec is one action of a workflow.
+type WorkflowStepSpec struct {
+	Name       string                 `json:"name,omitempty"`
+	ActionType string                 `json:"action_type"` // "shell" or "ipython"
+	Payload    map[string]interface{} `json:"payload"`
+	RunIf      string                 `json:"run_if,omitempty"` // RunOnSuccess, RunOnFailure or RunAlways
+	Timeout    time.Duration          `json:"-"`                // DefaultStepTimeout if zero
+}
+
+// WorkflowStep is a step together with its progress.
+type WorkflowStep struct {
+	WorkflowStepSpec
+	Status     string     `json:"status"`
+	ActionID   string     `json:"action_id,omitempty"`
+	ExitCode   *int       `json:"exit_code,omitempty"`
+	Error      string     `json:"error,omitempty"`
+	StartedAt  *time.Time `json:"started_at,omitempty"`
+	FinishedAt *time.Time `json:"finished_at,omitempty"`
+}
+
+// Workflow runs a list of actions in order inside one sandbox. Each step is an ordinary
+// action with its own observations; "workflow_step" and "workflow_end" observations report
+// progress. A step fails when its exit code is non-zero, it cannot start, or it times out.
+type Workflow struct {
+	ID         string          `json:"workflow_id"`
+	SandboxID  string          `json:"sandbox_id"`
+	Status     string          `json:"status"`
+	Steps      []*WorkflowStep `json:"steps"`
+	CreatedAt  time.Time       `json:"created_at"`
+	FinishedAt *time.Time      `json:"finished_at,omitempty"`
+}
+
+// WorkflowStepObservationData is the data payload of a "workflow_step" observation.
+type WorkflowStepObservationData struct {
+	WorkflowID string `json:"workflow_id"`
+	Step       int    `json:"step"`
+	Name       string `json:"name,omitempty"`
+	Status     string `json:"status"`
+	ExitCode   *int   `json:"exit_code,omitempty"`
+	Error      string `json:"error,omitempty"`
+}
+
+// WorkflowEndObservationData is the data payload of a "workflow_end" observation.
+type WorkflowEndObservationData struct {
+	WorkflowID string `json:"workflow_id"`
+	Status     string `json:"status"`
+}
+
+// StartWorkflow validates steps and runs them in the background, returning the new workflow.
+func (m *SandboxManager) StartWorkflow(ctx context.Context, sandboxID string, steps []WorkflowStepSpec) (*Workflow, error) {
+	if len(steps) == 0 {
+		return nil, newError(KindInvalid, "empty_workflow", "workflow has no steps")
+	}
+	wf := &Workflow{
+		ID:        uuid.NewString(),
+		SandboxID: sandboxID,
+		Status:    WorkflowRunning,
+		CreatedAt: time.Now().UTC(),
+	}
+	for _, spec := range steps {
+		if spec.ActionType != "shell" && spec.ActionType != "ipython" {
+			return nil, &Error{Kind: KindInvalid, Code: "unsupported_action_type", Message: "unsupported action type: " + spec.ActionType}
+		}
+		if spec.RunIf == "" {
+			spec.RunIf = RunOnSuccess
+		}
+		if spec.Timeout <= 0 {
+			spec.Timeout = DefaultStepTimeout
+		}
+		wf.Steps = append(wf.Steps, &WorkflowStep{WorkflowStepSpec: spec, Status: WorkflowPending})
+	}
+
+	m.mu.Lock()
+	state, exists := m.sandboxes[sandboxID]
+	if !exists {
+		m.mu.Unlock()
+		return nil, ErrSandboxNotFound
+	}
+	if !state.IsRunning {
+		m.mu.Unlock()
+		return nil, ErrSandboxNotRunning
+	}
+	if state.SetupStatus == SetupRunning {
+		m.mu.Unlock()
+		return nil, ErrSandboxSettingUp
+	}
+	if m.workflows[sandboxID] == nil {
+		m.workflows[sandboxID] = make(map[string]*Workflow)
+	}
+	m.workflows[sandboxID][wf.ID] = wf
+	snapshot := wf.snapshot()
+	// Steps outlive the request but not the sandbox
+	runCtx := state.ctx
+	m.mu.Unlock()
+	if runCtx == nil {
+		runCtx = context.Background()
+	}
+
+	m.logger.Info("Workflow started", "sandboxID", sandboxID, "workflowID", wf.ID, "steps", len(wf.Steps))
+	m.goSafe("workflow", func() { m.runWorkflow(runCtx, wf) })
+	return snapshot, nil
+}
+
+// GetWorkflow returns the current state of a workflow.
+func (m *SandboxManager) GetWorkflow(ctx context.Context, sandboxID, workflowID string) (*Workflow, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	if _, exists := m.sandboxes[sandboxID]; !exists {
+		return nil, ErrSandboxNotFound
+	}
+	wf, exists := m.workflows[sandboxID][workflowID]
+	if !exists {
+		return nil, ErrWorkflowNotFound
+	}
+	return wf.snapshot(), nil
+}
+
+// ListWorkflows returns the workflows of a sandbox.
+func (m *SandboxManager) ListWorkflows(ctx context.Context, sandboxID string) ([]*Workflow, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	if _, exists := m.sandboxes[sandboxID]; !exists {
+		return nil, ErrSandboxNotFound
+	}
+	workflows := make([]*Workflow, 0, len(m.workflows[sandboxID]))
+	for _, wf := range m.workflows[sandboxID] {
+		workflows = append(workflows, wf.snapshot())
+	}
+	return workflows, nil
+}
+
+// snapshot deep-copies the workflow. Callers must hold m.mu.
+func (wf *Workflow) snapshot() *Workflow {
+	wfCopy := *wf
+	wfCopy.Steps = make([]*WorkflowStep, len(wf.Steps))
+	for i, step := range wf.Steps {
+		stepCopy := *step
+		wfCopy.Steps[i] = &stepCopy
+	}
+	return &wfCopy
+}
+
+func (m *SandboxManager) runWorkflow(ctx context.Context, wf *Workflow) {
+	failed := false
+	for i, step := range wf.Steps {
+		run := step.RunIf == RunAlways ||
+			(step.RunIf == RunOnSuccess && !failed) ||
+			(step.RunIf == RunOnFailure && failed)
+		if !run {
+			m.updateStep(wf, i, func(s *WorkflowStep) { s.Status = WorkflowSkipped })
+			continue
+		}
+		if !m.runWorkflowStep(ctx, wf, i) {
+			failed = true
+		}
+	}
+
+	status := WorkflowSucceeded
+	if failed {
+		status = WorkflowFailed
+	}
+	m.mu.Lock()
+	finishedAt := time.Now().UTC()
+	wf.Status = status
+	wf.FinishedAt = &finishedAt
+	m.mu.Unlock()
+
+	m.logger.Info("Workflow finished", "sandboxID", wf.SandboxID, "workflowID", wf.ID, "status", status)
+	m.pushObservation(wf.SandboxID, "", "workflow_end", WorkflowEndObservationData{WorkflowID: wf.ID, Status: status})
+}
+
+// runWorkflowStep runs step i to completion and reports whether it succeeded.
+func (m *SandboxManager) runWorkflowStep(ctx context.Context, wf *Workflow, i int) bool {
+	step := wf.Steps[i]
+	done := make(chan int, 1)
+	actionID, err := m.initiateAction(ctx, wf.SandboxID, step.ActionType, step.Payload, done)
+	startedAt := time.Now().UTC()
+	if err != nil {
+		m.finishStep(wf, i, "", nil, err.Error(), startedAt)
+		return false
+	}
+	m.updateStep(wf, i, func(s *WorkflowStep) {
+		s.Status = WorkflowRunning
+		s.ActionID = actionID
+		s.StartedAt = &startedAt
+	})
+	m.pushObservation(wf.SandboxID, actionID, "workflow_step", WorkflowStepObservationData{
+		WorkflowID: wf.ID, Step: i, Name: step.Name, Status: WorkflowRunning,
+	})
+
+	exitCode, err := m.awaitAction(ctx, wf.SandboxID, actionID, done, step.Timeout)
+	if err != nil {
+		m.finishStep(wf, i, actionID, nil, err.Error(), startedAt)
+		return false
+	}
+	m.finishStep(wf, i, actionID, &exitCode, "", startedAt)
+	return exitCode == 0
+}
+
+// awaitAction waits for the exit code of an action started with done. It gives up after
+// timeout, when ctx is done, or when the sandbox is deleted or dies, since the action then
+// never ends.
+func (m *SandboxManager) awaitAction(ctx context.Context, sandboxID, actionID string, done chan int, timeout time.Duration) (int, error) {
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	alive := time.NewTicker(5 * time.Second)
+	defer alive.Stop()
+	for {
+		select {
+		case exitCode := <-done:
+			return exitCode, nil
+		case <-timer.C:
+			m.abandonAction(actionID)
+			return 0, fmt.Errorf("step timed out after %s", timeout)
+		case <-ctx.Done():
+			m.abandonAction(actionID)
+			return 0, errors.New("sandbox stopped while the step was running")
+		case <-alive.C:
+			m.mu.RLock()
+			state, exists := m.sandboxes[sandboxID]
+			running := exists && state.IsRunning
+			m.mu.RUnlock()
+			if !running {
+				m.abandonAction(actionID)
+				return 0, errors.New("sandbox stopped while the step was running")
+			}
+		}
+	}
+}
+
+func (m *SandboxManager) updateStep(wf *Workflow, i int, update func(*WorkflowStep)) {
+	m.mu.Lock()
+	update(wf.Steps[i])
+	m.mu.Unlock()
+}
+
+func (m *SandboxManager) finishStep(wf *Workflow, i int, actionID string, exitCode *int, errMsg string, startedAt time.Time) {
+	status := WorkflowSucceeded
+	if exitCode == nil || *exitCode != 0 {
+		status = WorkflowFailed
+	}
+	finishedAt := time.Now().UTC()
+	m.updateStep(wf, i, func(s *WorkflowStep) {
+		s.Status = status
+		s.ExitCode = exitCode
+		s.Error = errMsg
+		s.StartedAt = &startedAt
+		s.FinishedAt = &finishedAt
+	})
+	m.pushObservation(wf.SandboxID, actionID, "workflow_step", WorkflowStepObservationData{
+		WorkflowID: wf.ID, Step: i, Name: wf.Steps[i].Name, Status: status, ExitCode: exitCode, Error: errMsg,
+	})
+}
+
+// abandonAction stops waiting for an action's end.
+func (m *SandboxManager) abandonAction(actionID string) {
+	m.mu.Lock()
+	delete(m.actionWaiters, actionID)
+	m.mu.Unlock()
+}
@@ -0,0 +1,209 @@
+// Package metrics provides minimal counters and gauges exposed in the Prometheus text format.
+package metrics
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// Default is the registry served on /metrics.
+var Default = NewRegistry()
+
+// Counter is a monotonically increasing value.
+type Counter struct{ v atomic.Int64 }
+
+// Inc adds one to the counter.
+func (c *Counter) Inc() { c.v.Add(1) }
+
+// Add adds n to the counter.
+func (c *Counter) Add(n int64) { c.v.Add(n) }
+
+// Value returns the current value.
+func (c *Counter) Value() int64 { return c.v.Load() }
+
+// Gauge is a value that can go up and down.
+type Gauge struct{ v atomic.Int64 }
+
+// Set replaces the gauge value.
+func (g *Gauge) Set(n int64) { g.v.Store(n) }
+
+// Inc adds one to the gauge.
+func (g *Gauge) Inc() { g.v.Add(1) }
+
+// Dec subtracts one from the gauge.
+func (g *Gauge) Dec() { g.v.Add(-1) }
+
+// Value returns the current value.
+func (g *Gauge) Value() int64 { return g.v.Load() }
+
+// CounterVec is a set of counters partitioned by label values.
+type CounterVec struct {
+	labels   []string
+	mu       sync.Mutex
+	counters map[string]*Counter // Keyed by the joined label values
+}
+
+// With returns the counter for the given label values, creating it on first use.
+func (v *CounterVec) With(values ...string) *Counter {
+	key := labelKey(v.labels, values)
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	c, ok := v.counters[key]
+	if !ok {
+		c = &Counter{}
+		v.counters[key] = c
+	}
+	return c
+}
+
+// GaugeVec is a set of gauges partitioned by label values.
+type GaugeVec struct {
+	labels []string
+	mu     sync.Mutex
+	gauges map[string]*Gauge // Keyed by the joined label values
+}
+
+// With returns the gauge for the given label values, creating it on first use.
+func (v *GaugeVec) With(values ...string) *Gauge {
+	key := labelKey(v.labels, values)
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	g, ok := v.gauges[key]
+	if !ok {
+		g = &Gauge{}
+		v.gauges[key] = g
+	}
+	return g
+}
+
+func labelKey(labels, values []string) string {
+	if len(values) != len(labels) {
+		panic(fmt.Sprintf("metrics: expected %d label values, got %d", len(labels), len(values)))
+	}
+	return strings.Join(values, "\xff")
+}
+
+type family struct {
+	name, help, kind string
+	counter          *Counter
+	gauge            *Gauge
+	vec              *CounterVec
+	gaugeVec         *GaugeVec
+}
+
+// Registry holds named metrics and renders them on ServeHTTP.
+type Registry struct {
+	mu       sync.Mutex
+	families map[string]*family
+}
+
+// NewRegistry creates an empty registry.
+func NewRegistry() *Registry {
+	return &Registry{families: make(map[string]*family)}
+}
+
+// NewCounter registers a counter. Registering an existing name returns the existing counter.
+func (r *Registry) NewCounter(name, help string) *Counter {
+	f := r.register(name, help, "counter", func(f *family) { f.counter = &Counter{} })
+	return f.counter
+}
+
+// NewGauge registers a gauge. Registering an existing name returns the existing gauge.
+func (r *Registry) NewGauge(name, help string) *Gauge {
+	f := r.register(name, help, "gauge", func(f *family) { f.gauge = &Gauge{} })
+	return f.gauge
+}
+
+// NewCounterVec registers a labelled counter family.
+func (r *Registry) NewCounterVec(name, help string, labels ...string) *CounterVec {
+	f := r.register(name, help, "counter", func(f *family) {
+		f.vec = &CounterVec{labels: labels, counters: make(map[string]*Counter)}
+	})
+	return f.vec
+}
+
+// NewGaugeVec registers a labelled gauge family.
+func (r *Registry) NewGaugeVec(name, help string, labels ...string) *GaugeVec {
+	f := r.register(name, help, "gauge", func(f *family) {
+		f.gaugeVec = &GaugeVec{labels: labels, gauges: make(map[string]*Gauge)}
+	})
+	return f.gaugeVec
+}
+
+func (r *Registry) register(name, help, kind string, init func(*family)) *family {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if f, ok := r.families[name]; ok {
+		return f
+	}
+	f := &family{name: name, help: help, kind: kind}
+	init(f)
+	r.families[name] = f
+	return f
+}
+
+// ServeHTTP writes all metrics in the Prometheus text exposition format.
+func (r *Registry) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	fmt.Fprint(w, r.String())
+}
+
+// String renders all metrics in the Prometheus text exposition format.
+func (r *Registry) String() string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	names := make([]string, 0, len(r.families))
+	for name := range r.families {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var b strings.Builder
+	for _, name := range names {
+		f := r.families[name]
+		fmt.Fprintf(&b, "# HELP %s %s\n# TYPE %s %s\n", f.name, f.help, f.name, f.kind)
+		switch {
+		case f.counter != nil:
+			fmt.Fprintf(&b, "%s %d\n", f.name, f.counter.Value())
+		case f.gauge != nil:
+			fmt.Fprintf(&b, "%s %d\n", f.name, f.gauge.Value())
+		case f.vec != nil:
+			f.vec.mu.Lock()
+			values := make(map[string]int64, len(f.vec.counters))
+			for key, c := range f.vec.counters {
+				values[key] = c.Value()
+			}
+			f.vec.mu.Unlock()
+			writeSeries(&b, f.name, f.vec.labels, values)
+		case f.gaugeVec != nil:
+			f.gaugeVec.mu.Lock()
+			values := make(map[string]int64, len(f.gaugeVec.gauges))
+			for key, g := range f.gaugeVec.gauges {
+				values[key] = g.Value()
+			}
+			f.gaugeVec.mu.Unlock()
+			writeSeries(&b, f.name, f.gaugeVec.labels, values)
+		}
+	}
+	return b.String()
+}
+
+// writeSeries writes one line per label key of a vec family, sorted by key.
+func writeSeries(b *strings.Builder, name string, labels []string, values map[string]int64) {
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		pairs := make([]string, len(labels))
+		for i, value := range strings.Split(key, "\xff") {
+			pairs[i] = fmt.Sprintf("%s=%q", labels[i], value)
+		}
+		fmt.Fprintf(b, "%s{%s} %d\n", name, strings.Join(pairs, ","), values[key])
+	}
+}
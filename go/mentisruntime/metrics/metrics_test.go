@@ -0,0 +1,33 @@
+package metrics
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRegistry_String(t *testing.T) {
+	r := NewRegistry()
+	r.NewCounter("requests_total", "Requests served.").Add(3)
+	r.NewGauge("sandboxes", "Running sandboxes.").Set(2)
+	vec := r.NewCounterVec("drift_total", "Drift by kind.", "kind")
+	vec.With("stale").Inc()
+	vec.With("orphan").Add(2)
+	r.NewGaugeVec("pool_busy", "Busy workers.", "pool").With("actions").Set(4)
+
+	require.Same(t, vec, r.NewCounterVec("drift_total", "Drift by kind.", "kind"))
+	require.Equal(t, `# HELP drift_total Drift by kind.
+# TYPE drift_total counter
+drift_total{kind="orphan"} 2
+drift_total{kind="stale"} 1
+# HELP pool_busy Busy workers.
+# TYPE pool_busy gauge
+pool_busy{pool="actions"} 4
+# HELP requests_total Requests served.
+# TYPE requests_total counter
+requests_total 3
+# HELP sandboxes Running sandboxes.
+# TYPE sandboxes gauge
+sandboxes 2
+`, r.String())
+}
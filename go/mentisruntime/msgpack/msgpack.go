@@ -0,0 +1,293 @@
+// Package msgpack converts observation messages between JSON and MessagePack, which encodes
+// the same values in fewer bytes and without escaping or number parsing. It supports the
+// types JSON has: nil, booleans, numbers, strings, arrays and maps with string keys.
+// MessagePack binary values are decoded as base64 strings, as encoding/json encodes []byte;
+// extension types are not supported.
+package msgpack
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+)
+
+// ContentType is the media type of MessagePack request bodies.
+const ContentType = "application/msgpack"
+
+// maxDepth bounds the nesting of arrays and maps ToJSON decodes.
+const maxDepth = 100
+
+var errTruncated = errors.New("msgpack: truncated message")
+
+// FromJSON encodes a JSON value as MessagePack. Integers keep their exact value; other
+// numbers are encoded as 64-bit floats. Map keys are written in sorted order.
+func FromJSON(data []byte) ([]byte, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var v interface{}
+	if err := dec.Decode(&v); err != nil {
+		return nil, err
+	}
+	buf := make([]byte, 0, len(data))
+	return appendValue(buf, v)
+}
+
+func appendValue(buf []byte, v interface{}) ([]byte, error) {
+	switch v := v.(type) {
+	case nil:
+		return append(buf, 0xc0), nil
+	case bool:
+		if v {
+			return append(buf, 0xc3), nil
+		}
+		return append(buf, 0xc2), nil
+	case json.Number:
+		return appendNumber(buf, v)
+	case string:
+		return appendString(buf, v), nil
+	case []interface{}:
+		buf = appendLength(buf, len(v), 0x90, 0xdc, 0xdd)
+		var err error
+		for _, item := range v {
+			if buf, err = appendValue(buf, item); err != nil {
+				return nil, err
+			}
+		}
+		return buf, nil
+	case map[string]interface{}:
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		buf = appendLength(buf, len(v), 0x80, 0xde, 0xdf)
+		var err error
+		for _, k := range keys {
+			buf = appendString(buf, k)
+			if buf, err = appendValue(buf, v[k]); err != nil {
+				return nil, err
+			}
+		}
+		return buf, nil
+	}
+	return nil, fmt.Errorf("msgpack: unsupported type %T", v)
+}
+
+func appendNumber(buf []byte, n json.Number) ([]byte, error) {
+	if i, err := strconv.ParseInt(string(n), 10, 64); err == nil {
+		return appendInt(buf, i), nil
+	}
+	if u, err := strconv.ParseUint(string(n), 10, 64); err == nil {
+		return binary.BigEndian.AppendUint64(append(buf, 0xcf), u), nil
+	}
+	f, err := n.Float64()
+	if err != nil {
+		return nil, err
+	}
+	return binary.BigEndian.AppendUint64(append(buf, 0xcb), math.Float64bits(f)), nil
+}
+
+func appendInt(buf []byte, i int64) []byte {
+	switch {
+	case i >= 0 && i <= 0x7f:
+		return append(buf, byte(i))
+	case i < 0 && i >= -32:
+		return append(buf, byte(i))
+	case i >= 0 && i <= math.MaxUint8:
+		return append(buf, 0xcc, byte(i))
+	case i >= 0 && i <= math.MaxUint16:
+		return binary.BigEndian.AppendUint16(append(buf, 0xcd), uint16(i))
+	case i >= 0 && i <= math.MaxUint32:
+		return binary.BigEndian.AppendUint32(append(buf, 0xce), uint32(i))
+	case i >= 0:
+		return binary.BigEndian.AppendUint64(append(buf, 0xcf), uint64(i))
+	case i >= math.MinInt8:
+		return append(buf, 0xd0, byte(i))
+	case i >= math.MinInt16:
+		return binary.BigEndian.AppendUint16(append(buf, 0xd1), uint16(i))
+	case i >= math.MinInt32:
+		return binary.BigEndian.AppendUint32(append(buf, 0xd2), uint32(i))
+	}
+	return binary.BigEndian.AppendUint64(append(buf, 0xd3), uint64(i))
+}
+
+func appendString(buf []byte, s string) []byte {
+	switch n := len(s); {
+	case n < 32:
+		buf = append(buf, 0xa0|byte(n))
+	case n <= math.MaxUint8:
+		buf = append(buf, 0xd9, byte(n))
+	case n <= math.MaxUint16:
+		buf = binary.BigEndian.AppendUint16(append(buf, 0xda), uint16(n))
+	default:
+		buf = binary.BigEndian.AppendUint32(append(buf, 0xdb), uint32(n))
+	}
+	return append(buf, s...)
+}
+
+// appendLength writes the header of an array or map of n elements.
+func appendLength(buf []byte, n int, fix, code16, code32 byte) []byte {
+	switch {
+	case n < 16:
+		return append(buf, fix|byte(n))
+	case n <= math.MaxUint16:
+		return binary.BigEndian.AppendUint16(append(buf, code16), uint16(n))
+	}
+	return binary.BigEndian.AppendUint32(append(buf, code32), uint32(n))
+}
+
+// ToJSON decodes a MessagePack value as JSON. Trailing bytes are an error.
+func ToJSON(data []byte) ([]byte, error) {
+	d := decoder{data: data}
+	v, err := d.value(0)
+	if err != nil {
+		return nil, err
+	}
+	if d.off != len(d.data) {
+		return nil, errors.New("msgpack: trailing bytes after value")
+	}
+	return json.Marshal(v)
+}
+
+type decoder struct {
+	data []byte
+	off  int
+}
+
+func (d *decoder) next(n int) ([]byte, error) {
+	if n < 0 || len(d.data)-d.off < n {
+		return nil, errTruncated
+	}
+	b := d.data[d.off : d.off+n]
+	d.off += n
+	return b, nil
+}
+
+// uint reads a big-endian unsigned integer of n bytes.
+func (d *decoder) uint(n int) (uint64, error) {
+	b, err := d.next(n)
+	if err != nil {
+		return 0, err
+	}
+	var u uint64
+	for _, c := range b {
+		u = u<<8 | uint64(c)
+	}
+	return u, nil
+}
+
+func (d *decoder) value(depth int) (interface{}, error) {
+	if depth > maxDepth {
+		return nil, errors.New("msgpack: value nested too deeply")
+	}
+	b, err := d.next(1)
+	if err != nil {
+		return nil, err
+	}
+	code := b[0]
+	switch {
+	case code <= 0x7f:
+		return int64(code), nil
+	case code >= 0xe0:
+		return int64(int8(code)), nil
+	case code&0xf0 == 0x80:
+		return d.mapOf(int(code&0x0f), depth)
+	case code&0xf0 == 0x90:
+		return d.arrayOf(int(code&0x0f), depth)
+	case code&0xe0 == 0xa0:
+		return d.str(int(code & 0x1f))
+	}
+	switch code {
+	case 0xc0:
+		return nil, nil
+	case 0xc2:
+		return false, nil
+	case 0xc3:
+		return true, nil
+	case 0xc4, 0xc5, 0xc6:
+		n, err := d.uint(1 << (code - 0xc4))
+		if err != nil {
+			return nil, err
+		}
+		return d.next(int(n))
+	case 0xca:
+		u, err := d.uint(4)
+		return float64(math.Float32frombits(uint32(u))), err
+	case 0xcb:
+		u, err := d.uint(8)
+		return math.Float64frombits(u), err
+	case 0xcc, 0xcd, 0xce, 0xcf:
+		return d.uint(1 << (code - 0xcc))
+	case 0xd0, 0xd1, 0xd2, 0xd3:
+		size := 1 << (code - 0xd0)
+		u, err := d.uint(size)
+		// Sign-extend from the top bit of the value.
+		shift := 64 - 8*size
+		return int64(u<<shift) >> shift, err
+	case 0xd9, 0xda, 0xdb:
+		n, err := d.uint(1 << (code - 0xd9))
+		if err != nil {
+			return nil, err
+		}
+		return d.str(int(n))
+	case 0xdc, 0xdd:
+		n, err := d.uint(2 << (code - 0xdc))
+		if err != nil {
+			return nil, err
+		}
+		return d.arrayOf(int(n), depth)
+	case 0xde, 0xdf:
+		n, err := d.uint(2 << (code - 0xde))
+		if err != nil {
+			return nil, err
+		}
+		return d.mapOf(int(n), depth)
+	}
+	return nil, fmt.Errorf("msgpack: unsupported type code 0x%02x", code)
+}
+
+func (d *decoder) str(n int) (string, error) {
+	b, err := d.next(n)
+	return string(b), err
+}
+
+func (d *decoder) arrayOf(n int, depth int) (interface{}, error) {
+	if n > len(d.data)-d.off {
+		return nil, errTruncated // Each element takes at least a byte
+	}
+	items := make([]interface{}, n)
+	for i := range items {
+		v, err := d.value(depth + 1)
+		if err != nil {
+			return nil, err
+		}
+		items[i] = v
+	}
+	return items, nil
+}
+
+func (d *decoder) mapOf(n int, depth int) (interface{}, error) {
+	if n > (len(d.data)-d.off)/2 {
+		return nil, errTruncated
+	}
+	m := make(map[string]interface{}, n)
+	for i := 0; i < n; i++ {
+		k, err := d.value(depth + 1)
+		if err != nil {
+			return nil, err
+		}
+		key, ok := k.(string)
+		if !ok {
+			return nil, fmt.Errorf("msgpack: map key of type %T, want string", k)
+		}
+		if m[key], err = d.value(depth + 1); err != nil {
+			return nil, err
+		}
+	}
+	return m, nil
+}
@@ -0,0 +1,53 @@
+package msgpack
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRoundTrip(t *testing.T) {
+	for _, doc := range []string{
+		`null`,
+		`{"observation_type":"stream","action_id":"a1","stream":"stdout","line":"héllo","seq":42}`,
+		`{"exit_code":-1,"error":null,"ok":false,"big":18446744073709551615,"neg":-9223372036854775808,"ratio":0.25}`,
+		`[1,-32,-33,127,128,255,256,65535,65536,4294967295,4294967296,-128,-129,-32768,-32769,-2147483648,-2147483649]`,
+		`{"line":"` + strings.Repeat("x", 300) + `","long":"` + strings.Repeat("y", 70000) + `"}`,
+		`{"items":[` + strings.TrimSuffix(strings.Repeat(`{"a":[]},`, 20), ",") + `]}`,
+	} {
+		packed, err := FromJSON([]byte(doc))
+		require.NoError(t, err)
+		decoded, err := ToJSON(packed)
+		require.NoError(t, err)
+		require.JSONEq(t, doc, string(decoded))
+	}
+}
+
+func TestFromJSON_smaller(t *testing.T) {
+	doc := `{"seq":1234,"observation_type":"stream","action_id":"6f1c2b7e-0a4d-4c5e-9f10-2a3b4c5d6e7f","stream":"stdout","line":"ok","exit_code":0}`
+	packed, err := FromJSON([]byte(doc))
+	require.NoError(t, err)
+	require.Less(t, len(packed), len(doc))
+	require.Equal(t, byte(0x86), packed[0]) // fixmap of 6 entries
+}
+
+func TestToJSON_binaryAndFloat32(t *testing.T) {
+	decoded, err := ToJSON([]byte{0x82, 0xa1, 'b', 0xc4, 0x02, 'h', 'i', 0xa1, 'f', 0xca, 0x3f, 0xc0, 0x00, 0x00})
+	require.NoError(t, err)
+	require.JSONEq(t, `{"b":"aGk=","f":1.5}`, string(decoded))
+}
+
+func TestToJSON_invalid(t *testing.T) {
+	for name, data := range map[string][]byte{
+		"truncated string": {0xa5, 'a'},
+		"truncated map":    {0xdf, 0xff, 0xff, 0xff, 0xff},
+		"integer key":      {0x81, 0x01, 0x02},
+		"extension":        {0xd4, 0x01, 0x00},
+		"trailing bytes":   {0xc0, 0xc0},
+		"empty":            {},
+	} {
+		_, err := ToJSON(data)
+		require.Error(t, err, name)
+	}
+}
@@ -0,0 +1,178 @@
+// Package redact masks sensitive data — credentials matching known patterns and values known
+// to be secret — in logs, observations and the observation history.
+//
+// Masking works on JSON messages as they are: patterns do not match quotes or backslashes,
+// and secret values are also looked for as JSON escapes them, so a masked message stays
+// valid JSON.
+package redact
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Mask replaces what is redacted.
+const Mask = "[REDACTED]"
+
+// MinValueLength is the shortest secret value masked; shorter ones would mask ordinary text.
+const MinValueLength = 6
+
+// DefaultPatterns match common credentials. Where a pattern has a group, only the group is
+// masked, so that "password=hunter22" becomes "password=[REDACTED]".
+var DefaultPatterns = []string{
+	`AKIA[0-9A-Z]{16}`,                        // AWS access key IDs
+	`gh[pousr]_[A-Za-z0-9]{36,}`,              // GitHub tokens
+	`github_pat_[A-Za-z0-9_]{22,}`,            // GitHub fine-grained tokens
+	`sk-[A-Za-z0-9_-]{20,}`,                   // OpenAI and Anthropic API keys
+	`xox[abposr]-[A-Za-z0-9-]{10,}`,           // Slack tokens
+	`(?i)bearer\s+([A-Za-z0-9._~+/-]{16,}=*)`, // Authorization headers
+	`-----BEGIN [A-Z ]*PRIVATE KEY-----[^"]*?-----END [A-Z ]*PRIVATE KEY-----`,
+	`(?i)(?:api[_-]?key|access[_-]?token|auth[_-]?token|secret[_-]?key|client[_-]?secret|password|passwd)\\?["']?\s*[:=]\s*\\?["']?([^\s"'\\,;&]{6,})`,
+}
+
+// Redactor masks text matching its patterns and the secret values added to it. It is safe
+// for concurrent use. A nil Redactor masks nothing.
+type Redactor struct {
+	patterns []*regexp.Regexp
+
+	mu       sync.RWMutex
+	values   map[string]bool
+	replacer *strings.Replacer // Of values; rebuilt when they change, nil if there are none
+}
+
+// New returns a redactor masking text that matches patterns.
+func New(patterns []string) (*Redactor, error) {
+	r := &Redactor{values: make(map[string]bool)}
+	for _, pattern := range patterns {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid redaction pattern %q: %w", pattern, err)
+		}
+		if re.NumSubexp() > 1 {
+			return nil, fmt.Errorf("invalid redaction pattern %q: use at most one group, for the part to mask", pattern)
+		}
+		r.patterns = append(r.patterns, re)
+	}
+	return r, nil
+}
+
+// ReadPatterns reads patterns, one per line. Blank lines and lines starting with "#" are
+// skipped.
+func ReadPatterns(rd io.Reader) ([]string, error) {
+	var patterns []string
+	scanner := bufio.NewScanner(rd)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		patterns = append(patterns, line)
+	}
+	return patterns, scanner.Err()
+}
+
+// AddValue masks a secret value wherever it appears from now on. Values shorter than
+// MinValueLength are ignored.
+func (r *Redactor) AddValue(value string) {
+	if r == nil || len(value) < MinValueLength {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.values[value] {
+		return
+	}
+	r.values[value] = true
+	r.replacer = nil
+}
+
+// Bytes masks b. It returns b itself if nothing is masked.
+func (r *Redactor) Bytes(b []byte) []byte {
+	if r == nil || len(b) == 0 {
+		return b
+	}
+	for _, re := range r.patterns {
+		b = maskMatches(re, b)
+	}
+	if replacer := r.valueReplacer(); replacer != nil {
+		s := string(b)
+		if masked := replacer.Replace(s); masked != s {
+			b = []byte(masked)
+		}
+	}
+	return b
+}
+
+// String masks s.
+func (r *Redactor) String(s string) string {
+	if r == nil || s == "" {
+		return s
+	}
+	return string(r.Bytes([]byte(s)))
+}
+
+// valueReplacer returns the replacer of the secret values, building it if they changed.
+func (r *Redactor) valueReplacer() *strings.Replacer {
+	r.mu.RLock()
+	replacer, n := r.replacer, len(r.values)
+	r.mu.RUnlock()
+	if replacer != nil || n == 0 {
+		return replacer
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.replacer != nil {
+		return r.replacer
+	}
+	// Longest first, so a value containing another is masked whole
+	forms := make([]string, 0, 2*len(r.values))
+	for value := range r.values {
+		forms = append(forms, value)
+		if escaped := jsonEscape(value); escaped != value {
+			forms = append(forms, escaped)
+		}
+	}
+	sort.Slice(forms, func(i, j int) bool { return len(forms[i]) > len(forms[j]) })
+	oldnew := make([]string, 0, 2*len(forms))
+	for _, form := range forms {
+		oldnew = append(oldnew, form, Mask)
+	}
+	r.replacer = strings.NewReplacer(oldnew...)
+	return r.replacer
+}
+
+// maskMatches masks the matches of re in b, or their group if re has one.
+func maskMatches(re *regexp.Regexp, b []byte) []byte {
+	matches := re.FindAllSubmatchIndex(b, -1)
+	if len(matches) == 0 {
+		return b
+	}
+	out := make([]byte, 0, len(b))
+	last := 0
+	for _, match := range matches {
+		start, end := match[0], match[1]
+		if len(match) >= 4 && match[2] >= 0 {
+			start, end = match[2], match[3]
+		}
+		out = append(out, b[last:start]...)
+		out = append(out, Mask...)
+		last = end
+	}
+	return append(out, b[last:]...)
+}
+
+// jsonEscape returns value as it appears inside a JSON string.
+func jsonEscape(value string) string {
+	encoded, err := json.Marshal(value)
+	if err != nil {
+		return value
+	}
+	return string(encoded[1 : len(encoded)-1])
+}
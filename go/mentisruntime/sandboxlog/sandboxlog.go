@@ -0,0 +1,283 @@
+// Package sandboxlog keeps log files for each sandbox, such as its container output and its
+// observations, with size-based rotation. Files outlive their sandbox so they can be read
+// after a crash or deletion, and are pruned once untouched for the retention period.
+package sandboxlog
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Defaults used when a Config field is zero.
+const (
+	DefaultMaxBytes  = 10 << 20
+	DefaultMaxFiles  = 5
+	DefaultRetention = 7 * 24 * time.Hour
+)
+
+// Log names.
+const (
+	ContainerLog    = "container"    // Container stdout and stderr
+	ObservationsLog = "observations" // Observations as broadcast, one JSON message per line
+)
+
+// ErrNotFound is returned for sandboxes and files without logs.
+var ErrNotFound = errors.New("log not found")
+
+// spaceFile records the space of a sandbox in its log directory.
+const spaceFile = "space"
+
+var (
+	sandboxIDRe = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_.-]*$`)
+	fileNameRe  = regexp.MustCompile(`^[a-z]+\.log(\.[0-9]+)?$`)
+)
+
+// Config configures a Store.
+type Config struct {
+	MaxBytes  int64         // Size at which a log file is rotated
+	MaxFiles  int           // Files kept per log, including the current one
+	Retention time.Duration // How long logs of idle sandboxes are kept
+}
+
+// FileInfo describes a log file.
+type FileInfo struct {
+	Name     string    `json:"name"`
+	Size     int64     `json:"size"`
+	Modified time.Time `json:"modified"`
+}
+
+// Store manages the log directories of all sandboxes under one directory.
+type Store struct {
+	dir    string
+	config Config
+
+	mu      sync.Mutex
+	writers map[string]*rotatingFile // Map sandboxID/name to its open log
+}
+
+// NewStore creates a store under dir.
+func NewStore(dir string, config Config) (*Store, error) {
+	if config.MaxBytes <= 0 {
+		config.MaxBytes = DefaultMaxBytes
+	}
+	if config.MaxFiles <= 0 {
+		config.MaxFiles = DefaultMaxFiles
+	}
+	if config.Retention <= 0 {
+		config.Retention = DefaultRetention
+	}
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, fmt.Errorf("create log dir: %w", err)
+	}
+	return &Store{dir: dir, config: config, writers: make(map[string]*rotatingFile)}, nil
+}
+
+// Register creates the log directory of a sandbox. Only registered sandboxes are logged, so
+// Append can be called for any stream without checking. Registering prunes expired logs.
+func (s *Store) Register(sandboxID, spaceID string) error {
+	if !sandboxIDRe.MatchString(sandboxID) {
+		return fmt.Errorf("invalid sandbox ID %q", sandboxID)
+	}
+	s.prune()
+	dir := filepath.Join(s.dir, sandboxID)
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return fmt.Errorf("create sandbox log dir: %w", err)
+	}
+	return os.WriteFile(filepath.Join(dir, spaceFile), []byte(spaceID), 0o600)
+}
+
+// Append writes data to a log of a sandbox, rotating it when it grows past MaxBytes. It does
+// nothing for sandboxes that were never registered.
+func (s *Store) Append(sandboxID, name string, data []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	key := sandboxID + "/" + name
+	w, ok := s.writers[key]
+	if !ok {
+		if !sandboxIDRe.MatchString(sandboxID) {
+			return nil
+		}
+		dir := filepath.Join(s.dir, sandboxID)
+		if _, err := os.Stat(filepath.Join(dir, spaceFile)); err != nil {
+			return nil
+		}
+		w = &rotatingFile{path: filepath.Join(dir, name+".log"), maxBytes: s.config.MaxBytes, maxFiles: s.config.MaxFiles}
+		s.writers[key] = w
+	}
+	return w.write(data)
+}
+
+// Close closes the open logs of a sandbox. Its files are kept.
+func (s *Store) Close(sandboxID string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	prefix := sandboxID + "/"
+	for key, w := range s.writers {
+		if strings.HasPrefix(key, prefix) {
+			w.close()
+			delete(s.writers, key)
+		}
+	}
+}
+
+// List returns the space of a sandbox and its log files, newest rotation first per log.
+func (s *Store) List(sandboxID string) (string, []FileInfo, error) {
+	if !sandboxIDRe.MatchString(sandboxID) {
+		return "", nil, ErrNotFound
+	}
+	dir := filepath.Join(s.dir, sandboxID)
+	space, err := os.ReadFile(filepath.Join(dir, spaceFile))
+	if err != nil {
+		return "", nil, ErrNotFound
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return "", nil, err
+	}
+	files := []FileInfo{}
+	for _, e := range entries {
+		if !fileNameRe.MatchString(e.Name()) {
+			continue
+		}
+		info, err := e.Info()
+		if err != nil {
+			continue
+		}
+		files = append(files, FileInfo{Name: e.Name(), Size: info.Size(), Modified: info.ModTime().UTC()})
+	}
+	sort.Slice(files, func(i, j int) bool { return fileLess(files[i].Name, files[j].Name) })
+	return string(space), files, nil
+}
+
+// Open opens a log file of a sandbox for reading.
+func (s *Store) Open(sandboxID, file string) (*os.File, error) {
+	if !sandboxIDRe.MatchString(sandboxID) || !fileNameRe.MatchString(file) {
+		return nil, ErrNotFound
+	}
+	f, err := os.Open(filepath.Join(s.dir, sandboxID, file))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, ErrNotFound
+	}
+	return f, err
+}
+
+// prune removes the logs of sandboxes whose files have not changed for the retention period.
+func (s *Store) prune() {
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return
+	}
+	cutoff := time.Now().Add(-s.config.Retention)
+	for _, e := range entries {
+		if !e.IsDir() || s.active(e.Name()) {
+			continue
+		}
+		dir := filepath.Join(s.dir, e.Name())
+		if lastModified(dir).Before(cutoff) {
+			os.RemoveAll(dir)
+		}
+	}
+}
+
+func (s *Store) active(sandboxID string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	prefix := sandboxID + "/"
+	for key := range s.writers {
+		if strings.HasPrefix(key, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+func lastModified(dir string) time.Time {
+	var latest time.Time
+	entries, _ := os.ReadDir(dir)
+	for _, e := range entries {
+		if info, err := e.Info(); err == nil && info.ModTime().After(latest) {
+			latest = info.ModTime()
+		}
+	}
+	return latest
+}
+
+// fileLess orders files by log name, then by rotation with the current file first.
+func fileLess(a, b string) bool {
+	baseA, nA := splitRotation(a)
+	baseB, nB := splitRotation(b)
+	if baseA != baseB {
+		return baseA < baseB
+	}
+	return nA < nB
+}
+
+func splitRotation(name string) (string, int) {
+	base, suffix, found := strings.Cut(name, ".log.")
+	if !found {
+		return strings.TrimSuffix(name, ".log"), 0
+	}
+	n, _ := strconv.Atoi(suffix)
+	return base, n
+}
+
+// rotatingFile is an append-only file that is renamed to path.1 (shifting older rotations
+// up and dropping the oldest) once it would grow past maxBytes.
+type rotatingFile struct {
+	path     string
+	maxBytes int64
+	maxFiles int
+	file     *os.File
+	size     int64
+}
+
+func (r *rotatingFile) write(data []byte) error {
+	if r.file == nil {
+		f, err := os.OpenFile(r.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600)
+		if err != nil {
+			return err
+		}
+		info, err := f.Stat()
+		if err != nil {
+			f.Close()
+			return err
+		}
+		r.file, r.size = f, info.Size()
+	}
+	if r.size > 0 && r.size+int64(len(data)) > r.maxBytes {
+		if err := r.rotate(); err != nil {
+			return err
+		}
+		return r.write(data)
+	}
+	n, err := r.file.Write(data)
+	r.size += int64(n)
+	return err
+}
+
+func (r *rotatingFile) rotate() error {
+	r.close()
+	os.Remove(fmt.Sprintf("%s.%d", r.path, r.maxFiles-1))
+	for i := r.maxFiles - 2; i >= 1; i-- {
+		os.Rename(fmt.Sprintf("%s.%d", r.path, i), fmt.Sprintf("%s.%d", r.path, i+1))
+	}
+	if r.maxFiles > 1 {
+		return os.Rename(r.path, r.path+".1")
+	}
+	return os.Remove(r.path)
+}
+
+func (r *rotatingFile) close() {
+	if r.file != nil {
+		r.file.Close()
+		r.file = nil
+	}
+}
@@ -0,0 +1,56 @@
+package sandboxlog
+
+import (
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestStore_rotatesAndLists(t *testing.T) {
+	s, err := NewStore(t.TempDir(), Config{MaxBytes: 10, MaxFiles: 3})
+	require.NoError(t, err)
+
+	require.NoError(t, s.Append("sb1", ContainerLog, []byte("ignored\n")))
+	_, _, err = s.List("sb1")
+	require.ErrorIs(t, err, ErrNotFound)
+
+	require.NoError(t, s.Register("sb1", "team"))
+	for _, line := range []string{"one\n", "two\n", "three\n", "four\n", "five\n"} {
+		require.NoError(t, s.Append("sb1", ContainerLog, []byte(line)))
+	}
+	require.NoError(t, s.Append("sb1", ObservationsLog, []byte("{}\n")))
+	s.Close("sb1")
+
+	space, files, err := s.List("sb1")
+	require.NoError(t, err)
+	require.Equal(t, "team", space)
+	var names []string
+	for _, f := range files {
+		names = append(names, f.Name)
+	}
+	require.Equal(t, []string{"container.log", "container.log.1", "container.log.2", "observations.log"}, names)
+
+	f, err := s.Open("sb1", "container.log")
+	require.NoError(t, err)
+	defer f.Close()
+	data, err := io.ReadAll(f)
+	require.NoError(t, err)
+	require.Equal(t, "four\nfive\n", string(data))
+
+	_, err = s.Open("sb1", "../space")
+	require.ErrorIs(t, err, ErrNotFound)
+}
+
+func TestFileLess(t *testing.T) {
+	names := []string{"observations.log", "container.log.2", "container.log", "container.log.10"}
+	for i := range names {
+		for j := range names {
+			if i < j && fileLess(names[j], names[i]) {
+				names[i], names[j] = names[j], names[i]
+			}
+		}
+	}
+	require.Equal(t, "container.log,container.log.2,container.log.10,observations.log", strings.Join(names, ","))
+}
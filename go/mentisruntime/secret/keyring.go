@@ -0,0 +1,239 @@
+package secret
+
+import (
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrUnknownKey is returned when data was sealed with a key the keyring does not have.
+var ErrUnknownKey = errors.New("unknown data key")
+
+// DataKey is the metadata of a data key. The key itself is never part of it.
+type DataKey struct {
+	ID        string    `json:"id"` // "<scope>/<version>"
+	Scope     string    `json:"scope"`
+	Version   int       `json:"version"`
+	CreatedAt time.Time `json:"created_at"`
+	Current   bool      `json:"current"` // Whether new data is sealed with this key
+}
+
+type dataKey struct {
+	DataKey
+	Wrapped []byte `json:"wrapped"` // nonce || key sealed with the master key
+
+	aead cipher.AEAD // Unwrapped on first use
+}
+
+// Keyring holds data keys for envelope encryption: data is sealed with a random key of its
+// scope, and data keys are stored sealed with the master key. Rotating a scope's key seals
+// new data with a new key; older keys are kept to open what they sealed.
+type Keyring struct {
+	mu     sync.Mutex
+	master cipher.AEAD
+	path   string
+	scopes map[string][]*dataKey // By scope, oldest first; the last is current
+}
+
+// NewKeyring creates a keyring wrapping data keys with masterKey. If path is non-empty,
+// existing keys are loaded from it and new keys are written back.
+func NewKeyring(masterKey []byte, path string) (*Keyring, error) {
+	master, err := newAEAD(masterKey)
+	if err != nil {
+		return nil, err
+	}
+	k := &Keyring{master: master, path: path, scopes: make(map[string][]*dataKey)}
+	if path != "" {
+		if err := k.load(); err != nil {
+			return nil, err
+		}
+	}
+	return k, nil
+}
+
+// Seal encrypts plaintext with the current key of scope, creating the scope's first key if
+// it has none, and binds it to additionalData. It returns the ID of the key for Open.
+func (k *Keyring) Seal(scope string, plaintext, additionalData []byte) (string, []byte, error) {
+	k.mu.Lock()
+	keys := k.scopes[scope]
+	if len(keys) == 0 {
+		if _, err := k.rotateLocked(scope); err != nil {
+			k.mu.Unlock()
+			return "", nil, err
+		}
+		keys = k.scopes[scope]
+	}
+	key := keys[len(keys)-1]
+	aead, err := k.unwrapLocked(key)
+	k.mu.Unlock()
+	if err != nil {
+		return "", nil, err
+	}
+
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", nil, err
+	}
+	return key.ID, aead.Seal(nonce, nonce, plaintext, additionalData), nil
+}
+
+// Open decrypts what Seal returned.
+func (k *Keyring) Open(keyID string, ciphertext, additionalData []byte) ([]byte, error) {
+	k.mu.Lock()
+	key := k.findLocked(keyID)
+	if key == nil {
+		k.mu.Unlock()
+		return nil, fmt.Errorf("%w %q", ErrUnknownKey, keyID)
+	}
+	aead, err := k.unwrapLocked(key)
+	k.mu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+
+	n := aead.NonceSize()
+	if len(ciphertext) < n {
+		return nil, fmt.Errorf("key %s: corrupt ciphertext", keyID)
+	}
+	plain, err := aead.Open(nil, ciphertext[:n], ciphertext[n:], additionalData)
+	if err != nil {
+		return nil, fmt.Errorf("key %s: decrypt: %w", keyID, err)
+	}
+	return plain, nil
+}
+
+// Rotate makes a new key the current key of scope and returns its metadata.
+func (k *Keyring) Rotate(scope string) (*DataKey, error) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	return k.rotateLocked(scope)
+}
+
+// Keys returns the metadata of the keys of scope, oldest first.
+func (k *Keyring) Keys(scope string) []DataKey {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	keys := k.scopes[scope]
+	metas := make([]DataKey, len(keys))
+	for i, key := range keys {
+		metas[i] = key.DataKey
+		metas[i].Current = i == len(keys)-1
+	}
+	return metas
+}
+
+// rotateLocked implements Rotate. Callers must hold k.mu.
+func (k *Keyring) rotateLocked(scope string) (*DataKey, error) {
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		return nil, err
+	}
+	aead, err := newAEAD(raw)
+	if err != nil {
+		return nil, err
+	}
+	version := len(k.scopes[scope]) + 1
+	id := scope + "/" + strconv.Itoa(version)
+	nonce := make([]byte, k.master.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	// The ID is bound as additional data so wrapped keys cannot be swapped between scopes.
+	key := &dataKey{
+		DataKey: DataKey{ID: id, Scope: scope, Version: version, CreatedAt: time.Now().UTC()},
+		Wrapped: k.master.Seal(nonce, nonce, raw, []byte(id)),
+		aead:    aead,
+	}
+	k.scopes[scope] = append(k.scopes[scope], key)
+	if err := k.save(); err != nil {
+		k.scopes[scope] = k.scopes[scope][:version-1]
+		return nil, err
+	}
+	meta := key.DataKey
+	meta.Current = true
+	return &meta, nil
+}
+
+// findLocked returns the key with an ID, or nil. Callers must hold k.mu.
+func (k *Keyring) findLocked(id string) *dataKey {
+	i := strings.LastIndex(id, "/")
+	if i < 0 {
+		return nil
+	}
+	version, err := strconv.Atoi(id[i+1:])
+	keys := k.scopes[id[:i]]
+	if err != nil || version < 1 || version > len(keys) {
+		return nil
+	}
+	return keys[version-1]
+}
+
+// unwrapLocked returns the cipher of a key, decrypting the key on first use. Callers must
+// hold k.mu.
+func (k *Keyring) unwrapLocked(key *dataKey) (cipher.AEAD, error) {
+	if key.aead != nil {
+		return key.aead, nil
+	}
+	n := k.master.NonceSize()
+	if len(key.Wrapped) < n {
+		return nil, fmt.Errorf("key %s: corrupt wrapped key", key.ID)
+	}
+	raw, err := k.master.Open(nil, key.Wrapped[:n], key.Wrapped[n:], []byte(key.ID))
+	if err != nil {
+		return nil, fmt.Errorf("key %s: unwrap: %w", key.ID, err)
+	}
+	if key.aead, err = newAEAD(raw); err != nil {
+		return nil, err
+	}
+	return key.aead, nil
+}
+
+func (k *Keyring) load() error {
+	data, err := os.ReadFile(k.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("read keyring file: %w", err)
+	}
+	var scopes map[string][]*dataKey
+	if err := json.Unmarshal(data, &scopes); err != nil {
+		return fmt.Errorf("parse keyring file: %w", err)
+	}
+	for scope, keys := range scopes {
+		for i, key := range keys {
+			if key.Scope != scope || key.Version != i+1 {
+				return fmt.Errorf("parse keyring file: key %q out of order", key.ID)
+			}
+		}
+		k.scopes[scope] = keys
+	}
+	return nil
+}
+
+// save writes all keys to the keyring file. Callers must hold k.mu.
+func (k *Keyring) save() error {
+	if k.path == "" {
+		return nil
+	}
+	data, err := json.Marshal(k.scopes)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(k.path), 0o700); err != nil {
+		return fmt.Errorf("create keyring dir: %w", err)
+	}
+	tmp := k.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return fmt.Errorf("write keyring file: %w", err)
+	}
+	return os.Rename(tmp, k.path)
+}
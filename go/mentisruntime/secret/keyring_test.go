@@ -0,0 +1,49 @@
+package secret
+
+import (
+	"bytes"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestKeyring_sealRotateAndPersistence(t *testing.T) {
+	master := bytes.Repeat([]byte{7}, 32)
+	path := filepath.Join(t.TempDir(), "keys.json")
+	k, err := NewKeyring(master, path)
+	require.NoError(t, err)
+
+	oldID, oldSealed, err := k.Seal("space-a", []byte("output"), []byte("sb/1"))
+	require.NoError(t, err)
+	require.Equal(t, "space-a/1", oldID)
+	rotated, err := k.Rotate("space-a")
+	require.NoError(t, err)
+	require.Equal(t, "space-a/2", rotated.ID)
+	newID, newSealed, err := k.Seal("space-a", []byte("more"), []byte("sb/2"))
+	require.NoError(t, err)
+	require.Equal(t, "space-a/2", newID)
+
+	reopened, err := NewKeyring(master, path)
+	require.NoError(t, err)
+	plain, err := reopened.Open(oldID, oldSealed, []byte("sb/1"))
+	require.NoError(t, err)
+	require.Equal(t, "output", string(plain))
+	plain, err = reopened.Open(newID, newSealed, []byte("sb/2"))
+	require.NoError(t, err)
+	require.Equal(t, "more", string(plain))
+	keys := reopened.Keys("space-a")
+	require.Len(t, keys, 2)
+	require.False(t, keys[0].Current)
+	require.True(t, keys[1].Current)
+
+	_, err = reopened.Open(oldID, oldSealed, []byte("sb/2"))
+	require.Error(t, err, "sealed data must be bound to its additional data")
+	_, err = reopened.Open("space-b/1", oldSealed, []byte("sb/1"))
+	require.ErrorIs(t, err, ErrUnknownKey)
+
+	wrongMaster, err := NewKeyring(bytes.Repeat([]byte{8}, 32), path)
+	require.NoError(t, err)
+	_, err = wrongMaster.Open(oldID, oldSealed, []byte("sb/1"))
+	require.Error(t, err, "keys must not unwrap with another master key")
+}
@@ -0,0 +1,258 @@
+// Package secret stores named secrets encrypted at rest with a runtime master key. Each
+// tenant has its own namespace of names; the empty tenant is that of untenanted requests.
+package secret
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"sync"
+	"time"
+)
+
+var (
+	ErrNotFound    = errors.New("secret not found")
+	ErrInvalidName = errors.New("invalid secret name")
+)
+
+var nameRe = regexp.MustCompile(`^[A-Za-z0-9_.-]{1,128}$`)
+
+// Secret is the metadata of a stored secret. The value is never part of it.
+type Secret struct {
+	Name        string    `json:"name"`
+	Tenant      string    `json:"tenant,omitempty"` // Owning tenant; empty outside tenant isolation
+	Description string    `json:"description,omitempty"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+type entry struct {
+	Secret
+	Ciphertext []byte `json:"ciphertext"` // nonce || sealed value
+}
+
+// Store keeps secrets in memory, encrypted with AES-256-GCM, and optionally mirrors them to a file.
+type Store struct {
+	mu      sync.RWMutex
+	aead    cipher.AEAD
+	path    string
+	entries map[string]*entry
+}
+
+// ParseMasterKey decodes a base64-encoded 32 byte master key.
+func ParseMasterKey(encoded string) ([]byte, error) {
+	key, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, fmt.Errorf("master key is not valid base64: %w", err)
+	}
+	if len(key) != 32 {
+		return nil, fmt.Errorf("master key must be 32 bytes, got %d", len(key))
+	}
+	return key, nil
+}
+
+// NewStore creates a store encrypting with masterKey. If path is non-empty, existing
+// secrets are loaded from it and every change is written back.
+func NewStore(masterKey []byte, path string) (*Store, error) {
+	aead, err := newAEAD(masterKey)
+	if err != nil {
+		return nil, err
+	}
+	s := &Store{aead: aead, path: path, entries: make(map[string]*entry)}
+	if path != "" {
+		if err := s.load(); err != nil {
+			return nil, err
+		}
+	}
+	return s, nil
+}
+
+// newAEAD returns AES-256-GCM with key.
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("create cipher: %w", err)
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, fmt.Errorf("create gcm: %w", err)
+	}
+	return aead, nil
+}
+
+// key is the key of a tenant's secret in the entries map. Names cannot contain "/", so keys
+// of different tenants never collide, and those of the empty tenant are the bare names.
+func key(tenant, name string) string {
+	if tenant == "" {
+		return name
+	}
+	return tenant + "/" + name
+}
+
+// Put creates or replaces a secret of a tenant.
+func (s *Store) Put(tenant, name, value, description string) (*Secret, error) {
+	if !nameRe.MatchString(name) {
+		return nil, ErrInvalidName
+	}
+	k := key(tenant, name)
+	nonce := make([]byte, s.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	// The key is bound as additional data so ciphertexts cannot be swapped between secrets.
+	ciphertext := s.aead.Seal(nonce, nonce, []byte(value), []byte(k))
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now().UTC()
+	e := &entry{Secret: Secret{Name: name, Tenant: tenant, Description: description, CreatedAt: now, UpdatedAt: now}, Ciphertext: ciphertext}
+	if prev, exists := s.entries[k]; exists {
+		e.CreatedAt = prev.CreatedAt
+	}
+	entries := s.copyEntries()
+	entries[k] = e
+	if err := s.save(entries); err != nil {
+		return nil, err
+	}
+	s.entries = entries
+	meta := e.Secret
+	return &meta, nil
+}
+
+// Get returns the metadata of a secret of a tenant.
+func (s *Store) Get(tenant, name string) (*Secret, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	e, ok := s.entries[key(tenant, name)]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	meta := e.Secret
+	return &meta, nil
+}
+
+// Value decrypts and returns the value of a secret of a tenant.
+func (s *Store) Value(tenant, name string) (string, error) {
+	k := key(tenant, name)
+	s.mu.RLock()
+	e, ok := s.entries[k]
+	s.mu.RUnlock()
+	if !ok {
+		return "", ErrNotFound
+	}
+	n := s.aead.NonceSize()
+	if len(e.Ciphertext) < n {
+		return "", fmt.Errorf("secret %s: corrupt ciphertext", name)
+	}
+	plain, err := s.aead.Open(nil, e.Ciphertext[:n], e.Ciphertext[n:], []byte(k))
+	if err != nil {
+		return "", fmt.Errorf("secret %s: decrypt: %w", name, err)
+	}
+	return string(plain), nil
+}
+
+// List returns the metadata of the secrets of a tenant sorted by name.
+func (s *Store) List(tenant string) []*Secret {
+	secrets := s.All()
+	tenantSecrets := secrets[:0]
+	for _, meta := range secrets {
+		if meta.Tenant == tenant {
+			tenantSecrets = append(tenantSecrets, meta)
+		}
+	}
+	return tenantSecrets
+}
+
+// All returns the metadata of the secrets of every tenant sorted by tenant and name.
+func (s *Store) All() []*Secret {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	secrets := make([]*Secret, 0, len(s.entries))
+	for _, e := range s.entries {
+		meta := e.Secret
+		secrets = append(secrets, &meta)
+	}
+	sort.Slice(secrets, func(i, j int) bool {
+		if secrets[i].Tenant != secrets[j].Tenant {
+			return secrets[i].Tenant < secrets[j].Tenant
+		}
+		return secrets[i].Name < secrets[j].Name
+	})
+	return secrets
+}
+
+// Delete removes a secret of a tenant.
+func (s *Store) Delete(tenant, name string) error {
+	k := key(tenant, name)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.entries[k]; !ok {
+		return ErrNotFound
+	}
+	entries := s.copyEntries()
+	delete(entries, k)
+	if err := s.save(entries); err != nil {
+		return err
+	}
+	s.entries = entries
+	return nil
+}
+
+// copyEntries returns a copy of the entries map, which changes are made to and saved before
+// they replace it, so a failed save leaves the store as it was. Callers must hold s.mu.
+func (s *Store) copyEntries() map[string]*entry {
+	entries := make(map[string]*entry, len(s.entries)+1)
+	for k, e := range s.entries {
+		entries[k] = e
+	}
+	return entries
+}
+
+func (s *Store) load() error {
+	data, err := os.ReadFile(s.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("read secrets file: %w", err)
+	}
+	var entries []*entry
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return fmt.Errorf("parse secrets file: %w", err)
+	}
+	for _, e := range entries {
+		s.entries[key(e.Tenant, e.Name)] = e
+	}
+	return nil
+}
+
+// save writes entries to the secrets file. Callers must hold s.mu.
+func (s *Store) save(entries map[string]*entry) error {
+	if s.path == "" {
+		return nil
+	}
+	list := make([]*entry, 0, len(entries))
+	for _, e := range entries {
+		list = append(list, e)
+	}
+	data, err := json.Marshal(list)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(s.path), 0o700); err != nil {
+		return fmt.Errorf("create secrets dir: %w", err)
+	}
+	tmp := s.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return fmt.Errorf("write secrets file: %w", err)
+	}
+	return os.Rename(tmp, s.path)
+}
@@ -0,0 +1,98 @@
+package secret
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestStore_roundTripAndPersistence(t *testing.T) {
+	key := bytes.Repeat([]byte{7}, 32)
+	path := filepath.Join(t.TempDir(), "secrets.json")
+
+	s, err := NewStore(key, path)
+	require.NoError(t, err)
+	_, err = s.Put("", "OPENAI_KEY", "sk-test-value", "llm key")
+	require.NoError(t, err)
+
+	raw, err := os.ReadFile(path)
+	require.NoError(t, err)
+	require.NotContains(t, string(raw), "sk-test-value", "value must not be stored in plaintext")
+
+	reopened, err := NewStore(key, path)
+	require.NoError(t, err)
+	val, err := reopened.Value("", "OPENAI_KEY")
+	require.NoError(t, err)
+	require.Equal(t, "sk-test-value", val)
+
+	wrongKey, err := NewStore(bytes.Repeat([]byte{8}, 32), path)
+	require.NoError(t, err)
+	_, err = wrongKey.Value("", "OPENAI_KEY")
+	require.Error(t, err)
+
+	require.NoError(t, reopened.Delete("", "OPENAI_KEY"))
+	_, err = reopened.Get("", "OPENAI_KEY")
+	require.ErrorIs(t, err, ErrNotFound)
+}
+
+func TestStore_invalidName(t *testing.T) {
+	s, err := NewStore(bytes.Repeat([]byte{1}, 32), "")
+	require.NoError(t, err)
+	_, err = s.Put("", "bad name!", "x", "")
+	require.ErrorIs(t, err, ErrInvalidName)
+}
+
+func TestStore_failedSaveKeepsEntries(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "secrets")
+	s, err := NewStore(bytes.Repeat([]byte{7}, 32), filepath.Join(dir, "secrets.json"))
+	require.NoError(t, err)
+	_, err = s.Put("", "TOKEN", "old", "")
+	require.NoError(t, err)
+
+	// A file in place of the directory makes every save fail
+	require.NoError(t, os.RemoveAll(dir))
+	require.NoError(t, os.WriteFile(dir, nil, 0o600))
+	_, err = s.Put("", "TOKEN", "new", "")
+	require.Error(t, err)
+	_, err = s.Put("", "OTHER", "value", "")
+	require.Error(t, err)
+	require.Error(t, s.Delete("", "TOKEN"))
+
+	val, err := s.Value("", "TOKEN")
+	require.NoError(t, err)
+	require.Equal(t, "old", val)
+	require.Len(t, s.List(""), 1)
+}
+
+func TestStore_tenantsHaveTheirOwnNames(t *testing.T) {
+	key := bytes.Repeat([]byte{7}, 32)
+	path := filepath.Join(t.TempDir(), "secrets.json")
+	s, err := NewStore(key, path)
+	require.NoError(t, err)
+	_, err = s.Put("acme", "TOKEN", "acme-value", "")
+	require.NoError(t, err)
+	_, err = s.Put("globex", "TOKEN", "globex-value", "")
+	require.NoError(t, err)
+
+	_, err = s.Value("", "TOKEN")
+	require.ErrorIs(t, err, ErrNotFound)
+	_, err = s.Get("initech", "TOKEN")
+	require.ErrorIs(t, err, ErrNotFound)
+	require.Len(t, s.List("acme"), 1)
+	require.Len(t, s.All(), 2)
+
+	reopened, err := NewStore(key, path)
+	require.NoError(t, err)
+	val, err := reopened.Value("globex", "TOKEN")
+	require.NoError(t, err)
+	require.Equal(t, "globex-value", val)
+	require.NoError(t, reopened.Delete("acme", "TOKEN"))
+	_, err = reopened.Value("acme", "TOKEN")
+	require.ErrorIs(t, err, ErrNotFound)
+	val, err = reopened.Value("globex", "TOKEN")
+	require.NoError(t, err)
+	require.Equal(t, "globex-value", val)
+}
@@ -0,0 +1,358 @@
+// Package server composes the runtime — the space and sandbox managers, the WebSocket hub
+// and the HTTP API — into an http.Handler, for programs that mount the runtime in their own
+// binary and wrap it in their own middleware. The sandboxaid binary is one of them.
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/docker/docker/client"
+	"github.com/gorilla/mux"
+
+	"github.com/foreveryh/sandboxai/go/mentisruntime/handler"
+	"github.com/foreveryh/sandboxai/go/mentisruntime/logging"
+	"github.com/foreveryh/sandboxai/go/mentisruntime/manager"
+	"github.com/foreveryh/sandboxai/go/mentisruntime/metrics"
+	"github.com/foreveryh/sandboxai/go/mentisruntime/ui"
+	"github.com/foreveryh/sandboxai/go/mentisruntime/ws"
+)
+
+// Config configures a Server. Docker is required; zero values of the other fields disable
+// what they configure or keep a default.
+type Config struct {
+	Docker *client.Client // Client of the Docker daemon sandboxes run on
+	Logger *slog.Logger   // slog.Default() if nil
+	Scope  string         // Scope of the containers the runtime manages; "default" if empty
+
+	ManagerOptions []manager.Option // Optional features of the sandbox manager
+	WebSocket      ws.Config        // Hub and stream client settings; zero fields keep defaults
+
+	DataDir           string          // Data dir /v1/readyz checks is writable; empty skips the check
+	AdminToken        string          // Bearer token of /v1/admin and /v1/events; empty leaves /v1/admin open and disables /v1/events
+	TenantHeader      string          // Header naming the tenant of a request; empty disables tenant isolation, which needs AdminToken
+	LogLevels         *logging.Levels // Levels /v1/admin/log-levels reads and changes; nil omits the route
+	Gzip              bool            // Compress responses for clients that accept gzip
+	UI                bool            // Serve the web UI under /ui
+	V1Sunset          time.Time       // Sunset date announced on deprecated version 1 routes
+	ArtifactDownloads http.Handler    // Serves /v1/artifacts/download for the local artifact store
+
+	// Middleware wraps every matched route, in order, inside panic recovery and compression.
+	Middleware []mux.MiddlewareFunc
+	// APIMiddleware wraps the routes of both API versions, sandbox WebSocket streams
+	// included, in order, before tenant isolation, so it may set the tenant header, e.g. from
+	// an authenticated identity.
+	APIMiddleware []mux.MiddlewareFunc
+	// Routes registers extra routes: on router, or on api, the /v1 subrouter, to get
+	// APIMiddleware and tenant isolation. Built-in routes take precedence.
+	Routes func(router, api *mux.Router)
+}
+
+// Server is the runtime as an http.Handler serving its API under /v1 and /v2. Its managers
+// and hub run until Shutdown.
+type Server struct {
+	Manager *manager.SandboxManager
+	Spaces  *manager.SpaceManager
+	Hub     *ws.Hub
+
+	router      http.Handler
+	logger      *slog.Logger
+	stopManager context.CancelFunc
+	stopHub     context.CancelFunc
+	hubStopped  chan struct{}
+	shutdown    sync.Once
+}
+
+// NewServer starts the managers and hub of a runtime and builds its router.
+func NewServer(cfg Config) (*Server, error) {
+	if cfg.Docker == nil {
+		return nil, errors.New("server: a Docker client is required")
+	}
+	if err := cfg.WebSocket.Validate(); err != nil {
+		return nil, fmt.Errorf("server: %w", err)
+	}
+	if cfg.TenantHeader != "" && cfg.AdminToken == "" {
+		// Open admin routes would let tenants reach every space
+		return nil, errors.New("server: tenant isolation requires an admin token")
+	}
+	logger := cfg.Logger
+	if logger == nil {
+		logger = slog.Default()
+	}
+	scope := cfg.Scope
+	if scope == "" {
+		scope = "default"
+	}
+
+	hub := ws.NewHub(logger, ws.WithConfig(cfg.WebSocket))
+	hubCtx, stopHub := context.WithCancel(context.Background())
+	hubStopped := make(chan struct{})
+	go func() {
+		hub.Run(hubCtx)
+		close(hubStopped)
+	}()
+
+	spaceManager := manager.NewSpaceManager(logger)
+	// Canceled on shutdown, stopping background loops and in-flight agent requests
+	managerCtx, stopManager := context.WithCancel(context.Background())
+	sandboxManager, err := manager.NewSandboxManager(managerCtx, cfg.Docker, hub, spaceManager, logger, scope, cfg.ManagerOptions...)
+	if err != nil {
+		stopManager()
+		stopHub()
+		return nil, fmt.Errorf("create sandbox manager: %w", err)
+	}
+
+	s := &Server{
+		Manager:     sandboxManager,
+		Spaces:      spaceManager,
+		Hub:         hub,
+		logger:      logger,
+		stopManager: stopManager,
+		stopHub:     stopHub,
+		hubStopped:  hubStopped,
+	}
+	s.router = newRouter(cfg, handler.NewAPIHandler(logger, sandboxManager, spaceManager, hub), sandboxManager, hub, logger)
+	return s, nil
+}
+
+// ServeHTTP serves the runtime's API.
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.router.ServeHTTP(w, r)
+}
+
+// Shutdown stops the sandbox manager, waits for its work to finish, then stops the hub, so
+// the observations of the manager's shutdown reach clients. Stop serving requests first,
+// e.g. with http.Server.Shutdown. Sandboxes keep running. It returns ctx's error if ctx ends
+// first.
+func (s *Server) Shutdown(ctx context.Context) error {
+	s.shutdown.Do(func() {
+		s.stopManager()
+		go func() {
+			s.Manager.Wait()
+			s.stopHub()
+		}()
+	})
+	select {
+	case <-s.hubStopped:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// newRouter registers the routes of the API.
+func newRouter(cfg Config, apiHandler *handler.APIHandler, sandboxManager *manager.SandboxManager, hub *ws.Hub, logger *slog.Logger) http.Handler {
+	router := mux.NewRouter()
+	router.Use(handler.Recover(logger))
+	if cfg.Gzip {
+		router.Use(handler.Gzip)
+	}
+	router.Use(cfg.Middleware...)
+
+	// Version 1 routes superseded by version 2 are marked deprecated, with an optional sunset date (YYYY-MM-DD)
+	v1Deprecated := handler.Deprecated(handler.V1ObservationsDeprecated, cfg.V1Sunset)
+
+	// Register handlers
+	api := router.PathPrefix("/v1").Subrouter()
+	api.Use(cfg.APIMiddleware...)
+	api.HandleFunc("/health", handler.HealthCheckHandler).Methods("GET")
+	api.Handle("/metrics", metrics.Default).Methods("GET")
+	checks := map[string]handler.ReadinessCheck{
+		"docker": sandboxManager.PingDocker,
+		"hub":    hub.Ping,
+		"host":   handler.Degraded(sandboxManager.CheckHostPressure),
+	}
+	if cfg.DataDir != "" {
+		checks["state_store"] = func(ctx context.Context) error { return checkWritableDir(cfg.DataDir) }
+	}
+	api.HandleFunc("/readyz", handler.ReadyzHandler(checks)).Methods("GET")
+
+	// Tenant isolation of spaces, keyed by a header set by an authenticating proxy (disabled unless set)
+	if cfg.TenantHeader != "" {
+		api.Use(apiHandler.RequireTenant(cfg.TenantHeader))
+	}
+	// Sandbox names are unique per space, so resolve them once the space is known
+	api.Use(apiHandler.ResolveSandboxNames)
+
+	// Space routes (using chi style params)
+	api.HandleFunc("/spaces", apiHandler.CreateSpaceHandler).Methods("POST")
+	api.HandleFunc("/spaces", apiHandler.ListSpacesHandler).Methods("GET")
+	api.HandleFunc("/spaces/{spaceID}", apiHandler.GetSpaceHandler).Methods("GET")
+	api.HandleFunc("/spaces/{spaceID}", apiHandler.UpdateSpaceHandler).Methods("PUT")
+	api.HandleFunc("/spaces/{spaceID}", apiHandler.DeleteSpaceHandler).Methods("DELETE")
+	api.HandleFunc("/spaces/{spaceID}/budget", apiHandler.GetSpaceBudgetHandler).Methods("GET")
+	api.HandleFunc("/spaces/{spaceID}/budget", apiHandler.SetSpaceBudgetHandler).Methods("PUT")
+	api.HandleFunc("/spaces/{spaceID}/budget", apiHandler.DeleteSpaceBudgetHandler).Methods("DELETE")
+	api.HandleFunc("/spaces/{spaceID}/endpoints", apiHandler.GetSpaceEndpointsHandler).Methods("GET")
+	api.HandleFunc("/spaces/{spaceID}/stream", apiHandler.StreamSpaceHandler)
+	api.HandleFunc("/spaces/{spaceID}/transfers", apiHandler.CreateTransferHandler).Methods("POST")
+	api.HandleFunc("/spaces/{spaceID}/sandboxes/{sandboxID}/files", apiHandler.ReadFilesHandler).Methods("GET")
+	api.HandleFunc("/spaces/{spaceID}/sandboxes/{sandboxID}/files", apiHandler.WriteFilesHandler).Methods("PUT")
+	api.HandleFunc("/spaces/{spaceID}/sandboxes/{sandboxID}/files:checksums", apiHandler.FileChecksumsHandler).Methods("GET")
+
+	// Sandbox routes (associated with a space, using chi style params)
+	api.HandleFunc("/spaces/{spaceID}/sandboxes", apiHandler.CreateSandboxHandler).Methods("POST")
+	api.HandleFunc("/spaces/{spaceID}/sandboxes:batchDelete", apiHandler.BatchDeleteSandboxesHandler).Methods("POST")
+	api.HandleFunc("/spaces/{spaceID}/sandboxes/{sandboxID}", apiHandler.GetSandboxHandler).Methods("GET")       // Added GET sandbox
+	api.HandleFunc("/spaces/{spaceID}/sandboxes/{sandboxID}", apiHandler.DeleteSandboxHandler).Methods("DELETE") // Corrected DELETE sandbox path
+	api.HandleFunc("/spaces/{spaceID}/sandboxes/{sandboxID}", apiHandler.UpdateSandboxHandler).Methods("PATCH")
+	api.HandleFunc("/spaces/{spaceID}/sandboxes/{sandboxID}/stats", apiHandler.GetSandboxStatsHandler).Methods("GET")
+	api.HandleFunc("/spaces/{spaceID}/sandboxes/{sandboxID}/env", apiHandler.GetSandboxEnvHandler).Methods("GET")
+	api.HandleFunc("/spaces/{spaceID}/sandboxes/{sandboxID}/info", apiHandler.GetSandboxInfoHandler).Methods("GET")
+	api.HandleFunc("/spaces/{spaceID}/sandboxes/{sandboxID}/progress", apiHandler.GetCreationProgressHandler).Methods("GET")
+	api.HandleFunc("/spaces/{spaceID}/sandboxes/{sandboxID}:clone", apiHandler.CloneSandboxHandler).Methods("POST")
+	api.HandleFunc("/spaces/{spaceID}/sandboxes/{sandboxID}:replay", apiHandler.ReplaySandboxHandler).Methods("POST")
+	api.HandleFunc("/spaces/{spaceID}/sandboxes/{sandboxID}/replay", apiHandler.GetReplayHandler).Methods("GET")
+	api.HandleFunc("/spaces/{spaceID}/sandboxes/{sandboxID}/recording", apiHandler.GetRecordingHandler).Methods("GET")
+	api.Handle("/spaces/{spaceID}/sandboxes/{sandboxID}/observations", v1Deprecated(http.HandlerFunc(apiHandler.ListObservationsHandler))).Methods("GET")
+	api.HandleFunc("/spaces/{spaceID}/sandboxes/{sandboxID}/timeline", apiHandler.GetTimelineHandler).Methods("GET")
+
+	// Action routes (associated with a specific sandbox)
+	api.HandleFunc("/spaces/{spaceID}/sandboxes/{sandboxID}/tools:run_shell_command", apiHandler.PostShellCommandHandler).Methods("POST") // Corrected shell path
+	api.HandleFunc("/spaces/{spaceID}/sandboxes/{sandboxID}/tools:run_ipython_cell", apiHandler.PostIPythonCellHandler).Methods("POST")   // Corrected ipython path
+	api.HandleFunc("/spaces/{spaceID}/sandboxes/{sandboxID}/actions/{actionID}/result", apiHandler.GetActionResultHandler).Methods("GET")
+
+	// Image build routes (build output is streamed like sandbox observations)
+	api.HandleFunc("/images", apiHandler.ListImagesHandler).Methods("GET")
+	api.HandleFunc("/images:build", apiHandler.BuildImageHandler).Methods("POST")
+	api.HandleFunc("/images/builds/{buildID}", apiHandler.GetImageBuildHandler).Methods("GET")
+	api.HandleFunc("/images/builds/{buildID}/observations", apiHandler.ListImageBuildObservationsHandler).Methods("GET")
+	api.HandleFunc("/images/builds/{buildID}/stream", apiHandler.StreamImageBuildHandler)
+
+	// Log file routes (logs remain readable after the sandbox is deleted)
+	api.HandleFunc("/spaces/{spaceID}/sandboxes/{sandboxID}/logs", apiHandler.ListSandboxLogsHandler).Methods("GET")
+	api.HandleFunc("/spaces/{spaceID}/sandboxes/{sandboxID}/logs/{file}", apiHandler.GetSandboxLogHandler).Methods("GET")
+
+	// Usage reports for chargeback (tenants see their own spaces only)
+	api.HandleFunc("/usage", apiHandler.GetUsageHandler).Methods("GET")
+
+	// Search across spaces and sandboxes (tenants find their own only)
+	api.HandleFunc("/search", apiHandler.SearchHandler).Methods("GET")
+
+	// Profiles sandboxes can be created with, including host-provided ones
+	api.HandleFunc("/security-profiles", apiHandler.ListSecurityProfilesHandler).Methods("GET")
+
+	// Secret routes (values are write-only)
+	api.HandleFunc("/secrets", apiHandler.CreateSecretHandler).Methods("POST")
+	api.HandleFunc("/secrets", apiHandler.ListSecretsHandler).Methods("GET")
+	api.HandleFunc("/secrets/{name}", apiHandler.GetSecretHandler).Methods("GET")
+	api.HandleFunc("/secrets/{name}", apiHandler.DeleteSecretHandler).Methods("DELETE")
+
+	// Filesystem watch routes (events are delivered as "fs_event" observations on the stream)
+	api.HandleFunc("/spaces/{spaceID}/sandboxes/{sandboxID}/watches", apiHandler.CreateWatchHandler).Methods("POST")
+	api.HandleFunc("/spaces/{spaceID}/sandboxes/{sandboxID}/watches", apiHandler.ListWatchesHandler).Methods("GET")
+	api.HandleFunc("/spaces/{spaceID}/sandboxes/{sandboxID}/watches/{watchID}", apiHandler.DeleteWatchHandler).Methods("DELETE")
+	// Jupyter server of sandboxes created with "jupyter": true, REST API and kernel WebSockets
+	api.HandleFunc("/spaces/{spaceID}/sandboxes/{sandboxID}/jupyter/{path:.*}", apiHandler.JupyterProxyHandler)
+	// TCP port forwarding, one WebSocket per connection
+	api.HandleFunc("/spaces/{spaceID}/sandboxes/{sandboxID}/ports/{port}/forward", apiHandler.PortForwardHandler).Methods("GET")
+	// IPython kernel routes (cells choose one with "kernel_id")
+	api.HandleFunc("/spaces/{spaceID}/sandboxes/{sandboxID}/kernels", apiHandler.CreateKernelHandler).Methods("POST")
+	api.HandleFunc("/spaces/{spaceID}/sandboxes/{sandboxID}/kernels", apiHandler.ListKernelsHandler).Methods("GET")
+	api.HandleFunc("/spaces/{spaceID}/sandboxes/{sandboxID}/kernels/{kernelID}", apiHandler.DeleteKernelHandler).Methods("DELETE")
+
+	// Scheduled action routes (each run is reported like any other action)
+	api.HandleFunc("/spaces/{spaceID}/sandboxes/{sandboxID}/schedules", apiHandler.CreateScheduleHandler).Methods("POST")
+	api.HandleFunc("/spaces/{spaceID}/sandboxes/{sandboxID}/schedules", apiHandler.ListSchedulesHandler).Methods("GET")
+	api.HandleFunc("/spaces/{spaceID}/sandboxes/{sandboxID}/schedules/{scheduleID}", apiHandler.DeleteScheduleHandler).Methods("DELETE")
+
+	// Workflow routes (steps run server-side in order; progress is also pushed on the stream)
+	api.HandleFunc("/spaces/{spaceID}/sandboxes/{sandboxID}/workflows", apiHandler.StartWorkflowHandler).Methods("POST")
+	api.HandleFunc("/spaces/{spaceID}/sandboxes/{sandboxID}/workflows", apiHandler.ListWorkflowsHandler).Methods("GET")
+	api.HandleFunc("/spaces/{spaceID}/sandboxes/{sandboxID}/workflows/{workflowID}", apiHandler.GetWorkflowHandler).Methods("GET")
+
+	// Artifact routes (artifacts remain listable after the sandbox is deleted)
+	api.HandleFunc("/spaces/{spaceID}/sandboxes/{sandboxID}/artifacts", apiHandler.CaptureArtifactHandler).Methods("POST")
+	api.HandleFunc("/spaces/{spaceID}/sandboxes/{sandboxID}/artifacts", apiHandler.ListArtifactsHandler).Methods("GET")
+	api.HandleFunc("/spaces/{spaceID}/sandboxes/{sandboxID}/artifacts/{artifactID}", apiHandler.GetArtifactHandler).Methods("GET")
+	if cfg.ArtifactDownloads != nil {
+		api.Handle("/artifacts/download", cfg.ArtifactDownloads).Methods("GET")
+	}
+
+	// Admin routes, optionally protected by the admin token
+	admin := api.PathPrefix("/admin").Subrouter()
+	admin.Use(handler.RequireAdminToken(cfg.AdminToken))
+	admin.HandleFunc("/gc", apiHandler.GarbageCollectHandler).Methods("POST")
+	admin.HandleFunc("/hub", apiHandler.HubStatsHandler).Methods("GET")
+	if cfg.LogLevels != nil {
+		admin.HandleFunc("/log-levels", handler.LogLevelsHandler(cfg.LogLevels)).Methods("GET")
+		admin.HandleFunc("/log-levels", handler.SetLogLevelsHandler(cfg.LogLevels)).Methods("PUT")
+	}
+	admin.HandleFunc("/prewarm", apiHandler.PrewarmStatusHandler).Methods("GET")
+	admin.HandleFunc("/prewarm", apiHandler.RefreshPrewarmHandler).Methods("POST")
+	admin.HandleFunc("/budgets", apiHandler.ListTenantBudgetsHandler).Methods("GET")
+	admin.HandleFunc("/budgets/{tenant}", apiHandler.SetTenantBudgetHandler).Methods("PUT")
+	admin.HandleFunc("/budgets/{tenant}", apiHandler.DeleteTenantBudgetHandler).Methods("DELETE")
+	admin.HandleFunc("/spaces/{spaceID}/observation-keys", apiHandler.ObservationKeysHandler).Methods("GET")
+	admin.HandleFunc("/spaces/{spaceID}/observation-keys:rotate", apiHandler.RotateObservationKeyHandler).Methods("POST")
+	// Events of every space, only served behind the admin token
+	if cfg.AdminToken != "" {
+		api.Handle("/events", handler.RequireAdminToken(cfg.AdminToken)(http.HandlerFunc(apiHandler.StreamEventsHandler))).Methods("GET")
+	}
+
+	// Internal Observation Route
+	api.HandleFunc("/internal/observations/{sandboxID}", apiHandler.InternalObservationHandler).Methods("POST") // Changed to sandboxID
+	api.HandleFunc("/internal/observations/{sandboxID}/output/{actionID}", apiHandler.InternalOutputHandler).Methods("POST")
+
+	// Sandbox streams are outside the API subrouters but get their middleware and tenant isolation
+	streamMiddleware := func(next http.Handler) http.Handler {
+		if cfg.TenantHeader != "" {
+			next = apiHandler.RequireTenant(cfg.TenantHeader)(next)
+		}
+		for i := len(cfg.APIMiddleware) - 1; i >= 0; i-- {
+			next = cfg.APIMiddleware[i](next)
+		}
+		return next
+	}
+
+	// WebSocket Route (associated with a specific sandbox)
+	router.Handle("/v1/sandboxes/{sandboxID}/stream", streamMiddleware(v1Deprecated(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { // Changed to sandboxID
+		// Assuming ServeWs signature: hub, checker, resumer, w, r, logger
+		// Pass sandboxManager as it implements the SandboxChecker and Resumer interfaces
+		ws.ServeWs(hub, sandboxManager, sandboxManager, w, r, logger, ws.WithFormats(handler.StreamFormats...))
+	}))))
+
+	// Version 2 routes: observations use the typed schema, other routes are served by version 1
+	router.Handle("/v2/sandboxes/{sandboxID}/stream", streamMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ws.ServeWs(hub, sandboxManager, sandboxManager, w, r, logger, ws.WithEncoder(handler.EncodeTypedObservation), ws.WithFormats(handler.StreamFormats...))
+	})))
+	v2 := router.PathPrefix("/v2").Subrouter()
+	v2.Use(cfg.APIMiddleware...)
+	if cfg.TenantHeader != "" {
+		v2.Use(apiHandler.RequireTenant(cfg.TenantHeader))
+	}
+	v2.HandleFunc("/spaces/{spaceID}/sandboxes/{sandboxID}/observations", apiHandler.ListObservationsV2Handler).Methods("GET")
+	if cfg.Routes != nil {
+		cfg.Routes(router, api)
+	}
+	router.PathPrefix("/v2/").Handler(handler.Shim("v2", "v1", api))
+
+	// Embedded web UI for trying the runtime out
+	if cfg.UI {
+		uiHandler := ui.Handler("/ui")
+		router.Handle("/ui", uiHandler)
+		router.PathPrefix("/ui/").Handler(uiHandler)
+	}
+
+	return router
+}
+
+// checkWritableDir verifies that dir exists (creating it if needed) and accepts writes.
+func checkWritableDir(dir string) error {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return err
+	}
+	f, err := os.CreateTemp(dir, ".readyz-*")
+	if err != nil {
+		return fmt.Errorf("data dir not writable: %w", err)
+	}
+	name := f.Name()
+	f.Close()
+	return os.Remove(name)
+}
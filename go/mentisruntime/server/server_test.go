@@ -0,0 +1,163 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/require"
+
+	"github.com/foreveryh/sandboxai/go/mentisruntime/fake"
+	"github.com/foreveryh/sandboxai/go/mentisruntime/manager"
+)
+
+func TestNewServer_mountedWithMiddleware(t *testing.T) {
+	docker := fake.NewDocker(nil)
+	defer docker.Close()
+	dockerClient, err := docker.Client()
+	require.NoError(t, err)
+	srv, err := NewServer(Config{Docker: dockerClient, Scope: "server-test"})
+	require.NoError(t, err)
+
+	// Mounted under a prefix of another binary's mux, behind its own middleware
+	var seen []string
+	mux := http.NewServeMux()
+	mux.Handle("/runtime/", http.StripPrefix("/runtime", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seen = append(seen, r.URL.Path)
+		srv.ServeHTTP(w, r)
+	})))
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest("GET", "/runtime/v1/health", nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.Equal(t, []string{"/v1/health"}, seen)
+
+	rec = httptest.NewRecorder()
+	srv.ServeHTTP(rec, httptest.NewRequest("GET", "/v1/admin/log-levels", nil))
+	require.Equal(t, http.StatusNotFound, rec.Code, "log level routes need levels")
+
+	rec = httptest.NewRecorder()
+	srv.ServeHTTP(rec, httptest.NewRequest("GET", "/v1/events", nil))
+	require.Equal(t, http.StatusNotFound, rec.Code, "the event stream needs an admin token")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	require.NoError(t, srv.Shutdown(ctx))
+	require.NoError(t, srv.Shutdown(ctx), "Shutdown may be called again")
+}
+
+func TestNewServer_needsDocker(t *testing.T) {
+	_, err := NewServer(Config{})
+	require.Error(t, err)
+}
+
+func TestNewServer_unknownDefaultSecurityProfile(t *testing.T) {
+	docker := fake.NewDocker(nil)
+	defer docker.Close()
+	dockerClient, err := docker.Client()
+	require.NoError(t, err)
+	_, err = NewServer(Config{Docker: dockerClient, Scope: "server-test", ManagerOptions: []manager.Option{manager.WithDefaultSecurityProfile("hardend")}})
+	require.ErrorIs(t, err, manager.ErrUnknownSecurityProfile)
+}
+
+func TestNewServer_tenantIsolationNeedsAdminToken(t *testing.T) {
+	docker := fake.NewDocker(nil)
+	defer docker.Close()
+	dockerClient, err := docker.Client()
+	require.NoError(t, err)
+	_, err = NewServer(Config{Docker: dockerClient, Scope: "server-test", TenantHeader: "X-Tenant"})
+	require.Error(t, err)
+}
+
+func TestNewServer_tenantScopedRoutes(t *testing.T) {
+	docker := fake.NewDocker(nil)
+	defer docker.Close()
+	dockerClient, err := docker.Client()
+	require.NoError(t, err)
+	srv, err := NewServer(Config{Docker: dockerClient, Scope: "server-test", AdminToken: "admin", TenantHeader: "X-Tenant"})
+	require.NoError(t, err)
+	defer srv.Shutdown(context.Background())
+
+	spaceID := srv.Spaces.ResolveSpaceID(manager.WithTenant(context.Background(), "acme"), manager.DefaultSpaceID)
+	sandboxID, err := srv.Manager.CreateSandbox(context.Background(), spaceID, manager.SandboxSpec{})
+	require.NoError(t, err)
+
+	do := func(path, tenant string) int {
+		req := httptest.NewRequest("GET", path, nil)
+		if tenant != "" {
+			req.Header.Set("X-Tenant", tenant)
+		}
+		rec := httptest.NewRecorder()
+		srv.ServeHTTP(rec, req)
+		return rec.Code
+	}
+	stream := "/v1/sandboxes/" + sandboxID + "/stream"
+	require.Equal(t, http.StatusUnauthorized, do(stream, ""))
+	require.Equal(t, http.StatusNotFound, do(stream, "globex"))
+	// The owner gets as far as the WebSocket upgrade, which this plain request fails
+	require.Equal(t, http.StatusBadRequest, do(stream, "acme"))
+	require.Equal(t, http.StatusUnauthorized, do("/v1/secrets", ""))
+}
+
+func TestNewServer_customMiddlewareAndRoutes(t *testing.T) {
+	docker := fake.NewDocker(nil)
+	defer docker.Close()
+	dockerClient, err := docker.Client()
+	require.NoError(t, err)
+	srv, err := NewServer(Config{
+		Docker:       dockerClient,
+		Scope:        "server-test",
+		AdminToken:   "admin",
+		TenantHeader: "X-Tenant",
+		Middleware: []mux.MiddlewareFunc{func(next http.Handler) http.Handler {
+			return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("X-Edge", "1")
+				next.ServeHTTP(w, r)
+			})
+		}},
+		// Authenticates requests and names their tenant for tenant isolation
+		APIMiddleware: []mux.MiddlewareFunc{func(next http.Handler) http.Handler {
+			return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.Header.Get("Authorization") != "Bearer company" {
+					http.Error(w, "unauthorized", http.StatusUnauthorized)
+					return
+				}
+				r.Header.Set("X-Tenant", "acme")
+				next.ServeHTTP(w, r)
+			})
+		}},
+		Routes: func(router, api *mux.Router) {
+			router.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {})
+			api.HandleFunc("/whoami", func(w http.ResponseWriter, r *http.Request) {
+				w.Write([]byte(r.Header.Get("X-Tenant")))
+			}).Methods("GET")
+		},
+	})
+	require.NoError(t, err)
+	defer srv.Shutdown(context.Background())
+
+	do := func(path, auth string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", path, nil)
+		if auth != "" {
+			req.Header.Set("Authorization", auth)
+		}
+		rec := httptest.NewRecorder()
+		srv.ServeHTTP(rec, req)
+		return rec
+	}
+
+	rec := do("/healthz", "")
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.Equal(t, "1", rec.Header().Get("X-Edge"))
+	require.Equal(t, http.StatusUnauthorized, do("/v1/spaces", "").Code)
+	require.Equal(t, http.StatusUnauthorized, do("/v2/spaces", "").Code)
+	require.Equal(t, http.StatusOK, do("/v1/spaces", "Bearer company").Code)
+	// Sandbox streams are authenticated and scoped to tenants like the REST routes
+	require.Equal(t, http.StatusUnauthorized, do("/v1/sandboxes/unknown/stream", "").Code)
+	require.Equal(t, http.StatusNotFound, do("/v2/sandboxes/unknown/stream", "Bearer company").Code)
+	rec = do("/v1/whoami", "Bearer company")
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.Equal(t, "acme", rec.Body.String())
+}
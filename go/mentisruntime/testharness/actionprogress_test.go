@@ -0,0 +1,43 @@
+package testharness
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	v1 "github.com/foreveryh/sandboxai/go/api/v1"
+	"github.com/foreveryh/sandboxai/go/mentisruntime/fake"
+	"github.com/foreveryh/sandboxai/go/mentisruntime/handler"
+)
+
+func TestActionProgress(t *testing.T) {
+	h := New(t, WithShell(func(command string) fake.Result {
+		return fake.Result{Stdout: "done\n", Progress: []fake.Progress{
+			{Percent: 10, Message: "numpy"},
+			{Percent: 20, Message: "numpy"}, // Too soon after the first
+			{Percent: 150, Message: "pandas"},
+			{Percent: 50, Message: "pandas"},
+			{Percent: 100, Message: "pandas"},
+		}}
+	}))
+	spaceID := h.CreateSpace("progress")
+	sandboxID := h.CreateSandbox(spaceID, handler.CreateSandboxRequest{})
+	actionID := h.RunShell(spaceID, sandboxID, "pip install numpy pandas")
+	observations := h.Observe(sandboxID).Action(actionID)
+	RequireTypes(t, observations, "start", "progress", "progress", "progress", "stream", "result", "end")
+
+	var progress []v1.Progress
+	for _, obs := range observations[1:4] {
+		var p v1.Progress
+		require.NoError(t, json.Unmarshal(obs.Raw, &p))
+		progress = append(progress, p)
+	}
+	require.Equal(t, 10.0, *progress[0].Percent)
+	require.Equal(t, "numpy", progress[0].Message)
+	require.Nil(t, progress[0].EtaSeconds) // Nothing to estimate from yet
+	require.Equal(t, 50.0, *progress[1].Percent)
+	require.NotNil(t, progress[1].EtaSeconds)
+	require.Equal(t, 100.0, *progress[2].Percent)
+	require.Equal(t, 0.0, *progress[2].EtaSeconds)
+}
@@ -0,0 +1,78 @@
+package testharness
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/foreveryh/sandboxai/go/mentisruntime/fake"
+	"github.com/foreveryh/sandboxai/go/mentisruntime/handler"
+	"github.com/foreveryh/sandboxai/go/mentisruntime/manager"
+)
+
+func TestActionResult(t *testing.T) {
+	h := New(t, WithShell(func(command string) fake.Result {
+		if command == "sleep" {
+			return fake.Result{Delay: time.Minute}
+		}
+		return fake.Result{Stdout: "one\ntwo\n", Stderr: "warning\n", ExitCode: 3}
+	}))
+	spaceID := h.CreateSpace("results")
+	sandboxID := h.CreateSandbox(spaceID, handler.CreateSandboxRequest{})
+	actionID := h.RunShell(spaceID, sandboxID, "build")
+	h.Observe(sandboxID).Action(actionID)
+	path := "/v1/spaces/" + spaceID + "/sandboxes/" + sandboxID + "/actions/" + actionID + "/result"
+
+	get := func(accept string) (*http.Response, []byte) {
+		req, err := http.NewRequest("GET", h.URL+path, nil)
+		require.NoError(t, err)
+		if accept != "" {
+			req.Header.Set("Accept", accept)
+		}
+		resp, err := h.client.Do(req)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		body, err := io.ReadAll(resp.Body)
+		require.NoError(t, err)
+		return resp, body
+	}
+
+	resp, body := get("")
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	require.Equal(t, "3", resp.Header.Get("Exit-Code"))
+	var result manager.ActionResult
+	require.NoError(t, json.Unmarshal(body, &result))
+	require.Equal(t, actionID, result.ActionID)
+	require.Equal(t, 3, result.ExitCode)
+	require.Equal(t, "one\ntwo\n", result.Stdout)
+	require.Equal(t, "warning\n", result.Stderr)
+
+	resp, body = get("text/plain")
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	require.Equal(t, "text/plain; charset=utf-8", resp.Header.Get("Content-Type"))
+	require.Equal(t, "one\ntwo\n", string(body))
+
+	resp, body = get("application/x-ndjson, application/json;q=0.5")
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	var types []string
+	for lines := bufio.NewScanner(bytes.NewReader(body)); lines.Scan(); {
+		var obs Observation
+		require.NoError(t, json.Unmarshal(lines.Bytes(), &obs))
+		types = append(types, obs.ObservationType)
+	}
+	require.Equal(t, []string{"start", "stream", "stream", "stream", "result", "end"}, types)
+
+	resp, _ = get("image/png")
+	require.Equal(t, http.StatusNotAcceptable, resp.StatusCode)
+
+	// Running and unknown actions have no result yet
+	running := h.RunShell(spaceID, sandboxID, "sleep")
+	require.Equal(t, http.StatusConflict, h.Do("GET", "/v1/spaces/"+spaceID+"/sandboxes/"+sandboxID+"/actions/"+running+"/result", nil, nil))
+	require.Equal(t, http.StatusNotFound, h.Do("GET", "/v1/spaces/"+spaceID+"/sandboxes/"+sandboxID+"/actions/unknown/result", nil, nil))
+}
@@ -0,0 +1,44 @@
+package testharness
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/foreveryh/sandboxai/go/mentisruntime/handler"
+)
+
+func TestActionUser(t *testing.T) {
+	h := New(t)
+	spaceID := h.CreateSpace("users")
+	sandboxID := h.CreateSandbox(spaceID, handler.CreateSandboxRequest{})
+	run := func(sandboxID string, payload map[string]interface{}) int {
+		return h.Do("POST", "/v1/spaces/"+spaceID+"/sandboxes/"+sandboxID+"/tools:run_shell_command", payload, nil)
+	}
+
+	// The agent is asked to run the command as the user
+	actionID := h.RunAction(spaceID, sandboxID, "run_shell_command", map[string]interface{}{"command": "id", "user": "nobody"})
+	h.Observe(sandboxID).Action(actionID)
+	var sent map[string]interface{}
+	for _, call := range h.Docker.Agent(sandboxID).Calls() {
+		if call.Path == "/tools:run_shell_command" {
+			require.NoError(t, json.Unmarshal(call.Body, &sent))
+		}
+	}
+	require.Equal(t, "nobody", sent["user"])
+
+	require.Equal(t, http.StatusUnprocessableEntity, run(sandboxID, map[string]interface{}{"command": "id", "user": "no body"}))
+	require.Equal(t, http.StatusUnprocessableEntity, h.Do("POST", "/v1/spaces/"+spaceID+"/sandboxes/"+sandboxID+"/tools:run_ipython_cell", map[string]interface{}{"code": "1", "user": "nobody"}, nil))
+
+	// Hardened sandboxes run as nobody and cannot switch users
+	hardened := h.CreateSandbox(spaceID, handler.CreateSandboxRequest{SecurityProfile: "hardened"})
+	require.Equal(t, http.StatusAccepted, run(hardened, map[string]interface{}{"command": "id", "user": "nobody"}))
+	require.Equal(t, http.StatusBadRequest, run(hardened, map[string]interface{}{"command": "id", "user": "root"}))
+
+	// Nor can sandboxes running as another user than root
+	unprivileged := h.CreateSandbox(spaceID, handler.CreateSandboxRequest{User: "1000"})
+	require.Equal(t, http.StatusAccepted, run(unprivileged, map[string]interface{}{"command": "id", "user": "1000"}))
+	require.Equal(t, http.StatusBadRequest, run(unprivileged, map[string]interface{}{"command": "id", "user": "nobody"}))
+}
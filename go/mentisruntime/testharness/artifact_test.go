@@ -0,0 +1,37 @@
+package testharness
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/foreveryh/sandboxai/go/mentisruntime/artifact"
+	"github.com/foreveryh/sandboxai/go/mentisruntime/handler"
+	"github.com/foreveryh/sandboxai/go/mentisruntime/manager"
+)
+
+func TestArtifactNames(t *testing.T) {
+	store, err := artifact.NewLocalStore(t.TempDir(), "http://artifacts.test", []byte("key"))
+	require.NoError(t, err)
+	h := New(t, WithManagerOptions(manager.WithArtifactStore(store, time.Hour)))
+	spaceID := h.CreateSpace("artifacts")
+	sandboxID := h.CreateSandbox(spaceID, handler.CreateSandboxRequest{})
+	var state manager.SandboxState
+	h.mustDo(http.StatusOK, "GET", "/v1/spaces/"+spaceID+"/sandboxes/"+sandboxID, nil, &state)
+	require.NoError(t, h.Docker.WriteFile(state.ContainerID, "/work/out.txt", []byte("result")))
+	path := "/v1/spaces/" + spaceID + "/sandboxes/" + sandboxID + "/artifacts"
+
+	var captured manager.Artifact
+	h.mustDo(http.StatusCreated, "POST", path, handler.CaptureArtifactRequest{Path: "/work/out.txt", Name: "report.txt"}, &captured)
+	require.Equal(t, spaceID+"/"+sandboxID+"/"+captured.ID+"/report.txt", captured.Key)
+
+	// Names that would move the key under another space's prefix are refused
+	for _, name := range []string{"../../../other-space/sb/id/out", "a/b", `a\b`, ".."} {
+		require.Equal(t, http.StatusUnprocessableEntity, h.Do("POST", path, handler.CaptureArtifactRequest{Path: "/work/out.txt", Name: name}, nil), name)
+		_, err := h.Manager.CaptureArtifact(context.Background(), sandboxID, "/work/out.txt", name)
+		require.ErrorIs(t, err, manager.ErrInvalidArtifactName, name)
+	}
+}
@@ -0,0 +1,57 @@
+package testharness
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/foreveryh/sandboxai/go/mentisruntime/handler"
+	"github.com/foreveryh/sandboxai/go/mentisruntime/manager"
+)
+
+func TestBudget_enforcedOnSpace(t *testing.T) {
+	h := New(t, WithManagerOptions(manager.WithUsageAccounting(20*time.Millisecond)))
+	spaceID := h.CreateSpace("metered")
+	sandboxID := h.CreateSandbox(spaceID, handler.CreateSandboxRequest{})
+	stream := h.ObserveSpace(spaceID)
+	budgetPath := "/v1/spaces/" + spaceID + "/budget"
+	actionPath := "/v1/spaces/" + spaceID + "/sandboxes/" + sandboxID + "/tools:run_shell_command"
+
+	// A budget of about a second of running time
+	var status manager.BudgetStatus
+	h.mustDo(http.StatusOK, "PUT", budgetPath, manager.Budget{MaxRuntimeHours: 1.0 / 3600, WarnAt: []float64{0.5}}, &status)
+	require.False(t, status.Exceeded)
+
+	next := func(eventType string) manager.BudgetEventData {
+		events := stream.Until(eventType)
+		var data manager.BudgetEventData
+		require.NoError(t, json.Unmarshal(events[len(events)-1].Data, &data))
+		return data
+	}
+	warning := next(manager.SpaceEventBudgetWarning)
+	require.Equal(t, spaceID, warning.SpaceID)
+	require.GreaterOrEqual(t, warning.Share, 0.5)
+	require.True(t, next(manager.SpaceEventBudgetExceeded).Exceeded)
+
+	require.Equal(t, http.StatusTooManyRequests, h.Do("POST", actionPath, map[string]interface{}{"command": "true"}, nil))
+	require.Equal(t, http.StatusTooManyRequests, h.Do("POST", "/v1/spaces/"+spaceID+"/sandboxes", handler.CreateSandboxRequest{}, nil))
+	h.mustDo(http.StatusOK, "GET", budgetPath, nil, &status)
+	require.True(t, status.Exceeded)
+
+	// Lifting the budget lets work through again
+	h.mustDo(http.StatusNoContent, "DELETE", budgetPath, nil, nil)
+	require.Equal(t, http.StatusNotFound, h.Do("GET", budgetPath, nil, nil))
+	h.RunShell(spaceID, sandboxID, "true")
+
+	require.Equal(t, http.StatusUnprocessableEntity, h.Do("PUT", budgetPath, manager.Budget{}, nil))
+	require.Equal(t, http.StatusUnprocessableEntity, h.Do("PUT", budgetPath, manager.Budget{MaxCostUnits: 5, WarnAt: []float64{1.5}}, nil))
+}
+
+func TestBudget_needsUsageAccounting(t *testing.T) {
+	h := New(t)
+	spaceID := h.CreateSpace("unmetered")
+	require.Equal(t, http.StatusNotImplemented, h.Do("PUT", "/v1/spaces/"+spaceID+"/budget", manager.Budget{MaxRuntimeHours: 1}, nil))
+}
@@ -0,0 +1,27 @@
+package testharness
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/foreveryh/sandboxai/go/mentisruntime/handler"
+	"github.com/foreveryh/sandboxai/go/mentisruntime/manager"
+	"github.com/foreveryh/sandboxai/go/mentisruntime/secret"
+)
+
+func TestCloneRefusesSecretFiles(t *testing.T) {
+	store, err := secret.NewStore(make([]byte, 32), "")
+	require.NoError(t, err)
+	_, err = store.Put("", "API_TOKEN", "s3cret", "")
+	require.NoError(t, err)
+	h := New(t, WithManagerOptions(manager.WithSecretStore(store)))
+	spaceID := h.CreateSpace("clones")
+	sandboxID := h.CreateSandbox(spaceID, handler.CreateSandboxRequest{
+		Secrets: []manager.SecretRef{{Name: "API_TOKEN", File: "token"}},
+	})
+
+	// Committing the container would copy the secret file into the clone image
+	require.Equal(t, http.StatusConflict, h.Do("POST", "/v1/spaces/"+spaceID+"/sandboxes/"+sandboxID+":clone", nil, nil))
+}
@@ -0,0 +1,57 @@
+package testharness
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/foreveryh/sandboxai/go/mentisruntime/handler"
+	"github.com/foreveryh/sandboxai/go/mentisruntime/manager"
+)
+
+func TestConfinementProfiles(t *testing.T) {
+	h := New(t, WithManagerOptions(
+		manager.WithSeccompProfiles(map[string]string{"no-network": `{"defaultAction":"SCMP_ACT_ALLOW"}`}),
+		manager.WithAppArmorProfiles("sandbox-strict"),
+	))
+	spaceID := h.CreateSpace("confined")
+	docker, err := h.Docker.Client()
+	require.NoError(t, err)
+	securityOpt := func(sandboxID string) []string {
+		var state manager.SandboxState
+		h.mustDo(http.StatusOK, "GET", "/v1/spaces/"+spaceID+"/sandboxes/"+sandboxID, nil, &state)
+		info, err := docker.ContainerInspect(context.Background(), state.ContainerID)
+		require.NoError(t, err)
+		return info.HostConfig.SecurityOpt
+	}
+
+	opts := securityOpt(h.CreateSandbox(spaceID, handler.CreateSandboxRequest{}))
+	require.Empty(t, opts)
+
+	sandboxID := h.CreateSandbox(spaceID, handler.CreateSandboxRequest{SeccompProfile: "deny-dangerous", AppArmorProfile: "sandbox-strict"})
+	opts = securityOpt(sandboxID)
+	require.Len(t, opts, 2)
+	require.True(t, strings.HasPrefix(opts[0], "seccomp={"), opts[0])
+	require.Contains(t, opts[0], `"kexec_load"`)
+	require.Equal(t, "apparmor=sandbox-strict", opts[1])
+	var state manager.SandboxState
+	h.mustDo(http.StatusOK, "GET", "/v1/spaces/"+spaceID+"/sandboxes/"+sandboxID, nil, &state)
+	require.Equal(t, "deny-dangerous", state.SeccompProfile)
+	require.Equal(t, "sandbox-strict", state.AppArmorProfile)
+
+	opts = securityOpt(h.CreateSandbox(spaceID, handler.CreateSandboxRequest{SeccompProfile: "no-network"}))
+	require.Equal(t, []string{`seccomp={"defaultAction":"SCMP_ACT_ALLOW"}`}, opts)
+
+	var profiles handler.SecurityProfilesResponse
+	h.mustDo(http.StatusOK, "GET", "/v1/security-profiles", nil, &profiles)
+	require.Equal(t, []string{"deny-dangerous", "docker-default", "no-network"}, profiles.SeccompProfiles)
+	require.Equal(t, []string{"docker-default", "sandbox-strict"}, profiles.AppArmorProfiles)
+
+	path := "/v1/spaces/" + spaceID + "/sandboxes"
+	require.Equal(t, http.StatusBadRequest, h.Do("POST", path, handler.CreateSandboxRequest{SeccompProfile: "missing"}, nil))
+	require.Equal(t, http.StatusBadRequest, h.Do("POST", path, handler.CreateSandboxRequest{AppArmorProfile: "unconfined"}, nil))
+	require.Equal(t, http.StatusUnprocessableEntity, h.Do("POST", path, handler.CreateSandboxRequest{SeccompProfile: "../etc/passwd"}, nil))
+}
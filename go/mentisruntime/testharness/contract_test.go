@@ -0,0 +1,153 @@
+package testharness
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/foreveryh/sandboxai/go/mentisruntime/fake"
+	"github.com/foreveryh/sandboxai/go/mentisruntime/handler"
+	"github.com/foreveryh/sandboxai/go/mentisruntime/manager"
+)
+
+// Contract tests of the runtime and the agent protocol, with fake.Agent standing in for the
+// agent in python/mentis_executor.
+
+func newContractSandbox(t *testing.T, opts ...Option) (*Harness, string, string, *Stream) {
+	h := New(t, opts...)
+	spaceID := h.CreateSpace("contract")
+	sandboxID := h.CreateSandbox(spaceID, handler.CreateSandboxRequest{})
+	return h, spaceID, sandboxID, h.Observe(sandboxID)
+}
+
+func TestContract_actionRequests(t *testing.T) {
+	h, spaceID, sandboxID, stream := newContractSandbox(t)
+	agent := h.Docker.Agent(sandboxID)
+	require.NotNil(t, agent)
+
+	shellID := h.RunAction(spaceID, sandboxID, "run_shell_command", map[string]interface{}{
+		"command":  "echo hi",
+		"cwd":      "/work/src",
+		"env":      map[string]interface{}{"GREETING": "hi"},
+		"priority": 1,                                       // Runtime only
+		"coalesce": map[string]interface{}{"window_ms": 0},  // Runtime only
+		"metadata": map[string]interface{}{"step_id": "s1"}, // Runtime only
+	})
+	stream.Action(shellID)
+	cellID := h.RunIPython(spaceID, sandboxID, "print(1)")
+	stream.Action(cellID)
+
+	var actions []fake.Call
+	for _, call := range agent.Calls() {
+		if call.Method == http.MethodPost {
+			actions = append(actions, call)
+		}
+	}
+	require.Len(t, actions, 2)
+	require.Equal(t, "/tools:run_shell_command", actions[0].Path)
+	require.JSONEq(t, fmt.Sprintf(`{"action_id":%q,"command":"echo hi","cwd":"/work/src","env":{"GREETING":"hi"}}`, shellID), string(actions[0].Body))
+	require.Equal(t, "/tools:run_ipython_cell", actions[1].Path)
+	require.JSONEq(t, fmt.Sprintf(`{"action_id":%q,"code":"print(1)"}`, cellID), string(actions[1].Body))
+}
+
+func TestContract_shellSelection(t *testing.T) {
+	h, spaceID, sandboxID, stream := newContractSandbox(t)
+	agent := h.Docker.Agent(sandboxID)
+	path := fmt.Sprintf("/v1/spaces/%s/sandboxes/%s/tools:run_shell_command", spaceID, sandboxID)
+
+	actionID := h.RunAction(spaceID, sandboxID, "run_shell_command", map[string]interface{}{"command": "echo hi", "shell": "bash", "login": true})
+	RequireTypes(t, stream.Action(actionID), "start", "stream", "result", "end")
+	posts := func() (calls []fake.Call) {
+		for _, call := range agent.Calls() {
+			if call.Method == http.MethodPost {
+				calls = append(calls, call)
+			}
+		}
+		return calls
+	}
+	calls := posts()
+	require.JSONEq(t, fmt.Sprintf(`{"action_id":%q,"command":"echo hi","shell":"bash","login":true}`, actionID), string(calls[len(calls)-1].Body))
+
+	// Shells the agent does not report are refused before anything is sent to it
+	require.Equal(t, http.StatusBadRequest, h.Do("POST", path, map[string]interface{}{"command": "ls", "shell": "zsh"}, nil))
+	require.Equal(t, http.StatusUnprocessableEntity, h.Do("POST", path, map[string]interface{}{"command": "ls", "shell": "fish"}, nil))
+	require.Equal(t, http.StatusUnprocessableEntity, h.Do("POST", fmt.Sprintf("/v1/spaces/%s/sandboxes/%s/tools:run_ipython_cell", spaceID, sandboxID), map[string]interface{}{"code": "1", "login": true}, nil))
+	require.Len(t, posts(), len(calls))
+}
+
+func TestContract_actionOverridesValidated(t *testing.T) {
+	h, spaceID, sandboxID, _ := newContractSandbox(t)
+	path := fmt.Sprintf("/v1/spaces/%s/sandboxes/%s/tools:run_shell_command", spaceID, sandboxID)
+	for _, payload := range []map[string]interface{}{
+		{"command": "ls", "cwd": "work"},
+		{"command": "ls", "cwd": 1},
+		{"command": "ls", "env": map[string]interface{}{"1BAD": "x"}},
+		{"command": "ls", "env": map[string]interface{}{"N": 1}},
+		{"command": "ls", "env": []string{"A=B"}},
+	} {
+		require.Equal(t, http.StatusUnprocessableEntity, h.Do("POST", path, payload, nil), payload)
+	}
+}
+
+func TestContract_outputObservations(t *testing.T) {
+	h, spaceID, sandboxID, stream := newContractSandbox(t, WithShell(func(command string) fake.Result {
+		return fake.Result{Stdout: "text\n\xff\xfe\n", Stderr: "oops\n", ExitCode: 2}
+	}))
+
+	obs := stream.Action(h.RunShell(spaceID, sandboxID, "run"))
+	RequireTypes(t, obs, "start", "stream", "stream", "stream", "result", "end")
+	require.Equal(t, []string{"text", "//4="}, Lines(obs, "stdout"))
+	var binary struct {
+		Encoding string `json:"encoding"`
+		Final    bool   `json:"final"`
+	}
+	require.NoError(t, json.Unmarshal(obs[2].Raw, &binary))
+	require.Equal(t, "base64", binary.Encoding)
+	require.True(t, binary.Final)
+	require.Equal(t, 2, *obs[4].ExitCode)
+	require.Equal(t, 2, obs[5].EndExitCode())
+
+	// Large output is uploaded raw and relayed as binary frames
+	obs = stream.Action(h.RunAction(spaceID, sandboxID, "run_shell_command", map[string]interface{}{"command": "run", "large_output": true}))
+	RequireTypes(t, obs, "start", "output", "output", "result", "end")
+	require.Equal(t, []string{"text\n\xff\xfe\n"}, Lines(obs, "stdout"))
+	require.Equal(t, []string{"oops\n"}, Lines(obs, "stderr"))
+}
+
+func TestContract_watchesAndShutdown(t *testing.T) {
+	h, spaceID, sandboxID, stream := newContractSandbox(t, WithManagerOptions(manager.WithShutdownTimeout(time.Second)))
+	agent := h.Docker.Agent(sandboxID)
+
+	var watch struct {
+		ID string `json:"watch_id"`
+	}
+	require.Equal(t, http.StatusCreated, h.Do("POST", fmt.Sprintf("/v1/spaces/%s/sandboxes/%s/watches", spaceID, sandboxID), map[string]string{"path": "/work"}, &watch))
+	require.True(t, agent.Event(watch.ID, "/work/a.txt", "create", false))
+	event := stream.Until("fs_event")
+	var data struct {
+		WatchID string `json:"watch_id"`
+		Path    string `json:"path"`
+		Event   string `json:"event"`
+	}
+	require.NoError(t, json.Unmarshal(event[len(event)-1].Data, &data))
+	require.Equal(t, watch.ID, data.WatchID)
+	require.Equal(t, "/work/a.txt", data.Path)
+	require.Equal(t, "create", data.Event)
+
+	// Missing paths are not found, unknown events are invalid
+	watchesPath := fmt.Sprintf("/v1/spaces/%s/sandboxes/%s/watches", spaceID, sandboxID)
+	require.Equal(t, http.StatusNotFound, h.Do("POST", watchesPath, map[string]string{"path": fake.MissingPath + "/out"}, nil))
+	for _, events := range [][]string{{"rename"}, {"create", ""}} {
+		require.Equal(t, http.StatusUnprocessableEntity, h.Do("POST", watchesPath, map[string]interface{}{"path": "/work", "events": events}, nil), events)
+	}
+
+	// The agent is asked to shut down before its container is removed
+	h.DeleteSandbox(spaceID, sandboxID)
+	calls := agent.Calls()
+	require.Equal(t, "/shutdown", calls[len(calls)-1].Path)
+	require.False(t, agent.Event(watch.ID, "/work/a.txt", "delete", false))
+}
@@ -0,0 +1,37 @@
+package testharness
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/docker/docker/api/types/container"
+	"github.com/stretchr/testify/require"
+
+	"github.com/foreveryh/sandboxai/go/mentisruntime/handler"
+	"github.com/foreveryh/sandboxai/go/mentisruntime/manager"
+)
+
+func TestDeleteSandbox_retrySafe(t *testing.T) {
+	h := New(t)
+	spaceID := h.CreateSpace("retries")
+	sandboxID := h.CreateSandbox(spaceID, handler.CreateSandboxRequest{})
+	path := "/v1/spaces/" + spaceID + "/sandboxes/" + sandboxID
+
+	// A container removed behind the runtime's back still deletes cleanly
+	var state manager.SandboxState
+	h.mustDo(http.StatusOK, "GET", path, nil, &state)
+	docker, err := h.Docker.Client()
+	require.NoError(t, err)
+	require.NoError(t, docker.ContainerRemove(context.Background(), state.ContainerID, container.RemoveOptions{Force: true}))
+	require.Equal(t, http.StatusNoContent, h.Do("DELETE", path, nil, nil))
+
+	// Retries fail unless asked not to
+	require.Equal(t, http.StatusNotFound, h.Do("DELETE", path, nil, nil))
+	require.Equal(t, http.StatusNoContent, h.Do("DELETE", path+"?ignore_not_found=true", nil, nil))
+	require.Equal(t, http.StatusBadRequest, h.Do("DELETE", path+"?ignore_not_found=maybe", nil, nil))
+
+	// Sandboxes of other spaces are still not found
+	other := h.CreateSandbox(h.CreateSpace("other"), handler.CreateSandboxRequest{})
+	require.Equal(t, http.StatusNotFound, h.Do("DELETE", "/v1/spaces/"+spaceID+"/sandboxes/"+other+"?ignore_not_found=true", nil, nil))
+}
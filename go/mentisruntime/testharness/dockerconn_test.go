@@ -0,0 +1,44 @@
+package testharness
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/foreveryh/sandboxai/go/mentisruntime/handler"
+	"github.com/foreveryh/sandboxai/go/mentisruntime/manager"
+)
+
+func TestDockerReconnect_survivesDaemonRestart(t *testing.T) {
+	h := New(t, WithManagerOptions(manager.WithDockerReconnect(manager.DockerReconnect{
+		Interval:     10 * time.Millisecond,
+		QueueTimeout: 5 * time.Second,
+	})))
+	spaceID := h.CreateSpace("restarted")
+	sandboxID := h.CreateSandbox(spaceID, handler.CreateSandboxRequest{})
+	stream := h.Observe(sandboxID)
+
+	h.Docker.StopDaemon()
+	require.Eventually(t, func() bool {
+		return h.Manager.PingDocker(context.Background()) != nil
+	}, 5*time.Second, 10*time.Millisecond)
+	time.AfterFunc(200*time.Millisecond, h.Docker.StartDaemon)
+
+	// Held back until the daemon is back, instead of failing
+	h.CreateSandbox(spaceID, handler.CreateSandboxRequest{})
+	require.NoError(t, h.Manager.PingDocker(context.Background()))
+
+	// The restart stopped the container of the first sandbox, which the manager notices
+	for {
+		states := stream.Until("sandbox_state")
+		var change manager.SandboxStateObservationData
+		require.NoError(t, json.Unmarshal(states[len(states)-1].Data, &change))
+		if change.State == manager.PhaseStopped {
+			require.Equal(t, "container_not_running", change.Reason)
+			break
+		}
+	}
+}
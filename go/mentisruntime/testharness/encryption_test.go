@@ -0,0 +1,74 @@
+package testharness
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/foreveryh/sandboxai/go/mentisruntime/handler"
+	"github.com/foreveryh/sandboxai/go/mentisruntime/history"
+	"github.com/foreveryh/sandboxai/go/mentisruntime/manager"
+	"github.com/foreveryh/sandboxai/go/mentisruntime/secret"
+)
+
+func TestObservationEncryption_sealsHistoryPerSpace(t *testing.T) {
+	dir := t.TempDir()
+	store, err := history.NewStore(filepath.Join(dir, "observations"), 0)
+	require.NoError(t, err)
+	t.Cleanup(func() { store.Close() })
+	keyring, err := secret.NewKeyring(bytes.Repeat([]byte{7}, 32), filepath.Join(dir, "observation-keys.json"))
+	require.NoError(t, err)
+	h := New(t, WithManagerOptions(manager.WithObservationHistory(store), manager.WithObservationEncryption(keyring)))
+
+	spaceID := h.CreateSpace("encrypted")
+	sandboxID := h.CreateSandbox(spaceID, handler.CreateSandboxRequest{})
+	stream := h.Observe(sandboxID)
+	stream.Action(h.RunShell(spaceID, sandboxID, "echo confidential"))
+	historyFile := filepath.Join(dir, "observations", sandboxID+".jsonl")
+	raw, err := os.ReadFile(historyFile)
+	require.NoError(t, err)
+	require.NotContains(t, string(raw), "confidential")
+	require.Contains(t, string(raw), `"key_id":"`+spaceID+`/1"`)
+
+	ctx := context.Background()
+	rotation, err := h.Manager.RotateObservationKey(ctx, spaceID, true)
+	require.NoError(t, err)
+	require.Equal(t, spaceID+"/2", rotation.Key.ID)
+	require.Contains(t, rotation.Resealed, sandboxID)
+	require.Empty(t, rotation.Failed)
+	raw, err = os.ReadFile(historyFile)
+	require.NoError(t, err)
+	require.NotContains(t, string(raw), `"key_id":"`+spaceID+`/1"`)
+
+	// The history reads back in clear text after a restart
+	stream.Action(h.RunShell(spaceID, sandboxID, "echo again"))
+	reopened, err := history.NewStore(filepath.Join(dir, "observations"), 0)
+	require.NoError(t, err)
+	defer reopened.Close()
+	reopened.SetCipher(keyring)
+	page, err := reopened.Query(sandboxID, history.Query{Limit: history.MaxLimit})
+	require.NoError(t, err)
+	var found bool
+	for _, rec := range page.Observations {
+		found = found || bytes.Contains(rec.Observation, []byte("confidential"))
+	}
+	require.True(t, found)
+	keys, err := h.Manager.ObservationKeys(ctx, spaceID)
+	require.NoError(t, err)
+	require.Len(t, keys, 2)
+	require.True(t, keys[1].Current)
+
+	_, err = h.Manager.RotateObservationKey(ctx, "no-such-space", false)
+	require.ErrorIs(t, err, manager.ErrSpaceNotFound)
+}
+
+func TestObservationEncryption_disabled(t *testing.T) {
+	h := New(t)
+	spaceID := h.CreateSpace("plain")
+	_, err := h.Manager.RotateObservationKey(context.Background(), spaceID, false)
+	require.ErrorIs(t, err, manager.ErrObservationEncryptionDisabled)
+}
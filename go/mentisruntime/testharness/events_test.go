@@ -0,0 +1,46 @@
+package testharness
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/foreveryh/sandboxai/go/mentisruntime/handler"
+	"github.com/foreveryh/sandboxai/go/mentisruntime/manager"
+)
+
+func TestEventStream_acrossSpaces(t *testing.T) {
+	h := New(t)
+	first, second := h.CreateSpace("first"), h.CreateSpace("second")
+	created := h.ObserveEvents(manager.SpaceEventSandboxCreated)
+	all := h.ObserveEvents()
+
+	a := h.CreateSandbox(first, handler.CreateSandboxRequest{})
+	h.RunShell(first, a, "echo hi")
+	b := h.CreateSandbox(second, handler.CreateSandboxRequest{})
+
+	// Only the requested type arrives, with its space
+	for _, want := range []struct{ space, sandbox string }{{first, a}, {second, b}} {
+		obs := created.Next()
+		require.Equal(t, manager.SpaceEventSandboxCreated, obs.ObservationType)
+		var event struct {
+			SpaceID string                        `json:"space_id"`
+			Data    manager.SpaceSandboxEventData `json:"data"`
+		}
+		require.NoError(t, json.Unmarshal(obs.Raw, &event))
+		require.Equal(t, want.space, event.SpaceID)
+		require.Equal(t, want.sandbox, event.Data.SandboxID)
+	}
+
+	types := Types(all.Until(manager.SpaceEventActionDone))
+	require.Contains(t, types, manager.SpaceEventSandboxState)
+	require.Contains(t, types, manager.SpaceEventSandboxCreated)
+
+	require.Equal(t, http.StatusBadRequest, h.Do("GET", "/v1/events?types=a,,b", nil, nil))
+	resp, err := h.client.Get(h.URL + "/v1/events")
+	require.NoError(t, err)
+	resp.Body.Close()
+	require.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+}
@@ -0,0 +1,191 @@
+// Package testharness runs the runtime in-process for integration tests: the server of
+// package server, composed as sandboxaid composes it, on a local HTTP server, backed by the
+// fake Docker engine of package fake, whose containers run stand-in agents. Tests drive it
+// through the public API like any client and assert on the observations streamed back,
+// without a Docker host.
+package testharness
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/foreveryh/sandboxai/go/mentisruntime/fake"
+	"github.com/foreveryh/sandboxai/go/mentisruntime/handler"
+	"github.com/foreveryh/sandboxai/go/mentisruntime/history"
+	"github.com/foreveryh/sandboxai/go/mentisruntime/manager"
+	"github.com/foreveryh/sandboxai/go/mentisruntime/server"
+)
+
+// AdminToken is the admin token of harness runtimes, which requests and streams send.
+const AdminToken = "testharness-admin-token"
+
+// Harness is a runtime under test. Its API is served at URL.
+type Harness struct {
+	URL     string
+	Manager *manager.SandboxManager
+	Docker  *fake.Docker
+
+	t      testing.TB
+	client *http.Client
+}
+
+type config struct {
+	shell       fake.Shell
+	logger      *slog.Logger
+	managerOpts []manager.Option
+}
+
+// Option configures a Harness.
+type Option func(*config)
+
+// WithShell sets how the fake agents run commands and IPython cells (fake.Echo by default).
+func WithShell(shell fake.Shell) Option {
+	return func(c *config) {
+		c.shell = shell
+	}
+}
+
+// WithLogger sets the logger of the runtime, which is silent by default.
+func WithLogger(logger *slog.Logger) Option {
+	return func(c *config) {
+		c.logger = logger
+	}
+}
+
+// WithManagerOptions passes options to the sandbox manager, after the observation history
+// the harness always enables.
+func WithManagerOptions(opts ...manager.Option) Option {
+	return func(c *config) {
+		c.managerOpts = append(c.managerOpts, opts...)
+	}
+}
+
+// New starts a runtime and stops it when the test ends.
+func New(t testing.TB, opts ...Option) *Harness {
+	t.Helper()
+	cfg := config{logger: slog.New(slog.NewTextHandler(io.Discard, nil))}
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+
+	docker := fake.NewDocker(cfg.shell)
+	t.Cleanup(docker.Close)
+	dockerClient, err := docker.Client()
+	if err != nil {
+		t.Fatalf("testharness: create Docker client: %v", err)
+	}
+
+	// Streams resume from the history, so observations sent before a client subscribes are
+	// not lost.
+	store, err := history.NewStore("", 0)
+	if err != nil {
+		t.Fatalf("testharness: create observation history: %v", err)
+	}
+	managerOpts := append([]manager.Option{manager.WithObservationHistory(store)}, cfg.managerOpts...)
+	srv, err := server.NewServer(server.Config{Docker: dockerClient, Logger: cfg.logger, Scope: "testharness", AdminToken: AdminToken, ManagerOptions: managerOpts})
+	if err != nil {
+		t.Fatalf("testharness: create server: %v", err)
+	}
+
+	httpServer := httptest.NewServer(srv)
+	docker.SetRuntimeURL(httpServer.URL)
+	t.Cleanup(func() {
+		httpServer.Close()
+		srv.Shutdown(context.Background())
+	})
+
+	return &Harness{URL: httpServer.URL, Manager: srv.Manager, Docker: docker, t: t, client: httpServer.Client()}
+}
+
+// Do sends a JSON request to the API and decodes the response into out, if non-nil. It
+// returns the response status; transport and decoding errors fail the test.
+func (h *Harness) Do(method, path string, body, out interface{}) int {
+	h.t.Helper()
+	var reader io.Reader
+	if body != nil {
+		payload, err := json.Marshal(body)
+		if err != nil {
+			h.t.Fatalf("testharness: marshal %s %s: %v", method, path, err)
+		}
+		reader = bytes.NewReader(payload)
+	}
+	req, err := http.NewRequest(method, h.URL+path, reader)
+	if err != nil {
+		h.t.Fatalf("testharness: %s %s: %v", method, path, err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+AdminToken)
+	resp, err := h.client.Do(req)
+	if err != nil {
+		h.t.Fatalf("testharness: %s %s: %v", method, path, err)
+	}
+	defer resp.Body.Close()
+	if out != nil && resp.StatusCode < 300 {
+		if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+			h.t.Fatalf("testharness: decode %s %s: %v", method, path, err)
+		}
+	}
+	return resp.StatusCode
+}
+
+// mustDo is Do failing the test unless the response has status want.
+func (h *Harness) mustDo(want int, method, path string, body, out interface{}) {
+	h.t.Helper()
+	if status := h.Do(method, path, body, out); status != want {
+		h.t.Fatalf("testharness: %s %s: status %d, want %d", method, path, status, want)
+	}
+}
+
+// CreateSpace creates a space and returns its ID.
+func (h *Harness) CreateSpace(name string) string {
+	h.t.Helper()
+	var resp struct {
+		SpaceID string `json:"space_id"`
+	}
+	h.mustDo(http.StatusCreated, "POST", "/v1/spaces", map[string]string{"name": name}, &resp)
+	return resp.SpaceID
+}
+
+// CreateSandbox creates a sandbox in a space and returns its ID.
+func (h *Harness) CreateSandbox(spaceID string, req handler.CreateSandboxRequest) string {
+	h.t.Helper()
+	var state manager.SandboxState
+	h.mustDo(http.StatusCreated, "POST", fmt.Sprintf("/v1/spaces/%s/sandboxes", spaceID), req, &state)
+	return state.ID
+}
+
+// DeleteSandbox deletes a sandbox.
+func (h *Harness) DeleteSandbox(spaceID, sandboxID string) {
+	h.t.Helper()
+	h.mustDo(http.StatusNoContent, "DELETE", fmt.Sprintf("/v1/spaces/%s/sandboxes/%s", spaceID, sandboxID), nil, nil)
+}
+
+// RunShell starts a shell command and returns its action ID.
+func (h *Harness) RunShell(spaceID, sandboxID, command string) string {
+	h.t.Helper()
+	return h.RunAction(spaceID, sandboxID, "run_shell_command", map[string]interface{}{"command": command})
+}
+
+// RunIPython starts an IPython cell and returns its action ID.
+func (h *Harness) RunIPython(spaceID, sandboxID, code string) string {
+	h.t.Helper()
+	return h.RunAction(spaceID, sandboxID, "run_ipython_cell", map[string]interface{}{"code": code})
+}
+
+// RunAction starts an action of a tool ("run_shell_command" or "run_ipython_cell") with a
+// full request payload, and returns its action ID.
+func (h *Harness) RunAction(spaceID, sandboxID, tool string, payload map[string]interface{}) string {
+	h.t.Helper()
+	var resp struct {
+		ActionID string `json:"action_id"`
+	}
+	h.mustDo(http.StatusAccepted, "POST", fmt.Sprintf("/v1/spaces/%s/sandboxes/%s/tools:%s", spaceID, sandboxID, tool), payload, &resp)
+	return resp.ActionID
+}
@@ -0,0 +1,39 @@
+package testharness
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/foreveryh/sandboxai/go/mentisruntime/fake"
+	"github.com/foreveryh/sandboxai/go/mentisruntime/handler"
+)
+
+func TestHarness_runsActions(t *testing.T) {
+	h := New(t, WithShell(func(command string) fake.Result {
+		if command == "make" {
+			return fake.Result{Stdout: "building\ndone\n", Stderr: "warning\n"}
+		}
+		return fake.Echo(command)
+	}))
+	spaceID := h.CreateSpace("test")
+	sandboxID := h.CreateSandbox(spaceID, handler.CreateSandboxRequest{})
+	require.Len(t, h.Docker.Containers(), 1)
+	stream := h.Observe(sandboxID)
+
+	obs := stream.Action(h.RunShell(spaceID, sandboxID, "make"))
+	RequireTypes(t, obs, "start", "stream", "stream", "stream", "result", "end")
+	require.Equal(t, []string{"building", "done"}, Lines(obs, "stdout"))
+	require.Equal(t, []string{"warning"}, Lines(obs, "stderr"))
+	require.Equal(t, 0, obs[len(obs)-1].EndExitCode())
+
+	obs = stream.Action(h.RunShell(spaceID, sandboxID, "exit 3"))
+	RequireTypes(t, obs, "start", "result", "end")
+	require.Equal(t, 3, obs[len(obs)-1].EndExitCode())
+
+	obs = stream.Action(h.RunIPython(spaceID, sandboxID, "echo hi"))
+	require.Equal(t, []string{"hi\n"}, Lines(obs, "stdout"))
+
+	h.DeleteSandbox(spaceID, sandboxID)
+	require.Empty(t, h.Docker.Containers())
+}
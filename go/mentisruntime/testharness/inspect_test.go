@@ -0,0 +1,50 @@
+package testharness
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/foreveryh/sandboxai/go/mentisruntime/fake"
+	"github.com/foreveryh/sandboxai/go/mentisruntime/handler"
+	"github.com/foreveryh/sandboxai/go/mentisruntime/manager"
+	"github.com/foreveryh/sandboxai/go/mentisruntime/secret"
+)
+
+func TestInspect_envAndInfo(t *testing.T) {
+	store, err := secret.NewStore(make([]byte, 32), "")
+	require.NoError(t, err)
+	_, err = store.Put("", "API_TOKEN", "s3cret", "")
+	require.NoError(t, err)
+	h := New(t, WithManagerOptions(manager.WithSecretStore(store)))
+	spaceID := h.CreateSpace("inspect")
+	sandboxID := h.CreateSandbox(spaceID, handler.CreateSandboxRequest{
+		Env:       map[string]string{"MODE": "debug"},
+		Secrets:   []manager.SecretRef{{Name: "API_TOKEN"}, {Name: "API_TOKEN", Env: "TOKEN_COPY"}},
+		Tmpfs:     map[string]string{"/scratch": "size=16m"},
+		DiskLimit: "1G",
+	})
+	base := fmt.Sprintf("/v1/spaces/%s/sandboxes/%s", spaceID, sandboxID)
+
+	var env manager.SandboxEnv
+	require.Equal(t, http.StatusOK, h.Do("GET", base+"/env", nil, &env))
+	require.Equal(t, "debug", env.Env["MODE"])
+	require.Equal(t, sandboxID, env.Env["SANDBOX_ID"])
+	require.Equal(t, manager.RedactedValue, env.Env["API_TOKEN"])
+	require.Equal(t, manager.RedactedValue, env.Env["TOKEN_COPY"])
+	require.Equal(t, []string{"API_TOKEN", "TOKEN_COPY"}, env.Redacted)
+
+	var info manager.SandboxInfo
+	require.Equal(t, http.StatusOK, h.Do("GET", base+"/info", nil, &info))
+	require.Equal(t, sandboxID, info.SandboxID)
+	require.Equal(t, "sha256:fake", info.ImageID)
+	require.Equal(t, "running", info.Status)
+	require.Equal(t, fake.AgentVersion, info.AgentVersion)
+	require.Equal(t, fake.DefaultShells, info.AgentShells)
+	require.Equal(t, "1G", info.Limits.DiskLimit)
+	require.Contains(t, info.Mounts, manager.MountInfo{Type: "tmpfs", Destination: "/scratch"})
+
+	require.Equal(t, http.StatusNotFound, h.Do("GET", fmt.Sprintf("/v1/spaces/%s/sandboxes/missing/info", spaceID), nil, nil))
+}
@@ -0,0 +1,39 @@
+package testharness
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/foreveryh/sandboxai/go/mentisruntime/handler"
+)
+
+func TestJupyter_proxiedWithToken(t *testing.T) {
+	h := New(t)
+	spaceID := h.CreateSpace("jupyter")
+	sandboxID := h.CreateSandbox(spaceID, handler.CreateSandboxRequest{Jupyter: true})
+	base := fmt.Sprintf("/v1/spaces/%s/sandboxes/%s/jupyter/", spaceID, sandboxID)
+
+	var version struct {
+		Version string `json:"version"`
+	}
+	require.Equal(t, http.StatusOK, h.Do("GET", base+"api", nil, &version))
+	require.Equal(t, "fake", version.Version)
+	require.Equal(t, http.StatusNotFound, h.Do("GET", base+"api/missing", nil, nil))
+
+	// The token reaches the server through the proxy only
+	agent := h.Docker.Agent(sandboxID)
+	require.NotEmpty(t, agent.JupyterToken)
+	var info map[string]interface{}
+	require.Equal(t, http.StatusOK, h.Do("GET", fmt.Sprintf("/v1/spaces/%s/sandboxes/%s", spaceID, sandboxID), nil, &info))
+	require.Equal(t, true, info["jupyter"])
+	require.NotContains(t, fmt.Sprint(info), agent.JupyterToken)
+
+	plain := h.CreateSandbox(spaceID, handler.CreateSandboxRequest{})
+	require.Equal(t, http.StatusNotFound, h.Do("GET", fmt.Sprintf("/v1/spaces/%s/sandboxes/%s/jupyter/api", spaceID, plain), nil, nil))
+
+	h.DeleteSandbox(spaceID, sandboxID)
+	require.Equal(t, http.StatusNotFound, h.Do("GET", base+"api", nil, nil))
+}
@@ -0,0 +1,47 @@
+package testharness
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/foreveryh/sandboxai/go/mentisruntime/handler"
+	"github.com/foreveryh/sandboxai/go/mentisruntime/manager"
+)
+
+func TestKernels_createRunAndDelete(t *testing.T) {
+	h := New(t)
+	spaceID := h.CreateSpace("kernels")
+	sandboxID := h.CreateSandbox(spaceID, handler.CreateSandboxRequest{})
+	stream := h.Observe(sandboxID)
+	path := fmt.Sprintf("/v1/spaces/%s/sandboxes/%s/kernels", spaceID, sandboxID)
+	cellPath := fmt.Sprintf("/v1/spaces/%s/sandboxes/%s/tools:run_ipython_cell", spaceID, sandboxID)
+
+	var kernel manager.Kernel
+	require.Equal(t, http.StatusCreated, h.Do("POST", path, map[string]string{"kernel_id": "analysis"}, &kernel))
+	require.Equal(t, "analysis", kernel.ID)
+	require.Equal(t, http.StatusConflict, h.Do("POST", path, map[string]string{"kernel_id": "analysis"}, nil))
+	require.Equal(t, http.StatusConflict, h.Do("POST", path, map[string]string{"kernel_id": "default"}, nil))
+	require.Equal(t, http.StatusUnprocessableEntity, h.Do("POST", path, map[string]string{"kernel_id": "a/b"}, nil))
+
+	stream.Action(h.RunAction(spaceID, sandboxID, "run_ipython_cell", map[string]interface{}{"code": "x = 1", "kernel_id": "analysis"}))
+	stream.Action(h.RunIPython(spaceID, sandboxID, "print(1)"))
+	require.Equal(t, http.StatusNotFound, h.Do("POST", cellPath, map[string]interface{}{"code": "x", "kernel_id": "missing"}, nil))
+
+	var kernels []manager.Kernel
+	require.Equal(t, http.StatusOK, h.Do("GET", path, nil, &kernels))
+	require.Len(t, kernels, 2)
+	require.Equal(t, manager.DefaultKernel, kernels[0].ID)
+	require.Equal(t, 1, kernels[0].Executions)
+	require.Equal(t, "analysis", kernels[1].ID)
+	require.Equal(t, 1, kernels[1].Executions)
+	require.NotNil(t, kernels[1].LastUsedAt)
+	require.Empty(t, kernels[1].RunningActionID)
+
+	require.Equal(t, http.StatusBadRequest, h.Do("DELETE", path+"/default", nil, nil))
+	require.Equal(t, http.StatusNoContent, h.Do("DELETE", path+"/analysis", nil, nil))
+	require.Equal(t, http.StatusNotFound, h.Do("DELETE", path+"/analysis", nil, nil))
+	require.Equal(t, http.StatusNotFound, h.Do("POST", cellPath, map[string]interface{}{"code": "x", "kernel_id": "analysis"}, nil))
+}
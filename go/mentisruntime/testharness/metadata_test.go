@@ -0,0 +1,52 @@
+package testharness
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/foreveryh/sandboxai/go/mentisruntime/handler"
+	"github.com/foreveryh/sandboxai/go/mentisruntime/history"
+)
+
+func TestMetadata_carriedByObservations(t *testing.T) {
+	h := New(t)
+	spaceID := h.CreateSpace("metadata")
+	sandboxID := h.CreateSandbox(spaceID, handler.CreateSandboxRequest{})
+	stream := h.Observe(sandboxID)
+
+	metadata := `{"conversation_id":"c1","step_id":7}`
+	actionID := h.RunAction(spaceID, sandboxID, "run_shell_command", map[string]interface{}{
+		"command":  "echo hi",
+		"metadata": map[string]interface{}{"conversation_id": "c1", "step_id": 7},
+	})
+	obs := stream.Action(actionID)
+	RequireTypes(t, obs, "start", "stream", "result", "end")
+	for _, o := range obs {
+		require.JSONEq(t, metadata, string(o.Metadata), o.ObservationType)
+	}
+
+	var page history.Page
+	require.Equal(t, http.StatusOK, h.Do("GET", fmt.Sprintf("/v1/spaces/%s/sandboxes/%s/observations?action_id=%s", spaceID, sandboxID, actionID), nil, &page))
+	require.Len(t, page.Observations, len(obs))
+	for _, record := range page.Observations {
+		var o Observation
+		require.NoError(t, json.Unmarshal(record.Observation, &o))
+		require.JSONEq(t, metadata, string(o.Metadata), o.ObservationType)
+	}
+
+	var typed handler.TypedObservationPage
+	require.Equal(t, http.StatusOK, h.Do("GET", fmt.Sprintf("/v2/spaces/%s/sandboxes/%s/observations?action_id=%s", spaceID, sandboxID, actionID), nil, &typed))
+	require.JSONEq(t, metadata, string(typed.Observations[0].Metadata))
+
+	// Actions without metadata are unaffected.
+	obs = stream.Action(h.RunShell(spaceID, sandboxID, "echo bye"))
+	for _, o := range obs {
+		require.Empty(t, o.Metadata)
+	}
+	require.Equal(t, http.StatusUnprocessableEntity, h.Do("POST", fmt.Sprintf("/v1/spaces/%s/sandboxes/%s/tools:run_shell_command", spaceID, sandboxID),
+		map[string]interface{}{"command": "ls", "metadata": "step-7"}, nil))
+}
@@ -0,0 +1,34 @@
+package testharness
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/foreveryh/sandboxai/go/mentisruntime/fake"
+	"github.com/foreveryh/sandboxai/go/mentisruntime/handler"
+	"github.com/foreveryh/sandboxai/go/mentisruntime/manager"
+)
+
+func TestPlatform_multiArchImages(t *testing.T) {
+	h := New(t, WithManagerOptions(manager.WithPlatform(manager.Platform{Arch: "arm64"})))
+	spaceID := h.CreateSpace("graviton")
+	get := func(sandboxID string) manager.SandboxState {
+		var state manager.SandboxState
+		h.mustDo(http.StatusOK, "GET", "/v1/spaces/"+spaceID+"/sandboxes/"+sandboxID, nil, &state)
+		return state
+	}
+
+	// The local image is for another architecture, so the host's variant is pulled
+	native := h.CreateSandbox(spaceID, handler.CreateSandboxRequest{Image: "python:3.12"})
+	require.Equal(t, "linux/arm64", get(native).Platform)
+	require.Equal(t, []string{"docker.io/library/python:3.12"}, h.Docker.Pulls())
+
+	// An explicit platform overrides the host's; the local image already matches it
+	emulated := h.CreateSandbox(spaceID, handler.CreateSandboxRequest{Image: "node:22", Platform: fake.DefaultPlatform})
+	require.Equal(t, fake.DefaultPlatform, get(emulated).Platform)
+	require.Len(t, h.Docker.Pulls(), 1)
+
+	require.Equal(t, http.StatusUnprocessableEntity, h.Do("POST", "/v1/spaces/"+spaceID+"/sandboxes", handler.CreateSandboxRequest{Platform: "arm64"}, nil))
+}
@@ -0,0 +1,47 @@
+package testharness
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/foreveryh/sandboxai/go/mentisruntime/handler"
+	"github.com/foreveryh/sandboxai/go/mentisruntime/manager"
+)
+
+func TestSandboxNames(t *testing.T) {
+	h := New(t)
+	spaceID := h.CreateSpace("named")
+	sandboxID := h.CreateSandbox(spaceID, handler.CreateSandboxRequest{Name: "web"})
+
+	// Routes take the name in place of the ID
+	var state manager.SandboxState
+	h.mustDo(http.StatusOK, "GET", "/v1/spaces/"+spaceID+"/sandboxes/web", nil, &state)
+	require.Equal(t, sandboxID, state.ID)
+	require.Equal(t, "web", state.Name)
+	actionID := h.RunShell(spaceID, "web", "echo hi")
+	h.Observe(sandboxID).Action(actionID)
+
+	docker, err := h.Docker.Client()
+	require.NoError(t, err)
+	info, err := docker.ContainerInspect(context.Background(), state.ContainerID)
+	require.NoError(t, err)
+	require.True(t, strings.HasSuffix(info.Name, "-web-"+sandboxID), info.Name)
+	require.Equal(t, "web", info.Config.Labels["sandboxai.name"])
+
+	// Names are unique per space and must be valid container name parts
+	require.Equal(t, http.StatusConflict, h.Do("POST", "/v1/spaces/"+spaceID+"/sandboxes", handler.CreateSandboxRequest{Name: "web"}, nil))
+	require.Equal(t, http.StatusConflict, h.Do("POST", "/v1/spaces/"+spaceID+"/sandboxes", handler.CreateSandboxRequest{Name: sandboxID}, nil))
+	require.Equal(t, http.StatusUnprocessableEntity, h.Do("POST", "/v1/spaces/"+spaceID+"/sandboxes", handler.CreateSandboxRequest{Name: "my web"}, nil))
+	otherSpace := h.CreateSpace("other")
+	h.CreateSandbox(otherSpace, handler.CreateSandboxRequest{Name: "web"})
+	require.Equal(t, http.StatusNotFound, h.Do("GET", "/v1/spaces/"+otherSpace+"/sandboxes/"+sandboxID, nil, nil))
+
+	h.DeleteSandbox(spaceID, "web")
+	require.Equal(t, http.StatusNotFound, h.Do("GET", "/v1/spaces/"+spaceID+"/sandboxes/web", nil, nil))
+	// The name is free again
+	h.CreateSandbox(spaceID, handler.CreateSandboxRequest{Name: "web"})
+}
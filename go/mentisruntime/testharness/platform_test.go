@@ -0,0 +1,30 @@
+package testharness
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/foreveryh/sandboxai/go/mentisruntime/handler"
+	"github.com/foreveryh/sandboxai/go/mentisruntime/manager"
+)
+
+func TestPlatform_windowsContainers(t *testing.T) {
+	h := New(t, WithManagerOptions(manager.WithPlatform(manager.Platform{OS: manager.PlatformWindows, RuntimeHost: "172.20.0.1"})))
+	spaceID := h.CreateSpace("windows")
+
+	// Linux-only settings are refused
+	require.Equal(t, http.StatusBadRequest, h.Do("POST", "/v1/spaces/"+spaceID+"/sandboxes",
+		handler.CreateSandboxRequest{Tmpfs: map[string]string{"/tmp": "size=64m"}}, nil))
+
+	sandboxID := h.CreateSandbox(spaceID, handler.CreateSandboxRequest{Workdir: `C:\work`})
+	var state manager.SandboxState
+	h.mustDo(http.StatusOK, "GET", "/v1/spaces/"+spaceID+"/sandboxes/"+sandboxID, nil, &state)
+	require.Equal(t, "mentisai/sandboxai-box:windows", state.Image)
+
+	stream := h.Observe(sandboxID)
+	h.RunShell(spaceID, sandboxID, "Get-ChildItem")
+	end := stream.Until("end")
+	require.Equal(t, 0, end[len(end)-1].EndExitCode())
+}
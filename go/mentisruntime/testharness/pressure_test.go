@@ -0,0 +1,45 @@
+package testharness
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/foreveryh/sandboxai/go/mentisruntime/handler"
+	"github.com/foreveryh/sandboxai/go/mentisruntime/manager"
+)
+
+func TestHostPressure_throttlesActions(t *testing.T) {
+	var loaded atomic.Bool
+	loaded.Store(true)
+	h := New(t, WithManagerOptions(manager.WithHostPressureLimits(manager.PressureLimits{
+		Interval:      10 * time.Millisecond,
+		MaxLoadPerCPU: 1,
+		MaxDelay:      time.Minute,
+		Read: func() (manager.HostLoad, error) {
+			load := manager.HostLoad{Load1: 0.5, CPUs: 1}
+			if loaded.Load() {
+				load.Load1 = 4
+			}
+			return load, nil
+		},
+	})))
+	spaceID := h.CreateSpace("pressured")
+	sandboxID := h.CreateSandbox(spaceID, handler.CreateSandboxRequest{})
+	stream := h.Observe(sandboxID)
+
+	// Accepted, but held back until the load drops
+	actionID := h.RunShell(spaceID, sandboxID, "echo hi")
+	throttled := stream.Until("throttled")
+	require.Equal(t, actionID, throttled[len(throttled)-1].ActionID)
+	for _, o := range throttled {
+		require.NotEqual(t, "end", o.ObservationType)
+	}
+
+	loaded.Store(false)
+	end := stream.Until("end")
+	require.Equal(t, actionID, end[len(end)-1].ActionID)
+	require.Equal(t, 0, end[len(end)-1].EndExitCode())
+}
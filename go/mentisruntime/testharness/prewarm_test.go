@@ -0,0 +1,57 @@
+package testharness
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/foreveryh/sandboxai/go/mentisruntime/manager"
+)
+
+func TestImagePrewarm(t *testing.T) {
+	h := New(t, WithManagerOptions(manager.WithImagePrewarm([]string{"python:3.12", "node:22"}, time.Hour)))
+	ready := func(n int) func() bool {
+		return func() bool {
+			status, err := h.Manager.GetPrewarmStatus()
+			if err != nil {
+				return false
+			}
+			count := 0
+			for _, img := range status.Images {
+				if img.State == manager.PrewarmReady {
+					count++
+				}
+			}
+			return count == n && len(status.Images) == n
+		}
+	}
+	require.Eventually(t, ready(2), 5*time.Second, 10*time.Millisecond)
+	require.Equal(t, []string{"docker.io/library/python:3.12", "docker.io/library/node:22"}, h.Docker.Pulls())
+	status, err := h.Manager.GetPrewarmStatus()
+	require.NoError(t, err)
+	require.Equal(t, "1h0m0s", status.Interval)
+	require.NotNil(t, status.NextRunAt)
+	require.NotEmpty(t, status.Images[0].ImageID)
+	require.NotNil(t, status.Images[0].LastPulledAt)
+
+	// A refresh pulls again even though the images are present
+	require.NoError(t, h.Manager.RefreshPrewarm())
+	require.Eventually(t, func() bool { return len(h.Docker.Pulls()) == 4 }, 5*time.Second, 10*time.Millisecond)
+
+	// A reloaded list drops removed images and pulls the new ones
+	require.NoError(t, h.Manager.SetPrewarmImages([]string{"node:22", "golang:1.24"}))
+	require.Eventually(t, ready(2), 5*time.Second, 10*time.Millisecond)
+	require.Eventually(t, func() bool { return len(h.Docker.Pulls()) == 6 }, 5*time.Second, 10*time.Millisecond)
+	status, err = h.Manager.GetPrewarmStatus()
+	require.NoError(t, err)
+	require.Equal(t, "node:22", status.Images[0].Image)
+	require.Equal(t, "golang:1.24", status.Images[1].Image)
+}
+
+func TestImagePrewarmDisabled(t *testing.T) {
+	h := New(t)
+	_, err := h.Manager.GetPrewarmStatus()
+	require.ErrorIs(t, err, manager.ErrPrewarmDisabled)
+	require.ErrorIs(t, h.Manager.RefreshPrewarm(), manager.ErrPrewarmDisabled)
+}
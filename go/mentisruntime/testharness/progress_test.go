@@ -0,0 +1,60 @@
+package testharness
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/foreveryh/sandboxai/go/mentisruntime/handler"
+	"github.com/foreveryh/sandboxai/go/mentisruntime/manager"
+)
+
+func TestCreationProgress(t *testing.T) {
+	h := New(t)
+	spaceID := h.CreateSpace("progress")
+	path := "/v1/spaces/" + spaceID + "/sandboxes"
+
+	var started manager.CreationProgress
+	h.mustDo(http.StatusAccepted, "POST", path+"?wait=false", handler.CreateSandboxRequest{SetupCommands: []string{"true"}}, &started)
+	require.NotEmpty(t, started.SandboxID)
+	require.Equal(t, spaceID, started.SpaceID)
+
+	// The stream accepts subscribers while the sandbox is being created
+	stream := h.Observe(started.SandboxID)
+	var steps []string
+	for len(steps) == 0 || steps[len(steps)-1] != manager.CreationReady {
+		obs := stream.Next()
+		if obs.ObservationType != "creation_progress" {
+			continue
+		}
+		var progress manager.CreationProgress
+		require.NoError(t, json.Unmarshal(obs.Data, &progress))
+		steps = append(steps, progress.Step)
+	}
+	require.Equal(t, []string{
+		manager.CreationCreatingContainer,
+		manager.CreationStartingContainer,
+		manager.CreationWaitingForAgent,
+		manager.CreationRunningSetup,
+		manager.CreationReady,
+	}, steps)
+
+	var progress manager.CreationProgress
+	h.mustDo(http.StatusOK, "GET", path+"/"+started.SandboxID+"/progress", nil, &progress)
+	require.Equal(t, manager.CreationReady, progress.Step)
+	h.mustDo(http.StatusOK, "GET", path+"/"+started.SandboxID, nil, nil)
+
+	// A failed creation leaves its error behind, but no sandbox
+	h.mustDo(http.StatusAccepted, "POST", path+"?wait=false", handler.CreateSandboxRequest{Network: "missing"}, &started)
+	require.Eventually(t, func() bool {
+		status := h.Do("GET", path+"/"+started.SandboxID+"/progress", nil, &progress)
+		return status == http.StatusOK && progress.Step == manager.CreationFailed
+	}, 5*time.Second, 10*time.Millisecond)
+	require.NotEmpty(t, progress.Error)
+	require.Equal(t, http.StatusNotFound, h.Do("GET", path+"/"+started.SandboxID, nil, nil))
+	require.Equal(t, http.StatusNotFound, h.Do("GET", path+"/unknown/progress", nil, nil))
+	require.Equal(t, http.StatusBadRequest, h.Do("POST", path+"?wait=soon", handler.CreateSandboxRequest{}, nil))
+}
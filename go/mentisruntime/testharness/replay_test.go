@@ -0,0 +1,66 @@
+package testharness
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/foreveryh/sandboxai/go/mentisruntime/fake"
+	"github.com/foreveryh/sandboxai/go/mentisruntime/handler"
+	"github.com/foreveryh/sandboxai/go/mentisruntime/manager"
+)
+
+func TestReplay_rerunsRecordedActions(t *testing.T) {
+	var runs atomic.Int32
+	var commands []string
+	h := New(t, WithShell(func(command string) fake.Result {
+		commands = append(commands, command)
+		if command == "date" { // Differs on every run
+			return fake.Result{Stdout: fmt.Sprintf("run %d\n", runs.Add(1))}
+		}
+		return fake.Echo(command)
+	}))
+	spaceID := h.CreateSpace("replay")
+	sandboxID := h.CreateSandbox(spaceID, handler.CreateSandboxRequest{SetupCommands: []string{"echo setup"}})
+	stream := h.Observe(sandboxID)
+	stream.Action(h.RunShell(spaceID, sandboxID, "echo one"))
+	stream.Action(h.RunShell(spaceID, sandboxID, "date"))
+	stream.Action(h.RunShell(spaceID, sandboxID, "exit 3"))
+	path := fmt.Sprintf("/v1/spaces/%s/sandboxes/%s", spaceID, sandboxID)
+
+	var recording manager.Recording
+	h.mustDo(http.StatusOK, "GET", path+"/recording", nil, &recording)
+	require.Len(t, recording.Actions, 3) // Setup commands are not recorded
+	require.Equal(t, map[string]interface{}{"command": "echo one"}, recording.Actions[0].Payload)
+	require.Equal(t, 3, *recording.Actions[2].ExitCode)
+	require.True(t, strings.HasPrefix(recording.Actions[0].Digest, "sha256:"))
+
+	var replay manager.Replay
+	h.mustDo(http.StatusAccepted, "POST", path+":replay", nil, &replay)
+	require.Equal(t, sandboxID, replay.SourceSandboxID)
+	require.NotEqual(t, sandboxID, replay.SandboxID)
+	replayPath := fmt.Sprintf("/v1/spaces/%s/sandboxes/%s", spaceID, replay.SandboxID)
+	require.Eventually(t, func() bool {
+		h.mustDo(http.StatusOK, "GET", replayPath+"/replay", nil, &replay)
+		return replay.Status != manager.ReplayRunning
+	}, DefaultTimeout, 10*time.Millisecond)
+
+	require.Equal(t, manager.ReplayDiverged, replay.Status)
+	require.Equal(t, 1, *replay.DivergedAt)
+	require.Len(t, replay.Steps, 3)
+	require.True(t, *replay.Steps[0].Match)
+	require.Equal(t, replay.Steps[0].Digest, replay.Steps[0].ReplayDigest)
+	require.False(t, *replay.Steps[1].Match)
+	require.True(t, *replay.Steps[2].Match)
+	require.Equal(t, 3, *replay.Steps[2].ReplayExitCode)
+	require.Equal(t, []string{"echo setup", "echo one", "date", "exit 3", "echo setup", "echo one", "date", "exit 3"}, commands)
+
+	require.Equal(t, http.StatusNotFound, h.Do("GET", path+"/replay", nil, nil))
+	empty := h.CreateSandbox(spaceID, handler.CreateSandboxRequest{})
+	require.Equal(t, http.StatusBadRequest, h.Do("POST", fmt.Sprintf("/v1/spaces/%s/sandboxes/%s:replay", spaceID, empty), nil, nil))
+}
@@ -0,0 +1,68 @@
+package testharness
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/foreveryh/sandboxai/go/mentisruntime/fake"
+	"github.com/foreveryh/sandboxai/go/mentisruntime/handler"
+	"github.com/foreveryh/sandboxai/go/mentisruntime/manager"
+)
+
+func TestResultCache_replaysSuccessfulResults(t *testing.T) {
+	h := New(t, WithManagerOptions(manager.WithResultCache(1<<20)), WithShell(func(command string) fake.Result {
+		if command == "false" {
+			return fake.Result{ExitCode: 1}
+		}
+		return fake.Result{Stdout: "out\n", Stderr: "err\n"}
+	}))
+	spaceID := h.CreateSpace("cache")
+	sandboxID := h.CreateSandbox(spaceID, handler.CreateSandboxRequest{})
+	stream := h.Observe(sandboxID)
+	agent := h.Docker.Agent(sandboxID)
+	posts := func() (n int) {
+		for _, call := range agent.Calls() {
+			if call.Method == http.MethodPost {
+				n++
+			}
+		}
+		return n
+	}
+	run := func(payload map[string]interface{}) ([]Observation, manager.EndObservationData) {
+		obs := stream.Action(h.RunAction(spaceID, sandboxID, "run_shell_command", payload))
+		var end manager.EndObservationData
+		require.NoError(t, json.Unmarshal(obs[len(obs)-1].Data, &end))
+		return obs, end
+	}
+
+	obs, end := run(map[string]interface{}{"command": "make", "cache": true})
+	RequireTypes(t, obs, "start", "stream", "stream", "result", "end")
+	require.False(t, end.CacheHit)
+	require.Equal(t, 1, posts())
+
+	obs, end = run(map[string]interface{}{"command": "make", "cache": true, "aggregate": "separate", "metadata": map[string]interface{}{"step": "2"}})
+	RequireTypes(t, obs, "start", "stream", "stream", "end")
+	require.True(t, end.CacheHit)
+	require.Equal(t, "out\n", *end.Stdout)
+	require.Equal(t, "err\n", *end.Stderr)
+	require.JSONEq(t, `{"step":"2"}`, string(obs[1].Metadata))
+	require.Equal(t, 1, posts())
+
+	// Other commands, uncached requests and failed results are not answered from the cache
+	_, end = run(map[string]interface{}{"command": "make all", "cache": true})
+	require.False(t, end.CacheHit)
+	_, end = run(map[string]interface{}{"command": "make"})
+	require.False(t, end.CacheHit)
+	run(map[string]interface{}{"command": "false", "cache": true})
+	_, end = run(map[string]interface{}{"command": "false", "cache": true})
+	require.False(t, end.CacheHit)
+	require.Equal(t, 1, end.ExitCode)
+	require.Equal(t, 5, posts())
+
+	path := fmt.Sprintf("/v1/spaces/%s/sandboxes/%s/tools:run_shell_command", spaceID, sandboxID)
+	require.Equal(t, http.StatusUnprocessableEntity, h.Do("POST", path, map[string]interface{}{"command": "make", "cache": true, "large_output": true}, nil))
+}
@@ -0,0 +1,30 @@
+package testharness
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/foreveryh/sandboxai/go/mentisruntime/handler"
+	"github.com/foreveryh/sandboxai/go/mentisruntime/manager"
+)
+
+func TestSearch(t *testing.T) {
+	h := New(t)
+	spaceID := h.CreateSpace("fleet")
+	sandboxID := h.CreateSandbox(spaceID, handler.CreateSandboxRequest{Name: "worker-1", Labels: map[string]string{"pool": "gpu"}})
+
+	var resp handler.SearchResponse
+	h.mustDo(http.StatusOK, "GET", "/v1/search?q=worker&type=sandbox", nil, &resp)
+	require.Equal(t, "worker", resp.Query)
+	require.Equal(t, []manager.SearchResult{
+		{Type: manager.SearchResultSandbox, SpaceID: spaceID, SandboxID: sandboxID, Name: "worker-1", Field: "name", Value: "worker-1", Rank: 8},
+	}, resp.Results)
+	h.mustDo(http.StatusOK, "GET", "/v1/search?q=nothing-matches", nil, &resp)
+	require.Empty(t, resp.Results)
+
+	require.Equal(t, http.StatusUnprocessableEntity, h.Do("GET", "/v1/search", nil, nil))
+	require.Equal(t, http.StatusUnprocessableEntity, h.Do("GET", "/v1/search?q=gpu&type=image", nil, nil))
+	require.Equal(t, http.StatusUnprocessableEntity, h.Do("GET", "/v1/search?q=gpu&limit=0", nil, nil))
+}
@@ -0,0 +1,33 @@
+package testharness
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/foreveryh/sandboxai/go/mentisruntime/handler"
+	"github.com/foreveryh/sandboxai/go/mentisruntime/manager"
+	"github.com/foreveryh/sandboxai/go/mentisruntime/secret"
+)
+
+func TestSecretFilesOwnedBySandboxUser(t *testing.T) {
+	store, err := secret.NewStore(make([]byte, 32), "")
+	require.NoError(t, err)
+	_, err = store.Put("", "API_TOKEN", "s3cret", "")
+	require.NoError(t, err)
+	h := New(t, WithManagerOptions(manager.WithSecretStore(store)))
+	spaceID := h.CreateSpace("secrets")
+	sandboxID := h.CreateSandbox(spaceID, handler.CreateSandboxRequest{
+		User:    "1000",
+		Secrets: []manager.SecretRef{{Name: "API_TOKEN", File: "token"}},
+	})
+
+	var state manager.SandboxState
+	h.mustDo(http.StatusOK, "GET", "/v1/spaces/"+spaceID+"/sandboxes/"+sandboxID, nil, &state)
+	data, ok := h.Docker.ReadFile(state.ContainerID, "/run/secrets/token")
+	require.True(t, ok)
+	require.Equal(t, "s3cret", string(data))
+	owner, _ := h.Docker.FileOwner(state.ContainerID, "/run/secrets/token")
+	require.Equal(t, "1000", owner)
+}
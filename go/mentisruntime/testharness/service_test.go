@@ -0,0 +1,77 @@
+package testharness
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	v1 "github.com/foreveryh/sandboxai/go/api/v1"
+	"github.com/foreveryh/sandboxai/go/mentisruntime/manager"
+)
+
+func TestSandboxService_inProcess(t *testing.T) {
+	h := New(t)
+	var service manager.SandboxService = h.Manager
+	ctx := context.Background()
+
+	spaceID, err := service.CreateSpace(ctx, "embedded", "", nil)
+	require.NoError(t, err)
+	sandboxID, err := service.CreateSandbox(ctx, spaceID, manager.SandboxSpec{})
+	require.NoError(t, err)
+	observations, err := service.StreamObservations(ctx, sandboxID)
+	require.NoError(t, err)
+	actionID, err := service.InitiateAction(ctx, sandboxID, "shell", map[string]interface{}{"command": "echo hi"})
+	require.NoError(t, err)
+
+	var output string
+	var end *v1.EndObservation
+	timeout := time.After(5 * time.Second)
+	for end == nil {
+		select {
+		case message := <-observations:
+			obs, err := v1.DecodeObservation(message)
+			require.NoError(t, err)
+			if obs.ActionID != actionID {
+				continue
+			}
+			switch data := obs.Data.(type) {
+			case v1.StreamObservation:
+				output += data.Line
+			case v1.EndObservation:
+				end = &data
+			}
+		case <-timeout:
+			t.Fatalf("no end observation, got output %q", output)
+		}
+	}
+	require.Equal(t, "hi", output)
+	require.Equal(t, 0, end.ExitCode)
+
+	// Deleting the sandbox closes the stream
+	require.NoError(t, service.DeleteSandbox(ctx, sandboxID, false))
+	for range observations {
+	}
+	_, err = service.StreamObservations(ctx, sandboxID)
+	require.ErrorIs(t, err, manager.ErrSandboxNotFound)
+}
+
+func TestSandboxService_streamEndsWithContext(t *testing.T) {
+	h := New(t)
+	spaceID := h.CreateSpace("embedded")
+	sandboxID, err := h.Manager.CreateSandbox(context.Background(), spaceID, manager.SandboxSpec{})
+	require.NoError(t, err)
+	ctx, cancel := context.WithCancel(context.Background())
+	observations, err := h.Manager.StreamObservations(ctx, sandboxID)
+	require.NoError(t, err)
+	cancel()
+	require.Eventually(t, func() bool {
+		select {
+		case _, ok := <-observations:
+			return !ok
+		default:
+			return false
+		}
+	}, 5*time.Second, 10*time.Millisecond)
+}
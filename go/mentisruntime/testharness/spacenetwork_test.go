@@ -0,0 +1,79 @@
+package testharness
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/foreveryh/sandboxai/go/mentisruntime/handler"
+	"github.com/foreveryh/sandboxai/go/mentisruntime/manager"
+)
+
+func TestSpaceNetworks(t *testing.T) {
+	h := New(t, WithManagerOptions(manager.WithSpaceNetworks()))
+	spaceID := h.CreateSpace("agents")
+	server := h.CreateSandbox(spaceID, handler.CreateSandboxRequest{})
+	client := h.CreateSandbox(spaceID, handler.CreateSandboxRequest{})
+
+	networks := h.Docker.Networks()
+	require.Len(t, networks, 1)
+	require.True(t, strings.HasSuffix(networks[0], "-space-"+spaceID))
+	for _, sandboxID := range []string{server, client} {
+		var state manager.SandboxState
+		h.mustDo(http.StatusOK, "GET", "/v1/spaces/"+spaceID+"/sandboxes/"+sandboxID, nil, &state)
+		require.Equal(t, sandboxID, state.Hostname)
+		aliases, attached := h.Docker.NetworkAliases(state.ContainerID, networks[0])
+		require.True(t, attached)
+		require.Equal(t, []string{sandboxID}, aliases)
+	}
+
+	// Sandboxes of isolated spaces join no network
+	var created struct {
+		SpaceID string `json:"space_id"`
+	}
+	h.mustDo(http.StatusCreated, "POST", "/v1/spaces", map[string]interface{}{"name": "isolated", "isolated": true}, &created)
+	isolated := h.CreateSandbox(created.SpaceID, handler.CreateSandboxRequest{})
+	var state manager.SandboxState
+	h.mustDo(http.StatusOK, "GET", "/v1/spaces/"+created.SpaceID+"/sandboxes/"+isolated, nil, &state)
+	require.Empty(t, state.Hostname)
+	require.Len(t, h.Docker.Networks(), 1)
+
+	// The network goes with its space
+	h.mustDo(http.StatusNoContent, "DELETE", "/v1/spaces/"+spaceID, nil, nil)
+	require.Empty(t, h.Docker.Networks())
+}
+
+func TestSpaceEndpoints(t *testing.T) {
+	h := New(t, WithManagerOptions(manager.WithSpaceNetworks()))
+	spaceID := h.CreateSpace("agents")
+	endpointsPath := "/v1/spaces/" + spaceID + "/endpoints"
+	var endpoints manager.SpaceEndpoints
+	h.mustDo(http.StatusOK, "GET", endpointsPath, nil, &endpoints)
+	require.Empty(t, endpoints.Endpoints)
+
+	server := h.CreateSandbox(spaceID, handler.CreateSandboxRequest{Hostname: "server"})
+	client := h.CreateSandbox(spaceID, handler.CreateSandboxRequest{})
+	h.mustDo(http.StatusOK, "GET", endpointsPath, nil, &endpoints)
+	require.Len(t, endpoints.Endpoints, 2)
+	byID := map[string]manager.SpaceEndpoint{}
+	for _, ep := range endpoints.Endpoints {
+		require.NotEmpty(t, ep.IPAddress)
+		byID[ep.SandboxID] = ep
+	}
+	require.Equal(t, "server", byID[server].Hostname)
+	require.Equal(t, []string{"server", server}, byID[server].Aliases)
+	require.Equal(t, client, byID[client].Hostname)
+
+	// Hostnames are unique in a space and need a space network
+	path := "/v1/spaces/" + spaceID + "/sandboxes"
+	require.Equal(t, http.StatusConflict, h.Do("POST", path, handler.CreateSandboxRequest{Hostname: "server"}, nil))
+	require.Equal(t, http.StatusUnprocessableEntity, h.Do("POST", path, handler.CreateSandboxRequest{Hostname: "web.local"}, nil))
+	var created struct {
+		SpaceID string `json:"space_id"`
+	}
+	h.mustDo(http.StatusCreated, "POST", "/v1/spaces", map[string]interface{}{"name": "isolated", "isolated": true}, &created)
+	require.Equal(t, http.StatusConflict, h.Do("POST", "/v1/spaces/"+created.SpaceID+"/sandboxes", handler.CreateSandboxRequest{Hostname: "server"}, nil))
+	require.Equal(t, http.StatusConflict, h.Do("GET", "/v1/spaces/"+created.SpaceID+"/endpoints", nil, nil))
+}
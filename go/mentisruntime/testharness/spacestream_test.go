@@ -0,0 +1,41 @@
+package testharness
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/foreveryh/sandboxai/go/mentisruntime/handler"
+	"github.com/foreveryh/sandboxai/go/mentisruntime/manager"
+)
+
+func TestSpaceStream(t *testing.T) {
+	h := New(t)
+	spaceID := h.CreateSpace("orchestrated")
+	stream := h.ObserveSpace(spaceID)
+	next := func(eventType string, data interface{}) {
+		events := stream.Until(eventType)
+		require.NoError(t, json.Unmarshal(events[len(events)-1].Data, data))
+	}
+
+	sandboxID := h.CreateSandbox(spaceID, handler.CreateSandboxRequest{})
+	var created manager.SpaceSandboxEventData
+	next(manager.SpaceEventSandboxCreated, &created)
+	require.Equal(t, sandboxID, created.SandboxID)
+
+	actionID := h.RunShell(spaceID, sandboxID, "echo hi")
+	var done manager.ActionCompletedData
+	next(manager.SpaceEventActionDone, &done)
+	require.Equal(t, sandboxID, done.SandboxID)
+	require.Equal(t, actionID, done.ActionID)
+	require.Equal(t, 0, done.ExitCode)
+
+	h.DeleteSandbox(spaceID, sandboxID)
+	var deleted manager.SpaceSandboxEventData
+	next(manager.SpaceEventSandboxDeleted, &deleted)
+	require.Equal(t, sandboxID, deleted.SandboxID)
+
+	require.Equal(t, http.StatusNotFound, h.Do("GET", "/v1/spaces/missing/stream", nil, nil))
+}
@@ -0,0 +1,52 @@
+package testharness
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/docker/docker/api/types/mount"
+	"github.com/docker/docker/api/types/volume"
+	"github.com/stretchr/testify/require"
+
+	"github.com/foreveryh/sandboxai/go/mentisruntime/handler"
+	"github.com/foreveryh/sandboxai/go/mentisruntime/manager"
+)
+
+func TestSpaceVolumes(t *testing.T) {
+	h := New(t)
+	docker, err := h.Docker.Client()
+	require.NoError(t, err)
+	_, err = docker.VolumeCreate(context.Background(), volume.CreateOptions{Name: "datasets"})
+	require.NoError(t, err)
+
+	var created struct {
+		SpaceID string `json:"space_id"`
+	}
+	volumes := []manager.SpaceVolume{{Volume: "datasets", Path: "/data"}}
+	h.mustDo(http.StatusCreated, "POST", "/v1/spaces", map[string]interface{}{"name": "research", "volumes": volumes}, &created)
+	sandboxID := h.CreateSandbox(created.SpaceID, handler.CreateSandboxRequest{})
+
+	var state manager.SandboxState
+	h.mustDo(http.StatusOK, "GET", "/v1/spaces/"+created.SpaceID+"/sandboxes/"+sandboxID, nil, &state)
+	require.Equal(t, volumes, state.SpaceVolumes)
+	inspect, err := docker.ContainerInspect(context.Background(), state.ContainerID)
+	require.NoError(t, err)
+	require.Len(t, inspect.Mounts, 1)
+	require.Equal(t, mount.TypeVolume, inspect.Mounts[0].Type)
+	require.Equal(t, "datasets", inspect.Mounts[0].Name)
+	require.Equal(t, "/data", inspect.Mounts[0].Destination)
+	require.False(t, inspect.Mounts[0].RW)
+
+	// Sandboxes cannot mount anything else at a shared path
+	path := "/v1/spaces/" + created.SpaceID + "/sandboxes"
+	require.Equal(t, http.StatusBadRequest, h.Do("POST", path, handler.CreateSandboxRequest{Tmpfs: map[string]string{"/data": ""}}, nil))
+
+	// Volumes must exist, since Docker would create missing ones empty
+	spacePath := "/v1/spaces/" + created.SpaceID
+	h.mustDo(http.StatusNoContent, "PUT", spacePath, map[string]interface{}{"volumes": []manager.SpaceVolume{{Volume: "missing", Path: "/data"}}}, nil)
+	require.Equal(t, http.StatusBadRequest, h.Do("POST", path, handler.CreateSandboxRequest{}, nil))
+	require.Equal(t, http.StatusUnprocessableEntity, h.Do("PUT", spacePath, map[string]interface{}{
+		"volumes": []manager.SpaceVolume{{Volume: "datasets", Path: "/data"}, {Volume: "models", Path: "/data"}},
+	}, nil))
+}
@@ -0,0 +1,166 @@
+package testharness
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"github.com/foreveryh/sandboxai/go/mentisruntime/ws"
+)
+
+// DefaultTimeout bounds how long a Stream waits for an observation.
+var DefaultTimeout = 10 * time.Second
+
+// Observation is a message received on a sandbox stream. Binary output frames are reported
+// with ObservationType "output" and their bytes in Line.
+type Observation struct {
+	Seq             uint64          `json:"seq"`
+	ObservationType string          `json:"observation_type"`
+	ActionID        string          `json:"action_id"`
+	Stream          string          `json:"stream"`
+	Line            string          `json:"line"`
+	ExitCode        *int            `json:"exit_code"`
+	Metadata        json.RawMessage `json:"metadata"`
+	Data            json.RawMessage `json:"data"`
+	Raw             []byte          `json:"-"` // The message as received
+}
+
+// EndExitCode returns the exit code of an "end" observation.
+func (o Observation) EndExitCode() int {
+	var data struct {
+		ExitCode int `json:"exit_code"`
+	}
+	json.Unmarshal(o.Data, &data)
+	return data.ExitCode
+}
+
+// Stream is a WebSocket subscription to the observations of a sandbox.
+type Stream struct {
+	t    testing.TB
+	conn *websocket.Conn
+}
+
+// Observe subscribes to the observations of a sandbox, from the first one recorded, so
+// observations of actions started before the call are received too. The subscription ends
+// with the test.
+func (h *Harness) Observe(sandboxID string) *Stream {
+	h.t.Helper()
+	return h.subscribe("/v1/sandboxes/" + sandboxID + "/stream?cursor=0")
+}
+
+// ObserveSpace subscribes to the events of a space, from the first one recorded.
+func (h *Harness) ObserveSpace(spaceID string) *Stream {
+	h.t.Helper()
+	return h.subscribe("/v1/spaces/" + spaceID + "/stream?cursor=0")
+}
+
+// ObserveEvents subscribes to the events of every space, from the first one recorded, with
+// the ?types filter if any are given.
+func (h *Harness) ObserveEvents(types ...string) *Stream {
+	h.t.Helper()
+	path := "/v1/events?cursor=0"
+	if len(types) > 0 {
+		path += "&types=" + strings.Join(types, ",")
+	}
+	return h.subscribe(path)
+}
+
+func (h *Harness) subscribe(path string) *Stream {
+	h.t.Helper()
+	url := "ws" + strings.TrimPrefix(h.URL, "http") + path
+	conn, _, err := websocket.DefaultDialer.Dial(url, http.Header{"Authorization": {"Bearer " + AdminToken}})
+	if err != nil {
+		h.t.Fatalf("testharness: subscribe to %s: %v", path, err)
+	}
+	h.t.Cleanup(func() { conn.Close() })
+	return &Stream{t: h.t, conn: conn}
+}
+
+// Next returns the next observation, failing the test if none arrives within DefaultTimeout.
+func (s *Stream) Next() Observation {
+	s.t.Helper()
+	s.conn.SetReadDeadline(time.Now().Add(DefaultTimeout))
+	kind, message, err := s.conn.ReadMessage()
+	if err != nil {
+		s.t.Fatalf("testharness: read observation: %v", err)
+	}
+	if kind == websocket.BinaryMessage {
+		actionID, stream, output, err := ws.ParseOutputFrame(message)
+		if err != nil {
+			s.t.Fatalf("testharness: %v", err)
+		}
+		name := "stdout"
+		if stream == ws.StreamStderr {
+			name = "stderr"
+		}
+		return Observation{ObservationType: "output", ActionID: actionID, Stream: name, Line: string(output), Raw: message}
+	}
+	obs := Observation{Raw: message}
+	if err := json.Unmarshal(message, &obs); err != nil {
+		s.t.Fatalf("testharness: decode observation %s: %v", message, err)
+	}
+	return obs
+}
+
+// Action returns the observations of an action, up to and including its "end" observation,
+// skipping those of anything else.
+func (s *Stream) Action(actionID string) []Observation {
+	s.t.Helper()
+	var observations []Observation
+	for {
+		obs := s.Next()
+		if obs.ActionID != actionID {
+			continue
+		}
+		observations = append(observations, obs)
+		if obs.ObservationType == "end" {
+			return observations
+		}
+	}
+}
+
+// Until returns the observations up to and including the first of the given type.
+func (s *Stream) Until(observationType string) []Observation {
+	s.t.Helper()
+	var observations []Observation
+	for {
+		obs := s.Next()
+		observations = append(observations, obs)
+		if obs.ObservationType == observationType {
+			return observations
+		}
+	}
+}
+
+// Types returns the types of observations, in order.
+func Types(observations []Observation) []string {
+	types := make([]string, len(observations))
+	for i, obs := range observations {
+		types[i] = obs.ObservationType
+	}
+	return types
+}
+
+// Lines returns the lines of the "stream" and "output" observations of one stream, in order.
+func Lines(observations []Observation, stream string) []string {
+	var lines []string
+	for _, obs := range observations {
+		if (obs.ObservationType == "stream" || obs.ObservationType == "output") && obs.Stream == stream {
+			lines = append(lines, obs.Line)
+		}
+	}
+	return lines
+}
+
+// RequireTypes fails the test unless the observations have exactly the given types, in order.
+func RequireTypes(t testing.TB, observations []Observation, types ...string) {
+	t.Helper()
+	got := Types(observations)
+	if strings.Join(got, ",") != strings.Join(types, ",") {
+		t.Fatalf("testharness: observation types %q, want %q", got, types)
+	}
+}
@@ -0,0 +1,79 @@
+package testharness
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/foreveryh/sandboxai/go/mentisruntime/fake"
+	"github.com/foreveryh/sandboxai/go/mentisruntime/handler"
+	"github.com/foreveryh/sandboxai/go/mentisruntime/manager"
+)
+
+func TestStreams_sequenceAndAggregate(t *testing.T) {
+	h := New(t, WithShell(func(command string) fake.Result {
+		return fake.Result{Stdout: "building\ndone\n", Stderr: "warning\n", ExitCode: 1}
+	}))
+	spaceID := h.CreateSpace("streams")
+	sandboxID := h.CreateSandbox(spaceID, handler.CreateSandboxRequest{})
+	stream := h.Observe(sandboxID)
+
+	var end struct {
+		ExitCode int     `json:"exit_code"`
+		Output   *string `json:"output"`
+		Stdout   *string `json:"stdout"`
+		Stderr   *string `json:"stderr"`
+	}
+	obs := stream.Action(h.RunAction(spaceID, sandboxID, "run_shell_command", map[string]interface{}{"command": "make", "aggregate": "merged"}))
+	seqs := map[string][]uint64{}
+	for _, o := range obs {
+		if o.ObservationType == "stream" {
+			var fields struct {
+				StreamSeq uint64 `json:"stream_seq"`
+			}
+			require.NoError(t, json.Unmarshal(o.Raw, &fields))
+			seqs[o.Stream] = append(seqs[o.Stream], fields.StreamSeq)
+		}
+	}
+	require.Equal(t, map[string][]uint64{"stdout": {1, 2}, "stderr": {1}}, seqs)
+	require.NoError(t, json.Unmarshal(obs[len(obs)-1].Data, &end))
+	require.Equal(t, 1, end.ExitCode)
+	require.Equal(t, "building\ndone\nwarning\n", *end.Output)
+	require.Nil(t, end.Stdout)
+
+	obs = stream.Action(h.RunAction(spaceID, sandboxID, "run_shell_command", map[string]interface{}{"command": "make", "aggregate": "separate"}))
+	end.Output = nil
+	require.NoError(t, json.Unmarshal(obs[len(obs)-1].Data, &end))
+	require.Equal(t, "building\ndone\n", *end.Stdout)
+	require.Equal(t, "warning\n", *end.Stderr)
+	require.Nil(t, end.Output)
+}
+
+func TestStreams_endReportsSignalAndUsage(t *testing.T) {
+	h := New(t, WithShell(func(command string) fake.Result {
+		if command == "train" {
+			return fake.Result{ExitCode: 137, Signal: "SIGKILL", OOMKilled: true, Delay: 20 * time.Millisecond}
+		}
+		return fake.Echo(command)
+	}))
+	spaceID := h.CreateSpace("usage")
+	sandboxID := h.CreateSandbox(spaceID, handler.CreateSandboxRequest{})
+	stream := h.Observe(sandboxID)
+
+	obs := stream.Action(h.RunShell(spaceID, sandboxID, "train"))
+	var end manager.EndObservationData
+	require.NoError(t, json.Unmarshal(obs[len(obs)-1].Data, &end))
+	require.Equal(t, 137, end.ExitCode)
+	require.Equal(t, "SIGKILL", end.Signal)
+	require.True(t, end.OOMKilled)
+	require.NotNil(t, end.Usage)
+	require.GreaterOrEqual(t, end.Usage.DurationMS, int64(20))
+
+	obs = stream.Action(h.RunShell(spaceID, sandboxID, "echo ok"))
+	end = manager.EndObservationData{}
+	require.NoError(t, json.Unmarshal(obs[len(obs)-1].Data, &end))
+	require.Empty(t, end.Signal)
+	require.False(t, end.OOMKilled)
+}
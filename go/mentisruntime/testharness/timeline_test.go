@@ -0,0 +1,38 @@
+package testharness
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/foreveryh/sandboxai/go/mentisruntime/handler"
+	"github.com/foreveryh/sandboxai/go/mentisruntime/manager"
+)
+
+func TestTimeline_spansOfActions(t *testing.T) {
+	h := New(t)
+	spaceID := h.CreateSpace("timeline")
+	sandboxID := h.CreateSandbox(spaceID, handler.CreateSandboxRequest{})
+	stream := h.Observe(sandboxID)
+	shellID := h.RunShell(spaceID, sandboxID, "echo hi")
+	stream.Action(shellID)
+	cellID := h.RunIPython(spaceID, sandboxID, "x = 1\nprint(x)")
+	stream.Action(cellID)
+	path := fmt.Sprintf("/v1/spaces/%s/sandboxes/%s/timeline", spaceID, sandboxID)
+
+	var timeline manager.Timeline
+	h.mustDo(http.StatusOK, "GET", path, nil, &timeline)
+	require.Len(t, timeline.Actions, 2)
+	require.Equal(t, shellID, timeline.Actions[0].ActionID)
+	require.Equal(t, "shell", timeline.Actions[0].ActionType)
+	require.Equal(t, "echo hi", timeline.Actions[0].Label)
+	require.Equal(t, 0, *timeline.Actions[0].ExitCode)
+	require.Equal(t, 1, timeline.Actions[0].Lines["stdout"])
+	require.NotNil(t, timeline.Actions[0].DurationMS)
+	require.Equal(t, "ipython", timeline.Actions[1].ActionType)
+	require.Equal(t, "x = 1", timeline.Actions[1].Label)
+
+	require.Equal(t, http.StatusUnprocessableEntity, h.Do("GET", path+"?since=yesterday", nil, nil))
+}
@@ -0,0 +1,67 @@
+package testharness
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/foreveryh/sandboxai/go/mentisruntime/handler"
+	"github.com/foreveryh/sandboxai/go/mentisruntime/manager"
+)
+
+func TestTransfer_copiesBetweenSandboxes(t *testing.T) {
+	h := New(t)
+	spaceID := h.CreateSpace("pipeline")
+	build := h.CreateSandbox(spaceID, handler.CreateSandboxRequest{})
+	test := h.CreateSandbox(spaceID, handler.CreateSandboxRequest{})
+	container := func(sandboxID string) string {
+		var state manager.SandboxState
+		h.mustDo(http.StatusOK, "GET", "/v1/spaces/"+spaceID+"/sandboxes/"+sandboxID, nil, &state)
+		return state.ContainerID
+	}
+	buildContainer, testContainer := container(build), container(test)
+	require.NoError(t, h.Docker.WriteFile(buildContainer, "/src/dist/app", []byte("binary")))
+	require.NoError(t, h.Docker.WriteFile(buildContainer, "/src/dist/lib/util.so", []byte("lib")))
+	transfer := func(srcPath, dstPath string) (manager.FileTransfer, int) {
+		var result manager.FileTransfer
+		status := h.Do("POST", "/v1/spaces/"+spaceID+"/transfers", handler.TransferRequest{
+			Source:      manager.TransferEndpoint{SandboxID: build, Path: srcPath},
+			Destination: manager.TransferEndpoint{SandboxID: test, Path: dstPath},
+		}, &result)
+		return result, status
+	}
+
+	// A directory is copied into an existing directory
+	result, status := transfer("/src/dist", "/tmp")
+	require.Equal(t, http.StatusCreated, status)
+	require.Equal(t, 2, result.Files)
+	require.EqualValues(t, 9, result.Bytes)
+	data, ok := h.Docker.ReadFile(testContainer, "/tmp/dist/lib/util.so")
+	require.True(t, ok)
+	require.Equal(t, "lib", string(data))
+
+	// Other destinations name the copy
+	_, status = transfer("/src/dist/app", "/tmp/app-under-test")
+	require.Equal(t, http.StatusCreated, status)
+	data, _ = h.Docker.ReadFile(testContainer, "/tmp/app-under-test")
+	require.Equal(t, "binary", string(data))
+	_, status = transfer("/src/dist", "/tmp/release")
+	require.Equal(t, http.StatusCreated, status)
+	_, ok = h.Docker.ReadFile(testContainer, "/tmp/release/app")
+	require.True(t, ok)
+
+	_, status = transfer("/src/missing", "/tmp")
+	require.Equal(t, http.StatusNotFound, status)
+	_, status = transfer("/src/dist", "/missing/dir/copy")
+	require.Equal(t, http.StatusNotFound, status)
+	_, status = transfer("src/dist", "/tmp")
+	require.Equal(t, http.StatusUnprocessableEntity, status)
+
+	// Both sandboxes must be in the space
+	other := h.CreateSandbox(h.CreateSpace("other"), handler.CreateSandboxRequest{})
+	require.Equal(t, http.StatusNotFound, h.Do("POST", "/v1/spaces/"+spaceID+"/transfers", handler.TransferRequest{
+		Source:      manager.TransferEndpoint{SandboxID: build, Path: "/src/dist"},
+		Destination: manager.TransferEndpoint{SandboxID: other, Path: "/tmp"},
+	}, nil))
+}
@@ -0,0 +1,57 @@
+package testharness
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/foreveryh/sandboxai/go/mentisruntime/handler"
+	"github.com/foreveryh/sandboxai/go/mentisruntime/manager"
+)
+
+func TestSandboxUlimits(t *testing.T) {
+	h := New(t)
+	spaceID := h.CreateSpace("ulimits")
+	docker, err := h.Docker.Client()
+	require.NoError(t, err)
+	ulimits := func(sandboxID string) map[string]manager.Ulimit {
+		var state manager.SandboxState
+		h.mustDo(http.StatusOK, "GET", "/v1/spaces/"+spaceID+"/sandboxes/"+sandboxID, nil, &state)
+		info, err := docker.ContainerInspect(context.Background(), state.ContainerID)
+		require.NoError(t, err)
+		limits := make(map[string]manager.Ulimit)
+		for _, limit := range info.HostConfig.Ulimits {
+			limits[limit.Name] = manager.Ulimit{Soft: limit.Soft, Hard: limit.Hard}
+		}
+		return limits
+	}
+
+	require.Empty(t, ulimits(h.CreateSandbox(spaceID, handler.CreateSandboxRequest{})))
+
+	sandboxID := h.CreateSandbox(spaceID, handler.CreateSandboxRequest{Ulimits: map[string]manager.Ulimit{"nofile": {Soft: 256, Hard: 512}}})
+	require.Equal(t, map[string]manager.Ulimit{"nofile": {Soft: 256, Hard: 512}}, ulimits(sandboxID))
+
+	// The hardened profile has defaults, which the spec overrides by name
+	hardened := h.CreateSandbox(spaceID, handler.CreateSandboxRequest{
+		SecurityProfile: manager.SecurityProfileHardened,
+		Ulimits:         map[string]manager.Ulimit{"nproc": {Soft: 100, Hard: 200}},
+	})
+	require.Equal(t, map[string]manager.Ulimit{
+		"nofile": {Soft: 1024, Hard: 4096},
+		"nproc":  {Soft: 100, Hard: 200},
+		"core":   {Soft: 0, Hard: 0},
+	}, ulimits(hardened))
+
+	path := "/v1/spaces/" + spaceID + "/sandboxes"
+	for _, raised := range []map[string]manager.Ulimit{
+		{"nproc": {Soft: 4096, Hard: 100000}},
+		{"nofile": {Soft: 1024, Hard: 65536}},
+		{"core": {Soft: 0, Hard: 1 << 30}},
+	} {
+		require.Equal(t, http.StatusBadRequest, h.Do("POST", path, handler.CreateSandboxRequest{SecurityProfile: manager.SecurityProfileHardened, Ulimits: raised}, nil), raised)
+	}
+	require.Equal(t, http.StatusUnprocessableEntity, h.Do("POST", path, handler.CreateSandboxRequest{Ulimits: map[string]manager.Ulimit{"memlock": {Soft: 1, Hard: 1}}}, nil))
+	require.Equal(t, http.StatusUnprocessableEntity, h.Do("POST", path, handler.CreateSandboxRequest{Ulimits: map[string]manager.Ulimit{"nofile": {Soft: 10, Hard: 5}}}, nil))
+}
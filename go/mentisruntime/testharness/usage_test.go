@@ -0,0 +1,61 @@
+package testharness
+
+import (
+	"encoding/csv"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/foreveryh/sandboxai/go/mentisruntime/handler"
+	"github.com/foreveryh/sandboxai/go/mentisruntime/manager"
+)
+
+func TestUsage_accountsSandboxes(t *testing.T) {
+	h := New(t, WithManagerOptions(manager.WithUsageAccounting(20*time.Millisecond)))
+	spaceID := h.CreateSpace("billing")
+	sandboxID := h.CreateSandbox(spaceID, handler.CreateSandboxRequest{})
+
+	var report manager.UsageReport
+	require.Eventually(t, func() bool {
+		h.mustDo(http.StatusOK, "GET", "/v1/usage", nil, &report)
+		return len(report.Sandboxes) == 1 && report.Sandboxes[0].CPUSeconds > 0
+	}, 5*time.Second, 20*time.Millisecond)
+	usage := report.Sandboxes[0]
+	require.Equal(t, sandboxID, usage.SandboxID)
+	require.Equal(t, spaceID, usage.SpaceID)
+	require.Greater(t, usage.MemoryByteSeconds, 0.0)
+	require.GreaterOrEqual(t, usage.WallSeconds, usage.CPUSeconds) // The fake keeps half a CPU busy
+	require.Equal(t, []manager.SpaceUsage{{SpaceID: spaceID, UsageTotals: usage.UsageTotals}}, report.Spaces)
+	require.Equal(t, usage.UsageTotals, report.Total)
+
+	// Deleted sandboxes stay in reports
+	h.DeleteSandbox(spaceID, sandboxID)
+	h.mustDo(http.StatusOK, "GET", "/v1/usage", nil, &report)
+	require.True(t, report.Sandboxes[0].Deleted)
+
+	// Ranges before any usage are empty
+	h.mustDo(http.StatusOK, "GET", "/v1/usage?to=2020-01-01T00:00:00Z", nil, &report)
+	require.Empty(t, report.Sandboxes)
+
+	resp, err := http.Get(h.URL + "/v1/usage?format=csv")
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	require.Equal(t, "text/csv", resp.Header.Get("Content-Type"))
+	rows, err := csv.NewReader(resp.Body).ReadAll()
+	require.NoError(t, err)
+	require.Len(t, rows, 5)
+	require.Equal(t, "level,tenant,space_id,sandbox_id,cpu_seconds,memory_byte_seconds,wall_seconds", strings.Join(rows[0], ","))
+	require.Equal(t, []string{"sandbox", "", spaceID, sandboxID}, rows[1][:4])
+	require.Equal(t, "total", rows[4][0])
+
+	require.Equal(t, http.StatusUnprocessableEntity, h.Do("GET", "/v1/usage?from=2030-01-01T00:00:00Z&to=2020-01-01T00:00:00Z", nil, nil))
+	require.Equal(t, http.StatusUnprocessableEntity, h.Do("GET", "/v1/usage?format=xml", nil, nil))
+}
+
+func TestUsage_disabled(t *testing.T) {
+	h := New(t)
+	require.Equal(t, http.StatusNotImplemented, h.Do("GET", "/v1/usage", nil, nil))
+}
@@ -0,0 +1,164 @@
+package testharness
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/require"
+
+	"github.com/foreveryh/sandboxai/go/mentisruntime/handler"
+	"github.com/foreveryh/sandboxai/go/mentisruntime/manager"
+	"github.com/foreveryh/sandboxai/go/mentisruntime/msgpack"
+)
+
+func TestVersions_v2TypedObservations(t *testing.T) {
+	h := New(t)
+	// Routes unchanged in version 2 are served by version 1.
+	var space struct {
+		SpaceID string `json:"space_id"`
+	}
+	require.Equal(t, http.StatusCreated, h.Do("POST", "/v2/spaces", map[string]string{"name": "v2"}, &space))
+	sandboxID := h.CreateSandbox(space.SpaceID, handler.CreateSandboxRequest{})
+	actionID := h.RunShell(space.SpaceID, sandboxID, "echo hi")
+
+	url := "ws" + strings.TrimPrefix(h.URL, "http") + "/v2/sandboxes/" + sandboxID + "/stream?cursor=0"
+	conn, _, err := websocket.DefaultDialer.Dial(url, nil)
+	require.NoError(t, err)
+	defer conn.Close()
+	var streamed []handler.TypedObservation
+	for len(streamed) == 0 || streamed[len(streamed)-1].Type != "end" {
+		conn.SetReadDeadline(time.Now().Add(DefaultTimeout))
+		var obs handler.TypedObservation
+		require.NoError(t, conn.ReadJSON(&obs))
+		if obs.ActionID == actionID {
+			streamed = append(streamed, obs)
+		}
+	}
+	var types []string
+	for _, obs := range streamed {
+		types = append(types, obs.Type)
+	}
+	require.Equal(t, []string{"start", "stream", "result", "end"}, types)
+	require.NotZero(t, streamed[1].Seq)
+	require.NotEmpty(t, streamed[1].Timestamp)
+	require.JSONEq(t, `{"stream":"stdout","stream_seq":1,"line":"hi"}`, string(streamed[1].Data))
+	var end manager.EndObservationData
+	require.NoError(t, json.Unmarshal(streamed[3].Data, &end))
+	require.Equal(t, 0, end.ExitCode)
+	require.NotNil(t, end.Usage)
+
+	var page handler.TypedObservationPage
+	require.Equal(t, http.StatusOK, h.Do("GET", fmt.Sprintf("/v2/spaces/%s/sandboxes/%s/observations?action_id=%s", space.SpaceID, sandboxID, actionID), nil, &page))
+	require.Len(t, page.Observations, len(streamed))
+	for i, obs := range page.Observations {
+		require.Equal(t, streamed[i].Seq, obs.Seq)
+		require.Equal(t, streamed[i].Type, obs.Type)
+		require.JSONEq(t, string(streamed[i].Data), string(obs.Data))
+	}
+}
+
+func TestVersions_v1DeprecationHeaders(t *testing.T) {
+	h := New(t)
+	spaceID := h.CreateSpace("v1")
+	sandboxID := h.CreateSandbox(spaceID, handler.CreateSandboxRequest{})
+
+	path := fmt.Sprintf("/v1/spaces/%s/sandboxes/%s/observations", spaceID, sandboxID)
+	resp, err := http.Get(h.URL + path)
+	require.NoError(t, err)
+	resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	require.Equal(t, fmt.Sprintf("@%d", handler.V1ObservationsDeprecated.Unix()), resp.Header.Get("Deprecation"))
+	require.Equal(t, "</v2"+strings.TrimPrefix(path, "/v1")+`>; rel="successor-version"`, resp.Header.Get("Link"))
+
+	url := "ws" + strings.TrimPrefix(h.URL, "http") + "/v1/sandboxes/" + sandboxID + "/stream"
+	conn, resp, err := websocket.DefaultDialer.Dial(url, nil)
+	require.NoError(t, err)
+	conn.Close()
+	require.NotEmpty(t, resp.Header.Get("Deprecation"))
+
+	// Routes that are not deprecated carry no headers.
+	resp, err = http.Get(h.URL + "/v1/spaces/" + spaceID)
+	require.NoError(t, err)
+	resp.Body.Close()
+	require.Empty(t, resp.Header.Get("Deprecation"))
+
+	var page json.RawMessage
+	require.Equal(t, http.StatusNotFound, h.Do("GET", "/v2/spaces/"+spaceID+"/sandboxes/missing/observations", nil, &page))
+}
+
+func TestVersions_subprotocols(t *testing.T) {
+	h := New(t)
+	spaceID := h.CreateSpace("formats")
+	sandboxID := h.CreateSandbox(spaceID, handler.CreateSandboxRequest{})
+	actionID := h.RunShell(spaceID, sandboxID, "echo hi")
+	url := "ws" + strings.TrimPrefix(h.URL, "http") + "/v1/sandboxes/" + sandboxID + "/stream?cursor=0"
+
+	first := func(subprotocols ...string) (string, map[string]interface{}) {
+		t.Helper()
+		dialer := websocket.Dialer{Subprotocols: subprotocols}
+		conn, _, err := dialer.Dial(url, nil)
+		require.NoError(t, err)
+		defer conn.Close()
+		for {
+			conn.SetReadDeadline(time.Now().Add(DefaultTimeout))
+			var message map[string]interface{}
+			require.NoError(t, conn.ReadJSON(&message))
+			if message["action_id"] == actionID {
+				return conn.Subprotocol(), message
+			}
+		}
+	}
+
+	protocol, message := first()
+	require.Empty(t, protocol)
+	require.Equal(t, "start", message["observation_type"])
+
+	protocol, message = first("observations.v2.json")
+	require.Equal(t, "observations.v2.json", protocol)
+	require.Equal(t, "start", message["type"])
+
+	// The server prefers the typed schema.
+	protocol, _ = first("observations.v1.json", "observations.v2.json")
+	require.Equal(t, "observations.v2.json", protocol)
+	protocol, message = first("observations.v1.json", "chat")
+	require.Equal(t, "observations.v1.json", protocol)
+	require.Equal(t, "start", message["observation_type"])
+
+	_, resp, err := (&websocket.Dialer{Subprotocols: []string{"observations.v9.json"}}).Dial(url, nil)
+	require.Error(t, err)
+	require.Equal(t, http.StatusBadRequest, resp.StatusCode)
+}
+
+func TestVersions_msgpack(t *testing.T) {
+	h := New(t, WithManagerOptions(manager.WithAgentEncoding(manager.AgentEncodingMsgpack)))
+	spaceID := h.CreateSpace("msgpack")
+	sandboxID := h.CreateSandbox(spaceID, handler.CreateSandboxRequest{})
+	require.Equal(t, "msgpack", h.Docker.Agent(sandboxID).Encoding)
+	actionID := h.RunShell(spaceID, sandboxID, "echo hi")
+
+	url := "ws" + strings.TrimPrefix(h.URL, "http") + "/v1/sandboxes/" + sandboxID + "/stream?cursor=0"
+	conn, _, err := (&websocket.Dialer{Subprotocols: []string{"observations.v2.msgpack"}}).Dial(url, nil)
+	require.NoError(t, err)
+	defer conn.Close()
+	var streamed []handler.TypedObservation
+	for len(streamed) == 0 || streamed[len(streamed)-1].Type != "end" {
+		conn.SetReadDeadline(time.Now().Add(DefaultTimeout))
+		kind, message, err := conn.ReadMessage()
+		require.NoError(t, err)
+		require.Equal(t, websocket.BinaryMessage, kind)
+		decoded, err := msgpack.ToJSON(message)
+		require.NoError(t, err)
+		var obs handler.TypedObservation
+		require.NoError(t, json.Unmarshal(decoded, &obs))
+		if obs.ActionID == actionID {
+			streamed = append(streamed, obs)
+		}
+	}
+	require.Len(t, streamed, 4)
+	require.JSONEq(t, `{"stream":"stdout","stream_seq":1,"line":"hi"}`, string(streamed[1].Data))
+}
@@ -0,0 +1,93 @@
+package testharness
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/foreveryh/sandboxai/go/mentisruntime/fake"
+	"github.com/foreveryh/sandboxai/go/mentisruntime/handler"
+	"github.com/foreveryh/sandboxai/go/mentisruntime/manager"
+)
+
+// runWorkflow starts a workflow and returns it once its "workflow_end" observation arrives.
+// The stream replays the observations of earlier workflows, which are skipped.
+func runWorkflow(t *testing.T, h *Harness, spaceID, sandboxID string, steps ...handler.WorkflowStepRequest) *manager.Workflow {
+	t.Helper()
+	stream := h.Observe(sandboxID)
+	path := fmt.Sprintf("/v1/spaces/%s/sandboxes/%s/workflows", spaceID, sandboxID)
+	var wf manager.Workflow
+	h.mustDo(http.StatusAccepted, "POST", path, handler.StartWorkflowRequest{Steps: steps}, &wf)
+	for {
+		var end manager.WorkflowEndObservationData
+		observations := stream.Until("workflow_end")
+		require.NoError(t, json.Unmarshal(observations[len(observations)-1].Data, &end))
+		if end.WorkflowID == wf.ID {
+			break
+		}
+	}
+	h.mustDo(http.StatusOK, "GET", path+"/"+wf.ID, nil, &wf)
+	return &wf
+}
+
+func shellStep(command, runIf string) handler.WorkflowStepRequest {
+	return handler.WorkflowStepRequest{ActionType: "shell", Payload: map[string]interface{}{"command": command}, RunIf: runIf}
+}
+
+func stepStatuses(wf *manager.Workflow) []string {
+	statuses := make([]string, len(wf.Steps))
+	for i, step := range wf.Steps {
+		statuses[i] = step.Status
+	}
+	return statuses
+}
+
+func TestWorkflow_runIf(t *testing.T) {
+	h := New(t)
+	spaceID := h.CreateSpace("workflows")
+	sandboxID := h.CreateSandbox(spaceID, handler.CreateSandboxRequest{})
+
+	wf := runWorkflow(t, h, spaceID, sandboxID,
+		shellStep("echo build", ""),
+		shellStep("echo cleanup", manager.RunOnFailure),
+		shellStep("echo report", manager.RunAlways),
+	)
+	require.Equal(t, manager.WorkflowSucceeded, wf.Status)
+	require.Equal(t, []string{manager.WorkflowSucceeded, manager.WorkflowSkipped, manager.WorkflowSucceeded}, stepStatuses(wf))
+
+	wf = runWorkflow(t, h, spaceID, sandboxID,
+		shellStep("exit 3", manager.RunOnSuccess),
+		shellStep("echo deploy", ""),
+		shellStep("echo cleanup", manager.RunOnFailure),
+		shellStep("echo report", manager.RunAlways),
+	)
+	require.Equal(t, manager.WorkflowFailed, wf.Status)
+	require.Equal(t, []string{manager.WorkflowFailed, manager.WorkflowSkipped, manager.WorkflowSucceeded, manager.WorkflowSucceeded}, stepStatuses(wf))
+	require.NotNil(t, wf.Steps[0].ExitCode)
+	require.Equal(t, 3, *wf.Steps[0].ExitCode)
+	require.NotNil(t, wf.FinishedAt)
+}
+
+func TestWorkflow_stepTimeout(t *testing.T) {
+	release := make(chan struct{})
+	h := New(t, WithShell(func(command string) fake.Result {
+		if command == "hang" {
+			<-release
+		}
+		return fake.Echo(command)
+	}))
+	t.Cleanup(func() { close(release) })
+	spaceID := h.CreateSpace("workflows")
+	sandboxID := h.CreateSandbox(spaceID, handler.CreateSandboxRequest{})
+
+	hang := shellStep("hang", "")
+	hang.Timeout = "200ms"
+	wf := runWorkflow(t, h, spaceID, sandboxID, hang, shellStep("echo report", manager.RunAlways))
+	require.Equal(t, manager.WorkflowFailed, wf.Status)
+	require.Equal(t, []string{manager.WorkflowFailed, manager.WorkflowSucceeded}, stepStatuses(wf))
+	require.Nil(t, wf.Steps[0].ExitCode)
+	require.Contains(t, wf.Steps[0].Error, "timed out")
+}
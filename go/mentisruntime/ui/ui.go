@@ -0,0 +1,33 @@
+// Package ui serves the runtime's embedded web UI: a single page that lists spaces and
+// sandboxes, runs commands and shows their observations live through the public API.
+package ui
+
+import (
+	"embed"
+	"io/fs"
+	"net/http"
+	"strings"
+)
+
+//go:embed static
+var static embed.FS
+
+// Handler serves the UI under prefix, such as "/ui". A request for the prefix itself is
+// redirected to the page.
+func Handler(prefix string) http.Handler {
+	root, err := fs.Sub(static, "static")
+	if err != nil {
+		panic(err) // The embedded tree always has the directory
+	}
+	prefix = strings.TrimSuffix(prefix, "/")
+	files := http.StripPrefix(prefix, http.FileServer(http.FS(root)))
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == prefix {
+			http.Redirect(w, r, prefix+"/", http.StatusMovedPermanently)
+			return
+		}
+		// The page is small and changes with the runtime's version
+		w.Header().Set("Cache-Control", "no-cache")
+		files.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,230 @@
+// Package validation checks API request bodies and collects per-field errors.
+package validation
+
+import (
+	"fmt"
+	"net/netip"
+	"path"
+	"regexp"
+	"strings"
+
+	"github.com/distribution/reference"
+)
+
+// Limits applied to request fields.
+const (
+	MaxNameLength        = 128
+	MaxDescriptionLength = 1024
+	MaxPathLength        = 4096
+	MaxEnvVars           = 256
+	MaxEnvValueBytes     = 32 << 10
+	MaxCommandBytes      = 256 << 10 // Shell commands and IPython code
+	MaxSecretValueBytes  = 64 << 10
+	MaxLabels            = 64
+)
+
+var (
+	envNameRe    = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+	userRe       = regexp.MustCompile(`^[A-Za-z0-9_][A-Za-z0-9_.-]*(:[A-Za-z0-9_][A-Za-z0-9_.-]*)?$`)
+	networkRe    = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_.-]*$`)
+	labelRe      = regexp.MustCompile(`^[A-Za-z0-9]([A-Za-z0-9_./-]*[A-Za-z0-9])?$`)
+	hostRe       = regexp.MustCompile(`^[A-Za-z0-9]([A-Za-z0-9-]{0,61}[A-Za-z0-9])?(\.[A-Za-z0-9]([A-Za-z0-9-]{0,61}[A-Za-z0-9])?)*$`)
+	windowsAbsRe = regexp.MustCompile(`^[A-Za-z]:[\\/]`)
+)
+
+// FieldError describes why a single field was rejected.
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// Errors is the list of field errors of a rejected request.
+type Errors []FieldError
+
+func (e Errors) Error() string {
+	parts := make([]string, len(e))
+	for i, fe := range e {
+		parts[i] = fe.Field + ": " + fe.Message
+	}
+	return "validation failed: " + strings.Join(parts, "; ")
+}
+
+// Validator accumulates field errors. The zero value is ready to use.
+type Validator struct {
+	errs Errors
+}
+
+// Add records an error for field.
+func (v *Validator) Add(field, format string, args ...interface{}) {
+	v.errs = append(v.errs, FieldError{Field: field, Message: fmt.Sprintf(format, args...)})
+}
+
+// Check records msg for field unless ok.
+func (v *Validator) Check(ok bool, field, msg string) {
+	if !ok {
+		v.Add(field, "%s", msg)
+	}
+}
+
+// Required rejects an empty value.
+func (v *Validator) Required(field, value string) bool {
+	if value == "" {
+		v.Add(field, "is required")
+		return false
+	}
+	return true
+}
+
+// MaxLength rejects values longer than n bytes.
+func (v *Validator) MaxLength(field, value string, n int) {
+	if len(value) > n {
+		v.Add(field, "must be at most %d bytes, got %d", n, len(value))
+	}
+}
+
+// Image rejects values that are not valid image references. Empty values are allowed.
+func (v *Validator) Image(field, value string) {
+	if value == "" {
+		return
+	}
+	if _, err := reference.ParseNormalizedNamed(value); err != nil {
+		v.Add(field, "is not a valid image reference: %v", err)
+	}
+}
+
+// EnvName rejects names that are not valid environment variable names.
+func (v *Validator) EnvName(field, name string) {
+	if !envNameRe.MatchString(name) {
+		v.Add(field, "%q is not a valid environment variable name", name)
+	}
+}
+
+// Env validates an environment map's size, names and values.
+func (v *Validator) Env(field string, env map[string]string) {
+	if len(env) > MaxEnvVars {
+		v.Add(field, "must have at most %d entries, got %d", MaxEnvVars, len(env))
+	}
+	for name, value := range env {
+		v.EnvName(field+"."+name, name)
+		v.MaxLength(field+"."+name, value, MaxEnvValueBytes)
+	}
+}
+
+// AbsPath rejects empty, relative or overly long container paths. Paths of Windows
+// containers may start with a drive ("C:\work" or "C:/work").
+func (v *Validator) AbsPath(field, value string) {
+	if !v.Required(field, value) {
+		return
+	}
+	if !path.IsAbs(value) && !windowsAbsRe.MatchString(value) {
+		v.Add(field, "must be an absolute path")
+	}
+	v.MaxLength(field, value, MaxPathLength)
+}
+
+// FileName rejects values that are not a single path element: names containing "/" or "\",
+// "." and "..". Empty values are allowed.
+func (v *Validator) FileName(field, value string) {
+	switch {
+	case value == "":
+	case value == "." || value == ".." || strings.ContainsAny(value, `/\`):
+		v.Add(field, "%q is not a valid file name", value)
+	default:
+		v.MaxLength(field, value, MaxNameLength)
+	}
+}
+
+// User rejects values that are not a container user: a name or uid, optionally followed by
+// ":" and a group name or gid. Empty values are allowed.
+func (v *Validator) User(field, value string) {
+	if value == "" {
+		return
+	}
+	if len(value) > MaxNameLength || !userRe.MatchString(value) {
+		v.Add(field, "must be a user or uid, optionally followed by :group or :gid")
+	}
+}
+
+// IP rejects values that are not IPv4 or IPv6 addresses.
+func (v *Validator) IP(field, value string) {
+	if _, err := netip.ParseAddr(value); err != nil {
+		v.Add(field, "%q is not a valid IP address", value)
+	}
+}
+
+// Hostname rejects values that are not DNS names.
+func (v *Validator) Hostname(field, value string) {
+	if len(value) > 253 || !hostRe.MatchString(value) {
+		v.Add(field, "%q is not a valid hostname", value)
+	}
+}
+
+// ExtraHost rejects values that are not a "hostname:ip" /etc/hosts entry. The IP may also
+// be "host-gateway", which Docker replaces with the host's address.
+func (v *Validator) ExtraHost(field, value string) {
+	host, ip, ok := strings.Cut(value, ":")
+	if !ok {
+		v.Add(field, "must have the form hostname:ip")
+		return
+	}
+	v.Hostname(field, host)
+	if ip != "host-gateway" {
+		v.IP(field, ip)
+	}
+}
+
+// ResourceName rejects values that are not valid names for Docker networks and volumes.
+func (v *Validator) ResourceName(field, value string) {
+	if len(value) > MaxNameLength || !networkRe.MatchString(value) {
+		v.Add(field, "%q is not a valid name", value)
+	}
+}
+
+// NetworkName rejects values that are not Docker network names, as well as the "host" and
+// "none" networks, on which the runtime cannot reach the sandbox agent.
+func (v *Validator) NetworkName(field, value string) {
+	switch {
+	case value == "host" || value == "none":
+		v.Add(field, "%q networks are not supported", value)
+	case len(value) > MaxNameLength || !networkRe.MatchString(value):
+		v.Add(field, "%q is not a valid network name", value)
+	}
+}
+
+// Labels validates user labels: their number, keys and value lengths. Keys starting with
+// "sandboxai." are reserved for the runtime.
+func (v *Validator) Labels(field string, labels map[string]string) {
+	if len(labels) > MaxLabels {
+		v.Add(field, "must have at most %d entries, got %d", MaxLabels, len(labels))
+	}
+	for key, value := range labels {
+		switch {
+		case len(key) > MaxNameLength || !labelRe.MatchString(key):
+			v.Add(field+"."+key, "%q is not a valid label key", key)
+		case strings.HasPrefix(key, "sandboxai."):
+			v.Add(field+"."+key, "\"sandboxai.\" keys are reserved")
+		}
+		v.MaxLength(field+"."+key, value, MaxDescriptionLength)
+	}
+}
+
+// OneOf rejects values outside allowed. Empty values are allowed.
+func (v *Validator) OneOf(field, value string, allowed ...string) {
+	if value == "" {
+		return
+	}
+	for _, a := range allowed {
+		if value == a {
+			return
+		}
+	}
+	v.Add(field, "must be one of %s", strings.Join(allowed, ", "))
+}
+
+// Err returns the collected errors, or nil if there are none.
+func (v *Validator) Err() error {
+	if len(v.errs) == 0 {
+		return nil
+	}
+	return v.errs
+}
@@ -0,0 +1,52 @@
+package validation
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidator_collectsFieldErrors(t *testing.T) {
+	var v Validator
+	v.Required("name", "")
+	v.Image("image", "Not A Valid/Image")
+	v.Image("image_ok", "python:3.12-slim")
+	v.Env("env", map[string]string{"1BAD": "x", "GOOD_NAME": "y"})
+	v.AbsPath("path", "relative/dir")
+	v.AbsPath("path_ok", `C:\work`)
+	v.MaxLength("command", strings.Repeat("x", 11), 10)
+	v.User("user", "1000:1000:x")
+	v.User("user_ok", "1000:1000")
+	v.IP("dns[0]", "10.0.0.300")
+	v.IP("dns[1]", "fd00::53")
+	v.Hostname("dns_search[0]", "corp.example.com")
+	v.ExtraHost("extra_hosts[0]", "db.internal:10.0.0.10")
+	v.ExtraHost("extra_hosts[1]", "gateway:host-gateway")
+	v.ExtraHost("extra_hosts[2]", "api.internal:fd00::1")
+	v.ExtraHost("extra_hosts[3]", "no-ip")
+	v.NetworkName("network", "host")
+	v.NetworkName("network_ok", "compose_default")
+	v.Labels("labels", map[string]string{"sandboxai.id": "x"})
+	v.Labels("labels_ok", map[string]string{"eval.run": "42", "team": ""})
+	v.FileName("file_name", "../other/out")
+	v.FileName("file_name_ok", "report.v2.json")
+
+	err := v.Err()
+	require.Error(t, err)
+	var fieldErrs Errors
+	require.ErrorAs(t, err, &fieldErrs)
+
+	var fields []string
+	for _, fe := range fieldErrs {
+		fields = append(fields, fe.Field)
+	}
+	require.Equal(t, []string{"name", "image", "env.1BAD", "path", "command", "user", "dns[0]", "extra_hosts[3]", "network", "labels.sandboxai.id", "file_name"}, fields)
+}
+
+func TestValidator_noErrors(t *testing.T) {
+	var v Validator
+	v.Required("name", "x")
+	v.OneOf("profile", "", "default", "hardened")
+	require.NoError(t, v.Err())
+}
@@ -0,0 +1,144 @@
+// Package workpool runs tasks on a fixed number of goroutines fed by a bounded queue, so the
+// goroutines a process spawns under load are known in advance, and groups long-lived
+// goroutines whose lifetimes end together.
+package workpool
+
+import (
+	"context"
+	"errors"
+	"sync"
+
+	"github.com/foreveryh/sandboxai/go/mentisruntime/metrics"
+)
+
+var (
+	ErrQueueFull = errors.New("workpool: queue full")
+	ErrClosed    = errors.New("workpool: pool closed")
+)
+
+var (
+	queuedTasks = metrics.Default.NewGaugeVec("sandboxai_pool_queued_tasks",
+		"Tasks waiting for a worker, by pool.", "pool")
+	busyWorkers = metrics.Default.NewGaugeVec("sandboxai_pool_busy_workers",
+		"Workers running a task, by pool.", "pool")
+	poolWorkers = metrics.Default.NewGaugeVec("sandboxai_pool_workers",
+		"Workers started, by pool.", "pool")
+	rejectedTasks = metrics.Default.NewCounterVec("sandboxai_pool_rejected_total",
+		"Tasks rejected because the pool's queue was full, by pool.", "pool")
+)
+
+// Pool runs submitted tasks on a fixed set of workers, in submission order.
+type Pool struct {
+	name  string
+	tasks chan func()
+
+	mu      sync.RWMutex // Held for reading while submitting, so Close never closes tasks under a send
+	closed  bool
+	workers sync.WaitGroup
+
+	queued, busy *metrics.Gauge
+	rejected     *metrics.Counter
+}
+
+// New starts a pool with workers goroutines and room for queueSize tasks waiting for one.
+// Its metrics are labelled with name.
+func New(name string, workers, queueSize int) *Pool {
+	workers = max(workers, 1)
+	p := &Pool{
+		name:     name,
+		tasks:    make(chan func(), max(queueSize, 0)),
+		queued:   queuedTasks.With(name),
+		busy:     busyWorkers.With(name),
+		rejected: rejectedTasks.With(name),
+	}
+	poolWorkers.With(name).Set(int64(workers))
+	p.workers.Add(workers)
+	for range workers {
+		go p.work()
+	}
+	return p
+}
+
+func (p *Pool) work() {
+	defer p.workers.Done()
+	for task := range p.tasks {
+		p.queued.Dec()
+		p.busy.Inc()
+		task()
+		p.busy.Dec()
+	}
+}
+
+// Submit queues task, waiting while the queue is full. It returns ctx's error if ctx ends
+// first, and ErrClosed once the pool is closed.
+func (p *Pool) Submit(ctx context.Context, task func()) error {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	if p.closed {
+		return ErrClosed
+	}
+	p.queued.Inc()
+	select {
+	case p.tasks <- task:
+		return nil
+	case <-ctx.Done():
+		p.queued.Dec()
+		return ctx.Err()
+	}
+}
+
+// TrySubmit queues task without waiting. It returns ErrQueueFull if the queue is full, and
+// ErrClosed once the pool is closed.
+func (p *Pool) TrySubmit(task func()) error {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	if p.closed {
+		return ErrClosed
+	}
+	p.queued.Inc()
+	select {
+	case p.tasks <- task:
+		return nil
+	default:
+		p.queued.Dec()
+		p.rejected.Inc()
+		return ErrQueueFull
+	}
+}
+
+// Close stops accepting tasks and waits until the queued and running ones are done.
+// Calling it again only waits.
+func (p *Pool) Close() {
+	p.mu.Lock()
+	if !p.closed {
+		p.closed = true
+		close(p.tasks)
+	}
+	p.mu.Unlock()
+	p.workers.Wait()
+}
+
+// Group runs goroutines whose lifetimes end together, like errgroup.Group. The zero value
+// is ready to use.
+type Group struct {
+	wg      sync.WaitGroup
+	errOnce sync.Once
+	err     error
+}
+
+// Go runs f on a new goroutine.
+func (g *Group) Go(f func() error) {
+	g.wg.Add(1)
+	go func() {
+		defer g.wg.Done()
+		if err := f(); err != nil {
+			g.errOnce.Do(func() { g.err = err })
+		}
+	}()
+}
+
+// Wait waits for every goroutine started with Go and returns the first error one returned.
+func (g *Group) Wait() error {
+	g.wg.Wait()
+	return g.err
+}
@@ -0,0 +1,64 @@
+package workpool
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestPool_runsTasksOnBoundedWorkers(t *testing.T) {
+	p := New("test-bounded", 2, 8)
+	var running, peak, done atomic.Int64
+	for range 8 {
+		require.NoError(t, p.Submit(context.Background(), func() {
+			n := running.Add(1)
+			for {
+				old := peak.Load()
+				if n <= old || peak.CompareAndSwap(old, n) {
+					break
+				}
+			}
+			time.Sleep(5 * time.Millisecond)
+			running.Add(-1)
+			done.Add(1)
+		}))
+	}
+	p.Close()
+	require.EqualValues(t, 8, done.Load())
+	require.LessOrEqual(t, peak.Load(), int64(2))
+	require.ErrorIs(t, p.Submit(context.Background(), func() {}), ErrClosed)
+	require.ErrorIs(t, p.TrySubmit(func() {}), ErrClosed)
+}
+
+func TestPool_fullQueue(t *testing.T) {
+	p := New("test-full", 1, 1)
+	release := make(chan struct{})
+	started := make(chan struct{})
+	require.NoError(t, p.TrySubmit(func() { close(started); <-release }))
+	<-started
+	require.NoError(t, p.TrySubmit(func() {})) // Waits in the queue
+	require.ErrorIs(t, p.TrySubmit(func() {}), ErrQueueFull)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	require.ErrorIs(t, p.Submit(ctx, func() {}), context.DeadlineExceeded)
+	require.EqualValues(t, 1, p.queued.Value())
+
+	close(release)
+	p.Close()
+	require.Zero(t, p.queued.Value())
+	require.Zero(t, p.busy.Value())
+}
+
+func TestGroup_Wait(t *testing.T) {
+	var g Group
+	errFirst := errors.New("first")
+	g.Go(func() error { return errFirst })
+	g.Go(func() error { time.Sleep(5 * time.Millisecond); return errors.New("second") })
+	g.Go(func() error { return nil })
+	require.ErrorIs(t, g.Wait(), errFirst)
+}
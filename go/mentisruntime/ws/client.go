@@ -9,20 +9,6 @@ import (
 	"github.com/gorilla/websocket"
 )
 
-const (
-	// Time allowed to write a message to the peer.
-	writeWait = 10 * time.Second
-
-	// Time allowed to read the next pong message from the peer.
-	pongWait = 60 * time.Second
-
-	// Send pings to peer with this period. Must be less than pongWait.
-	pingPeriod = (pongWait * 9) / 10
-
-	// Maximum message size allowed from peer.
-	maxMessageSize = 512
-)
-
 var (
 	newline = []byte{ '\n' }
 	space   = []byte{ ' ' }
@@ -46,14 +32,47 @@ type Client struct {
 	conn *websocket.Conn
 
 	// Buffered channel of outbound messages.
-	send chan []byte
+	send chan outbound
 
 	// The sandbox ID this client is associated with.
 	sandboxID string
 
+	// Delivery counters reported by Hub.Stats.
+	counters clientCounters
+
+	// Sequence number up to which live messages were already replayed to a resuming client.
+	skipUpTo uint64
+
+	// Format of the JSON messages sent to the client.
+	format Format
+
+	// Observation types sent to the client; nil sends all.
+	types map[string]bool
+
+	// Close code and reason sent once the hub closes send; a normal closure if zero.
+	closeCode   int
+	closeReason string
+
+	// Closed when writePump returns.
+	written chan struct{}
+
 	logger *slog.Logger
 }
 
+// outbound is a message queued for a client.
+type outbound struct {
+	data   []byte
+	binary bool // Raw output frame; not recorded, so never skipped on resume
+}
+
+// closeShutdown closes the connection of a client the stopping hub turned away.
+func (c *Client) closeShutdown() {
+	c.logger.Info("Hub stopped, closing connection")
+	c.conn.SetWriteDeadline(time.Now().Add(c.hub.config.WriteWait))
+	_ = c.conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseGoingAway, closeReasonShutdown))
+	c.conn.Close()
+}
+
 // readPump pumps messages from the websocket connection to the hub.
 //
 // The application runs readPump in a per-connection goroutine. The application
@@ -61,15 +80,15 @@ type Client struct {
 // reads from this goroutine.
 func (c *Client) readPump() {
 	defer func() {
-		c.hub.unregister <- c
+		c.hub.remove(c)
 		c.conn.Close()
 		c.logger.Debug("readPump finished, client unregistered and connection closed")
 	}()
-	c.conn.SetReadLimit(maxMessageSize)
-	c.conn.SetReadDeadline(time.Now().Add(pongWait))
+	c.conn.SetReadLimit(c.hub.config.MaxMessageSize)
+	c.conn.SetReadDeadline(time.Now().Add(c.hub.config.PongWait))
 	c.conn.SetPongHandler(func(string) error { 
 		c.logger.Debug("Pong received")
-		c.conn.SetReadDeadline(time.Now().Add(pongWait)); 
+		c.conn.SetReadDeadline(time.Now().Add(c.hub.config.PongWait)); 
 		return nil 
 	})
 	for {
@@ -97,28 +116,48 @@ func (c *Client) readPump() {
 // application ensures that there is at most one writer to a connection by
 // executing all writes from this goroutine.
 func (c *Client) writePump() {
-	ticker := time.NewTicker(pingPeriod)
+	ticker := time.NewTicker(c.hub.config.pingPeriod())
 	defer func() {
 		ticker.Stop()
 		c.conn.Close()
+		close(c.written)
 		c.logger.Debug("writePump finished, ticker stopped and connection closed")
 	}()
 	for {
 		select {
 		case message, ok := <-c.send:
 			// Set write deadline before attempting to write
-			c.conn.SetWriteDeadline(time.Now().Add(writeWait))
+			c.conn.SetWriteDeadline(time.Now().Add(c.hub.config.WriteWait))
 			if !ok {
 				// The hub closed the channel. Send a close message.
 				c.logger.Info("Hub closed the send channel, sending close message")
 				// Best effort to send close frame, ignore error
-				_ = c.conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""))
+				code := c.closeCode
+				if code == 0 {
+					code = websocket.CloseNormalClosure
+				}
+				_ = c.conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(code, c.closeReason))
 				return // Exit goroutine
 			}
+			if !message.binary && (c.skip(message.data) || !c.wanted(message.data)) {
+				continue
+			}
+			data := message.data
+			if !message.binary {
+				var err error
+				if data, err = c.encoded(message.data); err != nil {
+					c.logger.Warn("Dropping message that cannot be encoded", "error", err)
+					continue
+				}
+			}
 
-			// Write the message as a single, distinct WebSocket text message.
+			// Write the message as a single, distinct WebSocket message: text for JSON observations, binary for raw output.
 			// Removed the loop that aggregated multiple messages into one frame.
-			err := c.conn.WriteMessage(websocket.TextMessage, message)
+			frameType := c.messageType()
+			if message.binary {
+				frameType = websocket.BinaryMessage
+			}
+			err := c.conn.WriteMessage(frameType, data)
 			if err != nil {
 				// Log error and assume connection is broken, exit goroutine.
 				// readPump will handle unregistering the client.
@@ -129,11 +168,11 @@ func (c *Client) writePump() {
 				}
 				return // Exit goroutine
 			}
-			c.logger.Debug("Message sent to client", "messageSize", len(message))
+			c.logger.Debug("Message sent to client", "messageSize", len(data))
 
 		case <-ticker.C:
 			// Send ping message
-			c.conn.SetWriteDeadline(time.Now().Add(writeWait))
+			c.conn.SetWriteDeadline(time.Now().Add(c.hub.config.WriteWait))
 			if err := c.conn.WriteMessage(websocket.PingMessage, nil); err != nil {
 				// Log error and assume connection is broken, exit goroutine.
 				// readPump will handle unregistering the client.
@@ -0,0 +1,66 @@
+package ws
+
+import (
+	"fmt"
+	"time"
+)
+
+// Config tunes WebSocket connections. Zero fields take the defaults of DefaultConfig.
+type Config struct {
+	WriteWait      time.Duration // Time allowed to write a message to the peer
+	PongWait       time.Duration // Time allowed to read the next pong; pings are sent at 90% of it
+	SendBuffer     int           // Messages queued per client before new ones are dropped
+	MaxMessageSize int64         // Largest message accepted from the peer
+	Compression    bool          // Offer permessage-deflate; used with clients that accept it
+}
+
+// DefaultConfig returns the settings used when none are configured.
+func DefaultConfig() Config {
+	return Config{
+		WriteWait:      10 * time.Second,
+		PongWait:       60 * time.Second,
+		SendBuffer:     256,
+		MaxMessageSize: 512,
+	}
+}
+
+// withDefaults fills zero fields from DefaultConfig.
+func (c Config) withDefaults() Config {
+	def := DefaultConfig()
+	if c.WriteWait <= 0 {
+		c.WriteWait = def.WriteWait
+	}
+	if c.PongWait <= 0 {
+		c.PongWait = def.PongWait
+	}
+	if c.SendBuffer <= 0 {
+		c.SendBuffer = def.SendBuffer
+	}
+	if c.MaxMessageSize <= 0 {
+		c.MaxMessageSize = def.MaxMessageSize
+	}
+	return c
+}
+
+// Validate rejects negative settings.
+func (c Config) Validate() error {
+	if c.WriteWait < 0 || c.PongWait < 0 || c.SendBuffer < 0 || c.MaxMessageSize < 0 {
+		return fmt.Errorf("websocket settings must not be negative")
+	}
+	return nil
+}
+
+// pingPeriod is how often pings are sent. It must be less than PongWait.
+func (c Config) pingPeriod() time.Duration {
+	return c.PongWait * 9 / 10
+}
+
+// Option configures a Hub.
+type Option func(*Hub)
+
+// WithConfig sets the connection settings of a Hub.
+func WithConfig(cfg Config) Option {
+	return func(h *Hub) {
+		h.config = cfg.withDefaults()
+	}
+}
@@ -0,0 +1,108 @@
+package ws
+
+import (
+	"encoding/json"
+
+	"github.com/gorilla/websocket"
+)
+
+// Encoder converts a JSON message of a stream into the format a client asked for. Raw
+// output frames are sent unchanged.
+type Encoder func(message []byte) ([]byte, error)
+
+// Format is a message format clients can ask for by offering its WebSocket subprotocol,
+// such as "observations.v1.json".
+type Format struct {
+	Subprotocol string
+	Encode      Encoder // Nil sends messages as recorded
+	Binary      bool    // Send encoded messages in binary frames, such as MessagePack
+}
+
+// streamConfig is the configuration of a stream connection.
+type streamConfig struct {
+	encode  Encoder
+	formats []Format
+	types   map[string]bool
+}
+
+// StreamOption configures a stream connection.
+type StreamOption func(*streamConfig)
+
+// WithEncoder sends the JSON messages of a stream, replayed ones included, through encode
+// unless the client negotiates a format. Messages it fails to encode are dropped.
+func WithEncoder(encode Encoder) StreamOption {
+	return func(c *streamConfig) {
+		c.encode = encode
+	}
+}
+
+// WithFormats offers formats as subprotocols, most preferred first. Clients offering none
+// of them get the default format; clients offering only others are refused.
+func WithFormats(formats ...Format) StreamOption {
+	return func(c *streamConfig) {
+		c.formats = append(c.formats, formats...)
+	}
+}
+
+// WithTypes sends only the messages of a stream with one of the given observation types,
+// replayed ones included. Raw output frames and "gap" observations are always sent.
+func WithTypes(types ...string) StreamOption {
+	return func(c *streamConfig) {
+		if c.types == nil {
+			c.types = make(map[string]bool, len(types))
+		}
+		for _, t := range types {
+			c.types[t] = true
+		}
+	}
+}
+
+// subprotocols returns the subprotocols of the formats.
+func (c *streamConfig) subprotocols() []string {
+	names := make([]string, len(c.formats))
+	for i, f := range c.formats {
+		names[i] = f.Subprotocol
+	}
+	return names
+}
+
+// format returns the negotiated format, or the default one.
+func (c *streamConfig) format(subprotocol string) Format {
+	for _, f := range c.formats {
+		if f.Subprotocol == subprotocol {
+			return f
+		}
+	}
+	return Format{Encode: c.encode}
+}
+
+// messageType returns the frame type of the messages the client receives, other than raw
+// output frames.
+func (c *Client) messageType() int {
+	if c.format.Binary {
+		return websocket.BinaryMessage
+	}
+	return websocket.TextMessage
+}
+
+// encoded returns a JSON message as the client receives it.
+func (c *Client) encoded(message []byte) ([]byte, error) {
+	if c.format.Encode == nil {
+		return message, nil
+	}
+	return c.format.Encode(message)
+}
+
+// wanted reports whether a JSON message has one of the types the client asked for.
+func (c *Client) wanted(message []byte) bool {
+	if c.types == nil {
+		return true
+	}
+	var meta struct {
+		ObservationType string `json:"observation_type"`
+	}
+	if json.Unmarshal(message, &meta) != nil {
+		return false
+	}
+	return c.types[meta.ObservationType]
+}
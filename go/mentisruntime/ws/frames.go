@@ -0,0 +1,52 @@
+package ws
+
+import "errors"
+
+// Binary frames carry raw action output, relayed as the agent streams it instead of one
+// JSON observation per line. Text frames are always JSON observations. An output frame is:
+//
+//	byte 0         FrameOutput
+//	byte 1         StreamStdout or StreamStderr
+//	byte 2         length n of the action ID
+//	bytes 3..3+n   the action ID
+//	rest           the output bytes
+const (
+	FrameOutput  byte = 1
+	StreamStdout byte = 1
+	StreamStderr byte = 2
+)
+
+// MaxFrameActionID is the longest action ID an output frame can carry.
+const MaxFrameActionID = 255
+
+var ErrInvalidFrame = errors.New("invalid binary frame")
+
+// StreamCode returns the frame code of a stream name.
+func StreamCode(name string) (byte, bool) {
+	switch name {
+	case "stdout":
+		return StreamStdout, true
+	case "stderr":
+		return StreamStderr, true
+	}
+	return 0, false
+}
+
+// AppendOutputHeader appends the header of an output frame to dst. actionID must not be
+// longer than MaxFrameActionID.
+func AppendOutputHeader(dst []byte, actionID string, stream byte) []byte {
+	dst = append(dst, FrameOutput, stream, byte(len(actionID)))
+	return append(dst, actionID...)
+}
+
+// ParseOutputFrame splits an output frame into its action ID, stream code and output.
+func ParseOutputFrame(frame []byte) (actionID string, stream byte, output []byte, err error) {
+	if len(frame) < 3 || frame[0] != FrameOutput {
+		return "", 0, nil, ErrInvalidFrame
+	}
+	end := 3 + int(frame[2])
+	if len(frame) < end {
+		return "", 0, nil, ErrInvalidFrame
+	}
+	return string(frame[3:end]), frame[1], frame[end:], nil
+}
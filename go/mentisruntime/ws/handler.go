@@ -3,8 +3,10 @@ package ws
 import (
 	"log/slog"
 	"net/http"
+	"strconv"
 
 	"github.com/gorilla/mux"
+	"github.com/gorilla/websocket"
 	// No longer import manager directly
 	// "github.com/foreveryh/sandboxai/go/mentisruntime/manager"
 )
@@ -13,7 +15,7 @@ import (
 // It upgrades the HTTP connection, creates a client, registers it with the hub,
 // and starts the read/write pumps.
 // It now accepts a SandboxChecker interface instead of a concrete manager.
-func ServeWs(hub *Hub, checker SandboxChecker, w http.ResponseWriter, r *http.Request, logger *slog.Logger) {
+func ServeWs(hub *Hub, checker SandboxChecker, resumer Resumer, w http.ResponseWriter, r *http.Request, logger *slog.Logger, opts ...StreamOption) {
 	vars := mux.Vars(r)
 	sandboxID, ok := vars["sandboxID"]
 	if !ok {
@@ -35,7 +37,39 @@ func ServeWs(hub *Hub, checker SandboxChecker, w http.ResponseWriter, r *http.Re
 		return
 	}
 
-	conn, err := upgrader.Upgrade(w, r, nil) // upgrader is defined in client.go
+	ServeStream(hub, resumer, sandboxID, w, r, logger, opts...)
+}
+
+// ServeStream upgrades the connection and subscribes it to the observations broadcast under
+// streamID. Callers check that the stream exists; ServeWs does so for sandboxes.
+// A client reconnecting with ?cursor=<seq> first receives the messages recorded after seq
+// from resumer, or a "gap" observation for those no longer recorded.
+// Headers set on w by middleware, such as deprecation notices, are sent with the upgrade
+// response. Clients choose among the formats of WithFormats with the Sec-WebSocket-Protocol
+// header.
+func ServeStream(hub *Hub, resumer Resumer, streamID string, w http.ResponseWriter, r *http.Request, logger *slog.Logger, opts ...StreamOption) {
+	sandboxID := streamID
+	var cursor uint64
+	resuming := r.URL.Query().Has("cursor")
+	if resuming {
+		var err error
+		if cursor, err = strconv.ParseUint(r.URL.Query().Get("cursor"), 10, 64); err != nil {
+			http.Error(w, "Invalid cursor", http.StatusBadRequest)
+			return
+		}
+	}
+	var cfg streamConfig
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+	if offered := websocket.Subprotocols(r); len(offered) > 0 && len(cfg.formats) > 0 && !supportsAny(cfg.formats, offered) {
+		http.Error(w, "Unsupported subprotocol", http.StatusBadRequest)
+		return
+	}
+	up := upgrader // upgrader is defined in client.go
+	up.EnableCompression = hub.config.Compression
+	up.Subprotocols = cfg.subprotocols()
+	conn, err := up.Upgrade(w, r, w.Header())
 	if err != nil {
 		logger.Error("Failed to upgrade WebSocket connection", "error", err, "sandboxID", sandboxID)
 		// Upgrade automatically sends an error response, so no need for http.Error here.
@@ -46,18 +80,41 @@ func ServeWs(hub *Hub, checker SandboxChecker, w http.ResponseWriter, r *http.Re
 	client := &Client{
 		hub:       hub,
 		conn:      conn,
-		send:      make(chan []byte, 256), // Buffered channel
+		send:      make(chan outbound, hub.config.SendBuffer), // Buffered channel
 		sandboxID: sandboxID,
+		format:    cfg.format(conn.Subprotocol()),
+		types:     cfg.types,
+		written:   make(chan struct{}),
 		logger:    clientLogger,
 	}
 
-	client.logger.Info("WebSocket client connection established")
+	client.logger.Info("WebSocket client connection established", "resuming", resuming, "subprotocol", conn.Subprotocol())
+
+	if resuming && resumer != nil {
+		go client.resume(resumer, cursor)
+		return
+	}
 
 	// Allow registration of the client to the hub.
-	client.hub.register <- client
+	if !client.hub.add(client) {
+		client.closeShutdown()
+		return
+	}
 
 	// Allow collection of memory referenced by the caller by doing all work in
 	// new goroutines.
 	go client.writePump()
 	go client.readPump()
-}
\ No newline at end of file
+}
+
+// supportsAny reports whether one of the offered subprotocols is that of a format.
+func supportsAny(formats []Format, offered []string) bool {
+	for _, f := range formats {
+		for _, name := range offered {
+			if name == f.Subprotocol {
+				return true
+			}
+		}
+	}
+	return false
+}
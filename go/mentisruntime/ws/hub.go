@@ -1,11 +1,22 @@
 package ws
 
 import (
+	"context"
+	"errors"
 	"log/slog"
 	"strings"
 	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
 )
 
+// ErrHubStopped is returned by Ping once Run has stopped.
+var ErrHubStopped = errors.New("websocket hub stopped")
+
+// closeReasonShutdown is the reason of the close frame clients receive when the hub stops.
+const closeReasonShutdown = "server shutting down"
+
 // Hub maintains the set of active clients and broadcasts messages to the
 // clients associated with specific sandboxes.
 type Hub struct {
@@ -23,6 +34,9 @@ type Hub struct {
 	// Unregister requests from clients.
 	unregister chan *Client
 
+	// Liveness probes; Run closes each channel it receives.
+	ping chan chan struct{}
+
 	// Map of sandbox IDs to the set of clients subscribed to that sandbox.
 	sandboxSubscriptions map[string]map[*Client]bool
 
@@ -30,30 +44,51 @@ type Hub struct {
 	mu sync.RWMutex
 
 	logger *slog.Logger
+
+	// Connection settings for clients.
+	config Config
+
+	// Closed when Run starts stopping; clients and messages arriving later are turned away.
+	done chan struct{}
 }
 
 // BroadcastMessage encapsulates a message intended for a specific sandbox.
 type BroadcastMessage struct {
 	SandboxID string
 	Message   []byte
+	Binary    bool // Message is a binary output frame (see AppendOutputHeader)
 }
 
-func NewHub(logger *slog.Logger) *Hub {
-	return &Hub{
+func NewHub(logger *slog.Logger, opts ...Option) *Hub {
+	h := &Hub{
 		// Increase buffer size, e.g., to 256 (adjust if needed)
 		broadcast:            make(chan *BroadcastMessage, 256), // <--- 修改这里
 		register:             make(chan *Client),
 		unregister:           make(chan *Client),
+		ping:                 make(chan chan struct{}),
 		clients:              make(map[*Client]bool),
 		sandboxSubscriptions: make(map[string]map[*Client]bool),
 		logger:               logger.With("component", "websocket-hub"),
+		config:               DefaultConfig(),
+		done:                 make(chan struct{}),
+	}
+	for _, opt := range opts {
+		opt(h)
 	}
+	return h
 }
 
-func (h *Hub) Run() {
+// Run registers clients and broadcasts messages until ctx is done. It then delivers the
+// messages still queued, closes every client with a close frame once its queued messages
+// are written, and returns when they are, or after the write timeout.
+func (h *Hub) Run(ctx context.Context) {
 	h.logger.Info("WebSocket Hub started")
 	for {
 		select {
+		case <-ctx.Done():
+			h.shutdown()
+			return
+
 		case client := <-h.register:
 			h.mu.Lock()
 			h.clients[client] = true
@@ -62,6 +97,7 @@ func (h *Hub) Run() {
 			}
 			h.sandboxSubscriptions[client.sandboxID][client] = true
 			h.mu.Unlock()
+			connectedClients.Inc()
 			h.logger.Debug("Client registered", "sandboxID", client.sandboxID, "remoteAddr", client.conn.RemoteAddr().String())
 
 		case client := <-h.unregister:
@@ -69,6 +105,7 @@ func (h *Hub) Run() {
 			if _, ok := h.clients[client]; ok {
 				delete(h.clients, client)
 				close(client.send) // Close the send channel when unregistering
+				connectedClients.Dec()
 				if subs, ok := h.sandboxSubscriptions[client.sandboxID]; ok {
 					delete(subs, client)
 					if len(subs) == 0 {
@@ -79,44 +116,154 @@ func (h *Hub) Run() {
 			}
 			h.mu.Unlock()
 
+		case reply := <-h.ping:
+			close(reply)
+
 		case broadcastMsg := <-h.broadcast:
-			h.mu.RLock()
-			subscribers, ok := h.sandboxSubscriptions[broadcastMsg.SandboxID]
-			if ok {
-				h.logger.Debug("Broadcasting message", "sandboxID", broadcastMsg.SandboxID, "numSubscribers", len(subscribers), "messageSize", len(broadcastMsg.Message))
-				for client := range subscribers {
-					select {
-					case client.send <- broadcastMsg.Message:
-					default:
-						// Prevent blocking if the client's send buffer is full
-						h.logger.Warn("Client send channel full, closing client", "sandboxID", client.sandboxID, "remoteAddr", client.conn.RemoteAddr().String())
-						// Closing the client here might be too aggressive, consider alternative strategies
-						// For now, we'll rely on the writePump detecting the closed channel
-						// close(client.send)
-						// delete(h.clients, client)
-						// delete(subscribers, client)
-					}
-				}
-			} else {
-				h.logger.Debug("No subscribers for sandbox, discarding message", "sandboxID", broadcastMsg.SandboxID)
+			broadcastQueueDepth.Set(int64(len(h.broadcast)))
+			h.deliver(broadcastMsg)
+		}
+	}
+}
+
+// deliver queues a broadcast message for the clients of its sandbox.
+func (h *Hub) deliver(broadcastMsg *BroadcastMessage) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	subscribers, ok := h.sandboxSubscriptions[broadcastMsg.SandboxID]
+	if !ok {
+		h.logger.Debug("No subscribers for sandbox, discarding message", "sandboxID", broadcastMsg.SandboxID)
+		return
+	}
+	h.logger.Debug("Broadcasting message", "sandboxID", broadcastMsg.SandboxID, "numSubscribers", len(subscribers), "messageSize", len(broadcastMsg.Message))
+	for client := range subscribers {
+		select {
+		case client.send <- outbound{data: broadcastMsg.Message, binary: broadcastMsg.Binary}:
+		default:
+			// Prevent blocking if the client's send buffer is full
+			recordClientDrop(client)
+			h.logger.Warn("Client send channel full, discarding message", "sandboxID", client.sandboxID, "remoteAddr", client.conn.RemoteAddr().String())
+			// Closing the client here might be too aggressive, consider alternative strategies
+			// For now, we'll rely on the writePump detecting the closed channel
+			// close(client.send)
+			// delete(h.clients, client)
+			// delete(subscribers, client)
+		}
+	}
+}
+
+// shutdown turns away new clients and messages, delivers the queued messages, and closes
+// the clients, waiting for their write pumps to send what they hold and the close frame.
+func (h *Hub) shutdown() {
+	close(h.done)
+	drained := 0
+	for pending := true; pending; {
+		select {
+		case broadcastMsg := <-h.broadcast:
+			h.deliver(broadcastMsg)
+			drained++
+		default:
+			pending = false
+		}
+	}
+	broadcastQueueDepth.Set(0)
+
+	h.mu.Lock()
+	clients := make([]*Client, 0, len(h.clients))
+	for client := range h.clients {
+		client.closeCode, client.closeReason = websocket.CloseGoingAway, closeReasonShutdown
+		close(client.send)
+		clients = append(clients, client)
+		connectedClients.Dec()
+	}
+	h.clients = make(map[*Client]bool)
+	h.sandboxSubscriptions = make(map[string]map[*Client]bool)
+	h.mu.Unlock()
+
+	timer := time.NewTimer(h.config.WriteWait)
+	defer timer.Stop()
+	flushed := 0
+	for _, client := range clients {
+		select {
+		case <-client.written:
+			flushed++
+		case <-timer.C:
+			h.logger.Warn("Timed out flushing WebSocket clients, closing the rest", "clients", len(clients), "flushed", flushed)
+			for _, c := range clients {
+				c.conn.Close()
 			}
-			h.mu.RUnlock()
+			return
 		}
 	}
+	h.logger.Info("WebSocket Hub stopped", "clients", len(clients), "drainedMessages", drained)
+}
+
+// add registers a client, or returns false once the hub is stopping.
+func (h *Hub) add(client *Client) bool {
+	select {
+	case h.register <- client:
+		return true
+	case <-h.done:
+		return false
+	}
+}
+
+// remove unregisters a client. Once the hub is stopping, it has already closed its clients.
+func (h *Hub) remove(client *Client) {
+	select {
+	case h.unregister <- client:
+	case <-h.done:
+	}
+}
+
+// Ping verifies that the Run loop is still processing events.
+func (h *Hub) Ping(ctx context.Context) error {
+	reply := make(chan struct{})
+	select {
+	case h.ping <- reply:
+	case <-h.done:
+		return ErrHubStopped
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	select {
+	case <-reply:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
 }
 
 // SubmitBroadcast sends a message to the hub for broadcasting to relevant clients.
 // This method is intended to be called by the SandboxManager or other components.
 func (h *Hub) SubmitBroadcast(sandboxID string, message []byte) {
-	broadcastMsg := &BroadcastMessage{
+	h.submit(&BroadcastMessage{
 		SandboxID: sandboxID,
 		Message:   message,
+	})
+}
+
+// SubmitBinary queues a binary output frame for the clients of a sandbox. The frame is sent
+// as it is, so it must not be modified afterwards.
+func (h *Hub) SubmitBinary(sandboxID string, frame []byte) {
+	h.submit(&BroadcastMessage{SandboxID: sandboxID, Message: frame, Binary: true})
+}
+
+func (h *Hub) submit(broadcastMsg *BroadcastMessage) {
+	sandboxID, message := broadcastMsg.SandboxID, broadcastMsg.Message
+	select {
+	case <-h.done:
+		messagesDropped.With(DropHubStopped).Inc()
+		h.logger.Debug("Hub stopped, discarding message", "sandboxID", sandboxID)
+		return
+	default:
 	}
 	select {
 	case h.broadcast <- broadcastMsg:
 		h.logger.Debug("Submitted message to broadcast channel", "sandboxID", sandboxID, "messageSize", len(message))
 	default:
 		// Hub's broadcast channel is full, might indicate a bottleneck or dead hub.
+		messagesDropped.With(DropHubFull).Inc()
 		h.logger.Error("Hub broadcast channel full, discarding message", "sandboxID", sandboxID)
 	}
 }
@@ -159,18 +306,20 @@ func (h *Hub) BroadcastToSandbox(sandboxID string, message []byte) {
 		h.logger.Debug("Attempting to send to client", "clientAddr", client.conn.RemoteAddr().String())
 		// *** END ADDED DIAGNOSTIC LOGGING ***
 		select {
-		case client.send <- message:
+		case client.send <- outbound{data: message}:
 			// *** ADDED DIAGNOSTIC LOGGING ***
 			h.logger.Debug("Successfully submitted to client channel", "clientAddr", client.conn.RemoteAddr().String())
 			// *** END ADDED DIAGNOSTIC LOGGING ***
 		default:
 			// If the send channel is full, assume the client is slow or disconnected.
 			// Close the client connection and remove it.
+			recordClientDrop(client)
+			backpressureDisconnects.Inc()
 			h.logger.Warn("Client send channel full, closing connection", "sandboxID", sandboxID, "clientAddr", client.conn.RemoteAddr().String())
 			// Need to run unregister in a goroutine or handle locking carefully
 			// to avoid deadlock if unregister tries to lock the hub.
 			go func(c *Client) {
-				h.unregister <- c // Send to unregister channel
+				h.remove(c) // Send to unregister channel
 				// close(c.send) // Closing channel here might cause panic if writePump tries to read after close
 			}(client)
 		}
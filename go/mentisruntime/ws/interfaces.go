@@ -9,6 +9,7 @@ import (
 // if a sandbox exists.
 // This helps break the import cycle between ws and manager.
 type SandboxChecker interface {
-	// SandboxExists checks if a sandbox with the given ID exists.
+	// SandboxExists checks if a sandbox with the given ID exists and may be streamed
+	// with ctx, which carries the tenant of the request, if any.
 	SandboxExists(ctx context.Context, sandboxID string) (bool, error)
 }
\ No newline at end of file
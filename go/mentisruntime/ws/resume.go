@@ -0,0 +1,127 @@
+package ws
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// resumePageSize is the number of recorded messages fetched at a time while resuming.
+const resumePageSize = 1000
+
+// RecordedMessage is a message of a stream as recorded, with its sequence number.
+type RecordedMessage struct {
+	Seq     uint64
+	Message []byte
+}
+
+// Resumer gives clients that reconnect with a cursor the messages they missed.
+type Resumer interface {
+	// MessagesAfter returns up to limit messages of a stream recorded after seq, oldest first.
+	MessagesAfter(streamID string, seq uint64, limit int) ([]RecordedMessage, error)
+}
+
+// GapObservationData is sent to a resuming client when messages after its cursor are no
+// longer recorded. ToSeq is zero when the extent of the gap is unknown.
+type GapObservationData struct {
+	FromSeq uint64 `json:"from_seq"`
+	ToSeq   uint64 `json:"to_seq,omitempty"`
+}
+
+// replay writes the messages recorded after cursor to the connection, page by page, and
+// returns the sequence number of the last one written (cursor if none).
+func (c *Client) replay(resumer Resumer, cursor uint64) (uint64, error) {
+	for {
+		messages, err := resumer.MessagesAfter(c.sandboxID, cursor, resumePageSize)
+		if err != nil {
+			c.logger.Warn("Cannot replay missed messages", "cursor", cursor, "error", err)
+			return cursor, c.writeGap(GapObservationData{FromSeq: cursor + 1})
+		}
+		if len(messages) == 0 {
+			return cursor, nil
+		}
+		if first := messages[0].Seq; first > cursor+1 {
+			if err := c.writeGap(GapObservationData{FromSeq: cursor + 1, ToSeq: first - 1}); err != nil {
+				return cursor, err
+			}
+		}
+		for _, msg := range messages {
+			if c.wanted(msg.Message) {
+				if err := c.write(msg.Message); err != nil {
+					return cursor, err
+				}
+			}
+			cursor = msg.Seq
+		}
+		if len(messages) < resumePageSize {
+			return cursor, nil
+		}
+	}
+}
+
+// resume replays the messages a reconnecting client missed, then subscribes it. Messages
+// recorded while subscribing may arrive both ways, so live messages up to the last replayed
+// sequence number are skipped by writePump.
+func (c *Client) resume(resumer Resumer, cursor uint64) {
+	// Replay the bulk before subscribing so live messages do not pile up meanwhile.
+	cursor, err := c.replay(resumer, cursor)
+	if err != nil {
+		c.logger.Info("Failed to replay missed messages", "error", err)
+		c.conn.Close()
+		return
+	}
+	if !c.hub.add(c) {
+		c.closeShutdown()
+		return
+	}
+	if cursor, err = c.replay(resumer, cursor); err != nil {
+		c.logger.Info("Failed to replay missed messages", "error", err)
+		c.hub.remove(c)
+		c.conn.Close()
+		close(c.written) // No writePump will run
+		return
+	}
+	c.skipUpTo = cursor
+	go c.writePump()
+	go c.readPump()
+}
+
+// skip reports whether a live message was already replayed. Once a newer message arrives,
+// no further messages are checked.
+func (c *Client) skip(message []byte) bool {
+	if c.skipUpTo == 0 {
+		return false
+	}
+	var meta struct {
+		Seq uint64 `json:"seq"`
+	}
+	if json.Unmarshal(message, &meta) != nil || meta.Seq == 0 {
+		return false
+	}
+	if meta.Seq <= c.skipUpTo {
+		return true
+	}
+	c.skipUpTo = 0
+	return false
+}
+
+func (c *Client) writeGap(gap GapObservationData) error {
+	message, err := json.Marshal(struct {
+		ObservationType string             `json:"observation_type"`
+		Timestamp       string             `json:"timestamp"`
+		Data            GapObservationData `json:"data"`
+	}{"gap", time.Now().UTC().Format(time.RFC3339Nano), gap})
+	if err != nil {
+		return err
+	}
+	return c.write(message)
+}
+
+func (c *Client) write(message []byte) error {
+	message, err := c.encoded(message)
+	if err != nil {
+		c.logger.Warn("Dropping message that cannot be encoded", "error", err)
+		return nil
+	}
+	c.conn.SetWriteDeadline(time.Now().Add(c.hub.config.WriteWait))
+	return c.conn.WriteMessage(c.messageType(), message)
+}
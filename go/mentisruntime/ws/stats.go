@@ -0,0 +1,88 @@
+package ws
+
+import (
+	"sort"
+	"sync/atomic"
+
+	"github.com/foreveryh/sandboxai/go/mentisruntime/metrics"
+)
+
+// Drop reasons reported in sandboxai_ws_messages_dropped_total.
+const (
+	DropHubFull    = "hub_full"    // The hub's inbound broadcast channel was full
+	DropClientFull = "client_full" // A client's send channel was full
+	DropHubStopped = "hub_stopped" // The hub had stopped
+)
+
+var (
+	messagesDropped = metrics.Default.NewCounterVec("sandboxai_ws_messages_dropped_total",
+		"Observation messages discarded before reaching WebSocket clients, by reason.", "reason")
+	backpressureDisconnects = metrics.Default.NewCounter("sandboxai_ws_backpressure_disconnects_total",
+		"WebSocket clients disconnected because they could not keep up.")
+	connectedClients = metrics.Default.NewGauge("sandboxai_ws_clients",
+		"Connected WebSocket clients.")
+	broadcastQueueDepth = metrics.Default.NewGauge("sandboxai_ws_broadcast_queue_depth",
+		"Messages waiting in the hub's inbound broadcast channel, sampled as the hub takes one.")
+)
+
+// clientCounters are the delivery counters of one client.
+type clientCounters struct {
+	dropped atomic.Int64
+}
+
+// ClientStats describes a connected client.
+type ClientStats struct {
+	SandboxID  string `json:"sandbox_id"`
+	RemoteAddr string `json:"remote_addr"`
+	Queued     int    `json:"queued"`   // Messages waiting in its send channel
+	Capacity   int    `json:"capacity"` // Size of its send channel
+	Dropped    int64  `json:"dropped"`  // Messages not delivered because the channel was full
+}
+
+// HubStats is a snapshot of the hub's delivery health.
+type HubStats struct {
+	Clients                 int           `json:"clients"`
+	Streams                 int           `json:"streams"` // Sandboxes and builds with at least one client
+	BroadcastQueued         int           `json:"broadcast_queued"`
+	BroadcastCapacity       int           `json:"broadcast_capacity"`
+	DroppedHubFull          int64         `json:"dropped_hub_full"`
+	DroppedClientFull       int64         `json:"dropped_client_full"`
+	BackpressureDisconnects int64         `json:"backpressure_disconnects"`
+	ClientDetails           []ClientStats `json:"client_details"` // Most dropped first
+}
+
+// Stats returns a snapshot of the hub's clients and drop counters. The counters are totals
+// since the process started.
+func (h *Hub) Stats() HubStats {
+	h.mu.RLock()
+	stats := HubStats{
+		Clients:                 len(h.clients),
+		Streams:                 len(h.sandboxSubscriptions),
+		BroadcastQueued:         len(h.broadcast),
+		BroadcastCapacity:       cap(h.broadcast),
+		DroppedHubFull:          messagesDropped.With(DropHubFull).Value(),
+		DroppedClientFull:       messagesDropped.With(DropClientFull).Value(),
+		BackpressureDisconnects: backpressureDisconnects.Value(),
+		ClientDetails:           make([]ClientStats, 0, len(h.clients)),
+	}
+	for c := range h.clients {
+		stats.ClientDetails = append(stats.ClientDetails, ClientStats{
+			SandboxID:  c.sandboxID,
+			RemoteAddr: c.conn.RemoteAddr().String(),
+			Queued:     len(c.send),
+			Capacity:   cap(c.send),
+			Dropped:    c.counters.dropped.Load(),
+		})
+	}
+	h.mu.RUnlock()
+	sort.Slice(stats.ClientDetails, func(i, j int) bool {
+		return stats.ClientDetails[i].Dropped > stats.ClientDetails[j].Dropped
+	})
+	return stats
+}
+
+// recordClientDrop counts a message a client's full send channel could not take.
+func recordClientDrop(c *Client) {
+	messagesDropped.With(DropClientFull).Inc()
+	c.counters.dropped.Add(1)
+}
@@ -11,7 +11,7 @@ __version__ = "0.1.0"
 # 导出核心组件
 from .client import MentisSandbox
 from .exceptions import MentisSandboxError, ConnectionError, APIError, WebSocketError
-from .models import BaseObservation, parse_observation
+from .models import BaseObservation, DisplayDataObservation, OutputChunkObservation, parse_observation, parse_output_frame
 
 # 导出API模型
 from .api import (
@@ -22,6 +22,7 @@ from .api import (
     CreateSandboxRequest,
     Sandbox,
     Space,
+    SpaceVolume,
     CreateSpaceRequest,
     UpdateSpaceRequest,
 )
@@ -46,7 +47,10 @@ __all__ = [
     "APIError",
     "WebSocketError",
     "BaseObservation",
+    "DisplayDataObservation",
+    "OutputChunkObservation",
     "parse_observation",
+    "parse_output_frame",
     
     # API模型
     "SandboxSpec",
@@ -56,6 +60,7 @@ __all__ = [
     "CreateSandboxRequest",
     "Sandbox",
     "Space",
+    "SpaceVolume",
     "CreateSpaceRequest",
     "UpdateSpaceRequest",
     
@@ -65,13 +65,21 @@ class RunIPythonCellRequest(BaseModel):
         description="Execution timeout in seconds",
         ge=1
     )
+    cwd: Optional[str] = Field(
+        None,
+        description="Absolute working directory for this action only"
+    )
     work_dir: Optional[str] = Field(
         None,
-        description="Working directory for execution"
+        description="Deprecated alias of cwd"
     )
     env: Optional[Dict[str, str]] = Field(
         None,
-        description="Execution environment variables"
+        description="Environment variables set for this action only, on top of the sandbox's"
+    )
+    kernel_id: Optional[str] = Field(
+        None,
+        description="Named kernel to run the cell in, created with POST .../kernels; the default kernel if unset"
     )
     # --- Added Fields ---
     action_id: Optional[str] = Field(
@@ -92,18 +100,34 @@ class RunShellCommandRequest(BaseModel):
         description="Command to execute",
         min_length=1
     )
+    shell: Optional[str] = Field(
+        None,
+        description="Shell to run the command with: bash, sh or zsh (powershell, pwsh or cmd in Windows containers); defaults to /bin/sh"
+    )
+    login: Optional[bool] = Field(
+        False,
+        description="Run a login shell, which sources the profiles that set up PATH"
+    )
     timeout: Optional[int] = Field(
         None,
         description="Execution timeout in seconds",
         ge=1
     )
+    cwd: Optional[str] = Field(
+        None,
+        description="Absolute working directory for this action only"
+    )
     work_dir: Optional[str] = Field(
         None,
-        description="Working directory for execution"
+        description="Deprecated alias of cwd"
     )
     env: Optional[Dict[str, str]] = Field(
         None,
-        description="Execution environment variables"
+        description="Environment variables set for this action only, on top of the sandbox's"
+    )
+    user: Optional[str] = Field(
+        None,
+        description="User to run this command as: a name or uid, optionally followed by :group or :gid; the sandbox's security profile decides which are allowed"
     )
     # --- Added Fields ---
     action_id: Optional[str] = Field(
@@ -114,6 +138,10 @@ class RunShellCommandRequest(BaseModel):
         False,
         description="Whether to split stdout and stderr in observations/results (Currently ignored by executor)"
     )
+    large_output: Optional[bool] = Field(
+        False,
+        description="Stream raw output chunks while the command runs instead of line observations after it ends"
+    )
     # --- End Added Fields ---
 
 
@@ -225,6 +253,12 @@ class Space(BaseModel):
     )
 
 
+class SpaceVolume(BaseModel):
+    """An existing Docker volume mounted read-only into every sandbox of a space"""
+    volume: str = Field(..., description="Name of the Docker volume")
+    path: str = Field(..., description="Absolute path it is mounted at in sandboxes")
+
+
 class CreateSpaceRequest(BaseModel):
     """Request model for creating a space"""
     name: str = Field(
@@ -242,6 +276,14 @@ class CreateSpaceRequest(BaseModel):
         None,
         description="Space metadata"
     )
+    isolated: Optional[bool] = Field(
+        None,
+        description="Keep the space's sandboxes off its shared network"
+    )
+    volumes: Optional[List[SpaceVolume]] = Field(
+        None,
+        description="Shared volumes mounted read-only into the space's sandboxes"
+    )
 
 
 class UpdateSpaceRequest(BaseModel):
@@ -253,4 +295,12 @@ class UpdateSpaceRequest(BaseModel):
     metadata: Optional[Dict[str, Any]] = Field(
         None,
         description="New metadata for the space"
+    )
+    isolated: Optional[bool] = Field(
+        None,
+        description="Keep sandboxes created from now on off the space's shared network"
+    )
+    volumes: Optional[List[SpaceVolume]] = Field(
+        None,
+        description="Replace the shared volumes mounted into sandboxes created from now on"
     )
\ No newline at end of file
@@ -16,6 +16,7 @@ from .exceptions import MentisSandboxError, ConnectionError, APIError, WebSocket
 from .models import (
     BaseObservation, 
     parse_observation, # Make sure parse_observation is exported from models.py
+    parse_output_frame,
     IPythonOutputObservationPart, 
     IPythonResultObservation, 
     ErrorObservation, 
@@ -34,6 +35,7 @@ DEFAULT_RECONNECT_DELAY = 1.0 # Initial delay before attempting WebSocket reconn
 DEFAULT_MAX_RECONNECT_DELAY = 60.0 # Maximum delay between reconnect attempts
 DEFAULT_API_TIMEOUT = 30.0 # Default timeout for standard API calls
 DEFAULT_CREATE_API_TIMEOUT = 60.0 # Default timeout for the create call
+STREAM_SUBPROTOCOL = "observations.v1.json" # WebSocket message format the client parses
 
 class MentisSandbox:
     """
@@ -126,6 +128,7 @@ class MentisSandbox:
         self._listener_thread: Optional[threading.Thread] = None
         self._stop_event = threading.Event()
         self._is_connected = threading.Event() # To signal successful connection
+        self._last_seq: Optional[int] = None # Last stream sequence number received, for resuming
 
     @classmethod
     def create(
@@ -134,6 +137,7 @@ class MentisSandbox:
         settings: Optional[Dict[str, Any]] = None,
         base_url: str = DEFAULT_BASE_URL,
         api_timeout: float = DEFAULT_CREATE_API_TIMEOUT, # Use specific timeout for creation
+        wait: bool = True,
         **kwargs # Pass other init args like callbacks/queue/ws_config
     ) -> 'MentisSandbox':
         """
@@ -144,6 +148,8 @@ class MentisSandbox:
             settings: Optional settings for sandbox creation (e.g., image).
             base_url: Base URL of the MentisRuntime.
             api_timeout: Timeout for the creation API call.
+            wait: If False, return as soon as creation has started. The stream then carries
+                "creation_progress" observations, and creation_progress() reports the step.
             **kwargs: Additional arguments passed to the MentisSandbox constructor.
 
         Returns:
@@ -155,8 +161,8 @@ class MentisSandbox:
         try:
             # Use a temporary client for creation to respect specific timeout
             with httpx.Client(timeout=api_timeout) as create_client:
-                response = create_client.post(url, json=settings or {})
-                if response.status_code == 201:
+                response = create_client.post(url, json=settings or {}, params=None if wait else {"wait": "false"})
+                if response.status_code == (201 if wait else 202):
                     data = response.json()
                     sandbox_id = data['sandbox_id']
                     # Verify space_id matches if returned (optional but good practice)
@@ -223,18 +229,44 @@ class MentisSandbox:
 
     # --- Action Methods (Phase 1) ---
 
-    def run_shell_command(self, command: str, work_dir: Optional[str]=None, env: Optional[Dict[str,str]]=None, timeout: Optional[int]=None) -> str:
+    def run_shell_command(self, command: str, work_dir: Optional[str]=None, env: Optional[Dict[str,str]]=None, timeout: Optional[int]=None, priority: Optional[int]=None, large_output: bool=False, coalesce: Optional[Dict[str,int]]=None, metadata: Optional[Dict[str,Any]]=None, cwd: Optional[str]=None, shell: Optional[str]=None, login: bool=False, aggregate: Optional[str]=None, cache: bool=False, user: Optional[str]=None) -> str:
         """
         Initiates a shell command execution. Returns an action_id.
+        shell ("bash", "sh" or "zsh", if installed in the image; "powershell", "pwsh" or
+        "cmd" in Windows containers) and login (a login shell, sourcing the profiles that
+        set up PATH) choose how the command runs; by default it runs with /bin/sh.
+        cwd (absolute; work_dir is its older name) and env apply to this command only, so
+        commands need no `cd X && VAR=Y ...` prefix.
         Results are received via the connected observation stream/callback.
+        In sandboxes created with action_queue, higher priority actions run first.
+        With large_output, output arrives while the command runs as OutputChunkObservation
+        raw chunks instead of line "stream" observations, and is not kept in the history.
+        coalesce ({"window_ms": 50, "max_bytes": 16384}) batches output lines into fewer
+        "stream" observations; zeros turn off the runtime's default batching.
+        metadata (such as {"step_id": "s1"}) is added to every observation of the action.
+        aggregate ("merged" or "separate") adds the output to the "end" observation's data, as
+        "output" in the order received, or as "stdout" and "stderr".
+        cache returns the result of an identical earlier successful command, replayed under a
+        new action_id with "cache_hit" in the "end" observation's data, instead of running it.
+        user ("nobody", "1000" or "1000:1000") runs the command as another user, if the
+        sandbox's security profile allows it.
         """
         payload = {"command": command}
-        if work_dir: payload["work_dir"] = work_dir
+        if large_output: payload["large_output"] = True
+        if shell: payload["shell"] = shell
+        if login: payload["login"] = True
+        if cwd or work_dir: payload["cwd"] = cwd or work_dir
         if env: payload["env"] = env
         if timeout: payload["timeout"] = timeout
+        if priority is not None: payload["priority"] = priority
+        if coalesce is not None: payload["coalesce"] = coalesce
+        if metadata: payload["metadata"] = metadata
+        if aggregate: payload["aggregate"] = aggregate
+        if cache: payload["cache"] = True
+        if user: payload["user"] = user
         return self._post_action("tools:run_shell_command", payload)
 
-    def run_ipython_cell(self, code: str, timeout: Optional[int]=None) -> str:
+    def run_ipython_cell(self, code: str, timeout: Optional[int]=None, priority: Optional[int]=None, coalesce: Optional[Dict[str,int]]=None, metadata: Optional[Dict[str,Any]]=None, cwd: Optional[str]=None, env: Optional[Dict[str,str]]=None, aggregate: Optional[str]=None, kernel_id: Optional[str]=None, cache: bool=False) -> str:
         """
         Initiates an IPython cell execution. Returns an action_id.
         Results are received via the connected observation stream/callback.
@@ -242,6 +274,14 @@ class MentisSandbox:
         Args:
             code: The Python code to execute
             timeout: Maximum time to wait for execution to complete (seconds)
+            priority: Queue priority in sandboxes created with action_queue; higher runs first
+            coalesce: Batching of output lines, {"window_ms": 50, "max_bytes": 16384}
+            metadata: Client metadata, such as an agent step ID, added to every observation of the action
+            cwd: Absolute working directory of the kernel while the cell runs
+            env: Environment variables set while the cell runs, restored afterwards
+            aggregate: "merged" or "separate", to get the output in the "end" observation's data
+            kernel_id: Named kernel to run the cell in (see create_kernel); the default kernel if unset
+            cache: Replay the result of an identical earlier successful cell instead of running it
             
         Returns:
             The action_id for tracking the execution
@@ -250,9 +290,102 @@ class MentisSandbox:
             MentisSandboxError: If execution fails
         """
         payload = {"code": code}
+        if cwd: payload["cwd"] = cwd
+        if env: payload["env"] = env
         if timeout: payload["timeout"] = timeout
+        if priority is not None: payload["priority"] = priority
+        if coalesce is not None: payload["coalesce"] = coalesce
+        if metadata: payload["metadata"] = metadata
+        if aggregate: payload["aggregate"] = aggregate
+        if kernel_id: payload["kernel_id"] = kernel_id
+        if cache: payload["cache"] = True
         return self._post_action("tools:run_ipython_cell", payload)
 
+    # --- Kernel Methods ---
+
+    def _sandbox_request(self, method: str, path: str, expected: int, payload: Optional[Dict[str, Any]] = None) -> Any:
+        """Helper for the endpoints of the sandbox; returns the decoded response body, if any."""
+        separator = "" if path.startswith(":") else "/" # Custom methods such as ":replay"
+        url = f"/spaces/{self.space_id}/sandboxes/{self.sandbox_id}{separator}{path}"
+        try:
+            response = self._client.request(method, url, json=payload)
+        except httpx.RequestError as e:
+            raise ConnectionError(f"API request failed for {method} {url}: {e}") from e
+        if response.status_code != expected:
+            try:
+                error_detail = response.json().get('message', response.text)
+            except Exception:
+                error_detail = response.text
+            raise APIError(f"{method} {path} failed (HTTP {response.status_code}): {error_detail}", status_code=response.status_code)
+        return response.json() if response.content else None
+
+    def create_kernel(self, kernel_id: str) -> Dict[str, Any]:
+        """
+        Starts a named IPython kernel with its own variables and imports. Cells run in it
+        when run_ipython_cell is given its kernel_id. Kernels share the sandbox's processes,
+        files and installed packages, and cells of all kernels run one at a time.
+        """
+        return self._sandbox_request("POST", "kernels", 201, {"kernel_id": kernel_id})
+
+    def list_kernels(self) -> List[Dict[str, Any]]:
+        """Lists the kernels of the sandbox, the "default" kernel first, with their executions."""
+        return self._sandbox_request("GET", "kernels", 200)
+
+    def delete_kernel(self, kernel_id: str) -> None:
+        """Stops a named kernel, discarding its variables. The default kernel cannot be deleted."""
+        self._sandbox_request("DELETE", f"kernels/{kernel_id}", 204)
+
+    def recording(self) -> Dict[str, Any]:
+        """
+        Returns the actions issued against the sandbox, in order, with their exit codes and
+        output digests.
+        """
+        return self._sandbox_request("GET", "recording", 200)
+
+    def replay(self, space_id: Optional[str] = None) -> Dict[str, Any]:
+        """
+        Replays the sandbox's recorded actions in a fresh sandbox created from the same image
+        ID and settings. Returns the replay: its "sandbox_id" is the new sandbox, whose
+        replay_status() reports whether each action's exit code and output matched.
+        """
+        return self._sandbox_request("POST", ":replay", 202, {"space_id": space_id} if space_id else None)
+
+    def creation_progress(self) -> Dict[str, Any]:
+        """
+        Returns how far the creation of the sandbox has got: its "step" ("pulling_image",
+        "creating_container", "starting_container", "waiting_for_agent", "running_setup",
+        "ready" or "failed", with an "error"), and the "percent" of an image pull.
+        """
+        return self._sandbox_request("GET", "progress", 200)
+
+    def replay_status(self) -> Dict[str, Any]:
+        """Returns the progress of the replay that created this sandbox."""
+        return self._sandbox_request("GET", "replay", 200)
+
+    def timeline(self, since: Optional[str] = None, until: Optional[str] = None) -> Dict[str, Any]:
+        """
+        Returns the sandbox's observation history as a timeline: a span per action with its
+        duration, exit code and output counts, and the events of no action. since and until
+        are RFC 3339 timestamps.
+        """
+        params = {k: v for k, v in {"since": since, "until": until}.items() if v}
+        url = f"/spaces/{self.space_id}/sandboxes/{self.sandbox_id}/timeline"
+        try:
+            response = self._client.get(url, params=params)
+        except httpx.RequestError as e:
+            raise ConnectionError(f"API request failed for GET {url}: {e}") from e
+        if response.status_code != 200:
+            raise APIError(f"GET timeline failed (HTTP {response.status_code}): {response.text}", status_code=response.status_code)
+        return response.json()
+
+    def jupyter_url(self) -> str:
+        """
+        Returns the base URL of the sandbox's Jupyter server, for sandboxes created with
+        settings={"jupyter": True}. Jupyter clients use it as the server URL without a token;
+        the runtime authenticates the request and adds the server's token.
+        """
+        return f"{self.api_url}/spaces/{self.space_id}/sandboxes/{self.sandbox_id}/jupyter/"
+
     # --- Streaming Connection Methods ---
 
     def connect_stream(self, timeout: Optional[float] = None):
@@ -302,6 +435,22 @@ class MentisSandbox:
         logger.info("WebSocket stream connected successfully (connect_stream method finished).") # Modified log
 
 
+    def _deliver_observation(self, observation_to_deliver: BaseObservation):
+        """Hands an observation to the queue or callback given to connect_stream."""
+        if self._observation_queue:
+            # **** ADDED LOG ****
+            logger.debug(f"Putting observation into queue: {observation_to_deliver.observation_type} for action {observation_to_deliver.action_id}")
+            self._observation_queue.put(observation_to_deliver)
+        elif self._on_observation_callback:
+            try:
+                # Callback now receives a Pydantic model instance
+                self._on_observation_callback(observation_to_deliver)
+            except Exception as cb_e:
+                 logger.error(f"Error in on_observation_callback: {cb_e}", exc_info=True)
+        else:
+            # Default logging if no handler provided
+            logger.debug(f"Received observation model: {observation_to_deliver}")
+
     def _websocket_listener_sync_wrapper(self):
         """Runs the async listener function in a way compatible with threading."""
         try:
@@ -326,13 +475,18 @@ class MentisSandbox:
         reconnect_delay = self._ws_reconnect_delay # Initial reconnect delay from config
         while not self._stop_event.is_set():
             try:
-                logger.info(f"Attempting to connect to WebSocket: {self.stream_url}") # Existing log
+                # Resume after the last received message so nothing is lost across reconnects
+                stream_url = self.stream_url
+                if self._last_seq is not None:
+                    stream_url = f"{self.stream_url}?cursor={self._last_seq}"
+                logger.info(f"Attempting to connect to WebSocket: {stream_url}") # Existing log
                 # Configure connect options using instance attributes
                 async with websockets.connect(
-                    self.stream_url,
+                    stream_url,
                     ping_interval=self._ws_ping_interval,
                     ping_timeout=self._ws_ping_timeout,
-                    open_timeout=self._ws_connect_timeout # Use configured connect timeout
+                    open_timeout=self._ws_connect_timeout, # Use configured connect timeout
+                    subprotocols=[STREAM_SUBPROTOCOL], # The format parse_observation reads
                 ) as websocket:
                     self._is_connected.set() # Signal successful connection
                     # **** ADDED LOG ****
@@ -351,9 +505,21 @@ class MentisSandbox:
                             logger.debug(f"Raw WebSocket message received: {message[:200]}...") # Log raw message
                             if self._stop_event.is_set(): break # Check again after recv
 
+                            # Binary frames carry the raw output of large_output actions
+                            if isinstance(message, bytes):
+                                try:
+                                    self._deliver_observation(parse_output_frame(message))
+                                except ValueError as frame_err:
+                                    logger.warning(f"Received invalid binary WebSocket frame: {frame_err}")
+                                continue
+
                             # --- Observation Processing ---
                             try:
                                 raw_observation = json.loads(message)
+                                if isinstance(raw_observation, dict) and isinstance(raw_observation.get("seq"), int):
+                                    self._last_seq = raw_observation["seq"]
+                                elif isinstance(raw_observation, dict) and raw_observation.get("observation_type") == "gap":
+                                    logger.warning(f"Missed observations that are no longer recorded: {raw_observation.get('data')}")
                                 # --- Use Pydantic Parsing ---
                                 try:
                                     # parsed_obs will be specific type like CmdStartObservation etc. or BaseObservation/Unknown
@@ -371,19 +537,7 @@ class MentisSandbox:
                                      continue # Skip this malformed message
 
                                 # --- Deliver Observation ---
-                                if self._observation_queue:
-                                    # **** ADDED LOG ****
-                                    logger.debug(f"Putting observation into queue: {observation_to_deliver.observation_type} for action {observation_to_deliver.action_id}")
-                                    self._observation_queue.put(observation_to_deliver)
-                                elif self._on_observation_callback:
-                                    try:
-                                        # Callback now receives a Pydantic model instance
-                                        self._on_observation_callback(observation_to_deliver)
-                                    except Exception as cb_e:
-                                         logger.error(f"Error in on_observation_callback: {cb_e}", exc_info=True)
-                                else:
-                                    # Default logging if no handler provided
-                                    logger.debug(f"Received observation model: {observation_to_deliver}")
+                                self._deliver_observation(observation_to_deliver)
 
                             except json.JSONDecodeError:
                                 logger.warning(f"Received non-JSON WebSocket message: {message[:100]}...")
@@ -608,7 +762,9 @@ class MentisSandbox:
                     # IPython/Cmd Output (stdout/stderr)
                     if obs.observation_type == "stream":
                         if isinstance(obs, IPythonOutputObservationPart):
-                            if obs.stream == "stdout":
+                            if obs.is_binary:
+                                pass # Binary frames (e.g. images) are not part of the text output
+                            elif obs.stream == "stdout":
                                 stdout_buffer += obs.line
                             elif obs.stream == "stderr": # Handle stderr for IPython
                                 stderr_buffer += obs.line
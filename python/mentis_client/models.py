@@ -1,7 +1,8 @@
 # mentis_client/models.py
 from pydantic import BaseModel, Field
 from typing import Optional, Dict, List, Any, Literal, Union
-from datetime import datetime
+from datetime import datetime, timezone
+import base64
 import logging
 
 logger = logging.getLogger(__name__)
@@ -11,6 +12,8 @@ class BaseObservation(BaseModel):
     observation_type: str
     action_id: Optional[str] = None # UUID as string
     timestamp: datetime # Pydantic handles ISO string parsing
+    seq: Optional[int] = None # Stream sequence number; used as the resume cursor on reconnect
+    metadata: Optional[Dict[str, Any]] = None # Client metadata of the action, if it was given any
 
 # --- Specific Observation Models (Phase 1) ---
 
@@ -43,6 +46,23 @@ class IPythonOutputObservationPart(BaseObservation):
     stream: Literal["stdout", "stderr", "display_data", "execute_result", "update_display_data"] # Add others if needed
     data: Any # Can be str for stdout/err, Dict[str, Any] for rich outputs
     line: Optional[str] = None # 服务器发送的'stream'类型使用'line'字段而不是'data'字段
+    # Binary frames carry base64 in 'line'; large payloads are split into chunks sharing chunk_id
+    encoding: Optional[Literal["utf-8", "base64"]] = None
+    mime_type: Optional[str] = None
+    chunk_id: Optional[str] = None
+    chunk_index: Optional[int] = None
+    final: Optional[bool] = None
+    truncated: Optional[bool] = None
+    coalesced: Optional[int] = None # Number of lines batched into 'line' by the runtime
+    stream_seq: Optional[int] = None # Number of the (first) line within its stream, from 1
+
+    @property
+    def is_binary(self) -> bool:
+        return self.encoding == "base64"
+
+    def binary(self) -> bytes:
+        """Decodes the payload of a binary frame (one chunk of it, for chunked payloads)."""
+        return base64.b64decode(self.line or "")
 
 class IPythonResultObservation(BaseObservation):
     observation_type: Literal["IPythonResultObservation", "result", "end"]
@@ -54,6 +74,56 @@ class IPythonResultObservation(BaseObservation):
     error_name: Optional[str] = None
     error_value: Optional[str] = None
     traceback: Optional[List[str]] = None
+    # How the command ended: the signal that killed it ("SIGKILL"), whether the out-of-memory
+    # killer did, and usage (duration_ms, user_cpu_ms, system_cpu_ms, max_rss_bytes)
+    signal: Optional[str] = None
+    oom_killed: Optional[bool] = None
+    usage: Optional[Dict[str, int]] = None
+    # "end": exit_code, signal, oom_killed and usage, and the output of actions run with
+    # aggregate ("output", or "stdout" and "stderr"), and cache_hit for results replayed from
+    # the runtime's result cache
+    data: Optional[Dict[str, Any]] = None
+
+class DisplayDataObservation(BaseObservation):
+    # Jupyter MIME bundle from display() ("display_data") or a cell's last expression ("execute_result")
+    observation_type: Literal["display_data", "execute_result"]
+    data: Dict[str, Any] # MIME type -> representation; binary types such as image/png are base64 text
+    metadata: Dict[str, Any] = Field(default_factory=dict)
+    execution_count: Optional[int] = None # execute_result only
+
+    def text(self) -> Optional[str]:
+        return self.data.get("text/plain")
+
+    def image(self, mime_type: str = "image/png") -> Optional[bytes]:
+        """Decodes a base64 image representation, if the bundle has one."""
+        value = self.data.get(mime_type)
+        return base64.b64decode(value) if value else None
+
+class OutputChunkObservation(BaseObservation):
+    """Raw output of a large_output action, received as a binary WebSocket frame."""
+    observation_type: Literal["output_chunk"] = "output_chunk"
+    stream: Literal["stdout", "stderr"]
+    data: bytes
+
+    def text(self, encoding: str = "utf-8") -> str:
+        """Decodes the chunk; a multi-byte character may be split across chunks."""
+        return self.data.decode(encoding, errors="replace")
+
+# Binary frame layout: frame kind, stream code, action ID length, action ID, output bytes.
+FRAME_OUTPUT = 1
+FRAME_STREAMS = {1: "stdout", 2: "stderr"}
+
+def parse_output_frame(frame: bytes) -> OutputChunkObservation:
+    """Parses a binary WebSocket frame. Raises ValueError for frames of an unknown layout."""
+    if len(frame) < 3 or frame[0] != FRAME_OUTPUT or frame[1] not in FRAME_STREAMS or len(frame) < 3 + frame[2]:
+        raise ValueError(f"not an output frame ({len(frame)} bytes)")
+    end = 3 + frame[2]
+    return OutputChunkObservation(
+        action_id=frame[3:end].decode("ascii"),
+        timestamp=datetime.now(timezone.utc),
+        stream=FRAME_STREAMS[frame[1]],
+        data=bytes(frame[end:]),
+    )
 
 class ErrorObservation(BaseObservation):
     observation_type: Literal["ErrorObservation"]
@@ -76,6 +146,7 @@ StreamMessage = Union[
     IPythonStartObservation,
     IPythonOutputObservationPart,
     IPythonResultObservation,
+    DisplayDataObservation,
     ErrorObservation,
     AgentStateObservation,
     # Add future Observation types here
@@ -133,6 +204,10 @@ def parse_observation(data: Dict[str, Any]) -> BaseObservation:
         logger.debug(f"Converting 'result' observation with action_id: {original_action_id}")
         return IPythonResultObservation(**data_copy)
     
+    if obs_type in ("display_data", "execute_result"):
+        logger.debug(f"Converting '{obs_type}' observation with action_id: {original_action_id}")
+        return DisplayDataObservation(**data_copy)
+
     # 处理标准观察类型
     if obs_type == "CmdStartObservation":
         logger.debug(f"Processing CmdStartObservation with action_id: {original_action_id}")
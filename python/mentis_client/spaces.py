@@ -231,6 +231,75 @@ class SpaceManager:
             raise MentisTimeoutError(f"Request timed out: {str(e)}", timeout=30.0)
         except Exception as e:
             raise MentisResourceError(f"Failed to list spaces: {str(e)}", resource_type="space")
+
+    def transfer_files(
+        self,
+        space_id: str,
+        source_sandbox_id: str,
+        source_path: str,
+        destination_sandbox_id: str,
+        destination_path: str,
+    ) -> Dict[str, Any]:
+        """Copy a file or directory from one sandbox of a space to another
+
+        The runtime streams the data between the containers; paths follow "docker cp".
+
+        Args:
+            space_id: Space ID
+            source_sandbox_id: Sandbox to copy from
+            source_path: Absolute path of the file or directory to copy
+            destination_sandbox_id: Sandbox to copy to
+            destination_path: Existing directory to copy into, or the path of the copy
+
+        Returns:
+            The transfer, with the number of files and bytes copied
+
+        Raises:
+            MentisError: If a sandbox or path is not found or the copy fails
+        """
+        payload = {
+            "source": {"sandbox_id": source_sandbox_id, "path": source_path},
+            "destination": {"sandbox_id": destination_sandbox_id, "path": destination_path},
+        }
+        try:
+            response = self._client.post(f"/v1/spaces/{space_id}/transfers", json=payload)
+            return self._handle_response(response)
+        except httpx.RequestError as e:
+            raise MentisConnectionError(f"Failed to connect to server: {str(e)}", original_error=e)
+        except httpx.TimeoutException as e:
+            raise MentisTimeoutError(f"Request timed out: {str(e)}", timeout=30.0)
+        except Exception as e:
+            raise MentisResourceError(
+                f"Failed to transfer files: {str(e)}",
+                resource_type="space",
+                resource_id=space_id
+            )
+
+    def get_space_endpoints(self, space_id: str) -> Dict[str, Any]:
+        """List the sandboxes on a space's network with their hostnames and addresses
+
+        Args:
+            space_id: Space ID
+
+        Returns:
+            {"space_id", "network", "endpoints": [{"sandbox_id", "hostname", "aliases", "ip_address"}]}
+
+        Raises:
+            MentisError: If the space has no network or the request fails
+        """
+        try:
+            response = self._client.get(f"/v1/spaces/{space_id}/endpoints")
+            return self._handle_response(response)
+        except httpx.RequestError as e:
+            raise MentisConnectionError(f"Failed to connect to server: {str(e)}", original_error=e)
+        except httpx.TimeoutException as e:
+            raise MentisTimeoutError(f"Request timed out: {str(e)}", timeout=30.0)
+        except Exception as e:
+            raise MentisResourceError(
+                f"Failed to list space endpoints: {str(e)}",
+                resource_type="space",
+                resource_id=space_id
+            )
             
     def update_space(self, space_id: str, request: UpdateSpaceRequest) -> Space:
         """Update space information
@@ -403,6 +472,52 @@ class SpaceManager:
                 resource_id=sandbox_id
             )
             
+    def delete_sandboxes(
+        self,
+        space_id: str,
+        sandbox_ids: Optional[List[str]] = None,
+        selector: Optional[Dict[str, str]] = None,
+        force: bool = False,
+    ) -> List[Dict[str, Any]]:
+        """Delete several sandboxes of a space at once
+        
+        Args:
+            space_id: ID of the space containing the sandboxes
+            sandbox_ids: IDs of the sandboxes to delete
+            selector: Labels the sandboxes to delete must all have; used instead of sandbox_ids
+            force: Also delete protected sandboxes and sandboxes with running actions
+            
+        Returns:
+            One result per sandbox, with "sandbox_id", "deleted" and, on failure, "code" and "error"
+            
+        Raises:
+            MentisError: If the request fails
+        """
+        logger.info(f"Deleting sandboxes in space: {space_id}")
+        body: Dict[str, Any] = {}
+        if sandbox_ids:
+            body["sandbox_ids"] = sandbox_ids
+        if selector:
+            body["selector"] = selector
+        try:
+            response = self._client.post(
+                f"/v1/spaces/{space_id}/sandboxes:batchDelete",
+                json=body,
+                params={"force": "true"} if force else None,
+            )
+            data = self._handle_response(response)
+            return data.get("results", [])
+        except httpx.RequestError as e:
+            raise MentisConnectionError(f"Failed to connect to server: {str(e)}", original_error=e)
+        except httpx.TimeoutException as e:
+            raise MentisTimeoutError(f"Request timed out: {str(e)}", timeout=30.0)
+        except Exception as e:
+            raise MentisResourceError(
+                f"Failed to delete sandboxes: {str(e)}",
+                resource_type="sandbox",
+                resource_id=space_id
+            )
+            
     def close(self) -> None:
         """Close the HTTP client"""
         self._client.close()
\ No newline at end of file
@@ -1,18 +1,43 @@
 # -*- coding: utf-8 -*-
 from fastapi import FastAPI, HTTPException, Response
 from IPython.core.interactiveshell import InteractiveShell
-from contextlib import redirect_stdout, redirect_stderr
+from IPython.core.displayhook import DisplayHook
+from IPython.core.displaypub import DisplayPublisher
+from contextlib import contextmanager, redirect_stdout, redirect_stderr
+import base64
 import json
 import threading
 import collections
 import subprocess
 import io
 import os
+import shutil
+import signal
+import sys
+import time
 import requests
 import logging
 import traceback # Import traceback
+import uuid
 from datetime import datetime, timezone # Added for timestamp
 
+try:
+    import msgpack # Optional: observations are sent as JSON without it
+except ImportError:
+    msgpack = None
+try:
+    import resource # POSIX only: Windows agents report no CPU usage
+except ImportError:
+    resource = None
+try:
+    import grp, pwd # POSIX only: Windows agents cannot run commands as another user
+except ImportError:
+    grp = pwd = None
+
+# Windows containers run the agent with PowerShell and cmd instead of POSIX shells, and
+# without process groups, rusage or cgroups.
+IS_WINDOWS = os.name == "nt"
+
 # Import Pydantic models from sandboxai library if possible,
 # otherwise define minimal ones here if needed for request validation/typing.
 # Assuming they are accessible via sandboxai.api.v1 as before
@@ -26,17 +51,28 @@ try:
 except ImportError:
     # Define minimal Pydantic models if import fails (basic structure)
     from pydantic import BaseModel, Field
-    from typing import Optional
+    from typing import Dict, Optional
     logger.warning("Could not import Pydantic models from sandboxai.api.v1, using fallback definitions.")
 
     class RunIPythonCellRequest(BaseModel):
         code: str
+        kernel_id: Optional[str] = None
+        cwd: Optional[str] = None
+        work_dir: Optional[str] = None
+        env: Optional[Dict[str, str]] = None
         split_output: Optional[bool] = False
         action_id: Optional[str] = None
 
     class RunShellCommandRequest(BaseModel):
         command: str
+        shell: Optional[str] = None
+        login: Optional[bool] = False
+        cwd: Optional[str] = None
+        work_dir: Optional[str] = None
+        env: Optional[Dict[str, str]] = None
+        user: Optional[str] = None
         split_output: Optional[bool] = False
+        large_output: Optional[bool] = False
         action_id: Optional[str] = None
 
 
@@ -46,6 +82,199 @@ logging.basicConfig(level=logging.DEBUG, # <-- Set level to DEBUG
                    format='%(asctime)s - %(name)s - %(levelname)s - %(message)s')
 logger = logging.getLogger("mentis-executor")
 
+# Run actions in the sandbox's configured working directory so relative paths are predictable.
+sandbox_workdir = os.environ.get("SANDBOX_WORKDIR")
+if sandbox_workdir:
+    try:
+        os.makedirs(sandbox_workdir, exist_ok=True)
+        os.chdir(sandbox_workdir)
+        logger.info(f"Working directory set to {sandbox_workdir}")
+    except OSError as workdir_err:
+        logger.error(f"Failed to change into SANDBOX_WORKDIR {sandbox_workdir}: {workdir_err}")
+# Shell commands without a cwd run here, even while an IPython cell with a cwd has the
+# process in another directory.
+default_cwd = os.getcwd()
+
+
+def action_cwd(request) -> str:
+    """Returns the working directory of an action: its cwd, or the sandbox's."""
+    return request.cwd or request.work_dir or default_cwd
+
+
+def cwd_error(cwd: str):
+    """Returns why an action cannot run in cwd, or None."""
+    if not os.path.isdir(cwd):
+        return f"cwd {cwd}: no such directory"
+    return None
+
+
+def wait_with_usage(process):
+    """Waits for a command like process.wait(), and returns the resource usage of the command
+    and the children it waited for, or None if the command was reaped elsewhere or the
+    platform does not report it."""
+    if not hasattr(os, "wait4"):
+        process.wait()
+        return None
+    try:
+        _, status, rusage = os.wait4(process.pid, 0)
+    except ChildProcessError:
+        process.wait()
+        return None
+    process.returncode = os.waitstatus_to_exitcode(status)
+    return rusage
+
+
+def oom_kill_count():
+    """Returns how many processes of the container the out-of-memory killer has killed, from
+    the memory cgroup (v2, else v1), or None if the kernel does not report it."""
+    for path in ("/sys/fs/cgroup/memory.events", "/sys/fs/cgroup/memory/memory.oom_control"):
+        try:
+            with open(path) as f:
+                for line in f:
+                    name, _, value = line.partition(" ")
+                    if name == "oom_kill":
+                        return int(value)
+        except (OSError, ValueError):
+            continue
+    return None
+
+
+def command_end(exit_code: int, rusage, started: float, oom_kills_before) -> dict:
+    """
+    Returns the fields of a shell command's "result" that tell how it ended: the signal that
+    killed it, if any, whether that was the out-of-memory killer, and its resource usage. A
+    command killed by a signal exits with a negative code, or with 128 plus the signal
+    number when the shell running it reports the signal.
+    """
+    fields = {"usage": {"duration_ms": int((time.monotonic() - started) * 1000)}}
+    if rusage is not None:
+        fields["usage"].update({
+            "user_cpu_ms": int(rusage.ru_utime * 1000),
+            "system_cpu_ms": int(rusage.ru_stime * 1000),
+            "max_rss_bytes": rusage.ru_maxrss * 1024, # KiB on Linux
+        })
+    signum = 0 if IS_WINDOWS else -exit_code if exit_code < 0 else exit_code - 128 if exit_code > 128 else 0
+    try:
+        name = signal.Signals(signum).name if signum else None
+    except ValueError:
+        name = None
+    if name:
+        fields["signal"] = name
+        if name == "SIGKILL" and oom_kills_before is not None:
+            oom_kills = oom_kill_count()
+            fields["oom_killed"] = oom_kills is not None and oom_kills > oom_kills_before
+    return fields
+
+
+# Shells commands can choose with the "shell" field, those installed in the image.
+SELECTABLE_SHELLS = ("powershell", "pwsh", "cmd") if IS_WINDOWS else ("bash", "sh", "zsh")
+
+
+def available_shells():
+    return [name for name in SELECTABLE_SHELLS if shutil.which(name)]
+
+
+def shell_args(request):
+    """Returns the Popen args of a shell command and whether Popen runs them through /bin/sh:
+    the command itself unless the request chooses a shell or a login shell, which sources the
+    profiles that set up PATH for tools such as nvm or pyenv."""
+    if not request.shell and not request.login:
+        return request.command, True
+    path = shutil.which(request.shell or ("powershell" if IS_WINDOWS else "sh"))
+    if path is None:
+        raise FileNotFoundError(f"shell {request.shell} is not installed")
+    if IS_WINDOWS:
+        if os.path.splitext(os.path.basename(path))[0].lower() == "cmd":
+            return [path, "/S", "/C", request.command], False
+        # PowerShell loads the profiles unless asked not to, so a login shell keeps them
+        flags = ["-Command"] if request.login else ["-NoProfile", "-Command"]
+        return [path, *flags, request.command], False
+    flags = ["-l", "-c"] if request.login else ["-c"]
+    return [path, *flags, request.command], False
+
+
+def signal_command(process, kill=False):
+    """Asks a shell command and its children to stop, or kills them. Windows has no process
+    groups to signal, so there only the command itself is stopped."""
+    if IS_WINDOWS:
+        process.kill() if kill else process.terminate()
+        return
+    os.killpg(process.pid, signal.SIGKILL if kill else signal.SIGTERM)
+
+
+def thread_cpu():
+    """Returns the user and system CPU seconds of the current thread, or None on Windows."""
+    if resource is None:
+        return None
+    usage = resource.getrusage(resource.RUSAGE_THREAD)
+    return usage.ru_utime, usage.ru_stime
+
+
+def action_env(request, user_env=None):
+    """Returns the environment of a shell command with env overrides, or None to inherit the agent's.
+    user_env, the HOME and USER of a command run as another user, applies before the overrides."""
+    if not request.env and not user_env:
+        return None
+    env = dict(os.environ)
+    env.update(user_env or {})
+    env.update(request.env or {})
+    return env
+
+
+def action_user(request):
+    """Returns the Popen arguments and environment that run a shell command as the request's
+    user ("name", "uid", "name:group" or "uid:gid"), and why it cannot if so. Switching to
+    another user needs the agent to run as root; the runtime only allows it when the
+    sandbox's security profile does."""
+    if not getattr(request, "user", None):
+        return {}, None, None
+    if pwd is None:
+        return {}, None, "running commands as another user is not supported on Windows"
+    name, _, group = request.user.partition(":")
+    try:
+        entry = pwd.getpwuid(int(name)) if name.isdigit() else pwd.getpwnam(name)
+    except KeyError:
+        if not name.isdigit():
+            return {}, None, f"user {name}: no such user"
+        entry = None # Numeric users need no passwd entry, as in Docker
+    uid = entry.pw_uid if entry else int(name)
+    gid = entry.pw_gid if entry else uid
+    if group:
+        try:
+            gid = int(group) if group.isdigit() else grp.getgrnam(group).gr_gid
+        except KeyError:
+            return {}, None, f"group {group}: no such group"
+    if os.geteuid() != 0 and uid != os.geteuid():
+        return {}, None, f"user {request.user}: the agent does not run as root and cannot switch users"
+    kwargs = {"user": uid, "group": gid}
+    if os.geteuid() == 0:
+        kwargs["extra_groups"] = [] # Drop root's supplementary groups
+    user_name = entry.pw_name if entry else str(uid)
+    env = {"HOME": entry.pw_dir if entry else "/tmp", "USER": user_name, "LOGNAME": user_name}
+    return kwargs, env, None
+
+
+@contextmanager
+def cell_overrides(cwd: str, env):
+    """Applies the cwd and env overrides of an IPython cell to the kernel process while it
+    runs, restoring the directory and the overridden variables afterwards."""
+    previous_cwd = os.getcwd()
+    previous_env = {name: os.environ.get(name) for name in (env or {})}
+    os.chdir(cwd)
+    os.environ.update(env or {})
+    try:
+        yield
+    finally:
+        for name, value in previous_env.items():
+            if value is None:
+                os.environ.pop(name, None)
+            else:
+                os.environ[name] = value
+        try:
+            os.chdir(previous_cwd)
+        except OSError as restore_err:
+            logger.error(f"[AGENT] Failed to restore working directory {previous_cwd}: {restore_err}")
+
 # 全局锁字典，为每个 sandbox_id 存储一个独立的线程锁
 # defaultdict 会在首次访问不存在的 key 时自动创建 Lock 对象
 ipython_locks = collections.defaultdict(threading.Lock)
@@ -56,6 +285,55 @@ app = FastAPI(
     description="The server that runs python code and shell commands in a MentisSandbox environment.",
 )
 
+# The action whose cell is running; rich outputs are sent as observations for it.
+# Cells run one at a time (see ipython_locks), so a single slot is enough.
+current_display_target = {"url": None, "action_id": None}
+
+
+def jsonable_mime_bundle(bundle: dict) -> dict:
+    """Makes a Jupyter MIME bundle JSON-safe: binary data such as PNG becomes base64 text."""
+    result = {}
+    for mime_type, value in (bundle or {}).items():
+        if isinstance(value, (bytes, bytearray)):
+            value = base64.b64encode(value).decode("ascii")
+        elif not isinstance(value, (str, dict, list, int, float, bool)) and value is not None:
+            value = str(value)
+        result[mime_type] = value
+    return result
+
+
+def send_display(observation_type: str, data: dict, metadata: dict = None, execution_count: int = None):
+    """Sends a display_data or execute_result observation for the running cell."""
+    url, action_id = current_display_target["url"], current_display_target["action_id"]
+    if not url or not action_id or not data:
+        return
+    observation = {
+        "observation_type": observation_type,
+        "action_id": action_id,
+        "data": jsonable_mime_bundle(data),
+        "metadata": jsonable_mime_bundle(metadata or {}),
+    }
+    if execution_count is not None:
+        observation["execution_count"] = execution_count
+    send_observation(url, observation)
+
+
+class ObservationDisplayPublisher(DisplayPublisher):
+    """Sends display() outputs as display_data observations, keeping the text repr on stdout."""
+
+    def publish(self, data, metadata=None, source=None, *, transient=None, update=False, **kwargs):
+        super().publish(data, metadata=metadata, source=source, transient=transient, update=update, **kwargs)
+        send_display("display_data", data, metadata)
+
+
+class ObservationDisplayHook(DisplayHook):
+    """Sends the value of a cell's last expression as an execute_result observation."""
+
+    def write_format_data(self, format_dict, md_dict=None):
+        super().write_format_data(format_dict, md_dict)
+        send_display("execute_result", format_dict, md_dict, self.prompt_count)
+
+
 # Initialize IPython shell
 # Use a try-except block for robustness, especially in container environments
 try:
@@ -64,16 +342,69 @@ try:
     with warnings.catch_warnings():
         warnings.simplefilter("ignore")
         # Disable noisy startup messages if possible (might depend on IPython version)
-        ipy = InteractiveShell.instance(banner1='', exit_msg='')
+        ipy = InteractiveShell.instance(
+            banner1='', exit_msg='',
+            display_pub_class=ObservationDisplayPublisher,
+            displayhook_class=ObservationDisplayHook,
+        )
     logger.info("IPython InteractiveShell initialized successfully.")
 except Exception as ipy_init_err:
     logger.error(f"Failed to initialize IPython InteractiveShell: {ipy_init_err}", exc_info=True)
     ipy = None # Set ipy to None if initialization fails
 
+# Named kernels created through POST /kernels, each a separate shell with its own namespace.
+# Cells choose one with "kernel_id"; the default kernel is ipy. All kernels share the
+# process, so cells still run one at a time (see ipython_locks).
+DEFAULT_KERNEL = "default"
+kernels = {}
+kernels_lock = threading.Lock()
+
+
+def kernel_shell(kernel_id):
+    """Returns the shell of a kernel, or None if there is no such kernel."""
+    if not kernel_id or kernel_id == DEFAULT_KERNEL:
+        return ipy
+    with kernels_lock:
+        return kernels.get(kernel_id)
+
+
+# --- Jupyter server ---
+# Sandboxes created with "jupyter": true get a Jupyter server on JUPYTER_PORT, which Jupyter
+# clients reach through the runtime's proxy. The runtime passes the server's token and base
+# URL (its proxy path) in the environment. Its kernels are separate processes, independent
+# of the kernels cells run in.
+JUPYTER_PORT = 8888
+
+
+def start_jupyter_server():
+    token = os.environ.pop("SANDBOXAI_JUPYTER_TOKEN", "") # Not inherited by actions
+    base_url = os.environ.pop("SANDBOXAI_JUPYTER_BASE_URL", "/")
+    if not token:
+        return None
+    cmd = [
+        sys.executable, "-m", "jupyter_server",
+        "--ip=0.0.0.0", f"--port={JUPYTER_PORT}", "--port-retries=0", "--no-browser", "--allow-root",
+        f"--ServerApp.base_url={base_url}",
+        f"--ServerApp.root_dir={os.getcwd()}",
+        # The runtime authenticates clients and adds the token; browsers see its origin
+        "--ServerApp.disable_check_xsrf=True", "--ServerApp.allow_origin=*",
+    ]
+    try:
+        process = subprocess.Popen(cmd, env=dict(os.environ, JUPYTER_TOKEN=token),
+                                   stdout=subprocess.DEVNULL, stderr=subprocess.DEVNULL, start_new_session=True)
+    except OSError as e:
+        logger.error(f"[AGENT] Failed to start Jupyter server: {e}")
+        return None
+    logger.info(f"[AGENT] Jupyter server started on port {JUPYTER_PORT}, base URL {base_url}")
+    return process
+
+
+jupyter_process = start_jupyter_server()
+
 @app.get(
     "/health",
     summary="Check the health of the API",
-    response_model=None, # No response body for simple health check
+    response_model=None,
     status_code=200,     # Explicitly set success status code
 )
 def health():
@@ -83,7 +414,9 @@ def health():
          # logger.warning("Health check failed: IPython shell not available.")
          # raise HTTPException(status_code=503, detail="IPython shell not available")
          pass # For now, consider agent healthy if FastAPI is running
-    return Response(status_code=200)
+    # The runtime reports the version in GET .../sandboxes/{id}/info, and refuses shell
+    # commands choosing a shell not listed in "shells"
+    return {"status": "ok", "version": app.version, "shells": available_shells()}
 
 
 @app.post(
@@ -107,6 +440,11 @@ def run_ipython_cell(request: RunIPythonCellRequest): # 保持函数签名不变
     action_id = request.action_id # 从请求中获取 action_id
     runtime_observation_url = os.environ.get('RUNTIME_OBSERVATION_URL') # 获取观测 URL
 
+    kernel_id = request.kernel_id or DEFAULT_KERNEL
+    shell = kernel_shell(kernel_id)
+    if shell is None and kernel_id != DEFAULT_KERNEL:
+        raise HTTPException(status_code=404, detail=f"kernel {kernel_id} not found")
+
     logger.info(f"[AGENT] Received IPython cell request. ActionID: {action_id}, SandboxID: {sandbox_id}. Attempting to acquire lock...")
 
     # --- 获取并使用特定于此 sandbox_id 的锁 ---
@@ -121,7 +459,7 @@ def run_ipython_cell(request: RunIPythonCellRequest): # 保持函数签名不变
         # --- (包括检查 ipy 是否 None, try...except 块, ipy.run_cell, ---
         # --- 处理 stdout/stderr, 发送所有相关的 send_observation 调用) ---
 
-        if ipy is None:
+        if shell is None:
             logger.error("IPython shell not initialized, cannot run cell.")
             # 注意：在锁内部抛出异常通常是安全的，with 语句会确保锁被释放
             raise HTTPException(status_code=503, detail="IPython shell not available")
@@ -131,13 +469,41 @@ def run_ipython_cell(request: RunIPythonCellRequest): # 保持函数签名不变
         error_value = None
         formatted_tb = []
 
+        cwd = action_cwd(request)
+        invalid_cwd = cwd_error(cwd)
+        if invalid_cwd:
+            logger.warning(f"[AGENT] {invalid_cwd}. ActionID: {action_id}")
+            if runtime_observation_url and action_id:
+                send_observation(runtime_observation_url, {
+                    "observation_type": "result",
+                    "action_id": action_id,
+                    "exit_code": 1,
+                    "status": "error",
+                    "error_name": "FileNotFoundError",
+                    "error_value": invalid_cwd,
+                    "traceback": [],
+                })
+            return Response(status_code=200)
+
         try:
             stdout_buf = io.StringIO()
             stderr_buf = io.StringIO()
 
-            with redirect_stdout(stdout_buf), redirect_stderr(stderr_buf):
-                # 实际执行 IPython 代码
-                exec_result = ipy.run_cell(request.code, store_history=True)
+            current_display_target["url"] = runtime_observation_url
+            current_display_target["action_id"] = action_id
+            started, cpu_before = time.monotonic(), thread_cpu()
+            try:
+                with cell_overrides(cwd, request.env), redirect_stdout(stdout_buf), redirect_stderr(stderr_buf):
+                    # 实际执行 IPython 代码
+                    exec_result = shell.run_cell(request.code, store_history=True)
+            finally:
+                current_display_target["url"] = None
+                current_display_target["action_id"] = None
+            cpu_after = thread_cpu()
+            usage = {"duration_ms": int((time.monotonic() - started) * 1000)}
+            if cpu_before is not None:
+                usage["user_cpu_ms"] = int((cpu_after[0] - cpu_before[0]) * 1000)
+                usage["system_cpu_ms"] = int((cpu_after[1] - cpu_before[1]) * 1000)
 
             stdout = stdout_buf.getvalue()
             stderr = stderr_buf.getvalue()
@@ -174,9 +540,9 @@ def run_ipython_cell(request: RunIPythonCellRequest): # 保持函数签名不变
                            ex_type, ex_value, tb = error_info
                            error_name = ex_type.__name__
                            error_value = str(ex_value)
-                           if hasattr(ipy, 'InteractiveTB') and hasattr(ipy.InteractiveTB, 'structured_traceback'):
-                                stb = ipy.InteractiveTB.structured_traceback(ex_type, ex_value, tb)
-                                formatted_tb = ipy.InteractiveTB.format_structured_traceback(stb)
+                           if hasattr(shell, 'InteractiveTB') and hasattr(shell.InteractiveTB, 'structured_traceback'):
+                                stb = shell.InteractiveTB.structured_traceback(ex_type, ex_value, tb)
+                                formatted_tb = shell.InteractiveTB.format_structured_traceback(stb)
                            else:
                                 formatted_tb = traceback.format_exception(ex_type, ex_value, tb)
                        except Exception as format_err:
@@ -198,6 +564,7 @@ def run_ipython_cell(request: RunIPythonCellRequest): # 保持函数签名不变
                         "error_name": error_name,
                         "error_value": error_value,
                         "traceback": formatted_tb,
+                        "usage": usage,
                     })
                 else:
                     exit_code = 0
@@ -205,7 +572,8 @@ def run_ipython_cell(request: RunIPythonCellRequest): # 保持函数签名不变
                         "observation_type": "result",
                         "action_id": action_id,
                         "exit_code": exit_code,
-                        "status": "ok"
+                        "status": "ok",
+                        "usage": usage,
                     })
             else:
                  logger.warning(f"[AGENT] Cannot send observations: URL missing or action_id missing. URL={runtime_observation_url}, ActionID={action_id}")
@@ -270,48 +638,79 @@ def run_shell_command(request: RunShellCommandRequest):
     exit_code = -1
     error_output = None
 
+    cwd = action_cwd(request)
+    run_as, user_env, invalid_user = action_user(request)
+    invalid = cwd_error(cwd) or invalid_user
+    if invalid:
+        logger.warning(f"[AGENT] {invalid}. ActionID: {action_id}")
+        if runtime_observation_url and action_id:
+            send_observation(runtime_observation_url, {
+                "observation_type": "result",
+                "action_id": action_id,
+                "exit_code": 1,
+                "error": invalid,
+            })
+        return Response(status_code=200)
+
     try:
+        args, use_sh = shell_args(request)
+        started, oom_kills_before = time.monotonic(), oom_kill_count()
         process = subprocess.Popen(
-            request.command,
-            shell=True,
+            args,
+            shell=use_sh,
+            cwd=cwd,
+            env=action_env(request, user_env),
             stdout=subprocess.PIPE,
             stderr=subprocess.PIPE,
-            text=True,
+            start_new_session=True, # Own process group, so shutdown can signal its children too
+            **run_as,
         )
+        with shell_processes_lock:
+            shell_processes.add(process)
 
-        stdout, stderr = process.communicate()
+        # Read bytes: lines that are not valid UTF-8 are forwarded as base64 frames
+        try:
+            if request.large_output and runtime_observation_url and action_id:
+                # Relay raw output while the command runs instead of line observations after it ends
+                relays = [
+                    threading.Thread(target=stream_raw_output, args=(runtime_observation_url, action_id, name, pipe))
+                    for name, pipe in (("stdout", process.stdout), ("stderr", process.stderr))
+                ]
+                for relay in relays:
+                    relay.start()
+                for relay in relays:
+                    relay.join()
+                rusage = wait_with_usage(process)
+                stdout_bytes = stderr_bytes = b""
+            else:
+                # Send lines while the command runs, in the order they are read from its pipes,
+                # so stdout and stderr lines keep their relative order
+                send_lock = threading.Lock()
+                captured = {"stdout": [], "stderr": []}
+                relays = [
+                    threading.Thread(target=relay_lines, args=(runtime_observation_url, action_id, name, pipe, send_lock, captured[name]))
+                    for name, pipe in (("stdout", process.stdout), ("stderr", process.stderr))
+                ]
+                for relay in relays:
+                    relay.start()
+                for relay in relays:
+                    relay.join()
+                rusage = wait_with_usage(process)
+                stdout_bytes, stderr_bytes = b"".join(captured["stdout"]), b"".join(captured["stderr"])
+        finally:
+            with shell_processes_lock:
+                shell_processes.discard(process)
+        stdout = stdout_bytes.decode("utf-8", errors="replace")
+        stderr = stderr_bytes.decode("utf-8", errors="replace")
         exit_code = process.returncode
 
         logger.info(f"[AGENT] Shell command finished. ActionID: {action_id}. ExitCode: {exit_code}. Stdout: {len(stdout)} chars. Stderr: {len(stderr)} chars.")
 
         # --- Send Observations ---
         if runtime_observation_url and action_id:
-            # Send stdout lines
-            if stdout:
-                stdout_lines = stdout.rstrip('\n').split('\n')
-                for line in stdout_lines:
-                    if line:
-                        send_observation(runtime_observation_url, {
-                            "observation_type": "stream", # Correct key
-                            "action_id": action_id,
-                            "stream": "stdout",
-                            "line": line
-                        })
-
-            # Send stderr lines
-            if stderr:
-                stderr_lines = stderr.rstrip('\n').split('\n')
-                if exit_code != 0:
-                    error_output = stderr.strip()
-
-                for line in stderr_lines:
-                    if line:
-                         send_observation(runtime_observation_url, {
-                            "observation_type": "stream", # Correct key
-                            "action_id": action_id,
-                            "stream": "stderr",
-                            "line": line
-                        })
+            # Output lines were sent while the command ran
+            if stderr and exit_code != 0:
+                error_output = stderr.strip()
 
             # Send final result observation
             send_observation(runtime_observation_url, {
@@ -319,6 +718,7 @@ def run_shell_command(request: RunShellCommandRequest):
                 "action_id": action_id,
                 "exit_code": exit_code,
                 "error": error_output,
+                **command_end(exit_code, rusage, started, oom_kills_before),
             })
         else:
              logger.warning(f"[AGENT] Cannot send observations: URL={runtime_observation_url}, action_id={action_id}")
@@ -342,6 +742,263 @@ def run_shell_command(request: RunShellCommandRequest):
         raise HTTPException(status_code=500, detail=error_msg)
 
 
+# Shell commands that are still running, so /shutdown can stop them.
+shell_processes = set()
+shell_processes_lock = threading.Lock()
+
+
+# --- Filesystem watches ---
+# Each watch runs an `inotifywait -m` subprocess and forwards its events as
+# "fs_event" observations. Keyed by watch_id.
+watches = {}
+watches_lock = threading.Lock()
+
+# Map inotify event names onto the smaller vocabulary exposed by the runtime.
+INOTIFY_EVENT_MAP = {
+    "CREATE": "create",
+    "MODIFY": "modify",
+    "CLOSE_WRITE": "modify",
+    "DELETE": "delete",
+    "DELETE_SELF": "delete",
+    "MOVED_FROM": "move",
+    "MOVED_TO": "move",
+}
+
+
+@app.post("/watches", summary="Start watching a path for filesystem events", status_code=200)
+def create_watch(request: dict):
+    watch_id = request.get("watch_id")
+    path = request.get("path")
+    if not watch_id or not path:
+        raise HTTPException(status_code=400, detail="watch_id and path are required")
+    if not os.path.exists(path):
+        raise HTTPException(status_code=404, detail=f"path {path} does not exist")
+
+    wanted = set(request.get("events") or [])
+    cmd = ["inotifywait", "-m", "-q", "--format", "%e|%w%f",
+           "-e", "create,modify,close_write,delete,delete_self,moved_from,moved_to"]
+    if request.get("recursive"):
+        cmd.append("-r")
+    cmd.append(path)
+
+    try:
+        process = subprocess.Popen(cmd, stdout=subprocess.PIPE, stderr=subprocess.DEVNULL, text=True)
+    except FileNotFoundError:
+        raise HTTPException(status_code=501, detail="inotifywait is not available in this sandbox")
+
+    runtime_observation_url = os.environ.get('RUNTIME_OBSERVATION_URL')
+
+    def forward_events():
+        for raw in process.stdout:
+            flags, _, changed = raw.rstrip("\n").partition("|")
+            flag_list = flags.split(",")
+            event = next((INOTIFY_EVENT_MAP[f] for f in flag_list if f in INOTIFY_EVENT_MAP), None)
+            if event is None or (wanted and event not in wanted):
+                continue
+            send_observation(runtime_observation_url, {
+                "observation_type": "fs_event",
+                "action_id": "",
+                "watch_id": watch_id,
+                "data": {
+                    "watch_id": watch_id,
+                    "path": changed,
+                    "event": event,
+                    "is_dir": "ISDIR" in flag_list,
+                },
+            })
+
+    with watches_lock:
+        watches[watch_id] = process
+    threading.Thread(target=forward_events, daemon=True).start()
+    logger.info(f"[AGENT] Watch started. WatchID: {watch_id}, Path: {path}")
+    return Response(status_code=200)
+
+
+@app.delete("/watches/{watch_id}", summary="Stop a filesystem watch", status_code=200)
+def delete_watch(watch_id: str):
+    with watches_lock:
+        process = watches.pop(watch_id, None)
+    if process is None:
+        raise HTTPException(status_code=404, detail=f"watch {watch_id} not found")
+    process.terminate()
+    logger.info(f"[AGENT] Watch stopped. WatchID: {watch_id}")
+    return Response(status_code=200)
+
+
+@app.post("/kernels", summary="Start a named IPython kernel", status_code=200)
+def create_kernel(request: dict):
+    kernel_id = request.get("kernel_id")
+    if not kernel_id:
+        raise HTTPException(status_code=400, detail="kernel_id is required")
+    with kernels_lock:
+        if kernel_id == DEFAULT_KERNEL or kernel_id in kernels:
+            raise HTTPException(status_code=409, detail=f"kernel {kernel_id} already exists")
+        try:
+            kernels[kernel_id] = InteractiveShell(
+                banner1='', exit_msg='',
+                display_pub_class=ObservationDisplayPublisher,
+                displayhook_class=ObservationDisplayHook,
+            )
+        except Exception as e:
+            logger.error(f"[AGENT] Failed to start kernel {kernel_id}: {e}", exc_info=True)
+            raise HTTPException(status_code=500, detail=f"failed to start kernel: {e}")
+    logger.info(f"[AGENT] Kernel started. KernelID: {kernel_id}")
+    return Response(status_code=200)
+
+
+@app.delete("/kernels/{kernel_id}", summary="Stop a named IPython kernel", status_code=200)
+def delete_kernel(kernel_id: str):
+    with kernels_lock:
+        shell = kernels.pop(kernel_id, None)
+    if shell is None:
+        raise HTTPException(status_code=404, detail=f"kernel {kernel_id} not found")
+    with ipython_locks[os.environ.get('SANDBOX_ID')]: # Not while one of its cells runs
+        shell.reset(new_session=False)
+    logger.info(f"[AGENT] Kernel stopped. KernelID: {kernel_id}")
+    return Response(status_code=200)
+
+
+# Seconds running shell commands get to exit after SIGTERM before they are killed.
+SHUTDOWN_KILL_GRACE = 3
+
+
+@app.post("/shutdown", summary="Prepare the sandbox for stopping", status_code=200)
+def shutdown():
+    """
+    Called by the runtime before it stops the container. Stops watches, terminates running
+    shell commands so their output and results are still sent, stops the Jupyter server,
+    saves the IPython history, and sends a final "shutdown" observation.
+    """
+    runtime_observation_url = os.environ.get('RUNTIME_OBSERVATION_URL')
+    logger.info("[AGENT] Shutdown requested")
+
+    with watches_lock:
+        stopped_watches = list(watches.values())
+        watches.clear()
+    for process in stopped_watches:
+        process.terminate()
+
+    with shell_processes_lock:
+        running = list(shell_processes)
+    for process in running:
+        try:
+            signal_command(process)
+        except ProcessLookupError:
+            pass
+    for process in running:
+        try:
+            process.wait(timeout=SHUTDOWN_KILL_GRACE)
+        except subprocess.TimeoutExpired:
+            try:
+                signal_command(process, kill=True)
+            except ProcessLookupError:
+                pass
+
+    if jupyter_process is not None and jupyter_process.poll() is None:
+        jupyter_process.terminate() # Shuts down its kernels too
+
+    with kernels_lock:
+        shells = [ipy] + list(kernels.values())
+    for shell in shells:
+        if shell is None:
+            continue
+        try:
+            shell.atexit_operations()
+        except Exception as e:
+            logger.error(f"[AGENT] Failed to shut down IPython shell: {e}")
+
+    send_observation(runtime_observation_url, {
+        "observation_type": "shutdown",
+        "action_id": None,
+        "terminated_commands": len(running),
+    })
+    return Response(status_code=200)
+
+
+# Decoded bytes per binary stream frame; larger payloads are split into chunks.
+BINARY_CHUNK_BYTES = 192 * 1024
+
+
+def send_stream_line(url: str, action_id: str, stream: str, raw_line: bytes):
+    """Sends a line, without its newline, as a text frame, or as base64 frames if it is not
+    UTF-8. Empty lines are skipped."""
+    if not raw_line:
+        return
+    try:
+        line = raw_line.decode("utf-8")
+    except UnicodeDecodeError:
+        send_binary(url, action_id, stream, raw_line)
+        return
+    send_observation(url, {
+        "observation_type": "stream",
+        "action_id": action_id,
+        "stream": stream,
+        "line": line,
+    })
+
+
+def relay_lines(url, action_id, stream: str, pipe, send_lock, captured: list):
+    """
+    Sends the lines of a command's pipe as the command flushes them, and keeps them in
+    captured. send_lock serializes the sends of the command's stdout and stderr relays, so
+    the runtime receives lines in the order they were read and numbers each stream in order.
+    """
+    for raw_line in iter(pipe.readline, b""):
+        captured.append(raw_line)
+        if url and action_id:
+            with send_lock:
+                send_stream_line(url, action_id, stream, raw_line.rstrip(b"\n"))
+
+
+# Bytes read from a command's pipe per request chunk in large-output mode.
+RAW_CHUNK_BYTES = 64 * 1024
+
+
+def stream_raw_output(url: str, action_id: str, stream: str, pipe):
+    """
+    Streams a pipe to the runtime as one chunked HTTP request, without JSON wrapping. The
+    runtime relays each chunk to stream clients as a binary frame as it arrives.
+    """
+    def chunks():
+        for chunk in iter(lambda: pipe.read1(RAW_CHUNK_BYTES), b""):
+            yield chunk
+
+    try:
+        response = requests.post(
+            f"{url}/output/{action_id}",
+            params={"stream": stream},
+            data=chunks(), # A generator body is sent with chunked transfer encoding
+            headers={"Content-Type": "application/octet-stream"},
+        )
+        response.raise_for_status()
+    except requests.exceptions.RequestException as e:
+        logger.warning(f"[AGENT] Failed to stream {stream} to runtime. ActionID: {action_id}, Error: {e}")
+    # Drain what was not sent, so the command never blocks on a full pipe
+    for _ in iter(lambda: pipe.read1(RAW_CHUNK_BYTES), b""):
+        pass
+
+
+def send_binary(url: str, action_id: str, stream: str, payload: bytes, mime_type: str = "application/octet-stream"):
+    """
+    Sends binary data as base64 "stream" frames. Frames of one payload share a chunk_id,
+    carry increasing chunk_index values, and the last one has final set.
+    """
+    chunk_id = str(uuid.uuid4())
+    chunks = [payload[i:i + BINARY_CHUNK_BYTES] for i in range(0, len(payload), BINARY_CHUNK_BYTES)] or [b""]
+    for index, chunk in enumerate(chunks):
+        send_observation(url, {
+            "observation_type": "stream",
+            "action_id": action_id,
+            "stream": stream,
+            "encoding": "base64",
+            "mime_type": mime_type,
+            "chunk_id": chunk_id,
+            "chunk_index": index,
+            "final": index == len(chunks) - 1,
+            "line": base64.b64encode(chunk).decode("ascii"),
+        })
+
+
 def send_observation(url: str, data: dict):
     """
     Send observation data to the runtime service. Logs errors.
@@ -376,12 +1033,21 @@ def send_observation(url: str, data: dict):
     # ---
 
     try:
-        response = requests.post(
-            url,
-            json=data, # requests 会自动设置 Content-Type: application/json
-            headers={"Content-Type": "application/json"}, # 明确设置以防万一
-            timeout=10 # 设置请求超时
-        )
+        if msgpack is not None and os.environ.get("OBSERVATION_ENCODING") == "msgpack":
+            # 运行时要求 MessagePack 时，编码更省 CPU 和带宽
+            response = requests.post(
+                url,
+                data=msgpack.packb(data, use_bin_type=True),
+                headers={"Content-Type": "application/msgpack"},
+                timeout=10
+            )
+        else:
+            response = requests.post(
+                url,
+                json=data, # requests 会自动设置 Content-Type: application/json
+                headers={"Content-Type": "application/json"}, # 明确设置以防万一
+                timeout=10 # 设置请求超时
+            )
         response.raise_for_status() # 对 4xx/5xx 状态码抛出异常
         # 发送成功后可以只记录 Info 或 Debug 级别的日志
         logger.debug(f"[AGENT] Observation sent successfully. ActionID: {action_id}, Type: {obs_type}, Status: {response.status_code}")